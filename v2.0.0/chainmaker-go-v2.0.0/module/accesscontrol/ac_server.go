@@ -15,6 +15,7 @@ import (
 	"sync/atomic"
 
 	"chainmaker.org/chainmaker-go/localconf"
+	"chainmaker.org/chainmaker-go/utils"
 	"chainmaker.org/chainmaker/common/v2/concurrentlru"
 	"chainmaker.org/chainmaker/common/v2/crypto/pkcs11"
 	bcx509 "chainmaker.org/chainmaker/common/v2/crypto/x509"
@@ -317,6 +318,12 @@ func (acs *accessControlService) createDefaultResourcePolicy(localOrgId string)
 		syscontract.ContractManageFunction_UNFREEZE_CONTRACT.String(), policyConfig)
 	acs.resourceNamePolicyMap.Store(syscontract.SystemContract_CONTRACT_MANAGE.String()+"-"+
 		syscontract.ContractManageFunction_REVOKE_CONTRACT.String(), policyConfig)
+	acs.resourceNamePolicyMap.Store(syscontract.SystemContract_CONTRACT_MANAGE.String()+"-"+
+		utils.ContractManageRollbackContract, policyConfig)
+	acs.resourceNamePolicyMap.Store(syscontract.SystemContract_CONTRACT_MANAGE.String()+"-"+
+		utils.ContractManageSetMethodAcl, policyConfig)
+	acs.resourceNamePolicyMap.Store(syscontract.SystemContract_CONTRACT_MANAGE.String()+"-"+
+		utils.ContractManageDeleteMethodAcl, policyConfig)
 
 	// certificate management
 	acs.resourceNamePolicyMap.Store(syscontract.SystemContract_CERT_MANAGE.String()+"-"+
@@ -518,6 +525,19 @@ func (acs *accessControlService) createPrincipalForTargetOrg(resourceName string
 	return p, nil
 }
 
+// policyPrincipal is the principal which carries its own policy, e.g. the method ACL of a user contract
+// which is stored on chain. The policy is verified instead of the one configured for the resource name.
+type policyPrincipal interface {
+	GetPolicy() *pbac.Policy
+}
+
+func (acs *accessControlService) lookUpPolicyOfPrincipal(principal protocol.Principal) (*policy, error) {
+	if p, ok := principal.(policyPrincipal); ok && p.GetPolicy() != nil {
+		return newPolicyFromPb(p.GetPolicy()), nil
+	}
+	return acs.lookUpPolicyByResourceName(principal.GetResourceName())
+}
+
 func (acs *accessControlService) lookUpPolicyByResourceName(resourceName string) (*policy, error) {
 	p, ok := acs.resourceNamePolicyMap.Load(resourceName)
 	if !ok {
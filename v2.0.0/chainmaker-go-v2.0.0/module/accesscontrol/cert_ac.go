@@ -574,7 +574,7 @@ func (cp *certACProvider) VerifyPrincipal(principal protocol.Principal) (bool, e
 		return true, nil
 	}
 
-	p, err := cp.acService.lookUpPolicyByResourceName(principal.GetResourceName())
+	p, err := cp.acService.lookUpPolicyOfPrincipal(principal)
 	if err != nil {
 		return false, fmt.Errorf("authentication failed, [%s]", err.Error())
 	}
@@ -993,7 +993,7 @@ func (cp *certACProvider) GetValidEndorsements(principal protocol.Principal) ([]
 	}
 	endorsements := refinedPolicy.GetEndorsement()
 
-	p, err := cp.acService.lookUpPolicyByResourceName(principal.GetResourceName())
+	p, err := cp.acService.lookUpPolicyOfPrincipal(principal)
 	if err != nil {
 		return nil, fmt.Errorf("authentication fail: [%v]", err)
 	}
@@ -430,6 +430,53 @@ func TestVerifyPrincipal(t *testing.T) {
 	fmt.Printf("Verify CONSENSUS average time (over %d runs in nanoseconds): %d\n", count, (timeEnd-timeStart)/count)
 }
 
+type testPolicyPrincipal struct {
+	protocol.Principal
+	policy *pbac.Policy
+}
+
+func (p *testPolicyPrincipal) GetPolicy() *pbac.Policy {
+	return p.policy
+}
+
+func TestVerifyPolicyPrincipal(t *testing.T) {
+	_, cleanFunc, err := createTempDirWithCleanFunc()
+	require.Nil(t, err)
+	defer cleanFunc()
+
+	var orgMemberMap = make(map[string]*orgMember, len(orgMemberInfoMap))
+	for orgId, info := range orgMemberInfoMap {
+		orgMemberMap[orgId] = initOrgMember(t, info)
+	}
+	acProvider := orgMemberMap[testOrg2].acProvider
+
+	endorsementClient, err := createEndorsementEntry(orgMemberMap, string(protocol.RoleClient), testOrg1,
+		testHashType, testMsg)
+	require.Nil(t, err)
+	principal, err := acProvider.CreatePrincipal("contract1-method1", []*common.EndorsementEntry{endorsementClient},
+		[]byte(testMsg))
+	require.Nil(t, err)
+
+	// the resource has no policy configured, the policy carried by the principal is verified
+	_, err = acProvider.VerifyPrincipal(principal)
+	require.NotNil(t, err)
+	ok, err := acProvider.VerifyPrincipal(&testPolicyPrincipal{Principal: principal, policy: &pbac.Policy{
+		Rule: string(protocol.RuleAny), OrgList: []string{testOrg1}, RoleList: []string{string(protocol.RoleClient)},
+	}})
+	require.Nil(t, err)
+	require.True(t, ok)
+	ok, err = acProvider.VerifyPrincipal(&testPolicyPrincipal{Principal: principal, policy: &pbac.Policy{
+		Rule: string(protocol.RuleAny), OrgList: []string{testOrg2},
+	}})
+	require.NotNil(t, err)
+	require.False(t, ok)
+	ok, err = acProvider.VerifyPrincipal(&testPolicyPrincipal{Principal: principal, policy: &pbac.Policy{
+		Rule: string(protocol.RuleAny), RoleList: []string{string(protocol.RoleAdmin)},
+	}})
+	require.NotNil(t, err)
+	require.False(t, ok)
+}
+
 func createCurrentPrincipal(orgMemberMap map[string]*orgMember, resourceName, acProviderOrgId string, endorsementResourceZephyrus ...*common.EndorsementEntry) (protocol.Principal, error) {
 	var endorsementResourceZephyrusList []*common.EndorsementEntry
 	endorsementResourceZephyrusList = append(endorsementResourceZephyrusList, endorsementResourceZephyrus...)
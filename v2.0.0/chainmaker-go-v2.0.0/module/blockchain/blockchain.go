@@ -9,6 +9,9 @@ SPDX-License-Identifier: Apache-2.0
 package blockchain
 
 import (
+	"strings"
+
+	"chainmaker.org/chainmaker-go/localconf"
 	"chainmaker.org/chainmaker-go/logger"
 	"chainmaker.org/chainmaker-go/net"
 	"chainmaker.org/chainmaker-go/subscriber"
@@ -33,6 +36,9 @@ const (
 	moduleNameDpos          = "DPoS"
 )
 
+// nodeTypeLight is the node type of the light node, which syncs and verifies the block headers only
+const nodeTypeLight = "light"
+
 // Blockchain is a block chain service. It manage all the modules of the chain.
 type Blockchain struct {
 	log *logger.CMLogger
@@ -116,7 +122,23 @@ func (bc *Blockchain) getConsensusType() consensus.ConsensusType {
 	return bc.chainConf.ChainConfig().Consensus.Type
 }
 
+// isLightNode returns whether the node is a light node in the local config.
+func (bc *Blockchain) isLightNode() bool {
+	return strings.EqualFold(localconf.ChainMakerConfig.NodeConfig.Type, nodeTypeLight)
+}
+
+// isStateSnapshotSync returns whether the new full node installs the state snapshot from peers in the local config.
+func (bc *Blockchain) isStateSnapshotSync() bool {
+	return localconf.ChainMakerConfig.SyncConfig.StateSnapshotSync && !bc.isLightNode() &&
+		bc.lastBlock != nil && bc.lastBlock.Header.BlockHeight == 0
+}
+
 // GetAccessControl get the protocol.AccessControlProvider of instance.
 func (bc *Blockchain) GetAccessControl() protocol.AccessControlProvider {
 	return bc.ac
 }
+
+// GetIdentity get the protocol.SigningMember of the node.
+func (bc *Blockchain) GetIdentity() protocol.SigningMember {
+	return bc.identity
+}
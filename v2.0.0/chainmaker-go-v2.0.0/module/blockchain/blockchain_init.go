@@ -30,6 +30,7 @@ import (
 	"chainmaker.org/chainmaker-go/txpool"
 	"chainmaker.org/chainmaker-go/utils"
 	"chainmaker.org/chainmaker-go/vm"
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
 	consensusPb "chainmaker.org/chainmaker/pb-go/v2/consensus"
 	storePb "chainmaker.org/chainmaker/pb-go/v2/store"
 	"chainmaker.org/chainmaker/protocol/v2"
@@ -54,7 +55,19 @@ func (bc *Blockchain) Init() (err error) {
 
 	var extModules []map[string]func() error
 
-	if bc.getConsensusType() == consensusPb.ConsensusType_SOLO {
+	if bc.isLightNode() {
+		// light node, it verifies the block headers synced from the full nodes, and serves the queries
+		extModules = []map[string]func() error{
+			// init access control
+			{moduleNameAccessControl: bc.initAC},
+			// init net service
+			{moduleNameNetService: bc.initNetService},
+			// init vm instances and module
+			{moduleNameVM: bc.initVM},
+			// init sync service module
+			{moduleNameSync: bc.initSync},
+		}
+	} else if bc.getConsensusType() == consensusPb.ConsensusType_SOLO {
 		// solo
 		extModules = []map[string]func() error{
 			// init access control
@@ -446,6 +459,9 @@ func (bc *Blockchain) initSync() (err error) {
 		bc.log.Infof("sync module existed, ignore.")
 		return
 	}
+	if bc.isLightNode() {
+		return bc.initLightSync()
+	}
 	// init sync service module
 	bc.syncServer = blockSync.NewBlockChainSyncServer(
 		bc.chainId,
@@ -456,10 +472,54 @@ func (bc *Blockchain) initSync() (err error) {
 		bc.coreEngine.GetBlockVerifier(),
 		bc.coreEngine.GetBlockCommitter(),
 	)
+	if bc.isStateSnapshotSync() {
+		trustedHash, err := hex.DecodeString(localconf.ChainMakerConfig.SyncConfig.StateSnapshotTrustedHash)
+		if err != nil {
+			return fmt.Errorf("invalid state snapshot trusted hash, %s", err)
+		}
+		// the blocks of the snapshot are verified with the chain config the node starts with, the chain config
+		// is reloaded from the installed states
+		bc.syncServer.(*blockSync.BlockChainSyncServer).EnableStateSnapshotSync(trustedHash,
+			localconf.ChainMakerConfig.SyncConfig.StateSnapshotMinPeers, bc.verifyBlockSignatures,
+			func(block, configBlock *commonPb.Block) error {
+				bc.lastBlock = block
+				return bc.chainConf.CompleteBlock(configBlock)
+			})
+	}
+	bc.initModules[moduleNameSync] = struct{}{}
+	return
+}
+
+// initLightSync init the sync service of the light node, the synced blocks are verified with the
+// consensus nodes and the trust roots in the chain config, which are changed by the synced config blocks
+func (bc *Blockchain) initLightSync() (err error) {
+	consensusType := bc.getConsensusType()
+	if consensusType == consensusPb.ConsensusType_SOLO || consensusType == consensusPb.ConsensusType_DPOS {
+		// the validators of dpos are elected in the state which the light node does not keep
+		return fmt.Errorf("light node does not support the consensus type %s", consensusType)
+	}
+	bc.syncServer = blockSync.NewLightBlockChainSyncServer(
+		bc.chainId,
+		bc.netService,
+		bc.msgBus,
+		bc.store,
+		bc.ledgerCache,
+		bc.chainConf,
+		bc.verifyBlockSignatures,
+	)
 	bc.initModules[moduleNameSync] = struct{}{}
 	return
 }
 
+// verifyBlockSignatures verifies the proposer signature and the consensus signatures of the block which is synced
+// without being executed
+func (bc *Blockchain) verifyBlockSignatures(block *commonPb.Block) error {
+	if err := utils.VerifyBlockProposerSig(bc.chainConf.ChainConfig(), block, bc.ac); err != nil {
+		return err
+	}
+	return consensus.VerifyBlockSignatures(bc.chainConf, bc.ac, bc.store, block, bc.ledgerCache)
+}
+
 func (bc *Blockchain) initSubscriber() error {
 	_, ok := bc.initModules[moduleNameSubscriber]
 	if ok {
@@ -17,11 +17,17 @@ func (bc *Blockchain) Start() error {
 	// 3、consensus module
 	// 4、tx pool
 	// 5、sync service
+	// the sync service starts after the net service if the new node installs the state snapshot,
+	// so that the other modules start with the installed ledger
 
+	stateSnapshotSync := bc.isStateSnapshotSync()
 	var startModules = make([]map[string]func() error, 0)
 	if bc.isModuleInit(moduleNameNetService) && !bc.isModuleStartUp(moduleNameNetService) {
 		startModules = append(startModules, map[string]func() error{moduleNameNetService: bc.startNetService})
 	}
+	if stateSnapshotSync && bc.isModuleInit(moduleNameSync) && !bc.isModuleStartUp(moduleNameSync) {
+		startModules = append(startModules, map[string]func() error{moduleNameSync: bc.startSyncService})
+	}
 	if bc.isModuleInit(moduleNameCore) && !bc.isModuleStartUp(moduleNameCore) {
 		startModules = append(startModules, map[string]func() error{moduleNameCore: bc.startCoreEngine})
 	}
@@ -31,7 +37,7 @@ func (bc *Blockchain) Start() error {
 	if bc.isModuleInit(moduleNameTxPool) && !bc.isModuleStartUp(moduleNameTxPool) {
 		startModules = append(startModules, map[string]func() error{moduleNameTxPool: bc.startTxPool})
 	}
-	if bc.isModuleInit(moduleNameSync) && !bc.isModuleStartUp(moduleNameSync) {
+	if !stateSnapshotSync && bc.isModuleInit(moduleNameSync) && !bc.isModuleStartUp(moduleNameSync) {
 		startModules = append(startModules, map[string]func() error{moduleNameSync: bc.startSyncService})
 	}
 
@@ -70,6 +70,8 @@ func (server *ChainMakerServer) initNet() error {
 	switch strings.ToLower(provider) {
 	case "libp2p":
 		netType = protocol.Libp2p
+	case "grpc":
+		netType = protocol.GRpc
 	default:
 		return errors.New("unsupported net provider")
 	}
@@ -248,6 +250,9 @@ func (server *ChainMakerServer) Stop() {
 // AddTx add a transaction.
 func (server *ChainMakerServer) AddTx(chainId string, tx *common.Transaction, source protocol.TxSource) error {
 	if blockchain, ok := server.blockchains.Load(chainId); ok {
+		if blockchain.(*Blockchain).txPool == nil {
+			return fmt.Errorf("chain[%s] is synced by the light node, which does not accept txs", chainId)
+		}
 		return blockchain.(*Blockchain).txPool.AddTx(tx, source)
 	}
 	return fmt.Errorf(chainIdNotFoundErrorTemplate, chainId)
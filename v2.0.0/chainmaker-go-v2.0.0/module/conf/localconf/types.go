@@ -72,6 +72,8 @@ type rpcConfig struct {
 	TLSConfig                              tlsConfig        `mapstructure:"tls"`
 	RateLimitConfig                        rateLimitConfig  `mapstructure:"ratelimit"`
 	SubscriberConfig                       subscriberConfig `mapstructure:"subscriber"`
+	GatewayConfig                          gatewayConfig    `mapstructure:"gateway"`
+	EthRpcConfig                           ethRpcConfig     `mapstructure:"eth_rpc"`
 	CheckChainConfTrustRootsChangeInterval int              `mapstructure:"check_chain_conf_trust_roots_change_interval"`
 }
 
@@ -92,6 +94,20 @@ type subscriberConfig struct {
 	RateLimitConfig rateLimitConfig `mapstructure:"ratelimit"`
 }
 
+// gatewayConfig is the config of the http/json gateway of the rpc service, it shares the tls config of rpc
+type gatewayConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	Port    int  `mapstructure:"port"`
+}
+
+// ethRpcConfig is the config of the ethereum json-rpc server, it serves the evm contracts of one chain
+// and shares the tls config of rpc, the EIP-155 chain id is evm.eth_chain_id in the chain config
+type ethRpcConfig struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Port    int    `mapstructure:"port"`
+	ChainId string `mapstructure:"chain_id"`
+}
+
 type debugConfig struct {
 	IsCliOpen           bool `mapstructure:"is_cli_open"`
 	IsHttpOpen          bool `mapstructure:"is_http_open"`
@@ -153,6 +169,11 @@ type StorageConfig struct {
 	ResultDbConfig         *DbConfig `mapstructure:"resultdb_config"`
 	ContractEventDbConfig  *DbConfig `mapstructure:"contract_eventdb_config"`
 	UnArchiveBlockHeight   uint64    `mapstructure:"unarchive_block_height"`
+	//链配置启用状态树时，保留最近多少个区块的状态根，更早的状态根及只被其引用的状态树节点会被裁剪，0表示不裁剪
+	RetainStateTreeBlocks uint64 `mapstructure:"retain_state_tree_blocks"`
+	//每隔多少个区块导出一次状态快照，供新节点快速同步，0表示不导出，仅支持kv状态数据库，须链配置启用状态树。
+	//快照在下一区块提交其状态根后于后台导出
+	StateSnapshotInterval uint64 `mapstructure:"state_snapshot_interval"`
 }
 
 func (config *StorageConfig) setDefault() {
@@ -288,6 +309,10 @@ type txPoolConfig struct {
 	CacheThresholdCount int64  `mapstructure:"cache_threshold_count"`
 	CacheFlushTimeOut   int64  `mapstructure:"cache_flush_timeout"`
 	AddTxChannelSize    int64  `mapstructure:"add_tx_channel_size"`
+	EnablePersist       bool   `mapstructure:"enable_persist"`
+	PersistDir          string `mapstructure:"persist_dir"`
+	OrderingPolicy      string `mapstructure:"ordering_policy"`
+	MaxSenderTxsInBlock int    `mapstructure:"max_sender_txs_in_block"`
 }
 
 type syncConfig struct {
@@ -301,6 +326,15 @@ type syncConfig struct {
 	SchedulerTick             float64 `mapstructure:"scheduler_tick"`
 	ReqTimeThreshold          float64 `mapstructure:"req_time_threshold"`
 	DataDetectionTick         float64 `mapstructure:"data_detection_tick"`
+	//单个请求最多同步的区块数，每个节点的批量大小在batch_Size_from_one_node和该值之间根据其响应自适应调整
+	MaxBatchSizeFromOneNode uint32 `mapstructure:"max_batch_size_from_one_node"`
+	//节点返回校验失败的区块后不再向其请求的时间，单位：s，再次失败时加倍
+	PeerPenaltyTime float64 `mapstructure:"peer_penalty_time"`
+	//只有创世区块的节点是否先从其他节点同步状态快照，再从快照的高度开始同步区块，快照的区块签名及下一区块提交的状态根校验通过后才安装
+	StateSnapshotSync bool `mapstructure:"state_snapshot_sync"`
+	//可信的快照区块哈希（hex），为空时接受至少state_snapshot_min_peers个节点一致的快照
+	StateSnapshotTrustedHash string `mapstructure:"state_snapshot_trusted_hash"`
+	StateSnapshotMinPeers    int    `mapstructure:"state_snapshot_min_peers"`
 }
 
 type monitorConfig struct {
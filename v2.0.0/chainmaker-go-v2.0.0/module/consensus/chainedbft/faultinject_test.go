@@ -0,0 +1,311 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package chainedbft
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"chainmaker.org/chainmaker-go/consensus/chainedbft/utils"
+	"chainmaker.org/chainmaker-go/consensus/faultinject"
+	"chainmaker.org/chainmaker-go/localconf"
+	"chainmaker.org/chainmaker/common/v2/crypto"
+	"chainmaker.org/chainmaker/common/v2/msgbus"
+	pbac "chainmaker.org/chainmaker/pb-go/v2/accesscontrol"
+	"chainmaker.org/chainmaker/pb-go/v2/common"
+	configpb "chainmaker.org/chainmaker/pb-go/v2/config"
+	consensuspb "chainmaker.org/chainmaker/pb-go/v2/consensus"
+	chainedbftpb "chainmaker.org/chainmaker/pb-go/v2/consensus/chainedbft"
+	"chainmaker.org/chainmaker/pb-go/v2/syscontract"
+	"chainmaker.org/chainmaker/protocol/v2/mock"
+	"github.com/gogo/protobuf/proto"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+// clusterCore takes the place of the core engine and the ledger of a node in the cluster, it builds empty
+// blocks for the proposals, records the committed blocks and the governance contract written by them
+type clusterCore struct {
+	sync.Mutex
+	msgbus.DefaultSubscriber
+
+	id          string
+	bus         msgbus.MessageBus
+	chainConfig []byte
+	governance  []byte
+	blocks      []*common.Block // the committed blocks from the genesis
+}
+
+func (c *clusterCore) height() uint64 {
+	c.Lock()
+	defer c.Unlock()
+	return uint64(len(c.blocks) - 1)
+}
+
+func (c *clusterCore) committed() []*common.Block {
+	c.Lock()
+	defer c.Unlock()
+	return append([]*common.Block(nil), c.blocks[1:]...)
+}
+
+func (c *clusterCore) lastCommittedBlock() *common.Block {
+	c.Lock()
+	defer c.Unlock()
+	return c.blocks[len(c.blocks)-1]
+}
+
+func (c *clusterCore) currentHeight() (uint64, error) {
+	return c.height(), nil
+}
+
+func (c *clusterCore) OnMessage(msg *msgbus.Message) {
+	if msg.Topic != msgbus.BuildProposal {
+		return
+	}
+	req := msg.Payload.(*chainedbftpb.BuildProposal)
+	if !req.IsProposer {
+		return
+	}
+	c.bus.Publish(msgbus.ProposedBlock, &consensuspb.ProposalBlock{Block: &common.Block{
+		Header: &common.BlockHeader{
+			ChainId:        "chain1",
+			BlockHeight:    req.Height,
+			PreBlockHash:   req.PreHash,
+			BlockTimestamp: int64(req.Height),
+			Proposer:       &pbac.Member{MemberInfo: []byte(c.id)},
+		},
+		Dag: &common.DAG{},
+	}})
+}
+
+func (c *clusterCore) addBlock(block *common.Block) error {
+	args, err := utils.GetConsensusArgsFromBlock(block)
+	if err != nil {
+		return err
+	}
+	c.Lock()
+	if block.Header.BlockHeight < uint64(len(c.blocks)) {
+		c.Unlock()
+		return nil
+	}
+	if block.Header.BlockHeight != uint64(len(c.blocks)) {
+		c.Unlock()
+		return fmt.Errorf("block %d is committed after %d", block.Header.BlockHeight, len(c.blocks)-1)
+	}
+	c.blocks = append(c.blocks, block)
+	for _, write := range args.GetConsensusData().GetTxWrites() {
+		if write.ContractName == syscontract.SystemContract_GOVERNANCE.String() {
+			c.governance = write.Value
+		}
+	}
+	c.Unlock()
+	c.bus.Publish(msgbus.BlockInfo, &common.BlockInfo{Block: block})
+	return nil
+}
+
+func (c *clusterCore) readObject(contractName string, key []byte) ([]byte, error) {
+	c.Lock()
+	defer c.Unlock()
+	switch contractName {
+	case syscontract.SystemContract_CHAIN_CONFIG.String():
+		return c.chainConfig, nil
+	case syscontract.SystemContract_GOVERNANCE.String():
+		return c.governance, nil
+	}
+	return nil, nil
+}
+
+func (c *clusterCore) getBlock(height uint64) (*common.Block, error) {
+	c.Lock()
+	defer c.Unlock()
+	if height >= uint64(len(c.blocks)) {
+		return nil, fmt.Errorf("block %d is not committed", height)
+	}
+	return c.blocks[height], nil
+}
+
+func (c *clusterCore) getBlockByHash(hash []byte) (*common.Block, error) {
+	c.Lock()
+	defer c.Unlock()
+	for _, block := range c.blocks {
+		if bytes.Equal(block.Header.BlockHash, hash) {
+			return block, nil
+		}
+	}
+	return nil, fmt.Errorf("block %x is not committed", hash)
+}
+
+// hotStuffCluster runs the nodes on a fake clock, which is advanced by waitCommitted once the nodes are idle
+type hotStuffCluster struct {
+	ids     []string
+	cores   map[string]*clusterCore
+	engines []*ConsensusChainedBftImpl
+	clock   *faultinject.FakeClock
+	network *faultinject.Network
+}
+
+func newHotStuffCluster(t *testing.T, ctrl *gomock.Controller, ids []string,
+	injector *faultinject.Injector) *hotStuffCluster {
+	chainConfig := &configpb.ChainConfig{
+		ChainId:   "chain1",
+		Crypto:    &configpb.CryptoConfig{Hash: crypto.CRYPTO_ALGO_SHA256},
+		Contract:  &configpb.ContractConfig{},
+		Consensus: &configpb.ConsensusConfig{Type: consensuspb.ConsensusType_HOTSTUFF},
+	}
+	for _, id := range ids {
+		chainConfig.Consensus.Nodes = append(chainConfig.Consensus.Nodes,
+			&configpb.OrgConfig{OrgId: "org-" + id, NodeId: []string{id}})
+	}
+	chainConfigBytes, err := proto.Marshal(chainConfig)
+	require.NoError(t, err)
+	genesisHash := sha256.Sum256([]byte("genesis"))
+	genesis := &common.Block{Header: &common.BlockHeader{ChainId: "chain1", BlockHash: genesisHash[:]}}
+
+	clock := faultinject.NewFakeClock(time.Unix(0, 0))
+	cluster := &hotStuffCluster{
+		ids:     ids,
+		cores:   make(map[string]*clusterCore),
+		clock:   clock,
+		network: faultinject.NewNetwork(injector, clock),
+	}
+	// the wal of each node is opened under the store path in New
+	localconf.ChainMakerConfig.StorageConfig.StorePath = t.TempDir()
+	for _, id := range ids {
+		bus := msgbus.NewMessageBus()
+		// the qc of the genesis is added to the last committed block when the node is created
+		core := &clusterCore{
+			id:          id,
+			bus:         bus,
+			chainConfig: chainConfigBytes,
+			blocks:      []*common.Block{proto.Clone(genesis).(*common.Block)},
+		}
+		bus.Register(msgbus.BuildProposal, core)
+		cluster.cores[id] = core
+
+		chainConf := mock.NewMockChainConf(ctrl)
+		chainConf.EXPECT().ChainConfig().Return(chainConfig).AnyTimes()
+		signer := mock.NewMockSigningMember(ctrl)
+		signer.EXPECT().Sign(gomock.Any(), gomock.Any()).Return([]byte("sig-"+id), nil).AnyTimes()
+		signer.EXPECT().GetMember().Return(&pbac.Member{MemberInfo: []byte(id)}, nil).AnyTimes()
+		ac := mock.NewMockAccessControlProvider(ctrl)
+		ac.EXPECT().CreatePrincipal(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, nil).AnyTimes()
+		ac.EXPECT().VerifyPrincipal(gomock.Any()).Return(true, nil).AnyTimes()
+		ledgerCache := mock.NewMockLedgerCache(ctrl)
+		ledgerCache.EXPECT().GetLastCommittedBlock().DoAndReturn(core.lastCommittedBlock).AnyTimes()
+		ledgerCache.EXPECT().CurrentHeight().DoAndReturn(core.currentHeight).AnyTimes()
+		store := mock.NewMockBlockchainStore(ctrl)
+		store.EXPECT().ReadObject(gomock.Any(), gomock.Any()).DoAndReturn(core.readObject).AnyTimes()
+		store.EXPECT().GetBlock(gomock.Any()).DoAndReturn(core.getBlock).AnyTimes()
+		store.EXPECT().GetBlockByHash(gomock.Any()).DoAndReturn(core.getBlockByHash).AnyTimes()
+		verifier := mock.NewMockBlockVerifier(ctrl)
+		verifier.EXPECT().VerifyBlock(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+		committer := mock.NewMockBlockCommitter(ctrl)
+		committer.EXPECT().AddBlock(gomock.Any()).DoAndReturn(core.addBlock).AnyTimes()
+		cluster.network.AddNode(id, bus, signer)
+
+		// the verifier of the chain config is registered by chain id once in a process, so each node runs on
+		// its own chain id
+		chainID := strings.ReplaceAll(t.Name(), "/", "_") + "_" + id
+		engine, err := New(chainID, id, signer, ac, ledgerCache, nil, verifier, committer, nil, store, bus,
+			chainConf, nil)
+		require.NoError(t, err)
+		engine.afterFunc = clock.AfterFunc
+		engine.timerService.SetAfterFunc(clock.AfterFunc)
+		cluster.engines = append(cluster.engines, engine)
+	}
+	return cluster
+}
+
+func (c *hotStuffCluster) start(t *testing.T) {
+	for _, engine := range c.engines {
+		require.NoError(t, engine.Start())
+	}
+}
+
+func (c *hotStuffCluster) stop() {
+	c.network.Stop()
+	for _, engine := range c.engines {
+		_ = engine.Stop()
+	}
+}
+
+// waitCommitted runs the cluster until the nodes commit the blocks up to height, and checks they commit the
+// same blocks. The timeouts are run on the fake clock, it fails if the nodes are still behind after maxSteps
+// advances of the clock.
+func (c *hotStuffCluster) waitCommitted(t *testing.T, ids []string, height uint64, maxSteps int) {
+	err := faultinject.Run(c.network, c.clock, 20*time.Millisecond, maxSteps, func() bool {
+		for _, id := range ids {
+			if c.cores[id].height() < height {
+				return false
+			}
+		}
+		return true
+	})
+	if err != nil {
+		for _, id := range ids {
+			t.Logf("node %s committed %d blocks, expect %d", id, c.cores[id].height(), height)
+		}
+		t.Fatal(err)
+	}
+	expect := c.cores[ids[0]].committed()
+	for _, id := range c.ids {
+		for i, block := range c.cores[id].committed() {
+			if i < int(height) && !bytes.Equal(expect[i].Header.BlockHash, block.Header.BlockHash) {
+				t.Errorf("node %s committed block[%d] %x, node %s committed %x", id, i+1,
+					block.Header.BlockHash, ids[0], expect[i].Header.BlockHash)
+			}
+		}
+	}
+}
+
+func TestConsensusChainedBftImpl_FaultInjection(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping the hotstuff cluster in short mode")
+	}
+	prevStorePath := localconf.ChainMakerConfig.StorageConfig.StorePath
+	defer func() {
+		localconf.ChainMakerConfig.StorageConfig.StorePath = prevStorePath
+	}()
+
+	ids := []string{"node1", "node2", "node3", "node4"}
+	tests := []struct {
+		scenario string
+		// the nodes expected to keep committing
+		live []string
+	}{
+		{"vote_lost", ids},
+		{"equivocation", ids},
+		{"delay_duplicate", ids},
+		{"partition", ids[:3]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.scenario, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			scenario, err := faultinject.LoadScenario(filepath.Join("testdata", "faultinject", tt.scenario+".yml"))
+			require.NoError(t, err)
+			injector, err := faultinject.NewInjector(scenario,
+				faultinject.NewChainedBFTCodec(crypto.CRYPTO_ALGO_SHA256))
+			require.NoError(t, err)
+			cluster := newHotStuffCluster(t, ctrl, ids, injector)
+			cluster.start(t)
+			defer cluster.stop()
+
+			cluster.waitCommitted(t, tt.live, 5, 200)
+			for i := range scenario.Rules {
+				require.NotZero(t, injector.Count(i), "rule %d of %s is not applied", i, tt.scenario)
+			}
+		})
+	}
+}
@@ -69,6 +69,7 @@ type ConsensusChainedBftImpl struct {
 	msgPool      *message.MsgPool          // manages all of consensus messages received for protocol
 	chainStore   *chainStore               // Cache blocks, status information of QC, and the process of the commit blocks on the chain
 	timerService *timeservice.TimerService // Timer service
+	afterFunc    timeservice.AfterFunc     // Schedules the timeouts of timerService, nil means the real timers
 
 	// Services of other modules
 	logger                *logger.CMLogger
@@ -995,6 +995,9 @@ func (cbi *ConsensusChainedBftImpl) switchNextEpoch(blockHeight uint64) error {
 	cbi.syncer = newSyncManager(cbi)
 	cbi.msgPool = cbi.nextEpoch.msgPool
 	cbi.timerService = timeservice.NewTimerService(cbi.logger)
+	if cbi.afterFunc != nil {
+		cbi.timerService.SetAfterFunc(cbi.afterFunc)
+	}
 	cbi.selfIndexInEpoch = cbi.nextEpoch.index
 	cbi.smr = newChainedBftSMR(cbi.chainID, cbi.nextEpoch, cbi.chainStore, cbi.timerService, cbi)
 	cbi.nextEpoch = nil
@@ -66,14 +66,19 @@ func (t *TimerEvent) String() string {
 		" duration: %s, state: %s", t.Height, t.Level, t.EpochId, t.Duration, t.State)
 }
 
+//AfterFunc calls f after d, the returned stop cancels the call and reports whether it was pending
+type AfterFunc func(d time.Duration, f func()) (stop func() bool)
+
 //TimerService provides timer service
 type TimerService struct {
 	pacemakerEvent *TimerEvent // The last pacemaker event added
-	pacemakerTimer *time.Timer // timer for pacemaker event
+	stopPacemaker  func() bool // stops the timer of pacemaker event
+	afterFunc      AfterFunc   // schedules the timer events, it is replaced by a fake clock in tests
 
-	eventCh chan *TimerEvent // For scheduling event timeouts
-	firedCh chan *TimerEvent // For notifying event timeouts
-	quitCh  chan struct{}    // Quit timer service
+	eventCh     chan *TimerEvent // For scheduling event timeouts
+	pacemakerCh chan *TimerEvent // For the pacemaker events due
+	firedCh     chan *TimerEvent // For notifying event timeouts
+	quitCh      chan struct{}    // Quit timer service
 
 	logger *logger.CMLogger // log
 }
@@ -81,16 +86,23 @@ type TimerService struct {
 //NewTimerService initializes an instance of timer service
 func NewTimerService(log *logger.CMLogger) *TimerService {
 	ts := &TimerService{
-		pacemakerTimer: time.NewTimer(RoundTimeout),
-		eventCh:        make(chan *TimerEvent, 10),
-		firedCh:        make(chan *TimerEvent, 10),
-		quitCh:         make(chan struct{}, 0),
-		logger:         log,
+		afterFunc: func(d time.Duration, f func()) func() bool {
+			return time.AfterFunc(d, f).Stop
+		},
+		eventCh:     make(chan *TimerEvent, 10),
+		pacemakerCh: make(chan *TimerEvent, 10),
+		firedCh:     make(chan *TimerEvent, 10),
+		quitCh:      make(chan struct{}, 0),
+		logger:      log,
 	}
-	dropTimerC(ts.pacemakerTimer, "start timeService", ts.logger)
 	return ts
 }
 
+//SetAfterFunc replaces the timers of the service, it must be called before Start
+func (ts *TimerService) SetAfterFunc(afterFunc AfterFunc) {
+	ts.afterFunc = afterFunc
+}
+
 //Start starts timer service
 func (ts *TimerService) Start() {
 	ts.loop()
@@ -99,17 +111,11 @@ func (ts *TimerService) Start() {
 //Stop stops timer service
 func (ts *TimerService) Stop() {
 	close(ts.quitCh)
-	dropTimerC(ts.pacemakerTimer, "stop timeService", ts.logger)
 }
 
-func dropTimerC(t *time.Timer, detail string, log *logger.CMLogger) {
-	if t != nil && !t.Stop() {
-		select {
-		case <-t.C:
-			log.Debugf("stop timer: %s", detail)
-		default:
-			log.Debugf("timer:( %s ) not fired", detail)
-		}
+func (ts *TimerService) stopPacemakerTimer(detail string) {
+	if ts.stopPacemaker != nil && ts.stopPacemaker() {
+		ts.logger.Debugf("stop timer: %s", detail)
 	}
 }
 
@@ -129,11 +135,13 @@ func (ts *TimerService) loop() {
 				continue
 			}
 			ts.processEvent(newEvent)
-		case <-ts.pacemakerTimer.C:
-			if ts.pacemakerEvent != nil {
+		case event := <-ts.pacemakerCh:
+			// ignore the timer fired before it is stopped
+			if event == ts.pacemakerEvent {
 				go ts.fireEvent(ts.pacemakerEvent, "pacemaker")
 			}
 		case <-ts.quitCh:
+			ts.stopPacemakerTimer("stop timeService")
 			return
 		}
 	}
@@ -143,8 +151,13 @@ func (ts *TimerService) processEvent(newEvent *TimerEvent) {
 	ts.logger.Debugf("received a timer event: %s, last timer event: %s", newEvent, ts.pacemakerEvent)
 	if newEvent.State == chainedbftpb.ConsStateType_PACEMAKER {
 		ts.pacemakerEvent = newEvent
-		dropTimerC(ts.pacemakerTimer, "Pacemaker", ts.logger)
-		ts.pacemakerTimer.Reset(ts.pacemakerEvent.Duration)
+		ts.stopPacemakerTimer("Pacemaker")
+		ts.stopPacemaker = ts.afterFunc(ts.pacemakerEvent.Duration, func() {
+			select {
+			case ts.pacemakerCh <- newEvent:
+			case <-ts.quitCh:
+			}
+		})
 		return
 	}
 }
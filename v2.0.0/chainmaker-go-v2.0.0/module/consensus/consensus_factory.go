@@ -53,6 +53,7 @@ func (f Factory) NewConsensusEngine(
 			Signer:      signer,
 			Ac:          ac,
 			DbHandle:    dbHandle,
+			Store:       store,
 			LedgerCache: ledgerCache,
 			ChainConf:   chainConf,
 			NetService:  netService,
@@ -61,7 +62,7 @@ func (f Factory) NewConsensusEngine(
 		}
 		return tbft.New(config)
 	case consensuspb.ConsensusType_SOLO:
-		return solo.New(chainID, id, signer, msgBus, chainConf)
+		return solo.New(chainID, id, signer, ac, msgBus, chainConf)
 	case consensuspb.ConsensusType_RAFT:
 		config := raft.ConsensusRaftImplConfig{
 			ChainID:        chainID,
@@ -100,11 +101,11 @@ func VerifyBlockSignatures(
 	case consensuspb.ConsensusType_TBFT, consensuspb.ConsensusType_DPOS:
 		return tbft.VerifyBlockSignatures(chainConf, ac, block, store)
 	case consensuspb.ConsensusType_RAFT:
-		return raft.VerifyBlockSignatures(block)
+		return raft.VerifyBlockSignatures(chainConf, ac, block)
 	case consensuspb.ConsensusType_HOTSTUFF:
 		return chainedbft.VerifyBlockSignatures(chainConf, ac, store, block, ledger)
 	case consensuspb.ConsensusType_SOLO:
-		fallthrough
+		return solo.VerifyBlockSignatures(chainConf, ac, block)
 	default:
 	}
 	return fmt.Errorf("error consensusType: %s", consensusType)
@@ -7,9 +7,12 @@ SPDX-License-Identifier: Apache-2.0
 package dpos
 
 import (
+	"bytes"
 	"encoding/binary"
+	"encoding/json"
 	"fmt"
 	"math/big"
+	"sort"
 
 	"chainmaker.org/chainmaker-go/vm/native/dposmgr"
 
@@ -44,8 +47,9 @@ func (impl *DPoSImpl) getNodeIDsFromValidators(epoch *syscontract.Epoch) ([]stri
 	return nodeIDs, nil
 }
 
-// getAllCandidateInfo get all candidates from ledger
-func (impl *DPoSImpl) getAllCandidateInfo() ([]*dpospb.CandidateInfo, error) {
+// getAllCandidateInfo get all candidates from ledger, the validators updated
+// in the block which are not committed yet take precedence over the ledger
+func (impl *DPoSImpl) getAllCandidateInfo(updatedVals map[string]*syscontract.Validator) ([]*dpospb.CandidateInfo, error) {
 	prefix := dposmgr.ToValidatorPrefix()
 	iterRange := util.BytesPrefix(prefix)
 	iter, err := impl.stateDB.SelectObject(syscontract.SystemContract_DPOS_STAKE.String(), iterRange.Start, iterRange.Limit)
@@ -78,6 +82,10 @@ func (impl *DPoSImpl) getAllCandidateInfo() ([]*dpospb.CandidateInfo, error) {
 			impl.log.Errorf("unmarshal validator failed, reason: %s", err)
 			return nil, err
 		}
+		if updated, ok := updatedVals[val.ValidatorAddress]; ok {
+			vals = append(vals, updated)
+			continue
+		}
 		vals = append(vals, &val)
 	}
 	if len(vals) == 0 {
@@ -129,12 +137,431 @@ func (impl *DPoSImpl) createEpochRwSet(epoch *syscontract.Epoch) (*commonpb.TxRW
 	return rw, nil
 }
 
-func (impl *DPoSImpl) createRewardRwSet(rewardAmount big.Int) (*commonpb.TxRWSet, error) {
-	return nil, nil
+func (impl *DPoSImpl) getIncentiveParams() (*incentiveParams, error) {
+	params, err := loadIncentiveParams(impl.chainConf.ChainConfig().Consensus.DposConfig)
+	if err != nil {
+		impl.log.Errorf("load reward and slash params failed, reason: %s", err)
+		return nil, err
+	}
+	return params, nil
+}
+
+// createRewardRwSet mint the epoch reward for the validators of the epoch which are not jailed,
+// each validator gets the same part, the part is split by the commission rate and the shares of the delegations
+func (impl *DPoSImpl) createRewardRwSet(params *incentiveParams, epoch *syscontract.Epoch, pending *commonpb.TxRWSet,
+	block *common.Block, blockTxRwSet map[string]*common.TxRWSet) (*commonpb.TxRWSet, error) {
+	rwSet := &commonpb.TxRWSet{
+		TxId: ModuleName,
+	}
+	if !params.rewardEnabled() || len(epoch.ProposerVector) == 0 {
+		return rwSet, nil
+	}
+	validators := make([]*syscontract.Validator, 0, len(epoch.ProposerVector))
+	for _, addr := range epoch.ProposerVector {
+		val, err := impl.getPendingValidator(addr, pending, block, blockTxRwSet)
+		if err != nil {
+			return nil, err
+		}
+		if val == nil || val.Jailed {
+			continue
+		}
+		validators = append(validators, val)
+	}
+	if len(validators) == 0 {
+		return rwSet, nil
+	}
+	delegations, err := impl.getDelegationsByValidator(pending, block, blockTxRwSet)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		minted        = big.NewInt(0)
+		balances      = make(map[string]*big.Int)
+		rewardedAddrs = make([]string, 0, len(validators))
+		perValidator  = big.NewInt(0).Div(params.epochReward, big.NewInt(int64(len(validators))))
+	)
+	addReward := func(addr string, amount *big.Int) error {
+		balance, ok := balances[addr]
+		if !ok {
+			var err error
+			if balance, err = impl.balanceOfPending(addr, pending, block, blockTxRwSet); err != nil {
+				return err
+			}
+			rewardedAddrs = append(rewardedAddrs, addr)
+		}
+		balances[addr] = balance.Add(balance, amount)
+		return nil
+	}
+	for _, val := range validators {
+		shares, ok := big.NewInt(0).SetString(val.DelegatorShares, 10)
+		if !ok {
+			impl.log.Errorf("validator delegatorShares not parse to big.Int, actual: %s ", val.DelegatorShares)
+			return nil, fmt.Errorf("validator delegatorShares not parse to big.Int, actual: %s ", val.DelegatorShares)
+		}
+		valDelegations := delegations[val.ValidatorAddress]
+		amounts, err := splitReward(perValidator, params.commissionRate, shares, valDelegations)
+		if err != nil {
+			impl.log.Errorf("split reward of validator[%s] failed, reason: %s", val.ValidatorAddress, err)
+			return nil, err
+		}
+		for i, delegation := range valDelegations {
+			if err = addReward(delegation.DelegatorAddress, amounts[i]); err != nil {
+				return nil, err
+			}
+		}
+		if err = addReward(val.ValidatorAddress, amounts[len(amounts)-1]); err != nil {
+			return nil, err
+		}
+		minted.Add(minted, perValidator)
+	}
+	for _, addr := range rewardedAddrs {
+		rwSet.TxWrites = append(rwSet.TxWrites, &commonpb.TxWrite{
+			ContractName: syscontract.SystemContract_DPOS_ERC20.String(),
+			Key:          []byte(dposmgr.BalanceKey(addr)),
+			Value:        []byte(balances[addr].String()),
+		})
+	}
+	totalSupplyWrite, err := impl.updateTotalSupplyRwSet(minted, pending, block, blockTxRwSet)
+	if err != nil {
+		return nil, err
+	}
+	rwSet.TxWrites = append(rwSet.TxWrites, totalSupplyWrite)
+	impl.log.Debugf("reward rwSet: %s", rwSet.String())
+	return rwSet, nil
+}
+
+// createSlashRwSet slash the validators by the evidences recorded in the epoch, the slashed tokens of the
+// validator are burned from the stake contract, so all the delegations of the validator are slashed by the same rate.
+// the validators which double signed are jailed, and can unjail themselves by the stake contract after the new epoch.
+func (impl *DPoSImpl) createSlashRwSet(params *incentiveParams, epoch *syscontract.Epoch, pending *commonpb.TxRWSet,
+	block *common.Block, blockTxRwSet map[string]*common.TxRWSet) (*commonpb.TxRWSet, map[string]*syscontract.Validator, error) {
+	rwSet := &commonpb.TxRWSet{
+		TxId: ModuleName,
+	}
+	if !params.slashEnabled() {
+		return rwSet, nil, nil
+	}
+	evidences, err := impl.getSlashEvidences(epoch)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(evidences) == 0 {
+		return rwSet, nil, nil
+	}
+
+	var (
+		addrs           = make([]string, 0, len(evidences))
+		doubleSigns     = make(map[string]uint64)
+		missedProposals = make(map[string]uint64)
+		slashedVals     = make(map[string]*syscontract.Validator)
+		burned          = big.NewInt(0)
+	)
+	for _, evidence := range evidences {
+		if _, ok := doubleSigns[evidence.ValidatorAddress]; !ok {
+			addrs = append(addrs, evidence.ValidatorAddress)
+			doubleSigns[evidence.ValidatorAddress] = 0
+		}
+		switch evidence.Type {
+		case EvidenceDoubleSign:
+			doubleSigns[evidence.ValidatorAddress]++
+		case EvidenceMissedProposal:
+			missedProposals[evidence.ValidatorAddress]++
+		}
+	}
+	for _, addr := range addrs {
+		rate, jail := params.slashRate(doubleSigns[addr], missedProposals[addr])
+		if rate == 0 && !jail {
+			continue
+		}
+		val, err := impl.getPendingValidator(addr, pending, block, blockTxRwSet)
+		if err != nil {
+			return nil, nil, err
+		}
+		if val == nil {
+			impl.log.Warnf("not found the validator[%s] to be slashed", addr)
+			continue
+		}
+		slashed, afterTokens, err := slashAmount(val.Tokens, rate)
+		if err != nil {
+			return nil, nil, err
+		}
+		_, afterSelfDelegation, err := slashAmount(val.SelfDelegation, rate)
+		if err != nil {
+			return nil, nil, err
+		}
+		val.Tokens = afterTokens.String()
+		val.SelfDelegation = afterSelfDelegation.String()
+		val.Jailed = val.Jailed || jail
+		bz, err := proto.Marshal(val)
+		if err != nil {
+			impl.log.Errorf("marshal validator failed, reason: %s", err)
+			return nil, nil, err
+		}
+		rwSet.TxWrites = append(rwSet.TxWrites, &commonpb.TxWrite{
+			ContractName: syscontract.SystemContract_DPOS_STAKE.String(),
+			Key:          dposmgr.ToValidatorKey(addr),
+			Value:        bz,
+		})
+		if jail {
+			// the validator is jailed from the new epoch, and can be unjailed after it
+			jailedEpoch := make([]byte, 8)
+			binary.BigEndian.PutUint64(jailedEpoch, epoch.EpochId+1)
+			rwSet.TxWrites = append(rwSet.TxWrites, &commonpb.TxWrite{
+				ContractName: syscontract.SystemContract_DPOS_STAKE.String(),
+				Key:          dposmgr.ToJailedEpochKey(addr),
+				Value:        jailedEpoch,
+			})
+		}
+		slashedVals[addr] = val
+		burned.Add(burned, slashed)
+		impl.log.Infof("slash validator[%s] by rate: %d%%, slashed: %s, jailed: %v, doubleSigns: %d, missedProposals: %d",
+			addr, rate, slashed.String(), val.Jailed, doubleSigns[addr], missedProposals[addr])
+	}
+	if burned.Sign() == 0 {
+		return rwSet, slashedVals, nil
+	}
+
+	stakeContractAddr := dposmgr.StakeContractAddr()
+	balance, err := impl.balanceOfPending(stakeContractAddr, pending, block, blockTxRwSet)
+	if err != nil {
+		return nil, nil, err
+	}
+	balanceWrite, _, err := impl.subBalanceRwSet(stakeContractAddr, balance, burned.String())
+	if err != nil {
+		return nil, nil, err
+	}
+	totalSupplyWrite, err := impl.updateTotalSupplyRwSet(big.NewInt(0).Neg(burned), pending, block, blockTxRwSet)
+	if err != nil {
+		return nil, nil, err
+	}
+	rwSet.TxWrites = append(rwSet.TxWrites, balanceWrite, totalSupplyWrite)
+	impl.log.Debugf("slash rwSet: %s", rwSet.String())
+	return rwSet, slashedVals, nil
+}
+
+func (impl *DPoSImpl) getSlashEvidences(epoch *syscontract.Epoch) ([]*SlashEvidence, error) {
+	prefix := dposmgr.ToSlashEvidencePrefix(epoch.EpochId)
+	iterRange := util.BytesPrefix(prefix)
+	iter, err := impl.stateDB.SelectObject(syscontract.SystemContract_DPOS_STAKE.String(), iterRange.Start, iterRange.Limit)
+	if err != nil {
+		impl.log.Errorf("new select range failed, reason: %s", err)
+		return nil, err
+	}
+	defer iter.Release()
+
+	evidences := make([]*SlashEvidence, 0)
+	for iter.Next() {
+		kv, err := iter.Value()
+		if err != nil {
+			impl.log.Errorf("get kv from iterator failed, reason: %s", err)
+			return nil, err
+		}
+		evidence := SlashEvidence{}
+		if err = json.Unmarshal(kv.Value, &evidence); err != nil {
+			impl.log.Errorf("unmarshal value to SlashEvidence failed, reason: %s", err)
+			return nil, err
+		}
+		evidences = append(evidences, &evidence)
+	}
+	if len(evidences) > 0 {
+		impl.log.Debugf("get slash evidences of epoch[%d]: %d", epoch.EpochId, len(evidences))
+	}
+	return evidences, nil
+}
+
+// NewDoubleSignEvidenceTxWrite create the write which records the double sign of the node in the block at
+// blockHeight, the write is nil if the chain is not DPoS or the node is not bound to a validator
+func (impl *DPoSImpl) NewDoubleSignEvidenceTxWrite(blockHeight uint64, nodeID string, evidenceHeight uint64,
+	round int64, data []byte) (*commonpb.TxWrite, error) {
+	if !impl.isDPoSConsensus() {
+		return nil, nil
+	}
+	epoch, err := impl.getEpochInfo()
+	if err != nil {
+		return nil, err
+	}
+	addr, err := impl.getValidatorOfNode(nodeID)
+	if err != nil || len(addr) == 0 {
+		return nil, err
+	}
+	return NewSlashEvidenceTxWrite(evidenceEpochID(epoch, blockHeight), &SlashEvidence{
+		Type:             EvidenceDoubleSign,
+		ValidatorAddress: addr,
+		BlockHeight:      evidenceHeight,
+		Round:            round,
+		Data:             data,
+	})
+}
+
+// NewMissedProposalEvidenceTxWrite create the write which records that the node, the proposer of the round at
+// evidenceHeight, missed its proposal, the write is recorded in the block at blockHeight. The write is nil if the
+// chain is not DPoS, the node is not bound to a validator, or the block at evidenceHeight created the current epoch,
+// whose rounds are proposed by the validators of the last epoch.
+func (impl *DPoSImpl) NewMissedProposalEvidenceTxWrite(blockHeight uint64, nodeID string, evidenceHeight uint64,
+	round int64) (*commonpb.TxWrite, error) {
+	if !impl.isDPoSConsensus() {
+		return nil, nil
+	}
+	epoch, err := impl.getEpochInfo()
+	if err != nil {
+		return nil, err
+	}
+	epochBlockNum, err := impl.getEpochBlockNumber()
+	if err != nil {
+		return nil, err
+	}
+	if epoch.NextEpochCreateHeight == evidenceHeight+epochBlockNum {
+		return nil, nil
+	}
+	addr, err := impl.getValidatorOfNode(nodeID)
+	if err != nil || len(addr) == 0 {
+		return nil, err
+	}
+	return NewSlashEvidenceTxWrite(evidenceEpochID(epoch, blockHeight), &SlashEvidence{
+		Type:             EvidenceMissedProposal,
+		ValidatorAddress: addr,
+		BlockHeight:      evidenceHeight,
+		Round:            round,
+	})
+}
+
+// evidenceEpochID returns the epoch which the evidences recorded in the block at blockHeight belong to,
+// the evidences of the finished epoch are consumed by the block which creates the new epoch,
+// so the evidences in this block are recorded in the new epoch
+func evidenceEpochID(epoch *syscontract.Epoch, blockHeight uint64) uint64 {
+	if epoch.NextEpochCreateHeight == blockHeight {
+		return epoch.EpochId + 1
+	}
+	return epoch.EpochId
+}
+
+// getValidatorOfNode returns the address of the validator bound to the node, which is empty if not found
+func (impl *DPoSImpl) getValidatorOfNode(nodeID string) (string, error) {
+	addr, err := impl.stateDB.ReadObject(syscontract.SystemContract_DPOS_STAKE.String(), dposmgr.ToReverseNodeIDKey(nodeID))
+	if err != nil {
+		impl.log.Errorf("read the validator of node[%s] failed, reason: %s", nodeID, err)
+		return "", err
+	}
+	if len(addr) == 0 {
+		impl.log.Warnf("not found the validator of node[%s] to record the evidence", nodeID)
+	}
+	return string(addr), nil
 }
 
-func (impl *DPoSImpl) createSlashRwSet(slashAmount big.Int) (*commonpb.TxRWSet, error) {
-	return nil, nil
+func (impl *DPoSImpl) getEpochBlockNumber() (uint64, error) {
+	bz, err := impl.stateDB.ReadObject(syscontract.SystemContract_DPOS_STAKE.String(), []byte(dposmgr.KeyEpochBlockNumber))
+	if err != nil {
+		impl.log.Errorf("load epochBlockNum from db failed, reason: %s", err)
+		return 0, err
+	}
+	if len(bz) != 8 {
+		return 0, fmt.Errorf("invalid epochBlockNum: %x", bz)
+	}
+	return binary.BigEndian.Uint64(bz), nil
+}
+
+// getDelegationsByValidator get all delegations grouped by the validator, the delegations updated by the txs
+// of the block and the consensus rwSet that are being built take precedence over the ledger
+func (impl *DPoSImpl) getDelegationsByValidator(pending *commonpb.TxRWSet, block *common.Block,
+	blockTxRwSet map[string]*common.TxRWSet) (map[string][]*syscontract.Delegation, error) {
+	var (
+		contractName = syscontract.SystemContract_DPOS_STAKE.String()
+		prefix       = dposmgr.ToDelegationPrefix("")
+		values       = make(map[string][]byte)
+	)
+	iterRange := util.BytesPrefix(prefix)
+	iter, err := impl.stateDB.SelectObject(contractName, iterRange.Start, iterRange.Limit)
+	if err != nil {
+		impl.log.Errorf("new select range failed, reason: %s", err)
+		return nil, err
+	}
+	defer iter.Release()
+	for iter.Next() {
+		kv, err := iter.Value()
+		if err != nil {
+			impl.log.Errorf("get kv from iterator failed, reason: %s", err)
+			return nil, err
+		}
+		values[string(kv.Key)] = kv.Value
+	}
+
+	overlay := func(txWrites []*common.TxWrite) {
+		for _, txWrite := range txWrites {
+			if txWrite.ContractName == contractName && bytes.HasPrefix(txWrite.Key, prefix) {
+				values[string(txWrite.Key)] = txWrite.Value
+			}
+		}
+	}
+	for _, tx := range block.Txs {
+		if rwSet, ok := blockTxRwSet[tx.Payload.TxId]; ok {
+			overlay(rwSet.TxWrites)
+		}
+	}
+	if pending != nil {
+		overlay(pending.TxWrites)
+	}
+
+	keys := make([]string, 0, len(values))
+	for key, value := range values {
+		// the undelegated delegation is deleted
+		if len(value) > 0 {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	delegations := make(map[string][]*syscontract.Delegation)
+	for _, key := range keys {
+		delegation := syscontract.Delegation{}
+		if err = proto.Unmarshal(values[key], &delegation); err != nil {
+			impl.log.Errorf("unmarshal value to Delegation failed, reason: %s", err)
+			return nil, err
+		}
+		delegations[delegation.ValidatorAddress] = append(delegations[delegation.ValidatorAddress], &delegation)
+	}
+	return delegations, nil
+}
+
+func (impl *DPoSImpl) getPendingValidator(addr string, pending *commonpb.TxRWSet,
+	block *common.Block, blockTxRwSet map[string]*common.TxRWSet) (*syscontract.Validator, error) {
+	bz, err := impl.getPendingState(syscontract.SystemContract_DPOS_STAKE.String(),
+		dposmgr.ToValidatorKey(addr), pending, block, blockTxRwSet)
+	if err != nil {
+		return nil, err
+	}
+	if len(bz) == 0 {
+		return nil, nil
+	}
+	val := syscontract.Validator{}
+	if err = proto.Unmarshal(bz, &val); err != nil {
+		impl.log.Errorf("unmarshal validator failed, reason: %s", err)
+		return nil, err
+	}
+	return &val, nil
+}
+
+// updateTotalSupplyRwSet change the total supply of the erc20 contract by delta, which is positive when minting
+func (impl *DPoSImpl) updateTotalSupplyRwSet(delta *big.Int, pending *commonpb.TxRWSet,
+	block *common.Block, blockTxRwSet map[string]*common.TxRWSet) (*commonpb.TxWrite, error) {
+	bz, err := impl.getPendingState(syscontract.SystemContract_DPOS_ERC20.String(),
+		[]byte(dposmgr.KeyTotalSupply), pending, block, blockTxRwSet)
+	if err != nil {
+		return nil, err
+	}
+	totalSupply, ok := big.NewInt(0).SetString(string(bz), 10)
+	if !ok {
+		impl.log.Errorf("invalid total supply: %s", bz)
+		return nil, fmt.Errorf("invalid total supply: %s", bz)
+	}
+	if totalSupply.Add(totalSupply, delta).Sign() < 0 {
+		impl.log.Errorf("total supply is not enough, delta: %s", delta.String())
+		return nil, fmt.Errorf("total supply is not enough, delta: %s", delta.String())
+	}
+	return &commonpb.TxWrite{
+		ContractName: syscontract.SystemContract_DPOS_ERC20.String(),
+		Key:          []byte(dposmgr.KeyTotalSupply),
+		Value:        []byte(totalSupply.String()),
+	}, nil
 }
 
 func (impl *DPoSImpl) completeUnbounding(epoch *syscontract.Epoch,
@@ -255,12 +682,26 @@ func (impl *DPoSImpl) subBalanceRwSet(addr string, before *big.Int, amount strin
 	}, after, nil
 }
 
+func (impl *DPoSImpl) balanceOfPending(addr string, pending *commonpb.TxRWSet,
+	block *common.Block, blockTxRwSet map[string]*common.TxRWSet) (*big.Int, error) {
+	val, err := impl.getPendingState(syscontract.SystemContract_DPOS_ERC20.String(),
+		[]byte(dposmgr.BalanceKey(addr)), pending, block, blockTxRwSet)
+	if err != nil {
+		return nil, err
+	}
+	return parseBalance(val)
+}
+
 func (impl *DPoSImpl) balanceOf(addr string, block *common.Block, blockTxRwSet map[string]*common.TxRWSet) (*big.Int, error) {
 	key := []byte(dposmgr.BalanceKey(addr))
 	val, err := impl.getState(syscontract.SystemContract_DPOS_ERC20.String(), key, block, blockTxRwSet)
 	if err != nil {
 		return nil, err
 	}
+	return parseBalance(val)
+}
+
+func parseBalance(val []byte) (*big.Int, error) {
 	balance := big.NewInt(0)
 	if len(val) == 0 {
 		return balance, nil
@@ -192,25 +192,71 @@ func TestDPoSImpl_GetAllCandidateInfo(t *testing.T) {
 	defer fn()
 
 	// 0. no candidates
-	candidates, err := impl.getAllCandidateInfo()
+	candidates, err := impl.getAllCandidateInfo(nil)
 	require.NoError(t, err)
 	require.EqualValues(t, 0, len(candidates))
 
 	// 1. init 6 candidates
 	blk, blkRwSet := generateCandidateBlockAndRwSet(t, 6, 10, 1)
 	require.NoError(t, impl.stateDB.PutBlock(blk, blkRwSet))
-	candidates, err = impl.getAllCandidateInfo()
+	candidates, err = impl.getAllCandidateInfo(nil)
 	require.NoError(t, err)
 	require.EqualValues(t, 6, len(candidates))
 
 	// 2. add other 10 candidates
 	blk, blkRwSet = generateCandidateBlockAndRwSet(t, 10, 20, 2)
 	require.NoError(t, impl.stateDB.PutBlock(blk, blkRwSet))
-	candidates, err = impl.getAllCandidateInfo()
+	candidates, err = impl.getAllCandidateInfo(nil)
 	require.NoError(t, err)
 	require.EqualValues(t, 16, len(candidates))
 }
 
+func TestDPoSImpl_GetDelegationsByValidator(t *testing.T) {
+	impl, fn := initDPoSWithStore(t)
+	defer fn()
+
+	delegationWrite := func(delegator, validator string) *common.TxWrite {
+		bz, err := proto.Marshal(&syscontract.Delegation{DelegatorAddress: delegator, ValidatorAddress: validator,
+			Shares: "100"})
+		require.NoError(t, err)
+		return &common.TxWrite{
+			ContractName: syscontract.SystemContract_DPOS_STAKE.String(),
+			Key:          dposmgr.ToDelegationKey(delegator, validator),
+			Value:        bz,
+		}
+	}
+	committed := &common.Block{
+		Header: &common.BlockHeader{ChainId: "test-chain", BlockHeight: 1},
+		Txs:    []*common.Transaction{{Payload: &common.Payload{TxId: "delegate-tx"}}},
+	}
+	require.NoError(t, impl.stateDB.PutBlock(committed, []*common.TxRWSet{{
+		TxId:     "delegate-tx",
+		TxWrites: []*common.TxWrite{delegationWrite("del1", "val1"), delegationWrite("del2", "val1")},
+	}}))
+
+	// the block being proposed delegates to val1 and undelegates all of del2, which are not committed yet
+	block := &common.Block{
+		Header: &common.BlockHeader{ChainId: "test-chain", BlockHeight: 2},
+		Txs:    []*common.Transaction{{Payload: &common.Payload{TxId: "tx1"}}, {Payload: &common.Payload{TxId: "tx2"}}},
+	}
+	undelegated := delegationWrite("del2", "val1")
+	undelegated.Value = nil
+	blockTxRwSet := map[string]*common.TxRWSet{
+		"tx1": {TxId: "tx1", TxWrites: []*common.TxWrite{delegationWrite("del3", "val1")}},
+		"tx2": {TxId: "tx2", TxWrites: []*common.TxWrite{undelegated}},
+	}
+	pending := &common.TxRWSet{TxWrites: []*common.TxWrite{delegationWrite("del4", "val2")}}
+
+	delegations, err := impl.getDelegationsByValidator(pending, block, blockTxRwSet)
+	require.NoError(t, err)
+	require.Len(t, delegations, 2)
+	require.Len(t, delegations["val1"], 2)
+	require.Equal(t, "del1", delegations["val1"][0].DelegatorAddress)
+	require.Equal(t, "del3", delegations["val1"][1].DelegatorAddress)
+	require.Len(t, delegations["val2"], 1)
+	require.Equal(t, "del4", delegations["val2"][0].DelegatorAddress)
+}
+
 func initDPoSWithStore(t *testing.T) (*DPoSImpl, func()) {
 	ctrl := gomock.NewController(t)
 	mockConf := newMockChainConf(ctrl)
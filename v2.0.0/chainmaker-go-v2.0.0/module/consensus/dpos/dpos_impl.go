@@ -72,8 +72,25 @@ func (impl *DPoSImpl) createDPoSRWSet(preBlkHash []byte, proposedBlock *consensu
 		impl.log.Errorf("create complete unbonding error, reason: %s", err)
 		return nil, err
 	}
-	// 4. create newEpoch
-	newEpoch, err := impl.createNewEpoch(blockHeight, epoch, preBlkHash)
+	// 4. slash and reward the validators of the finished epoch
+	params, err := impl.getIncentiveParams()
+	if err != nil {
+		return nil, err
+	}
+	slashRwSet, slashedVals, err := impl.createSlashRwSet(params, epoch, unboundingRwSet, block, blockTxRwSet)
+	if err != nil {
+		impl.log.Errorf("create slash rwSet error, reason: %s", err)
+		return nil, err
+	}
+	unboundingRwSet.TxWrites = append(unboundingRwSet.TxWrites, slashRwSet.TxWrites...)
+	rewardRwSet, err := impl.createRewardRwSet(params, epoch, unboundingRwSet, block, blockTxRwSet)
+	if err != nil {
+		impl.log.Errorf("create reward rwSet error, reason: %s", err)
+		return nil, err
+	}
+	unboundingRwSet.TxWrites = append(unboundingRwSet.TxWrites, rewardRwSet.TxWrites...)
+	// 5. create newEpoch
+	newEpoch, err := impl.createNewEpoch(blockHeight, epoch, preBlkHash, slashedVals)
 	if err != nil {
 		impl.log.Errorf("create new epoch error, reason: %s", err)
 		return nil, err
@@ -83,7 +100,7 @@ func (impl *DPoSImpl) createDPoSRWSet(preBlkHash []byte, proposedBlock *consensu
 		impl.log.Errorf("create epoch rwSet error, reason: %s", err)
 		return nil, err
 	}
-	// 5. Aggregate read-write set
+	// 6. Aggregate read-write set
 	unboundingRwSet.TxWrites = append(unboundingRwSet.TxWrites, epochRwSet.TxWrites...)
 	impl.log.Debugf("end createDPoS rwSet: %v ", unboundingRwSet)
 	return unboundingRwSet, nil
@@ -93,7 +110,8 @@ func (impl *DPoSImpl) isDPoSConsensus() bool {
 	return impl.chainConf.ChainConfig().Consensus.Type == consensus.ConsensusType_DPOS
 }
 
-func (impl *DPoSImpl) createNewEpoch(proposalHeight uint64, oldEpoch *syscontract.Epoch, seed []byte) (*syscontract.Epoch, error) {
+func (impl *DPoSImpl) createNewEpoch(proposalHeight uint64, oldEpoch *syscontract.Epoch, seed []byte,
+	updatedVals map[string]*syscontract.Validator) (*syscontract.Epoch, error) {
 	impl.log.Debugf("begin create new epoch in blockHeight: %d", proposalHeight)
 	// 1. get property: epochBlockNum
 	epochBlockNumBz, err := impl.stateDB.ReadObject(syscontract.SystemContract_DPOS_STAKE.String(), []byte(dposmgr.KeyEpochBlockNumber))
@@ -105,7 +123,7 @@ func (impl *DPoSImpl) createNewEpoch(proposalHeight uint64, oldEpoch *syscontrac
 	impl.log.Debugf("epoch blockNum: %d", epochBlockNum)
 
 	// 2. get all candidates
-	candidates, err := impl.getAllCandidateInfo()
+	candidates, err := impl.getAllCandidateInfo(updatedVals)
 	if err != nil {
 		return nil, err
 	}
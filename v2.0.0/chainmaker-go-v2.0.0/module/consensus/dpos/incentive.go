@@ -0,0 +1,192 @@
+/*
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package dpos
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+
+	"chainmaker.org/chainmaker-go/vm/native/dposmgr"
+
+	commonpb "chainmaker.org/chainmaker/pb-go/v2/common"
+	configpb "chainmaker.org/chainmaker/pb-go/v2/config"
+	"chainmaker.org/chainmaker/pb-go/v2/syscontract"
+)
+
+const (
+	/**
+	  奖励及惩罚的配置，位于 consensus.dpos_config 中，未配置时不发放奖励，也不进行惩罚
+	    - key: stake.epochReward
+	      value: 1000000
+	    - key: stake.commissionRate
+	      value: 10
+	    - key: stake.slashDoubleSignRate
+	      value: 5
+	    - key: stake.slashMissedProposalRate
+	      value: 1
+	    - key: stake.missedProposalThreshold
+	      value: 10
+	*/
+	keyStakeEpochReward             = "stake.epochReward"
+	keyStakeCommissionRate          = "stake.commissionRate"
+	keyStakeSlashDoubleSignRate     = "stake.slashDoubleSignRate"
+	keyStakeSlashMissedProposalRate = "stake.slashMissedProposalRate"
+	keyStakeMissedProposalThreshold = "stake.missedProposalThreshold"
+
+	// the rates are expressed in percent
+	maxRate = 100
+)
+
+// EvidenceType the kind of the misbehavior which the validator is slashed for
+type EvidenceType string
+
+const (
+	EvidenceDoubleSign     EvidenceType = "DOUBLE_SIGN"
+	EvidenceMissedProposal EvidenceType = "MISSED_PROPOSAL"
+)
+
+// SlashEvidence the misbehavior of a validator in an epoch, stored in the stake contract
+// with key dposmgr.ToSlashEvidenceKey and consumed when the epoch switches
+type SlashEvidence struct {
+	Type             EvidenceType `json:"type"`
+	ValidatorAddress string       `json:"validator_address"`
+	BlockHeight      uint64       `json:"block_height"`
+	Round            int64        `json:"round"`
+	Data             []byte       `json:"data,omitempty"`
+}
+
+// NewSlashEvidenceTxWrite create the write which persists the evidence in the stake contract
+func NewSlashEvidenceTxWrite(epochID uint64, evidence *SlashEvidence) (*commonpb.TxWrite, error) {
+	if evidence.Type != EvidenceDoubleSign && evidence.Type != EvidenceMissedProposal {
+		return nil, fmt.Errorf("unknown evidence type: %s", evidence.Type)
+	}
+	bz, err := json.Marshal(evidence)
+	if err != nil {
+		return nil, err
+	}
+	return &commonpb.TxWrite{
+		ContractName: syscontract.SystemContract_DPOS_STAKE.String(),
+		Key: dposmgr.ToSlashEvidenceKey(epochID, evidence.ValidatorAddress, string(evidence.Type),
+			evidence.BlockHeight, uint64(evidence.Round)),
+		Value: bz,
+	}, nil
+}
+
+// incentiveParams the reward and slash params of the DPoS consensus
+type incentiveParams struct {
+	epochReward             *big.Int
+	commissionRate          int64
+	slashDoubleSignRate     int64
+	slashMissedProposalRate int64
+	missedProposalThreshold uint64
+}
+
+func (p *incentiveParams) rewardEnabled() bool {
+	return p.epochReward.Sign() > 0
+}
+
+func (p *incentiveParams) slashEnabled() bool {
+	return p.slashDoubleSignRate > 0 || (p.slashMissedProposalRate > 0 && p.missedProposalThreshold > 0)
+}
+
+// slashRate calculate the rate to be slashed and whether the validator will be jailed
+func (p *incentiveParams) slashRate(doubleSigns, missedProposals uint64) (int64, bool) {
+	var (
+		rate int64
+		jail bool
+	)
+	if doubleSigns > 0 && p.slashDoubleSignRate > 0 {
+		rate += p.slashDoubleSignRate
+		jail = true
+	}
+	if p.missedProposalThreshold > 0 && missedProposals >= p.missedProposalThreshold {
+		rate += p.slashMissedProposalRate
+	}
+	if rate > maxRate {
+		rate = maxRate
+	}
+	return rate, jail
+}
+
+func loadIncentiveParams(consensusExtConfig []*configpb.ConfigKeyValue) (*incentiveParams, error) {
+	params := &incentiveParams{epochReward: big.NewInt(0)}
+	for _, kv := range consensusExtConfig {
+		var err error
+		switch kv.Key {
+		case keyStakeEpochReward:
+			reward, ok := big.NewInt(0).SetString(string(kv.Value), 10)
+			if !ok || reward.Sign() < 0 {
+				return nil, fmt.Errorf("%s error, actual: %s", keyStakeEpochReward, kv.Value)
+			}
+			params.epochReward = reward
+		case keyStakeCommissionRate:
+			params.commissionRate, err = parseRate(kv.Key, string(kv.Value))
+		case keyStakeSlashDoubleSignRate:
+			params.slashDoubleSignRate, err = parseRate(kv.Key, string(kv.Value))
+		case keyStakeSlashMissedProposalRate:
+			params.slashMissedProposalRate, err = parseRate(kv.Key, string(kv.Value))
+		case keyStakeMissedProposalThreshold:
+			params.missedProposalThreshold, err = strconv.ParseUint(string(kv.Value), 10, 64)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return params, nil
+}
+
+func parseRate(key, val string) (int64, error) {
+	rate, err := strconv.ParseInt(val, 10, 64)
+	if err != nil || rate < 0 || rate > maxRate {
+		return 0, fmt.Errorf("%s error, expect a percent in [0, %d], actual: %s", key, maxRate, val)
+	}
+	return rate, nil
+}
+
+// splitReward split the reward of a validator, the commission belongs to the validator, the rest is
+// shared by the delegations (include the self delegation) according to their shares,
+// the remainder of the division also belongs to the validator.
+// the returned amounts are in the same order as the delegations, the last one is the amount of the validator.
+func splitReward(reward *big.Int, commissionRate int64, validatorShares *big.Int,
+	delegations []*syscontract.Delegation) ([]*big.Int, error) {
+	amounts := make([]*big.Int, 0, len(delegations)+1)
+	commission := big.NewInt(0).Mul(reward, big.NewInt(commissionRate))
+	commission.Div(commission, big.NewInt(maxRate))
+	rest := big.NewInt(0).Sub(reward, commission)
+	distributed := big.NewInt(0)
+	for _, delegation := range delegations {
+		amount := big.NewInt(0)
+		if validatorShares.Sign() > 0 {
+			shares, ok := big.NewInt(0).SetString(delegation.Shares, 10)
+			if !ok {
+				return nil, fmt.Errorf("invalid shares of delegation[%s/%s]: %s",
+					delegation.DelegatorAddress, delegation.ValidatorAddress, delegation.Shares)
+			}
+			amount.Mul(rest, shares).Div(amount, validatorShares)
+		}
+		distributed.Add(distributed, amount)
+		amounts = append(amounts, amount)
+	}
+	if distributed.Cmp(rest) > 0 {
+		return nil, fmt.Errorf("the shares of delegations exceed the shares of validator: %s", validatorShares.String())
+	}
+	validatorAmount := commission.Add(commission, rest.Sub(rest, distributed))
+	return append(amounts, validatorAmount), nil
+}
+
+// slashAmount calculate the amount to be slashed by the rate
+func slashAmount(amount string, rate int64) (*big.Int, *big.Int, error) {
+	before, ok := big.NewInt(0).SetString(amount, 10)
+	if !ok {
+		return nil, nil, fmt.Errorf("invalid amount: %s", amount)
+	}
+	slashed := big.NewInt(0).Mul(before, big.NewInt(rate))
+	slashed.Div(slashed, big.NewInt(maxRate))
+	return slashed, before.Sub(before, slashed), nil
+}
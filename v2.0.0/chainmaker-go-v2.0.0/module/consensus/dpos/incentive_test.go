@@ -0,0 +1,183 @@
+/*
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package dpos
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"chainmaker.org/chainmaker-go/vm/native/dposmgr"
+	configpb "chainmaker.org/chainmaker/pb-go/v2/config"
+	"chainmaker.org/chainmaker/pb-go/v2/syscontract"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadIncentiveParams(t *testing.T) {
+	params, err := loadIncentiveParams(nil)
+	require.NoError(t, err)
+	require.False(t, params.rewardEnabled())
+	require.False(t, params.slashEnabled())
+
+	params, err = loadIncentiveParams([]*configpb.ConfigKeyValue{
+		{Key: keyStakeEpochReward, Value: "1000000"},
+		{Key: keyStakeCommissionRate, Value: "10"},
+		{Key: keyStakeSlashDoubleSignRate, Value: "5"},
+		{Key: keyStakeSlashMissedProposalRate, Value: "1"},
+		{Key: keyStakeMissedProposalThreshold, Value: "3"},
+		{Key: "stake.epochBlockNum", Value: "10"},
+	})
+	require.NoError(t, err)
+	require.True(t, params.rewardEnabled())
+	require.True(t, params.slashEnabled())
+	require.EqualValues(t, "1000000", params.epochReward.String())
+	require.EqualValues(t, 10, params.commissionRate)
+	require.EqualValues(t, 3, params.missedProposalThreshold)
+
+	_, err = loadIncentiveParams([]*configpb.ConfigKeyValue{{Key: keyStakeCommissionRate, Value: "101"}})
+	require.Error(t, err)
+	_, err = loadIncentiveParams([]*configpb.ConfigKeyValue{{Key: keyStakeEpochReward, Value: "-1"}})
+	require.Error(t, err)
+}
+
+func TestIncentiveParams_SlashRate(t *testing.T) {
+	params := &incentiveParams{
+		epochReward:             big.NewInt(0),
+		slashDoubleSignRate:     60,
+		slashMissedProposalRate: 50,
+		missedProposalThreshold: 2,
+	}
+	rate, jail := params.slashRate(0, 1)
+	require.EqualValues(t, 0, rate)
+	require.False(t, jail)
+
+	rate, jail = params.slashRate(0, 2)
+	require.EqualValues(t, 50, rate)
+	require.False(t, jail)
+
+	rate, jail = params.slashRate(1, 0)
+	require.EqualValues(t, 60, rate)
+	require.True(t, jail)
+
+	rate, jail = params.slashRate(1, 2)
+	require.EqualValues(t, maxRate, rate)
+	require.True(t, jail)
+}
+
+func TestSplitReward(t *testing.T) {
+	delegations := []*syscontract.Delegation{
+		{DelegatorAddress: "val1", ValidatorAddress: "val1", Shares: "500"},
+		{DelegatorAddress: "del1", ValidatorAddress: "val1", Shares: "300"},
+		{DelegatorAddress: "del2", ValidatorAddress: "val1", Shares: "200"},
+	}
+	amounts, err := splitReward(big.NewInt(1001), 10, big.NewInt(1000), delegations)
+	require.NoError(t, err)
+	require.EqualValues(t, 4, len(amounts))
+	// commission: 100, rest: 901
+	require.EqualValues(t, "450", amounts[0].String())
+	require.EqualValues(t, "270", amounts[1].String())
+	require.EqualValues(t, "180", amounts[2].String())
+	// commission and the remainder of the division
+	require.EqualValues(t, "101", amounts[3].String())
+
+	total := big.NewInt(0)
+	for _, amount := range amounts {
+		total.Add(total, amount)
+	}
+	require.EqualValues(t, "1001", total.String())
+
+	// no delegations, the validator takes all
+	amounts, err = splitReward(big.NewInt(1001), 10, big.NewInt(0), nil)
+	require.NoError(t, err)
+	require.EqualValues(t, "1001", amounts[0].String())
+
+	_, err = splitReward(big.NewInt(1001), 10, big.NewInt(100), delegations)
+	require.Error(t, err)
+}
+
+func TestSlashAmount(t *testing.T) {
+	slashed, after, err := slashAmount("1005", 10)
+	require.NoError(t, err)
+	require.EqualValues(t, "100", slashed.String())
+	require.EqualValues(t, "905", after.String())
+
+	_, _, err = slashAmount("invalid", 10)
+	require.Error(t, err)
+}
+
+func TestNewSlashEvidenceTxWrite(t *testing.T) {
+	evidence := &SlashEvidence{Type: EvidenceDoubleSign, ValidatorAddress: "val1", BlockHeight: 10, Round: 1}
+	write, err := NewSlashEvidenceTxWrite(2, evidence)
+	require.NoError(t, err)
+	require.EqualValues(t, syscontract.SystemContract_DPOS_STAKE.String(), write.ContractName)
+	require.EqualValues(t, dposmgr.ToSlashEvidenceKey(2, "val1", string(EvidenceDoubleSign), 10, 1), write.Key)
+
+	decoded := &SlashEvidence{}
+	require.NoError(t, json.Unmarshal(write.Value, decoded))
+	require.EqualValues(t, evidence, decoded)
+
+	// the evidences of the other type or round at the same height are recorded apart
+	missed, err := NewSlashEvidenceTxWrite(2, &SlashEvidence{Type: EvidenceMissedProposal,
+		ValidatorAddress: "val1", BlockHeight: 10, Round: 1})
+	require.NoError(t, err)
+	require.NotEqual(t, write.Key, missed.Key)
+	otherRound, err := NewSlashEvidenceTxWrite(2, &SlashEvidence{Type: EvidenceMissedProposal,
+		ValidatorAddress: "val1", BlockHeight: 10, Round: 2})
+	require.NoError(t, err)
+	require.NotEqual(t, missed.Key, otherRound.Key)
+	require.True(t, dposmgr.IsSlashEvidenceKey(otherRound.Key))
+
+	_, err = NewSlashEvidenceTxWrite(2, &SlashEvidence{Type: "UNKNOWN"})
+	require.Error(t, err)
+}
+
+func TestDPoSImpl_NewDoubleSignEvidenceTxWrite(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	impl := NewDPoSImpl(newMockChainConf(ctrl), newMockBlockChainStore(ctrl))
+
+	write, err := impl.NewDoubleSignEvidenceTxWrite(10, testNodeID, 9, 1, []byte("votes"))
+	require.NoError(t, err)
+	require.EqualValues(t, dposmgr.ToSlashEvidenceKey(0, testAddr, string(EvidenceDoubleSign), 9, 1), write.Key)
+	decoded := &SlashEvidence{}
+	require.NoError(t, json.Unmarshal(write.Value, decoded))
+	require.EqualValues(t, &SlashEvidence{Type: EvidenceDoubleSign, ValidatorAddress: testAddr, BlockHeight: 9,
+		Round: 1, Data: []byte("votes")}, decoded)
+
+	// the block creating the new epoch records the evidence in the new epoch
+	write, err = impl.NewDoubleSignEvidenceTxWrite(100, testNodeID, 9, 1, nil)
+	require.NoError(t, err)
+	require.EqualValues(t, dposmgr.ToSlashEvidenceKey(1, testAddr, string(EvidenceDoubleSign), 9, 1), write.Key)
+
+	write, err = impl.NewDoubleSignEvidenceTxWrite(10, "QmUnknown", 9, 1, nil)
+	require.NoError(t, err)
+	require.Nil(t, write)
+}
+
+func TestDPoSImpl_NewMissedProposalEvidenceTxWrite(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	impl := NewDPoSImpl(newMockChainConf(ctrl), newMockBlockChainStore(ctrl))
+
+	write, err := impl.NewMissedProposalEvidenceTxWrite(10, testNodeID, 9, 2)
+	require.NoError(t, err)
+	require.EqualValues(t, dposmgr.ToSlashEvidenceKey(0, testAddr, string(EvidenceMissedProposal), 9, 2), write.Key)
+	decoded := &SlashEvidence{}
+	require.NoError(t, json.Unmarshal(write.Value, decoded))
+	require.EqualValues(t, &SlashEvidence{Type: EvidenceMissedProposal, ValidatorAddress: testAddr, BlockHeight: 9,
+		Round: 2}, decoded)
+
+	// the rounds of the block creating the current epoch are proposed by the validators of the last epoch
+	write, err = impl.NewMissedProposalEvidenceTxWrite(97, testNodeID, 96, 0)
+	require.NoError(t, err)
+	require.Nil(t, write)
+
+	write, err = impl.NewMissedProposalEvidenceTxWrite(10, "QmUnknown", 9, 0)
+	require.NoError(t, err)
+	require.Nil(t, write)
+}
@@ -25,6 +25,7 @@ import (
 var (
 	testAddr        = "addr1-balance"
 	testAddrBalance = 9999
+	testNodeID      = "QmNode1"
 )
 
 func newMockBlockChainStore(ctrl *gomock.Controller) protocol.BlockchainStore {
@@ -34,6 +35,9 @@ func newMockBlockChainStore(ctrl *gomock.Controller) protocol.BlockchainStore {
 			if bytes.Equal(key, []byte(native.BalanceKey(testAddr))) {
 				return []byte(fmt.Sprintf("%d", testAddrBalance)), nil
 			}
+			if bytes.Equal(key, native.ToReverseNodeIDKey(testNodeID)) {
+				return []byte(testAddr), nil
+			}
 			if bytes.Equal(key, []byte(native.KeyMinSelfDelegation)) {
 				return []byte("200000"), nil
 			}
@@ -31,3 +31,18 @@ func (impl *DPoSImpl) getState(contractName string, key []byte, block *common.Bl
 	}
 	return val, nil
 }
+
+// getPendingState read the value of the key, the writes of the consensus rwSet that are being built
+// take precedence over the writes of the block and the state in ledger
+func (impl *DPoSImpl) getPendingState(contractName string, key []byte, pending *common.TxRWSet,
+	block *common.Block, blockTxRwSet map[string]*common.TxRWSet) ([]byte, error) {
+	if pending != nil {
+		for i := len(pending.TxWrites) - 1; i >= 0; i-- {
+			txWrite := pending.TxWrites[i]
+			if txWrite.ContractName == contractName && bytes.Equal(txWrite.Key, key) {
+				return txWrite.Value, nil
+			}
+		}
+	}
+	return impl.getState(contractName, key, block, blockTxRwSet)
+}
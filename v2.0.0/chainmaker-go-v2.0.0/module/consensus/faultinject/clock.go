@@ -0,0 +1,155 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package faultinject
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock schedules the delayed messages of the network, the same clock takes the place of the timers of the
+// consensus engines in a test cluster
+type Clock interface {
+	Now() time.Time
+	// AfterFunc calls f after d, the returned stop cancels the call and reports whether it was pending
+	AfterFunc(d time.Duration, f func()) (stop func() bool)
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) AfterFunc(d time.Duration, f func()) func() bool {
+	return time.AfterFunc(d, f).Stop
+}
+
+// RealClock returns the clock of the system time
+func RealClock() Clock {
+	return realClock{}
+}
+
+// FakeClock is a clock moved by the test only, the funcs scheduled are called when the clock is advanced past
+// their deadlines, so a cluster runs through its timeouts without waiting for them
+type FakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	seq    uint64
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	deadline time.Time
+	seq      uint64
+	f        func()
+}
+
+// NewFakeClock returns a fake clock starting at now
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+// Now returns the time of the clock
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// AfterFunc schedules f at d after the time of the clock, f is called in its own goroutine at once if d is
+// not positive like time.AfterFunc
+func (c *FakeClock) AfterFunc(d time.Duration, f func()) func() bool {
+	if d <= 0 {
+		go f()
+		return func() bool { return false }
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	timer := &fakeTimer{deadline: c.now.Add(d), seq: c.seq, f: f}
+	c.seq++
+	c.timers = append(c.timers, timer)
+	return func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		for i, t := range c.timers {
+			if t == timer {
+				c.timers = append(c.timers[:i], c.timers[i+1:]...)
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Advance moves the clock forward by d, and calls the funcs due in the order of their deadlines
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	end := c.now.Add(d)
+	c.mu.Unlock()
+	for {
+		c.mu.Lock()
+		sort.Slice(c.timers, func(i, j int) bool {
+			if !c.timers[i].deadline.Equal(c.timers[j].deadline) {
+				return c.timers[i].deadline.Before(c.timers[j].deadline)
+			}
+			return c.timers[i].seq < c.timers[j].seq
+		})
+		if len(c.timers) == 0 || c.timers[0].deadline.After(end) {
+			c.now = end
+			c.mu.Unlock()
+			return
+		}
+		timer := c.timers[0]
+		c.timers = c.timers[1:]
+		c.now = timer.deadline
+		c.mu.Unlock()
+		// the funcs may schedule others, which are called in this advance if they are due
+		timer.f()
+	}
+}
+
+// Next returns the duration to the earliest deadline of the funcs scheduled, false if none is scheduled
+func (c *FakeClock) Next() (time.Duration, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.timers) == 0 {
+		return 0, false
+	}
+	next := c.timers[0].deadline
+	for _, t := range c.timers[1:] {
+		if t.deadline.Before(next) {
+			next = t.deadline
+		}
+	}
+	return next.Sub(c.now), true
+}
+
+// Run drives a test cluster on the fake clock until done returns true. The nodes are left to run in real time
+// while they send messages on the network, and the clock is advanced to the next deadline, e.g. a delayed
+// message or a timeout of a node, once no message is sent for the settle time, so the cluster never waits for
+// its timeouts in real time. It fails after the cluster is found idle maxSteps times.
+func Run(network *Network, clock *FakeClock, settle time.Duration, maxSteps int, done func() bool) error {
+	for steps := 0; !done(); {
+		sent := network.Sent()
+		time.Sleep(settle)
+		if done() || network.Sent() != sent {
+			continue
+		}
+		if steps >= maxSteps {
+			return fmt.Errorf("the cluster is still running after advancing the clock %d times", maxSteps)
+		}
+		steps++
+		// the nodes may be busy without sending messages if no func is scheduled
+		if d, ok := clock.Next(); ok {
+			clock.Advance(d)
+		}
+	}
+	return nil
+}
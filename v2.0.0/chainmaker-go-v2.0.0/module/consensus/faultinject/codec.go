@@ -0,0 +1,305 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package faultinject
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"strings"
+
+	cbftutils "chainmaker.org/chainmaker-go/consensus/chainedbft/utils"
+	"chainmaker.org/chainmaker-go/utils"
+	"chainmaker.org/chainmaker/pb-go/v2/common"
+	chainedbftpb "chainmaker.org/chainmaker/pb-go/v2/consensus/chainedbft"
+	tbftpb "chainmaker.org/chainmaker/pb-go/v2/consensus/tbft"
+	"chainmaker.org/chainmaker/protocol/v2"
+	"github.com/gogo/protobuf/proto"
+	"go.etcd.io/etcd/raft/v3/raftpb"
+)
+
+// ErrEquivocationUnsupported is returned by the codec which can't forge a conflicting message
+var ErrEquivocationUnsupported = errors.New("equivocation is not supported")
+
+// MsgInfo is the information of a consensus message matched by the rules
+type MsgInfo struct {
+	Type   string
+	Height uint64
+	Round  uint64
+	// Author is the node which created and signed the message, it may differ from the sender if the message
+	// is relayed, e.g. the votes gossiped by tbft
+	Author string
+}
+
+// MsgCodec decodes the payloads of the net messages of a consensus algorithm
+type MsgCodec interface {
+	// Types returns the names of the message types
+	Types() []string
+	// Decode returns the information of the payload
+	Decode(payload []byte) (*MsgInfo, error)
+	// Equivocate returns a payload conflicting with the given one, it is signed by the signer
+	Equivocate(payload []byte, signer protocol.SigningMember) ([]byte, error)
+}
+
+// conflictingHash returns another hash which the equivocating node votes for instead of hash
+func conflictingHash(hash []byte) []byte {
+	h := sha256.Sum256(append([]byte("equivocation-"), hash...))
+	return h[:]
+}
+
+// forkBlock returns a copy of the block with another hash, it is signed by the signer as the proposer
+func forkBlock(hashType string, block *common.Block, signer protocol.SigningMember) (*common.Block, error) {
+	if block == nil || block.Header == nil {
+		return nil, errors.New("nil block")
+	}
+	fork := proto.Clone(block).(*common.Block)
+	fork.Header.BlockTimestamp++
+	fork.Header.BlockHash = nil
+	fork.Header.Signature = nil
+	hash, sig, err := utils.SignBlock(hashType, signer, fork)
+	if err != nil {
+		return nil, err
+	}
+	fork.Header.BlockHash = hash
+	fork.Header.Signature = sig
+	return fork, nil
+}
+
+func signEntry(hashType string, signer protocol.SigningMember, data []byte) (*common.EndorsementEntry, error) {
+	sig, err := signer.Sign(hashType, data)
+	if err != nil {
+		return nil, err
+	}
+	member, err := signer.GetMember()
+	if err != nil {
+		return nil, err
+	}
+	return &common.EndorsementEntry{Signer: member, Signature: sig}, nil
+}
+
+// tbftCodec decodes tbftpb.TBFTMsg, the type names are the TBFTMsgType without the MSG_ prefix
+type tbftCodec struct {
+	hashType string
+}
+
+// NewTBFTCodec returns the codec of tbft, hashType is the hash algorithm of the chain used to sign messages
+func NewTBFTCodec(hashType string) MsgCodec {
+	return &tbftCodec{hashType: hashType}
+}
+
+func (c *tbftCodec) Types() []string {
+	types := make([]string, 0, len(tbftpb.TBFTMsgType_name))
+	for _, name := range tbftpb.TBFTMsgType_name {
+		types = append(types, strings.TrimPrefix(name, "MSG_"))
+	}
+	return types
+}
+
+func (c *tbftCodec) Decode(payload []byte) (*MsgInfo, error) {
+	msg := new(tbftpb.TBFTMsg)
+	if err := proto.Unmarshal(payload, msg); err != nil {
+		return nil, err
+	}
+	info := &MsgInfo{Type: strings.TrimPrefix(msg.Type.String(), "MSG_")}
+	switch msg.Type {
+	case tbftpb.TBFTMsgType_MSG_PROPOSE:
+		proposal := new(tbftpb.Proposal)
+		if err := proto.Unmarshal(msg.Msg, proposal); err != nil {
+			return nil, err
+		}
+		info.Height, info.Round, info.Author = proposal.Height, uint64(proposal.Round), proposal.Voter
+	case tbftpb.TBFTMsgType_MSG_PREVOTE, tbftpb.TBFTMsgType_MSG_PRECOMMIT:
+		vote := new(tbftpb.Vote)
+		if err := proto.Unmarshal(msg.Msg, vote); err != nil {
+			return nil, err
+		}
+		info.Height, info.Round, info.Author = vote.Height, uint64(vote.Round), vote.Voter
+	case tbftpb.TBFTMsgType_MSG_STATE:
+		state := new(tbftpb.GossipState)
+		if err := proto.Unmarshal(msg.Msg, state); err != nil {
+			return nil, err
+		}
+		info.Height, info.Round, info.Author = state.Height, uint64(state.Round), state.Id
+	}
+	return info, nil
+}
+
+// Equivocate forks the block of the proposal, or votes for another hash, the signatures are created in the
+// same way as ConsensusTBFTImpl.signProposal and signVote
+func (c *tbftCodec) Equivocate(payload []byte, signer protocol.SigningMember) ([]byte, error) {
+	msg := new(tbftpb.TBFTMsg)
+	if err := proto.Unmarshal(payload, msg); err != nil {
+		return nil, err
+	}
+	var forged proto.Message
+	switch msg.Type {
+	case tbftpb.TBFTMsgType_MSG_PROPOSE:
+		proposal := new(tbftpb.Proposal)
+		if err := proto.Unmarshal(msg.Msg, proposal); err != nil {
+			return nil, err
+		}
+		block, err := forkBlock(c.hashType, proposal.Block, signer)
+		if err != nil {
+			return nil, err
+		}
+		proposal.Block, proposal.Endorsement = block, nil
+		// the additional data of the block is not signed, see ConsensusTBFTImpl.verifyProposal
+		unsigned := proto.Clone(proposal).(*tbftpb.Proposal)
+		unsigned.Block.AdditionalData = nil
+		data, err := proto.Marshal(unsigned)
+		if err != nil {
+			return nil, err
+		}
+		if proposal.Endorsement, err = signEntry(c.hashType, signer, data); err != nil {
+			return nil, err
+		}
+		forged = proposal
+	case tbftpb.TBFTMsgType_MSG_PREVOTE, tbftpb.TBFTMsgType_MSG_PRECOMMIT:
+		vote := new(tbftpb.Vote)
+		if err := proto.Unmarshal(msg.Msg, vote); err != nil {
+			return nil, err
+		}
+		vote.Hash, vote.Endorsement = conflictingHash(vote.Hash), nil
+		data, err := proto.Marshal(vote)
+		if err != nil {
+			return nil, err
+		}
+		if vote.Endorsement, err = signEntry(c.hashType, signer, data); err != nil {
+			return nil, err
+		}
+		forged = vote
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrEquivocationUnsupported, msg.Type)
+	}
+	data, err := proto.Marshal(forged)
+	if err != nil {
+		return nil, err
+	}
+	return proto.Marshal(&tbftpb.TBFTMsg{Type: msg.Type, Msg: data})
+}
+
+// raftCodec decodes raftpb.Message, the height is the log index and the round is the term
+type raftCodec struct{}
+
+// NewRaftCodec returns the codec of raft, raft assumes no byzantine nodes, so the equivocation is not supported
+func NewRaftCodec() MsgCodec {
+	return &raftCodec{}
+}
+
+func (c *raftCodec) Types() []string {
+	types := make([]string, 0, len(raftpb.MessageType_name))
+	for _, name := range raftpb.MessageType_name {
+		types = append(types, name)
+	}
+	return types
+}
+
+func (c *raftCodec) Decode(payload []byte) (*MsgInfo, error) {
+	msg := raftpb.Message{}
+	if err := msg.Unmarshal(payload); err != nil {
+		return nil, err
+	}
+	return &MsgInfo{
+		Type:   msg.Type.String(),
+		Height: msg.Index,
+		Round:  msg.Term,
+		Author: fmt.Sprintf("%x", msg.From),
+	}, nil
+}
+
+func (c *raftCodec) Equivocate(payload []byte, signer protocol.SigningMember) ([]byte, error) {
+	return nil, ErrEquivocationUnsupported
+}
+
+// chainedBFTCodec decodes chainedbftpb.ConsensusMsg, the round is the level, the type names are the
+// MessageType without the _MESSAGE suffix
+type chainedBFTCodec struct {
+	hashType string
+}
+
+// NewChainedBFTCodec returns the codec of chainedbft(hotstuff), hashType is the hash algorithm of the chain
+func NewChainedBFTCodec(hashType string) MsgCodec {
+	return &chainedBFTCodec{hashType: hashType}
+}
+
+func (c *chainedBFTCodec) Types() []string {
+	types := make([]string, 0, len(chainedbftpb.MessageType_name))
+	for _, name := range chainedbftpb.MessageType_name {
+		types = append(types, strings.TrimSuffix(name, "_MESSAGE"))
+	}
+	return types
+}
+
+func (c *chainedBFTCodec) Decode(payload []byte) (*MsgInfo, error) {
+	msg := new(chainedbftpb.ConsensusMsg)
+	if err := proto.Unmarshal(payload, msg); err != nil {
+		return nil, err
+	}
+	if msg.Payload == nil {
+		return nil, errors.New("nil consensus payload")
+	}
+	info := &MsgInfo{Type: strings.TrimSuffix(msg.Payload.Type.String(), "_MESSAGE")}
+	switch msg.Payload.Type {
+	case chainedbftpb.MessageType_PROPOSAL_MESSAGE:
+		if proposal := msg.Payload.GetProposalMsg().GetProposalData(); proposal != nil {
+			info.Height, info.Round, info.Author = proposal.Height, proposal.Level, string(proposal.Proposer)
+		}
+	case chainedbftpb.MessageType_VOTE_MESSAGE:
+		if vote := msg.Payload.GetVoteMsg().GetVoteData(); vote != nil {
+			info.Height, info.Round, info.Author = vote.Height, vote.Level, string(vote.Author)
+		}
+	case chainedbftpb.MessageType_BLOCK_FETCH_MESSAGE:
+		if fetch := msg.Payload.GetBlockFetchMsg(); fetch != nil {
+			info.Height = fetch.Height
+		}
+	}
+	return info, nil
+}
+
+// Equivocate forks the block of the proposal, or votes for another block, the signatures are created in the
+// same way as ConsensusChainedBftImpl.constructVote and signAndMarshal
+func (c *chainedBFTCodec) Equivocate(payload []byte, signer protocol.SigningMember) ([]byte, error) {
+	msg := new(chainedbftpb.ConsensusMsg)
+	if err := proto.Unmarshal(payload, msg); err != nil {
+		return nil, err
+	}
+	if msg.Payload == nil {
+		return nil, errors.New("nil consensus payload")
+	}
+	switch msg.Payload.Type {
+	case chainedbftpb.MessageType_PROPOSAL_MESSAGE:
+		proposal := msg.Payload.GetProposalMsg().GetProposalData()
+		if proposal == nil {
+			return nil, errors.New("nil proposal data")
+		}
+		block, err := forkBlock(c.hashType, proposal.Block, signer)
+		if err != nil {
+			return nil, err
+		}
+		proposal.Block = block
+	case chainedbftpb.MessageType_VOTE_MESSAGE:
+		vote := msg.Payload.GetVoteMsg().GetVoteData()
+		if vote == nil || vote.NewView {
+			return nil, fmt.Errorf("%w: vote without block", ErrEquivocationUnsupported)
+		}
+		vote.BlockId, vote.Signature = conflictingHash(vote.BlockId), nil
+		data, err := proto.Marshal(vote)
+		if err != nil {
+			return nil, err
+		}
+		if vote.Signature, err = signEntry(c.hashType, signer, data); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrEquivocationUnsupported, msg.Payload.Type)
+	}
+	msg.SignEntry = nil
+	if err := cbftutils.SignConsensusMsg(msg, c.hashType, signer); err != nil {
+		return nil, err
+	}
+	return proto.Marshal(msg)
+}
@@ -0,0 +1,27 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+/*
+Package faultinject injects scripted byzantine faults into the messages between the consensus nodes in tests.
+
+A scenario is loaded from yaml, e.g. the node2 drops its prevotes to the others at heights 2 to 3, and the
+node4 is partitioned from the others from height 5:
+
+	name: prevote_lost
+	seed: 1
+	rules:
+	  - action: drop
+	    from: [node2]
+	    types: [PREVOTE]
+	    heights: 2-3
+	  - action: partition
+	    groups: [[node4]]
+	    heights: 5-
+
+The nodes of a test cluster are connected by a Network with the Injector of the scenario, instead of the
+net service.
+*/
+package faultinject
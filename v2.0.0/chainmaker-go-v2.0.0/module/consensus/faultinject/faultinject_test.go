@@ -0,0 +1,280 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package faultinject
+
+import (
+	"testing"
+	"time"
+
+	"chainmaker.org/chainmaker/common/v2/crypto"
+	"chainmaker.org/chainmaker/common/v2/msgbus"
+	pbac "chainmaker.org/chainmaker/pb-go/v2/accesscontrol"
+	"chainmaker.org/chainmaker/pb-go/v2/common"
+	tbftpb "chainmaker.org/chainmaker/pb-go/v2/consensus/tbft"
+	netpb "chainmaker.org/chainmaker/pb-go/v2/net"
+	"chainmaker.org/chainmaker/protocol/v2/mock"
+	"github.com/gogo/protobuf/proto"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func newTBFTVote(t *testing.T, typ tbftpb.TBFTMsgType, voter string, height uint64, round int32) []byte {
+	voteType := tbftpb.VoteType_VOTE_PREVOTE
+	if typ == tbftpb.TBFTMsgType_MSG_PRECOMMIT {
+		voteType = tbftpb.VoteType_VOTE_PRECOMMIT
+	}
+	vote, err := proto.Marshal(&tbftpb.Vote{Type: voteType, Voter: voter, Height: height, Round: round,
+		Hash: []byte("block")})
+	require.NoError(t, err)
+	msg, err := proto.Marshal(&tbftpb.TBFTMsg{Type: typ, Msg: vote})
+	require.NoError(t, err)
+	return msg
+}
+
+func newTBFTProposal(t *testing.T, voter string, height uint64, round int32) []byte {
+	proposal, err := proto.Marshal(&tbftpb.Proposal{Voter: voter, Height: height, Round: round,
+		Block: &common.Block{Header: &common.BlockHeader{BlockHeight: height, BlockHash: []byte("block")}}})
+	require.NoError(t, err)
+	msg, err := proto.Marshal(&tbftpb.TBFTMsg{Type: tbftpb.TBFTMsgType_MSG_PROPOSE, Msg: proposal})
+	require.NoError(t, err)
+	return msg
+}
+
+func newSigner(ctrl *gomock.Controller, id string) *mock.MockSigningMember {
+	signer := mock.NewMockSigningMember(ctrl)
+	signer.EXPECT().Sign(gomock.Any(), gomock.Any()).Return([]byte("sig-"+id), nil).AnyTimes()
+	signer.EXPECT().GetMember().Return(&pbac.Member{MemberInfo: []byte(id)}, nil).AnyTimes()
+	return signer
+}
+
+func TestLoadScenario(t *testing.T) {
+	scenario, err := LoadScenario("testdata/scenario.yml")
+	require.NoError(t, err)
+	require.Equal(t, "byzantine_node2", scenario.Name)
+	require.EqualValues(t, 7, scenario.Seed)
+	require.Len(t, scenario.Rules, 5)
+	require.Equal(t, ActionEquivocate, scenario.Rules[0].Action)
+	require.Equal(t, []string{"node3", "node4"}, scenario.Rules[0].To)
+	require.Equal(t, span{min: 2, max: 2}, scenario.Rules[0].heights)
+	require.Equal(t, span{min: 0, max: 0}, scenario.Rules[2].rounds)
+	require.Equal(t, 200*time.Millisecond, scenario.Rules[2].Delay)
+	require.Equal(t, 3, scenario.Rules[3].Times)
+	require.Equal(t, [][]string{{"node4"}}, scenario.Rules[4].Groups)
+	require.Equal(t, span{min: 5, unbounded: true}, scenario.Rules[4].heights)
+
+	_, err = NewInjector(scenario, NewTBFTCodec(crypto.CRYPTO_ALGO_SHA256))
+	require.NoError(t, err)
+	// the message types are checked against the codec
+	_, err = NewInjector(scenario, NewRaftCodec())
+	require.Error(t, err)
+
+	for _, rule := range []*Rule{
+		{Action: "crash"},
+		{Action: ActionDelay},
+		{Action: ActionDrop, Heights: "5-3"},
+		{Action: ActionDrop, Probability: 2},
+		{Action: ActionPartition},
+		{Action: ActionPartition, Groups: [][]string{{"node1"}, {"node1", "node2"}}},
+	} {
+		require.Error(t, (&Scenario{Rules: []*Rule{rule}}).Validate(), rule.Action)
+	}
+}
+
+func TestInjector_Apply(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	scenario := &Scenario{Rules: []*Rule{
+		{Action: ActionDrop, From: []string{"node1"}, Types: []string{"PRECOMMIT"}, Heights: "2-3"},
+		{Action: ActionDelay, To: []string{"node3"}, Types: []string{"PROPOSE"}, Rounds: "0", Delay: time.Second},
+		{Action: ActionDuplicate, From: []string{"node2"}, Types: []string{"PREVOTE"}, Copies: 2, Times: 1},
+		{Action: ActionEquivocate, From: []string{"node4"}, To: []string{"node3"}},
+		{Action: ActionPartition, Groups: [][]string{{"node1", "node2"}}, Heights: "10-"},
+	}}
+	inj, err := NewInjector(scenario, NewTBFTCodec(crypto.CRYPTO_ALGO_SHA256))
+	require.NoError(t, err)
+	apply := func(from, to string, payload []byte) []*Delivery {
+		return inj.Apply(&Message{From: from, To: to, Payload: payload}, newSigner(ctrl, from))
+	}
+
+	// drop
+	precommit := newTBFTVote(t, tbftpb.TBFTMsgType_MSG_PRECOMMIT, "node1", 2, 0)
+	require.Empty(t, apply("node1", "node2", precommit))
+	require.Len(t, apply("node2", "node1", newTBFTVote(t, tbftpb.TBFTMsgType_MSG_PRECOMMIT, "node2", 2, 0)), 1)
+	require.Len(t, apply("node1", "node2", newTBFTVote(t, tbftpb.TBFTMsgType_MSG_PRECOMMIT, "node1", 4, 0)), 1)
+
+	// delay
+	deliveries := apply("node1", "node3", newTBFTProposal(t, "node1", 1, 0))
+	require.Len(t, deliveries, 1)
+	require.Equal(t, time.Second, deliveries[0].Delay)
+	require.Zero(t, apply("node1", "node3", newTBFTProposal(t, "node1", 1, 1))[0].Delay)
+
+	// duplicate, only once on each link
+	prevote := newTBFTVote(t, tbftpb.TBFTMsgType_MSG_PREVOTE, "node2", 1, 0)
+	require.Len(t, apply("node2", "node1", prevote), 3)
+	require.Len(t, apply("node2", "node1", prevote), 1)
+	require.Len(t, apply("node2", "node3", prevote), 3)
+	// the times are counted on each message, not on the messages sent before it
+	require.Len(t, apply("node2", "node1", newTBFTVote(t, tbftpb.TBFTMsgType_MSG_PREVOTE, "node2", 2, 0)), 3)
+
+	// equivocate the messages signed by node4 only
+	prevote = newTBFTVote(t, tbftpb.TBFTMsgType_MSG_PREVOTE, "node4", 1, 0)
+	deliveries = apply("node4", "node3", prevote)
+	require.Len(t, deliveries, 1)
+	msg := new(tbftpb.TBFTMsg)
+	require.NoError(t, proto.Unmarshal(deliveries[0].Payload, msg))
+	vote := new(tbftpb.Vote)
+	require.NoError(t, proto.Unmarshal(msg.Msg, vote))
+	require.Equal(t, "node4", vote.Voter)
+	require.NotEqual(t, []byte("block"), vote.Hash)
+	require.Equal(t, []byte("sig-node4"), vote.Endorsement.Signature)
+	require.Equal(t, prevote, apply("node4", "node1", prevote)[0].Payload)
+	relayed := newTBFTVote(t, tbftpb.TBFTMsgType_MSG_PREVOTE, "node1", 1, 0)
+	require.Equal(t, relayed, apply("node4", "node3", relayed)[0].Payload)
+
+	proposal := newTBFTProposal(t, "node4", 1, 1)
+	deliveries = apply("node4", "node3", proposal)
+	require.NoError(t, proto.Unmarshal(deliveries[0].Payload, msg))
+	forged := new(tbftpb.Proposal)
+	require.NoError(t, proto.Unmarshal(msg.Msg, forged))
+	require.NotEqual(t, []byte("block"), forged.Block.Header.BlockHash)
+	require.Equal(t, []byte("sig-node4"), forged.Block.Header.Signature)
+
+	// partition
+	require.Empty(t, apply("node1", "node3", newTBFTVote(t, tbftpb.TBFTMsgType_MSG_PREVOTE, "node1", 10, 0)))
+	require.Empty(t, apply("node3", "node2", newTBFTVote(t, tbftpb.TBFTMsgType_MSG_PREVOTE, "node3", 11, 0)))
+	require.Len(t, apply("node1", "node2", newTBFTVote(t, tbftpb.TBFTMsgType_MSG_PREVOTE, "node1", 10, 0)), 1)
+	require.Len(t, apply("node3", "node4", newTBFTVote(t, tbftpb.TBFTMsgType_MSG_PREVOTE, "node3", 10, 0)), 1)
+
+	require.Equal(t, 1, inj.Count(0))
+	require.Equal(t, 3, inj.Count(2))
+	require.Equal(t, 2, inj.Count(3))
+	require.Equal(t, 2, inj.Count(4))
+	require.Len(t, inj.Events(), 9)
+}
+
+func TestInjector_Deterministic(t *testing.T) {
+	scenario := &Scenario{Seed: 42, Rules: []*Rule{{Action: ActionDrop, Probability: 0.5}}}
+	run := func(seed int64) []bool {
+		scenario.Seed = seed
+		inj, err := NewInjector(scenario, NewTBFTCodec(crypto.CRYPTO_ALGO_SHA256))
+		require.NoError(t, err)
+		var dropped []bool
+		for height := uint64(1); height <= 100; height++ {
+			payload := newTBFTVote(t, tbftpb.TBFTMsgType_MSG_PREVOTE, "node1", height, 0)
+			// the same message sent again may be decided differently
+			for i := 0; i < 2; i++ {
+				dropped = append(dropped, len(inj.Apply(&Message{From: "node1", To: "node2", Payload: payload},
+					nil)) == 0)
+			}
+		}
+		return dropped
+	}
+
+	first := run(42)
+	require.Equal(t, first, run(42))
+	require.NotEqual(t, first, run(43))
+	count := 0
+	for _, d := range first {
+		if d {
+			count++
+		}
+	}
+	require.True(t, count > 50 && count < 150, count)
+}
+
+type recvCollector struct {
+	msgbus.DefaultSubscriber
+	msgs chan *netpb.NetMsg
+}
+
+func (c *recvCollector) OnMessage(msg *msgbus.Message) {
+	c.msgs <- msg.Payload.(*netpb.NetMsg)
+}
+
+func TestNetwork(t *testing.T) {
+	scenario := &Scenario{Rules: []*Rule{
+		{Action: ActionDrop, To: []string{"node3"}},
+		{Action: ActionDelay, Types: []string{"PROPOSE"}, Delay: 100 * time.Millisecond},
+	}}
+	inj, err := NewInjector(scenario, NewTBFTCodec(crypto.CRYPTO_ALGO_SHA256))
+	require.NoError(t, err)
+	clock := NewFakeClock(time.Unix(0, 0))
+	network := NewNetwork(inj, clock)
+	defer network.Stop()
+
+	collectors := make(map[string]*recvCollector)
+	buses := make(map[string]msgbus.MessageBus)
+	for _, id := range []string{"node1", "node2", "node3"} {
+		buses[id] = msgbus.NewMessageBus()
+		collectors[id] = &recvCollector{msgs: make(chan *netpb.NetMsg, 8)}
+		buses[id].Register(msgbus.RecvConsensusMsg, collectors[id])
+		network.AddNode(id, buses[id], nil)
+	}
+
+	send := func(to string, payload []byte) {
+		buses["node1"].Publish(msgbus.SendConsensusMsg,
+			&netpb.NetMsg{Payload: payload, Type: netpb.NetMsg_CONSENSUS_MSG, To: to})
+	}
+	prevote := newTBFTVote(t, tbftpb.TBFTMsgType_MSG_PREVOTE, "node1", 1, 0)
+	proposal := newTBFTProposal(t, "node1", 1, 0)
+	send("node3", prevote)
+	send("node2", proposal)
+	send("node2", prevote)
+
+	recv := func(id string) *netpb.NetMsg {
+		select {
+		case msg := <-collectors[id].msgs:
+			return msg
+		case <-time.After(100 * time.Millisecond):
+			return nil
+		}
+	}
+	require.Equal(t, prevote, recv("node2").Payload)
+	// the proposal is delivered by the clock
+	require.Nil(t, recv("node2"))
+	clock.Advance(99 * time.Millisecond)
+	require.Nil(t, recv("node2"))
+	clock.Advance(time.Millisecond)
+	require.Equal(t, proposal, recv("node2").Payload)
+	require.Nil(t, recv("node3"))
+	require.EqualValues(t, 3, network.Sent())
+
+	// the delayed messages are dropped after the network is stopped
+	send("node2", proposal)
+	network.Stop()
+	clock.Advance(time.Second)
+	require.Nil(t, recv("node2"))
+}
+
+func TestFakeClock(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	var called []string
+	clock.AfterFunc(2*time.Second, func() { called = append(called, "b") })
+	stop := clock.AfterFunc(time.Second, func() { called = append(called, "stopped") })
+	clock.AfterFunc(time.Second, func() {
+		called = append(called, "a")
+		// scheduled by a func, and due in the same advance
+		clock.AfterFunc(500*time.Millisecond, func() { called = append(called, "c") })
+	})
+	clock.AfterFunc(2*time.Second, func() { called = append(called, "d") })
+	require.True(t, stop())
+	require.False(t, stop())
+
+	d, ok := clock.Next()
+	require.True(t, ok)
+	require.Equal(t, time.Second, d)
+	clock.Advance(1500 * time.Millisecond)
+	require.Equal(t, []string{"a", "c"}, called)
+	require.Equal(t, time.Unix(0, 0).Add(1500*time.Millisecond), clock.Now())
+	d, _ = clock.Next()
+	require.Equal(t, 500*time.Millisecond, d)
+	clock.Advance(d)
+	require.Equal(t, []string{"a", "c", "b", "d"}, called)
+	_, ok = clock.Next()
+	require.False(t, ok)
+}
@@ -0,0 +1,182 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package faultinject
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+
+	"chainmaker.org/chainmaker/protocol/v2"
+)
+
+// Message is a consensus message sent from a node to another
+type Message struct {
+	From    string
+	To      string
+	Payload []byte
+}
+
+// Delivery is a message to be delivered to the receiver after the delay
+type Delivery struct {
+	Payload []byte
+	Delay   time.Duration
+}
+
+// Event records a fault injected by a rule
+type Event struct {
+	Rule   int
+	Action Action
+	From   string
+	To     string
+	Info   MsgInfo
+}
+
+func (e Event) String() string {
+	return fmt.Sprintf("rule %d %s %s(%d/%d) from %s to %s", e.Rule, e.Action, e.Info.Type, e.Info.Height,
+		e.Info.Round, e.From, e.To)
+}
+
+// Injector applies the rules of a scenario to the messages. The decision on a message depends on the
+// scenario, the message and how many times the same message was sent before, not on the time or the order
+// of the messages on different links, so a scenario injects the same faults in each run of a test.
+type Injector struct {
+	sync.Mutex
+	scenario *Scenario
+	codec    MsgCodec
+
+	sent   map[string]uint64 // the times each message was sent on each link
+	events []Event
+}
+
+// NewInjector returns the injector of the scenario for the consensus decoded by codec
+func NewInjector(scenario *Scenario, codec MsgCodec) (*Injector, error) {
+	if err := scenario.Validate(); err != nil {
+		return nil, err
+	}
+	types := make(map[string]bool)
+	for _, t := range codec.Types() {
+		types[t] = true
+	}
+	for i, rule := range scenario.Rules {
+		for _, t := range rule.Types {
+			if !types[t] {
+				return nil, fmt.Errorf("rule %d: unknown message type %s", i, t)
+			}
+		}
+	}
+	return &Injector{
+		scenario: scenario,
+		codec:    codec,
+		sent:     make(map[string]uint64),
+	}, nil
+}
+
+// Apply returns the deliveries of the message, it is empty if the message is dropped. The signer of the
+// sender is required by the equivocation, the message is delivered unchanged if it can't be forged.
+func (inj *Injector) Apply(msg *Message, signer protocol.SigningMember) []*Delivery {
+	info, err := inj.codec.Decode(msg.Payload)
+	if err != nil {
+		// the message unknown to the codec is not matched by any rule
+		return []*Delivery{{Payload: msg.Payload}}
+	}
+
+	inj.Lock()
+	defer inj.Unlock()
+	key := fmt.Sprintf("%s/%s/%x", msg.From, msg.To, sha256.Sum256(msg.Payload))
+	seq := inj.sent[key]
+	inj.sent[key]++
+
+	deliveries := []*Delivery{{Payload: msg.Payload}}
+	for i, rule := range inj.scenario.Rules {
+		if !inj.match(i, rule, msg, info, key, seq) {
+			continue
+		}
+		inj.events = append(inj.events, Event{Rule: i, Action: rule.Action, From: msg.From, To: msg.To, Info: *info})
+		switch rule.Action {
+		case ActionDrop, ActionPartition:
+			return nil
+		case ActionDelay:
+			for _, d := range deliveries {
+				d.Delay += rule.Delay
+			}
+		case ActionDuplicate:
+			for n := 0; n < rule.Copies; n++ {
+				deliveries = append(deliveries, &Delivery{Payload: msg.Payload, Delay: deliveries[0].Delay})
+			}
+		case ActionEquivocate:
+			if signer == nil {
+				continue
+			}
+			forged, err := inj.codec.Equivocate(msg.Payload, signer)
+			if err != nil {
+				continue
+			}
+			for _, d := range deliveries {
+				d.Payload = forged
+			}
+		}
+	}
+	return deliveries
+}
+
+func (inj *Injector) match(index int, rule *Rule, msg *Message, info *MsgInfo, key string, seq uint64) bool {
+	if !contains(rule.From, msg.From) || !contains(rule.To, msg.To) || !contains(rule.Types, info.Type) ||
+		!rule.heights.contains(info.Height) || !rule.rounds.contains(info.Round) {
+		return false
+	}
+	switch rule.Action {
+	case ActionPartition:
+		if rule.group(msg.From) == rule.group(msg.To) {
+			return false
+		}
+	case ActionEquivocate:
+		// the node can only forge the messages signed by itself
+		if info.Author != msg.From {
+			return false
+		}
+	}
+	if rule.Probability > 0 && rule.Probability < 1 && inj.draw(index, key, seq) >= rule.Probability {
+		return false
+	}
+	// the times are counted on the same message, the other messages on the link don't change the decision
+	return rule.Times == 0 || seq < uint64(rule.Times)
+}
+
+// draw returns a number in [0, 1) decided by the seed, the rule and the message
+func (inj *Injector) draw(index int, key string, seq uint64) float64 {
+	buf := make([]byte, 24, 24+len(key))
+	binary.BigEndian.PutUint64(buf, uint64(inj.scenario.Seed))
+	binary.BigEndian.PutUint64(buf[8:], uint64(index))
+	binary.BigEndian.PutUint64(buf[16:], seq)
+	h := sha256.Sum256(append(buf, key...))
+	return float64(binary.BigEndian.Uint64(h[:8])>>11) / (1 << 53)
+}
+
+// Events returns the faults injected so far
+func (inj *Injector) Events() []Event {
+	inj.Lock()
+	defer inj.Unlock()
+	events := make([]Event, len(inj.events))
+	copy(events, inj.events)
+	return events
+}
+
+// Count returns the number of faults injected by the rule of index
+func (inj *Injector) Count(index int) int {
+	inj.Lock()
+	defer inj.Unlock()
+	count := 0
+	for _, e := range inj.events {
+		if e.Rule == index {
+			count++
+		}
+	}
+	return count
+}
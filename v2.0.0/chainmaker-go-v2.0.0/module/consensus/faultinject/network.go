@@ -0,0 +1,144 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package faultinject
+
+import (
+	"sync"
+	"time"
+
+	"chainmaker.org/chainmaker-go/logger"
+	"chainmaker.org/chainmaker/common/v2/msgbus"
+	netpb "chainmaker.org/chainmaker/pb-go/v2/net"
+	"chainmaker.org/chainmaker/protocol/v2"
+)
+
+// Network is an in-memory network between the message buses of the consensus nodes in a test, it takes the
+// place of the net service. The consensus messages published by a node to msgbus.SendConsensusMsg are passed
+// through the injector, and published to msgbus.RecvConsensusMsg of the receiver.
+type Network struct {
+	mu       sync.RWMutex
+	injector *Injector
+	clock    Clock
+	nodes    map[string]*netNode
+	pending  map[*pendingMsg]struct{}
+	sent     uint64
+	stopped  bool
+
+	log *logger.CMLogger
+}
+
+type netNode struct {
+	msgbus.DefaultSubscriber
+	id     string
+	bus    msgbus.MessageBus
+	signer protocol.SigningMember
+	net    *Network
+}
+
+// pendingMsg is a delayed message which is not delivered yet
+type pendingMsg struct {
+	stop func() bool
+}
+
+// NewNetwork returns the network injecting the faults by injector, the messages are delivered unchanged if
+// injector is nil. The delayed messages are delivered by clock, which is the real clock if it is nil.
+func NewNetwork(injector *Injector, clock Clock) *Network {
+	if clock == nil {
+		clock = RealClock()
+	}
+	return &Network{
+		injector: injector,
+		clock:    clock,
+		nodes:    make(map[string]*netNode),
+		pending:  make(map[*pendingMsg]struct{}),
+		log:      logger.GetLogger(logger.MODULE_NET),
+	}
+}
+
+// AddNode connects the message bus of the node to the network, the signer of the node is used to forge
+// the messages of the node in the equivocation
+func (n *Network) AddNode(id string, bus msgbus.MessageBus, signer protocol.SigningMember) {
+	node := &netNode{id: id, bus: bus, signer: signer, net: n}
+	n.mu.Lock()
+	n.nodes[id] = node
+	n.mu.Unlock()
+	bus.Register(msgbus.SendConsensusMsg, node)
+}
+
+// Stop drops the delayed messages which are not delivered and the messages sent later
+func (n *Network) Stop() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.stopped = true
+	for msg := range n.pending {
+		msg.stop()
+	}
+	n.pending = make(map[*pendingMsg]struct{})
+}
+
+// Sent returns the number of messages sent on the network so far
+func (n *Network) Sent() uint64 {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.sent
+}
+
+func (node *netNode) OnMessage(msg *msgbus.Message) {
+	if msg.Topic != msgbus.SendConsensusMsg {
+		return
+	}
+	if netMsg, ok := msg.Payload.(*netpb.NetMsg); ok {
+		node.net.send(node, netMsg)
+	}
+}
+
+func (n *Network) send(from *netNode, msg *netpb.NetMsg) {
+	n.mu.Lock()
+	to, exist := n.nodes[msg.To]
+	stopped := n.stopped
+	n.sent++
+	n.mu.Unlock()
+	if !exist || stopped {
+		return
+	}
+	if n.injector == nil {
+		to.bus.Publish(msgbus.RecvConsensusMsg, msg)
+		return
+	}
+	deliveries := n.injector.Apply(&Message{From: from.id, To: to.id, Payload: msg.Payload}, from.signer)
+	if len(deliveries) == 0 {
+		n.log.Debugf("drop consensus message from %s to %s", from.id, to.id)
+	}
+	for _, d := range deliveries {
+		delivered := &netpb.NetMsg{Payload: d.Payload, Type: msg.Type, To: msg.To}
+		if d.Delay <= 0 {
+			to.bus.Publish(msgbus.RecvConsensusMsg, delivered)
+			continue
+		}
+		n.deliverLater(to, delivered, d.Delay)
+	}
+}
+
+func (n *Network) deliverLater(to *netNode, msg *netpb.NetMsg, delay time.Duration) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.stopped {
+		return
+	}
+	pending := &pendingMsg{}
+	// the func waits for the lock if it is called at once, until the message is added to the pending ones
+	pending.stop = n.clock.AfterFunc(delay, func() {
+		n.mu.Lock()
+		_, exist := n.pending[pending]
+		delete(n.pending, pending)
+		n.mu.Unlock()
+		if exist {
+			to.bus.Publish(msgbus.RecvConsensusMsg, msg)
+		}
+	})
+	n.pending[pending] = struct{}{}
+}
@@ -0,0 +1,201 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package faultinject
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Action is the fault injected into the matched consensus messages
+type Action string
+
+const (
+	// ActionDrop drops the message
+	ActionDrop Action = "drop"
+	// ActionDelay delivers the message after Rule.Delay
+	ActionDelay Action = "delay"
+	// ActionDuplicate delivers Rule.Copies extra copies of the message
+	ActionDuplicate Action = "duplicate"
+	// ActionEquivocate replaces the message of the sender with a conflicting one signed by the sender,
+	// e.g. a proposal of another block or a vote for another hash
+	ActionEquivocate Action = "equivocate"
+	// ActionPartition drops the message between the nodes in different Rule.Groups
+	ActionPartition Action = "partition"
+)
+
+// Scenario is a scripted list of faults injected into the messages between the consensus nodes.
+// The rules are applied in order to each message, a message dropped by a rule is not passed to the later rules.
+type Scenario struct {
+	Name string `mapstructure:"name"`
+	// Seed decides the messages matched by the rules with a probability
+	Seed  int64   `mapstructure:"seed"`
+	Rules []*Rule `mapstructure:"rules"`
+}
+
+// Rule injects a fault into the messages it matches, the empty conditions match all messages
+type Rule struct {
+	Action Action `mapstructure:"action"`
+	// From and To are the ids of the senders and the receivers
+	From []string `mapstructure:"from"`
+	To   []string `mapstructure:"to"`
+	// Types are the message types named by the codec of the consensus, e.g. PREVOTE of tbft
+	Types []string `mapstructure:"types"`
+	// Heights and Rounds are the inclusive ranges like "3", "3-5" or "3-", the round of raft is the term
+	Heights string `mapstructure:"heights"`
+	Rounds  string `mapstructure:"rounds"`
+	// Probability is the chance to match a message, 0 means always
+	Probability float64 `mapstructure:"probability"`
+	// Times limits the rule to the first sends of the same message on each link from a sender to a receiver,
+	// the later resends of the message are not matched, 0 means unlimited
+	Times int `mapstructure:"times"`
+
+	Delay  time.Duration `mapstructure:"delay"`
+	Copies int           `mapstructure:"copies"`
+	// Groups are the node sets of the partition, the nodes not in any group form another group
+	Groups [][]string `mapstructure:"groups"`
+
+	heights span
+	rounds  span
+}
+
+// span is an inclusive range, the unbounded span has no upper bound
+type span struct {
+	min, max  uint64
+	unbounded bool
+}
+
+func (s span) contains(v uint64) bool {
+	return v >= s.min && (s.unbounded || v <= s.max)
+}
+
+func parseSpan(s string) (span, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return span{unbounded: true}, nil
+	}
+	parts := strings.SplitN(s, "-", 2)
+	min, err := strconv.ParseUint(strings.TrimSpace(parts[0]), 10, 64)
+	if err != nil {
+		return span{}, fmt.Errorf("invalid range %q: %v", s, err)
+	}
+	if len(parts) == 1 {
+		return span{min: min, max: min}, nil
+	}
+	if strings.TrimSpace(parts[1]) == "" {
+		return span{min: min, unbounded: true}, nil
+	}
+	max, err := strconv.ParseUint(strings.TrimSpace(parts[1]), 10, 64)
+	if err != nil {
+		return span{}, fmt.Errorf("invalid range %q: %v", s, err)
+	}
+	if max < min {
+		return span{}, fmt.Errorf("invalid range %q", s)
+	}
+	return span{min: min, max: max}, nil
+}
+
+// LoadScenario loads the scenario from the yaml file
+func LoadScenario(file string) (*Scenario, error) {
+	v := viper.New()
+	v.SetConfigFile(file)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, err
+	}
+	scenario := &Scenario{}
+	if err := v.Unmarshal(scenario); err != nil {
+		return nil, err
+	}
+	if err := scenario.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid scenario %s: %v", file, err)
+	}
+	return scenario, nil
+}
+
+// Validate checks the rules and parses their ranges, it is called by LoadScenario and NewInjector
+func (s *Scenario) Validate() error {
+	for i, rule := range s.Rules {
+		if err := rule.validate(); err != nil {
+			return fmt.Errorf("rule %d: %v", i, err)
+		}
+	}
+	return nil
+}
+
+func (r *Rule) validate() error {
+	var err error
+	if r.heights, err = parseSpan(r.Heights); err != nil {
+		return err
+	}
+	if r.rounds, err = parseSpan(r.Rounds); err != nil {
+		return err
+	}
+	if r.Probability < 0 || r.Probability > 1 {
+		return fmt.Errorf("probability %v out of [0, 1]", r.Probability)
+	}
+	if r.Times < 0 {
+		return fmt.Errorf("negative times %d", r.Times)
+	}
+	switch r.Action {
+	case ActionDrop, ActionEquivocate:
+	case ActionDelay:
+		if r.Delay <= 0 {
+			return fmt.Errorf("delay must be positive")
+		}
+	case ActionDuplicate:
+		if r.Copies < 0 {
+			return fmt.Errorf("negative copies %d", r.Copies)
+		}
+		if r.Copies == 0 {
+			r.Copies = 1
+		}
+	case ActionPartition:
+		if len(r.Groups) == 0 {
+			return fmt.Errorf("partition without groups")
+		}
+		seen := make(map[string]bool)
+		for _, group := range r.Groups {
+			for _, id := range group {
+				if seen[id] {
+					return fmt.Errorf("node %s in more than one group", id)
+				}
+				seen[id] = true
+			}
+		}
+	default:
+		return fmt.Errorf("unknown action %q", r.Action)
+	}
+	return nil
+}
+
+// group returns the index of the group of the node, the nodes not in any group share the index len(r.Groups)
+func (r *Rule) group(id string) int {
+	for i, group := range r.Groups {
+		for _, member := range group {
+			if member == id {
+				return i
+			}
+		}
+	}
+	return len(r.Groups)
+}
+
+func contains(ids []string, id string) bool {
+	if len(ids) == 0 {
+		return true
+	}
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
@@ -653,7 +653,7 @@ func (consensus *ConsensusRaftImpl) processConfigChange() {
 // is qulified with the consensus algorithm. It should return nil
 // error when verify successfully, and return corresponding error
 // when failed.
-func VerifyBlockSignatures(block *common.Block) error {
+func VerifyBlockSignatures(chainConf protocol.ChainConf, ac protocol.AccessControlProvider, block *common.Block) error {
 	if block == nil || block.Header == nil ||
 		block.AdditionalData == nil || block.AdditionalData.ExtraData == nil {
 		return fmt.Errorf("invalid block")
@@ -664,15 +664,27 @@ func VerifyBlockSignatures(block *common.Block) error {
 	}
 
 	additionalData := &AdditionalData{}
-	json.Unmarshal(byt, additionalData)
+	if err := json.Unmarshal(byt, additionalData); err != nil {
+		return fmt.Errorf("unmarshal block.AdditionalData.ExtraData[RAFTAddtionalDataKey] failed: %v", err)
+	}
 
 	endorsement := new(common.EndorsementEntry)
-	mustUnmarshal(additionalData.Signature, endorsement)
+	if err := proto.Unmarshal(additionalData.Signature, endorsement); err != nil {
+		return fmt.Errorf("unmarshal endorsement failed: %v", err)
+	}
 
 	if !bytes.Equal(block.Header.Signature, endorsement.Signature) {
-		return fmt.Errorf("block.AdditionalData.ExtraData[RAFTAddtionalDataKey] not exist")
+		return fmt.Errorf("endorsement signature mismatch with block signature")
 	}
-	return nil
+	if !proto.Equal(block.Header.Proposer, endorsement.Signer) {
+		return fmt.Errorf("endorsement signer mismatch with block proposer")
+	}
+
+	chainConfig, err := chainConf.GetChainConfigFromFuture(block.Header.BlockHeight)
+	if err != nil {
+		return err
+	}
+	return utils.VerifyBlockProposerSig(chainConfig, block, ac)
 }
 
 func computeRaftIdFromNodeId(nodeId string) uint64 {
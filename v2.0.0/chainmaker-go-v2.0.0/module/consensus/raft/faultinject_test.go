@@ -0,0 +1,202 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package raft
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"chainmaker.org/chainmaker-go/consensus/faultinject"
+	"chainmaker.org/chainmaker-go/localconf"
+	"chainmaker.org/chainmaker/common/v2/crypto"
+	"chainmaker.org/chainmaker/common/v2/msgbus"
+	pbac "chainmaker.org/chainmaker/pb-go/v2/accesscontrol"
+	"chainmaker.org/chainmaker/pb-go/v2/common"
+	"chainmaker.org/chainmaker/pb-go/v2/config"
+	consensuspb "chainmaker.org/chainmaker/pb-go/v2/consensus"
+	"chainmaker.org/chainmaker/protocol/v2/mock"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+// clusterCore takes the place of the core engine of a node in the cluster, it proposes empty blocks when the
+// node is the leader, and records the blocks committed by raft
+type clusterCore struct {
+	sync.Mutex
+	msgbus.DefaultSubscriber
+
+	id         string
+	bus        msgbus.MessageBus
+	committed  []*common.Block
+	proposedAt time.Time // the time the block after the committed blocks is proposed
+}
+
+func (c *clusterCore) height() uint64 {
+	c.Lock()
+	defer c.Unlock()
+	return uint64(len(c.committed))
+}
+
+func (c *clusterCore) blocks() []*common.Block {
+	c.Lock()
+	defer c.Unlock()
+	return append([]*common.Block(nil), c.committed...)
+}
+
+func (c *clusterCore) OnMessage(msg *msgbus.Message) {
+	if msg.Topic != msgbus.ProposeState || !msg.Payload.(bool) {
+		return
+	}
+	c.Lock()
+	// the leader is notified on each ready of raft, the block is proposed again if it is not committed in time,
+	// e.g. it is lost in the change of the leader
+	if time.Since(c.proposedAt) < 3*time.Second {
+		c.Unlock()
+		return
+	}
+	c.proposedAt = time.Now()
+	header := &common.BlockHeader{
+		ChainId:        c.id,
+		BlockHeight:    uint64(len(c.committed)) + 1,
+		BlockTimestamp: int64(len(c.committed)) + 1,
+		Proposer:       &pbac.Member{MemberInfo: []byte(c.id)},
+	}
+	if len(c.committed) > 0 {
+		header.PreBlockHash = c.committed[len(c.committed)-1].Header.BlockHash
+	}
+	c.Unlock()
+	c.bus.Publish(msgbus.ProposedBlock, &consensuspb.ProposalBlock{
+		Block: &common.Block{Header: header, Dag: &common.DAG{}},
+	})
+}
+
+func (c *clusterCore) addBlock(block *common.Block) error {
+	c.Lock()
+	defer c.Unlock()
+	if block.Header.BlockHeight == uint64(len(c.committed))+1 {
+		c.committed = append(c.committed, block)
+		c.proposedAt = time.Time{}
+	}
+	return nil
+}
+
+func TestConsensusRaftImpl_FaultInjection(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping the raft cluster in short mode")
+	}
+	prevStorePath := localconf.ChainMakerConfig.StorageConfig.StorePath
+	defer func() {
+		localconf.ChainMakerConfig.StorageConfig.StorePath = prevStorePath
+	}()
+
+	ids := []string{"raftnode1", "raftnode2", "raftnode3"}
+	chainConfig := &config.ChainConfig{
+		Crypto:    &config.CryptoConfig{Hash: crypto.CRYPTO_ALGO_SHA256},
+		Consensus: &config.ConsensusConfig{Type: consensuspb.ConsensusType_RAFT},
+	}
+	for _, id := range ids {
+		chainConfig.Consensus.Nodes = append(chainConfig.Consensus.Nodes,
+			&config.OrgConfig{OrgId: "org-" + id, NodeId: []string{id}})
+	}
+
+	tests := []struct {
+		scenario string
+		// the nodes expected to keep committing
+		live []string
+	}{
+		{"partition", ids[:2]},
+		{"delay_duplicate", ids},
+	}
+	for _, tt := range tests {
+		t.Run(tt.scenario, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			scenario, err := faultinject.LoadScenario(filepath.Join("testdata", "faultinject", tt.scenario+".yml"))
+			require.NoError(t, err)
+			injector, err := faultinject.NewInjector(scenario, faultinject.NewRaftCodec())
+			require.NoError(t, err)
+			// raft ticks on its own ticker, so the cluster runs on the real clock
+			network := faultinject.NewNetwork(injector, nil)
+			defer network.Stop()
+
+			storePath := t.TempDir()
+			cores := make(map[string]*clusterCore)
+			for _, id := range ids {
+				bus := msgbus.NewMessageBus()
+				core := &clusterCore{id: id, bus: bus}
+				bus.Register(msgbus.ProposeState, core)
+				cores[id] = core
+				network.AddNode(id, bus, nil)
+
+				chainConf := mock.NewMockChainConf(ctrl)
+				chainConf.EXPECT().ChainConfig().Return(chainConfig).AnyTimes()
+				signer := mock.NewMockSigningMember(ctrl)
+				signer.EXPECT().Sign(gomock.Any(), gomock.Any()).Return([]byte("sig-"+id), nil).AnyTimes()
+				signer.EXPECT().GetMember().Return(&pbac.Member{MemberInfo: []byte(id)}, nil).AnyTimes()
+				ledgerCache := mock.NewMockLedgerCache(ctrl)
+				ledgerCache.EXPECT().CurrentHeight().DoAndReturn(func() (uint64, error) {
+					return core.height(), nil
+				}).AnyTimes()
+				verifier := mock.NewMockBlockVerifier(ctrl)
+				verifier.EXPECT().VerifyBlock(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+				committer := mock.NewMockBlockCommitter(ctrl)
+				committer.EXPECT().AddBlock(gomock.Any()).DoAndReturn(core.addBlock).AnyTimes()
+
+				// the verifier of the chain config is registered by chain id once in a process, so each
+				// node runs on its own chain id, and opens the wal under its own store path
+				chainID := strings.ReplaceAll(t.Name(), "/", "_") + "_" + id
+				localconf.ChainMakerConfig.StorageConfig.StorePath = filepath.Join(storePath, id)
+				require.NoError(t, os.MkdirAll(filepath.Join(storePath, id, chainID), 0750))
+				engine, err := New(ConsensusRaftImplConfig{
+					ChainID:        chainID,
+					NodeId:         id,
+					Singer:         signer,
+					LedgerCache:    ledgerCache,
+					BlockVerifier:  verifier,
+					BlockCommitter: committer,
+					ChainConf:      chainConf,
+					MsgBus:         bus,
+				})
+				require.NoError(t, err)
+				require.NoError(t, engine.Start())
+				defer func() {
+					_ = engine.Stop()
+					engine.node.Stop()
+				}()
+			}
+
+			// the first election takes 10 to 20 ticks of a second
+			deadline := time.Now().Add(90 * time.Second)
+			for _, id := range tt.live {
+				for cores[id].height() < 5 {
+					if time.Now().After(deadline) {
+						t.Fatalf("node %s committed %d blocks, expect 5", id, cores[id].height())
+					}
+					time.Sleep(100 * time.Millisecond)
+				}
+			}
+			expect := cores[tt.live[0]].blocks()
+			for _, id := range ids {
+				for i, block := range cores[id].blocks() {
+					if i < 5 && !bytes.Equal(expect[i].Header.BlockHash, block.Header.BlockHash) {
+						t.Errorf("node %s committed block[%d] %x, node %s committed %x", id, i+1,
+							block.Header.BlockHash, tt.live[0], expect[i].Header.BlockHash)
+					}
+				}
+			}
+			for i := range scenario.Rules {
+				require.NotZero(t, injector.Count(i), "rule %d of %s is not applied", i, tt.scenario)
+			}
+		})
+	}
+}
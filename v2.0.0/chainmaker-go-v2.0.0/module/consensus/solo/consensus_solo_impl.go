@@ -30,6 +30,7 @@ type ConsensusSoloImpl struct {
 	chainID string
 	id      string
 	singer  protocol.SigningMember
+	ac      protocol.AccessControlProvider
 	msgbus  msgbus.MessageBus
 
 	verifyingBlock *common.Block
@@ -39,7 +40,7 @@ type ConsensusSoloImpl struct {
 }
 
 //New ...
-func New(chainID string, uid string, singer protocol.SigningMember,
+func New(chainID string, uid string, singer protocol.SigningMember, ac protocol.AccessControlProvider,
 	msgBus msgbus.MessageBus, chainConf protocol.ChainConf) (*ConsensusSoloImpl, error) {
 	clog = logger.GetLoggerByChain(logger.MODULE_CONSENSUS, chainID)
 
@@ -49,6 +50,7 @@ func New(chainID string, uid string, singer protocol.SigningMember,
 	consensus.chainID = chainID
 	consensus.id = uid
 	consensus.singer = singer
+	consensus.ac = ac
 	consensus.msgbus = msgBus
 	consensus.chainConf = chainConf
 
@@ -194,7 +196,22 @@ func (consensus *ConsensusSoloImpl) CanProposeBlock() bool {
 	return true
 }
 
-// TODO
+// VerifyBlockSignatures verifies the signature of the proposer of block, see VerifyBlockSignatures
 func (consensus *ConsensusSoloImpl) VerifyBlockSignatures(block *common.Block) error {
-	return nil
+	return VerifyBlockSignatures(consensus.chainConf, consensus.ac, block)
+}
+
+// VerifyBlockSignatures verifies whether the signatures in block
+// is qulified with the consensus algorithm. It should return nil
+// error when verify successfully, and return corresponding error
+// when failed.
+func VerifyBlockSignatures(chainConf protocol.ChainConf, ac protocol.AccessControlProvider, block *common.Block) error {
+	if block == nil || block.Header == nil {
+		return fmt.Errorf("invalid block")
+	}
+	chainConfig, err := chainConf.GetChainConfigFromFuture(block.Header.BlockHeight)
+	if err != nil {
+		return err
+	}
+	return utils.VerifyBlockProposerSig(chainConfig, block, ac)
 }
@@ -80,6 +80,7 @@ type ConsensusTBFTImpl struct {
 	singer           protocol.SigningMember
 	ac               protocol.AccessControlProvider
 	dbHandle         protocol.DBHandle
+	store            protocol.BlockchainStore
 	ledgerCache      protocol.LedgerCache
 	chainConf        protocol.ChainConf
 	netService       protocol.NetService
@@ -97,6 +98,7 @@ type ConsensusTBFTImpl struct {
 	gossip        *gossipService
 	timeScheduler *timeScheduler
 	verifingBlock *common.Block // verifing block
+	evidencePool  *evidencePool
 
 	proposedBlockC chan *consensuspb.ProposalBlock
 	verifyResultC  chan *consensuspb.VerifyResult
@@ -119,6 +121,7 @@ type ConsensusTBFTImplConfig struct {
 	Signer      protocol.SigningMember
 	Ac          protocol.AccessControlProvider
 	DbHandle    protocol.DBHandle
+	Store       protocol.BlockchainStore
 	LedgerCache protocol.LedgerCache
 	ChainConf   protocol.ChainConf
 	NetService  protocol.NetService
@@ -136,6 +139,7 @@ func New(config ConsensusTBFTImplConfig) (*ConsensusTBFTImpl, error) {
 	consensus.singer = config.Signer
 	consensus.ac = config.Ac
 	consensus.dbHandle = config.DbHandle
+	consensus.store = config.Store
 	consensus.ledgerCache = config.LedgerCache
 	consensus.chainConf = config.ChainConf
 	consensus.netService = config.NetService
@@ -165,6 +169,7 @@ func New(config ConsensusTBFTImplConfig) (*ConsensusTBFTImpl, error) {
 	consensus.consensusStateCache = newConsensusStateCache(defaultConsensusStateCacheSize)
 	consensus.timeScheduler = NewTimeSheduler(consensus.logger, config.Id)
 	consensus.gossip = newGossipService(consensus.logger, consensus)
+	consensus.evidencePool = newEvidencePool()
 
 	return consensus, nil
 }
@@ -185,6 +190,9 @@ func (consensus *ConsensusTBFTImpl) Start() error {
 	if err != nil {
 		return err
 	}
+	if err = consensus.loadCommittedEvidences(); err != nil {
+		return err
+	}
 
 	consensus.timeScheduler.Start()
 	consensus.gossip.start()
@@ -247,6 +255,12 @@ func (consensus *ConsensusTBFTImpl) OnMessage(message *msgbus.Message) {
 				consensus.logger.Errorf("receive message failed, error message BlockInfo = nil")
 				return
 			}
+			// the evidences committed in the block will not be proposed again
+			_, evidences, _, err := splitBlockEvidences(blockInfo.Block)
+			if err != nil {
+				consensus.logger.Warnf("get evidences from block failed, reason: %s", err)
+			}
+			consensus.evidencePool.markCommitted(blockInfo.Block.Header.BlockHeight, evidences)
 			consensus.blockHeightC <- blockInfo.Block.Header.BlockHeight
 		} else {
 			panic(fmt.Errorf("error message type"))
@@ -432,6 +446,13 @@ func (consensus *ConsensusTBFTImpl) handleProposedBlock(proposedBlock *consensus
 		return
 	}
 
+	// add the pending evidences in block
+	if err = consensus.addEvidencesToBlock(block); err != nil {
+		consensus.logger.Errorf("[%s](%d/%d/%s) add evidences to block failed, reason: %s",
+			consensus.Id, consensus.Height, consensus.Round, consensus.Step, err)
+		return
+	}
+
 	// Add hash and signature to block
 	hash, sig, err := utils.SignBlock(consensus.chainConf.ChainConfig().Crypto.Hash, consensus.singer, block)
 	if err != nil {
@@ -489,7 +510,12 @@ func (consensus *ConsensusTBFTImpl) handleVerifyResult(verifyResult *consensuspb
 		return
 	}
 
-	if err := consensus.dpos.VerifyConsensusArgs(verifyResult.VerifiedBlock, verifyResult.TxsRwSet); err != nil {
+	block, err := consensus.verifyBlockEvidences(verifyResult.VerifiedBlock)
+	if err != nil {
+		consensus.logger.Warnf("verify block evidences failed, reason: %s", err)
+		return
+	}
+	if err := consensus.dpos.VerifyConsensusArgs(block, verifyResult.TxsRwSet); err != nil {
 		consensus.logger.Warnf("verify block DPoS consensus failed, reason: %s", err)
 		return
 	}
@@ -623,6 +649,7 @@ func (consensus *ConsensusTBFTImpl) procPrevote(msg *tbftpb.TBFTMsg) {
 			)
 			return
 		}
+		consensus.detectDuplicateVote(prevote)
 	}
 
 	if consensus.Height != prevote.Height ||
@@ -664,6 +691,7 @@ func (consensus *ConsensusTBFTImpl) procPrecommit(msg *tbftpb.TBFTMsg) {
 			)
 			return
 		}
+		consensus.detectDuplicateVote(precommit)
 	}
 
 	if consensus.Height != precommit.Height ||
@@ -701,6 +729,8 @@ func (consensus *ConsensusTBFTImpl) handleConsensusMsg(msg *tbftpb.TBFTMsg) {
 	case tbftpb.TBFTMsgType_MSG_STATE:
 		// Async is ok
 		go consensus.gossip.onRecvState(msg)
+	case msgEvidence:
+		consensus.procEvidence(msg)
 	}
 }
 
@@ -0,0 +1,570 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package tbft
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"chainmaker.org/chainmaker-go/vm/native/dposmgr"
+	"chainmaker.org/chainmaker-go/vm/native/government"
+	"chainmaker.org/chainmaker/pb-go/v2/common"
+	consensuspb "chainmaker.org/chainmaker/pb-go/v2/consensus"
+	tbftpb "chainmaker.org/chainmaker/pb-go/v2/consensus/tbft"
+	"chainmaker.org/chainmaker/pb-go/v2/syscontract"
+	"chainmaker.org/chainmaker/protocol/v2"
+	"github.com/gogo/protobuf/proto"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// msgEvidence gossips a DuplicateVoteEvidence in json, it extends tbftpb.TBFTMsgType
+const msgEvidence tbftpb.TBFTMsgType = 100
+
+const (
+	// evidenceTxID is the TxId of the consensus args which only carry the evidences
+	evidenceTxID = "tbft_evidence"
+	// maxEvidencesPerBlock is the max number of the evidences included in a block
+	maxEvidencesPerBlock = 10
+	// evidenceMaxAge is the max number of heights an evidence can be included in a block after its votes
+	evidenceMaxAge = uint64(10000)
+)
+
+var (
+	ErrInvalidEvidence = errors.New("invalid evidence")
+)
+
+// slashEvidenceWriter is implemented by the DPoS module, which slashes the validators by the
+// double sign and missed proposal evidences recorded in the stake contract
+type slashEvidenceWriter interface {
+	NewDoubleSignEvidenceTxWrite(blockHeight uint64, nodeID string, evidenceHeight uint64,
+		round int64, data []byte) (*common.TxWrite, error)
+	NewMissedProposalEvidenceTxWrite(blockHeight uint64, nodeID string, evidenceHeight uint64,
+		round int64) (*common.TxWrite, error)
+}
+
+// DuplicateVoteEvidence proves that a validator signed two votes for different hashes
+// at the same height, round and step
+type DuplicateVoteEvidence struct {
+	VoteA *tbftpb.Vote `json:"vote_a"`
+	VoteB *tbftpb.Vote `json:"vote_b"`
+}
+
+// NewDuplicateVoteEvidence creates the evidence of the conflicting votes, the votes are ordered by hash
+// so that the evidence is the same on all nodes
+func NewDuplicateVoteEvidence(a, b *tbftpb.Vote) *DuplicateVoteEvidence {
+	if bytes.Compare(a.Hash, b.Hash) > 0 {
+		a, b = b, a
+	}
+	return &DuplicateVoteEvidence{VoteA: a, VoteB: b}
+}
+
+// ValidateBasic checks the votes conflict with each other, the signatures are not verified
+func (ev *DuplicateVoteEvidence) ValidateBasic() error {
+	a, b := ev.VoteA, ev.VoteB
+	if a == nil || b == nil {
+		return fmt.Errorf("%w: nil vote", ErrInvalidEvidence)
+	}
+	if a.Endorsement == nil || b.Endorsement == nil {
+		return fmt.Errorf("%w: vote without endorsement", ErrInvalidEvidence)
+	}
+	if a.Type != b.Type || a.Voter != b.Voter || a.Height != b.Height || a.Round != b.Round {
+		return fmt.Errorf("%w: votes %s(%d/%d/%s) and %s(%d/%d/%s) are not for the same step", ErrInvalidEvidence,
+			a.Voter, a.Height, a.Round, a.Type, b.Voter, b.Height, b.Round, b.Type)
+	}
+	if bytes.Compare(a.Hash, b.Hash) >= 0 {
+		return fmt.Errorf("%w: hashes %x and %x are not in order", ErrInvalidEvidence, a.Hash, b.Hash)
+	}
+	return nil
+}
+
+// Key returns the key of the evidence in the governance contract
+func (ev *DuplicateVoteEvidence) Key() []byte {
+	return government.ToVoteEvidenceKey(ev.VoteA.Voter, ev.VoteA.Height, ev.VoteA.Round, ev.VoteA.Type.String())
+}
+
+func (ev *DuplicateVoteEvidence) String() string {
+	return fmt.Sprintf("DuplicateVoteEvidence{%s-%s(%d/%d)-%x/%x}", ev.VoteA.Type, ev.VoteA.Voter,
+		ev.VoteA.Height, ev.VoteA.Round, ev.VoteA.Hash, ev.VoteB.Hash)
+}
+
+// evidencePool keeps the evidences which are not committed in blocks
+type evidencePool struct {
+	sync.Mutex
+	pending   map[string]*DuplicateVoteEvidence
+	committed map[string]uint64 // key -> the height of the evidence
+}
+
+func newEvidencePool() *evidencePool {
+	return &evidencePool{
+		pending:   make(map[string]*DuplicateVoteEvidence),
+		committed: make(map[string]uint64),
+	}
+}
+
+// add returns false if the evidence is pending or committed
+func (pool *evidencePool) add(ev *DuplicateVoteEvidence) bool {
+	pool.Lock()
+	defer pool.Unlock()
+
+	key := string(ev.Key())
+	if _, ok := pool.pending[key]; ok {
+		return false
+	}
+	if _, ok := pool.committed[key]; ok {
+		return false
+	}
+	pool.pending[key] = ev
+	return true
+}
+
+// pendingEvidences returns at most limit evidences which can be included in the block at height,
+// the expired evidences are removed
+func (pool *evidencePool) pendingEvidences(height uint64, limit int) []*DuplicateVoteEvidence {
+	pool.Lock()
+	defer pool.Unlock()
+
+	keys := make([]string, 0, len(pool.pending))
+	for key, ev := range pool.pending {
+		if ev.VoteA.Height+evidenceMaxAge < height {
+			delete(pool.pending, key)
+			continue
+		}
+		if ev.VoteA.Height < height {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	if len(keys) > limit {
+		keys = keys[:limit]
+	}
+	evidences := make([]*DuplicateVoteEvidence, 0, len(keys))
+	for _, key := range keys {
+		evidences = append(evidences, pool.pending[key])
+	}
+	return evidences
+}
+
+// loadCommitted records the evidence committed in the state, it will not be added to the pool again
+func (pool *evidencePool) loadCommitted(ev *DuplicateVoteEvidence) {
+	pool.Lock()
+	defer pool.Unlock()
+
+	key := string(ev.Key())
+	delete(pool.pending, key)
+	pool.committed[key] = ev.VoteA.Height
+}
+
+// markCommitted moves the evidences included in the block at height out of the pending evidences
+func (pool *evidencePool) markCommitted(height uint64, evidences []*DuplicateVoteEvidence) {
+	pool.Lock()
+	defer pool.Unlock()
+
+	for _, ev := range evidences {
+		key := string(ev.Key())
+		delete(pool.pending, key)
+		pool.committed[key] = ev.VoteA.Height
+	}
+	for key, evHeight := range pool.committed {
+		if evHeight+evidenceMaxAge < height {
+			delete(pool.committed, key)
+		}
+	}
+}
+
+func (pool *evidencePool) size() int {
+	pool.Lock()
+	defer pool.Unlock()
+	return len(pool.pending)
+}
+
+func createEvidenceMsg(ev *DuplicateVoteEvidence) (*tbftpb.TBFTMsg, error) {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return nil, err
+	}
+	return &tbftpb.TBFTMsg{
+		Type: msgEvidence,
+		Msg:  data,
+	}, nil
+}
+
+// isEvidenceWrite returns whether the write of the consensus args records an evidence in the governance contract
+func isEvidenceWrite(write *common.TxWrite) bool {
+	return write.ContractName == syscontract.SystemContract_GOVERNANCE.String() &&
+		government.IsVoteEvidenceKey(write.Key)
+}
+
+// isSlashEvidenceWrite returns whether the write of the consensus args records an evidence in the stake contract
+func isSlashEvidenceWrite(write *common.TxWrite) bool {
+	return write.ContractName == syscontract.SystemContract_DPOS_STAKE.String() &&
+		dposmgr.IsSlashEvidenceKey(write.Key)
+}
+
+// getEvidencesFromWrites decodes the evidences recorded by the writes of the consensus args
+func getEvidencesFromWrites(writes []*common.TxWrite) ([]*DuplicateVoteEvidence, error) {
+	var evidences []*DuplicateVoteEvidence
+	for _, write := range writes {
+		if !isEvidenceWrite(write) {
+			continue
+		}
+		ev := new(DuplicateVoteEvidence)
+		if err := json.Unmarshal(write.Value, ev); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidEvidence, err)
+		}
+		if err := ev.ValidateBasic(); err != nil {
+			return nil, err
+		}
+		evidences = append(evidences, ev)
+	}
+	return evidences, nil
+}
+
+// detectDuplicateVote records the evidence if the voter has voted for another hash at the same step,
+// the vote has been verified
+func (consensus *ConsensusTBFTImpl) detectDuplicateVote(voteProto *tbftpb.Vote) {
+	if voteProto.Voter == consensus.Id || voteProto.Height != consensus.Height ||
+		(voteProto.Type != tbftpb.VoteType_VOTE_PREVOTE && voteProto.Type != tbftpb.VoteType_VOTE_PRECOMMIT) {
+		return
+	}
+	voteSet := consensus.heightRoundVoteSet.getVoteSet(voteProto.Round, voteProto.Type)
+	if voteSet == nil {
+		return
+	}
+	existing, ok := voteSet.Votes[voteProto.Voter]
+	if !ok || existing.Endorsement == nil || bytes.Equal(existing.Hash, voteProto.Hash) {
+		return
+	}
+	consensus.addEvidence(NewDuplicateVoteEvidence(existing.ToProto(), voteProto))
+}
+
+// addEvidence adds the verified evidence to the pool, and gossips it to the validators if it is new
+func (consensus *ConsensusTBFTImpl) addEvidence(ev *DuplicateVoteEvidence) {
+	committed, err := consensus.isEvidenceCommitted(ev)
+	if err != nil {
+		consensus.logger.Errorf("[%s](%d/%d/%s) read %s from state failed, %v",
+			consensus.Id, consensus.Height, consensus.Round, consensus.Step, ev, err)
+		return
+	}
+	if committed {
+		consensus.evidencePool.loadCommitted(ev)
+		return
+	}
+	if !consensus.evidencePool.add(ev) {
+		return
+	}
+	consensus.logger.Warnf("[%s](%d/%d/%s) receive %s, pending evidences: %d",
+		consensus.Id, consensus.Height, consensus.Round, consensus.Step, ev, consensus.evidencePool.size())
+	msg, err := createEvidenceMsg(ev)
+	if err != nil {
+		consensus.logger.Errorf("[%s](%d/%d/%s) create evidence message failed, %v",
+			consensus.Id, consensus.Height, consensus.Round, consensus.Step, err)
+		return
+	}
+	go consensus.gossip.broadcast(msg)
+}
+
+func (consensus *ConsensusTBFTImpl) procEvidence(msg *tbftpb.TBFTMsg) {
+	ev := new(DuplicateVoteEvidence)
+	if err := json.Unmarshal(msg.Msg, ev); err != nil {
+		consensus.logger.Errorf("[%s](%d/%d/%s) receive evidence unmarshal failed, %v",
+			consensus.Id, consensus.Height, consensus.Round, consensus.Step, err)
+		return
+	}
+	if err := consensus.verifyEvidence(ev, consensus.Height); err != nil {
+		consensus.logger.Errorf("[%s](%d/%d/%s) receive invalid evidence, %v",
+			consensus.Id, consensus.Height, consensus.Round, consensus.Step, err)
+		return
+	}
+	consensus.addEvidence(ev)
+}
+
+// isEvidenceCommitted returns whether the evidence has been recorded in the governance contract by a committed block
+func (consensus *ConsensusTBFTImpl) isEvidenceCommitted(ev *DuplicateVoteEvidence) (bool, error) {
+	value, err := consensus.store.ReadObject(syscontract.SystemContract_GOVERNANCE.String(), ev.Key())
+	if err != nil {
+		return false, err
+	}
+	return len(value) > 0, nil
+}
+
+// loadCommittedEvidences rebuilds the committed evidences of the pool from the governance contract, the evidences
+// which are too old to be proposed again are skipped
+func (consensus *ConsensusTBFTImpl) loadCommittedEvidences() error {
+	height, err := consensus.ledgerCache.CurrentHeight()
+	if err != nil {
+		return err
+	}
+	keyRange := util.BytesPrefix(government.VoteEvidencePrefix())
+	iter, err := consensus.store.SelectObject(syscontract.SystemContract_GOVERNANCE.String(),
+		keyRange.Start, keyRange.Limit)
+	if err != nil {
+		return err
+	}
+	defer iter.Release()
+
+	count := 0
+	for iter.Next() {
+		kv, err := iter.Value()
+		if err != nil {
+			return err
+		}
+		ev := new(DuplicateVoteEvidence)
+		if err = json.Unmarshal(kv.Value, ev); err != nil || ev.ValidateBasic() != nil {
+			consensus.logger.Warnf("[%s] skip invalid evidence %x in state", consensus.Id, kv.Key)
+			continue
+		}
+		if ev.VoteA.Height+evidenceMaxAge < height {
+			continue
+		}
+		consensus.evidencePool.loadCommitted(ev)
+		count++
+	}
+	consensus.logger.Infof("[%s] load %d committed evidences at height %d", consensus.Id, count, height)
+	return nil
+}
+
+// verifyEvidence checks the evidence can be included in the block at height, and both votes are signed by the voter
+func (consensus *ConsensusTBFTImpl) verifyEvidence(ev *DuplicateVoteEvidence, height uint64) error {
+	if err := ev.ValidateBasic(); err != nil {
+		return err
+	}
+	if ev.VoteA.Height > height || ev.VoteA.Height+evidenceMaxAge < height {
+		return fmt.Errorf("%w: height %d of %s is out of range at height %d",
+			ErrInvalidEvidence, ev.VoteA.Height, ev, height)
+	}
+	for _, vote := range []*tbftpb.Vote{ev.VoteA, ev.VoteB} {
+		if err := consensus.verifyVote(vote); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidEvidence, err)
+		}
+	}
+	return nil
+}
+
+// createEvidenceWrites creates the writes recording the evidences in the block at height, the evidence is recorded in
+// the governance contract, and in the stake contract for slashing if the chain is DPoS
+func (consensus *ConsensusTBFTImpl) createEvidenceWrites(height uint64,
+	evidences []*DuplicateVoteEvidence) ([]*common.TxWrite, error) {
+	writer, slashable := consensus.dpos.(slashEvidenceWriter)
+	writes := make([]*common.TxWrite, 0, len(evidences))
+	for _, ev := range evidences {
+		data, err := json.Marshal(ev)
+		if err != nil {
+			return nil, err
+		}
+		writes = append(writes, &common.TxWrite{
+			ContractName: syscontract.SystemContract_GOVERNANCE.String(),
+			Key:          ev.Key(),
+			Value:        data,
+		})
+		if !slashable {
+			continue
+		}
+		write, err := writer.NewDoubleSignEvidenceTxWrite(height, ev.VoteA.Voter, ev.VoteA.Height,
+			int64(ev.VoteA.Round), data)
+		if err != nil {
+			return nil, err
+		}
+		if write != nil {
+			writes = append(writes, write)
+		}
+	}
+	return writes, nil
+}
+
+// createMissedProposalWrites creates the writes recording the proposers which missed their proposals at the last
+// height in the block at height, they are the proposers of the rounds before the one in which the last block is
+// committed. The rounds beyond a full rotation of the validators are not recorded, since every validator has missed
+// its proposal by then, which is the fault of the network rather than the proposers. The writes are only created for
+// DPoS, which slashes the validators by them.
+func (consensus *ConsensusTBFTImpl) createMissedProposalWrites(height uint64) ([]*common.TxWrite, error) {
+	writer, slashable := consensus.dpos.(slashEvidenceWriter)
+	if !slashable || height <= 1 ||
+		consensus.chainConf.ChainConfig().Consensus.Type != consensuspb.ConsensusType_DPOS {
+		return nil, nil
+	}
+	lastBlock, err := consensus.store.GetBlock(height - 1)
+	if err != nil {
+		return nil, err
+	}
+	if lastBlock == nil || lastBlock.AdditionalData == nil || lastBlock.AdditionalData.ExtraData == nil {
+		return nil, fmt.Errorf("the qc of block %d is not found", height-1)
+	}
+	qc, ok := lastBlock.AdditionalData.ExtraData[protocol.TBFTAddtionalDataKey]
+	if !ok {
+		return nil, fmt.Errorf("the qc of block %d is not found", height-1)
+	}
+	voteSet := new(tbftpb.VoteSet)
+	if err = proto.Unmarshal(qc, voteSet); err != nil {
+		return nil, err
+	}
+	rounds := voteSet.Round
+	if rounds > consensus.validatorSet.Size() {
+		rounds = consensus.validatorSet.Size()
+	}
+	var writes []*common.TxWrite
+	for round := int32(0); round < rounds; round++ {
+		proposer, err := consensus.validatorSet.GetProposer(height-1, round)
+		if err != nil {
+			return nil, err
+		}
+		write, err := writer.NewMissedProposalEvidenceTxWrite(height, proposer, height-1, int64(round))
+		if err != nil {
+			return nil, err
+		}
+		if write != nil {
+			writes = append(writes, write)
+		}
+	}
+	return writes, nil
+}
+
+// addEvidencesToBlock appends the writes of the pending evidences to the consensus args of the proposed block,
+// they are persisted with the consensus args when the block is committed
+func (consensus *ConsensusTBFTImpl) addEvidencesToBlock(block *common.Block) error {
+	pending := consensus.evidencePool.pendingEvidences(block.Header.BlockHeight, maxEvidencesPerBlock)
+	evidences := make([]*DuplicateVoteEvidence, 0, len(pending))
+	for _, ev := range pending {
+		committed, err := consensus.isEvidenceCommitted(ev)
+		if err != nil {
+			return err
+		}
+		if committed {
+			consensus.evidencePool.loadCommitted(ev)
+			continue
+		}
+		evidences = append(evidences, ev)
+	}
+	writes, err := consensus.createEvidenceWrites(block.Header.BlockHeight, evidences)
+	if err != nil {
+		return err
+	}
+	missed, err := consensus.createMissedProposalWrites(block.Header.BlockHeight)
+	if err != nil {
+		return err
+	}
+	writes = append(writes, missed...)
+	if len(writes) == 0 {
+		return nil
+	}
+
+	args := &consensuspb.BlockHeaderConsensusArgs{
+		ConsensusType: int64(consensus.chainConf.ChainConfig().Consensus.Type),
+	}
+	if len(block.Header.ConsensusArgs) > 0 {
+		if err = proto.Unmarshal(block.Header.ConsensusArgs, args); err != nil {
+			return err
+		}
+	}
+	if args.ConsensusData == nil {
+		args.ConsensusData = &common.TxRWSet{TxId: evidenceTxID}
+	}
+	args.ConsensusData.TxWrites = append(args.ConsensusData.TxWrites, writes...)
+	block.Header.ConsensusArgs = mustMarshal(args)
+	consensus.logger.Infof("[%s](%d/%d/%s) add %d evidences and %d missed proposals to block %d",
+		consensus.Id, consensus.Height, consensus.Round, consensus.Step, len(evidences), len(missed),
+		block.Header.BlockHeight)
+	return nil
+}
+
+// splitBlockEvidences returns the evidences in the consensus args of the block, and the block whose consensus
+// args are without the writes of the evidences
+func splitBlockEvidences(block *common.Block) (*common.Block, []*DuplicateVoteEvidence, []*common.TxWrite, error) {
+	if len(block.Header.ConsensusArgs) == 0 {
+		return block, nil, nil, nil
+	}
+	args := new(consensuspb.BlockHeaderConsensusArgs)
+	if err := proto.Unmarshal(block.Header.ConsensusArgs, args); err != nil {
+		return nil, nil, nil, err
+	}
+	if args.ConsensusData == nil {
+		return block, nil, nil, nil
+	}
+	// the writes of the evidences are appended to the writes of the other consensus args
+	writes := args.ConsensusData.TxWrites
+	first := len(writes)
+	for i, write := range writes {
+		if isEvidenceWrite(write) || isSlashEvidenceWrite(write) {
+			first = i
+			break
+		}
+	}
+	if first == len(writes) {
+		return block, nil, nil, nil
+	}
+	evidences, err := getEvidencesFromWrites(writes[first:])
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	header := proto.Clone(block.Header).(*common.BlockHeader)
+	header.ConsensusArgs = nil
+	if first > 0 || args.ConsensusData.TxId != evidenceTxID {
+		args.ConsensusData.TxWrites = writes[:first]
+		header.ConsensusArgs = mustMarshal(args)
+	}
+	stripped := &common.Block{
+		Header:         header,
+		Dag:            block.Dag,
+		Txs:            block.Txs,
+		AdditionalData: block.AdditionalData,
+	}
+	return stripped, evidences, writes[first:], nil
+}
+
+// verifyBlockEvidences verifies the evidences in the proposed block, and returns the block without the evidences
+// for verifying the other consensus args
+func (consensus *ConsensusTBFTImpl) verifyBlockEvidences(block *common.Block) (*common.Block, error) {
+	stripped, evidences, writes, err := splitBlockEvidences(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(evidences) > maxEvidencesPerBlock {
+		return nil, fmt.Errorf("%w: %d evidences in block %d, max %d", ErrInvalidEvidence,
+			len(evidences), block.Header.BlockHeight, maxEvidencesPerBlock)
+	}
+	keys := make(map[string]struct{}, len(evidences))
+	for _, ev := range evidences {
+		if _, ok := keys[string(ev.Key())]; ok {
+			return nil, fmt.Errorf("%w: duplicate %s", ErrInvalidEvidence, ev)
+		}
+		keys[string(ev.Key())] = struct{}{}
+		// the evidence of the current height can't be proposed
+		if err = consensus.verifyEvidence(ev, block.Header.BlockHeight-1); err != nil {
+			return nil, err
+		}
+		// the evidence is recorded only once, so that the validator is not slashed repeatedly
+		committed, err := consensus.isEvidenceCommitted(ev)
+		if err != nil {
+			return nil, err
+		}
+		if committed {
+			return nil, fmt.Errorf("%w: %s has been committed", ErrInvalidEvidence, ev)
+		}
+	}
+	expected, err := consensus.createEvidenceWrites(block.Header.BlockHeight, evidences)
+	if err != nil {
+		return nil, err
+	}
+	// the missed proposals are derived from the last block, the proposer can't omit or forge them
+	missed, err := consensus.createMissedProposalWrites(block.Header.BlockHeight)
+	if err != nil {
+		return nil, err
+	}
+	expected = append(expected, missed...)
+	if len(writes) == 0 && len(expected) == 0 {
+		return stripped, nil
+	}
+	if !bytes.Equal(mustMarshal(&common.TxRWSet{TxWrites: writes}), mustMarshal(&common.TxRWSet{TxWrites: expected})) {
+		return nil, fmt.Errorf("%w: writes of the evidences mismatch in block %d",
+			ErrInvalidEvidence, block.Header.BlockHeight)
+	}
+	return stripped, nil
+}
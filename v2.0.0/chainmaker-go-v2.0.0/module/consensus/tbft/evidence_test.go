@@ -0,0 +1,525 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package tbft
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"chainmaker.org/chainmaker-go/consensus/dpos"
+	"chainmaker.org/chainmaker-go/consensus/faultinject"
+	"chainmaker.org/chainmaker-go/localconf"
+	"chainmaker.org/chainmaker-go/logger"
+	"chainmaker.org/chainmaker-go/vm/native/dposmgr"
+	"chainmaker.org/chainmaker-go/vm/native/government"
+	"chainmaker.org/chainmaker/common/v2/crypto"
+	"chainmaker.org/chainmaker/common/v2/msgbus"
+	pbac "chainmaker.org/chainmaker/pb-go/v2/accesscontrol"
+	"chainmaker.org/chainmaker/pb-go/v2/common"
+	configpb "chainmaker.org/chainmaker/pb-go/v2/config"
+	consensuspb "chainmaker.org/chainmaker/pb-go/v2/consensus"
+	tbftpb "chainmaker.org/chainmaker/pb-go/v2/consensus/tbft"
+	netpb "chainmaker.org/chainmaker/pb-go/v2/net"
+	"chainmaker.org/chainmaker/pb-go/v2/store"
+	"chainmaker.org/chainmaker/pb-go/v2/syscontract"
+	"chainmaker.org/chainmaker/protocol/v2"
+	"chainmaker.org/chainmaker/protocol/v2/mock"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestVote(voter string, height uint64, round int32, hash string) *tbftpb.Vote {
+	return &tbftpb.Vote{
+		Type:   tbftpb.VoteType_VOTE_PREVOTE,
+		Voter:  voter,
+		Height: height,
+		Round:  round,
+		Hash:   []byte(hash),
+		Endorsement: &common.EndorsementEntry{
+			Signer:    &pbac.Member{MemberInfo: []byte(voter)},
+			Signature: []byte("sig-" + voter),
+		},
+	}
+}
+
+func newTestEvidence(voter string, height uint64) *DuplicateVoteEvidence {
+	return NewDuplicateVoteEvidence(newTestVote(voter, height, 0, "block2"), newTestVote(voter, height, 0, "block1"))
+}
+
+func TestDuplicateVoteEvidence_ValidateBasic(t *testing.T) {
+	a, b := newTestVote("node2", 1, 0, "block1"), newTestVote("node2", 1, 0, "block2")
+	ev := NewDuplicateVoteEvidence(b, a)
+	require.Equal(t, a, ev.VoteA)
+	require.NoError(t, ev.ValidateBasic())
+	require.Equal(t, government.ToVoteEvidenceKey("node2", 1, 0, "VOTE_PREVOTE"), ev.Key())
+
+	otherRound := newTestVote("node2", 1, 1, "block2")
+	noEndorsement := newTestVote("node2", 1, 0, "block2")
+	noEndorsement.Endorsement = nil
+	for _, invalid := range []*DuplicateVoteEvidence{
+		{VoteA: a},
+		{VoteA: a, VoteB: a},
+		{VoteA: b, VoteB: a},
+		{VoteA: a, VoteB: otherRound},
+		{VoteA: a, VoteB: newTestVote("node3", 1, 0, "block2")},
+		{VoteA: a, VoteB: noEndorsement},
+	} {
+		require.True(t, errors.Is(invalid.ValidateBasic(), ErrInvalidEvidence))
+	}
+}
+
+func TestEvidencePool(t *testing.T) {
+	pool := newEvidencePool()
+	ev1, ev2 := newTestEvidence("node2", 1), newTestEvidence("node3", 3)
+	require.True(t, pool.add(ev1))
+	require.False(t, pool.add(newTestEvidence("node2", 1)))
+	require.True(t, pool.add(ev2))
+
+	// the evidence is included in the blocks after its height
+	require.Equal(t, []*DuplicateVoteEvidence{ev1}, pool.pendingEvidences(2, maxEvidencesPerBlock))
+	require.Equal(t, []*DuplicateVoteEvidence{ev1, ev2}, pool.pendingEvidences(4, maxEvidencesPerBlock))
+	require.Len(t, pool.pendingEvidences(4, 1), 1)
+
+	pool.markCommitted(4, []*DuplicateVoteEvidence{ev1})
+	require.False(t, pool.add(ev1))
+	require.Equal(t, []*DuplicateVoteEvidence{ev2}, pool.pendingEvidences(5, maxEvidencesPerBlock))
+
+	require.Empty(t, pool.pendingEvidences(4+evidenceMaxAge, maxEvidencesPerBlock))
+	require.Zero(t, pool.size())
+	pool.markCommitted(2+evidenceMaxAge, nil)
+	require.True(t, pool.add(ev1))
+}
+
+type sendCollector struct {
+	msgbus.DefaultSubscriber
+	msgs chan *netpb.NetMsg
+}
+
+func (c *sendCollector) OnMessage(msg *msgbus.Message) {
+	c.msgs <- msg.Payload.(*netpb.NetMsg)
+}
+
+type kvIterator struct {
+	kvs []*store.KV
+	idx int
+}
+
+func (kvi *kvIterator) Next() bool {
+	kvi.idx++
+	return kvi.idx <= len(kvi.kvs)
+}
+
+func (kvi *kvIterator) Value() (*store.KV, error) {
+	return kvi.kvs[kvi.idx-1], nil
+}
+
+func (kvi *kvIterator) Release() {
+	kvi.idx = 0
+	kvi.kvs = nil
+}
+
+// newEvidenceTestStore returns the store of the committed state, which is keyed by the contract name and the key
+func newEvidenceTestStore(ctrl *gomock.Controller, state map[string][]byte) protocol.BlockchainStore {
+	blockchainStore := mock.NewMockBlockchainStore(ctrl)
+	blockchainStore.EXPECT().ReadObject(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(contractName string, key []byte) ([]byte, error) {
+			return state[contractName+"#"+string(key)], nil
+		}).AnyTimes()
+	blockchainStore.EXPECT().SelectObject(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(contractName string, start []byte, limit []byte) (protocol.StateIterator, error) {
+			iter := &kvIterator{}
+			for k, v := range state {
+				key := []byte(strings.TrimPrefix(k, contractName+"#"))
+				if !strings.HasPrefix(k, contractName+"#") || bytes.Compare(key, start) < 0 ||
+					bytes.Compare(key, limit) >= 0 {
+					continue
+				}
+				iter.kvs = append(iter.kvs, &store.KV{ContractName: contractName, Key: key, Value: v})
+			}
+			sort.Slice(iter.kvs, func(i, j int) bool {
+				return bytes.Compare(iter.kvs[i].Key, iter.kvs[j].Key) < 0
+			})
+			return iter, nil
+		}).AnyTimes()
+	return blockchainStore
+}
+
+// commitTestEvidence records the evidence in the governance contract of the state
+func commitTestEvidence(t *testing.T, state map[string][]byte, ev *DuplicateVoteEvidence) {
+	data, err := json.Marshal(ev)
+	require.NoError(t, err)
+	state[syscontract.SystemContract_GOVERNANCE.String()+"#"+string(ev.Key())] = data
+}
+
+func newEvidenceTestBlock(t *testing.T, height uint64, evs ...*DuplicateVoteEvidence) *common.Block {
+	rwSet := &common.TxRWSet{TxId: evidenceTxID}
+	for _, ev := range evs {
+		data, err := json.Marshal(ev)
+		require.NoError(t, err)
+		rwSet.TxWrites = append(rwSet.TxWrites, &common.TxWrite{
+			ContractName: syscontract.SystemContract_GOVERNANCE.String(),
+			Key:          ev.Key(),
+			Value:        data,
+		})
+	}
+	return &common.Block{Header: &common.BlockHeader{
+		BlockHeight: height,
+		ConsensusArgs: mustMarshal(&consensuspb.BlockHeaderConsensusArgs{
+			ConsensusType: int64(consensuspb.ConsensusType_TBFT),
+			ConsensusData: rwSet,
+		}),
+	}}
+}
+
+func newEvidenceTestTBFT(ctrl *gomock.Controller, state map[string][]byte) *ConsensusTBFTImpl {
+	ids := []string{"node1", "node2", "node3", "node4"}
+	chainConfig := &configpb.ChainConfig{
+		ChainId:   chainId,
+		Crypto:    &configpb.CryptoConfig{Hash: crypto.CRYPTO_ALGO_SHA256},
+		Consensus: &configpb.ConsensusConfig{Type: consensuspb.ConsensusType_TBFT},
+	}
+	for _, id := range ids {
+		chainConfig.TrustMembers = append(chainConfig.TrustMembers,
+			&configpb.TrustMemberConfig{MemberInfo: id, OrgId: "org-" + id, NodeId: id})
+	}
+	chainConf := mock.NewMockChainConf(ctrl)
+	chainConf.EXPECT().ChainConfig().Return(chainConfig).AnyTimes()
+	ac := mock.NewMockAccessControlProvider(ctrl)
+	ac.EXPECT().CreatePrincipal(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(resourceName string, endorsements []*common.EndorsementEntry, message []byte) (protocol.Principal, error) {
+			if string(endorsements[0].Signature) == "forged" {
+				return nil, errors.New("invalid signature")
+			}
+			return nil, nil
+		}).AnyTimes()
+	ac.EXPECT().VerifyPrincipal(gomock.Any()).Return(true, nil).AnyTimes()
+	ac.EXPECT().NewMember(gomock.Any()).Return(nil, nil).AnyTimes()
+	ledgerCache := mock.NewMockLedgerCache(ctrl)
+	ledgerCache.EXPECT().CurrentHeight().Return(uint64(4), nil).AnyTimes()
+
+	consensus := &ConsensusTBFTImpl{
+		logger:       logger.GetLoggerByChain(logger.MODULE_CONSENSUS, chainId),
+		chainID:      chainId,
+		Id:           ids[0],
+		dpos:         dpos.NewDPoSImpl(chainConf, nil),
+		ac:           ac,
+		store:        newEvidenceTestStore(ctrl, state),
+		ledgerCache:  ledgerCache,
+		chainConf:    chainConf,
+		msgbus:       msgbus.NewMessageBus(),
+		evidencePool: newEvidencePool(),
+	}
+	consensus.validatorSet = newValidatorSet(consensus.logger, ids, DefaultBlocksPerProposer)
+	consensus.ConsensusState = NewConsensusState(consensus.logger, consensus.Id)
+	consensus.Height = 5
+	consensus.heightRoundVoteSet = newHeightRoundVoteSet(consensus.logger, consensus.Height, 0, consensus.validatorSet)
+	consensus.gossip = newGossipService(consensus.logger, consensus)
+	return consensus
+}
+
+func TestConsensusTBFTImpl_DetectDuplicateVote(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	consensus := newEvidenceTestTBFT(ctrl, make(map[string][]byte))
+	collector := &sendCollector{msgs: make(chan *netpb.NetMsg, 8)}
+	consensus.msgbus.Register(msgbus.SendConsensusMsg, collector)
+
+	vote := newTestVote("node2", 5, 0, "block1")
+	_, err := consensus.heightRoundVoteSet.addVote(NewVoteFromProto(vote))
+	require.NoError(t, err)
+	consensus.detectDuplicateVote(vote)
+	require.Zero(t, consensus.evidencePool.size())
+
+	conflicting := newTestVote("node2", 5, 0, "block2")
+	consensus.detectDuplicateVote(conflicting)
+	require.Equal(t, []*DuplicateVoteEvidence{NewDuplicateVoteEvidence(vote, conflicting)},
+		consensus.evidencePool.pendingEvidences(6, maxEvidencesPerBlock))
+
+	// the evidence is gossiped to the other validators
+	receivers := make(map[string]bool)
+	for i := 0; i < 3; i++ {
+		select {
+		case netMsg := <-collector.msgs:
+			msg := new(tbftpb.TBFTMsg)
+			mustUnmarshal(netMsg.Payload, msg)
+			require.Equal(t, msgEvidence, msg.Type)
+			receivers[netMsg.To] = true
+		case <-time.After(time.Second):
+			t.Fatal("the evidence is not gossiped")
+		}
+	}
+	require.Equal(t, map[string]bool{"node2": true, "node3": true, "node4": true}, receivers)
+
+	// the gossiped evidence is verified
+	msg, err := createEvidenceMsg(newTestEvidence("node3", 4))
+	require.NoError(t, err)
+	consensus.procEvidence(msg)
+	require.Equal(t, 2, consensus.evidencePool.size())
+	forged := newTestEvidence("node4", 4)
+	forged.VoteB.Endorsement.Signature = []byte("forged")
+	msg, err = createEvidenceMsg(forged)
+	require.NoError(t, err)
+	consensus.procEvidence(msg)
+	require.Equal(t, 2, consensus.evidencePool.size())
+}
+
+func TestConsensusTBFTImpl_BlockEvidences(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	consensus := newEvidenceTestTBFT(ctrl, make(map[string][]byte))
+	ev := newTestEvidence("node2", 3)
+	require.True(t, consensus.evidencePool.add(ev))
+
+	block := &common.Block{Header: &common.BlockHeader{BlockHeight: 5}}
+	require.NoError(t, consensus.addEvidencesToBlock(block))
+	require.NotEmpty(t, block.Header.ConsensusArgs)
+	stripped, err := consensus.verifyBlockEvidences(block)
+	require.NoError(t, err)
+	require.Nil(t, stripped.Header.ConsensusArgs)
+	_, evidences, _, err := splitBlockEvidences(block)
+	require.NoError(t, err)
+	require.Equal(t, []*DuplicateVoteEvidence{ev}, evidences)
+
+	// the writes of the evidences follow the other consensus args, which are verified without them
+	other := mustMarshal(&consensuspb.BlockHeaderConsensusArgs{
+		ConsensusType: int64(consensuspb.ConsensusType_DPOS),
+		ConsensusData: &common.TxRWSet{TxId: "dpos_module", TxWrites: []*common.TxWrite{
+			{ContractName: syscontract.SystemContract_DPOS_STAKE.String(), Key: []byte("CE"), Value: []byte("epoch")},
+		}},
+	})
+	block = &common.Block{Header: &common.BlockHeader{BlockHeight: 5, ConsensusArgs: other}}
+	require.NoError(t, consensus.addEvidencesToBlock(block))
+	require.NotEqual(t, other, block.Header.ConsensusArgs)
+	stripped, err = consensus.verifyBlockEvidences(block)
+	require.NoError(t, err)
+	require.Equal(t, other, stripped.Header.ConsensusArgs)
+
+	newBlock := func(evs ...*DuplicateVoteEvidence) *common.Block {
+		return newEvidenceTestBlock(t, 5, evs...)
+	}
+	_, err = consensus.verifyBlockEvidences(newBlock(ev))
+	require.NoError(t, err)
+
+	forged := newTestEvidence("node4", 3)
+	forged.VoteA.Endorsement.Signature = []byte("forged")
+	tampered := newTestEvidence("node3", 3)
+	tampered.VoteB = tampered.VoteA
+	for _, invalid := range []*common.Block{
+		newBlock(ev, ev),
+		newBlock(forged),
+		newBlock(tampered),
+		// the evidence of the height of the block
+		newBlock(newTestEvidence("node2", 5)),
+	} {
+		_, err = consensus.verifyBlockEvidences(invalid)
+		require.True(t, errors.Is(err, ErrInvalidEvidence), err)
+	}
+
+	// the expired evidence
+	err = consensus.verifyEvidence(newTestEvidence("node2", 1), evidenceMaxAge+2)
+	require.True(t, errors.Is(err, ErrInvalidEvidence), err)
+
+	// the key of the write must be the key of the evidence
+	block = newBlock(ev)
+	_, evidences, writes, err := splitBlockEvidences(block)
+	require.NoError(t, err)
+	require.Len(t, evidences, 1)
+	writes[0].Key = government.ToVoteEvidenceKey("node2", 4, 0, "VOTE_PREVOTE")
+	block.Header.ConsensusArgs = mustMarshal(&consensuspb.BlockHeaderConsensusArgs{
+		ConsensusType: int64(consensuspb.ConsensusType_TBFT),
+		ConsensusData: &common.TxRWSet{TxId: evidenceTxID, TxWrites: writes},
+	})
+	_, err = consensus.verifyBlockEvidences(block)
+	require.True(t, errors.Is(err, ErrInvalidEvidence), err)
+}
+
+// missedProposalTestDPoS records the missed proposals of the nodes by the node id
+type missedProposalTestDPoS struct {
+	protocol.DPoS
+}
+
+func (d *missedProposalTestDPoS) NewDoubleSignEvidenceTxWrite(blockHeight uint64, nodeID string,
+	evidenceHeight uint64, round int64, data []byte) (*common.TxWrite, error) {
+	return nil, nil
+}
+
+func (d *missedProposalTestDPoS) NewMissedProposalEvidenceTxWrite(blockHeight uint64, nodeID string,
+	evidenceHeight uint64, round int64) (*common.TxWrite, error) {
+	return &common.TxWrite{
+		ContractName: syscontract.SystemContract_DPOS_STAKE.String(),
+		Key: dposmgr.ToSlashEvidenceKey(0, nodeID, string(dpos.EvidenceMissedProposal),
+			evidenceHeight, uint64(round)),
+	}, nil
+}
+
+// lastBlockTestStore serves the last block committed in the round
+type lastBlockTestStore struct {
+	protocol.BlockchainStore
+	round int32
+}
+
+func (s *lastBlockTestStore) GetBlock(height uint64) (*common.Block, error) {
+	qc := mustMarshal(&tbftpb.VoteSet{Type: tbftpb.VoteType_VOTE_PRECOMMIT, Height: height, Round: s.round})
+	return &common.Block{
+		Header:         &common.BlockHeader{BlockHeight: height},
+		AdditionalData: &common.AdditionalData{ExtraData: map[string][]byte{protocol.TBFTAddtionalDataKey: qc}},
+	}, nil
+}
+
+func TestConsensusTBFTImpl_MissedProposals(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	consensus := newEvidenceTestTBFT(ctrl, make(map[string][]byte))
+	chainConf := mock.NewMockChainConf(ctrl)
+	chainConf.EXPECT().ChainConfig().Return(&configpb.ChainConfig{
+		ChainId:   chainId,
+		Consensus: &configpb.ConsensusConfig{Type: consensuspb.ConsensusType_DPOS},
+	}).AnyTimes()
+	consensus.chainConf = chainConf
+	consensus.dpos = &missedProposalTestDPoS{}
+	lastBlockStore := &lastBlockTestStore{BlockchainStore: consensus.store}
+	consensus.store = lastBlockStore
+
+	missedKeys := func(block *common.Block) []string {
+		_, _, writes, err := splitBlockEvidences(block)
+		require.NoError(t, err)
+		var keys []string
+		for _, write := range writes {
+			keys = append(keys, string(write.Key))
+		}
+		return keys
+	}
+	proposerKeys := func(rounds int32) []string {
+		var keys []string
+		for round := int32(0); round < rounds; round++ {
+			proposer, err := consensus.validatorSet.GetProposer(4, round)
+			require.NoError(t, err)
+			keys = append(keys, string(dposmgr.ToSlashEvidenceKey(0, proposer,
+				string(dpos.EvidenceMissedProposal), 4, uint64(round))))
+		}
+		return keys
+	}
+
+	// the last block is committed in the first round
+	block := &common.Block{Header: &common.BlockHeader{BlockHeight: 5}}
+	require.NoError(t, consensus.addEvidencesToBlock(block))
+	require.Empty(t, block.Header.ConsensusArgs)
+	_, err := consensus.verifyBlockEvidences(block)
+	require.NoError(t, err)
+
+	// the proposers of the first two rounds missed their proposals
+	lastBlockStore.round = 2
+	block = &common.Block{Header: &common.BlockHeader{BlockHeight: 5}}
+	require.NoError(t, consensus.addEvidencesToBlock(block))
+	require.Equal(t, proposerKeys(2), missedKeys(block))
+	stripped, err := consensus.verifyBlockEvidences(block)
+	require.NoError(t, err)
+	require.Nil(t, stripped.Header.ConsensusArgs)
+
+	// the proposer can't omit the missed proposals
+	_, err = consensus.verifyBlockEvidences(&common.Block{Header: &common.BlockHeader{BlockHeight: 5}})
+	require.True(t, errors.Is(err, ErrInvalidEvidence), err)
+	_, _, writes, err := splitBlockEvidences(block)
+	require.NoError(t, err)
+	block.Header.ConsensusArgs = mustMarshal(&consensuspb.BlockHeaderConsensusArgs{
+		ConsensusType: int64(consensuspb.ConsensusType_DPOS),
+		ConsensusData: &common.TxRWSet{TxId: evidenceTxID, TxWrites: writes[1:]},
+	})
+	_, err = consensus.verifyBlockEvidences(block)
+	require.True(t, errors.Is(err, ErrInvalidEvidence), err)
+
+	// every validator missed its proposal once at most
+	lastBlockStore.round = 10
+	block = &common.Block{Header: &common.BlockHeader{BlockHeight: 5}}
+	require.NoError(t, consensus.addEvidencesToBlock(block))
+	require.Equal(t, proposerKeys(4), missedKeys(block))
+}
+
+func TestConsensusTBFTImpl_CommittedEvidences(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	state := make(map[string][]byte)
+	committed := newTestEvidence("node2", 3)
+	commitTestEvidence(t, state, committed)
+	consensus := newEvidenceTestTBFT(ctrl, state)
+
+	// the committed evidences are rebuilt from the state on start
+	require.NoError(t, consensus.loadCommittedEvidences())
+	require.False(t, consensus.evidencePool.add(committed))
+	msg, err := createEvidenceMsg(committed)
+	require.NoError(t, err)
+	consensus.procEvidence(msg)
+	require.Zero(t, consensus.evidencePool.size())
+
+	// the block recording the committed evidence again is rejected
+	_, err = consensus.verifyBlockEvidences(newEvidenceTestBlock(t, 5, committed))
+	require.True(t, errors.Is(err, ErrInvalidEvidence), err)
+	_, err = consensus.verifyBlockEvidences(newEvidenceTestBlock(t, 5, newTestEvidence("node3", 3), committed))
+	require.True(t, errors.Is(err, ErrInvalidEvidence), err)
+
+	// the pending evidence committed by the block of another proposer is not proposed again
+	pending := newTestEvidence("node3", 3)
+	require.True(t, consensus.evidencePool.add(pending))
+	commitTestEvidence(t, state, pending)
+	block := &common.Block{Header: &common.BlockHeader{BlockHeight: 5}}
+	require.NoError(t, consensus.addEvidencesToBlock(block))
+	require.Empty(t, block.Header.ConsensusArgs)
+	require.Zero(t, consensus.evidencePool.size())
+}
+
+func TestConsensusTBFTImpl_DoubleSignEvidence(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping the tbft cluster in short mode")
+	}
+	prevStorePath := localconf.ChainMakerConfig.StorageConfig.StorePath
+	defer func() {
+		localconf.ChainMakerConfig.StorageConfig.StorePath = prevStorePath
+	}()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	scenario, err := faultinject.LoadScenario(filepath.Join("testdata", "faultinject", "double_sign.yml"))
+	require.NoError(t, err)
+	injector, err := faultinject.NewInjector(scenario, faultinject.NewTBFTCodec(crypto.CRYPTO_ALGO_SHA256))
+	require.NoError(t, err)
+	ids := []string{"node1", "node2", "node3", "node4"}
+	cluster := newTBFTCluster(t, ctrl, ids, injector)
+	cluster.start(t)
+	defer cluster.stop()
+
+	// node3 receives the conflicting prevotes of node2, and the evidences are committed in the next 20 blocks
+	for i := 0; ; i++ {
+		cluster.waitCommitted(t, ids, cluster.cores["node1"].height()+1, 50)
+		committed := make(map[string]bool)
+		core := cluster.cores["node1"]
+		core.Lock()
+		blocks := append([]*common.Block(nil), core.committed...)
+		core.Unlock()
+		for _, block := range blocks {
+			_, evidences, _, err := splitBlockEvidences(block)
+			require.NoError(t, err)
+			for _, ev := range evidences {
+				require.Equal(t, "node2", ev.VoteA.Voter)
+				require.True(t, ev.VoteA.Height < block.Header.BlockHeight)
+				require.False(t, committed[string(ev.Key())], "evidence %s is committed twice", ev)
+				committed[string(ev.Key())] = true
+			}
+		}
+		if len(committed) >= 2 {
+			break
+		}
+		if i >= 20 {
+			t.Fatalf("%d evidences are committed in %d blocks, expect at least 2", len(committed), len(blocks))
+		}
+	}
+}
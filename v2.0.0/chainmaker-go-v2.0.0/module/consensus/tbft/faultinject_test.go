@@ -0,0 +1,253 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package tbft
+
+import (
+	"bytes"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"chainmaker.org/chainmaker-go/consensus/dpos"
+	"chainmaker.org/chainmaker-go/consensus/faultinject"
+	"chainmaker.org/chainmaker-go/localconf"
+	"chainmaker.org/chainmaker/common/v2/crypto"
+	"chainmaker.org/chainmaker/common/v2/msgbus"
+	pbac "chainmaker.org/chainmaker/pb-go/v2/accesscontrol"
+	"chainmaker.org/chainmaker/pb-go/v2/common"
+	configpb "chainmaker.org/chainmaker/pb-go/v2/config"
+	consensuspb "chainmaker.org/chainmaker/pb-go/v2/consensus"
+	"chainmaker.org/chainmaker/protocol/v2"
+	"chainmaker.org/chainmaker/protocol/v2/mock"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+// clusterCore takes the place of the core engine of a node in the cluster, it proposes empty blocks,
+// accepts all proposed blocks and records the committed blocks
+type clusterCore struct {
+	sync.Mutex
+	msgbus.DefaultSubscriber
+
+	id        string
+	bus       msgbus.MessageBus
+	committed []*common.Block
+}
+
+func (c *clusterCore) height() uint64 {
+	c.Lock()
+	defer c.Unlock()
+	return uint64(len(c.committed))
+}
+
+func (c *clusterCore) OnMessage(msg *msgbus.Message) {
+	switch msg.Topic {
+	case msgbus.ProposeState:
+		if !msg.Payload.(bool) {
+			return
+		}
+		c.Lock()
+		header := &common.BlockHeader{
+			ChainId:        chainId,
+			BlockHeight:    uint64(len(c.committed)) + 1,
+			BlockTimestamp: int64(len(c.committed)) + 1,
+			Proposer:       &pbac.Member{MemberInfo: []byte(c.id)},
+		}
+		if len(c.committed) > 0 {
+			header.PreBlockHash = c.committed[len(c.committed)-1].Header.BlockHash
+		}
+		c.Unlock()
+		c.bus.Publish(msgbus.ProposedBlock, &consensuspb.ProposalBlock{
+			Block: &common.Block{Header: header, Dag: &common.DAG{}},
+		})
+	case msgbus.VerifyBlock:
+		c.bus.Publish(msgbus.VerifyResult, &consensuspb.VerifyResult{
+			VerifiedBlock: msg.Payload.(*common.Block),
+			Code:          consensuspb.VerifyResult_SUCCESS,
+		})
+	case msgbus.CommitBlock:
+		block := msg.Payload.(*common.Block)
+		c.Lock()
+		if block.Header.BlockHeight != uint64(len(c.committed))+1 {
+			c.Unlock()
+			return
+		}
+		c.committed = append(c.committed, block)
+		c.Unlock()
+		c.bus.Publish(msgbus.BlockInfo, &common.BlockInfo{Block: block})
+	}
+}
+
+// tbftCluster runs the nodes on a fake clock, which is advanced by waitCommitted once the nodes are idle
+type tbftCluster struct {
+	ids     []string
+	cores   map[string]*clusterCore
+	engines []*ConsensusTBFTImpl
+	clock   *faultinject.FakeClock
+	network *faultinject.Network
+}
+
+func newTBFTCluster(t *testing.T, ctrl *gomock.Controller, ids []string,
+	injector *faultinject.Injector) *tbftCluster {
+	chainConfig := &configpb.ChainConfig{
+		ChainId: chainId,
+		Crypto:  &configpb.CryptoConfig{Hash: crypto.CRYPTO_ALGO_SHA256},
+		Consensus: &configpb.ConsensusConfig{
+			Type: consensuspb.ConsensusType_TBFT,
+			ExtConfig: []*configpb.ConfigKeyValue{
+				{Key: protocol.TBFT_propose_timeout_key, Value: "1s"},
+			},
+		},
+	}
+	for _, id := range ids {
+		chainConfig.Consensus.Nodes = append(chainConfig.Consensus.Nodes,
+			&configpb.OrgConfig{OrgId: "org-" + id, NodeId: []string{id}})
+		chainConfig.TrustMembers = append(chainConfig.TrustMembers,
+			&configpb.TrustMemberConfig{MemberInfo: id, OrgId: "org-" + id, NodeId: id})
+	}
+
+	clock := faultinject.NewFakeClock(time.Unix(0, 0))
+	cluster := &tbftCluster{
+		ids:     ids,
+		cores:   make(map[string]*clusterCore),
+		clock:   clock,
+		network: faultinject.NewNetwork(injector, clock),
+	}
+	storePath := t.TempDir()
+	for _, id := range ids {
+		chainConf := mock.NewMockChainConf(ctrl)
+		chainConf.EXPECT().ChainConfig().Return(chainConfig).AnyTimes()
+		signer := mock.NewMockSigningMember(ctrl)
+		signer.EXPECT().Sign(gomock.Any(), gomock.Any()).Return([]byte("sig-"+id), nil).AnyTimes()
+		signer.EXPECT().GetMember().Return(&pbac.Member{MemberInfo: []byte(id)}, nil).AnyTimes()
+		ac := mock.NewMockAccessControlProvider(ctrl)
+		ac.EXPECT().CreatePrincipal(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, nil).AnyTimes()
+		ac.EXPECT().VerifyPrincipal(gomock.Any()).Return(true, nil).AnyTimes()
+		ac.EXPECT().NewMember(gomock.Any()).Return(nil, nil).AnyTimes()
+		dbHandle := mock.NewMockDBHandle(ctrl)
+		dbHandle.EXPECT().Put(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+		ledgerCache := mock.NewMockLedgerCache(ctrl)
+		ledgerCache.EXPECT().CurrentHeight().Return(uint64(0), nil).AnyTimes()
+
+		bus := msgbus.NewMessageBus()
+		core := &clusterCore{id: id, bus: bus}
+		bus.Register(msgbus.ProposeState, core)
+		bus.Register(msgbus.VerifyBlock, core)
+		bus.Register(msgbus.CommitBlock, core)
+		cluster.cores[id] = core
+		cluster.network.AddNode(id, bus, signer)
+
+		// the wal of each node is opened under the store path in New
+		localconf.ChainMakerConfig.StorageConfig.StorePath = filepath.Join(storePath, id)
+		engine, err := New(ConsensusTBFTImplConfig{
+			ChainID:     chainId,
+			Id:          id,
+			Dpos:        dpos.NewDPoSImpl(chainConf, nil),
+			Signer:      signer,
+			Ac:          ac,
+			DbHandle:    dbHandle,
+			Store:       newEvidenceTestStore(ctrl, make(map[string][]byte)),
+			LedgerCache: ledgerCache,
+			ChainConf:   chainConf,
+			MsgBus:      bus,
+		})
+		require.NoError(t, err)
+		engine.timeScheduler.afterFunc = clock.AfterFunc
+		cluster.engines = append(cluster.engines, engine)
+	}
+	return cluster
+}
+
+func (c *tbftCluster) start(t *testing.T) {
+	for _, engine := range c.engines {
+		require.NoError(t, engine.Start())
+	}
+}
+
+func (c *tbftCluster) stop() {
+	c.network.Stop()
+	for _, engine := range c.engines {
+		_ = engine.Stop()
+	}
+}
+
+// waitCommitted runs the cluster until the nodes commit the blocks up to height, and checks they commit the
+// same blocks. The timeouts are run on the fake clock, it fails if the nodes are still behind after maxSteps
+// advances of the clock.
+func (c *tbftCluster) waitCommitted(t *testing.T, ids []string, height uint64, maxSteps int) {
+	err := faultinject.Run(c.network, c.clock, 20*time.Millisecond, maxSteps, func() bool {
+		for _, id := range ids {
+			if c.cores[id].height() < height {
+				return false
+			}
+		}
+		return true
+	})
+	if err != nil {
+		for _, id := range ids {
+			t.Logf("node %s committed %d blocks, expect %d", id, c.cores[id].height(), height)
+		}
+		t.Fatal(err)
+	}
+	committed := func(id string) []*common.Block {
+		core := c.cores[id]
+		core.Lock()
+		defer core.Unlock()
+		return append([]*common.Block(nil), core.committed...)
+	}
+	expect := committed(ids[0])
+	for _, id := range c.ids {
+		for i, block := range committed(id) {
+			if i < int(height) && !bytes.Equal(expect[i].Header.BlockHash, block.Header.BlockHash) {
+				t.Errorf("node %s committed block[%d] %x, node %s committed %x", id, i+1,
+					block.Header.BlockHash, ids[0], expect[i].Header.BlockHash)
+			}
+		}
+	}
+}
+
+func TestConsensusTBFTImpl_FaultInjection(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping the tbft cluster in short mode")
+	}
+	prevStorePath := localconf.ChainMakerConfig.StorageConfig.StorePath
+	defer func() {
+		localconf.ChainMakerConfig.StorageConfig.StorePath = prevStorePath
+	}()
+
+	ids := []string{"node1", "node2", "node3", "node4"}
+	tests := []struct {
+		scenario string
+		// the nodes expected to keep committing
+		live []string
+	}{
+		{"prevote_lost", ids},
+		{"equivocation", ids},
+		{"delay_duplicate", ids},
+		{"partition", ids[:3]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.scenario, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			scenario, err := faultinject.LoadScenario(filepath.Join("testdata", "faultinject", tt.scenario+".yml"))
+			require.NoError(t, err)
+			injector, err := faultinject.NewInjector(scenario, faultinject.NewTBFTCodec(crypto.CRYPTO_ALGO_SHA256))
+			require.NoError(t, err)
+			cluster := newTBFTCluster(t, ctrl, ids, injector)
+			cluster.start(t)
+			defer cluster.stop()
+
+			cluster.waitCommitted(t, tt.live, 5, 200)
+			for i := range scenario.Rules {
+				require.NotZero(t, injector.Count(i), "rule %d of %s is not applied", i, tt.scenario)
+			}
+		})
+	}
+}
@@ -14,6 +14,7 @@ import (
 
 	"chainmaker.org/chainmaker/common/v2/msgbus"
 	tbftpb "chainmaker.org/chainmaker/pb-go/v2/consensus/tbft"
+	netpb "chainmaker.org/chainmaker/pb-go/v2/net"
 	"github.com/gogo/protobuf/proto"
 )
 
@@ -156,6 +157,21 @@ func (g *gossipService) gossipState() {
 	}
 }
 
+// broadcast sends the message to all the other validators
+func (g *gossipService) broadcast(msg *tbftpb.TBFTMsg) {
+	payload := mustMarshal(msg)
+
+	g.Lock()
+	defer g.Unlock()
+	for id := range g.peerStates {
+		g.msgbus.Publish(msgbus.SendConsensusMsg, &netpb.NetMsg{
+			Payload: payload,
+			Type:    netpb.NetMsg_CONSENSUS_MSG,
+			To:      id,
+		})
+	}
+}
+
 func (g *gossipService) onRecvState(msg *tbftpb.TBFTMsg) {
 	g.recvStateC <- msg
 }
@@ -53,25 +53,30 @@ func newTimeoutInfoFromProto(ti *tbftpb.TimeoutInfo) timeoutInfo {
 // timeScheduler is used by consensus for shecdule timeout events.
 // Outdated timeouts will be ignored in processing.
 type timeScheduler struct {
-	logger   *logger.CMLogger
-	id       string
-	timer    *time.Timer
-	bufferC  chan timeoutInfo
-	timeoutC chan timeoutInfo
-	stopC    chan struct{}
+	logger *logger.CMLogger
+	id     string
+	// afterFunc schedules the timeouts, it is replaced by a fake clock in tests
+	afterFunc func(d time.Duration, f func()) (stop func() bool)
+	stop      func() bool // stops the timer of the latest timeout
+	bufferC   chan timeoutInfo
+	firedC    chan timeoutInfo
+	timeoutC  chan timeoutInfo
+	stopC     chan struct{}
 }
 
 // NewTimeSheduler returns a new timeScheduler
 func NewTimeSheduler(logger *logger.CMLogger, id string) *timeScheduler {
 	ts := &timeScheduler{
-		logger:   logger,
-		id:       id,
-		timer:    time.NewTimer(0),
+		logger: logger,
+		id:     id,
+		afterFunc: func(d time.Duration, f func()) func() bool {
+			return time.AfterFunc(d, f).Stop
+		},
 		bufferC:  make(chan timeoutInfo, defaultTimeSchedulerBufferSize),
+		firedC:   make(chan timeoutInfo, defaultTimeSchedulerBufferSize),
 		timeoutC: make(chan timeoutInfo, defaultTimeSchedulerBufferSize),
 		stopC:    make(chan struct{}),
 	}
-	ts.stopTimer()
 
 	return ts
 }
@@ -88,7 +93,9 @@ func (ts *timeScheduler) Stop() {
 
 // stopTimer stop timer of timeScheduler
 func (ts *timeScheduler) stopTimer() {
-	ts.timer.Stop()
+	if ts.stop != nil {
+		ts.stop()
+	}
 }
 
 // AddTimeoutInfo add a timeoutInfo event to timeScheduler
@@ -127,13 +134,24 @@ func (ts *timeScheduler) handle() {
 
 			// update with new timeout
 			ti = t
-			ts.timer.Reset(ti.Duration)
+			fired := ti
+			ts.stop = ts.afterFunc(ti.Duration, func() {
+				select {
+				case ts.firedC <- fired:
+				case <-ts.stopC:
+				}
+			})
 			ts.logger.Debugf("[%s] schedule %s", ts.id, ti)
 
-		case <-ts.timer.C: // timeout
+		case t := <-ts.firedC: // timeout
+			// ignore the timer fired before it is stopped
+			if t != ti {
+				continue
+			}
 			ts.logger.Debugf("[%s] %s timeout", ts.id, ti)
 			ts.timeoutC <- ti
 		case <-ts.stopC:
+			ts.stopTimer()
 			return
 		}
 	}
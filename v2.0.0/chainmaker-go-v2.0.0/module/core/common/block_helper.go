@@ -73,6 +73,24 @@ func NewBlockBuilder(conf *BlockBuilderConf) *BlockBuilder {
 	return creatorBlock
 }
 
+// filterTxsByNonce removes the txs whose nonce has been used from the pool, and puts the txs which wait for the
+// txs of lower nonce back to the pool, the remaining txs use the nonces of their senders in order.
+func (bb *BlockBuilder) filterTxsByNonce(txs []*commonpb.Transaction, snapshot protocol.Snapshot) []*commonpb.Transaction {
+	chainConfig := bb.chainConf.ChainConfig()
+	if !utils.IsTxNonceEnabled(chainConfig) {
+		return txs
+	}
+	reader := func(contractName string, key []byte) ([]byte, error) {
+		return snapshot.GetKey(-1, contractName, key)
+	}
+	validTxs, usedTxs, waitingTxs := utils.SplitTxsByNonce(txs, chainConfig.Crypto.Hash, reader)
+	if len(usedTxs) > 0 || len(waitingTxs) > 0 {
+		bb.log.Infof("filter txs by nonce, used: %d, waiting: %d", len(usedTxs), len(waitingTxs))
+		bb.txPool.RetryAndRemoveTxs(waitingTxs, usedTxs)
+	}
+	return validTxs
+}
+
 func (bb *BlockBuilder) GenerateNewBlock(proposingHeight uint64, preHash []byte, txBatch []*commonpb.Transaction) (*commonpb.Block, []int64, error) {
 	timeLasts := make([]int64, 0)
 	currentHeight, _ := bb.ledgerCache.CurrentHeight()
@@ -109,6 +127,7 @@ func (bb *BlockBuilder) GenerateNewBlock(proposingHeight uint64, preHash []byte,
 	// If only part of the txBatch is filled into the Block, consider executing it again
 	ssStartTick := utils.CurrentTimeMillisSeconds()
 	snapshot := bb.snapshotManager.NewSnapshot(lastBlock, block)
+	validatedTxs = bb.filterTxsByNonce(validatedTxs, snapshot)
 	vmStartTick := utils.CurrentTimeMillisSeconds()
 	ssLasts := vmStartTick - ssStartTick
 	bb.storeHelper.BeginDbTransaction(snapshot.GetBlockchainStore(), block.GetTxKey())
@@ -128,6 +147,11 @@ func (bb *BlockBuilder) GenerateNewBlock(proposingHeight uint64, preHash []byte,
 		return nil, timeLasts, fmt.Errorf("no txs in scheduled block, proposing block ends")
 	}
 
+	if err = SetStateRoot(block, lastBlock, snapshot.GetBlockchainStore(), bb.ledgerCache,
+		bb.proposalCache); err != nil {
+		return nil, timeLasts, fmt.Errorf("set state root of block(%d) error %s", block.Header.BlockHeight, err)
+	}
+
 	finalizeStartTick := utils.CurrentTimeMillisSeconds()
 	err = FinalizeBlock(
 		block,
@@ -343,6 +367,21 @@ func IsTxDuplicate(txs []*commonpb.Transaction) bool {
 	return len(txSet) < len(txs)
 }
 
+// IsTxNonceValid, to check if the nonces of the txs of each sender are consecutive from the nonce in state
+func IsTxNonceValid(block *commonpb.Block, snapshot protocol.Snapshot, chainConf protocol.ChainConf) error {
+	chainConfig := chainConf.ChainConfig()
+	if !utils.IsTxNonceEnabled(chainConfig) {
+		return nil
+	}
+	reader := func(contractName string, key []byte) ([]byte, error) {
+		return snapshot.GetKey(-1, contractName, key)
+	}
+	if err := utils.VerifyTxsNonce(block.Txs, chainConfig.Crypto.Hash, reader); err != nil {
+		return fmt.Errorf("verify tx nonce failed, %s", err)
+	}
+	return nil
+}
+
 // IsMerkleRootValid, to check if block merkle root equals with simulated merkle root
 func IsMerkleRootValid(block *commonpb.Block, txHashes [][]byte, hashType string) error {
 	txRoot, err := hash.GetMerkleRoot(hashType, txHashes)
@@ -513,6 +552,9 @@ func (vb *VerifierBlock) ValidateBlock(
 	if err != nil {
 		return nil, nil, timeLasts, err
 	}
+	if err = IsStateRootValid(block, lastBlock, vb.blockchainStore, vb.ledgerCache, vb.proposalCache); err != nil {
+		return nil, nil, timeLasts, err
+	}
 	// we must new a snapshot for the vacant block,
 	// otherwise the subsequent snapshot can not link to the previous snapshot.
 	snapshot := vb.snapshotManager.NewSnapshot(lastBlock, block)
@@ -523,6 +565,10 @@ func (vb *VerifierBlock) ValidateBlock(
 	if IsTxDuplicate(block.Txs) {
 		return nil, nil, timeLasts, fmt.Errorf("tx duplicate")
 	}
+	// verify the nonces of the senders are used in order
+	if err = IsTxNonceValid(block, snapshot, vb.chainConf); err != nil {
+		return nil, nil, timeLasts, err
+	}
 
 	// simulate with DAG, and verify read write set
 	startVMTick := utils.CurrentTimeMillisSeconds()
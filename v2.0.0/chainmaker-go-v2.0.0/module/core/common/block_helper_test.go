@@ -16,6 +16,7 @@ import (
 	"chainmaker.org/chainmaker/common/v2/crypto/hash"
 	"chainmaker.org/chainmaker/pb-go/v2/accesscontrol"
 	commonpb "chainmaker.org/chainmaker/pb-go/v2/common"
+	configpb "chainmaker.org/chainmaker/pb-go/v2/config"
 	"chainmaker.org/chainmaker/protocol/v2"
 	"github.com/stretchr/testify/require"
 )
@@ -191,3 +192,71 @@ func FinalizeBlockSync(
 
 	return nil
 }
+
+type nonceTestChainConf struct {
+	protocol.ChainConf
+	config *configpb.ChainConfig
+}
+
+func (c *nonceTestChainConf) ChainConfig() *configpb.ChainConfig {
+	return c.config
+}
+
+type nonceTestSnapshot struct {
+	protocol.Snapshot
+	state map[string][]byte
+}
+
+func (s *nonceTestSnapshot) GetKey(txExecSeq int, contractName string, key []byte) ([]byte, error) {
+	return s.state[contractName+"/"+string(key)], nil
+}
+
+func createNonceTestTx(member string, nonce uint64) *commonpb.Transaction {
+	tx := createNewTestTx(fmt.Sprintf("%s-%d", member, nonce))
+	tx.Payload.Sequence = nonce
+	tx.Sender = &commonpb.EndorsementEntry{Signer: &accesscontrol.Member{OrgId: "org1",
+		MemberType: accesscontrol.MemberType_PUBLIC_KEY, MemberInfo: []byte(member)}}
+	return tx
+}
+
+func TestIsTxNonceValid(t *testing.T) {
+	chainConf := &nonceTestChainConf{config: &configpb.ChainConfig{
+		Crypto: &configpb.CryptoConfig{Hash: "SHA256"},
+		Consensus: &configpb.ConsensusConfig{ExtConfig: []*configpb.ConfigKeyValue{
+			{Key: utils.TxNonceConfigKey, Value: "true"},
+		}},
+	}}
+	account, err := utils.TxNonceAccount(createNonceTestTx("user1", 0), "SHA256")
+	require.NoError(t, err)
+	snapshot := &nonceTestSnapshot{state: map[string][]byte{
+		utils.TxNonceContractName + "/" + string(utils.TxNonceKey(account)): utils.EncodeTxNonce(5),
+	}}
+
+	tests := []struct {
+		name  string
+		txs   []*commonpb.Transaction
+		valid bool
+	}{
+		{"consecutive", []*commonpb.Transaction{createNonceTestTx("user1", 6), createNonceTestTx("user2", 1),
+			createNonceTestTx("user1", 7)}, true},
+		{"used", []*commonpb.Transaction{createNonceTestTx("user1", 5)}, false},
+		{"gap", []*commonpb.Transaction{createNonceTestTx("user1", 6), createNonceTestTx("user1", 8)}, false},
+		{"out of order", []*commonpb.Transaction{createNonceTestTx("user1", 7), createNonceTestTx("user1", 6)}, false},
+		{"duplicate", []*commonpb.Transaction{createNonceTestTx("user1", 6), createNonceTestTx("user1", 6)}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := IsTxNonceValid(&commonpb.Block{Txs: tt.txs}, snapshot, chainConf)
+			if tt.valid {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+		})
+	}
+
+	// the nonces are not verified if they are not enabled
+	chainConf.config.Consensus.ExtConfig = nil
+	require.NoError(t, IsTxNonceValid(&commonpb.Block{Txs: []*commonpb.Transaction{createNonceTestTx("user1", 5)}},
+		snapshot, chainConf))
+}
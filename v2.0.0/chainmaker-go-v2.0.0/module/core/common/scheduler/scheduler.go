@@ -40,13 +40,20 @@ type TxScheduler struct {
 
 	metricVMRunTime *prometheus.HistogramVec
 	StoreHelper     conf.StoreHelper
+
+	// gasFees the gas fees of the txs of the block being scheduled
+	gasFees *blockGasFees
+
+	// sqlTxLock keeps the statements of a sql tx contiguous in the db transaction of block, from its savepoint
+	// to its apply, so that the tx can be rolled back to the savepoint alone
+	sqlTxLock sync.Mutex
 }
 
 // Transaction dependency in adjacency table representation
 type dagNeighbors map[int]bool
 
 func NewTxSimContext(vmManager protocol.VmManager, snapshot protocol.Snapshot, tx *commonpb.Transaction,
-	blockVersion uint32) protocol.TxSimContext {
+	blockVersion uint32) TxSimContext {
 	return &txSimContextImpl{
 		txExecSeq:        snapshot.GetSnapshotSize(),
 		tx:               tx,
@@ -70,6 +77,7 @@ func (ts *TxScheduler) Schedule(block *commonpb.Block, txBatch []*commonpb.Trans
 
 	ts.lock.Lock()
 	defer ts.lock.Unlock()
+	ts.gasFees = newBlockGasFees()
 	txRWSetMap := make(map[string]*commonpb.TxRWSet)
 	txBatchSize := len(txBatch)
 	runningTxC := make(chan *commonpb.Transaction, txBatchSize)
@@ -84,6 +92,7 @@ func (ts *TxScheduler) Schedule(block *commonpb.Block, txBatch []*commonpb.Trans
 		return nil, nil, err
 	}
 	defer goRoutinePool.Release()
+	nonceBackoff := newTxNonceBackoff()
 	startTime := time.Now()
 	go func() {
 		for {
@@ -94,26 +103,37 @@ func (ts *TxScheduler) Schedule(block *commonpb.Block, txBatch []*commonpb.Trans
 					if snapshot.IsSealed() {
 						return
 					}
+					// the tx of the sender runs after the tx of the lower nonce is applied
+					if ts.isTxNonceWaiting(tx, snapshot) {
+						nonceBackoff.requeue(tx, runningTxC)
+						return
+					}
 					ts.log.Debugf("run vm for tx id:%s", tx.Payload.GetTxId())
 					txSimContext := NewTxSimContext(ts.VmManager, snapshot, tx, block.Header.BlockVersion)
-					runVmSuccess := true
 					var txResult *commonpb.Result
-					var err error
+					var applyResult bool
+					var applySize int
 					var start time.Time
 					if localconf.ChainMakerConfig.MonitorConfig.Enabled {
 						start = time.Now()
 					}
-					//交易结果
-					if txResult, err = ts.runVM(tx, txSimContext); err != nil {
-						runVmSuccess = false
-						tx.Result = txResult
-						txSimContext.SetTxResult(txResult)
-						ts.log.Errorf("failed to run vm for tx id:%s during schedule, tx result:%+v, error:%+v", tx.Payload.GetTxId(), txResult, err)
-					} else {
-						tx.Result = txResult
-						txSimContext.SetTxResult(txResult)
-					}
-					applyResult, applySize := snapshot.ApplyTxSimContext(txSimContext, runVmSuccess)
+					// the sql of the tx conflicted in snapshot is rolled back before it runs again
+					ts.runInSqlSavePoint(block, tx, snapshot, func() bool {
+						runVmSuccess := true
+						var err error
+						//交易结果
+						if txResult, err = ts.runTx(tx, txSimContext); err != nil {
+							runVmSuccess = false
+							tx.Result = txResult
+							txSimContext.SetTxResult(txResult)
+							ts.log.Errorf("failed to run vm for tx id:%s during schedule, tx result:%+v, error:%+v", tx.Payload.GetTxId(), txResult, err)
+						} else {
+							tx.Result = txResult
+							txSimContext.SetTxResult(txResult)
+						}
+						applyResult, applySize = snapshot.ApplyTxSimContext(txSimContext, runVmSuccess)
+						return applyResult
+					})
 					if !applyResult {
 						runningTxC <- tx
 					} else {
@@ -159,6 +179,9 @@ func (ts *TxScheduler) Schedule(block *commonpb.Block, txBatch []*commonpb.Trans
 	timeCostA := time.Since(startTime)
 	block.Dag = snapshot.BuildDAG(ts.chainConf.ChainConfig().Contract.EnableSqlSupport)
 	block.Txs = snapshot.GetTxTable()
+	if err = ts.creditGasFees(block, snapshot); err != nil {
+		return nil, nil, err
+	}
 	timeCostB := time.Since(startTime)
 	ts.log.Infof("schedule tx batch end, success %d, time used %v, time used (dag include) %v ",
 		len(block.Dag.Vertexes), timeCostA, timeCostB)
@@ -184,6 +207,7 @@ func (ts *TxScheduler) Schedule(block *commonpb.Block, txBatch []*commonpb.Trans
 func (ts *TxScheduler) SimulateWithDag(block *commonpb.Block, snapshot protocol.Snapshot) (map[string]*commonpb.TxRWSet, map[string]*commonpb.Result, error) {
 	ts.lock.Lock()
 	defer ts.lock.Unlock()
+	ts.gasFees = newBlockGasFees()
 
 	var (
 		startTime  = time.Now()
@@ -233,20 +257,24 @@ func (ts *TxScheduler) SimulateWithDag(block *commonpb.Block, snapshot protocol.
 				err := goRoutinePool.Submit(func() {
 					ts.log.Debugf("run vm with dag for tx id %s", tx.Payload.GetTxId())
 					txSimContext := NewTxSimContext(ts.VmManager, snapshot, tx, block.Header.BlockVersion)
-					runVmSuccess := true
 					var txResult *commonpb.Result
-					var err error
-
-					if txResult, err = ts.runVM(tx, txSimContext); err != nil {
-						runVmSuccess = false
-						txSimContext.SetTxResult(txResult)
-						ts.log.Errorf("failed to run vm for tx id:%s during simulate with dag, tx result:%+v, error:%+v", tx.Payload.GetTxId(), txResult, err)
-					} else {
-						//ts.log.Debugf("success to run vm for tx id:%s during simulate with dag, tx result:%+v", tx.Payload.GetTxId(), txResult)
-						txSimContext.SetTxResult(txResult)
-					}
-
-					applyResult, applySize := snapshot.ApplyTxSimContext(txSimContext, runVmSuccess)
+					var applyResult bool
+					var applySize int
+
+					ts.runInSqlSavePoint(block, tx, snapshot, func() bool {
+						runVmSuccess := true
+						var err error
+						if txResult, err = ts.runTx(tx, txSimContext); err != nil {
+							runVmSuccess = false
+							txSimContext.SetTxResult(txResult)
+							ts.log.Errorf("failed to run vm for tx id:%s during simulate with dag, tx result:%+v, error:%+v", tx.Payload.GetTxId(), txResult, err)
+						} else {
+							//ts.log.Debugf("success to run vm for tx id:%s during simulate with dag, tx result:%+v", tx.Payload.GetTxId(), txResult)
+							txSimContext.SetTxResult(txResult)
+						}
+						applyResult, applySize = snapshot.ApplyTxSimContext(txSimContext, runVmSuccess)
+						return applyResult
+					})
 					if !applyResult {
 						ts.log.Debugf("failed to apply according to dag with tx %s ", tx.Payload.TxId)
 						runningTxC <- txIndex
@@ -292,6 +320,12 @@ func (ts *TxScheduler) SimulateWithDag(block *commonpb.Block, snapshot protocol.
 
 	<-ts.scheduleFinishC
 	snapshot.Seal()
+	// the block fails to verify if some txs are not applied
+	if len(snapshot.GetTxTable()) == len(block.Txs) {
+		if err = ts.creditGasFees(block, snapshot); err != nil {
+			return nil, nil, err
+		}
+	}
 
 	ts.log.Infof("simulate with dag end, size %d, time used %+v", len(block.Txs), time.Since(startTime))
 
@@ -329,7 +363,7 @@ func (ts *TxScheduler) Halt() {
 	ts.scheduleFinishC <- true
 }
 
-func (ts *TxScheduler) runVM(tx *commonpb.Transaction, txSimContext protocol.TxSimContext) (*commonpb.Result, error) {
+func (ts *TxScheduler) runVM(tx *commonpb.Transaction, txSimContext TxSimContext) (*commonpb.Result, error) {
 	//var contractId *commonpb.Contract
 	var contractName string
 	//var runtimeType commonpb.RuntimeType
@@ -349,6 +383,8 @@ func (ts *TxScheduler) runVM(tx *commonpb.Transaction, txSimContext protocol.TxS
 		RwSetHash: nil,
 	}
 	payload := tx.Payload
+	// the fee of the previous run of the tx is discarded
+	ts.gasFees.set(payload.TxId, nil)
 	switch tx.Payload.TxType {
 	case commonpb.TxType_QUERY_CONTRACT:
 		//var payload commonpb.Payload
@@ -462,15 +498,27 @@ func (ts *TxScheduler) runVM(tx *commonpb.Transaction, txSimContext protocol.TxS
 	//	RuntimeType:     runtimeType,
 	//}
 
+	gasPrice, err := ts.checkGasFee(tx, txSimContext)
+	if err != nil {
+		ts.log.Warnf("check gas fee of tx[%s] error:%s", payload.TxId, err)
+		return errResult(result, fmt.Errorf("check gas fee of tx[%s] error:%s", payload.TxId, err.Error()))
+	}
+
 	contractResultPayload, txStatusCode := ts.VmManager.RunContract(contract, method, byteCode, parameters, txSimContext, 0, tx.Payload.TxType)
 
 	result.Code = txStatusCode
 	result.ContractResult = contractResultPayload
 
-	if txStatusCode == commonpb.TxStatusCode_SUCCESS {
+	if err = ts.chargeGasFee(txSimContext, gasPrice, result); err != nil {
+		ts.log.Errorf("charge gas fee of tx[%s] error:%s", payload.TxId, err)
+		result.Code = commonpb.TxStatusCode_INTERNAL_ERROR
+		return result, err
+	}
+
+	if result.Code == commonpb.TxStatusCode_SUCCESS {
 		return result, nil
 	} else {
-		return result, errors.New(contractResultPayload.Message)
+		return result, errors.New(result.ContractResult.Message)
 	}
 }
 
@@ -0,0 +1,136 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package scheduler
+
+import (
+	"fmt"
+	"sync"
+
+	"chainmaker.org/chainmaker-go/utils"
+	commonpb "chainmaker.org/chainmaker/pb-go/v2/common"
+	"chainmaker.org/chainmaker/protocol/v2"
+)
+
+// blockGasFees the gas fees charged for the txs of the block being scheduled, which are credited to the proposer
+// once after all the txs are applied
+type blockGasFees struct {
+	mu   sync.Mutex
+	fees map[string]*utils.BigInteger
+}
+
+func newBlockGasFees() *blockGasFees {
+	return &blockGasFees{fees: make(map[string]*utils.BigInteger)}
+}
+
+// set records the fee of the last run of the tx, nil discards the fee of the previous run
+func (f *blockGasFees) set(txId string, fee *utils.BigInteger) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if fee == nil {
+		delete(f.fees, txId)
+		return
+	}
+	f.fees[txId] = fee
+}
+
+// total returns the sum of the fees of the txs
+func (f *blockGasFees) total(txs []*commonpb.Transaction) *utils.BigInteger {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	total := utils.NewZeroBigInteger()
+	for _, tx := range txs {
+		if fee, ok := f.fees[tx.Payload.TxId]; ok {
+			total.Add(fee)
+		}
+	}
+	return total
+}
+
+// blockWriteSnapshot the snapshot which takes the writes made for the whole block after all the txs are applied
+type blockWriteSnapshot interface {
+	// ApplyBlockWrite appends the write to the rw set of the tx, it replaces the write of the same key in the rw set
+	ApplyBlockWrite(txId string, txWrite *commonpb.TxWrite) error
+}
+
+// checkGasFee check whether the sender can pay the fee of the whole gas limit before running vm,
+// returns the gas price charged for the tx, 0 means no fee is charged.
+func (ts *TxScheduler) checkGasFee(tx *commonpb.Transaction, txSimContext protocol.TxSimContext) (uint64, error) {
+	gasPrice, err := utils.GetGasPrice(ts.chainConf.ChainConfig())
+	if err != nil || gasPrice == 0 {
+		return 0, err
+	}
+	gasLimit, err := utils.ParseTxGasLimit(tx.Payload.Limit)
+	if err != nil {
+		return 0, err
+	}
+	gasPrice = utils.TxGasPrice(tx, gasPrice)
+	if err = utils.CheckGasFee(txSimContext, utils.GasFee(gasLimit, gasPrice)); err != nil {
+		return 0, err
+	}
+	return gasPrice, nil
+}
+
+// chargeGasFee charge gasUsed * gasPrice from the sender before the rw set is applied.
+// The writes of the failed tx are reverted before charging, so that the tx which is out of gas is still charged.
+// If the contract spends the balance reserved for the fee, the tx fails and is reverted too.
+// The fee is credited to the proposer by creditGasFees.
+func (ts *TxScheduler) chargeGasFee(txSimContext TxSimContext, gasPrice uint64, result *commonpb.Result) error {
+	if gasPrice == 0 || result.ContractResult == nil || result.ContractResult.GasUsed == 0 {
+		return nil
+	}
+	gasUsed := result.ContractResult.GasUsed
+	if gasLimit := utils.TxGasLimit(txSimContext.GetTx()); gasUsed > gasLimit {
+		gasUsed = gasLimit
+	}
+	fee := utils.GasFee(gasUsed, gasPrice)
+	txId := txSimContext.GetTx().Payload.TxId
+
+	if result.Code == commonpb.TxStatusCode_SUCCESS {
+		err := utils.PayGasFee(txSimContext, fee)
+		if err == nil {
+			ts.gasFees.set(txId, fee)
+			return nil
+		}
+		result.Code = commonpb.TxStatusCode_CONTRACT_FAIL
+		result.ContractResult.Code = 1
+		result.ContractResult.Message = fmt.Sprintf("failed to charge gas fee, %s", err.Error())
+	}
+
+	if err := txSimContext.RevertWrites(); err != nil {
+		return err
+	}
+	if err := utils.PayGasFee(txSimContext, fee); err != nil {
+		return err
+	}
+	ts.gasFees.set(txId, fee)
+	return nil
+}
+
+// creditGasFees credit the gas fees of the txs of block to the proposer. The write is appended to the rw set of
+// the last tx of block, so that it is committed after the writes of all the txs, and the txs do not conflict on
+// the balance of the proposer.
+func (ts *TxScheduler) creditGasFees(block *commonpb.Block, snapshot protocol.Snapshot) error {
+	if len(block.Txs) == 0 {
+		return nil
+	}
+	fees := ts.gasFees.total(block.Txs)
+	if fees.Cmp(utils.NewZeroBigInteger()) <= 0 {
+		return nil
+	}
+	writer, ok := snapshot.(blockWriteSnapshot)
+	if !ok {
+		return fmt.Errorf("snapshot %T can not credit the gas fees of block", snapshot)
+	}
+	txWrite, err := utils.CreditGasFees(block.Header.Proposer, fees, func(contractName string, key []byte) (
+		[]byte, error) {
+		return snapshot.GetKey(-1, contractName, key)
+	})
+	if err != nil {
+		return fmt.Errorf("credit gas fees %s to the proposer error:%s", fees.String(), err)
+	}
+	return writer.ApplyBlockWrite(block.Txs[len(block.Txs)-1].Payload.TxId, txWrite)
+}
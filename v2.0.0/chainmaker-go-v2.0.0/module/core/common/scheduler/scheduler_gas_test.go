@@ -0,0 +1,299 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package scheduler
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"chainmaker.org/chainmaker-go/core/provider/conf"
+	"chainmaker.org/chainmaker-go/utils"
+	acpb "chainmaker.org/chainmaker/pb-go/v2/accesscontrol"
+	commonpb "chainmaker.org/chainmaker/pb-go/v2/common"
+	configpb "chainmaker.org/chainmaker/pb-go/v2/config"
+	"chainmaker.org/chainmaker/protocol/v2"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	gasTestSenderCert   = "-----BEGIN CERTIFICATE-----\nMIICijCCAi+gAwIBAgIDBS9vMAoGCCqGSM49BAMCMIGKMQswCQYDVQQGEwJDTjEQ\nMA4GA1UECBMHQmVpamluZzEQMA4GA1UEBxMHQmVpamluZzEfMB0GA1UEChMWd3gt\nb3JnMS5jaGFpbm1ha2VyLm9yZzESMBAGA1UECxMJcm9vdC1jZXJ0MSIwIAYDVQQD\nExljYS53eC1vcmcxLmNoYWlubWFrZXIub3JnMB4XDTIwMTIwODA2NTM0M1oXDTI1\nMTIwNzA2NTM0M1owgZExCzAJBgNVBAYTAkNOMRAwDgYDVQQIEwdCZWlqaW5nMRAw\nDgYDVQQHEwdCZWlqaW5nMR8wHQYDVQQKExZ3eC1vcmcxLmNoYWlubWFrZXIub3Jn\nMQ8wDQYDVQQLEwZjbGllbnQxLDAqBgNVBAMTI2NsaWVudDEuc2lnbi53eC1vcmcx\nLmNoYWlubWFrZXIub3JnMFkwEwYHKoZIzj0CAQYIKoZIzj0DAQcDQgAE56xayRx0\n/a8KEXPxRfiSzYgJ/sE4tVeI/ZbjpiUX9m0TCJX7W/VHdm6WeJLOdCDuLLNvjGTy\nt8LLyqyubJI5AKN7MHkwDgYDVR0PAQH/BAQDAgGmMA8GA1UdJQQIMAYGBFUdJQAw\nKQYDVR0OBCIEIMjAiM2eMzlQ9HzV9ePW69rfUiRZVT2pDBOMqM4WVJSAMCsGA1Ud\nIwQkMCKAIDUkP3EcubfENS6TH3DFczH5dAnC2eD73+wcUF/bEIlnMAoGCCqGSM49\nBAMCA0kAMEYCIQCWUHL0xisjQoW+o6VV12pBXIRJgdeUeAu2EIjptSg2GAIhAIxK\nLXpHIBFxIkmWlxUaanCojPSZhzEbd+8LRrmhEO8n\n-----END CERTIFICATE-----\n"
+	gasTestProposerCert = "-----BEGIN CERTIFICATE-----\nMIIChzCCAi2gAwIBAgIDAwGbMAoGCCqGSM49BAMCMIGKMQswCQYDVQQGEwJDTjEQ\nMA4GA1UECBMHQmVpamluZzEQMA4GA1UEBxMHQmVpamluZzEfMB0GA1UEChMWd3gt\nb3JnMS5jaGFpbm1ha2VyLm9yZzESMBAGA1UECxMJcm9vdC1jZXJ0MSIwIAYDVQQD\nExljYS53eC1vcmcxLmNoYWlubWFrZXIub3JnMB4XDTIwMTIwODA2NTM0M1oXDTI1\nMTIwNzA2NTM0M1owgY8xCzAJBgNVBAYTAkNOMRAwDgYDVQQIEwdCZWlqaW5nMRAw\nDgYDVQQHEwdCZWlqaW5nMR8wHQYDVQQKExZ3eC1vcmcxLmNoYWlubWFrZXIub3Jn\nMQ4wDAYDVQQLEwVhZG1pbjErMCkGA1UEAxMiYWRtaW4xLnNpZ24ud3gtb3JnMS5j\naGFpbm1ha2VyLm9yZzBZMBMGByqGSM49AgEGCCqGSM49AwEHA0IABORqoYNAw8ax\n9QOD94VaXq1dCHguarSKqAruEI39dRkm8Vu2gSHkeWlxzvSsVVqoN6ATObi2ZohY\nKYab2s+/QA2jezB5MA4GA1UdDwEB/wQEAwIBpjAPBgNVHSUECDAGBgRVHSUAMCkG\nA1UdDgQiBCDZOtAtHzfoZd/OQ2Jx5mIMgkqkMkH4SDvAt03yOrRnBzArBgNVHSME\nJDAigCA1JD9xHLm3xDUukx9wxXMx+XQJwtng+9/sHFBf2xCJZzAKBggqhkjOPQQD\nAgNIADBFAiEAiGjIB8Wb8mhI+ma4F3kCW/5QM6tlxiKIB5zTcO5E890CIBxWDICm\nAod1WZHJajgnDQ2zEcFF94aejR9dmGBB/P//\n-----END CERTIFICATE-----"
+
+	gasTestPrice    = 2
+	gasTestLimit    = 300
+	gasTestBalance  = 10000
+	gasTestContract = "gas_contract"
+)
+
+type gasTestStoreHelper struct {
+	conf.StoreHelper
+}
+
+// GetPoolCapacity runs the txs one by one, so that the fake snapshot applies them without conflicts
+func (h *gasTestStoreHelper) GetPoolCapacity() int {
+	return 1
+}
+
+// gasTestVmManager runs the tx as its method says, the contract writes a key in all the cases
+type gasTestVmManager struct {
+	protocol.VmManager
+	senderAddress string
+}
+
+func (m *gasTestVmManager) RunContract(contract *commonpb.Contract, method string, byteCode []byte,
+	parameters map[string][]byte, txContext protocol.TxSimContext, gasUsed uint64, refTxType commonpb.TxType) (
+	*commonpb.ContractResult, commonpb.TxStatusCode) {
+	if err := txContext.Put(gasTestContract, []byte(txContext.GetTx().Payload.TxId), []byte(method)); err != nil {
+		return &commonpb.ContractResult{Code: 1, Message: err.Error()}, commonpb.TxStatusCode_CONTRACT_FAIL
+	}
+	switch method {
+	case "fail":
+		return &commonpb.ContractResult{Code: 1, Message: "fail", GasUsed: 50}, commonpb.TxStatusCode_CONTRACT_FAIL
+	case "out_of_gas":
+		// the vm fails the tx which uses more gas than its limit
+		return &commonpb.ContractResult{Code: 1, Message: "out of gas", GasUsed: 1000},
+			commonpb.TxStatusCode_CONTRACT_FAIL
+	case "spend":
+		// the contract spends the balance reserved for the fee
+		err := txContext.Put(utils.GasFeeContractName, utils.GasFeeBalanceKey(m.senderAddress), []byte("0"))
+		if err != nil {
+			return &commonpb.ContractResult{Code: 1, Message: err.Error()}, commonpb.TxStatusCode_CONTRACT_FAIL
+		}
+	}
+	return &commonpb.ContractResult{GasUsed: 100}, commonpb.TxStatusCode_SUCCESS
+}
+
+// gasTestSnapshot applies the txs to the state in the order they run
+type gasTestSnapshot struct {
+	protocol.Snapshot
+	store    protocol.BlockchainStore
+	proposer *acpb.Member
+
+	mu      sync.Mutex
+	state   map[string][]byte
+	sealed  bool
+	txs     []*commonpb.Transaction
+	rwSets  []*commonpb.TxRWSet
+	results map[string]*commonpb.Result
+}
+
+func newGasTestSnapshot(state map[string][]byte) *gasTestSnapshot {
+	return &gasTestSnapshot{
+		store:    &sqlTestStore{},
+		proposer: &acpb.Member{MemberType: acpb.MemberType_CERT, MemberInfo: []byte(gasTestProposerCert)},
+		state:    state,
+		results:  make(map[string]*commonpb.Result),
+	}
+}
+
+func (s *gasTestSnapshot) GetBlockchainStore() protocol.BlockchainStore {
+	return s.store
+}
+
+func (s *gasTestSnapshot) GetSnapshotSize() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.txs)
+}
+
+func (s *gasTestSnapshot) GetBlockHeight() uint64 {
+	return 1
+}
+
+func (s *gasTestSnapshot) GetBlockProposer() *acpb.Member {
+	return s.proposer
+}
+
+func (s *gasTestSnapshot) GetKey(txExecSeq int, contractName string, key []byte) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state[contractName+"/"+string(key)], nil
+}
+
+func (s *gasTestSnapshot) ApplyTxSimContext(txSimContext protocol.TxSimContext, runVmSuccess bool) (bool, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tx := txSimContext.GetTx()
+	rwSet := txSimContext.GetTxRWSet(runVmSuccess)
+	for _, write := range rwSet.TxWrites {
+		s.state[write.ContractName+"/"+string(write.Key)] = write.Value
+	}
+	s.txs = append(s.txs, tx)
+	s.rwSets = append(s.rwSets, rwSet)
+	s.results[tx.Payload.TxId] = txSimContext.GetTxResult()
+	return true, len(s.txs)
+}
+
+func (s *gasTestSnapshot) ApplyBlockWrite(txId string, txWrite *commonpb.TxWrite) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, tx := range s.txs {
+		if tx.Payload.TxId == txId {
+			s.rwSets[i].TxWrites = append(s.rwSets[i].TxWrites, txWrite)
+			s.state[txWrite.ContractName+"/"+string(txWrite.Key)] = txWrite.Value
+			return nil
+		}
+	}
+	return fmt.Errorf("tx %s is not applied", txId)
+}
+
+func (s *gasTestSnapshot) IsSealed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sealed
+}
+
+func (s *gasTestSnapshot) Seal() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sealed = true
+}
+
+// BuildDAG the txs depend on the previous ones, so they are simulated in the same order
+func (s *gasTestSnapshot) BuildDAG(isSql bool) *commonpb.DAG {
+	dag := &commonpb.DAG{}
+	for i := range s.txs {
+		vertex := &commonpb.DAG_Neighbor{}
+		if i > 0 {
+			vertex.Neighbors = []uint32{uint32(i - 1)}
+		}
+		dag.Vertexes = append(dag.Vertexes, vertex)
+	}
+	return dag
+}
+
+func (s *gasTestSnapshot) GetTxTable() []*commonpb.Transaction {
+	return s.txs
+}
+
+func (s *gasTestSnapshot) GetTxRWSetTable() []*commonpb.TxRWSet {
+	return s.rwSets
+}
+
+func (s *gasTestSnapshot) GetTxResultMap() map[string]*commonpb.Result {
+	return s.results
+}
+
+func newGasTestScheduler(t *testing.T) (*TxScheduler, map[string][]byte, string, string) {
+	senderAddress, err := utils.CertAddress([]byte(gasTestSenderCert))
+	require.NoError(t, err)
+	proposerAddress, err := utils.CertAddress([]byte(gasTestProposerCert))
+	require.NoError(t, err)
+	chainConf := &sqlTestChainConf{config: &configpb.ChainConfig{
+		ChainId:  "chain1",
+		Contract: &configpb.ContractConfig{},
+		Consensus: &configpb.ConsensusConfig{ExtConfig: []*configpb.ConfigKeyValue{
+			{Key: utils.GasPriceConfigKey, Value: fmt.Sprintf("%d", gasTestPrice)},
+		}},
+	}}
+	scheduler := newTxScheduler(&gasTestVmManager{senderAddress: senderAddress}, chainConf, &gasTestStoreHelper{})
+	state := map[string][]byte{
+		utils.GasFeeContractName + "/" + string(utils.GasFeeBalanceKey(senderAddress)): []byte(
+			fmt.Sprintf("%d", gasTestBalance)),
+	}
+	return scheduler, state, senderAddress, proposerAddress
+}
+
+func newGasTestBlock(methods ...string) *commonpb.Block {
+	block := &commonpb.Block{Header: &commonpb.BlockHeader{
+		ChainId:     "chain1",
+		BlockHeight: 1,
+		Proposer:    &acpb.Member{MemberType: acpb.MemberType_CERT, MemberInfo: []byte(gasTestProposerCert)},
+	}}
+	for i, method := range methods {
+		block.Txs = append(block.Txs, &commonpb.Transaction{
+			Payload: &commonpb.Payload{
+				ChainId:      "chain1",
+				TxId:         fmt.Sprintf("tx-%d", i),
+				TxType:       commonpb.TxType_INVOKE_CONTRACT,
+				ContractName: gasTestContract,
+				Method:       method,
+				Limit:        utils.NewTxGasLimit(gasTestLimit),
+			},
+			Sender: &commonpb.EndorsementEntry{Signer: &acpb.Member{
+				MemberType: acpb.MemberType_CERT,
+				MemberInfo: []byte(gasTestSenderCert),
+			}},
+		})
+	}
+	return block
+}
+
+func gasTestBalanceOf(state map[string][]byte, address string) string {
+	return string(state[utils.GasFeeContractName+"/"+string(utils.GasFeeBalanceKey(address))])
+}
+
+func TestTxScheduler_ChargeGasFee(t *testing.T) {
+	tests := []struct {
+		method string
+		code   commonpb.TxStatusCode
+		fee    int
+	}{
+		{"ok", commonpb.TxStatusCode_SUCCESS, 100 * gasTestPrice},
+		// the writes of the failed tx are reverted, the gas used is still charged
+		{"fail", commonpb.TxStatusCode_CONTRACT_FAIL, 50 * gasTestPrice},
+		// the tx out of gas is charged for its gas limit
+		{"out_of_gas", commonpb.TxStatusCode_CONTRACT_FAIL, gasTestLimit * gasTestPrice},
+		// the tx fails as the fee can not be charged, it is charged from the balance before it runs
+		{"spend", commonpb.TxStatusCode_CONTRACT_FAIL, 100 * gasTestPrice},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			scheduler, state, sender, proposer := newGasTestScheduler(t)
+			block := newGasTestBlock(tt.method)
+			snapshot := newGasTestSnapshot(state)
+
+			_, _, err := scheduler.Schedule(block, block.Txs, snapshot)
+			require.NoError(t, err)
+			require.Len(t, block.Txs, 1)
+			require.Equal(t, tt.code, snapshot.GetTxResultMap()[block.Txs[0].Payload.TxId].Code)
+			written := state[gasTestContract+"/"+block.Txs[0].Payload.TxId]
+			if tt.code == commonpb.TxStatusCode_SUCCESS {
+				require.Equal(t, []byte(tt.method), written)
+			} else {
+				require.Nil(t, written)
+			}
+			require.Equal(t, fmt.Sprintf("%d", gasTestBalance-tt.fee), gasTestBalanceOf(state, sender))
+			require.Equal(t, fmt.Sprintf("%d", tt.fee), gasTestBalanceOf(state, proposer))
+		})
+	}
+}
+
+func TestTxScheduler_CreditGasFeesOnce(t *testing.T) {
+	scheduler, state, sender, proposer := newGasTestScheduler(t)
+	block := newGasTestBlock("ok", "fail", "out_of_gas", "ok")
+	snapshot := newGasTestSnapshot(state)
+
+	txRWSetMap, _, err := scheduler.Schedule(block, block.Txs, snapshot)
+	require.NoError(t, err)
+	require.Len(t, block.Txs, 4)
+	fees := (100 + 50 + gasTestLimit + 100) * gasTestPrice
+	require.Equal(t, fmt.Sprintf("%d", gasTestBalance-fees), gasTestBalanceOf(state, sender))
+	require.Equal(t, fmt.Sprintf("%d", fees), gasTestBalanceOf(state, proposer))
+
+	// the proposer is credited once in the rw set of the last tx
+	proposerKey := string(utils.GasFeeBalanceKey(proposer))
+	credits := make(map[string]int)
+	for txId, rwSet := range txRWSetMap {
+		for _, write := range rwSet.TxWrites {
+			if string(write.Key) == proposerKey {
+				credits[txId]++
+			}
+		}
+	}
+	require.Equal(t, map[string]int{block.Txs[3].Payload.TxId: 1}, credits)
+
+	// the verifier credits the same fees
+	_, verifierState, _, _ := newGasTestScheduler(t)
+	verifierSnapshot := newGasTestSnapshot(verifierState)
+	verifierRWSetMap, _, err := newTxScheduler(scheduler.VmManager, scheduler.chainConf, &gasTestStoreHelper{}).
+		SimulateWithDag(block, verifierSnapshot)
+	require.NoError(t, err)
+	require.Equal(t, txRWSetMap, verifierRWSetMap)
+	require.Equal(t, state, verifierState)
+}
@@ -0,0 +1,130 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package scheduler
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"chainmaker.org/chainmaker-go/utils"
+	commonpb "chainmaker.org/chainmaker/pb-go/v2/common"
+	"chainmaker.org/chainmaker/protocol/v2"
+)
+
+// runTx run the tx in vm, the nonce of the sender is consumed whether the tx succeeds or not
+func (ts *TxScheduler) runTx(tx *commonpb.Transaction, txSimContext TxSimContext) (*commonpb.Result, error) {
+	nonceKey, err := ts.checkTxNonce(tx, txSimContext)
+	if err != nil {
+		ts.log.Warnf("check nonce of tx[%s] error:%s", tx.Payload.TxId, err)
+		return errResult(&commonpb.Result{ContractResult: &commonpb.ContractResult{}}, err)
+	}
+	result, err := ts.runVM(tx, txSimContext)
+	if nonceKey == nil {
+		return result, err
+	}
+	if nonceErr := ts.consumeTxNonce(tx, txSimContext, nonceKey, result); nonceErr != nil {
+		ts.log.Errorf("consume nonce of tx[%s] error:%s", tx.Payload.TxId, nonceErr)
+		result.Code = commonpb.TxStatusCode_INTERNAL_ERROR
+		return result, nonceErr
+	}
+	return result, err
+}
+
+// checkTxNonce check the nonce of tx is the next nonce of the sender, returns the key of the nonce in state,
+// it is nil if the tx does not use the nonce.
+func (ts *TxScheduler) checkTxNonce(tx *commonpb.Transaction, txSimContext protocol.TxSimContext) ([]byte, error) {
+	chainConfig := ts.chainConf.ChainConfig()
+	if !utils.IsTxNonceEnabled(chainConfig) || !utils.IsNonceTx(tx) {
+		return nil, nil
+	}
+	account, err := utils.TxNonceAccount(tx, chainConfig.Crypto.Hash)
+	if err != nil {
+		return nil, err
+	}
+	key := utils.TxNonceKey(account)
+	value, err := txSimContext.Get(utils.TxNonceContractName, key)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := utils.DecodeTxNonce(value)
+	if err != nil {
+		return nil, err
+	}
+	if err = utils.CheckTxNonce(tx, nonce); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// consumeTxNonce write the nonce of tx to state. The writes of the failed tx are reverted first,
+// so that the nonce is kept in the rw set of the failed tx.
+func (ts *TxScheduler) consumeTxNonce(tx *commonpb.Transaction, txSimContext TxSimContext, key []byte,
+	result *commonpb.Result) error {
+	if result.Code != commonpb.TxStatusCode_SUCCESS && !txSimContext.IsReverted() {
+		if err := txSimContext.RevertWrites(); err != nil {
+			return err
+		}
+	}
+	return txSimContext.Put(utils.TxNonceContractName, key, utils.EncodeTxNonce(tx.Payload.Sequence))
+}
+
+// isTxNonceWaiting whether the tx waits for the tx of the lower nonce of the same sender in the block
+func (ts *TxScheduler) isTxNonceWaiting(tx *commonpb.Transaction, snapshot protocol.Snapshot) bool {
+	chainConfig := ts.chainConf.ChainConfig()
+	if !utils.IsTxNonceEnabled(chainConfig) || !utils.IsNonceTx(tx) {
+		return false
+	}
+	account, err := utils.TxNonceAccount(tx, chainConfig.Crypto.Hash)
+	if err != nil {
+		return false
+	}
+	value, err := snapshot.GetKey(-1, utils.TxNonceContractName, utils.TxNonceKey(account))
+	if err != nil {
+		return false
+	}
+	nonce, err := utils.DecodeTxNonce(value)
+	return err == nil && errors.Is(utils.CheckTxNonce(tx, nonce), utils.ErrTxNonceGap)
+}
+
+const (
+	// txNonceMinBackoff the delay before a waiting tx is scheduled again the first time, it doubles on each wait
+	txNonceMinBackoff = time.Millisecond
+	// txNonceMaxBackoff the max delay before a waiting tx is scheduled again
+	txNonceMaxBackoff = 50 * time.Millisecond
+)
+
+// txNonceBackoff delays the txs waiting for the txs of the lower nonces, so that they do not spin in the
+// running queue of the scheduler
+type txNonceBackoff struct {
+	mu    sync.Mutex
+	waits map[string]uint
+}
+
+func newTxNonceBackoff() *txNonceBackoff {
+	return &txNonceBackoff{waits: make(map[string]uint)}
+}
+
+// delay returns the delay of the next wait of the tx
+func (b *txNonceBackoff) delay(txId string) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	waits := b.waits[txId]
+	b.waits[txId] = waits + 1
+	delay := txNonceMinBackoff << waits
+	if delay <= 0 || delay > txNonceMaxBackoff {
+		return txNonceMaxBackoff
+	}
+	return delay
+}
+
+// requeue puts the waiting tx back to the running queue after its delay, without holding the routine of the pool
+func (b *txNonceBackoff) requeue(tx *commonpb.Transaction, runningTxC chan<- *commonpb.Transaction) {
+	time.AfterFunc(b.delay(tx.Payload.TxId), func() {
+		runningTxC <- tx
+	})
+}
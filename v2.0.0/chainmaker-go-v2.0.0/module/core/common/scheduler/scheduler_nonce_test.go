@@ -0,0 +1,122 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package scheduler
+
+import (
+	"fmt"
+	"testing"
+
+	"chainmaker.org/chainmaker-go/utils"
+	acpb "chainmaker.org/chainmaker/pb-go/v2/accesscontrol"
+	commonpb "chainmaker.org/chainmaker/pb-go/v2/common"
+	configpb "chainmaker.org/chainmaker/pb-go/v2/config"
+	"github.com/stretchr/testify/require"
+)
+
+func newNonceTestScheduler() *TxScheduler {
+	chainConf := &sqlTestChainConf{config: &configpb.ChainConfig{
+		ChainId:  "chain1",
+		Contract: &configpb.ContractConfig{},
+		Crypto:   &configpb.CryptoConfig{Hash: "SHA256"},
+		Consensus: &configpb.ConsensusConfig{ExtConfig: []*configpb.ConfigKeyValue{
+			{Key: utils.TxNonceConfigKey, Value: "true"},
+		}},
+	}}
+	// the txs run in parallel, so that the txs of the higher nonces wait for the lower ones
+	return newTxScheduler(&gasTestVmManager{}, chainConf, &sqlTestStoreHelper{})
+}
+
+func newNonceTestTx(member string, nonce uint64, method string) *commonpb.Transaction {
+	return &commonpb.Transaction{
+		Payload: &commonpb.Payload{
+			ChainId:      "chain1",
+			TxId:         fmt.Sprintf("%s-%d", member, nonce),
+			TxType:       commonpb.TxType_INVOKE_CONTRACT,
+			ContractName: gasTestContract,
+			Method:       method,
+			Sequence:     nonce,
+		},
+		Sender: &commonpb.EndorsementEntry{Signer: &acpb.Member{
+			OrgId:      "org1",
+			MemberType: acpb.MemberType_PUBLIC_KEY,
+			MemberInfo: []byte(member),
+		}},
+	}
+}
+
+func nonceTestKey(t *testing.T, member string) string {
+	account, err := utils.TxNonceAccount(newNonceTestTx(member, 0, ""), "SHA256")
+	require.NoError(t, err)
+	return utils.TxNonceContractName + "/" + string(utils.TxNonceKey(account))
+}
+
+func TestTxScheduler_ScheduleTxNonce(t *testing.T) {
+	block := newGasTestBlock()
+	block.Txs = []*commonpb.Transaction{
+		newNonceTestTx("user1", 3, "ok"),
+		newNonceTestTx("user1", 1, "ok"),
+		newNonceTestTx("user2", 1, "ok"),
+		newNonceTestTx("user1", 2, "fail"),
+	}
+	state := map[string][]byte{}
+	snapshot := newGasTestSnapshot(state)
+
+	txRWSetMap, _, err := newNonceTestScheduler().Schedule(block, block.Txs, snapshot)
+	require.NoError(t, err)
+	require.Len(t, block.Txs, 4)
+
+	// the txs of a sender are applied in the order of their nonces
+	var user1Nonces []uint64
+	for _, tx := range block.Txs {
+		if string(tx.Sender.Signer.MemberInfo) == "user1" {
+			user1Nonces = append(user1Nonces, tx.Payload.Sequence)
+		}
+	}
+	require.Equal(t, []uint64{1, 2, 3}, user1Nonces)
+	require.Equal(t, utils.EncodeTxNonce(3), state[nonceTestKey(t, "user1")])
+	require.Equal(t, utils.EncodeTxNonce(1), state[nonceTestKey(t, "user2")])
+
+	// the failed tx consumes its nonce, the other writes are reverted
+	failedTxId := "user1-2"
+	require.Equal(t, commonpb.TxStatusCode_CONTRACT_FAIL, snapshot.GetTxResultMap()[failedTxId].Code)
+	require.Nil(t, state[gasTestContract+"/"+failedTxId])
+	require.Len(t, txRWSetMap[failedTxId].TxWrites, 1)
+	require.Equal(t, utils.EncodeTxNonce(2), txRWSetMap[failedTxId].TxWrites[0].Value)
+
+	// the verifier simulates the block to the same rw sets
+	verifierState := map[string][]byte{}
+	verifierRWSetMap, _, err := newNonceTestScheduler().SimulateWithDag(block, newGasTestSnapshot(verifierState))
+	require.NoError(t, err)
+	require.Equal(t, txRWSetMap, verifierRWSetMap)
+	require.Equal(t, state, verifierState)
+}
+
+func TestTxScheduler_SimulateTxNonceUsed(t *testing.T) {
+	block := newGasTestBlock()
+	block.Txs = []*commonpb.Transaction{newNonceTestTx("user1", 1, "ok")}
+	block.Dag = &commonpb.DAG{Vertexes: []*commonpb.DAG_Neighbor{{}}}
+	state := map[string][]byte{nonceTestKey(t, "user1"): utils.EncodeTxNonce(1)}
+
+	txRWSetMap, results, err := newNonceTestScheduler().SimulateWithDag(block, newGasTestSnapshot(state))
+	require.NoError(t, err)
+	// the tx of the used nonce fails without running the contract or writing the nonce
+	require.Equal(t, commonpb.TxStatusCode_INVALID_PARAMETER, results["user1-1"].Code)
+	require.Empty(t, txRWSetMap["user1-1"].TxWrites)
+	require.Equal(t, utils.EncodeTxNonce(1), state[nonceTestKey(t, "user1")])
+	require.Nil(t, state[gasTestContract+"/user1-1"])
+}
+
+func TestTxNonceBackoff(t *testing.T) {
+	backoff := newTxNonceBackoff()
+	require.Equal(t, txNonceMinBackoff, backoff.delay("tx1"))
+	require.Equal(t, 2*txNonceMinBackoff, backoff.delay("tx1"))
+	require.Equal(t, txNonceMinBackoff, backoff.delay("tx2"))
+	for i := 0; i < 100; i++ {
+		require.LessOrEqual(t, int64(backoff.delay("tx1")), int64(txNonceMaxBackoff))
+	}
+	require.Equal(t, txNonceMaxBackoff, backoff.delay("tx1"))
+}
@@ -0,0 +1,64 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package scheduler
+
+import (
+	commonpb "chainmaker.org/chainmaker/pb-go/v2/common"
+	"chainmaker.org/chainmaker/pb-go/v2/syscontract"
+	"chainmaker.org/chainmaker/protocol/v2"
+)
+
+// sqlTxSavePointPrefix the prefix of the savepoint of tx set by the scheduler, the vm sets its own savepoint
+// named by the tx id for each contract invocation
+const sqlTxSavePointPrefix = "tx_"
+
+// runInSqlSavePoint runs and applies the tx by runAndApply, which returns whether the tx is applied to the snapshot.
+// The tx which may execute sql is run in its own savepoint of the db transaction of block, and its sql is rolled
+// back to the savepoint if it is not applied, e.g. it conflicts with the txs applied concurrently and runs again,
+// so that every tx applied keeps the sql of its last run only.
+// All the sql of block is executed in the one db transaction, whose savepoints are a stack: rolling back to the
+// savepoint of a tx, here or by the vm for the failed contract, discards the sql of every tx run after it. So the
+// txs which may execute sql run one by one even if they use different tables and are independent in the dag, only
+// the other txs run concurrently with them.
+func (ts *TxScheduler) runInSqlSavePoint(block *commonpb.Block, tx *commonpb.Transaction, snapshot protocol.Snapshot,
+	runAndApply func() bool) {
+	if !ts.chainConf.ChainConfig().Contract.EnableSqlSupport || !mayExecuteSql(tx) {
+		runAndApply()
+		return
+	}
+
+	ts.sqlTxLock.Lock()
+	defer ts.sqlTxLock.Unlock()
+	savePoint := sqlTxSavePointPrefix + tx.Payload.TxId
+	dbTransaction, err := snapshot.GetBlockchainStore().GetDbTransaction(block.GetTxKey())
+	if err == nil {
+		err = dbTransaction.BeginDbSavePoint(savePoint)
+	}
+	if err != nil {
+		// the vm fails the tx since the db transaction is not available either
+		ts.log.Errorf("failed to begin the db savepoint of tx[%s], %s", tx.Payload.TxId, err)
+		runAndApply()
+		return
+	}
+	if runAndApply() {
+		return
+	}
+	if err = dbTransaction.RollbackDbSavePoint(savePoint); err != nil {
+		ts.log.Errorf("failed to rollback the db savepoint of tx[%s], %s", tx.Payload.TxId, err)
+	}
+}
+
+// mayExecuteSql returns whether the tx may execute sql in the db transaction of block, the user contracts and the
+// system contracts calling user contracts do.
+func mayExecuteSql(tx *commonpb.Transaction) bool {
+	contractName := tx.Payload.ContractName
+	if _, ok := syscontract.SystemContract_value[contractName]; !ok {
+		return true
+	}
+	return contractName == syscontract.SystemContract_CONTRACT_MANAGE.String() ||
+		contractName == syscontract.SystemContract_MULTI_SIGN.String()
+}
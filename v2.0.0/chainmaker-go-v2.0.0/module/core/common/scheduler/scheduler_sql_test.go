@@ -0,0 +1,300 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package scheduler
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"chainmaker.org/chainmaker-go/core/provider/conf"
+	"chainmaker.org/chainmaker-go/localconf"
+	"chainmaker.org/chainmaker-go/store/dbprovider/rawsqlprovider"
+	acpb "chainmaker.org/chainmaker/pb-go/v2/accesscontrol"
+	commonpb "chainmaker.org/chainmaker/pb-go/v2/common"
+	configpb "chainmaker.org/chainmaker/pb-go/v2/config"
+	"chainmaker.org/chainmaker/pb-go/v2/syscontract"
+	"chainmaker.org/chainmaker/protocol/v2"
+	"chainmaker.org/chainmaker/protocol/v2/test"
+	"github.com/stretchr/testify/require"
+)
+
+const sqlTestTxCount = 30
+
+type sqlTestChainConf struct {
+	protocol.ChainConf
+	config *configpb.ChainConfig
+}
+
+func (c *sqlTestChainConf) ChainConfig() *configpb.ChainConfig {
+	return c.config
+}
+
+type sqlTestStoreHelper struct {
+	conf.StoreHelper
+}
+
+func (h *sqlTestStoreHelper) GetPoolCapacity() int {
+	return 8
+}
+
+// sqlTestStore serves the db transactions of block from a real sqlite db
+type sqlTestStore struct {
+	protocol.BlockchainStore
+	db protocol.SqlDBHandle
+}
+
+func (s *sqlTestStore) GetDbTransaction(txName string) (protocol.SqlDBTransaction, error) {
+	return s.db.GetDbTransaction(txName)
+}
+
+func (s *sqlTestStore) GetContractByName(name string) (*commonpb.Contract, error) {
+	if _, ok := syscontract.SystemContract_value[name]; ok {
+		return &commonpb.Contract{Name: name, RuntimeType: commonpb.RuntimeType_NATIVE}, nil
+	}
+	return &commonpb.Contract{Name: name, RuntimeType: commonpb.RuntimeType_WASMER}, nil
+}
+
+func (s *sqlTestStore) GetContractBytecode(name string) ([]byte, error) {
+	return []byte(name), nil
+}
+
+// sqlTestVmManager the user contract counts the txs and records the tx id in sql, the system contracts do nothing.
+// It records the max number of the user contracts running at the same time.
+type sqlTestVmManager struct {
+	protocol.VmManager
+	txKey string
+
+	running    int32
+	maxRunning int32
+}
+
+func (m *sqlTestVmManager) RunContract(contract *commonpb.Contract, method string, byteCode []byte,
+	parameters map[string][]byte, txContext protocol.TxSimContext, gasUsed uint64, refTxType commonpb.TxType) (
+	*commonpb.ContractResult, commonpb.TxStatusCode) {
+	result := &commonpb.ContractResult{}
+	if contract.RuntimeType == commonpb.RuntimeType_NATIVE {
+		return result, commonpb.TxStatusCode_SUCCESS
+	}
+	running := atomic.AddInt32(&m.running, 1)
+	defer atomic.AddInt32(&m.running, -1)
+	for {
+		maxRunning := atomic.LoadInt32(&m.maxRunning)
+		if running <= maxRunning || atomic.CompareAndSwapInt32(&m.maxRunning, maxRunning, running) {
+			break
+		}
+	}
+	// leave the other txs the time to overlap
+	time.Sleep(time.Millisecond)
+	fail := func(err error) (*commonpb.ContractResult, commonpb.TxStatusCode) {
+		result.Code = 1
+		result.Message = err.Error()
+		return result, commonpb.TxStatusCode_CONTRACT_FAIL
+	}
+	dbTransaction, err := txContext.GetBlockchainStore().GetDbTransaction(m.txKey)
+	if err != nil {
+		return fail(err)
+	}
+	if _, err = dbTransaction.ExecSql("update counter set n = n + 1 where id = 1"); err != nil {
+		return fail(err)
+	}
+	// the rerun of the tx fails by the primary key if the sql of the discarded run is not rolled back
+	if _, err = dbTransaction.ExecSql("insert into tx_log(tx_id) values(?)", txContext.GetTx().Payload.TxId); err != nil {
+		return fail(err)
+	}
+	return result, commonpb.TxStatusCode_SUCCESS
+}
+
+// sqlTestSnapshot rejects the first applies of some txs as if they conflict with the txs applied concurrently
+type sqlTestSnapshot struct {
+	protocol.Snapshot
+	store protocol.BlockchainStore
+
+	mu        sync.Mutex
+	conflicts map[string]int
+	sealed    bool
+	txs       []*commonpb.Transaction
+	results   map[string]*commonpb.Result
+}
+
+func newSqlTestSnapshot(store protocol.BlockchainStore, conflicts map[string]int) *sqlTestSnapshot {
+	return &sqlTestSnapshot{
+		store:     store,
+		conflicts: conflicts,
+		results:   make(map[string]*commonpb.Result),
+	}
+}
+
+func (s *sqlTestSnapshot) GetBlockchainStore() protocol.BlockchainStore {
+	return s.store
+}
+
+func (s *sqlTestSnapshot) GetSnapshotSize() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.txs)
+}
+
+func (s *sqlTestSnapshot) GetBlockHeight() uint64 {
+	return 1
+}
+
+func (s *sqlTestSnapshot) GetBlockProposer() *acpb.Member {
+	return &acpb.Member{MemberInfo: []byte("proposer")}
+}
+
+func (s *sqlTestSnapshot) ApplyTxSimContext(txSimContext protocol.TxSimContext, runVmSuccess bool) (bool, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tx := txSimContext.GetTx()
+	if s.conflicts[tx.Payload.TxId] > 0 {
+		s.conflicts[tx.Payload.TxId]--
+		return false, len(s.txs)
+	}
+	s.txs = append(s.txs, tx)
+	s.results[tx.Payload.TxId] = txSimContext.GetTxResult()
+	return true, len(s.txs)
+}
+
+func (s *sqlTestSnapshot) IsSealed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sealed
+}
+
+func (s *sqlTestSnapshot) Seal() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sealed = true
+}
+
+func (s *sqlTestSnapshot) BuildDAG(isSql bool) *commonpb.DAG {
+	dag := &commonpb.DAG{}
+	for range s.txs {
+		dag.Vertexes = append(dag.Vertexes, &commonpb.DAG_Neighbor{})
+	}
+	return dag
+}
+
+func (s *sqlTestSnapshot) GetTxTable() []*commonpb.Transaction {
+	return s.txs
+}
+
+func (s *sqlTestSnapshot) GetTxRWSetTable() []*commonpb.TxRWSet {
+	return nil
+}
+
+func (s *sqlTestSnapshot) GetTxResultMap() map[string]*commonpb.Result {
+	return s.results
+}
+
+// newSqlTestScheduler returns the scheduler of a sql chain and the sqlite db, in which the db transaction of
+// the block is begun
+func newSqlTestScheduler(t *testing.T, block *commonpb.Block) (*TxScheduler, protocol.SqlDBHandle) {
+	db := rawsqlprovider.NewSqlDBHandle("chain1", &localconf.SqlDbConfig{
+		Dsn:       t.TempDir(),
+		SqlDbType: "sqlite",
+	}, &test.GoLogger{})
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+	_, err := db.ExecSql("create table counter(id int primary key, n int)")
+	require.NoError(t, err)
+	_, err = db.ExecSql("insert into counter(id, n) values(1, 0)")
+	require.NoError(t, err)
+	_, err = db.ExecSql("create table tx_log(tx_id varchar(128) primary key)")
+	require.NoError(t, err)
+	_, err = db.BeginDbTransaction(block.GetTxKey())
+	require.NoError(t, err)
+
+	chainConf := &sqlTestChainConf{config: &configpb.ChainConfig{
+		ChainId:  "chain1",
+		Contract: &configpb.ContractConfig{EnableSqlSupport: true},
+	}}
+	vmManager := &sqlTestVmManager{txKey: block.GetTxKey()}
+	return newTxScheduler(vmManager, chainConf, &sqlTestStoreHelper{}), db
+}
+
+func newSqlTestBlock() (*commonpb.Block, map[string]int) {
+	block := &commonpb.Block{Header: &commonpb.BlockHeader{
+		ChainId:     "chain1",
+		BlockHeight: 1,
+		Proposer:    &acpb.Member{MemberInfo: []byte("proposer")},
+	}}
+	conflicts := make(map[string]int)
+	for i := 0; i < sqlTestTxCount; i++ {
+		contractName := "sql_contract"
+		if i%5 == 4 {
+			contractName = syscontract.SystemContract_CHAIN_QUERY.String()
+		}
+		tx := &commonpb.Transaction{Payload: &commonpb.Payload{
+			ChainId:      "chain1",
+			TxId:         fmt.Sprintf("tx-%d", i),
+			TxType:       commonpb.TxType_INVOKE_CONTRACT,
+			ContractName: contractName,
+			Method:       "invoke",
+		}}
+		block.Txs = append(block.Txs, tx)
+		if i%3 == 0 {
+			conflicts[tx.Payload.TxId] = 2
+		}
+	}
+	return block, conflicts
+}
+
+// requireSqlState requires the sql state is the one of running the sql txs serially once. The sql txs share the
+// db transaction of block, they never overlap though they are independent in the dag
+func requireSqlState(t *testing.T, scheduler *TxScheduler, db protocol.SqlDBHandle, block *commonpb.Block,
+	results map[string]*commonpb.Result) {
+	require.EqualValues(t, 1, atomic.LoadInt32(&scheduler.VmManager.(*sqlTestVmManager).maxRunning))
+	require.NoError(t, db.CommitDbTransaction(block.GetTxKey()))
+	sqlTxs := 0
+	for _, tx := range block.Txs {
+		require.EqualValues(t, commonpb.TxStatusCode_SUCCESS, results[tx.Payload.TxId].Code,
+			results[tx.Payload.TxId].ContractResult.Message)
+		if mayExecuteSql(tx) {
+			sqlTxs++
+		}
+	}
+	var n, logs int
+	row, err := db.QuerySingle("select n from counter where id = 1")
+	require.NoError(t, err)
+	require.NoError(t, row.ScanColumns(&n))
+	row, err = db.QuerySingle("select count(*) from tx_log")
+	require.NoError(t, err)
+	require.NoError(t, row.ScanColumns(&logs))
+	require.Equal(t, sqlTxs, n)
+	require.Equal(t, sqlTxs, logs)
+}
+
+func TestTxScheduler_ScheduleSql(t *testing.T) {
+	block, conflicts := newSqlTestBlock()
+	scheduler, db := newSqlTestScheduler(t, block)
+	snapshot := newSqlTestSnapshot(&sqlTestStore{db: db}, conflicts)
+
+	_, _, err := scheduler.Schedule(block, block.Txs, snapshot)
+	require.NoError(t, err)
+	require.Len(t, block.Txs, sqlTestTxCount)
+	requireSqlState(t, scheduler, db, block, snapshot.GetTxResultMap())
+}
+
+func TestTxScheduler_SimulateSqlWithDag(t *testing.T) {
+	block, conflicts := newSqlTestBlock()
+	block.Dag = &commonpb.DAG{}
+	for range block.Txs {
+		block.Dag.Vertexes = append(block.Dag.Vertexes, &commonpb.DAG_Neighbor{})
+	}
+	scheduler, db := newSqlTestScheduler(t, block)
+	snapshot := newSqlTestSnapshot(&sqlTestStore{db: db}, conflicts)
+
+	_, results, err := scheduler.SimulateWithDag(block, snapshot)
+	require.NoError(t, err)
+	require.Len(t, results, sqlTestTxCount)
+	requireSqlState(t, scheduler, db, block, results)
+}
@@ -11,11 +11,23 @@ import (
 	"fmt"
 	"sort"
 
+	"chainmaker.org/chainmaker-go/utils"
 	acpb "chainmaker.org/chainmaker/pb-go/v2/accesscontrol"
 	commonpb "chainmaker.org/chainmaker/pb-go/v2/common"
 	"chainmaker.org/chainmaker/protocol/v2"
 )
 
+// TxSimContext the protocol.TxSimContext the scheduler runs the txs in, the writes of the failed tx can be
+// reverted, so that the writes made to charge the tx are committed alone
+type TxSimContext interface {
+	protocol.TxSimContext
+	// RevertWrites discards the writes of the tx except ddl sql, the writes made after it are kept in the rw set
+	// even if the tx fails
+	RevertWrites() error
+	// IsReverted returns whether the writes of the tx are reverted
+	IsReverted() bool
+}
+
 // Storage interface for smart contracts
 type txSimContextImpl struct {
 	txExecSeq        int
@@ -24,6 +36,7 @@ type txSimContextImpl struct {
 	tx               *commonpb.Transaction
 	txReadKeyMap     map[string]*commonpb.TxRead
 	txWriteKeyMap    map[string]*commonpb.TxWrite
+	txReadKeySql     []*commonpb.TxRead // record dql, they are used to build the dag of sql txs
 	txWriteKeySql    []*commonpb.TxWrite
 	txWriteKeyDdlSql []*commonpb.TxWrite // record ddl vm run success or failure
 	snapshot         protocol.Snapshot
@@ -35,6 +48,7 @@ type txSimContextImpl struct {
 	sqlRowCache      map[int32]protocol.SqlRows
 	kvRowCache       map[int32]protocol.StateIterator
 	blockVersion     uint32
+	reverted         bool // reverted is true if the writes of vm are discarded, see RevertWrites
 }
 
 type callContractResult struct {
@@ -73,6 +87,14 @@ func (s *txSimContextImpl) Put(contractName string, key []byte, value []byte) er
 }
 
 func (s *txSimContextImpl) PutRecord(contractName string, value []byte, sqlType protocol.SqlType) {
+	if sqlType == protocol.SqlTypeDql {
+		s.txReadKeySql = append(s.txReadKeySql, &commonpb.TxRead{
+			Key:          nil,
+			Value:        value,
+			ContractName: contractName,
+		})
+		return
+	}
 	txWrite := &commonpb.TxWrite{
 		Key:          nil,
 		Value:        value,
@@ -185,10 +207,12 @@ func (s *txSimContextImpl) GetTxRWSet(runVmSuccess bool) *commonpb.TxRWSet {
 		for _, k := range txIds {
 			s.txRWSet.TxReads = append(s.txRWSet.TxReads, s.txReadKeyMap[k])
 		}
+		// sql nil key tx reads
+		s.txRWSet.TxReads = append(s.txRWSet.TxReads, s.txReadKeySql...)
 	}
 
 	// write set
-	if runVmSuccess {
+	if runVmSuccess || s.reverted {
 		txIds := make([]string, 0, len(s.txWriteKeyMap))
 		for txId := range s.txWriteKeyMap {
 			txIds = append(txIds, txId)
@@ -206,6 +230,30 @@ func (s *txSimContextImpl) GetTxRWSet(runVmSuccess bool) *commonpb.TxRWSet {
 	return s.txRWSet
 }
 
+// RevertWrites discard the writes of the failed tx except ddl sql, the reads of the discarded keys are reloaded
+// from snapshot. The writes made after reverting are kept in rw set even if vm run fails, they are used to
+// charge the gas fee.
+func (s *txSimContextImpl) RevertWrites() error {
+	for k, txWrite := range s.txWriteKeyMap {
+		if _, ok := s.txReadKeyMap[k]; !ok {
+			continue
+		}
+		value, err := s.snapshot.GetKey(s.txExecSeq, txWrite.ContractName, txWrite.Key)
+		if err != nil {
+			return err
+		}
+		s.putIntoReadSet(txWrite.ContractName, txWrite.Key, value)
+	}
+	s.txWriteKeyMap = make(map[string]*commonpb.TxWrite, 8)
+	s.txWriteKeySql = append(make([]*commonpb.TxWrite, 0, len(s.txWriteKeyDdlSql)), s.txWriteKeyDdlSql...)
+	s.reverted = true
+	return nil
+}
+
+func (s *txSimContextImpl) IsReverted() bool {
+	return s.reverted
+}
+
 // Get the height of the corresponding block
 func (s *txSimContextImpl) GetBlockHeight() uint64 {
 	return s.snapshot.GetBlockHeight()
@@ -249,11 +297,11 @@ func (s *txSimContextImpl) CallContract(contract *commonpb.Contract, method stri
 		}
 		return contractResult, commonpb.TxStatusCode_CONTRACT_TOO_DEEP_FAILED
 	}
-	if s.gasUsed > protocol.GasLimit {
+	if gasLimit := utils.TxGasLimit(s.tx); s.gasUsed > gasLimit {
 		contractResult := &commonpb.ContractResult{
 			Code:    uint32(1),
 			Result:  nil,
-			Message: fmt.Sprintf("There is not enough gas, gasUsed %d GasLimit %d ", gasUsed, int64(protocol.GasLimit)),
+			Message: fmt.Sprintf("There is not enough gas, gasUsed %d GasLimit %d ", gasUsed, gasLimit),
 		}
 		return contractResult, commonpb.TxStatusCode_CONTRACT_FAIL
 	}
@@ -0,0 +1,122 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"bytes"
+	"fmt"
+
+	"chainmaker.org/chainmaker-go/utils"
+	commonpb "chainmaker.org/chainmaker/pb-go/v2/common"
+	"chainmaker.org/chainmaker/protocol/v2"
+)
+
+// stateRootStore is implemented by the blockchain store which maintains the state tree
+type stateRootStore interface {
+	IsStateTreeEnabled() (bool, error)
+	GetStateRoot(height uint64) ([]byte, error)
+	CalcStateRoot(root []byte, writes []*commonpb.TxWrite, nodes map[string][]byte) ([]byte, error)
+}
+
+// getStateRootStore returns the store if it maintains the state tree, or nil if the state tree is not enabled.
+// The error is returned if the chain config enables the state tree but the store can not maintain it.
+func getStateRootStore(store protocol.BlockchainStore) (stateRootStore, error) {
+	s, ok := store.(stateRootStore)
+	if !ok {
+		return nil, nil
+	}
+	enabled, err := s.IsStateTreeEnabled()
+	if err != nil {
+		return nil, fmt.Errorf("check state tree error, %s", err)
+	}
+	if !enabled {
+		return nil, nil
+	}
+	return s, nil
+}
+
+// SetStateRoot sets the state root after lastBlock into block if the store maintains the state tree,
+// it must be called before the block hash is calculated
+func SetStateRoot(block, lastBlock *commonpb.Block, store protocol.BlockchainStore,
+	ledgerCache protocol.LedgerCache, proposalCache protocol.ProposalCache) error {
+	s, err := getStateRootStore(store)
+	if err != nil || s == nil {
+		return err
+	}
+	stateRoot, err := calcStateRoot(s, lastBlock, ledgerCache, proposalCache, make(map[string][]byte))
+	if err != nil {
+		return err
+	}
+	utils.SetBlockStateRoot(block, stateRoot)
+	return nil
+}
+
+// IsStateRootValid, to check if the state root of block equals with the state root after lastBlock,
+// the state root is not checked if the state tree is not enabled by the chain config
+func IsStateRootValid(block, lastBlock *commonpb.Block, store protocol.BlockchainStore,
+	ledgerCache protocol.LedgerCache, proposalCache protocol.ProposalCache) error {
+	s, err := getStateRootStore(store)
+	if err != nil || s == nil {
+		return err
+	}
+	stateRoot, err := calcStateRoot(s, lastBlock, ledgerCache, proposalCache, make(map[string][]byte))
+	if err != nil {
+		return fmt.Errorf("calc state root error, %s", err)
+	}
+	if !bytes.Equal(stateRoot, utils.GetBlockStateRoot(block)) {
+		return fmt.Errorf("state root expect %x, got %x", stateRoot, utils.GetBlockStateRoot(block))
+	}
+	return nil
+}
+
+// calcStateRoot returns the state root after block, the state root of the block not committed is calculated from
+// its parent and the rwsets in proposal cache, the nodes of state tree not committed are kept in nodes
+func calcStateRoot(store stateRootStore, block *commonpb.Block, ledgerCache protocol.LedgerCache,
+	proposalCache protocol.ProposalCache, nodes map[string][]byte) ([]byte, error) {
+	height := block.Header.BlockHeight
+	currentHeight, err := ledgerCache.CurrentHeight()
+	if err != nil {
+		return nil, err
+	}
+	if height <= currentHeight {
+		stateRoot, err := store.GetStateRoot(height)
+		if err != nil {
+			return nil, err
+		}
+		if stateRoot == nil {
+			return nil, fmt.Errorf("state root of block(%d) not found", height)
+		}
+		return stateRoot, nil
+	}
+
+	proposedBlock, rwSetMap := proposalCache.GetProposedBlockByHashAndHeight(block.Header.BlockHash, height)
+	if proposedBlock == nil {
+		return nil, fmt.Errorf("no proposed block found (%d,%x)", height, block.Header.BlockHash)
+	}
+	// the committed parent only needs its height to get the state root
+	parent := &commonpb.Block{Header: &commonpb.BlockHeader{BlockHeight: height - 1}}
+	if height-1 > currentHeight {
+		if parent, _ = proposalCache.GetProposedBlockByHashAndHeight(block.Header.PreBlockHash,
+			height-1); parent == nil {
+			return nil, fmt.Errorf("no pre block found (%d,%x)", height-1, block.Header.PreBlockHash)
+		}
+	}
+	parentRoot, err := calcStateRoot(store, parent, ledgerCache, proposalCache, nodes)
+	if err != nil {
+		return nil, err
+	}
+
+	txRWSets := make([]*commonpb.TxRWSet, 0, len(proposedBlock.Txs))
+	for _, tx := range proposedBlock.Txs {
+		txRWSets = append(txRWSets, rwSetMap[tx.Payload.TxId])
+	}
+	writes, err := utils.GetBlockStateWrites(proposedBlock, txRWSets)
+	if err != nil {
+		return nil, err
+	}
+	return store.CalcStateRoot(parentRoot, writes, nodes)
+}
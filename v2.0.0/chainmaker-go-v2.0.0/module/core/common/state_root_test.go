@@ -0,0 +1,164 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"fmt"
+	"testing"
+
+	"chainmaker.org/chainmaker-go/utils"
+	commonpb "chainmaker.org/chainmaker/pb-go/v2/common"
+	"chainmaker.org/chainmaker/protocol/v2"
+	"github.com/stretchr/testify/require"
+)
+
+// memStateRootStore keeps the state tree in memory
+type memStateRootStore struct {
+	protocol.BlockchainStore
+	roots map[uint64][]byte
+	nodes map[string][]byte
+	err   error // the error checking whether the state tree is enabled
+}
+
+func newMemStateRootStore() *memStateRootStore {
+	return &memStateRootStore{
+		roots: map[uint64][]byte{},
+		nodes: map[string][]byte{},
+	}
+}
+
+func (s *memStateRootStore) IsStateTreeEnabled() (bool, error) {
+	return s.err == nil, s.err
+}
+
+func (s *memStateRootStore) GetStateRoot(height uint64) ([]byte, error) {
+	return s.roots[height], nil
+}
+
+func (s *memStateRootStore) CalcStateRoot(root []byte, writes []*commonpb.TxWrite, nodes map[string][]byte) (
+	[]byte, error) {
+	newRoot, newNodes, err := utils.UpdateStateTree(root, writes, func(hash []byte) ([]byte, error) {
+		if node, ok := nodes[string(hash)]; ok {
+			return node, nil
+		}
+		return s.nodes[string(hash)], nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for hash, node := range newNodes {
+		nodes[hash] = node
+	}
+	return newRoot, nil
+}
+
+func (s *memStateRootStore) commit(height uint64, writes []*commonpb.TxWrite) {
+	root := utils.StateTreeEmptyRoot
+	if height > 0 {
+		root = s.roots[height-1]
+	}
+	s.roots[height], _ = s.CalcStateRoot(root, writes, s.nodes)
+}
+
+type fakeLedgerCache struct {
+	protocol.LedgerCache
+	height uint64
+}
+
+func (l *fakeLedgerCache) CurrentHeight() (uint64, error) {
+	return l.height, nil
+}
+
+type fakeProposalCache struct {
+	protocol.ProposalCache
+	blocks   map[string]*commonpb.Block
+	rwSetMap map[string]map[string]*commonpb.TxRWSet
+}
+
+func (p *fakeProposalCache) GetProposedBlockByHashAndHeight(hash []byte, height uint64) (*commonpb.Block,
+	map[string]*commonpb.TxRWSet) {
+	block, ok := p.blocks[string(hash)]
+	if !ok || block.Header.BlockHeight != height {
+		return nil, nil
+	}
+	return block, p.rwSetMap[string(hash)]
+}
+
+func createStateRootBlock(height uint64) (*commonpb.Block, map[string]*commonpb.TxRWSet) {
+	block := createBlock(height)
+	block.Header.BlockHash = []byte(fmt.Sprintf("hash%d", height))
+	block.Header.PreBlockHash = []byte(fmt.Sprintf("hash%d", height-1))
+	rwSetMap := make(map[string]*commonpb.TxRWSet)
+	for i := 0; i < 3; i++ {
+		txId := fmt.Sprintf("tx%d_%d", height, i)
+		block.Txs = append(block.Txs, createNewTestTx(txId))
+		rwSetMap[txId] = &commonpb.TxRWSet{
+			TxId: txId,
+			TxWrites: []*commonpb.TxWrite{{
+				ContractName: "contract1",
+				Key:          []byte(fmt.Sprintf("key%d", i)),
+				Value:        []byte(fmt.Sprintf("value%d_%d", height, i)),
+			}},
+		}
+	}
+	return block, rwSetMap
+}
+
+func TestSetStateRoot(t *testing.T) {
+	store := newMemStateRootStore()
+	store.commit(0, []*commonpb.TxWrite{{ContractName: "contract1", Key: []byte("key0"), Value: []byte("value0")}})
+	ledgerCache := &fakeLedgerCache{height: 1}
+	proposalCache := &fakeProposalCache{
+		blocks:   map[string]*commonpb.Block{},
+		rwSetMap: map[string]map[string]*commonpb.TxRWSet{},
+	}
+
+	// block 1 is committed, block 2 and 3 are proposed
+	blocks := make([]*commonpb.Block, 4)
+	expectRoots := make([][]byte, 4)
+	overlay := make(map[string][]byte)
+	for height := uint64(1); height < 4; height++ {
+		block, rwSetMap := createStateRootBlock(height)
+		blocks[height] = block
+		writes := make([]*commonpb.TxWrite, 0)
+		for _, tx := range block.Txs {
+			writes = append(writes, rwSetMap[tx.Payload.TxId].TxWrites...)
+		}
+		if height == 1 {
+			store.commit(height, writes)
+			expectRoots[height] = store.roots[height]
+			continue
+		}
+		root, err := store.CalcStateRoot(expectRoots[height-1], writes, overlay)
+		require.Nil(t, err)
+		expectRoots[height] = root
+		proposalCache.blocks[string(block.Header.BlockHash)] = block
+		proposalCache.rwSetMap[string(block.Header.BlockHash)] = rwSetMap
+	}
+
+	newBlock := createBlock(4)
+	require.Nil(t, SetStateRoot(newBlock, blocks[3], store, ledgerCache, proposalCache))
+	require.Equal(t, expectRoots[3], utils.GetBlockStateRoot(newBlock))
+	require.Nil(t, IsStateRootValid(newBlock, blocks[3], store, ledgerCache, proposalCache))
+
+	newBlock2 := createBlock(3)
+	require.Nil(t, SetStateRoot(newBlock2, blocks[2], store, ledgerCache, proposalCache))
+	require.Equal(t, expectRoots[2], utils.GetBlockStateRoot(newBlock2))
+	require.NotNil(t, IsStateRootValid(newBlock, blocks[2], store, ledgerCache, proposalCache))
+
+	unknownBlock, _ := createStateRootBlock(3)
+	unknownBlock.Header.BlockHash = []byte("unknown")
+	require.NotNil(t, SetStateRoot(newBlock, unknownBlock, store, ledgerCache, proposalCache))
+
+	// the state root is not checked if the store does not maintain the state tree
+	require.Nil(t, IsStateRootValid(createBlock(4), blocks[3], nil, ledgerCache, proposalCache))
+
+	// the block is neither proposed nor verified if the state tree is enabled but not maintained
+	store.err = fmt.Errorf("state tree is only supported by kv state db")
+	require.NotNil(t, SetStateRoot(createBlock(4), blocks[3], store, ledgerCache, proposalCache))
+	require.NotNil(t, IsStateRootValid(newBlock, blocks[3], store, ledgerCache, proposalCache))
+}
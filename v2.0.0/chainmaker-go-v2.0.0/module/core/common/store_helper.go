@@ -71,6 +71,8 @@ func (sql *SQLStoreHelper) BeginDbTransaction(blockchainStore protocol.Blockchai
 	blockchainStore.BeginDbTransaction(txKey)
 }
 
+// GetPoolCapacity the txs run concurrently, except that the txs executing sql run one by one, each in its own
+// savepoint of the db transaction of block
 func (sql *SQLStoreHelper) GetPoolCapacity() int {
-	return 1
+	return runtime.NumCPU() * 4
 }
@@ -28,6 +28,7 @@ const (
 	SUBSYSTEM_CORE_VERIFIER           = "verifier"
 	SUBSYSTEM_WASM_WASMER             = "wasmer"
 	SUBSYSTEM_TXPOOL                  = "txpool"
+	SUBSYSTEM_SYNC                    = "sync"
 
 	ChainId                    = "chainId"
 	MetricBlockSize            = "metric_block_size"
@@ -20,6 +20,7 @@ require (
 	github.com/stretchr/testify v1.7.0
 	github.com/tjfoc/gmsm v1.3.2
 	github.com/tjfoc/gmtls v1.2.1
+	google.golang.org/grpc v1.37.0
 )
 
 replace (
@@ -0,0 +1,111 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package grpcnet
+
+import (
+	"errors"
+	"fmt"
+
+	"google.golang.org/grpc"
+)
+
+const (
+	serviceName = "chainmaker.net.GRpcNet"
+	streamName  = "MsgStream"
+	codecName   = "chainmaker-grpc-net"
+)
+
+// ErrorInvalidFrame
+var ErrorInvalidFrame = errors.New("invalid frame")
+
+type frameType byte
+
+const (
+	// frameDirect is a frame sent to the peer directly.
+	frameDirect frameType = iota + 1
+	// framePubSub is a frame broadcast to the topic of a chain, the topic is carried by the flag of net msg.
+	framePubSub
+)
+
+// frame is the unit transferred on the msg stream.
+//		layout: | type(1 byte) | compressed(1 byte) | net pb msg bytes |
+type frame struct {
+	typ        frameType
+	compressed bool
+	data       []byte
+}
+
+// frameCodec marshal and unmarshal the frames of the msg stream, it implements both grpc.Codec and encoding.Codec.
+type frameCodec struct{}
+
+// Marshal
+func (frameCodec) Marshal(v interface{}) ([]byte, error) {
+	f, ok := v.(*frame)
+	if !ok {
+		return nil, fmt.Errorf("unsupported msg type: %T", v)
+	}
+	bytes := make([]byte, 0, len(f.data)+2)
+	compressed := byte(0)
+	if f.compressed {
+		compressed = byte(1)
+	}
+	bytes = append(bytes, byte(f.typ), compressed)
+	return append(bytes, f.data...), nil
+}
+
+// Unmarshal
+func (frameCodec) Unmarshal(data []byte, v interface{}) error {
+	f, ok := v.(*frame)
+	if !ok {
+		return fmt.Errorf("unsupported msg type: %T", v)
+	}
+	if len(data) < 2 {
+		return ErrorInvalidFrame
+	}
+	f.typ = frameType(data[0])
+	if f.typ != frameDirect && f.typ != framePubSub {
+		return ErrorInvalidFrame
+	}
+	f.compressed = data[1] == byte(1)
+	f.data = append([]byte{}, data[2:]...)
+	return nil
+}
+
+// Name
+func (frameCodec) Name() string {
+	return codecName
+}
+
+// String
+func (frameCodec) String() string {
+	return codecName
+}
+
+// msgStreamServer handle the msg stream opened by remote peers.
+type msgStreamServer interface {
+	handleMsgStream(stream grpc.ServerStream) error
+}
+
+func msgStreamHandler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(msgStreamServer).handleMsgStream(stream)
+}
+
+// serviceDesc describe the only service of gRPC net, a bidirectional stream between two nodes.
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: serviceName,
+	HandlerType: (*msgStreamServer)(nil),
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    streamName,
+			Handler:       msgStreamHandler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+}
+
+var msgStreamMethod = "/" + serviceName + "/" + streamName
@@ -0,0 +1,892 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+// Package grpcnet implement a net service provider based on gRPC.
+// Every two nodes share one mutual tls bidirectional stream, the uid of a node is computed from its tls cert
+// in the same way as libp2p net, so the node ids configured for consensus work with both providers.
+// gRPC net does not route msg for other nodes, the nodes of a chain should connect with each other by seeds.
+package grpcnet
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"net"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	rootLog "chainmaker.org/chainmaker-go/logger"
+	"chainmaker.org/chainmaker-go/net/p2p/libp2pgmtls"
+	"chainmaker.org/chainmaker-go/net/p2p/libp2ptls"
+	"chainmaker.org/chainmaker-go/net/p2p/revoke"
+	"chainmaker.org/chainmaker-go/utils"
+	"chainmaker.org/chainmaker/common/v2/crypto"
+	"chainmaker.org/chainmaker/common/v2/crypto/asym"
+	cmx509 "chainmaker.org/chainmaker/common/v2/crypto/x509"
+	"chainmaker.org/chainmaker/common/v2/helper"
+	pbac "chainmaker.org/chainmaker/pb-go/v2/accesscontrol"
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	netPb "chainmaker.org/chainmaker/pb-go/v2/net"
+	"chainmaker.org/chainmaker/pb-go/v2/syscontract"
+	api "chainmaker.org/chainmaker/protocol/v2"
+	"github.com/gogo/protobuf/proto"
+	"github.com/tjfoc/gmtls"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/peer"
+)
+
+const (
+	// DefaultGRpcListenAddress is the default address that gRPC net will listen on.
+	DefaultGRpcListenAddress = "/ip4/0.0.0.0/tcp/0"
+	// DefaultGRpcMaxMsgSize is the default max size of msg.
+	DefaultGRpcMaxMsgSize = 50 << 20
+	// DefaultMaxPeerCountAllow is the default max count of nodes that connected to us.
+	DefaultMaxPeerCountAllow = 20
+	// DefaultDialTimeout is the default timeout for dialing a seed.
+	DefaultDialTimeout = 10 * time.Second
+	// DefaultSeedRedialInterval is the interval of redialing the seeds not connected.
+	DefaultSeedRedialInterval = 5 * time.Second
+)
+
+// compressThreshold is the default threshold value for enable compress net msg bytes. Default value is 1M.
+const compressThreshold = 1024 * 1024
+
+var logger = rootLog.GetLogger(rootLog.MODULE_NET)
+
+// ErrorPubSubNotExist
+var ErrorPubSubNotExist = errors.New("pubsub not exist")
+
+// ErrorPubSubExisted
+var ErrorPubSubExisted = errors.New("pubsub existed")
+
+// ErrorTopicSubscribed
+var ErrorTopicSubscribed = errors.New("topic has been subscribed")
+
+// ErrorNotConnected
+var ErrorNotConnected = errors.New("node not connected")
+
+// ErrorNotBelongToChain
+var ErrorNotBelongToChain = errors.New("node not belong to chain")
+
+// ErrorMsgTooLarge
+var ErrorMsgTooLarge = errors.New("msg too large")
+
+// GRpcNet is an implementation of net.Net interface based on gRPC.
+type GRpcNet struct {
+	compressMsgBytes bool
+	lock             sync.RWMutex
+	startUp          bool
+
+	nodeUid     string
+	certificate tls.Certificate
+	// isGmTls whether gmtls is used instead of crypto/tls, it is used if the key of the node is SM2.
+	isGmTls       bool
+	gmCertificate gmtls.Certificate
+
+	tlsChainTrustRoots   *libp2ptls.ChainTrustRoots
+	gmTlsChainTrustRoots *libp2pgmtls.ChainTrustRoots
+	revokedValidator     *revoke.RevokedValidator
+	certRecorder         *peerCertRecorder
+	blackList            *blackList
+	conns                *peerConnManager
+
+	// seeds mapping the node uid to the address of the seed.
+	seeds     map[string]*seedAddr
+	seedsLock sync.RWMutex
+	// dialing contains the node uids which are being dialed.
+	dialing sync.Map
+
+	// pubSubs mapping the chainId to the max msg size of the chain. Same as map[string]int .
+	pubSubs sync.Map
+	// subscribedTopics mapping the chainId to a map which mapping the topic name to the handler.
+	subscribedTopics map[string]map[string]api.PubsubMsgHandler
+	subscribeLock    sync.RWMutex
+	// directMsgHandlers mapping the chainId + msgFlag to the handler.
+	directMsgHandlers map[string]api.DirectMsgHandler
+	directMsgLock     sync.RWMutex
+
+	listener net.Listener
+	server   *grpc.Server
+	stopC    chan struct{}
+	wg       sync.WaitGroup
+
+	prepare *GRpcNetPrepare // prepare contains the base info for the net starting.
+}
+
+// NewGRpcNet create a new GRpcNet instance.
+func NewGRpcNet() (*GRpcNet, error) {
+	return &GRpcNet{
+		revokedValidator:  revoke.NewRevokedValidator(),
+		certRecorder:      newPeerCertRecorder(),
+		blackList:         newBlackList(),
+		conns:             newPeerConnManager(),
+		seeds:             make(map[string]*seedAddr),
+		subscribedTopics:  make(map[string]map[string]api.PubsubMsgHandler),
+		directMsgHandlers: make(map[string]api.DirectMsgHandler),
+		prepare:           newGRpcNetPrepare(),
+	}, nil
+}
+
+func (gn *GRpcNet) Prepare() *GRpcNetPrepare {
+	return gn.prepare
+}
+
+func (gn *GRpcNet) SetCompressMsgBytes(enable bool) {
+	gn.compressMsgBytes = enable
+}
+
+// GetNodeUid is the unique id of node.
+func (gn *GRpcNet) GetNodeUid() string {
+	gn.lock.RLock()
+	uid := gn.nodeUid
+	gn.lock.RUnlock()
+	if uid != "" {
+		return uid
+	}
+	uid, err := helper.GetLibp2pPeerIdFromCert(gn.prepare.certBytes)
+	if err != nil {
+		logger.Errorf("[Net] get node uid from cert failed, %s", err.Error())
+		return ""
+	}
+	return uid
+}
+
+// InitPubsub will init the pubsub of the chain which id is the given chainId .
+func (gn *GRpcNet) InitPubsub(chainId string, maxMessageSize int) error {
+	if maxMessageSize <= 0 {
+		maxMessageSize = DefaultGRpcMaxMsgSize
+	}
+	if _, loaded := gn.pubSubs.LoadOrStore(chainId, maxMessageSize); loaded {
+		return ErrorPubSubExisted
+	}
+	return nil
+}
+
+// BroadcastWithChainId broadcast a msg to the given topic of the target chain which id is the given chainId .
+// The msg is sent to all the nodes of the chain connected to us.
+func (gn *GRpcNet) BroadcastWithChainId(chainId string, topic string, netMsg *netPb.NetMsg) error {
+	maxMessageSize, ok := gn.pubSubs.Load(chainId)
+	if !ok {
+		return ErrorPubSubNotExist
+	}
+	f, size, err := gn.newFrame(framePubSub, &netPb.Msg{Msg: netMsg, ChainId: chainId, Flag: topic})
+	if err != nil {
+		return err
+	}
+	if size > maxMessageSize.(int) {
+		return ErrorMsgTooLarge
+	}
+	for _, pc := range gn.chainConns(chainId) {
+		if err = pc.send(f); err != nil {
+			logger.Warnf("[Net] broadcast msg to peer failed(pid: %s, chain id: %s), %s", pc.pid, chainId, err.Error())
+		}
+	}
+	return nil
+}
+
+// SubscribeWithChainId subscribe the given topic of the target chain
+// which id is the given chainId with the given sub-msg handler function.
+func (gn *GRpcNet) SubscribeWithChainId(chainId string, topic string, handler api.PubsubMsgHandler) error {
+	if _, ok := gn.pubSubs.Load(chainId); !ok {
+		return ErrorPubSubNotExist
+	}
+	gn.subscribeLock.Lock()
+	defer gn.subscribeLock.Unlock()
+	topics, ok := gn.subscribedTopics[chainId]
+	if !ok {
+		topics = make(map[string]api.PubsubMsgHandler)
+		gn.subscribedTopics[chainId] = topics
+	}
+	if _, ok = topics[topic]; ok {
+		return ErrorTopicSubscribed
+	}
+	topics[topic] = handler
+	return nil
+}
+
+// CancelSubscribeWithChainId cancel subscribing the given topic of the target chain which id is the given chainId.
+func (gn *GRpcNet) CancelSubscribeWithChainId(chainId string, topic string) error {
+	if _, ok := gn.pubSubs.Load(chainId); !ok {
+		return ErrorPubSubNotExist
+	}
+	gn.subscribeLock.Lock()
+	defer gn.subscribeLock.Unlock()
+	if topics, ok := gn.subscribedTopics[chainId]; ok {
+		delete(topics, topic)
+	}
+	return nil
+}
+
+func (gn *GRpcNet) topicHandler(chainId string, topic string) api.PubsubMsgHandler {
+	gn.subscribeLock.RLock()
+	defer gn.subscribeLock.RUnlock()
+	return gn.subscribedTopics[chainId][topic]
+}
+
+// SendMsg send a msg to the given node belong to the given chain.
+func (gn *GRpcNet) SendMsg(chainId string, node string, msgFlag string, netMsg *netPb.NetMsg) error {
+	if node == gn.GetNodeUid() {
+		logger.Warn("[Net] can not send msg to self")
+		return nil
+	}
+	pid := node
+	if peerId, err := gn.certRecorder.findPeerIdByCertId(node); err == nil {
+		pid = peerId
+	}
+	pc := gn.conns.get(pid)
+	if pc == nil {
+		return ErrorNotConnected
+	}
+	// is peer belong to this chain
+	if !gn.prepare.isInsecurity && !gn.certRecorder.isPeerBelongToChain(pid, chainId) {
+		return ErrorNotBelongToChain
+	}
+	f, _, err := gn.newFrame(frameDirect, &netPb.Msg{Msg: netMsg, ChainId: chainId, Flag: msgFlag})
+	if err != nil {
+		return err
+	}
+	return pc.send(f)
+}
+
+// DirectMsgHandle register a DirectMsgHandler for handling msg received.
+func (gn *GRpcNet) DirectMsgHandle(chainId string, msgFlag string, handler api.DirectMsgHandler) error {
+	gn.directMsgLock.Lock()
+	defer gn.directMsgLock.Unlock()
+	key := chainId + msgFlag
+	if _, exist := gn.directMsgHandlers[key]; exist {
+		return errors.New("can not register handler more than once")
+	}
+	gn.directMsgHandlers[key] = handler
+	return nil
+}
+
+// CancelDirectMsgHandle unregister a DirectMsgHandler for handling msg received.
+func (gn *GRpcNet) CancelDirectMsgHandle(chainId string, msgFlag string) error {
+	gn.directMsgLock.Lock()
+	defer gn.directMsgLock.Unlock()
+	delete(gn.directMsgHandlers, chainId+msgFlag)
+	return nil
+}
+
+func (gn *GRpcNet) directMsgHandler(chainId string, msgFlag string) api.DirectMsgHandler {
+	gn.directMsgLock.RLock()
+	defer gn.directMsgLock.RUnlock()
+	return gn.directMsgHandlers[chainId+msgFlag]
+}
+
+// AddSeed add a seed node address. It can be a consensus node address.
+func (gn *GRpcNet) AddSeed(seed string) error {
+	sa, err := parseSeedAddr(seed)
+	if err != nil {
+		return err
+	}
+	if !gn.IsRunning() {
+		gn.prepare.AddBootstrapsPeer(seed)
+		return nil
+	}
+	gn.seedsLock.Lock()
+	if _, ok := gn.seeds[sa.pid]; ok {
+		gn.seedsLock.Unlock()
+		logger.Warn("[Net] seed already exists. ignored.")
+		return nil
+	}
+	gn.seeds[sa.pid] = sa
+	gn.seedsLock.Unlock()
+	gn.dialSeeds()
+	return nil
+}
+
+// RefreshSeeds reset addresses of seed nodes with given.
+func (gn *GRpcNet) RefreshSeeds(seeds []string) error {
+	newSeeds := make(map[string]*seedAddr, len(seeds))
+	for _, seed := range seeds {
+		sa, err := parseSeedAddr(seed)
+		if err != nil {
+			return err
+		}
+		newSeeds[sa.pid] = sa
+	}
+	if !gn.IsRunning() {
+		for _, seed := range seeds {
+			gn.prepare.AddBootstrapsPeer(seed)
+		}
+		return nil
+	}
+	gn.seedsLock.Lock()
+	gn.seeds = newSeeds
+	gn.seedsLock.Unlock()
+	gn.dialSeeds()
+	return nil
+}
+
+func (gn *GRpcNet) isSeed(pid string) bool {
+	gn.seedsLock.RLock()
+	defer gn.seedsLock.RUnlock()
+	_, ok := gn.seeds[pid]
+	return ok
+}
+
+// AddTrustRoot add a root cert for chain.
+func (gn *GRpcNet) AddTrustRoot(chainId string, rootCertByte []byte) error {
+	if gn.IsRunning() {
+		var err error
+		if gn.isGmTls {
+			_, err = libp2pgmtls.AppendNewCertsToTrustRoots(gn.gmTlsChainTrustRoots, chainId, rootCertByte)
+		} else {
+			_, err = libp2ptls.AppendNewCertsToTrustRoots(gn.tlsChainTrustRoots, chainId, rootCertByte)
+		}
+		if err != nil {
+			logger.Errorf("[Net] add trust root failed. %s", err.Error())
+			return err
+		}
+		return nil
+	}
+	gn.prepare.AddTrustRootCert(chainId, rootCertByte)
+	return nil
+}
+
+// RefreshTrustRoots reset all root certs for chain.
+func (gn *GRpcNet) RefreshTrustRoots(chainId string, rootsCertsBytes [][]byte) error {
+	if gn.IsRunning() {
+		var refreshed bool
+		if gn.isGmTls {
+			refreshed = gn.gmTlsChainTrustRoots.RefreshRootsFromPem(chainId, rootsCertsBytes)
+		} else {
+			refreshed = gn.tlsChainTrustRoots.RefreshRootsFromPem(chainId, rootsCertsBytes)
+		}
+		if !refreshed {
+			return errors.New("refresh trust roots failed")
+		}
+		return nil
+	}
+	for _, certsByte := range rootsCertsBytes {
+		gn.prepare.AddTrustRootCert(chainId, certsByte)
+	}
+	return nil
+}
+
+// ReVerifyTrustRoots verify the tls certs of the peers connected with the trust roots of the chain,
+// the peers which failed are removed from the chain, the others are added to the chain.
+func (gn *GRpcNet) ReVerifyTrustRoots(chainId string) {
+	if !gn.IsRunning() {
+		return
+	}
+	for pid, certBytes := range gn.certRecorder.storeCopy() {
+		verified, err := gn.verifyCertOfChain(chainId, certBytes)
+		if err != nil {
+			logger.Errorf("[Net] [ReVerifyTrustRoots] parse tls cert failed. %s", err.Error())
+			continue
+		}
+		belong := gn.certRecorder.isPeerBelongToChain(pid, chainId)
+		if verified {
+			if !belong {
+				gn.certRecorder.addPeerChainId(pid, chainId)
+				logger.Infof("[Net] [ReVerifyTrustRoots] add peer to chain, (pid: %s, chain id: %s)",
+					pid, chainId)
+			}
+			continue
+		}
+		if belong {
+			gn.certRecorder.removePeerChainId(pid, chainId)
+			logger.Infof("[Net] [ReVerifyTrustRoots] remove peer from chain, (pid: %s, chain id: %s)",
+				pid, chainId)
+		}
+	}
+}
+
+// IsRunning
+func (gn *GRpcNet) IsRunning() bool {
+	gn.lock.RLock()
+	defer gn.lock.RUnlock()
+	return gn.startUp
+}
+
+// ChainNodesInfo
+func (gn *GRpcNet) ChainNodesInfo(chainId string) ([]*api.ChainNodeInfo, error) {
+	result := make([]*api.ChainNodeInfo, 0)
+	if !gn.IsRunning() {
+		return result, nil
+	}
+	result = append(result, &api.ChainNodeInfo{
+		NodeUid:     gn.GetNodeUid(),
+		NodeAddress: []string{hostPortToMultiAddr(gn.listener.Addr().String())},
+		NodeTlsCert: gn.localTlsCert(),
+	})
+	for _, pc := range gn.chainConns(chainId) {
+		result = append(result, &api.ChainNodeInfo{
+			NodeUid:     pc.pid,
+			NodeAddress: []string{hostPortToMultiAddr(pc.addr)},
+			NodeTlsCert: gn.certRecorder.certOfPeer(pc.pid),
+		})
+	}
+	return result, nil
+}
+
+// localTlsCert return the tls cert of the node.
+func (gn *GRpcNet) localTlsCert() []byte {
+	if gn.isGmTls {
+		return gn.gmCertificate.Certificate[0]
+	}
+	return gn.certificate.Certificate[0]
+}
+
+// GetNodeUidByCertId
+func (gn *GRpcNet) GetNodeUidByCertId(certId string) (string, error) {
+	return gn.certRecorder.findPeerIdByCertId(certId)
+}
+
+// chainConns return the conns of the peers belong to the chain.
+func (gn *GRpcNet) chainConns(chainId string) []*peerConn {
+	conns := gn.conns.all()
+	if gn.prepare.isInsecurity {
+		return conns
+	}
+	result := make([]*peerConn, 0, len(conns))
+	for _, pc := range conns {
+		if gn.certRecorder.isPeerBelongToChain(pc.pid, chainId) {
+			result = append(result, pc)
+		}
+	}
+	return result
+}
+
+// newFrame marshal the msg and compress it if necessary, the size of msg before compressed is returned.
+func (gn *GRpcNet) newFrame(typ frameType, msg *netPb.Msg) (*frame, int, error) {
+	bytes, err := proto.Marshal(msg)
+	if err != nil {
+		logger.Errorf("[Net] marshal net pb msg failed, %s", err.Error())
+		return nil, 0, err
+	}
+	size := len(bytes)
+	f := &frame{typ: typ, data: bytes}
+	if gn.compressMsgBytes && size > compressThreshold {
+		f.data, err = utils.GZipCompressBytes(bytes)
+		if err != nil {
+			return nil, 0, err
+		}
+		f.compressed = true
+		logger.Debugf("[Net] compress net msg bytes ok(length before/after compress: %d/%d)",
+			size, len(f.data))
+	}
+	return f, size, nil
+}
+
+// handleFrame dispatch the frame received from the peer to the handler registered.
+func (gn *GRpcNet) handleFrame(pid string, f *frame) {
+	data := f.data
+	if f.compressed {
+		var err error
+		data, err = utils.GZipDeCompressBytes(data)
+		if err != nil {
+			logger.Errorf("[Net] decompress msg bytes failed, %s", err.Error())
+			return
+		}
+	}
+	var msg netPb.Msg
+	if err := proto.Unmarshal(data, &msg); err != nil {
+		logger.Errorf("[Net] unmarshal net pb msg failed, %s", err.Error())
+		return
+	}
+	if !gn.prepare.isInsecurity && !gn.certRecorder.isPeerBelongToChain(pid, msg.GetChainId()) {
+		logger.Debugf("[Net] sender not belong to chain. drop message. (chainId:%s, sender:%s)",
+			msg.GetChainId(), pid)
+		return
+	}
+	switch f.typ {
+	case frameDirect:
+		handler := gn.directMsgHandler(msg.GetChainId(), msg.GetFlag())
+		if handler == nil {
+			logger.Warnf("[Net] handler not registered. drop message. (chainId:%s, flag:%s)",
+				msg.GetChainId(), msg.GetFlag())
+			return
+		}
+		go callHandler(pid, msg.GetMsg(), handler)
+	case framePubSub:
+		handler := gn.topicHandler(msg.GetChainId(), msg.GetFlag())
+		if handler == nil {
+			return
+		}
+		logger.Debugf("[Net] receive subscribed msg(topic:%s), data size:%d", msg.GetFlag(), len(data))
+		go callHandler(pid, msg.GetMsg(), handler)
+	}
+}
+
+func callHandler(pid string, netMsg *netPb.NetMsg, handler func(string, *netPb.NetMsg) error) {
+	defer func() {
+		if err := recover(); err != nil {
+			logger.Errorf("[Net] call msg handler recover failed, %s", err)
+			logger.Error(string(debug.Stack()))
+		}
+	}()
+	if err := handler(pid, netMsg); err != nil {
+		logger.Errorf("[Net] call msg handler failed, %s", err.Error())
+	}
+}
+
+// handleMsgStream handle the msg stream opened by the remote peer, it returns when the stream closed.
+func (gn *GRpcNet) handleMsgStream(stream grpc.ServerStream) error {
+	p, ok := peer.FromContext(stream.Context())
+	if !ok {
+		return errors.New("peer info not found")
+	}
+	certBytes, err := peerCertFromAuthInfo(p.AuthInfo)
+	if err != nil {
+		return err
+	}
+	pid, err := peerIdFromCert(certBytes)
+	if err != nil {
+		return err
+	}
+	if !gn.isSeed(pid) && gn.conns.count() >= gn.prepare.maxPeerCountAllow {
+		logger.Warnf("[Net] max peer count reached, reject peer(pid: %s)", pid)
+		return errors.New("max peer count reached")
+	}
+	pc := newPeerConn(pid, p.Addr.String(), false, stream, nil)
+	if !gn.addPeerConn(pc) {
+		return errors.New("peer connected already")
+	}
+	// the cert is recorded after the conn is kept, so the peers rejected leave no cert behind
+	if err = gn.recordPeerCert(pid, certBytes); err != nil {
+		gn.removePeerConn(pc)
+		return err
+	}
+	go gn.recvLoop(pc)
+	select {
+	case <-pc.closeC:
+	case <-stream.Context().Done():
+		gn.removePeerConn(pc)
+	}
+	return nil
+}
+
+// dial connect to the seed and open a msg stream.
+func (gn *GRpcNet) dial(seed *seedAddr) error {
+	if gn.blackList.containsAddress(seed.addr) || gn.blackList.containsPeerId(seed.pid) {
+		return fmt.Errorf("seed in blacklist(pid: %s, addr: %s)", seed.pid, seed.addr)
+	}
+	maxMsgSize := gn.prepare.maxMsgSize()
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultDialTimeout)
+	defer cancel()
+	verified := &verifiedCert{}
+	cc, err := grpc.DialContext(ctx, seed.addr,
+		grpc.WithTransportCredentials(gn.newTransportCredentials(seed.pid, verified)),
+		grpc.WithBlock(),
+		grpc.FailOnNonTempDialError(true),
+		grpc.WithDefaultCallOptions(
+			grpc.ForceCodec(frameCodec{}),
+			grpc.MaxCallRecvMsgSize(maxMsgSize),
+			grpc.MaxCallSendMsgSize(maxMsgSize),
+		),
+	)
+	if err != nil {
+		return err
+	}
+	streamCtx, streamCancel := context.WithCancel(context.Background())
+	stream, err := cc.NewStream(streamCtx, &serviceDesc.Streams[0], msgStreamMethod)
+	if err != nil {
+		streamCancel()
+		_ = cc.Close()
+		return err
+	}
+	pc := newPeerConn(seed.pid, seed.addr, true, stream, func() {
+		streamCancel()
+		_ = cc.Close()
+	})
+	if !gn.IsRunning() {
+		pc.close()
+		return nil
+	}
+	if gn.addPeerConn(pc) {
+		if err = gn.recordPeerCert(seed.pid, verified.get()); err != nil {
+			gn.removePeerConn(pc)
+			return err
+		}
+		go gn.recvLoop(pc)
+	}
+	return nil
+}
+
+// dialSeeds dial the seeds not connected.
+func (gn *GRpcNet) dialSeeds() {
+	gn.seedsLock.RLock()
+	defer gn.seedsLock.RUnlock()
+	for _, seed := range gn.seeds {
+		if seed.pid == gn.nodeUid || gn.conns.isConnected(seed.pid) {
+			continue
+		}
+		if _, loaded := gn.dialing.LoadOrStore(seed.pid, struct{}{}); loaded {
+			continue
+		}
+		go func(seed *seedAddr) {
+			defer gn.dialing.Delete(seed.pid)
+			if err := gn.dial(seed); err != nil {
+				logger.Debugf("[Net] dial seed failed(pid: %s, addr: %s), %s", seed.pid, seed.addr, err.Error())
+			}
+		}(seed)
+	}
+}
+
+// superviseSeeds redial the seeds not connected periodically.
+func (gn *GRpcNet) superviseSeeds() {
+	defer gn.wg.Done()
+	ticker := time.NewTicker(DefaultSeedRedialInterval)
+	defer ticker.Stop()
+	for {
+		gn.dialSeeds()
+		select {
+		case <-gn.stopC:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// addPeerConn add the conn to the manager, return false if the conn is dropped.
+func (gn *GRpcNet) addPeerConn(pc *peerConn) bool {
+	kept, dropped := gn.conns.add(pc)
+	if dropped != nil {
+		dropped.close()
+	}
+	if kept {
+		logger.Infof("[Net] peer connected(pid: %s, addr: %s)", pc.pid, pc.addr)
+	}
+	return kept
+}
+
+func (gn *GRpcNet) removePeerConn(pc *peerConn) {
+	pc.close()
+	if gn.conns.remove(pc) {
+		gn.certRecorder.remove(pc.pid)
+		logger.Infof("[Net] peer disconnected(pid: %s, addr: %s)", pc.pid, pc.addr)
+	}
+}
+
+// recvLoop receive frames from the conn until it closed.
+func (gn *GRpcNet) recvLoop(pc *peerConn) {
+	defer gn.removePeerConn(pc)
+	for {
+		f := &frame{}
+		if err := pc.stream.RecvMsg(f); err != nil {
+			logger.Debugf("[Net] receive msg from peer stopped(pid: %s), %s", pc.pid, err.Error())
+			return
+		}
+		gn.handleFrame(pc.pid, f)
+	}
+}
+
+// blackListListener close the conns from the addresses in blacklist.
+type blackListListener struct {
+	net.Listener
+	blackList *blackList
+}
+
+func (l *blackListListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		if l.blackList.containsAddress(conn.RemoteAddr().String()) {
+			logger.Warnf("[Net] reject conn from black address[%s]", conn.RemoteAddr().String())
+			_ = conn.Close()
+			continue
+		}
+		return conn, nil
+	}
+}
+
+func (gn *GRpcNet) prepareBlackList() {
+	logger.Info("[Net] preparing blacklist...")
+	for addr := range gn.prepare.blackAddresses {
+		gn.blackList.addAddress(addr)
+		logger.Infof("[Net] black address found[%s]", addr)
+	}
+	for pid := range gn.prepare.blackPeerIds {
+		gn.blackList.addPeerId(pid)
+		logger.Infof("[Net] black peer id found[%s]", pid)
+	}
+	logger.Info("[Net] blacklist prepared.")
+}
+
+// prepareTls load the tls key pair and the trust roots, gmtls is used if the key is SM2 like libp2p net.
+func (gn *GRpcNet) prepareTls() error {
+	privateKey, err := asym.PrivateKeyFromPEM(gn.prepare.keyBytes, nil)
+	if err != nil {
+		logger.Errorf("[Net] parse pem to private key failed, %s", err.Error())
+		return err
+	}
+	if privateKey.Type() == crypto.SM2 {
+		logger.Info("[Net] the priv key type found[sm2]. use gm tls security.")
+		gn.isGmTls = true
+		gn.gmCertificate, err = gmtls.X509KeyPair(gn.prepare.certBytes, gn.prepare.keyBytes)
+		if err != nil {
+			logger.Errorf("[Net] load gm tls key pair failed, %s", err.Error())
+			return err
+		}
+		gn.gmTlsChainTrustRoots, err = libp2pgmtls.BuildTlsTrustRoots(gn.prepare.chainTrustRootCertsBytes)
+		if err != nil {
+			logger.Errorf("[Net] build gm tls trust roots failed, %s", err.Error())
+			return err
+		}
+		return nil
+	}
+	logger.Info("[Net] the priv key type found[not sm2]. use normal tls security.")
+	gn.isGmTls = false
+	gn.certificate, err = tls.X509KeyPair(gn.prepare.certBytes, gn.prepare.keyBytes)
+	if err != nil {
+		logger.Errorf("[Net] load tls key pair failed, %s", err.Error())
+		return err
+	}
+	gn.tlsChainTrustRoots, err = libp2ptls.BuildTlsTrustRoots(gn.prepare.chainTrustRootCertsBytes)
+	if err != nil {
+		logger.Errorf("[Net] build tls trust roots failed, %s", err.Error())
+		return err
+	}
+	return nil
+}
+
+// Start
+func (gn *GRpcNet) Start() error {
+	gn.lock.Lock()
+	defer gn.lock.Unlock()
+	if gn.startUp {
+		logger.Warn("[Net] net is running.")
+		return nil
+	}
+	var err error
+	if err = gn.prepareTls(); err != nil {
+		return err
+	}
+	gn.nodeUid, err = helper.GetLibp2pPeerIdFromCert(gn.prepare.certBytes)
+	if err != nil {
+		return err
+	}
+	gn.conns.local = gn.nodeUid
+	gn.prepareBlackList()
+	for seed := range gn.prepare.bootstrapsPeers {
+		sa, err := parseSeedAddr(seed)
+		if err != nil {
+			return err
+		}
+		gn.seeds[sa.pid] = sa
+	}
+
+	listenAddr, err := parseListenAddr(gn.prepare.listenAddr)
+	if err != nil {
+		return err
+	}
+	listener, err := net.Listen("tcp", listenAddr)
+	if err != nil {
+		return err
+	}
+	gn.listener = &blackListListener{Listener: listener, blackList: gn.blackList}
+	maxMsgSize := gn.prepare.maxMsgSize()
+	gn.server = grpc.NewServer(
+		grpc.Creds(gn.newTransportCredentials("", nil)),
+		grpc.CustomCodec(frameCodec{}),
+		grpc.MaxRecvMsgSize(maxMsgSize),
+		grpc.MaxSendMsgSize(maxMsgSize),
+	)
+	gn.server.RegisterService(&serviceDesc, gn)
+	go func() {
+		if err := gn.server.Serve(gn.listener); err != nil {
+			logger.Errorf("[Net] grpc server stopped, %s", err.Error())
+		}
+	}()
+	logger.Infof("[Net] grpc net listening on %s", listener.Addr().String())
+
+	gn.startUp = true
+	gn.stopC = make(chan struct{})
+	gn.wg.Add(1)
+	go gn.superviseSeeds()
+	return nil
+}
+
+// Stop
+func (gn *GRpcNet) Stop() error {
+	gn.lock.Lock()
+	defer gn.lock.Unlock()
+	if !gn.startUp {
+		logger.Warn("[Net] net is not running.")
+		return nil
+	}
+	close(gn.stopC)
+	gn.wg.Wait()
+	for _, pc := range gn.conns.all() {
+		gn.removePeerConn(pc)
+	}
+	gn.server.Stop()
+	gn.startUp = false
+	return nil
+}
+
+func (gn *GRpcNet) AddAC(chainId string, ac api.AccessControlProvider) {
+	gn.revokedValidator.AddAC(chainId, ac)
+}
+
+// CheckRevokeTlsCerts check whether any tls certs of the peers revoked, the conns of the revoked peers are closed.
+func (gn *GRpcNet) CheckRevokeTlsCerts(ac api.AccessControlProvider, certManageSystemContractPayload []byte) error {
+	var payload commonPb.Payload
+	err := proto.Unmarshal(certManageSystemContractPayload, &payload)
+	if err != nil {
+		return fmt.Errorf("resolve payload failed: %v", err)
+	}
+	if payload.Method != syscontract.CertManageFunction_CERTS_REVOKE.String() {
+		return nil
+	}
+	for _, param := range payload.Parameters {
+		if param.Key != "cert_crl" {
+			continue
+		}
+		crlStr := strings.Replace(string(param.Value), ",", "\n", -1)
+		if _, err = ac.VerifyRelatedMaterial(pbac.VerifyType_CRL, []byte(crlStr)); err != nil {
+			logger.Errorf("[Net] validate crl failed, %s", err.Error())
+			return err
+		}
+		crl, err := x509.ParseCRL([]byte(crlStr))
+		if err != nil {
+			logger.Errorf("[Net] validate crl failed, %s", err.Error())
+			return err
+		}
+		revokedPeerIds, err := gn.findRevokedPeerIdsByCRL(crl)
+		if err != nil {
+			return err
+		}
+		for _, pid := range revokedPeerIds {
+			logger.Infof("[Net] revoked peer found(pid: %s)", pid)
+			gn.revokedValidator.AddPeerId(pid)
+			if pc := gn.conns.get(pid); pc != nil {
+				gn.removePeerConn(pc)
+				logger.Infof("[Net] closing revoked peer connection(pid: %s)", pid)
+			}
+		}
+		return nil
+	}
+	return nil
+}
+
+func (gn *GRpcNet) findRevokedPeerIdsByCRL(crl *pkix.CertificateList) ([]string, error) {
+	revokedPeerIds := make([]string, 0)
+	for pid, certBytes := range gn.certRecorder.storeCopy() {
+		cert, err := cmx509.ParseCertificate(certBytes)
+		if err != nil {
+			logger.Errorf("[Net] parse chainmaker certificate failed, %s", err.Error())
+			return nil, err
+		}
+		for _, rc := range crl.TBSCertList.RevokedCertificates {
+			if rc.SerialNumber.Cmp(cert.SerialNumber) == 0 {
+				revokedPeerIds = append(revokedPeerIds, pid)
+				break
+			}
+		}
+	}
+	return revokedPeerIds, nil
+}
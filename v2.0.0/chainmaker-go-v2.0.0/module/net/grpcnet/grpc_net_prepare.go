@@ -0,0 +1,128 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package grpcnet
+
+import (
+	"strings"
+	"sync"
+)
+
+// GRpcNetPrepare prepare the config options.
+type GRpcNetPrepare struct {
+	listenAddr              string              // listenAddr
+	bootstrapsPeers         map[string]struct{} // bootstrapsPeers
+	pubSubMaxMsgSize        int                 // pubSubMaxMsgSize
+	peerStreamPoolSize      int                 // peerStreamPoolSize, unused by gRPC net
+	maxPeerCountAllow       int                 // maxPeerCountAllow
+	peerEliminationStrategy int                 // peerEliminationStrategy, unused by gRPC net
+
+	keyBytes  []byte // keyBytes
+	certBytes []byte // certBytes
+
+	chainTrustRootCertsBytes map[string][][]byte // chainTrustRootCertsBytes
+
+	blackAddresses map[string]struct{} // blackAddresses
+	blackPeerIds   map[string]struct{} // blackPeerIds
+
+	isInsecurity bool
+
+	lock sync.Mutex
+}
+
+func newGRpcNetPrepare() *GRpcNetPrepare {
+	return &GRpcNetPrepare{
+		listenAddr:               DefaultGRpcListenAddress,
+		bootstrapsPeers:          make(map[string]struct{}),
+		maxPeerCountAllow:        DefaultMaxPeerCountAllow,
+		chainTrustRootCertsBytes: make(map[string][][]byte),
+		blackAddresses:           make(map[string]struct{}),
+		blackPeerIds:             make(map[string]struct{}),
+	}
+}
+
+func (g *GRpcNetPrepare) SetIsInsecurity(isInsecurity bool) {
+	g.isInsecurity = isInsecurity
+}
+
+// SetCert set cert with pem bytes.
+func (g *GRpcNetPrepare) SetCert(certPem []byte) {
+	g.certBytes = certPem
+}
+
+// SetKey set private key with pem bytes.
+func (g *GRpcNetPrepare) SetKey(keyPem []byte) {
+	g.keyBytes = keyPem
+}
+
+// SetPubSubMaxMsgSize set max msg size for pub-sub service.(M)
+// It limits the size of all msg received by gRPC net.
+func (g *GRpcNetPrepare) SetPubSubMaxMsgSize(pubSubMaxMsgSize int) {
+	g.pubSubMaxMsgSize = pubSubMaxMsgSize
+}
+
+// maxMsgSize return the max size of msg in bytes.
+func (g *GRpcNetPrepare) maxMsgSize() int {
+	if g.pubSubMaxMsgSize <= 0 {
+		return DefaultGRpcMaxMsgSize
+	}
+	return g.pubSubMaxMsgSize << 20
+}
+
+// SetPeerStreamPoolSize set stream pool max size of each peer.
+// gRPC multiplexes all msg on one stream of each peer, so the size is only recorded.
+func (g *GRpcNetPrepare) SetPeerStreamPoolSize(peerStreamPoolSize int) {
+	g.peerStreamPoolSize = peerStreamPoolSize
+}
+
+// AddBootstrapsPeer add a node address for connecting directly. It can be a seed node address or a consensus node address.
+func (g *GRpcNetPrepare) AddBootstrapsPeer(bootstrapAddr string) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.bootstrapsPeers[bootstrapAddr] = struct{}{}
+}
+
+// AddTrustRootCert add a trust root cert for chain.
+func (g *GRpcNetPrepare) AddTrustRootCert(chainId string, rootCert []byte) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.chainTrustRootCertsBytes[chainId] = append(g.chainTrustRootCertsBytes[chainId], rootCert)
+}
+
+// SetListenAddr set address that the net will listen on.
+//		example: /ip4/127.0.0.1/tcp/10001
+func (g *GRpcNetPrepare) SetListenAddr(listenAddr string) {
+	g.listenAddr = listenAddr
+}
+
+// SetMaxPeerCountAllow set max count of nodes that connected to us.
+func (g *GRpcNetPrepare) SetMaxPeerCountAllow(maxPeerCountAllow int) {
+	g.maxPeerCountAllow = maxPeerCountAllow
+}
+
+// SetPeerEliminationStrategy set the strategy for eliminating node when the count of nodes
+// that connected to us reach the max value. gRPC net always rejects the new inbound node.
+func (g *GRpcNetPrepare) SetPeerEliminationStrategy(peerEliminationStrategy int) {
+	g.peerEliminationStrategy = peerEliminationStrategy
+}
+
+// AddBlackAddress add a black address to blacklist.
+//		example: 192.168.1.18:10000
+//		example: 192.168.1.89
+func (g *GRpcNetPrepare) AddBlackAddress(address string) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	address = strings.ReplaceAll(address, "：", ":")
+	g.blackAddresses[address] = struct{}{}
+}
+
+// AddBlackPeerId add a black node id to blacklist.
+//		example: QmcQHCuAXaFkbcsPUj7e37hXXfZ9DdN7bozseo5oX4qiC4
+func (g *GRpcNetPrepare) AddBlackPeerId(pid string) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.blackPeerIds[pid] = struct{}{}
+}
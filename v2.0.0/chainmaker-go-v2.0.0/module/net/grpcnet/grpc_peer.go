@@ -0,0 +1,243 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package grpcnet
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/multiformats/go-multiaddr"
+	"google.golang.org/grpc"
+)
+
+// blackList is a blacklist for controlling nodes connection.
+type blackList struct {
+	lock      sync.RWMutex
+	addresses map[string]struct{} // addresses contains "ip" or "ip:port"
+	peerIds   map[string]struct{}
+}
+
+func newBlackList() *blackList {
+	return &blackList{addresses: make(map[string]struct{}), peerIds: make(map[string]struct{})}
+}
+
+func (b *blackList) addAddress(address string) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.addresses[address] = struct{}{}
+}
+
+func (b *blackList) addPeerId(pid string) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.peerIds[pid] = struct{}{}
+}
+
+// containsAddress return whether the ip and port exist in blacklist.
+// If not found ip+port, but found ip only, return true.
+func (b *blackList) containsAddress(hostPort string) bool {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	if _, ok := b.addresses[hostPort]; ok {
+		return true
+	}
+	host, _, err := net.SplitHostPort(hostPort)
+	if err != nil {
+		return false
+	}
+	_, ok := b.addresses[host]
+	return ok
+}
+
+func (b *blackList) containsPeerId(pid string) bool {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	_, ok := b.peerIds[pid]
+	return ok
+}
+
+// peerConn is a msg stream connected with a remote peer.
+type peerConn struct {
+	pid      string
+	addr     string // addr is the remote address, "ip:port"
+	outbound bool   // outbound is true if the stream is opened by us
+
+	stream   grpc.Stream
+	sendLock sync.Mutex
+
+	closeOnce sync.Once
+	closeC    chan struct{}
+	// cancel release the resources of the stream, for outbound stream it also closes the client conn.
+	cancel func()
+}
+
+func newPeerConn(pid, addr string, outbound bool, stream grpc.Stream, cancel func()) *peerConn {
+	return &peerConn{
+		pid:      pid,
+		addr:     addr,
+		outbound: outbound,
+		stream:   stream,
+		closeC:   make(chan struct{}),
+		cancel:   cancel,
+	}
+}
+
+func (pc *peerConn) send(f *frame) error {
+	pc.sendLock.Lock()
+	defer pc.sendLock.Unlock()
+	return pc.stream.SendMsg(f)
+}
+
+func (pc *peerConn) close() {
+	pc.closeOnce.Do(func() {
+		close(pc.closeC)
+		if pc.cancel != nil {
+			pc.cancel()
+		}
+	})
+}
+
+// peerConnManager manage the msg streams of the connected peers, one stream for each peer.
+type peerConnManager struct {
+	lock  sync.RWMutex
+	local string // local is the uid of local node
+	conns map[string]*peerConn
+}
+
+func newPeerConnManager() *peerConnManager {
+	return &peerConnManager{conns: make(map[string]*peerConn)}
+}
+
+// add try to add a new conn. If there is a conn of the peer already, the conn opened by the node with the
+// smaller uid is kept, so that both sides keep the same conn when they dial each other at the same time.
+// The conn which is not kept is returned and should be closed by caller.
+func (m *peerConnManager) add(pc *peerConn) (kept bool, dropped *peerConn) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	old, ok := m.conns[pc.pid]
+	if !ok {
+		m.conns[pc.pid] = pc
+		return true, nil
+	}
+	if m.dialer(pc) < m.dialer(old) {
+		m.conns[pc.pid] = pc
+		return true, old
+	}
+	return false, pc
+}
+
+func (m *peerConnManager) dialer(pc *peerConn) string {
+	if pc.outbound {
+		return m.local
+	}
+	return pc.pid
+}
+
+// remove the conn if it is still the current conn of the peer, return true if removed.
+func (m *peerConnManager) remove(pc *peerConn) bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if cur, ok := m.conns[pc.pid]; ok && cur == pc {
+		delete(m.conns, pc.pid)
+		return true
+	}
+	return false
+}
+
+func (m *peerConnManager) get(pid string) *peerConn {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return m.conns[pid]
+}
+
+func (m *peerConnManager) isConnected(pid string) bool {
+	return m.get(pid) != nil
+}
+
+func (m *peerConnManager) count() int {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return len(m.conns)
+}
+
+func (m *peerConnManager) all() []*peerConn {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	conns := make([]*peerConn, 0, len(m.conns))
+	for _, pc := range m.conns {
+		conns = append(conns, pc)
+	}
+	return conns
+}
+
+// seedAddr is the address of a seed node.
+type seedAddr struct {
+	pid  string
+	addr string // addr is "host:port"
+}
+
+// parseSeedAddr parse a seed address.
+//		example: /ip4/127.0.0.1/tcp/10001/p2p/QmcQHCuAXaFkbcsPUj7e37hXXfZ9DdN7bozseo5oX4qiC4
+func parseSeedAddr(seed string) (*seedAddr, error) {
+	ma, err := multiaddr.NewMultiaddr(seed)
+	if err != nil {
+		return nil, err
+	}
+	pid, err := ma.ValueForProtocol(multiaddr.P_P2P)
+	if err != nil {
+		return nil, fmt.Errorf("no node uid found in seed address: %s", seed)
+	}
+	addr, err := multiAddrToHostPort(ma)
+	if err != nil {
+		return nil, err
+	}
+	return &seedAddr{pid: pid, addr: addr}, nil
+}
+
+// parseListenAddr parse the listen address, it may be a multi address or "host:port".
+func parseListenAddr(listenAddr string) (string, error) {
+	if !strings.HasPrefix(listenAddr, "/") {
+		return listenAddr, nil
+	}
+	ma, err := multiaddr.NewMultiaddr(listenAddr)
+	if err != nil {
+		return "", err
+	}
+	return multiAddrToHostPort(ma)
+}
+
+func multiAddrToHostPort(ma multiaddr.Multiaddr) (string, error) {
+	port, err := ma.ValueForProtocol(multiaddr.P_TCP)
+	if err != nil {
+		return "", fmt.Errorf("no tcp port found in address: %s", ma.String())
+	}
+	for _, code := range []int{multiaddr.P_IP4, multiaddr.P_IP6, multiaddr.P_DNS, multiaddr.P_DNS4, multiaddr.P_DNS6} {
+		if host, err := ma.ValueForProtocol(code); err == nil {
+			return net.JoinHostPort(host, port), nil
+		}
+	}
+	return "", fmt.Errorf("no host found in address: %s", ma.String())
+}
+
+// hostPortToMultiAddr format "host:port" as a multi address, it is used to report node address.
+func hostPortToMultiAddr(hostPort string) string {
+	host, port, err := net.SplitHostPort(hostPort)
+	if err != nil {
+		return hostPort
+	}
+	ip := net.ParseIP(host)
+	switch {
+	case ip == nil:
+		return "/dns/" + host + "/tcp/" + port
+	case ip.To4() == nil:
+		return "/ip6/" + host + "/tcp/" + port
+	default:
+		return "/ip4/" + host + "/tcp/" + port
+	}
+}
@@ -0,0 +1,328 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package grpcnet
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"sync"
+
+	"chainmaker.org/chainmaker-go/net/p2p/revoke"
+	cmx509 "chainmaker.org/chainmaker/common/v2/crypto/x509"
+	"chainmaker.org/chainmaker/common/v2/helper"
+	pbac "chainmaker.org/chainmaker/pb-go/v2/accesscontrol"
+	"github.com/tjfoc/gmsm/sm2"
+	"github.com/tjfoc/gmtls"
+	"github.com/tjfoc/gmtls/gmcredentials"
+	"google.golang.org/grpc/credentials"
+)
+
+// ErrorCertIdNotMapped
+var ErrorCertIdNotMapped = errors.New("cert id not mapped")
+
+// peerCertInfo is the tls cert info of a peer recorded when handshaking.
+type peerCertInfo struct {
+	certBytes []byte
+	certId    string
+	chainIds  map[string]struct{}
+}
+
+// peerCertRecorder record the tls cert, the cert id and the chains of the peers.
+type peerCertRecorder struct {
+	lock          sync.RWMutex
+	infos         map[string]*peerCertInfo // infos mapping peer id to the cert info.
+	certIdPeerIds map[string]string        // certIdPeerIds mapping cert id to peer id.
+}
+
+func newPeerCertRecorder() *peerCertRecorder {
+	return &peerCertRecorder{
+		infos:         make(map[string]*peerCertInfo),
+		certIdPeerIds: make(map[string]string),
+	}
+}
+
+func (r *peerCertRecorder) record(pid string, info *peerCertInfo) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if old, ok := r.infos[pid]; ok && old.certId != "" {
+		delete(r.certIdPeerIds, old.certId)
+	}
+	r.infos[pid] = info
+	if info.certId != "" {
+		r.certIdPeerIds[info.certId] = pid
+	}
+}
+
+func (r *peerCertRecorder) remove(pid string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	info, ok := r.infos[pid]
+	if !ok {
+		return
+	}
+	if info.certId != "" {
+		delete(r.certIdPeerIds, info.certId)
+	}
+	delete(r.infos, pid)
+}
+
+func (r *peerCertRecorder) isPeerBelongToChain(pid string, chainId string) bool {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	info, ok := r.infos[pid]
+	if !ok {
+		return false
+	}
+	_, ok = info.chainIds[chainId]
+	return ok
+}
+
+func (r *peerCertRecorder) addPeerChainId(pid string, chainId string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if info, ok := r.infos[pid]; ok {
+		info.chainIds[chainId] = struct{}{}
+	}
+}
+
+func (r *peerCertRecorder) removePeerChainId(pid string, chainId string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if info, ok := r.infos[pid]; ok {
+		delete(info.chainIds, chainId)
+	}
+}
+
+func (r *peerCertRecorder) certOfPeer(pid string) []byte {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	if info, ok := r.infos[pid]; ok {
+		return info.certBytes
+	}
+	return nil
+}
+
+func (r *peerCertRecorder) findPeerIdByCertId(certId string) (string, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	pid, ok := r.certIdPeerIds[certId]
+	if !ok {
+		return "", ErrorCertIdNotMapped
+	}
+	return pid, nil
+}
+
+// storeCopy return a copy of the mapping of peer id to the tls cert bytes.
+func (r *peerCertRecorder) storeCopy() map[string][]byte {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	certs := make(map[string][]byte, len(r.infos))
+	for pid, info := range r.infos {
+		certs[pid] = info.certBytes
+	}
+	return certs
+}
+
+// peerIdFromCert compute the node uid from the tls cert, it is the same as the uid of libp2p net.
+func peerIdFromCert(certBytes []byte) (string, error) {
+	certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certBytes})
+	return helper.GetLibp2pPeerIdFromCert(certPem)
+}
+
+// verifiedCert keeps the tls cert of the peer verified in the latest handshake of a dial.
+type verifiedCert struct {
+	lock      sync.Mutex
+	certBytes []byte
+}
+
+func (v *verifiedCert) set(certBytes []byte) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.certBytes = certBytes
+}
+
+func (v *verifiedCert) get() []byte {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	return v.certBytes
+}
+
+// newTransportCredentials create the tls credentials used by both the server and the client side, gmtls is used
+// if the key of the node is SM2 like libp2p net.
+// When expectedPid is not empty, the handshake fails if the uid of the remote node is not equal to it.
+// The cert of the peer is not recorded here, the conn may still be rejected after the handshake, the cert
+// verified is kept in verified if it is not nil.
+func (gn *GRpcNet) newTransportCredentials(expectedPid string,
+	verified *verifiedCert) credentials.TransportCredentials {
+	verify := func(rawCerts [][]byte) error {
+		if _, err := gn.verifyPeerCert(rawCerts, expectedPid); err != nil {
+			return err
+		}
+		if verified != nil {
+			verified.set(rawCerts[0])
+		}
+		return nil
+	}
+	if gn.isGmTls {
+		return gmcredentials.NewTLS(&gmtls.Config{
+			Certificates: []gmtls.Certificate{gn.gmCertificate},
+			// the cert chain is verified with the trust roots of chains in VerifyPeerCertificate
+			InsecureSkipVerify: true,
+			ClientAuth:         gmtls.RequireAnyClientCert,
+			VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*sm2.Certificate) error {
+				return verify(rawCerts)
+			},
+		})
+	}
+	return credentials.NewTLS(&tls.Config{
+		Certificates: []tls.Certificate{gn.certificate},
+		// the cert chain is verified with the trust roots of chains in VerifyPeerCertificate
+		InsecureSkipVerify: true,
+		ClientAuth:         tls.RequireAnyClientCert,
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			return verify(rawCerts)
+		},
+		MinVersion: tls.VersionTLS12,
+	})
+}
+
+// verifyPeerCert verify the tls cert chain of the peer when handshaking, returns the uid of the peer.
+func (gn *GRpcNet) verifyPeerCert(rawCerts [][]byte, expectedPid string) (string, error) {
+	if len(rawCerts) == 0 {
+		return "", errors.New("no certificate found")
+	}
+	revoked, err := isRevoked(gn.revokedValidator, rawCerts)
+	if err != nil {
+		return "", err
+	}
+	if revoked {
+		return "", errors.New("certificate revoked")
+	}
+	peerId, _, err := gn.peerCertInfo(rawCerts[0])
+	if err != nil {
+		return "", err
+	}
+	if expectedPid != "" && peerId != expectedPid {
+		return "", fmt.Errorf("peer id mismatch, expect %s, got %s", expectedPid, peerId)
+	}
+	if gn.blackList.containsPeerId(peerId) {
+		return "", fmt.Errorf("peer id in blacklist: %s", peerId)
+	}
+	if gn.revokedValidator.ContainsPeerId(peerId) {
+		return "", fmt.Errorf("peer id revoked: %s", peerId)
+	}
+	return peerId, nil
+}
+
+// peerCertInfo parse the tls cert of the peer, returns the uid of the peer and the cert info with the chains
+// whose trust roots verify the cert.
+func (gn *GRpcNet) peerCertInfo(tlsCertBytes []byte) (string, *peerCertInfo, error) {
+	var (
+		chainIds []string
+		certId   []byte
+		err      error
+	)
+	if gn.isGmTls {
+		cert, parseErr := sm2.ParseCertificate(tlsCertBytes)
+		if parseErr != nil {
+			return "", nil, fmt.Errorf("parse certificate failed: %s", parseErr.Error())
+		}
+		chainIds, err = gn.gmTlsChainTrustRoots.VerifyCert(cert)
+		if err == nil {
+			certId, err = cmx509.GetNodeIdFromSm2Certificate(cmx509.OidNodeId, *cert)
+			if err != nil {
+				return "", nil, fmt.Errorf("get cert id failed: %s", err.Error())
+			}
+		}
+	} else {
+		cert, parseErr := x509.ParseCertificate(tlsCertBytes)
+		if parseErr != nil {
+			return "", nil, fmt.Errorf("parse certificate failed: %s", parseErr.Error())
+		}
+		chainIds, err = gn.tlsChainTrustRoots.VerifyCert(cert)
+		if err == nil {
+			certId, err = cmx509.GetNodeIdFromCertificate(cmx509.OidNodeId, *cert)
+			if err != nil {
+				return "", nil, fmt.Errorf("get cert id failed: %s", err.Error())
+			}
+		}
+	}
+	if err != nil {
+		if !gn.prepare.isInsecurity {
+			return "", nil, fmt.Errorf("verify certificate failed: %s", err.Error())
+		}
+		chainIds = nil
+	}
+	peerId, err := peerIdFromCert(tlsCertBytes)
+	if err != nil {
+		return "", nil, fmt.Errorf("parse pid from certificate failed: %s", err.Error())
+	}
+	info := &peerCertInfo{certBytes: tlsCertBytes, certId: string(certId), chainIds: make(map[string]struct{})}
+	for _, chainId := range chainIds {
+		info.chainIds[chainId] = struct{}{}
+	}
+	return peerId, info, nil
+}
+
+// verifyCertOfChain whether the tls cert is verified by the trust roots of the chain.
+func (gn *GRpcNet) verifyCertOfChain(chainId string, tlsCertBytes []byte) (bool, error) {
+	if gn.isGmTls {
+		cert, err := sm2.ParseCertificate(tlsCertBytes)
+		if err != nil {
+			return false, err
+		}
+		return gn.gmTlsChainTrustRoots.VerifyCertOfChain(chainId, cert), nil
+	}
+	cert, err := x509.ParseCertificate(tlsCertBytes)
+	if err != nil {
+		return false, err
+	}
+	return gn.tlsChainTrustRoots.VerifyCertOfChain(chainId, cert), nil
+}
+
+// recordPeerCert record the tls cert of the peer whose conn is kept.
+func (gn *GRpcNet) recordPeerCert(pid string, tlsCertBytes []byte) error {
+	certPid, info, err := gn.peerCertInfo(tlsCertBytes)
+	if err != nil {
+		return err
+	}
+	if certPid != pid {
+		return fmt.Errorf("peer id mismatch, expect %s, got %s", pid, certPid)
+	}
+	gn.certRecorder.record(pid, info)
+	return nil
+}
+
+// peerCertFromAuthInfo returns the tls cert of the peer from the auth info of the conn.
+func peerCertFromAuthInfo(authInfo credentials.AuthInfo) ([]byte, error) {
+	switch info := authInfo.(type) {
+	case credentials.TLSInfo:
+		if len(info.State.PeerCertificates) > 0 {
+			return info.State.PeerCertificates[0].Raw, nil
+		}
+	case gmcredentials.TLSInfo:
+		if len(info.State.PeerCertificates) > 0 {
+			return info.State.PeerCertificates[0].Raw, nil
+		}
+	}
+	return nil, errors.New("tls info not found")
+}
+
+func isRevoked(revokeValidator *revoke.RevokedValidator, rawCerts [][]byte) (bool, error) {
+	members := make([]*pbac.Member, 0, len(rawCerts))
+	for idx := range rawCerts {
+		members = append(members, &pbac.Member{
+			MemberType: pbac.MemberType_CERT,
+			MemberInfo: rawCerts[idx],
+		})
+	}
+	ok, err := revokeValidator.ValidateMemberStatus(members)
+	return !ok, err
+}
@@ -7,6 +7,7 @@ SPDX-License-Identifier: Apache-2.0
 package net
 
 import (
+	"chainmaker.org/chainmaker-go/net/grpcnet"
 	"chainmaker.org/chainmaker-go/net/p2p"
 	netPb "chainmaker.org/chainmaker/pb-go/v2/net"
 	api "chainmaker.org/chainmaker/protocol/v2"
@@ -60,3 +61,4 @@ type Net interface {
 }
 
 var _ Net = (*p2p.LibP2pNet)(nil)
+var _ Net = (*grpcnet.GRpcNet)(nil)
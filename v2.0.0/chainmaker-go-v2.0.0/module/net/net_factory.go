@@ -10,6 +10,7 @@ import (
 	"errors"
 	"io/ioutil"
 
+	"chainmaker.org/chainmaker-go/net/grpcnet"
 	"chainmaker.org/chainmaker-go/net/p2p"
 	"chainmaker.org/chainmaker/protocol/v2"
 )
@@ -35,7 +36,8 @@ func WithListenAddr(addr string) NetOption {
 			n, _ := nf.n.(*p2p.LibP2pNet)
 			n.Prepare().SetListenAddr(addr)
 		case protocol.GRpc:
-			//TODO gRpc
+			n, _ := nf.n.(*grpcnet.GRpcNet)
+			n.Prepare().SetListenAddr(addr)
 		}
 		return nil
 	}
@@ -58,7 +60,9 @@ func WithCrypto(keyFile string, certFile string) NetOption {
 			n.Prepare().SetKey(keyBytes)
 			n.Prepare().SetCert(certBytes)
 		case protocol.GRpc:
-			//TODO gRpc
+			n, _ := nf.n.(*grpcnet.GRpcNet)
+			n.Prepare().SetKey(keyBytes)
+			n.Prepare().SetCert(certBytes)
 		}
 		return nil
 	}
@@ -77,7 +81,10 @@ func WithSeeds(seeds ...string) NetOption {
 				n.Prepare().AddBootstrapsPeer(seed)
 			}
 		case protocol.GRpc:
-			//TODO gRpc
+			n, _ := nf.n.(*grpcnet.GRpcNet)
+			for _, seed := range seeds {
+				n.Prepare().AddBootstrapsPeer(seed)
+			}
 		}
 		return nil
 	}
@@ -91,7 +98,8 @@ func WithPeerStreamPoolSize(size int) NetOption {
 			n, _ := nf.n.(*p2p.LibP2pNet)
 			n.Prepare().SetPeerStreamPoolSize(size)
 		case protocol.GRpc:
-			//TODO gRpc
+			n, _ := nf.n.(*grpcnet.GRpcNet)
+			n.Prepare().SetPeerStreamPoolSize(size)
 		}
 		return nil
 	}
@@ -105,7 +113,8 @@ func WithPubSubMaxMessageSize(size int) NetOption {
 			n, _ := nf.n.(*p2p.LibP2pNet)
 			n.Prepare().SetPubSubMaxMsgSize(size)
 		case protocol.GRpc:
-			//TODO gRpc
+			n, _ := nf.n.(*grpcnet.GRpcNet)
+			n.Prepare().SetPubSubMaxMsgSize(size)
 		}
 		return nil
 	}
@@ -119,7 +128,8 @@ func WithMaxPeerCountAllow(max int) NetOption {
 			n, _ := nf.n.(*p2p.LibP2pNet)
 			n.Prepare().SetMaxPeerCountAllow(max)
 		case protocol.GRpc:
-			//TODO gRpc
+			n, _ := nf.n.(*grpcnet.GRpcNet)
+			n.Prepare().SetMaxPeerCountAllow(max)
 		}
 		return nil
 	}
@@ -133,7 +143,8 @@ func WithPeerEliminationStrategy(strategy int) NetOption {
 			n, _ := nf.n.(*p2p.LibP2pNet)
 			n.Prepare().SetPeerEliminationStrategy(strategy)
 		case protocol.GRpc:
-			//TODO gRpc
+			n, _ := nf.n.(*grpcnet.GRpcNet)
+			n.Prepare().SetPeerEliminationStrategy(strategy)
 		}
 		return nil
 	}
@@ -152,7 +163,10 @@ func WithBlackAddresses(blackAddresses ...string) NetOption {
 				n.Prepare().AddBlackAddress(ba)
 			}
 		case protocol.GRpc:
-			//TODO gRpc
+			n, _ := nf.n.(*grpcnet.GRpcNet)
+			for _, ba := range blackAddresses {
+				n.Prepare().AddBlackAddress(ba)
+			}
 		}
 		return nil
 	}
@@ -171,7 +185,10 @@ func WithBlackNodeIds(blackNodeIds ...string) NetOption {
 				n.Prepare().AddBlackPeerId(bn)
 			}
 		case protocol.GRpc:
-			//TODO gRpc
+			n, _ := nf.n.(*grpcnet.GRpcNet)
+			for _, bn := range blackNodeIds {
+				n.Prepare().AddBlackPeerId(bn)
+			}
 		}
 		return nil
 	}
@@ -184,7 +201,8 @@ func WithMsgCompression(enable bool) NetOption {
 			n, _ := nf.n.(*p2p.LibP2pNet)
 			n.SetCompressMsgBytes(enable)
 		case protocol.GRpc:
-			//TODO gRpc
+			n, _ := nf.n.(*grpcnet.GRpcNet)
+			n.SetCompressMsgBytes(enable)
 		}
 		return nil
 	}
@@ -197,7 +215,8 @@ func WithInsecurity(isInsecurity bool) NetOption {
 			n, _ := nf.n.(*p2p.LibP2pNet)
 			n.Prepare().SetIsInsecurity(isInsecurity)
 		case protocol.GRpc:
-			//TODO gRpc
+			n, _ := nf.n.(*grpcnet.GRpcNet)
+			n.Prepare().SetIsInsecurity(isInsecurity)
 		}
 		return nil
 	}
@@ -216,8 +235,12 @@ func (nf *NetFactory) NewNet(netType protocol.NetType, opts ...NetOption) (Net,
 		}
 		nf.n = localNet
 	case protocol.GRpc:
-		//初始化gRpcNet实现 TODO
-		return nil, nil
+		//初始化gRpcNet实现
+		localNet, err := grpcnet.NewGRpcNet() //创建GRpcNet实例
+		if err != nil {
+			return nil, err
+		}
+		nf.n = localNet
 	default:
 		return nil, ErrorNetType
 	}
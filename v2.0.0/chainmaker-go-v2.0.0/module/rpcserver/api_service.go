@@ -10,7 +10,9 @@ package rpcserver
 import (
 	"context"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"strconv"
 
 	"chainmaker.org/chainmaker-go/blockchain"
 	"chainmaker.org/chainmaker-go/localconf"
@@ -30,6 +32,9 @@ import (
 
 const (
 	SYSTEM_CHAIN = "system_chain"
+	// QUERY_BLOCK_HEIGHT_PARAM is the reserved parameter of query tx, which specifies the block height
+	// that the contract reads state at, the value is a decimal string. It is removed before calling contract.
+	QUERY_BLOCK_HEIGHT_PARAM = "__block_height__"
 )
 
 var _ apiPb.RpcNodeServer = (*ApiService)(nil)
@@ -215,27 +220,39 @@ func (s *ApiService) dealQuery(tx *commonPb.Transaction, source protocol.TxSourc
 		blockVersion:     protocol.DefaultBlockVersion,
 	}
 
-	contract, err := store.GetContractByName(tx.Payload.ContractName)
+	params := s.kvPair2Map(tx.Payload.Parameters)
+	if heightBytes, ok := params[QUERY_BLOCK_HEIGHT_PARAM]; ok {
+		delete(params, QUERY_BLOCK_HEIGHT_PARAM)
+		if err = s.setQueryHeight(ctx, store, heightBytes); err != nil {
+			s.log.Warn(err)
+			resp.Code = commonPb.TxStatusCode_INVALID_PARAMETER
+			resp.Message = err.Error()
+			resp.TxId = tx.Payload.TxId
+			return resp
+		}
+	}
+
+	contract, err := ctx.GetContractByName(tx.Payload.ContractName)
 	if err != nil {
 		s.log.Error(err)
-		resp.Code = commonPb.TxStatusCode_INTERNAL_ERROR
+		resp.Code = archivedStatusCode(err.Error(), commonPb.TxStatusCode_INTERNAL_ERROR)
 		resp.Message = err.Error()
 		resp.TxId = tx.Payload.TxId
 		return resp
 	}
 	var bytecode []byte
 	if contract.RuntimeType != commonPb.RuntimeType_NATIVE {
-		bytecode, err = store.GetContractBytecode(tx.Payload.ContractName)
+		bytecode, err = ctx.GetContractBytecode(tx.Payload.ContractName)
 		if err != nil {
 			s.log.Error(err)
-			resp.Code = commonPb.TxStatusCode_INTERNAL_ERROR
+			resp.Code = archivedStatusCode(err.Error(), commonPb.TxStatusCode_INTERNAL_ERROR)
 			resp.Message = err.Error()
 			resp.TxId = tx.Payload.TxId
 			return resp
 		}
 	}
 	txResult, txStatusCode := vmMgr.RunContract(contract, tx.Payload.Method,
-		bytecode, s.kvPair2Map(tx.Payload.Parameters), ctx, 0, tx.Payload.TxType)
+		bytecode, params, ctx, 0, tx.Payload.TxType)
 	s.log.DebugDynamic(func() string {
 		return fmt.Sprintf("vmMgr.RunContract: txStatusCode:%d, resultCode:%d, contractName[%s] method[%s] txType[%s], message[%s],result len: %d",
 			txStatusCode, txResult.Code, tx.Payload.ContractName, tx.Payload.Method, tx.Payload.TxType, txResult.Message, len(txResult.Result))
@@ -253,12 +270,7 @@ func (s *ApiService) dealQuery(tx *commonPb.Transaction, source protocol.TxSourc
 			txStatusCode, txResult.Code, tx.Payload.ContractName, tx.Payload.Method, tx.Payload.TxType, txResult.Message)
 		s.log.Warn(errMsg)
 
-		resp.Code = txStatusCode
-		if txResult.Message == archive.ErrArchivedBlock.Error() {
-			resp.Code = commonPb.TxStatusCode_ARCHIVED_BLOCK
-		} else if txResult.Message == archive.ErrArchivedTx.Error() {
-			resp.Code = commonPb.TxStatusCode_ARCHIVED_TX
-		}
+		resp.Code = archivedStatusCode(txResult.Message, txStatusCode)
 
 		resp.Message = errMsg
 		resp.ContractResult = txResult
@@ -334,6 +346,35 @@ func (s *ApiService) dealSystemChainQuery(tx *commonPb.Transaction, vmMgr protoc
 	return resp
 }
 
+// setQueryHeight makes the query tx read the state at the given block height through the history db
+func (s *ApiService) setQueryHeight(ctx *txQuerySimContextImpl, store protocol.BlockchainStore,
+	heightBytes []byte) error {
+	height, err := strconv.ParseUint(string(heightBytes), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid %s [%s], %s", QUERY_BLOCK_HEIGHT_PARAM, heightBytes, err)
+	}
+	reader, ok := store.(stateAtHeightReader)
+	if !ok {
+		return errors.New("query at block height is not supported by the store")
+	}
+	ctx.heightReader = reader
+	ctx.queryHeight = height
+	return nil
+}
+
+// archivedStatusCode returns the tx status code of archived block or rwset if the error msg is caused by
+// archiving, otherwise returns the default code
+func archivedStatusCode(errMsg string, defaultCode commonPb.TxStatusCode) commonPb.TxStatusCode {
+	switch errMsg {
+	case archive.ErrArchivedBlock.Error():
+		return commonPb.TxStatusCode_ARCHIVED_BLOCK
+	case archive.ErrArchivedTx.Error(), archive.ErrArchivedRWSet.Error():
+		return commonPb.TxStatusCode_ARCHIVED_TX
+	default:
+		return defaultCode
+	}
+}
+
 // kvPair2Map - change []*commonPb.KeyValuePair to map[string]string
 func (s *ApiService) kvPair2Map(kvPair []*commonPb.KeyValuePair) map[string][]byte {
 	kvMap := make(map[string][]byte)
@@ -0,0 +1,296 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package rpcserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+
+	"chainmaker.org/chainmaker-go/blockchain"
+	"chainmaker.org/chainmaker-go/localconf"
+	"chainmaker.org/chainmaker-go/logger"
+	"chainmaker.org/chainmaker/common/v2/evmutils"
+	pbac "chainmaker.org/chainmaker/pb-go/v2/accesscontrol"
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	configPb "chainmaker.org/chainmaker/pb-go/v2/config"
+	"chainmaker.org/chainmaker/protocol/v2"
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/tjfoc/gmtls"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// ethRpcServicePrefix is the full method prefix of the ethereum json-rpc methods, used by the interceptors
+	ethRpcServicePrefix = "/eth/"
+	ethRpcVersion       = "2.0"
+)
+
+// the error codes of json-rpc 2.0 and the revert code of ethereum
+const (
+	ethRpcErrCodeParse          = -32700
+	ethRpcErrCodeInvalidRequest = -32600
+	ethRpcErrCodeNoMethod       = -32601
+	ethRpcErrCodeInvalidParams  = -32602
+	ethRpcErrCodeServer         = -32000
+	ethRpcErrCodeReverted       = 3
+)
+
+// ethRpcServer serves the ethereum json-rpc api over HTTP, the calls go through the same interceptors as gRPC
+type ethRpcServer struct {
+	service     *ethRpcService
+	interceptor grpc.UnaryServerInterceptor
+	server      *http.Server
+	log         *logger.CMLogger
+}
+
+type ethRpcRequest struct {
+	JsonRpc string          `json:"jsonrpc"`
+	Id      json.RawMessage `json:"id"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+}
+
+type ethRpcResponse struct {
+	JsonRpc string          `json:"jsonrpc"`
+	Id      json.RawMessage `json:"id"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *ethRpcError    `json:"error,omitempty"`
+}
+
+// ethRpcError is the error object of json-rpc 2.0
+type ethRpcError struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+func (e *ethRpcError) Error() string {
+	return e.Message
+}
+
+// newEthRpcServer - new ethereum json-rpc server of the chain in config
+func newEthRpcServer(apiService *ApiService, interceptor grpc.UnaryServerInterceptor) *ethRpcServer {
+	config := localconf.ChainMakerConfig.RpcConfig.EthRpcConfig
+	backend := &apiEthBackend{
+		apiService: apiService,
+		chainId:    config.ChainId,
+	}
+	return newEthRpcServerWithService(newEthRpcService(backend, config.ChainId), interceptor)
+}
+
+func newEthRpcServerWithService(service *ethRpcService, interceptor grpc.UnaryServerInterceptor) *ethRpcServer {
+	e := &ethRpcServer{
+		service:     service,
+		interceptor: interceptor,
+		log:         logger.GetLogger(logger.MODULE_RPC),
+	}
+	e.server = newHttpServer(e)
+	return e
+}
+
+// start - listen on the ethereum json-rpc port, the listener uses the tls config of rpc
+func (e *ethRpcServer) start(chainMakerServer *blockchain.ChainMakerServer) error {
+	endPoint := fmt.Sprintf(":%d", localconf.ChainMakerConfig.RpcConfig.EthRpcConfig.Port)
+	ln, err := net.Listen("tcp", endPoint)
+	if err != nil {
+		return fmt.Errorf("TCP listen failed, %s", err.Error())
+	}
+
+	if localconf.ChainMakerConfig.RpcConfig.TLSConfig.Mode != TLS_MODE_DISABLE {
+		tlsConfig, err := newGatewayTLSConfig(chainMakerServer)
+		if err != nil {
+			ln.Close()
+			return err
+		}
+		ln = gmtls.NewListener(ln, tlsConfig)
+	}
+
+	go func() {
+		if err := e.server.Serve(ln); err != nil && err != http.ErrServerClosed {
+			e.log.Errorf("ethereum json-rpc Serve failed, %s", err.Error())
+		}
+	}()
+
+	e.log.Infof("ethereum json-rpc server of chain[%s] listen on %s", e.service.chainId, endPoint)
+	return nil
+}
+
+// stop - close the ethereum json-rpc server
+func (e *ethRpcServer) stop() {
+	if err := e.server.Close(); err != nil {
+		e.log.Warnf("close ethereum json-rpc server failed, %s", err.Error())
+	}
+}
+
+// ServeHTTP - handle the single or batch json-rpc request in the body of http POST
+func (e *ethRpcServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, fmt.Sprintf("http method %s is not allowed", r.Method), http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, httpMaxBodySize))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("read request body failed, %s", err), http.StatusBadRequest)
+		return
+	}
+
+	var resp interface{}
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		var reqs []*ethRpcRequest
+		if err = json.Unmarshal(body, &reqs); err != nil {
+			resp = newEthRpcErrorResponse(nil, &ethRpcError{Code: ethRpcErrCodeParse, Message: err.Error()})
+		} else if len(reqs) == 0 {
+			resp = newEthRpcErrorResponse(nil, &ethRpcError{Code: ethRpcErrCodeInvalidRequest,
+				Message: "empty batch"})
+		} else {
+			resps := make([]*ethRpcResponse, 0, len(reqs))
+			for _, req := range reqs {
+				resps = append(resps, e.handle(r.Context(), req))
+			}
+			resp = resps
+		}
+	} else {
+		req := &ethRpcRequest{}
+		if err = json.Unmarshal(body, req); err != nil {
+			resp = newEthRpcErrorResponse(nil, &ethRpcError{Code: ethRpcErrCodeParse, Message: err.Error()})
+		} else {
+			resp = e.handle(r.Context(), req)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(resp); err != nil {
+		e.log.Errorf("write ethereum json-rpc response failed, %s", err)
+	}
+}
+
+// handle - call the method of the request through the interceptors
+func (e *ethRpcServer) handle(ctx context.Context, req *ethRpcRequest) *ethRpcResponse {
+	if req.JsonRpc != ethRpcVersion || len(req.Method) == 0 {
+		return newEthRpcErrorResponse(req.Id, &ethRpcError{Code: ethRpcErrCodeInvalidRequest,
+			Message: "invalid json-rpc 2.0 request"})
+	}
+
+	method, ok := e.service.methods[req.Method]
+	if !ok {
+		return newEthRpcErrorResponse(req.Id, &ethRpcError{Code: ethRpcErrCodeNoMethod,
+			Message: fmt.Sprintf("the method %s does not exist/is not available", req.Method)})
+	}
+
+	var params []json.RawMessage
+	if len(req.Params) > 0 && string(req.Params) != "null" {
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return newEthRpcErrorResponse(req.Id, &ethRpcError{Code: ethRpcErrCodeInvalidParams,
+				Message: fmt.Sprintf("the params must be an array, %s", err)})
+		}
+	}
+
+	info := &grpc.UnaryServerInfo{
+		Server:     e.service,
+		FullMethod: ethRpcServicePrefix + req.Method,
+	}
+	result, err := e.interceptor(ctx, params, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return method(req.([]json.RawMessage))
+	})
+	if err != nil {
+		rpcErr, ok := err.(*ethRpcError)
+		if !ok {
+			rpcErr = &ethRpcError{Code: ethRpcErrCodeServer, Message: status.Convert(err).Message()}
+		}
+		return newEthRpcErrorResponse(req.Id, rpcErr)
+	}
+
+	resultBytes, err := json.Marshal(result)
+	if err != nil {
+		return newEthRpcErrorResponse(req.Id, &ethRpcError{Code: ethRpcErrCodeServer, Message: err.Error()})
+	}
+	return &ethRpcResponse{
+		JsonRpc: ethRpcVersion,
+		Id:      req.Id,
+		Result:  resultBytes,
+	}
+}
+
+func newEthRpcErrorResponse(id json.RawMessage, err *ethRpcError) *ethRpcResponse {
+	if len(id) == 0 {
+		id = json.RawMessage("null")
+	}
+	return &ethRpcResponse{
+		JsonRpc: ethRpcVersion,
+		Id:      id,
+		Error:   err,
+	}
+}
+
+// apiEthBackend is the ethBackend of the chain served by ApiService, the txs are signed by the node identity
+type apiEthBackend struct {
+	apiService *ApiService
+	chainId    string
+}
+
+func (b *apiEthBackend) getStore() (protocol.BlockchainStore, error) {
+	return b.apiService.chainMakerServer.GetStore(b.chainId)
+}
+
+func (b *apiEthBackend) getChainConfig() (*configPb.ChainConfig, error) {
+	chainConf, err := b.apiService.chainMakerServer.GetChainConf(b.chainId)
+	if err != nil {
+		return nil, err
+	}
+	return chainConf.ChainConfig(), nil
+}
+
+func (b *apiEthBackend) sendTx(payload *commonPb.Payload) (*commonPb.TxResponse, error) {
+	bc, err := b.apiService.chainMakerServer.GetBlockchain(b.chainId)
+	if err != nil {
+		return nil, err
+	}
+	identity := bc.GetIdentity()
+	signer, err := identity.GetMember()
+	if err != nil {
+		return nil, fmt.Errorf("get node identity failed, %s", err)
+	}
+	payloadBytes, err := payload.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	signature, err := identity.Sign(bc.GetAccessControl().GetHashAlg(), payloadBytes)
+	if err != nil {
+		return nil, fmt.Errorf("sign tx failed, %s", err)
+	}
+	return b.apiService.invoke(&commonPb.Transaction{
+		Payload: payload,
+		Sender: &commonPb.EndorsementEntry{
+			Signer:    signer,
+			Signature: signature,
+		},
+	}, protocol.RPC), nil
+}
+
+func (b *apiEthBackend) getMemberAddress(member *pbac.Member) (ethcommon.Address, error) {
+	bc, err := b.apiService.chainMakerServer.GetBlockchain(b.chainId)
+	if err != nil {
+		return ethcommon.Address{}, err
+	}
+	m, err := bc.GetAccessControl().NewMember(member)
+	if err != nil {
+		return ethcommon.Address{}, err
+	}
+	address, err := evmutils.MakeAddressFromHex(m.GetUid())
+	if err != nil {
+		return ethcommon.Address{}, err
+	}
+	return ethcommon.BigToAddress(address.Int), nil
+}
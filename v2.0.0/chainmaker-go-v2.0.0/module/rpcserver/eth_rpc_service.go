@@ -0,0 +1,957 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package rpcserver
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strconv"
+	"time"
+
+	"chainmaker.org/chainmaker-go/evm"
+	"chainmaker.org/chainmaker-go/evm/evm-go/storage"
+	"chainmaker.org/chainmaker-go/logger"
+	"chainmaker.org/chainmaker-go/utils"
+	"chainmaker.org/chainmaker-go/vm/native/dposmgr"
+	"chainmaker.org/chainmaker/common/v2/evmutils"
+	pbac "chainmaker.org/chainmaker/pb-go/v2/accesscontrol"
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	configPb "chainmaker.org/chainmaker/pb-go/v2/config"
+	"chainmaker.org/chainmaker/pb-go/v2/syscontract"
+	"chainmaker.org/chainmaker/protocol/v2"
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+const (
+	// ethMaxLogBlockRange is the max count of blocks that eth_getLogs scans
+	ethMaxLogBlockRange = 10000
+	// ethMethodLen is the length of method selector in the call data of evm contract
+	ethMethodLen = 4
+)
+
+// ethTxHashReg matches the tx id which can be used as the ethereum tx hash directly
+var ethTxHashReg = regexp.MustCompile("^[0-9a-fA-F]{64}$")
+
+// ethBackend is the chain that the ethereum json-rpc requests are served by
+type ethBackend interface {
+	// getStore returns the blockchain store of the chain
+	getStore() (protocol.BlockchainStore, error)
+	// getChainConfig returns the current chain config
+	getChainConfig() (*configPb.ChainConfig, error)
+	// sendTx signs the tx with the node identity and sends it, the query tx is run and its result is returned
+	sendTx(payload *commonPb.Payload) (*commonPb.TxResponse, error)
+	// getMemberAddress returns the evm address of the member, it is the msg.sender of the member in evm
+	getMemberAddress(member *pbac.Member) (ethcommon.Address, error)
+}
+
+// ethRpcMethod is the method of ethereum json-rpc, it receives the positional params
+type ethRpcMethod func(params []json.RawMessage) (interface{}, error)
+
+// ethRpcService implements the ethereum json-rpc methods on the evm contracts of a chain.
+// The ethereum tx is mapped to a chainmaker tx signed by the node identity, which carries the ethereum tx,
+// so the evm runtime verifies it and takes its signer as msg.sender. The hash of the ethereum tx is the tx id.
+type ethRpcService struct {
+	backend ethBackend
+	chainId string
+	methods map[string]ethRpcMethod
+	log     *logger.CMLogger
+}
+
+// ethCallArgs is the call object of eth_call and eth_estimateGas
+type ethCallArgs struct {
+	From  *ethcommon.Address `json:"from"`
+	To    *ethcommon.Address `json:"to"`
+	Gas   *hexutil.Uint64    `json:"gas"`
+	Value *hexutil.Big       `json:"value"`
+	Data  *hexutil.Bytes     `json:"data"`
+	Input *hexutil.Bytes     `json:"input"`
+}
+
+// ethLogFilter is the filter object of eth_getLogs
+type ethLogFilter struct {
+	BlockHash *ethcommon.Hash   `json:"blockHash"`
+	FromBlock json.RawMessage   `json:"fromBlock"`
+	ToBlock   json.RawMessage   `json:"toBlock"`
+	Address   json.RawMessage   `json:"address"`
+	Topics    []json.RawMessage `json:"topics"`
+}
+
+type ethBlock struct {
+	Number           hexutil.Uint64    `json:"number"`
+	Hash             ethcommon.Hash    `json:"hash"`
+	ParentHash       ethcommon.Hash    `json:"parentHash"`
+	Nonce            types.BlockNonce  `json:"nonce"`
+	Sha3Uncles       ethcommon.Hash    `json:"sha3Uncles"`
+	LogsBloom        types.Bloom       `json:"logsBloom"`
+	TransactionsRoot ethcommon.Hash    `json:"transactionsRoot"`
+	StateRoot        ethcommon.Hash    `json:"stateRoot"`
+	ReceiptsRoot     ethcommon.Hash    `json:"receiptsRoot"`
+	Miner            ethcommon.Address `json:"miner"`
+	Difficulty       *hexutil.Big      `json:"difficulty"`
+	ExtraData        hexutil.Bytes     `json:"extraData"`
+	GasLimit         hexutil.Uint64    `json:"gasLimit"`
+	GasUsed          hexutil.Uint64    `json:"gasUsed"`
+	Timestamp        hexutil.Uint64    `json:"timestamp"`
+	Transactions     []interface{}     `json:"transactions"`
+	Uncles           []ethcommon.Hash  `json:"uncles"`
+}
+
+type ethTransaction struct {
+	Hash             ethcommon.Hash     `json:"hash"`
+	Nonce            hexutil.Uint64     `json:"nonce"`
+	BlockHash        ethcommon.Hash     `json:"blockHash"`
+	BlockNumber      hexutil.Uint64     `json:"blockNumber"`
+	TransactionIndex hexutil.Uint64     `json:"transactionIndex"`
+	From             ethcommon.Address  `json:"from"`
+	To               *ethcommon.Address `json:"to"`
+	Value            *hexutil.Big       `json:"value"`
+	Gas              hexutil.Uint64     `json:"gas"`
+	GasPrice         *hexutil.Big       `json:"gasPrice"`
+	Input            hexutil.Bytes      `json:"input"`
+	V                *hexutil.Big       `json:"v"`
+	R                *hexutil.Big       `json:"r"`
+	S                *hexutil.Big       `json:"s"`
+}
+
+type ethReceipt struct {
+	TransactionHash   ethcommon.Hash     `json:"transactionHash"`
+	TransactionIndex  hexutil.Uint64     `json:"transactionIndex"`
+	BlockHash         ethcommon.Hash     `json:"blockHash"`
+	BlockNumber       hexutil.Uint64     `json:"blockNumber"`
+	From              ethcommon.Address  `json:"from"`
+	To                *ethcommon.Address `json:"to"`
+	CumulativeGasUsed hexutil.Uint64     `json:"cumulativeGasUsed"`
+	GasUsed           hexutil.Uint64     `json:"gasUsed"`
+	ContractAddress   *ethcommon.Address `json:"contractAddress"`
+	Logs              []*types.Log       `json:"logs"`
+	LogsBloom         types.Bloom        `json:"logsBloom"`
+	Status            hexutil.Uint64     `json:"status"`
+}
+
+// newEthRpcService - new ethereum json-rpc service of the chain
+func newEthRpcService(backend ethBackend, chainId string) *ethRpcService {
+	s := &ethRpcService{
+		backend: backend,
+		chainId: chainId,
+		log:     logger.GetLoggerByChain(logger.MODULE_RPC, chainId),
+	}
+	s.methods = map[string]ethRpcMethod{
+		"eth_chainId":               s.chainID,
+		"net_version":               s.netVersion,
+		"eth_blockNumber":           s.blockNumber,
+		"eth_gasPrice":              s.gasPrice,
+		"eth_getBalance":            s.getBalance,
+		"eth_getTransactionCount":   s.getTransactionCount,
+		"eth_getBlockByNumber":      s.getBlockByNumber,
+		"eth_getBlockByHash":        s.getBlockByHash,
+		"eth_getTransactionByHash":  s.getTransactionByHash,
+		"eth_getTransactionReceipt": s.getTransactionReceipt,
+		"eth_getLogs":               s.getLogs,
+		"eth_call":                  s.call,
+		"eth_estimateGas":           s.estimateGas,
+		"eth_sendRawTransaction":    s.sendRawTransaction,
+	}
+	return s
+}
+
+func (s *ethRpcService) chainID([]json.RawMessage) (interface{}, error) {
+	ethChainId, err := s.getEthChainId()
+	if err != nil {
+		return nil, err
+	}
+	return (*hexutil.Big)(ethChainId), nil
+}
+
+func (s *ethRpcService) netVersion([]json.RawMessage) (interface{}, error) {
+	ethChainId, err := s.getEthChainId()
+	if err != nil {
+		return nil, err
+	}
+	return ethChainId.String(), nil
+}
+
+// getEthChainId returns the EIP-155 chain id in chain config, the evm runtime accepts the ethereum tx of it only
+func (s *ethRpcService) getEthChainId() (*big.Int, error) {
+	chainConfig, err := s.backend.getChainConfig()
+	if err != nil {
+		return nil, err
+	}
+	ethChainId, err := utils.GetEthChainId(chainConfig)
+	if err != nil {
+		return nil, err
+	}
+	if ethChainId == nil {
+		return nil, &ethRpcError{Code: ethRpcErrCodeServer,
+			Message: fmt.Sprintf("%s is not set in chain config", utils.EthChainIdConfigKey)}
+	}
+	return ethChainId, nil
+}
+
+func (s *ethRpcService) blockNumber([]json.RawMessage) (interface{}, error) {
+	store, err := s.backend.getStore()
+	if err != nil {
+		return nil, err
+	}
+	block, err := store.GetLastBlock()
+	if err != nil {
+		return nil, err
+	}
+	return hexutil.Uint64(block.Header.BlockHeight), nil
+}
+
+// gasPrice returns the gas price in chain config, the fee of tx is gasUsed * price
+func (s *ethRpcService) gasPrice([]json.RawMessage) (interface{}, error) {
+	chainConfig, err := s.backend.getChainConfig()
+	if err != nil {
+		return nil, err
+	}
+	price, err := utils.GetGasPrice(chainConfig)
+	if err != nil {
+		return nil, err
+	}
+	return (*hexutil.Big)(new(big.Int).SetUint64(price)), nil
+}
+
+// getBalance returns the balance of the evm address in the DPoS ERC20 ledger, the block number is ignored
+func (s *ethRpcService) getBalance(params []json.RawMessage) (interface{}, error) {
+	var address ethcommon.Address
+	if err := parseEthParams(params, 1, &address); err != nil {
+		return nil, err
+	}
+	store, err := s.backend.getStore()
+	if err != nil {
+		return nil, err
+	}
+	account := storage.BalanceAccount(evmutils.FromBigInt(new(big.Int).SetBytes(address.Bytes())))
+	val, err := store.ReadObject(syscontract.SystemContract_DPOS_ERC20.String(),
+		[]byte(fmt.Sprintf(dposmgr.KeyBalanceFormat, account)))
+	if err != nil {
+		return nil, err
+	}
+	balance := new(big.Int)
+	if len(val) > 0 {
+		if _, ok := balance.SetString(string(val), 10); !ok {
+			return nil, fmt.Errorf("invalid balance %s of account %s", val, account)
+		}
+	}
+	return (*hexutil.Big)(balance), nil
+}
+
+// getTransactionCount returns the count of the ethereum txs of the address committed, it is the nonce of the next
+// ethereum tx checked by the evm runtime, the block number is ignored
+func (s *ethRpcService) getTransactionCount(params []json.RawMessage) (interface{}, error) {
+	var address ethcommon.Address
+	if err := parseEthParams(params, 1, &address); err != nil {
+		return nil, err
+	}
+	store, err := s.backend.getStore()
+	if err != nil {
+		return nil, err
+	}
+	val, err := store.ReadObject(utils.TxNonceContractName, utils.EthNonceKey(address.Bytes()))
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := utils.DecodeTxNonce(val)
+	if err != nil {
+		return nil, err
+	}
+	return hexutil.Uint64(nonce), nil
+}
+
+func (s *ethRpcService) getBlockByNumber(params []json.RawMessage) (interface{}, error) {
+	var (
+		number json.RawMessage
+		fullTx bool
+	)
+	if err := parseEthParams(params, 1, &number, &fullTx); err != nil {
+		return nil, err
+	}
+	store, err := s.backend.getStore()
+	if err != nil {
+		return nil, err
+	}
+	height, err := parseEthBlockNumber(store, number)
+	if err != nil {
+		return nil, err
+	}
+	block, err := store.GetBlock(height)
+	if err != nil || block == nil {
+		return nil, err
+	}
+	return s.newEthBlock(block, fullTx)
+}
+
+func (s *ethRpcService) getBlockByHash(params []json.RawMessage) (interface{}, error) {
+	var (
+		hash   ethcommon.Hash
+		fullTx bool
+	)
+	if err := parseEthParams(params, 1, &hash, &fullTx); err != nil {
+		return nil, err
+	}
+	store, err := s.backend.getStore()
+	if err != nil {
+		return nil, err
+	}
+	block, err := store.GetBlockByHash(hash.Bytes())
+	if err != nil || block == nil {
+		return nil, err
+	}
+	return s.newEthBlock(block, fullTx)
+}
+
+func (s *ethRpcService) getTransactionByHash(params []json.RawMessage) (interface{}, error) {
+	block, index, err := s.getBlockOfTx(params)
+	if err != nil || block == nil {
+		return nil, err
+	}
+	return s.newEthTransaction(block, index)
+}
+
+func (s *ethRpcService) getTransactionReceipt(params []json.RawMessage) (interface{}, error) {
+	block, index, err := s.getBlockOfTx(params)
+	if err != nil || block == nil {
+		return nil, err
+	}
+	return s.newEthReceipt(block, index)
+}
+
+// getLogs returns the logs of the evm contracts matching the filter, the heights of the events are looked up
+// in the contract event db if the addresses are specified and it is enabled, otherwise the blocks are scanned
+func (s *ethRpcService) getLogs(params []json.RawMessage) (interface{}, error) {
+	filter := &ethLogFilter{}
+	if err := parseEthParams(params, 1, filter); err != nil {
+		return nil, err
+	}
+	addresses, err := parseEthAddresses(filter.Address)
+	if err != nil {
+		return nil, err
+	}
+	topics, err := parseEthTopics(filter.Topics)
+	if err != nil {
+		return nil, err
+	}
+	store, err := s.backend.getStore()
+	if err != nil {
+		return nil, err
+	}
+
+	logs := make([]*types.Log, 0)
+	if filter.BlockHash != nil {
+		block, err := store.GetBlockByHash(filter.BlockHash.Bytes())
+		if err != nil {
+			return nil, err
+		}
+		if block == nil {
+			return nil, newEthInvalidParamsError("unknown block")
+		}
+		return filterEthLogs(s.newEthBlockLogs(block), addresses, topics), nil
+	}
+
+	heights, err := s.getLogHeights(store, filter, addresses)
+	if err != nil {
+		return nil, err
+	}
+	for _, height := range heights {
+		block, err := store.GetBlock(height)
+		if err != nil {
+			return nil, err
+		}
+		if block == nil {
+			break
+		}
+		logs = append(logs, filterEthLogs(s.newEthBlockLogs(block), addresses, topics)...)
+	}
+	return logs, nil
+}
+
+func (s *ethRpcService) getLogHeights(store protocol.BlockchainStore, filter *ethLogFilter,
+	addresses []ethcommon.Address) ([]uint64, error) {
+	from, err := parseEthBlockNumber(store, filter.FromBlock)
+	if err != nil {
+		return nil, err
+	}
+	to, err := parseEthBlockNumber(store, filter.ToBlock)
+	if err != nil {
+		return nil, err
+	}
+	if from > to {
+		return nil, newEthInvalidParamsError("fromBlock is greater than toBlock")
+	}
+	if to-from >= ethMaxLogBlockRange {
+		return nil, newEthInvalidParamsError(fmt.Sprintf("block range is greater than %d", ethMaxLogBlockRange))
+	}
+
+	reader, ok := store.(contractEventReader)
+	if len(addresses) == 0 || !ok {
+		return ethHeightRange(from, to, nil), nil
+	}
+
+	heightSet := make(map[uint64]struct{})
+	for _, address := range addresses {
+		events, err := reader.GetContractEvents(ethContractName(address), "", from, to)
+		if err != nil {
+			s.log.Debugf("get contract events from db failed, scan the blocks instead, %s", err)
+			return ethHeightRange(from, to, nil), nil
+		}
+		for _, event := range events {
+			heightSet[event.BlockHeight] = struct{}{}
+		}
+	}
+	return ethHeightRange(from, to, heightSet), nil
+}
+
+// ethHeightRange returns the heights in range [from, to] in order, only the heights in set are returned if it is
+// not nil
+func ethHeightRange(from, to uint64, set map[uint64]struct{}) []uint64 {
+	heights := make([]uint64, 0)
+	for height := from; height <= to; height++ {
+		if set == nil {
+			heights = append(heights, height)
+		} else if _, ok := set[height]; ok {
+			heights = append(heights, height)
+		}
+	}
+	return heights
+}
+
+// call runs the query tx mapped from the call object at the block number
+func (s *ethRpcService) call(params []json.RawMessage) (interface{}, error) {
+	resp, err := s.doCall(params)
+	if err != nil {
+		return nil, err
+	}
+	return hexutil.Bytes(resp.ContractResult.Result), nil
+}
+
+// estimateGas returns the gas used by the query tx mapped from the call object
+func (s *ethRpcService) estimateGas(params []json.RawMessage) (interface{}, error) {
+	resp, err := s.doCall(params)
+	if err != nil {
+		return nil, err
+	}
+	return hexutil.Uint64(resp.ContractResult.GasUsed), nil
+}
+
+func (s *ethRpcService) doCall(params []json.RawMessage) (*commonPb.TxResponse, error) {
+	var (
+		args   = &ethCallArgs{}
+		number json.RawMessage
+	)
+	if err := parseEthParams(params, 1, args, &number); err != nil {
+		return nil, err
+	}
+	if args.To == nil {
+		return nil, newEthInvalidParamsError("contract creation is not supported, the `to` is required")
+	}
+	data := args.Input
+	if data == nil {
+		data = args.Data
+	}
+	if data == nil || len(*data) < ethMethodLen {
+		return nil, newEthInvalidParamsError("the data must start with the method selector")
+	}
+
+	payload := s.newPayload(commonPb.TxType_QUERY_CONTRACT, utils.GetRandTxId(), *args.To, *data,
+		(*big.Int)(args.Value))
+	if args.From != nil {
+		payload.Parameters = append(payload.Parameters, &commonPb.KeyValuePair{
+			Key:   evm.EvmEthCallerParamKey,
+			Value: []byte(hex.EncodeToString(args.From.Bytes())),
+		})
+	}
+	if args.Gas != nil && *args.Gas > 0 {
+		payload.Limit = utils.NewTxGasLimit(uint64(*args.Gas))
+	}
+	if height, ok, err := s.parseHistoryBlockNumber(number); err != nil {
+		return nil, err
+	} else if ok {
+		payload.Parameters = append(payload.Parameters, &commonPb.KeyValuePair{
+			Key:   QUERY_BLOCK_HEIGHT_PARAM,
+			Value: []byte(strconv.FormatUint(height, 10)),
+		})
+	}
+
+	resp, err := s.backend.sendTx(payload)
+	if err != nil {
+		return nil, err
+	}
+	switch resp.Code {
+	case commonPb.TxStatusCode_SUCCESS:
+		return resp, nil
+	case commonPb.TxStatusCode_CONTRACT_FAIL:
+		return nil, &ethRpcError{
+			Code:    ethRpcErrCodeReverted,
+			Message: "execution reverted: " + resp.ContractResult.Message,
+			Data:    hexutil.Bytes(resp.ContractResult.Result),
+		}
+	default:
+		return nil, &ethRpcError{Code: ethRpcErrCodeServer, Message: resp.Message}
+	}
+}
+
+// sendRawTransaction sends the invoke tx mapped from the signed ethereum tx, only the replay-protected tx of
+// the chain id in config is accepted and it must call an evm contract
+func (s *ethRpcService) sendRawTransaction(params []json.RawMessage) (interface{}, error) {
+	var rawTx hexutil.Bytes
+	if err := parseEthParams(params, 1, &rawTx); err != nil {
+		return nil, err
+	}
+	tx, _, err := evm.DecodeEthTx(rawTx)
+	if err != nil {
+		return nil, newEthInvalidParamsError(err.Error())
+	}
+	ethChainId, err := s.getEthChainId()
+	if err != nil {
+		return nil, err
+	}
+	if !tx.Protected() || tx.ChainId().Cmp(ethChainId) != 0 {
+		return nil, newEthInvalidParamsError(fmt.Sprintf("only the replay-protected tx of chain id %s is allowed",
+			ethChainId))
+	}
+	if tx.To() == nil {
+		return nil, newEthInvalidParamsError("contract creation is not supported")
+	}
+	if len(tx.Data()) < ethMethodLen {
+		return nil, newEthInvalidParamsError("the data must start with the method selector")
+	}
+
+	txHash := tx.Hash()
+	payload := s.newPayload(commonPb.TxType_INVOKE_CONTRACT, hex.EncodeToString(txHash.Bytes()), *tx.To(),
+		tx.Data(), tx.Value())
+	payload.Parameters = append(payload.Parameters, &commonPb.KeyValuePair{
+		Key:   evm.EvmEthRawTxParamKey,
+		Value: rawTx,
+	})
+	if price := tx.GasPrice(); tx.Gas() > 0 && price.Sign() > 0 && price.IsUint64() {
+		payload.Limit = utils.NewTxGasLimitWithPrice(tx.Gas(), price.Uint64())
+	} else if tx.Gas() > 0 {
+		payload.Limit = utils.NewTxGasLimit(tx.Gas())
+	}
+
+	resp, err := s.backend.sendTx(payload)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Code != commonPb.TxStatusCode_SUCCESS {
+		return nil, &ethRpcError{Code: ethRpcErrCodeServer, Message: resp.Message}
+	}
+	return txHash, nil
+}
+
+// newPayload - new the payload which calls the evm contract with the data and value
+func (s *ethRpcService) newPayload(txType commonPb.TxType, txId string, to ethcommon.Address, data []byte,
+	value *big.Int) *commonPb.Payload {
+	parameters := []*commonPb.KeyValuePair{
+		{
+			Key:   protocol.ContractEvmParamKey,
+			Value: []byte(hex.EncodeToString(data)),
+		},
+	}
+	if value != nil && value.Sign() > 0 {
+		parameters = append(parameters, &commonPb.KeyValuePair{
+			Key:   evm.EvmValueParamKey,
+			Value: []byte(value.String()),
+		})
+	}
+	return &commonPb.Payload{
+		ChainId:      s.chainId,
+		TxType:       txType,
+		TxId:         txId,
+		Timestamp:    time.Now().Unix(),
+		ContractName: ethContractName(to),
+		Method:       hex.EncodeToString(data[:ethMethodLen]),
+		Parameters:   parameters,
+	}
+}
+
+// parseHistoryBlockNumber returns the block height if the block number is not the latest
+func (s *ethRpcService) parseHistoryBlockNumber(number json.RawMessage) (uint64, bool, error) {
+	var tag string
+	if len(number) == 0 || json.Unmarshal(number, &tag) != nil {
+		return 0, false, nil
+	}
+	switch tag {
+	case "", "latest", "pending":
+		return 0, false, nil
+	case "earliest":
+		return 0, true, nil
+	}
+	height, err := hexutil.DecodeUint64(tag)
+	if err != nil {
+		return 0, false, newEthInvalidParamsError(fmt.Sprintf("invalid block number %s, %s", tag, err))
+	}
+	return height, true, nil
+}
+
+// getBlockOfTx returns the block and the index of the tx whose hash is the first param
+func (s *ethRpcService) getBlockOfTx(params []json.RawMessage) (*commonPb.Block, int, error) {
+	var hash ethcommon.Hash
+	if err := parseEthParams(params, 1, &hash); err != nil {
+		return nil, 0, err
+	}
+	store, err := s.backend.getStore()
+	if err != nil {
+		return nil, 0, err
+	}
+	txId := hex.EncodeToString(hash.Bytes())
+	block, err := store.GetBlockByTx(txId)
+	if err != nil || block == nil {
+		return nil, 0, err
+	}
+	for i, tx := range block.Txs {
+		if tx.Payload.TxId == txId {
+			return block, i, nil
+		}
+	}
+	return nil, 0, nil
+}
+
+func (s *ethRpcService) newEthBlock(block *commonPb.Block, fullTx bool) (*ethBlock, error) {
+	miner, err := s.getMemberAddress(block.Header.Proposer)
+	if err != nil {
+		return nil, err
+	}
+	b := &ethBlock{
+		Number:           hexutil.Uint64(block.Header.BlockHeight),
+		Hash:             ethcommon.BytesToHash(block.Header.BlockHash),
+		ParentHash:       ethcommon.BytesToHash(block.Header.PreBlockHash),
+		Sha3Uncles:       types.EmptyUncleHash,
+		TransactionsRoot: ethcommon.BytesToHash(block.Header.TxRoot),
+		StateRoot:        ethcommon.BytesToHash(block.Header.RwSetRoot),
+		Miner:            miner,
+		Difficulty:       (*hexutil.Big)(new(big.Int)),
+		ExtraData:        hexutil.Bytes{},
+		GasLimit:         hexutil.Uint64(protocol.GasLimit),
+		Timestamp:        hexutil.Uint64(block.Header.BlockTimestamp),
+		Transactions:     make([]interface{}, 0, len(block.Txs)),
+		Uncles:           make([]ethcommon.Hash, 0),
+	}
+	for i, tx := range block.Txs {
+		if tx.Result != nil && tx.Result.ContractResult != nil {
+			b.GasUsed += hexutil.Uint64(tx.Result.ContractResult.GasUsed)
+		}
+		if !fullTx {
+			b.Transactions = append(b.Transactions, ethTxHash(tx.Payload.TxId))
+			continue
+		}
+		ethTx, err := s.newEthTransaction(block, i)
+		if err != nil {
+			return nil, err
+		}
+		b.Transactions = append(b.Transactions, ethTx)
+	}
+	b.LogsBloom = types.BytesToBloom(types.LogsBloom(s.newEthBlockLogs(block)))
+	return b, nil
+}
+
+// newEthTransaction returns the ethereum view of the tx in block, the fields of the ethereum tx that the tx is
+// mapped from are used if it exists
+func (s *ethRpcService) newEthTransaction(block *commonPb.Block, index int) (*ethTransaction, error) {
+	tx := block.Txs[index]
+	ethTx := &ethTransaction{
+		Hash:             ethTxHash(tx.Payload.TxId),
+		BlockHash:        ethcommon.BytesToHash(block.Header.BlockHash),
+		BlockNumber:      hexutil.Uint64(block.Header.BlockHeight),
+		TransactionIndex: hexutil.Uint64(index),
+		Value:            (*hexutil.Big)(new(big.Int)),
+		Gas:              hexutil.Uint64(utils.TxGasLimit(tx)),
+		GasPrice:         (*hexutil.Big)(new(big.Int)),
+		Input:            hexutil.Bytes{},
+		V:                (*hexutil.Big)(new(big.Int)),
+		R:                (*hexutil.Big)(new(big.Int)),
+		S:                (*hexutil.Big)(new(big.Int)),
+	}
+	if utils.CheckEvmAddressFormat(tx.Payload.ContractName) {
+		to := ethcommon.HexToAddress(tx.Payload.ContractName)
+		ethTx.To = &to
+	}
+
+	rawTx, data := getEthTxParams(tx)
+	if rawTx == nil {
+		from, err := s.getMemberAddress(tx.Sender.GetSigner())
+		if err != nil {
+			return nil, err
+		}
+		ethTx.From = from
+		ethTx.Input = data
+		return ethTx, nil
+	}
+
+	signedTx, from, err := evm.DecodeEthTx(rawTx)
+	if err != nil {
+		return nil, err
+	}
+	v, r, sig := signedTx.RawSignatureValues()
+	ethTx.Nonce = hexutil.Uint64(signedTx.Nonce())
+	ethTx.From = ethcommon.BigToAddress(from.Int)
+	ethTx.Value = (*hexutil.Big)(signedTx.Value())
+	ethTx.Gas = hexutil.Uint64(signedTx.Gas())
+	ethTx.GasPrice = (*hexutil.Big)(signedTx.GasPrice())
+	ethTx.Input = signedTx.Data()
+	ethTx.V, ethTx.R, ethTx.S = (*hexutil.Big)(v), (*hexutil.Big)(r), (*hexutil.Big)(sig)
+	return ethTx, nil
+}
+
+func (s *ethRpcService) newEthReceipt(block *commonPb.Block, index int) (*ethReceipt, error) {
+	ethTx, err := s.newEthTransaction(block, index)
+	if err != nil {
+		return nil, err
+	}
+	receipt := &ethReceipt{
+		TransactionHash:  ethTx.Hash,
+		TransactionIndex: ethTx.TransactionIndex,
+		BlockHash:        ethTx.BlockHash,
+		BlockNumber:      ethTx.BlockNumber,
+		From:             ethTx.From,
+		To:               ethTx.To,
+		Logs:             make([]*types.Log, 0),
+	}
+	for i := 0; i <= index; i++ {
+		if result := block.Txs[i].Result; result != nil && result.ContractResult != nil {
+			receipt.CumulativeGasUsed += hexutil.Uint64(result.ContractResult.GasUsed)
+		}
+	}
+	if result := block.Txs[index].Result; result != nil && result.ContractResult != nil {
+		receipt.GasUsed = hexutil.Uint64(result.ContractResult.GasUsed)
+	}
+	if result := block.Txs[index].Result; result != nil && result.Code == commonPb.TxStatusCode_SUCCESS &&
+		(result.ContractResult == nil || result.ContractResult.Code == 0) {
+		receipt.Status = hexutil.Uint64(types.ReceiptStatusSuccessful)
+	}
+	for _, ethLog := range s.newEthBlockLogs(block) {
+		if ethLog.TxIndex == uint(index) {
+			receipt.Logs = append(receipt.Logs, ethLog)
+		}
+	}
+	receipt.LogsBloom = types.BytesToBloom(types.LogsBloom(receipt.Logs))
+	return receipt, nil
+}
+
+// newEthBlockLogs returns the logs of the evm contracts in block, they are converted from the contract events
+func (s *ethRpcService) newEthBlockLogs(block *commonPb.Block) []*types.Log {
+	logs := make([]*types.Log, 0)
+	for i, tx := range block.Txs {
+		if tx.Result == nil || tx.Result.ContractResult == nil {
+			continue
+		}
+		for _, event := range tx.Result.ContractResult.ContractEvent {
+			ethLog, ok := contractEventToEthLog(event)
+			if !ok {
+				continue
+			}
+			ethLog.BlockNumber = block.Header.BlockHeight
+			ethLog.BlockHash = ethcommon.BytesToHash(block.Header.BlockHash)
+			ethLog.TxHash = ethTxHash(tx.Payload.TxId)
+			ethLog.TxIndex = uint(i)
+			ethLog.Index = uint(len(logs))
+			logs = append(logs, ethLog)
+		}
+	}
+	return logs
+}
+
+func (s *ethRpcService) getMemberAddress(member *pbac.Member) (ethcommon.Address, error) {
+	if member == nil {
+		return ethcommon.Address{}, nil
+	}
+	return s.backend.getMemberAddress(member)
+}
+
+// contractEventToEthLog converts the contract event of evm contract to the ethereum log,
+// the topic of event is the first topic of log, the event data are the other topics and the log data at last
+func contractEventToEthLog(event *commonPb.ContractEvent) (*types.Log, bool) {
+	if !utils.CheckEvmAddressFormat(event.ContractName) {
+		return nil, false
+	}
+	ethLog := &types.Log{
+		Address: ethcommon.HexToAddress(event.ContractName),
+		Topics:  make([]ethcommon.Hash, 0, len(event.EventData)),
+		Data:    []byte{},
+	}
+	hexTopics := event.EventData
+	if len(event.EventData) > 0 {
+		data, err := hex.DecodeString(event.EventData[len(event.EventData)-1])
+		if err != nil {
+			return nil, false
+		}
+		ethLog.Data = data
+		hexTopics = event.EventData[:len(event.EventData)-1]
+	}
+	if len(event.Topic) > 0 {
+		hexTopics = append([]string{event.Topic}, hexTopics...)
+	}
+	for _, hexTopic := range hexTopics {
+		topic, err := hex.DecodeString(hexTopic)
+		if err != nil || len(topic) > ethcommon.HashLength {
+			return nil, false
+		}
+		ethLog.Topics = append(ethLog.Topics, ethcommon.BytesToHash(topic))
+	}
+	return ethLog, true
+}
+
+// filterEthLogs returns the logs emitted by one of the addresses and matching the topics by position,
+// the empty addresses or topics at a position match any
+func filterEthLogs(logs []*types.Log, addresses []ethcommon.Address, topics [][]ethcommon.Hash) []*types.Log {
+	filtered := make([]*types.Log, 0, len(logs))
+	for _, ethLog := range logs {
+		if len(addresses) > 0 && !containsEthAddress(addresses, ethLog.Address) {
+			continue
+		}
+		if len(topics) > len(ethLog.Topics) {
+			continue
+		}
+		match := true
+		for i, sub := range topics {
+			if len(sub) > 0 && !containsEthHash(sub, ethLog.Topics[i]) {
+				match = false
+				break
+			}
+		}
+		if match {
+			filtered = append(filtered, ethLog)
+		}
+	}
+	return filtered
+}
+
+func containsEthAddress(addresses []ethcommon.Address, address ethcommon.Address) bool {
+	for _, a := range addresses {
+		if a == address {
+			return true
+		}
+	}
+	return false
+}
+
+func containsEthHash(hashes []ethcommon.Hash, hash ethcommon.Hash) bool {
+	for _, h := range hashes {
+		if h == hash {
+			return true
+		}
+	}
+	return false
+}
+
+// getEthTxParams returns the raw ethereum tx and the call data of evm contract in the tx params
+func getEthTxParams(tx *commonPb.Transaction) (rawTx []byte, data []byte) {
+	for _, kv := range tx.Payload.Parameters {
+		switch kv.Key {
+		case evm.EvmEthRawTxParamKey:
+			rawTx = kv.Value
+		case protocol.ContractEvmParamKey:
+			data, _ = hex.DecodeString(string(kv.Value))
+		}
+	}
+	if data == nil {
+		data = []byte{}
+	}
+	return rawTx, data
+}
+
+// ethTxHash returns the ethereum tx hash of the tx id, the tx id which is not a 32 bytes hex string is hashed
+func ethTxHash(txId string) ethcommon.Hash {
+	if ethTxHashReg.MatchString(txId) {
+		return ethcommon.HexToHash(txId)
+	}
+	return ethcommon.BytesToHash(evmutils.Keccak256([]byte(txId)))
+}
+
+// ethContractName returns the name of evm contract at the address, it is the 40 characters hex string
+func ethContractName(address ethcommon.Address) string {
+	return hex.EncodeToString(address.Bytes())
+}
+
+// parseEthParams unmarshal the positional params to the args, the first required args must be present
+func parseEthParams(params []json.RawMessage, required int, args ...interface{}) error {
+	if len(params) < required {
+		return newEthInvalidParamsError(fmt.Sprintf("missing value for required argument %d", len(params)))
+	}
+	if len(params) > len(args) {
+		return newEthInvalidParamsError(fmt.Sprintf("too many arguments, want at most %d", len(args)))
+	}
+	for i, param := range params {
+		if err := json.Unmarshal(param, args[i]); err != nil {
+			return newEthInvalidParamsError(fmt.Sprintf("invalid argument %d: %s", i, err))
+		}
+	}
+	return nil
+}
+
+// parseEthBlockNumber returns the block height of the block number, the latest height is returned if it is empty
+func parseEthBlockNumber(store protocol.BlockchainStore, number json.RawMessage) (uint64, error) {
+	var tag string
+	if len(number) > 0 && string(number) != "null" {
+		if err := json.Unmarshal(number, &tag); err != nil {
+			return 0, newEthInvalidParamsError(fmt.Sprintf("invalid block number %s", number))
+		}
+	}
+	switch tag {
+	case "", "latest", "pending":
+		block, err := store.GetLastBlock()
+		if err != nil {
+			return 0, err
+		}
+		return block.Header.BlockHeight, nil
+	case "earliest":
+		return 0, nil
+	}
+	height, err := hexutil.DecodeUint64(tag)
+	if err != nil {
+		return 0, newEthInvalidParamsError(fmt.Sprintf("invalid block number %s, %s", tag, err))
+	}
+	return height, nil
+}
+
+// parseEthAddresses parses the address of log filter, it is null, an address or an array of addresses
+func parseEthAddresses(raw json.RawMessage) ([]ethcommon.Address, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	var address ethcommon.Address
+	if err := json.Unmarshal(raw, &address); err == nil {
+		return []ethcommon.Address{address}, nil
+	}
+	var addresses []ethcommon.Address
+	if err := json.Unmarshal(raw, &addresses); err != nil {
+		return nil, newEthInvalidParamsError(fmt.Sprintf("invalid address %s", raw))
+	}
+	return addresses, nil
+}
+
+// parseEthTopics parses the topics of log filter, each position is null, a topic or an array of topics
+func parseEthTopics(raws []json.RawMessage) ([][]ethcommon.Hash, error) {
+	topics := make([][]ethcommon.Hash, 0, len(raws))
+	for _, raw := range raws {
+		if len(raw) == 0 || string(raw) == "null" {
+			topics = append(topics, nil)
+			continue
+		}
+		var topic ethcommon.Hash
+		if err := json.Unmarshal(raw, &topic); err == nil {
+			topics = append(topics, []ethcommon.Hash{topic})
+			continue
+		}
+		var sub []ethcommon.Hash
+		if err := json.Unmarshal(raw, &sub); err != nil {
+			return nil, newEthInvalidParamsError(fmt.Sprintf("invalid topic %s", raw))
+		}
+		topics = append(topics, sub)
+	}
+	return topics, nil
+}
+
+func newEthInvalidParamsError(msg string) error {
+	return &ethRpcError{Code: ethRpcErrCodeInvalidParams, Message: msg}
+}
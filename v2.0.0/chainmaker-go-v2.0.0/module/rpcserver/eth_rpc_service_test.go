@@ -0,0 +1,292 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package rpcserver
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"chainmaker.org/chainmaker-go/evm"
+	"chainmaker.org/chainmaker-go/utils"
+	pbac "chainmaker.org/chainmaker/pb-go/v2/accesscontrol"
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	configPb "chainmaker.org/chainmaker/pb-go/v2/config"
+	"chainmaker.org/chainmaker/pb-go/v2/syscontract"
+	"chainmaker.org/chainmaker/protocol/v2"
+	"chainmaker.org/chainmaker/protocol/v2/mock"
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+// the signed ethereum tx recorded in testdata, it is signed by the first account of hardhat with chain id 1337
+// and transfers 100 tokens of the ERC20 contract to the receiver
+const (
+	testEthRawTx    = "f8a78080830186a0945fbdb2315678afecb367f032d93f642f64180aa380b844a9059cbb00000000000000000000000070997970c51812dc3a010c7d01b50e0d17dc79c80000000000000000000000000000000000000000000000000000000000000064820a95a0e8013ab7eff7746ea97111636c466cd1a7bd3ec5f8abb5011dfd4d6fe44222ada0296906045d784c6ea6cb0284e0d4d0208a7cfbf02923e190b0f711dee44a4915"
+	testEthTxHash   = "944f06b9013ad580e9bf0964d3f1ff9f8231a63ed09988cf0770e07e736b4c4c"
+	testEthTxData   = "a9059cbb00000000000000000000000070997970c51812dc3a010c7d01b50e0d17dc79c80000000000000000000000000000000000000000000000000000000000000064"
+	testEthSender   = "f39fd6e51aad88f6f4ce6ab8827279cfffb92266"
+	testEthReceiver = "70997970c51812dc3a010c7d01b50e0d17dc79c8"
+	testEthContract = "5fbdb2315678afecb367f032d93f642f64180aa3"
+	testEthProposer = "2c7536e3605d9c16a7a3d7b1898e529396a65c23"
+	testEthTransfer = "ddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"
+)
+
+type mockEthBackend struct {
+	store    protocol.BlockchainStore
+	payloads []*commonPb.Payload
+}
+
+func (b *mockEthBackend) getStore() (protocol.BlockchainStore, error) {
+	return b.store, nil
+}
+
+func (b *mockEthBackend) getChainConfig() (*configPb.ChainConfig, error) {
+	return &configPb.ChainConfig{Consensus: &configPb.ConsensusConfig{ExtConfig: []*configPb.ConfigKeyValue{
+		{Key: utils.EthChainIdConfigKey, Value: "1337"},
+	}}}, nil
+}
+
+func (b *mockEthBackend) sendTx(payload *commonPb.Payload) (*commonPb.TxResponse, error) {
+	b.payloads = append(b.payloads, payload)
+	return &commonPb.TxResponse{
+		Code: commonPb.TxStatusCode_SUCCESS,
+		ContractResult: &commonPb.ContractResult{
+			Result:  ethcommon.BigToHash(big.NewInt(100)).Bytes(),
+			GasUsed: 21000,
+		},
+		TxId: payload.TxId,
+	}, nil
+}
+
+func (b *mockEthBackend) getMemberAddress(*pbac.Member) (ethcommon.Address, error) {
+	return ethcommon.HexToAddress(testEthProposer), nil
+}
+
+func padEthTopic(hexStr string) string {
+	return hex.EncodeToString(ethcommon.HexToHash(hexStr).Bytes())
+}
+
+func newTestEthBlocks(t *testing.T) map[uint64]*commonPb.Block {
+	rawTx, err := hex.DecodeString(testEthRawTx)
+	require.NoError(t, err)
+	proposer := &pbac.Member{OrgId: "wx-org1.chainmaker.org", MemberInfo: []byte("consensus1")}
+	newHeader := func(height uint64, hash, preHash, root byte, timestamp int64) *commonPb.BlockHeader {
+		return &commonPb.BlockHeader{
+			ChainId:        "chain1",
+			BlockHeight:    height,
+			BlockHash:      bytes.Repeat([]byte{hash}, 32),
+			PreBlockHash:   bytes.Repeat([]byte{preHash}, 32),
+			TxRoot:         bytes.Repeat([]byte{root}, 32),
+			RwSetRoot:      bytes.Repeat([]byte{root + 0x11}, 32),
+			BlockTimestamp: timestamp,
+			Proposer:       proposer,
+		}
+	}
+
+	block0 := &commonPb.Block{Header: newHeader(0, 0x00, 0x00, 0x00, 1629999980)}
+	block1 := &commonPb.Block{Header: newHeader(1, 0x11, 0x00, 0x00, 1629999990)}
+	block1.Header.RwSetRoot = make([]byte, 32)
+	block2 := &commonPb.Block{
+		Header: newHeader(2, 0x22, 0x11, 0x33, 1630000000),
+		Txs: []*commonPb.Transaction{
+			{
+				Payload: &commonPb.Payload{
+					ChainId:      "chain1",
+					TxType:       commonPb.TxType_INVOKE_CONTRACT,
+					TxId:         testEthTxHash,
+					Timestamp:    1630000000,
+					ContractName: testEthContract,
+					Method:       testEthTxData[:8],
+					Parameters: []*commonPb.KeyValuePair{
+						{Key: protocol.ContractEvmParamKey, Value: []byte(testEthTxData)},
+						{Key: evm.EvmEthRawTxParamKey, Value: rawTx},
+					},
+					Limit: utils.NewTxGasLimit(100000),
+				},
+				Sender: &commonPb.EndorsementEntry{Signer: proposer},
+				Result: &commonPb.Result{
+					Code: commonPb.TxStatusCode_SUCCESS,
+					ContractResult: &commonPb.ContractResult{
+						Result:  ethcommon.BigToHash(big.NewInt(1)).Bytes(),
+						GasUsed: 35000,
+						ContractEvent: []*commonPb.ContractEvent{
+							{
+								Topic:           testEthTransfer,
+								TxId:            testEthTxHash,
+								ContractName:    testEthContract,
+								ContractVersion: "1.0",
+								EventData: []string{padEthTopic(testEthSender), padEthTopic(testEthReceiver),
+									padEthTopic("64")},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	return map[uint64]*commonPb.Block{0: block0, 1: block1, 2: block2}
+}
+
+func newTestEthRpcServer(t *testing.T) (*httptest.Server, *mockEthBackend) {
+	ctrl := gomock.NewController(t)
+	t.Cleanup(ctrl.Finish)
+
+	blocks := newTestEthBlocks(t)
+	store := mock.NewMockBlockchainStore(ctrl)
+	store.EXPECT().GetLastBlock().Return(blocks[2], nil).AnyTimes()
+	store.EXPECT().GetBlock(gomock.Any()).DoAndReturn(func(height uint64) (*commonPb.Block, error) {
+		return blocks[height], nil
+	}).AnyTimes()
+	store.EXPECT().GetBlockByHash(gomock.Any()).DoAndReturn(func(hash []byte) (*commonPb.Block, error) {
+		for _, block := range blocks {
+			if bytes.Equal(block.Header.BlockHash, hash) {
+				return block, nil
+			}
+		}
+		return nil, nil
+	}).AnyTimes()
+	store.EXPECT().GetBlockByTx(gomock.Any()).DoAndReturn(func(txId string) (*commonPb.Block, error) {
+		if txId == testEthTxHash {
+			return blocks[2], nil
+		}
+		return nil, nil
+	}).AnyTimes()
+	store.EXPECT().ReadObject(syscontract.SystemContract_DPOS_ERC20.String(),
+		[]byte("B/"+testEthSender)).Return([]byte("1000000000000000000"), nil).AnyTimes()
+
+	store.EXPECT().ReadObject(utils.TxNonceContractName,
+		utils.EthNonceKey(ethcommon.HexToAddress(testEthSender).Bytes())).Return(utils.EncodeTxNonce(1), nil).AnyTimes()
+	store.EXPECT().ReadObject(utils.TxNonceContractName, gomock.Any()).Return(nil, nil).AnyTimes()
+
+	backend := &mockEthBackend{store: store}
+	service := newEthRpcService(backend, "chain1")
+	server := httptest.NewServer(newEthRpcServerWithService(service, newUnaryInterceptor()))
+	t.Cleanup(server.Close)
+	return server, backend
+}
+
+func postEthRpc(t *testing.T, server *httptest.Server, body []byte) interface{} {
+	resp, err := http.Post(server.URL, "application/json", bytes.NewReader(body))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var result interface{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+	return result
+}
+
+// TestEthRpcServer_Recorded replays the requests recorded in testdata and compares the responses
+func TestEthRpcServer_Recorded(t *testing.T) {
+	server, _ := newTestEthRpcServer(t)
+
+	recorded, err := ioutil.ReadFile("testdata/eth_rpc_recorded.json")
+	require.NoError(t, err)
+	var cases []struct {
+		Name     string          `json:"name"`
+		Request  json.RawMessage `json:"request"`
+		Response json.RawMessage `json:"response"`
+	}
+	require.NoError(t, json.Unmarshal(recorded, &cases))
+	require.NotEmpty(t, cases)
+
+	for _, c := range cases {
+		var expected interface{}
+		require.NoError(t, json.Unmarshal(c.Response, &expected), c.Name)
+		require.Equal(t, expected, postEthRpc(t, server, c.Request), c.Name)
+	}
+}
+
+func TestEthRpcServer_Batch(t *testing.T) {
+	server, _ := newTestEthRpcServer(t)
+
+	result := postEthRpc(t, server, []byte(`[{"jsonrpc":"2.0","id":1,"method":"eth_chainId"},
+		{"jsonrpc":"2.0","id":"2","method":"eth_blockNumber","params":[]},
+		{"jsonrpc":"1.0","id":3,"method":"eth_blockNumber"}]`))
+	resps, ok := result.([]interface{})
+	require.True(t, ok)
+	require.Len(t, resps, 3)
+	require.Equal(t, map[string]interface{}{"jsonrpc": "2.0", "id": float64(1), "result": "0x539"}, resps[0])
+	require.Equal(t, map[string]interface{}{"jsonrpc": "2.0", "id": "2", "result": "0x2"}, resps[1])
+	require.Equal(t, float64(ethRpcErrCodeInvalidRequest),
+		resps[2].(map[string]interface{})["error"].(map[string]interface{})["code"])
+
+	// the count of the committed ethereum txs is the nonce of the next tx
+	result = postEthRpc(t, server, []byte(`[{"jsonrpc":"2.0","id":1,"method":"eth_getTransactionCount",
+		"params":["0x`+testEthSender+`","latest"]},{"jsonrpc":"2.0","id":2,"method":"eth_getTransactionCount",
+		"params":["0x`+testEthReceiver+`","latest"]}]`))
+	resps, ok = result.([]interface{})
+	require.True(t, ok)
+	require.Equal(t, "0x1", resps[0].(map[string]interface{})["result"])
+	require.Equal(t, "0x0", resps[1].(map[string]interface{})["result"])
+
+	result = postEthRpc(t, server, []byte(`[]`))
+	require.Equal(t, float64(ethRpcErrCodeInvalidRequest),
+		result.(map[string]interface{})["error"].(map[string]interface{})["code"])
+
+	resp, err := http.Get(server.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
+
+func TestEthRpcService_MapTx(t *testing.T) {
+	server, backend := newTestEthRpcServer(t)
+	getParam := func(payload *commonPb.Payload, key string) string {
+		for _, kv := range payload.Parameters {
+			if kv.Key == key {
+				return string(kv.Value)
+			}
+		}
+		return ""
+	}
+
+	// the raw tx is sent as the invoke tx whose id is the ethereum tx hash
+	postEthRpc(t, server, []byte(`{"jsonrpc":"2.0","id":1,"method":"eth_sendRawTransaction","params":["0x`+
+		testEthRawTx+`"]}`))
+	require.Len(t, backend.payloads, 1)
+	payload := backend.payloads[0]
+	require.Equal(t, commonPb.TxType_INVOKE_CONTRACT, payload.TxType)
+	require.Equal(t, "chain1", payload.ChainId)
+	require.Equal(t, testEthTxHash, payload.TxId)
+	require.Equal(t, testEthContract, payload.ContractName)
+	require.Equal(t, "a9059cbb", payload.Method)
+	require.Equal(t, testEthTxData, getParam(payload, protocol.ContractEvmParamKey))
+	require.Equal(t, testEthRawTx, hex.EncodeToString([]byte(getParam(payload, evm.EvmEthRawTxParamKey))))
+	require.Equal(t, "", getParam(payload, evm.EvmValueParamKey))
+	require.Equal(t, uint64(100000), utils.TxGasLimit(&commonPb.Transaction{Payload: payload}))
+
+	// the call at a history block is the query tx with the caller and the block height
+	postEthRpc(t, server, []byte(`{"jsonrpc":"2.0","id":2,"method":"eth_call","params":[{"from":"0x`+
+		testEthSender+`","to":"0x`+testEthContract+`","data":"0x70a08231","value":"0x64"},"0x1"]}`))
+	require.Len(t, backend.payloads, 2)
+	payload = backend.payloads[1]
+	require.Equal(t, commonPb.TxType_QUERY_CONTRACT, payload.TxType)
+	require.Equal(t, testEthContract, payload.ContractName)
+	require.Equal(t, "70a08231", payload.Method)
+	require.Equal(t, testEthSender, getParam(payload, evm.EvmEthCallerParamKey))
+	require.Equal(t, "100", getParam(payload, evm.EvmValueParamKey))
+	require.Equal(t, "1", getParam(payload, QUERY_BLOCK_HEIGHT_PARAM))
+
+	// the invalid ethereum tx and the call without method selector are rejected before sent
+	for _, req := range []string{
+		`{"jsonrpc":"2.0","id":3,"method":"eth_sendRawTransaction","params":["0xf86b"]}`,
+		`{"jsonrpc":"2.0","id":4,"method":"eth_call","params":[{"to":"0x` + testEthContract + `","data":"0x70"}]}`,
+	} {
+		result := postEthRpc(t, server, []byte(req))
+		require.Equal(t, float64(ethRpcErrCodeInvalidParams),
+			result.(map[string]interface{})["error"].(map[string]interface{})["code"], req)
+	}
+	require.Len(t, backend.payloads, 2)
+}
@@ -4,6 +4,7 @@ go 1.15
 
 require (
 	chainmaker.org/chainmaker-go/blockchain v0.0.0
+	chainmaker.org/chainmaker-go/evm v0.0.0
 	chainmaker.org/chainmaker-go/localconf v0.0.0
 	chainmaker.org/chainmaker-go/logger v0.0.0
 	chainmaker.org/chainmaker-go/monitor v0.0.0
@@ -14,9 +15,14 @@ require (
 	chainmaker.org/chainmaker/common/v2 v2.0.0
 	chainmaker.org/chainmaker/pb-go/v2 v2.0.0
 	chainmaker.org/chainmaker/protocol/v2 v2.0.0
+	github.com/ethereum/go-ethereum v1.10.3
 	github.com/gogo/protobuf v1.3.2
+	github.com/golang/mock v1.6.0
 	github.com/grpc-ecosystem/go-grpc-middleware v1.3.0
 	github.com/prometheus/client_golang v1.9.0
+	github.com/stretchr/testify v1.7.0
+	github.com/tjfoc/gmsm v1.3.2
+	github.com/tjfoc/gmtls v1.2.1
 	golang.org/x/time v0.0.0-20210220033141-f8bda1e9f3ba
 	google.golang.org/grpc v1.37.0
 )
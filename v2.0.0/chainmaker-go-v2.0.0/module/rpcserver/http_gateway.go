@@ -0,0 +1,390 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package rpcserver
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"time"
+
+	"chainmaker.org/chainmaker-go/blockchain"
+	"chainmaker.org/chainmaker-go/localconf"
+	"chainmaker.org/chainmaker-go/logger"
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	configPb "chainmaker.org/chainmaker/pb-go/v2/config"
+	"github.com/gogo/protobuf/jsonpb"
+	"github.com/gogo/protobuf/proto"
+	"github.com/tjfoc/gmsm/sm2"
+	"github.com/tjfoc/gmtls"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// gatewayPathPrefix is the url path prefix of the http gateway, the method name of RpcNode follows it
+	gatewayPathPrefix = "/v1/"
+	// rpcNodeServicePrefix is the gRPC full method prefix of RpcNode, used by the interceptors
+	rpcNodeServicePrefix = "/api.RpcNode/"
+
+	// httpMaxBodySize is the max size of the request body of the http servers, the bytes fields are base64 encoded
+	// in JSON, so it is twice the max size of the message received by gRPC
+	httpMaxBodySize = 2 * rpcMaxRecvMsgSize
+
+	// the timeouts of the http servers, the write deadline of the subscription is cleared after it starts
+	httpReadTimeout  = 30 * time.Second
+	httpWriteTimeout = 60 * time.Second
+	httpIdleTimeout  = 120 * time.Second
+)
+
+// httpConnContextKey is the context key of the connection of the http request
+type httpConnContextKey struct{}
+
+var (
+	gatewayMarshaler   = &jsonpb.Marshaler{OrigName: true, EmitDefaults: true}
+	gatewayUnmarshaler = &jsonpb.Unmarshaler{AllowUnknownFields: true}
+)
+
+// httpGateway serves the RpcNode api in JSON over HTTP,
+// the requests go through the same interceptors as gRPC and the subscription is pushed by Server-Sent Events
+type httpGateway struct {
+	apiService  *ApiService
+	interceptor grpc.UnaryServerInterceptor
+	server      *http.Server
+	log         *logger.CMLogger
+}
+
+// unaryCall calls the method of ApiService with the request
+type unaryCall func(ctx context.Context, req proto.Message) (proto.Message, error)
+
+// newHttpGateway - new http gateway of the api service, the interceptor is shared with gRPC
+func newHttpGateway(apiService *ApiService, interceptor grpc.UnaryServerInterceptor) *httpGateway {
+	g := &httpGateway{
+		apiService:  apiService,
+		interceptor: interceptor,
+		log:         logger.GetLogger(logger.MODULE_RPC),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(gatewayPathPrefix+"SendRequest", g.handleUnary("SendRequest",
+		func() proto.Message { return &commonPb.TxRequest{} },
+		func(ctx context.Context, req proto.Message) (proto.Message, error) {
+			return apiService.SendRequest(ctx, req.(*commonPb.TxRequest))
+		}))
+	mux.HandleFunc(gatewayPathPrefix+"GetChainMakerVersion", g.handleUnary("GetChainMakerVersion",
+		func() proto.Message { return &configPb.ChainMakerVersionRequest{} },
+		func(ctx context.Context, req proto.Message) (proto.Message, error) {
+			return apiService.GetChainMakerVersion(ctx, req.(*configPb.ChainMakerVersionRequest))
+		}))
+	mux.HandleFunc(gatewayPathPrefix+"CheckNewBlockChainConfig", g.handleUnary("CheckNewBlockChainConfig",
+		func() proto.Message { return &configPb.CheckNewBlockChainConfigRequest{} },
+		func(ctx context.Context, req proto.Message) (proto.Message, error) {
+			return apiService.CheckNewBlockChainConfig(ctx, req.(*configPb.CheckNewBlockChainConfigRequest))
+		}))
+	mux.HandleFunc(gatewayPathPrefix+"RefreshLogLevelsConfig", g.handleUnary("RefreshLogLevelsConfig",
+		func() proto.Message { return &configPb.LogLevelsRequest{} },
+		func(ctx context.Context, req proto.Message) (proto.Message, error) {
+			return apiService.RefreshLogLevelsConfig(ctx, req.(*configPb.LogLevelsRequest))
+		}))
+	mux.HandleFunc(gatewayPathPrefix+"Subscribe", g.handleSubscribe)
+
+	g.server = newHttpServer(mux)
+	return g
+}
+
+// newHttpServer - new http server of the handler with the timeouts, the connection of the request is kept in
+// the context of the request
+func newHttpServer(handler http.Handler) *http.Server {
+	return &http.Server{
+		Handler:      handler,
+		ReadTimeout:  httpReadTimeout,
+		WriteTimeout: httpWriteTimeout,
+		IdleTimeout:  httpIdleTimeout,
+		ConnContext: func(ctx context.Context, conn net.Conn) context.Context {
+			return context.WithValue(ctx, httpConnContextKey{}, conn)
+		},
+	}
+}
+
+// clearWriteDeadline - clear the write deadline of the connection of the request, so that the long running
+// response is not cut off by the write timeout of the server
+func clearWriteDeadline(r *http.Request) error {
+	conn, ok := r.Context().Value(httpConnContextKey{}).(net.Conn)
+	if !ok {
+		return fmt.Errorf("no connection in the request context")
+	}
+	return conn.SetWriteDeadline(time.Time{})
+}
+
+// start - listen on the gateway port, the listener uses the tls config of rpc
+func (g *httpGateway) start(chainMakerServer *blockchain.ChainMakerServer) error {
+	endPoint := fmt.Sprintf(":%d", localconf.ChainMakerConfig.RpcConfig.GatewayConfig.Port)
+	ln, err := net.Listen("tcp", endPoint)
+	if err != nil {
+		return fmt.Errorf("TCP listen failed, %s", err.Error())
+	}
+
+	if localconf.ChainMakerConfig.RpcConfig.TLSConfig.Mode != TLS_MODE_DISABLE {
+		tlsConfig, err := newGatewayTLSConfig(chainMakerServer)
+		if err != nil {
+			ln.Close()
+			return err
+		}
+		ln = gmtls.NewListener(ln, tlsConfig)
+	}
+
+	go func() {
+		if err := g.server.Serve(ln); err != nil && err != http.ErrServerClosed {
+			g.log.Errorf("http gateway Serve failed, %s", err.Error())
+		}
+	}()
+
+	g.log.Infof("http gateway listen on %s", endPoint)
+	return nil
+}
+
+// stop - close the gateway, the subscriptions are closed by the context of the api service
+func (g *httpGateway) stop() {
+	if err := g.server.Close(); err != nil {
+		g.log.Warnf("close http gateway failed, %s", err.Error())
+	}
+}
+
+// handleUnary - handle the unary method, the request and the response are protobuf messages in JSON
+func (g *httpGateway) handleUnary(method string, newReq func() proto.Message, call unaryCall) http.HandlerFunc {
+	info := &grpc.UnaryServerInfo{
+		Server:     g.apiService,
+		FullMethod: rpcNodeServicePrefix + method,
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		req := newReq()
+		if err := g.readRequest(w, r, req); err != nil {
+			g.writeError(w, err)
+			return
+		}
+
+		resp, err := g.interceptor(r.Context(), req, info,
+			func(ctx context.Context, req interface{}) (interface{}, error) {
+				return call(ctx, req.(proto.Message))
+			})
+		if err != nil {
+			g.writeError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err = gatewayMarshaler.Marshal(w, resp.(proto.Message)); err != nil {
+			g.log.Errorf("write http gateway response of %s failed, %s", method, err)
+		}
+	}
+}
+
+// handleSubscribe - handle the subscription, the results are pushed as the events of Server-Sent Events,
+// an `error` event is pushed if the subscription fails and an `end` event is pushed when it is finished
+func (g *httpGateway) handleSubscribe(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		g.writeError(w, status.Error(codes.Internal, "streaming unsupported"))
+		return
+	}
+
+	req := &commonPb.TxRequest{}
+	if err := g.readRequest(w, r, req); err != nil {
+		g.writeError(w, err)
+		return
+	}
+
+	if err := clearWriteDeadline(r); err != nil {
+		g.log.Warnf("clear the write deadline of http gateway subscription failed, %s", err)
+	}
+
+	info := &grpc.UnaryServerInfo{
+		Server:     g.apiService,
+		FullMethod: rpcNodeServicePrefix + "Subscribe",
+	}
+	stream := &sseSubscribeServer{
+		ctx:     r.Context(),
+		writer:  w,
+		flusher: flusher,
+	}
+
+	_, err := g.interceptor(r.Context(), req, info,
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			stream.ctx = ctx
+			return nil, g.apiService.Subscribe(req.(*commonPb.TxRequest), stream)
+		})
+
+	if !stream.started {
+		if status.Code(err) != codes.OK {
+			g.writeError(w, err)
+			return
+		}
+		stream.start()
+	}
+
+	if status.Code(err) != codes.OK {
+		err = stream.writeEvent("error", []byte(fmt.Sprintf("%q", status.Convert(err).Message())))
+	} else {
+		err = stream.writeEvent("end", []byte("{}"))
+	}
+	if err != nil {
+		g.log.Warnf("write http gateway subscribe event failed, %s", err)
+	}
+}
+
+func (g *httpGateway) readRequest(w http.ResponseWriter, r *http.Request, req proto.Message) error {
+	if r.Method != http.MethodPost && r.Method != http.MethodGet {
+		return status.Errorf(codes.Unimplemented, "http method %s is not allowed", r.Method)
+	}
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, httpMaxBodySize))
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "read request body failed, %s", err)
+	}
+
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil
+	}
+
+	if err = gatewayUnmarshaler.Unmarshal(bytes.NewReader(body), req); err != nil {
+		return status.Errorf(codes.InvalidArgument, "unmarshal request failed, %s", err)
+	}
+
+	return nil
+}
+
+func (g *httpGateway) writeError(w http.ResponseWriter, err error) {
+	st := status.Convert(err)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(httpStatusFromCode(st.Code()))
+	if _, err = fmt.Fprintf(w, `{"code":%d,"message":%q}`, st.Code(), st.Message()); err != nil {
+		g.log.Errorf("write http gateway error failed, %s", err)
+	}
+}
+
+// httpStatusFromCode - map the gRPC status code to http status code
+func httpStatusFromCode(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.InvalidArgument:
+		return http.StatusBadRequest
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusMethodNotAllowed
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// newGatewayTLSConfig - new the tls config of the gateway with the rpc cert and the trust roots of all the chains
+func newGatewayTLSConfig(chainMakerServer *blockchain.ChainMakerServer) (*gmtls.Config, error) {
+	tlsConfig := localconf.ChainMakerConfig.RpcConfig.TLSConfig
+	certificate, err := gmtls.LoadX509KeyPair(tlsConfig.CertFile, tlsConfig.PrivKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("load http gateway cert failed, %s", err)
+	}
+
+	caCerts, err := getTrustRootCerts(chainMakerServer)
+	if err != nil {
+		return nil, err
+	}
+
+	certPool := sm2.NewCertPool()
+	for _, caCert := range caCerts {
+		if !certPool.AppendCertsFromPEM([]byte(caCert)) {
+			return nil, fmt.Errorf("append trust root cert to http gateway failed")
+		}
+	}
+
+	config := &gmtls.Config{
+		Certificates: []gmtls.Certificate{certificate},
+		ClientCAs:    certPool,
+	}
+	if tlsConfig.Mode == TLS_MODE_TWOWAY {
+		config.ClientAuth = gmtls.RequireAndVerifyClientCert
+	}
+
+	return config, nil
+}
+
+// sseSubscribeServer implements RpcNode_SubscribeServer, it pushes the subscribe results as Server-Sent Events
+type sseSubscribeServer struct {
+	ctx     context.Context
+	writer  http.ResponseWriter
+	flusher http.Flusher
+	started bool
+}
+
+// Send - push the subscribe result as a `message` event
+func (s *sseSubscribeServer) Send(result *commonPb.SubscribeResult) error {
+	var buf bytes.Buffer
+	if err := gatewayMarshaler.Marshal(&buf, result); err != nil {
+		return err
+	}
+
+	if !s.started {
+		s.start()
+	}
+	return s.writeEvent("message", buf.Bytes())
+}
+
+func (s *sseSubscribeServer) start() {
+	s.started = true
+	header := s.writer.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	s.writer.WriteHeader(http.StatusOK)
+	s.flusher.Flush()
+}
+
+func (s *sseSubscribeServer) writeEvent(event string, data []byte) error {
+	if _, err := fmt.Fprintf(s.writer, "event: %s\ndata: %s\n\n", event, data); err != nil {
+		return err
+	}
+	s.flusher.Flush()
+	return nil
+}
+
+func (s *sseSubscribeServer) SetHeader(metadata.MD) error {
+	return nil
+}
+
+func (s *sseSubscribeServer) SendHeader(metadata.MD) error {
+	return nil
+}
+
+func (s *sseSubscribeServer) SetTrailer(metadata.MD) {
+}
+
+func (s *sseSubscribeServer) Context() context.Context {
+	return s.ctx
+}
+
+func (s *sseSubscribeServer) SendMsg(m interface{}) error {
+	result, ok := m.(*commonPb.SubscribeResult)
+	if !ok {
+		return fmt.Errorf("unexpected message type %T", m)
+	}
+	return s.Send(result)
+}
+
+func (s *sseSubscribeServer) RecvMsg(interface{}) error {
+	return status.Error(codes.Unimplemented, "RecvMsg is not supported by http gateway")
+}
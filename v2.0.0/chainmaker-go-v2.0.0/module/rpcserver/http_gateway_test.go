@@ -0,0 +1,153 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package rpcserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"chainmaker.org/chainmaker-go/localconf"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// countingInterceptor counts the calls of each full method
+type countingInterceptor struct {
+	calls map[string]int
+}
+
+func (c *countingInterceptor) intercept(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler) (interface{}, error) {
+	c.calls[info.FullMethod]++
+	return handler(ctx, req)
+}
+
+func newTestHttpGateway(t *testing.T, interceptor grpc.UnaryServerInterceptor) *httptest.Server {
+	server := httptest.NewServer(newHttpGateway(&ApiService{}, interceptor).server.Handler)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func postGateway(t *testing.T, server *httptest.Server, method string, body []byte) (int, map[string]interface{}) {
+	resp, err := http.Post(server.URL+gatewayPathPrefix+method, "application/json", bytes.NewReader(body))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	result := make(map[string]interface{})
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+	return resp.StatusCode, result
+}
+
+func TestHttpGateway_Unary(t *testing.T) {
+	interceptor := &countingInterceptor{calls: make(map[string]int)}
+	server := newTestHttpGateway(t, interceptor.intercept)
+
+	code, result := postGateway(t, server, "GetChainMakerVersion", []byte("{}"))
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, localconf.CurrentVersion, result["version"])
+	require.Equal(t, 1, interceptor.calls[rpcNodeServicePrefix+"GetChainMakerVersion"])
+
+	req, err := http.NewRequest(http.MethodPut, server.URL+gatewayPathPrefix+"GetChainMakerVersion", nil)
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+	require.Equal(t, 1, interceptor.calls[rpcNodeServicePrefix+"GetChainMakerVersion"])
+}
+
+func TestHttpGateway_MaxBodySize(t *testing.T) {
+	interceptor := &countingInterceptor{calls: make(map[string]int)}
+	server := newTestHttpGateway(t, interceptor.intercept)
+
+	body := []byte(`{"payload":{"tx_id":"` + strings.Repeat("a", httpMaxBodySize) + `"}}`)
+	code, result := postGateway(t, server, "SendRequest", body)
+	require.Equal(t, http.StatusBadRequest, code)
+	require.EqualValues(t, codes.InvalidArgument, result["code"])
+	require.Contains(t, result["message"], "request body too large")
+	require.Zero(t, interceptor.calls[rpcNodeServicePrefix+"SendRequest"])
+
+	ethServer := httptest.NewServer(newEthRpcServerWithService(newEthRpcService(&mockEthBackend{}, "chain1"),
+		interceptor.intercept))
+	defer ethServer.Close()
+	resp, err := http.Post(ethServer.URL, "application/json", bytes.NewReader(body))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+// TestHttpGateway_SharedRateLimit the ratelimit of the shared interceptor applies to all the http servers
+func TestHttpGateway_SharedRateLimit(t *testing.T) {
+	rateLimitConfig := localconf.ChainMakerConfig.RpcConfig.RateLimitConfig
+	defer func() {
+		localconf.ChainMakerConfig.RpcConfig.RateLimitConfig = rateLimitConfig
+	}()
+	localconf.ChainMakerConfig.RpcConfig.RateLimitConfig.TokenBucketSize = 1
+	localconf.ChainMakerConfig.RpcConfig.RateLimitConfig.TokenPerSecond = 1
+
+	interceptor := RateLimitInterceptor()
+	server := newTestHttpGateway(t, interceptor)
+	ethServer := httptest.NewServer(newEthRpcServerWithService(newEthRpcService(&mockEthBackend{}, "chain1"),
+		interceptor))
+	defer ethServer.Close()
+
+	code, _ := postGateway(t, server, "GetChainMakerVersion", []byte("{}"))
+	require.Equal(t, http.StatusOK, code)
+
+	resp, err := http.Post(ethServer.URL, "application/json",
+		strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"eth_chainId"}`))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	var ethResp ethRpcResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&ethResp))
+	require.NotNil(t, ethResp.Error)
+	require.Contains(t, ethResp.Error.Message, "rejected by ratelimit")
+
+	code, _ = postGateway(t, server, "GetChainMakerVersion", []byte("{}"))
+	require.Equal(t, http.StatusTooManyRequests, code)
+}
+
+func TestNewHttpServer_Timeouts(t *testing.T) {
+	server := newHttpServer(http.NotFoundHandler())
+	require.Equal(t, httpReadTimeout, server.ReadTimeout)
+	require.Equal(t, httpWriteTimeout, server.WriteTimeout)
+	require.Equal(t, httpIdleTimeout, server.IdleTimeout)
+}
+
+// TestClearWriteDeadline the response written after the write timeout is received once the deadline is cleared
+func TestClearWriteDeadline(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := clearWriteDeadline(r); err != nil {
+			t.Error(err)
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte("first\n"))
+		w.(http.Flusher).Flush()
+		time.Sleep(300 * time.Millisecond)
+		_, _ = w.Write([]byte("second\n"))
+	})
+	server := httptest.NewUnstartedServer(handler)
+	server.Config = newHttpServer(handler)
+	server.Config.WriteTimeout = 100 * time.Millisecond
+	server.Start()
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Equal(t, "first\nsecond\n", string(body))
+}
@@ -36,6 +36,9 @@ import (
 // RPCServer struct define
 type RPCServer struct {
 	grpcServer                 *grpc.Server
+	interceptor                grpc.UnaryServerInterceptor
+	gateway                    *httpGateway
+	ethRpc                     *ethRpcServer
 	chainMakerServer           *blockchain.ChainMakerServer
 	log                        *logger.CMLogger
 	ctx                        context.Context
@@ -58,6 +61,9 @@ const (
 	// subscriber ratelimit config
 	subscriberRateLimitDefaultTokenPerSecond  = 1000
 	subscriberRateLimitDefaultTokenBucketSize = 1000
+
+	// rpcMaxRecvMsgSize is the max size of the message received by gRPC, the default of gRPC
+	rpcMaxRecvMsgSize = 4 * 1024 * 1024
 )
 
 // TLS Mode
@@ -70,7 +76,9 @@ const (
 // NewRPCServer - new RPCServer object
 func NewRPCServer(chainMakerServer *blockchain.ChainMakerServer) (*RPCServer, error) {
 
-	server, err := newGrpc(chainMakerServer)
+	// the interceptors are shared by gRPC and the http servers, so that the ratelimit applies to all of them
+	interceptor := newUnaryInterceptor()
+	server, err := newGrpc(chainMakerServer, interceptor)
 	if err != nil {
 		return nil, fmt.Errorf("new grpc server failed, %s", err.Error())
 	}
@@ -89,6 +97,7 @@ func NewRPCServer(chainMakerServer *blockchain.ChainMakerServer) (*RPCServer, er
 
 	return &RPCServer{
 		grpcServer:       server,
+		interceptor:      interceptor,
 		chainMakerServer: chainMakerServer,
 		log:              log,
 	}, nil
@@ -115,7 +124,8 @@ func (s *RPCServer) Start() error {
 		s.log.Debugf("[START] current chain config trust roots hash: %s", s.curChainConfTrustRootsHash)
 	}
 
-	if err = s.RegisterHandler(); err != nil {
+	apiService := NewApiService(s.chainMakerServer, s.ctx)
+	if err = s.RegisterHandler(apiService); err != nil {
 		return fmt.Errorf("register handler failed, %s", err.Error())
 	}
 
@@ -134,12 +144,25 @@ func (s *RPCServer) Start() error {
 
 	s.log.Infof("gRPC server listen on %s", endPoint)
 
+	if localconf.ChainMakerConfig.RpcConfig.GatewayConfig.Enabled {
+		s.gateway = newHttpGateway(apiService, s.interceptor)
+		if err = s.gateway.start(s.chainMakerServer); err != nil {
+			return fmt.Errorf("start http gateway failed, %s", err.Error())
+		}
+	}
+
+	if localconf.ChainMakerConfig.RpcConfig.EthRpcConfig.Enabled {
+		s.ethRpc = newEthRpcServer(apiService, s.interceptor)
+		if err = s.ethRpc.start(s.chainMakerServer); err != nil {
+			return fmt.Errorf("start ethereum json-rpc server failed, %s", err.Error())
+		}
+	}
+
 	return nil
 }
 
 // RegisterHandler - register apiservice handler to rpcserver
-func (s *RPCServer) RegisterHandler() error {
-	apiService := NewApiService(s.chainMakerServer, s.ctx)
+func (s *RPCServer) RegisterHandler(apiService *ApiService) error {
 	apiPb.RegisterRpcNodeServer(s.grpcServer, apiService)
 	return nil
 }
@@ -149,6 +172,7 @@ func (s *RPCServer) Stop() {
 	s.isShutdown = true
 	s.cancel()
 	s.grpcServer.GracefulStop()
+	s.stopHttpServers()
 	s.log.Info("RPCServer is stopped!")
 }
 
@@ -162,8 +186,9 @@ func (s *RPCServer) Restart(reason string) error {
 
 	s.cancel()
 	s.grpcServer.GracefulStop()
+	s.stopHttpServers()
 
-	s.grpcServer, err = newGrpc(s.chainMakerServer)
+	s.grpcServer, err = newGrpc(s.chainMakerServer, s.interceptor)
 	if err != nil {
 		errMsg := fmt.Sprintf("RPCServer restart for reason [%s], new rpc server failed, %s", reason, err.Error())
 		s.log.Errorf(errMsg)
@@ -180,6 +205,17 @@ func (s *RPCServer) Restart(reason string) error {
 	return nil
 }
 
+func (s *RPCServer) stopHttpServers() {
+	if s.gateway != nil {
+		s.gateway.stop()
+		s.gateway = nil
+	}
+	if s.ethRpc != nil {
+		s.ethRpc.stop()
+		s.ethRpc = nil
+	}
+}
+
 func (s *RPCServer) getCurChainConfTrustRootsHash() (string, error) {
 	chainConfs, err := s.chainMakerServer.GetAllChainConf()
 	if err != nil {
@@ -256,42 +292,57 @@ func (s *RPCServer) checkAndRestart() error {
 	return nil
 }
 
-// newGrpc - new GRPC object
-func newGrpc(chainMakerServer *blockchain.ChainMakerServer) (*grpc.Server, error) {
-	var opts []grpc.ServerOption
+// newUnaryInterceptor - new the chain of unary interceptors, it is built once by RPCServer and shared by gRPC,
+// the http gateway and the ethereum json-rpc server
+func newUnaryInterceptor() grpc.UnaryServerInterceptor {
 	if localconf.ChainMakerConfig.MonitorConfig.Enabled {
-		opts = []grpc.ServerOption{
-			grpc_middleware.WithUnaryServerChain(
-				RecoveryInterceptor,
-				LoggingInterceptor,
-				MonitorInterceptor,
-				RateLimitInterceptor(),
-			),
-		}
-	} else {
-		opts = []grpc.ServerOption{
-			grpc_middleware.WithUnaryServerChain(
-				RecoveryInterceptor,
-				LoggingInterceptor,
-				RateLimitInterceptor(),
-			),
+		return grpc_middleware.ChainUnaryServer(
+			RecoveryInterceptor,
+			LoggingInterceptor,
+			MonitorInterceptor,
+			RateLimitInterceptor(),
+		)
+	}
+
+	return grpc_middleware.ChainUnaryServer(
+		RecoveryInterceptor,
+		LoggingInterceptor,
+		RateLimitInterceptor(),
+	)
+}
+
+// getTrustRootCerts - get the trust root certs of all the chains
+func getTrustRootCerts(chainMakerServer *blockchain.ChainMakerServer) ([]string, error) {
+	chainConfs, err := chainMakerServer.GetAllChainConf()
+	if err != nil {
+		return nil, fmt.Errorf("get all chain conf failed, %s", err)
+	}
+
+	var caCerts []string
+	for _, chainConf := range chainConfs {
+		for _, orgRoot := range chainConf.ChainConfig().TrustRoots {
+			for _, trustRoot := range orgRoot.Root {
+				caCerts = append(caCerts, trustRoot)
+			}
 		}
 	}
 
+	return caCerts, nil
+}
+
+// newGrpc - new GRPC object
+func newGrpc(chainMakerServer *blockchain.ChainMakerServer,
+	interceptor grpc.UnaryServerInterceptor) (*grpc.Server, error) {
+	opts := []grpc.ServerOption{
+		grpc.UnaryInterceptor(interceptor),
+		grpc.MaxRecvMsgSize(rpcMaxRecvMsgSize),
+	}
+
 	if localconf.ChainMakerConfig.RpcConfig.TLSConfig.Mode != TLS_MODE_DISABLE {
 
-		chainConfs, err := chainMakerServer.GetAllChainConf()
+		caCerts, err := getTrustRootCerts(chainMakerServer)
 		if err != nil {
-			return nil, fmt.Errorf("get all chain conf failed, %s", err)
-		}
-
-		var caCerts []string
-		for _, chainConf := range chainConfs {
-			for _, orgRoot := range chainConf.ChainConfig().TrustRoots {
-				for _, trustRoot := range orgRoot.Root {
-					caCerts = append(caCerts, trustRoot)
-				}
-			}
+			return nil, err
 		}
 
 		tlsRPCServer := ca.CAServer{
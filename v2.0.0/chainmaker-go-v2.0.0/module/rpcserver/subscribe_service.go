@@ -27,6 +27,20 @@ import (
 	"google.golang.org/grpc/status"
 )
 
+// the parameter keys of the block height range of the contract event subscription,
+// they are the same as the block subscription
+var (
+	subscribeContractEventStartBlock = syscontract.SubscribeBlock_START_BLOCK.String()
+	subscribeContractEventEndBlock   = syscontract.SubscribeBlock_END_BLOCK.String()
+)
+
+// contractEventReader reads the history contract events, it is implemented by the block store
+// when the contract event db is enabled.
+type contractEventReader interface {
+	GetContractEvents(contractName, topic string, startHeight,
+		endHeight uint64) ([]*commonPb.ContractEventInfo, error)
+}
+
 // Subscribe - deal block/tx subscribe request
 func (s *ApiService) Subscribe(req *commonPb.TxRequest, server apiPb.RpcNode_SubscribeServer) error {
 	var (
@@ -213,9 +227,12 @@ func (s *ApiService) dealContractEventSubscription(tx *commonPb.Transaction, ser
 		err          error
 		errMsg       string
 		errCode      commonErr.ErrCode
+		db           protocol.BlockchainStore
 		payload      = tx.Payload
 		topic        string
 		contractName string
+		startBlock   int64 = -1
+		endBlock     int64 = -1
 	)
 
 	for _, kv := range payload.Parameters {
@@ -223,20 +240,45 @@ func (s *ApiService) dealContractEventSubscription(tx *commonPb.Transaction, ser
 			topic = string(kv.Value)
 		} else if kv.Key == syscontract.SubscribeContractEvent_CONTRACT_NAME.String() {
 			contractName = string(kv.Value)
+		} else if kv.Key == subscribeContractEventStartBlock {
+			startBlock, err = utils.BytesToInt64(kv.Value)
+		} else if kv.Key == subscribeContractEventEndBlock {
+			endBlock, err = utils.BytesToInt64(kv.Value)
+		}
+
+		if err != nil {
+			errCode = commonErr.ERR_CODE_CHECK_PAYLOAD_PARAM_SUBSCRIBE_CONTRACT_EVENT
+			errMsg = s.getErrMsg(errCode, err)
+			s.log.Error(errMsg)
+			return status.Error(codes.InvalidArgument, errMsg)
 		}
 	}
 
-	if err = s.checkSubscribeContractEventPayload(topic, contractName); err != nil {
+	if err = s.checkSubscribeContractEventPayload(topic, contractName); err == nil {
+		err = s.checkSubscribeBlockHeight(startBlock, endBlock)
+	}
+	if err != nil {
 		errCode = commonErr.ERR_CODE_CHECK_PAYLOAD_PARAM_SUBSCRIBE_CONTRACT_EVENT
 		errMsg = s.getErrMsg(errCode, err)
 		s.log.Error(errMsg)
 		return status.Error(codes.InvalidArgument, errMsg)
 	}
-	s.log.Infof("Recv contractEventInfo subscribe request: [topic:%v]/[contractName:%v]",
-		topic, contractName)
+	s.log.Infof("Recv contractEventInfo subscribe request: [topic:%v]/[contractName:%v]/[start:%d]/[end:%d]",
+		topic, contractName, startBlock, endBlock)
 
-	return s.doSendContractEvent(tx, server, topic, contractName)
+	if startBlock == -1 && endBlock == -1 {
+		return s.doSendContractEvent(tx, server, topic, contractName)
+	}
+
+	chainId := tx.Payload.ChainId
+	if db, err = s.chainMakerServer.GetStore(chainId); err != nil {
+		errCode = commonErr.ERR_CODE_GET_STORE
+		errMsg = s.getErrMsg(errCode, err)
+		s.log.Error(errMsg)
+		return status.Error(codes.Internal, errMsg)
+	}
 
+	return s.doSendHistoryContractEvent(tx, db, server, topic, contractName, startBlock, endBlock)
 }
 
 func (s *ApiService) checkSubscribeContractEventPayload(topic, contractName string) error {
@@ -299,6 +341,245 @@ func (s *ApiService) doSendContractEvent(tx *commonPb.Transaction, server apiPb.
 	}
 }
 
+// doSendHistoryContractEvent - send the history contract events from the start block, then send the new ones
+// until the end block
+func (s *ApiService) doSendHistoryContractEvent(tx *commonPb.Transaction, db protocol.BlockchainStore,
+	server apiPb.RpcNode_SubscribeServer, topic, contractName string, startBlock, endBlock int64) error {
+
+	var (
+		err             error
+		errMsg          string
+		errCode         commonErr.ErrCode
+		lastBlockHeight int64
+	)
+
+	if lastBlockHeight, err = s.checkAndGetLastBlockHeight(db, startBlock); err != nil {
+		errCode = commonErr.ERR_CODE_GET_LAST_BLOCK
+		errMsg = s.getErrMsg(errCode, err)
+		s.log.Error(errMsg)
+		return status.Error(codes.Internal, errMsg)
+	}
+
+	var startBlockHeight int64
+	if startBlock > startBlockHeight {
+		startBlockHeight = startBlock
+	}
+
+	if endBlock != -1 && endBlock <= lastBlockHeight {
+		if err = s.sendHistoryContractEvent(db, server, topic, contractName, startBlockHeight, endBlock); err != nil {
+			s.log.Errorf("sendHistoryContractEvent failed, %s", err)
+			return err
+		}
+
+		return status.Error(codes.OK, "OK")
+	}
+
+	if err = s.sendHistoryContractEvent(db, server, topic, contractName, startBlockHeight, lastBlockHeight); err != nil {
+		s.log.Errorf("sendHistoryContractEvent failed, %s", err)
+		return err
+	}
+
+	return s.sendNewContractEvent(db, tx, server, topic, contractName, endBlock, lastBlockHeight)
+}
+
+// sendNewContractEvent - send the contract events of the new blocks to subscriber,
+// the events of the blocks committed after the history ones are sent and before subscribing are read from store,
+// so that no event is lost or sent twice
+func (s *ApiService) sendNewContractEvent(store protocol.BlockchainStore, tx *commonPb.Transaction,
+	server apiPb.RpcNode_SubscribeServer, topic, contractName string,
+	endBlockHeight int64, alreadySendHistoryBlockHeight int64) error {
+
+	var (
+		errCode         commonErr.ErrCode
+		err             error
+		errMsg          string
+		eventSubscriber *subscriber.EventSubscriber
+	)
+
+	blockCh := make(chan model.NewBlockEvent)
+
+	chainId := tx.Payload.ChainId
+	if eventSubscriber, err = s.chainMakerServer.GetEventSubscribe(chainId); err != nil {
+		errCode = commonErr.ERR_CODE_GET_SUBSCRIBER
+		errMsg = s.getErrMsg(errCode, err)
+		s.log.Error(errMsg)
+		return status.Error(codes.Internal, errMsg)
+	}
+
+	sub := eventSubscriber.SubscribeBlockEvent(blockCh)
+	defer sub.Unsubscribe()
+
+	return s.sendContractEventOfNewBlocks(store, blockCh, server, topic, contractName, endBlockHeight,
+		alreadySendHistoryBlockHeight)
+}
+
+// sendContractEventOfNewBlocks - send the contract events of the new blocks following the history ones sent,
+// the blocks not newer than alreadySendHistoryBlockHeight are skipped, and the blocks missed between the history
+// and the new block, e.g. committed before subscribing, are read from store
+func (s *ApiService) sendContractEventOfNewBlocks(store protocol.BlockchainStore, blockCh <-chan model.NewBlockEvent,
+	server apiPb.RpcNode_SubscribeServer, topic, contractName string,
+	endBlockHeight int64, alreadySendHistoryBlockHeight int64) error {
+
+	var (
+		err   error
+		block *commonPb.Block
+	)
+
+	for {
+		select {
+		case ev := <-blockCh:
+			block = ev.BlockInfo.Block
+			blockHeight := int64(block.Header.BlockHeight)
+
+			if blockHeight <= alreadySendHistoryBlockHeight {
+				continue
+			}
+
+			if blockHeight > alreadySendHistoryBlockHeight+1 {
+				err = s.sendHistoryContractEvent(store, server, topic, contractName,
+					alreadySendHistoryBlockHeight+1, blockHeight-1)
+				if err != nil {
+					s.log.Errorf("send history contract event failed, %s", err)
+					return err
+				}
+			}
+			alreadySendHistoryBlockHeight = blockHeight
+
+			if err = s.sendContractEventList(server, getContractEventsOfBlock(block, topic, contractName)); err != nil {
+				s.log.Error(err.Error())
+				return status.Error(codes.Internal, err.Error())
+			}
+
+			if endBlockHeight != -1 && blockHeight >= endBlockHeight {
+				return status.Error(codes.OK, "OK")
+			}
+
+		case <-server.Context().Done():
+			return nil
+		case <-s.ctx.Done():
+			return nil
+		}
+	}
+}
+
+// sendHistoryContractEvent - send the contract events in block height range [startBlockHeight, endBlockHeight]
+// to subscriber, the events are read from the contract event db if it is enabled, otherwise from the blocks
+func (s *ApiService) sendHistoryContractEvent(store protocol.BlockchainStore, server apiPb.RpcNode_SubscribeServer,
+	topic, contractName string, startBlockHeight, endBlockHeight int64) error {
+
+	if reader, ok := store.(contractEventReader); ok {
+		events, err := reader.GetContractEvents(contractName, topic, uint64(startBlockHeight), uint64(endBlockHeight))
+		if err == nil {
+			return s.sendHistoryContractEventList(server, events)
+		}
+		s.log.Debugf("get contract events from contract event db failed, read them from blocks, %s", err)
+	}
+
+	for i := startBlockHeight; i <= endBlockHeight; i++ {
+		select {
+		case <-s.ctx.Done():
+			return status.Error(codes.Internal, "chainmaker is restarting, please retry later")
+		default:
+		}
+
+		if err := s.getRateLimitToken(); err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+
+		block, err := store.GetBlock(uint64(i))
+		if err != nil {
+			errMsg := fmt.Sprintf("get block failed, at [height:%d], %s", i, err)
+			s.log.Error(errMsg)
+			return status.Error(codes.Internal, errMsg)
+		}
+
+		if block == nil {
+			return nil
+		}
+
+		if err = s.sendContractEventList(server, getContractEventsOfBlock(block, topic, contractName)); err != nil {
+			s.log.Error(err.Error())
+			return status.Error(codes.Internal, err.Error())
+		}
+	}
+
+	return nil
+}
+
+// sendHistoryContractEventList - send the events ordered by block height, one list for a block
+func (s *ApiService) sendHistoryContractEventList(server apiPb.RpcNode_SubscribeServer,
+	events []*commonPb.ContractEventInfo) error {
+
+	for len(events) > 0 {
+		select {
+		case <-s.ctx.Done():
+			return status.Error(codes.Internal, "chainmaker is restarting, please retry later")
+		default:
+		}
+
+		if err := s.getRateLimitToken(); err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+
+		i := 1
+		for i < len(events) && events[i].BlockHeight == events[0].BlockHeight {
+			i++
+		}
+
+		if err := s.sendContractEventList(server, &commonPb.ContractEventInfoList{ContractEvents: events[:i]}); err != nil {
+			s.log.Error(err.Error())
+			return status.Error(codes.Internal, err.Error())
+		}
+		events = events[i:]
+	}
+
+	return nil
+}
+
+func (s *ApiService) sendContractEventList(server apiPb.RpcNode_SubscribeServer,
+	eventInfoList *commonPb.ContractEventInfoList) error {
+
+	if len(eventInfoList.ContractEvents) == 0 {
+		return nil
+	}
+
+	result, err := s.getContractEventSubscribeResult(eventInfoList)
+	if err != nil {
+		return err
+	}
+
+	if err = server.Send(result); err != nil {
+		return fmt.Errorf("send contract event info failed, %s", err)
+	}
+
+	return nil
+}
+
+// getContractEventsOfBlock - get the events of the topic emitted by the contract in the block
+func getContractEventsOfBlock(block *commonPb.Block, topic, contractName string) *commonPb.ContractEventInfoList {
+	eventInfoList := &commonPb.ContractEventInfoList{}
+	for _, tx := range block.Txs {
+		if tx.Result == nil || tx.Result.ContractResult == nil {
+			continue
+		}
+		for _, event := range tx.Result.ContractResult.ContractEvent {
+			if event.ContractName != contractName || event.Topic != topic {
+				continue
+			}
+			eventInfoList.ContractEvents = append(eventInfoList.ContractEvents, &commonPb.ContractEventInfo{
+				BlockHeight:     block.Header.BlockHeight,
+				ChainId:         block.Header.ChainId,
+				Topic:           event.Topic,
+				TxId:            event.TxId,
+				ContractName:    event.ContractName,
+				ContractVersion: event.ContractVersion,
+				EventData:       event.EventData,
+			})
+		}
+	}
+	return eventInfoList
+}
+
 func (s *ApiService) doSendTx(tx *commonPb.Transaction, db protocol.BlockchainStore,
 	server apiPb.RpcNode_SubscribeServer, startBlock, endBlock int64, contractName string, txIds []string) error {
 
@@ -0,0 +1,233 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package rpcserver
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"chainmaker.org/chainmaker-go/logger"
+	"chainmaker.org/chainmaker-go/subscriber/model"
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	"chainmaker.org/chainmaker/protocol/v2"
+	"chainmaker.org/chainmaker/protocol/v2/mock"
+	"github.com/gogo/protobuf/proto"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	testEventContract = "contract1"
+	testEventTopic    = "topic1"
+)
+
+// mockSubscribeServer collects the contract events sent to the subscriber
+type mockSubscribeServer struct {
+	grpc.ServerStream
+	ctx    context.Context
+	events []*commonPb.ContractEventInfo
+}
+
+func (m *mockSubscribeServer) Send(result *commonPb.SubscribeResult) error {
+	list := &commonPb.ContractEventInfoList{}
+	if err := proto.Unmarshal(result.Data, list); err != nil {
+		return err
+	}
+	m.events = append(m.events, list.ContractEvents...)
+	return nil
+}
+
+func (m *mockSubscribeServer) Context() context.Context {
+	return m.ctx
+}
+
+// heights returns the block heights of the events sent, one for an event
+func (m *mockSubscribeServer) heights() []uint64 {
+	heights := make([]uint64, 0, len(m.events))
+	for _, event := range m.events {
+		heights = append(heights, event.BlockHeight)
+	}
+	return heights
+}
+
+// mockContractEventStore the block store with the contract event db enabled
+type mockContractEventStore struct {
+	protocol.BlockchainStore
+	events []*commonPb.ContractEventInfo
+}
+
+func (m *mockContractEventStore) GetContractEvents(contractName, topic string, startHeight,
+	endHeight uint64) ([]*commonPb.ContractEventInfo, error) {
+	var events []*commonPb.ContractEventInfo
+	for _, event := range m.events {
+		if event.ContractName == contractName && event.Topic == topic &&
+			event.BlockHeight >= startHeight && event.BlockHeight <= endHeight {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+func newTestSubscribeApiService() *ApiService {
+	return &ApiService{
+		log: logger.GetLogger(logger.MODULE_RPC),
+		ctx: context.Background(),
+	}
+}
+
+// createEventTestBlock returns the block of height with a tx emitting an event of the test contract and topic,
+// and the events which must not be sent to the subscriber
+func createEventTestBlock(height uint64) *commonPb.Block {
+	event := func(contractName, topic string) *commonPb.ContractEvent {
+		return &commonPb.ContractEvent{
+			Topic:        topic,
+			TxId:         fmt.Sprintf("tx%d", height),
+			ContractName: contractName,
+			EventData:    []string{fmt.Sprintf("data%d", height)},
+		}
+	}
+	return &commonPb.Block{
+		Header: &commonPb.BlockHeader{ChainId: "chain1", BlockHeight: height},
+		Txs: []*commonPb.Transaction{
+			{Payload: &commonPb.Payload{TxId: fmt.Sprintf("tx%d", height)}, Result: &commonPb.Result{
+				ContractResult: &commonPb.ContractResult{ContractEvent: []*commonPb.ContractEvent{
+					event(testEventContract, testEventTopic),
+					event(testEventContract, "topic2"),
+					event("contract2", testEventTopic),
+				}},
+			}},
+			{Payload: &commonPb.Payload{TxId: "noResult"}},
+		},
+	}
+}
+
+func newTestBlockStore(ctrl *gomock.Controller, blocks map[uint64]*commonPb.Block) *mock.MockBlockchainStore {
+	store := mock.NewMockBlockchainStore(ctrl)
+	store.EXPECT().GetBlock(gomock.Any()).DoAndReturn(func(height uint64) (*commonPb.Block, error) {
+		block, ok := blocks[height]
+		if !ok {
+			return nil, fmt.Errorf("block %d not found", height)
+		}
+		return block, nil
+	}).AnyTimes()
+	return store
+}
+
+func TestGetContractEventsOfBlock(t *testing.T) {
+	block := createEventTestBlock(5)
+
+	list := getContractEventsOfBlock(block, testEventTopic, testEventContract)
+	require.Len(t, list.ContractEvents, 1)
+	event := list.ContractEvents[0]
+	require.Equal(t, uint64(5), event.BlockHeight)
+	require.Equal(t, "chain1", event.ChainId)
+	require.Equal(t, "tx5", event.TxId)
+	require.Equal(t, testEventContract, event.ContractName)
+	require.Equal(t, testEventTopic, event.Topic)
+	require.Equal(t, []string{"data5"}, event.EventData)
+
+	require.Empty(t, getContractEventsOfBlock(block, "topic3", testEventContract).ContractEvents)
+	require.Empty(t, getContractEventsOfBlock(block, testEventTopic, "contract3").ContractEvents)
+}
+
+func TestApiService_SendHistoryContractEvent(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	blocks := make(map[uint64]*commonPb.Block)
+	var events []*commonPb.ContractEventInfo
+	for i := uint64(0); i <= 5; i++ {
+		blocks[i] = createEventTestBlock(i)
+		events = append(events, getContractEventsOfBlock(blocks[i], testEventTopic, testEventContract).ContractEvents...)
+	}
+	stores := map[string]protocol.BlockchainStore{
+		"blocks":        newTestBlockStore(ctrl, blocks),
+		"contractEvent": &mockContractEventStore{events: events},
+	}
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			s := newTestSubscribeApiService()
+			server := &mockSubscribeServer{ctx: context.Background()}
+			require.NoError(t, s.sendHistoryContractEvent(store, server, testEventTopic, testEventContract, 2, 4))
+			require.Equal(t, []uint64{2, 3, 4}, server.heights())
+		})
+	}
+}
+
+func TestApiService_SendContractEventOfNewBlocks(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	blocks := make(map[uint64]*commonPb.Block)
+	for i := uint64(0); i <= 10; i++ {
+		blocks[i] = createEventTestBlock(i)
+	}
+
+	tests := []struct {
+		name string
+		// the blocks received from the subscriber after the history up to height 5 is sent
+		newBlocks []uint64
+		store     protocol.BlockchainStore
+		want      []uint64
+	}{
+		{
+			name:      "following",
+			newBlocks: []uint64{6, 7, 8},
+			// the history is not read from store
+			store: mock.NewMockBlockchainStore(ctrl),
+			want:  []uint64{6, 7, 8},
+		},
+		{
+			name:      "sent",
+			newBlocks: []uint64{4, 5, 6, 6, 7, 8},
+			store:     mock.NewMockBlockchainStore(ctrl),
+			want:      []uint64{6, 7, 8},
+		},
+		{
+			name:      "gap",
+			newBlocks: []uint64{5, 8},
+			store:     newTestBlockStore(ctrl, blocks),
+			want:      []uint64{6, 7, 8},
+		},
+		{
+			name:      "end",
+			newBlocks: []uint64{6, 7, 8, 9, 10},
+			store:     mock.NewMockBlockchainStore(ctrl),
+			want:      []uint64{6, 7, 8},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			blockCh := make(chan model.NewBlockEvent, len(test.newBlocks))
+			for _, height := range test.newBlocks {
+				blockCh <- model.NewBlockEvent{BlockInfo: &commonPb.BlockInfo{Block: blocks[height]}}
+			}
+
+			s := newTestSubscribeApiService()
+			server := &mockSubscribeServer{ctx: context.Background()}
+			err := s.sendContractEventOfNewBlocks(test.store, blockCh, server, testEventTopic, testEventContract, 8, 5)
+			require.Equal(t, codes.OK, status.Code(err))
+			require.Equal(t, test.want, server.heights())
+		})
+	}
+}
+
+func TestApiService_SendContractEventOfNewBlocks_Done(t *testing.T) {
+	s := newTestSubscribeApiService()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	server := &mockSubscribeServer{ctx: ctx}
+	require.NoError(t, s.sendContractEventOfNewBlocks(nil, make(chan model.NewBlockEvent), server,
+		testEventTopic, testEventContract, -1, 5))
+	require.Empty(t, server.events)
+}
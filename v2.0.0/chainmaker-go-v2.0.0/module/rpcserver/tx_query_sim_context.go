@@ -11,6 +11,7 @@ import (
 	"errors"
 	"fmt"
 
+	"chainmaker.org/chainmaker-go/utils"
 	acPb "chainmaker.org/chainmaker/pb-go/v2/accesscontrol"
 	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
 	"chainmaker.org/chainmaker/protocol/v2"
@@ -33,6 +34,17 @@ type txQuerySimContextImpl struct {
 	sqlRowCache      map[int32]protocol.SqlRows
 	kvRowCache       map[int32]protocol.StateIterator
 	blockVersion     uint32
+	// heightReader is set when querying the state at a history block height
+	heightReader stateAtHeightReader
+	queryHeight  uint64
+}
+
+// stateAtHeightReader reads the state at a history block height, it is implemented by the block store
+// when the history db is enabled.
+type stateAtHeightReader interface {
+	ReadObjectAtHeight(contractName string, key []byte, height uint64) ([]byte, error)
+	SelectObjectAtHeight(contractName string, startKey []byte, limit []byte,
+		height uint64) (protocol.StateIterator, error)
 }
 
 type callContractResult struct {
@@ -64,7 +76,7 @@ func (s *txQuerySimContextImpl) Get(contractName string, key []byte) ([]byte, er
 	}
 
 	// Get from db
-	value, err := s.blockchainStore.ReadObject(contractName, key)
+	value, err := s.readObject(contractName, key)
 	if err != nil {
 		return nil, err
 	}
@@ -96,7 +108,18 @@ func (s *txQuerySimContextImpl) Del(contractName string, key []byte) error {
 	return nil
 }
 
+// readObject reads the state from db, at the query block height if it is set
+func (s *txQuerySimContextImpl) readObject(contractName string, key []byte) ([]byte, error) {
+	if s.heightReader != nil {
+		return s.heightReader.ReadObjectAtHeight(contractName, key, s.queryHeight)
+	}
+	return s.blockchainStore.ReadObject(contractName, key)
+}
+
 func (s *txQuerySimContextImpl) Select(contractName string, startKey []byte, limit []byte) (protocol.StateIterator, error) {
+	if s.heightReader != nil {
+		return s.heightReader.SelectObjectAtHeight(contractName, startKey, limit, s.queryHeight)
+	}
 	return s.blockchainStore.SelectObject(contractName, startKey, limit)
 }
 
@@ -113,6 +136,9 @@ func (s *txQuerySimContextImpl) GetSender() *acPb.Member {
 }
 
 func (s *txQuerySimContextImpl) GetBlockHeight() uint64 {
+	if s.heightReader != nil {
+		return s.queryHeight
+	}
 	if lastBlock, err := s.blockchainStore.GetLastBlock(); err != nil {
 		return 0
 	} else {
@@ -121,6 +147,13 @@ func (s *txQuerySimContextImpl) GetBlockHeight() uint64 {
 }
 
 func (s *txQuerySimContextImpl) GetBlockProposer() *acPb.Member {
+	if s.heightReader != nil {
+		block, err := s.blockchainStore.GetBlock(s.queryHeight)
+		if err != nil || block == nil {
+			return nil
+		}
+		return block.Header.Proposer
+	}
 	if lastBlock, err := s.blockchainStore.GetLastBlock(); err != nil {
 		return nil
 	} else {
@@ -238,11 +271,11 @@ func (s *txQuerySimContextImpl) CallContract(contract *commonPb.Contract, method
 		}
 		return contractResult, commonPb.TxStatusCode_CONTRACT_TOO_DEEP_FAILED
 	}
-	if s.gasUsed > protocol.GasLimit {
+	if gasLimit := utils.TxGasLimit(s.tx); s.gasUsed > gasLimit {
 		contractResult := &commonPb.ContractResult{
 			Code:    uint32(1),
 			Result:  nil,
-			Message: fmt.Sprintf("There is not enough gas, gasUsed %d GasLimit %d ", gasUsed, int64(protocol.GasLimit)),
+			Message: fmt.Sprintf("There is not enough gas, gasUsed %d GasLimit %d ", gasUsed, gasLimit),
 		}
 		return contractResult, commonPb.TxStatusCode_CONTRACT_FAIL
 	}
@@ -295,10 +328,16 @@ func (s *txQuerySimContextImpl) GetStateKvHandle(index int32) (protocol.StateIte
 	return data, ok
 }
 func (s *txQuerySimContextImpl) GetContractByName(name string) (*commonPb.Contract, error) {
+	if s.heightReader != nil {
+		return utils.GetContractByName(s.readObject, name)
+	}
 	return s.blockchainStore.GetContractByName(name)
 }
 
 //GetContractBytecode get contract bytecode
 func (s *txQuerySimContextImpl) GetContractBytecode(name string) ([]byte, error) {
+	if s.heightReader != nil {
+		return utils.GetContractBytecode(s.readObject, name)
+	}
 	return s.blockchainStore.GetContractBytecode(name)
 }
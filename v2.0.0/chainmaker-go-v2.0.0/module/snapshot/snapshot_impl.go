@@ -8,7 +8,9 @@ SPDX-License-Identifier: Apache-2.0
 package snapshot
 
 import (
+	"bytes"
 	"fmt"
+	"strings"
 	"sync"
 
 	"chainmaker.org/chainmaker/pb-go/v2/accesscontrol"
@@ -50,6 +52,9 @@ type SnapshotImpl struct {
 	txResultMap  map[string]*commonPb.Result
 	readTable    map[string]*sv
 	writeTable   map[string]*sv
+
+	// sqlKeyCache caches the conflict keys of the sql statements, see sqlConflictKeys
+	sqlKeyCache map[string][]string
 }
 
 func (s *SnapshotImpl) GetPreSnapshot() protocol.Snapshot {
@@ -174,9 +179,8 @@ func (s *SnapshotImpl) ApplyTxSimContext(cache protocol.TxSimContext, runVmSucce
 
 	// Check whether the dependent state has been modified during the run
 	for _, txRead := range txRWSet.TxReads {
-		finalKey := constructKey(txRead.ContractName, txRead.Key)
-		if sv, ok := s.writeTable[finalKey]; ok {
-			if sv.seq >= txExecSeq {
+		for _, finalKey := range s.readConflictKeys(txRead) {
+			if s.isReadConflicted(finalKey, txExecSeq) {
 				//log.Debugf("Key Conflicted %+v-%+v", sv.seq, txExecSeq)
 				return false, len(s.txTable)
 			}
@@ -192,19 +196,21 @@ func (s *SnapshotImpl) apply(tx *commonPb.Transaction, txRWSet *commonPb.TxRWSet
 	// Append to read table
 	applySeq := len(s.txTable)
 	for _, txRead := range txRWSet.TxReads {
-		finalKey := constructKey(txRead.ContractName, txRead.Key)
-		s.readTable[finalKey] = &sv{
-			seq:   applySeq,
-			value: txRead.Value,
+		for _, finalKey := range s.readConflictKeys(txRead) {
+			s.readTable[finalKey] = &sv{
+				seq:   applySeq,
+				value: txRead.Value,
+			}
 		}
 	}
 
 	// Append to write table
 	for _, txWrite := range txRWSet.TxWrites {
-		finalKey := constructKey(txWrite.ContractName, txWrite.Key)
-		s.writeTable[finalKey] = &sv{
-			seq:   applySeq,
-			value: txWrite.Value,
+		for _, finalKey := range s.writeConflictKeys(txWrite) {
+			s.writeTable[finalKey] = &sv{
+				seq:   applySeq,
+				value: txWrite.Value,
+			}
 		}
 	}
 
@@ -218,6 +224,40 @@ func (s *SnapshotImpl) apply(tx *commonPb.Transaction, txRWSet *commonPb.TxRWSet
 	s.txTable = append(s.txTable, tx)
 }
 
+// ApplyBlockWrite appends the write made for the whole block after all the txs are applied, e.g. the gas fees
+// credited to the proposer, to the rw set of the tx, the write of the same key in the rw set is replaced.
+// The write is visible to the snapshots of the next blocks like the writes of the txs.
+func (s *SnapshotImpl) ApplyBlockWrite(txId string, txWrite *commonPb.TxWrite) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for i, tx := range s.txTable {
+		if tx.Payload.TxId != txId {
+			continue
+		}
+		txRWSet := s.txRWSetTable[i]
+		replaced := false
+		for j, write := range txRWSet.TxWrites {
+			if write.ContractName == txWrite.ContractName && bytes.Equal(write.Key, txWrite.Key) {
+				txRWSet.TxWrites[j] = txWrite
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			txRWSet.TxWrites = append(txRWSet.TxWrites, txWrite)
+		}
+		for _, finalKey := range s.writeConflictKeys(txWrite) {
+			s.writeTable[finalKey] = &sv{
+				seq:   i,
+				value: txWrite.Value,
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("tx %s is not applied to the snapshot", txId)
+}
+
 // check if snapshot is sealed
 func (s *SnapshotImpl) IsSealed() bool {
 	s.lock.Lock()
@@ -248,35 +288,64 @@ func (s *SnapshotImpl) Seal() {
 // read/write bitmap: 			key1	key2	key3
 //						tx1		1		0		1
 // 						tx2		0		1		1
+// The keys of sql statements are the tables they use, the statement of all tables of a contract sets the bits
+// of all the tables of the contract, see sqlConflictKeys
 func (s *SnapshotImpl) buildRWBitmaps() ([]*bitmap.Bitmap, []*bitmap.Bitmap) {
-	dictIndex := 0
 	txCount := len(s.txTable)
 	readBitmap := make([]*bitmap.Bitmap, txCount)
 	writeBitmap := make([]*bitmap.Bitmap, txCount)
 	keyDict := make(map[string]int, 1024)
+	setKey := func(b *bitmap.Bitmap, key string) {
+		if existIndex, ok := keyDict[key]; !ok {
+			keyDict[key] = len(keyDict)
+			b.Set(keyDict[key])
+		} else {
+			b.Set(existIndex)
+		}
+	}
+
+	var allTablesBitmaps []*bitmap.Bitmap
+	var allTablesPrefixes []string
 	for i := 0; i < txCount; i++ {
 		readTableItemForI := s.txRWSetTable[i].TxReads
 		writeTableItemForI := s.txRWSetTable[i].TxWrites
 
 		readBitmap[i] = &bitmap.Bitmap{}
 		for _, keyForI := range readTableItemForI {
-			if existIndex, ok := keyDict[string(keyForI.Key)]; !ok {
-				keyDict[string(keyForI.Key)] = dictIndex
-				readBitmap[i].Set(dictIndex)
-				dictIndex++
-			} else {
-				readBitmap[i].Set(existIndex)
+			if !isSqlRecord(keyForI.Key) {
+				setKey(readBitmap[i], string(keyForI.Key))
+				continue
+			}
+			for _, key := range s.sqlConflictKeys(keyForI.ContractName, keyForI.Value) {
+				setKey(readBitmap[i], key)
+				if prefix, table, _ := splitSqlConflictKey(key); table == sqlAllTables {
+					allTablesBitmaps = append(allTablesBitmaps, readBitmap[i])
+					allTablesPrefixes = append(allTablesPrefixes, prefix)
+				}
 			}
 		}
 
 		writeBitmap[i] = &bitmap.Bitmap{}
 		for _, keyForI := range writeTableItemForI {
-			if existIndex, ok := keyDict[string(keyForI.Key)]; !ok {
-				keyDict[string(keyForI.Key)] = dictIndex
-				writeBitmap[i].Set(dictIndex)
-				dictIndex++
-			} else {
-				writeBitmap[i].Set(existIndex)
+			if !isSqlRecord(keyForI.Key) {
+				setKey(writeBitmap[i], string(keyForI.Key))
+				continue
+			}
+			for _, key := range s.sqlConflictKeys(keyForI.ContractName, keyForI.Value) {
+				setKey(writeBitmap[i], key)
+				if prefix, table, _ := splitSqlConflictKey(key); table == sqlAllTables {
+					allTablesBitmaps = append(allTablesBitmaps, writeBitmap[i])
+					allTablesPrefixes = append(allTablesPrefixes, prefix)
+				}
+			}
+		}
+	}
+
+	// the tables used by the txs after are included too
+	for i, b := range allTablesBitmaps {
+		for key, index := range keyDict {
+			if strings.HasPrefix(key, allTablesPrefixes[i]) {
+				b.Set(index)
 			}
 		}
 	}
@@ -308,7 +377,10 @@ func (s *SnapshotImpl) buildCumulativeBitmap(readBitmap []*bitmap.Bitmap, writeB
 // world state, or cache state. As long as the world state or cache state that the tx depends on does not
 // change during the execution, then the execution result of the transaction is determined.
 // We need to ensure that when validating the DAG, there is no possibility that the execution of other
-// transactions will affect the dependence of the current transaction
+// transactions will affect the dependence of the current transaction.
+// The sql statements conflict at the granularity of table, isSql does not change the way of building DAG. The sql
+// txs are not chained to the other txs, but they are still executed one by one in the db transaction of block,
+// see TxScheduler.runInSqlSavePoint.
 func (s *SnapshotImpl) BuildDAG(isSql bool) *commonPb.DAG {
 	if !s.IsSealed() {
 		log.Warnf("you need to execute Seal before you can build DAG of snapshot with height %d", s.blockHeight)
@@ -338,40 +410,29 @@ func (s *SnapshotImpl) BuildDAG(isSql bool) *commonPb.DAG {
 	// tx2	1		0		0
 	// tx3	1		1		0
 	reachMap := make([]*bitmap.Bitmap, txCount)
-	if isSql {
-		for i := 0; i < txCount; i++ {
-			dag.Vertexes[i] = &commonPb.DAG_Neighbor{
-				Neighbors: make([]uint32, 0, 1),
-			}
-			if i != 0 {
-				dag.Vertexes[i].Neighbors = append(dag.Vertexes[i].Neighbors, uint32(i-1))
-			}
+	for i := 0; i < txCount; i++ {
+		// 1、get read and write bitmap for tx i
+		readBitmapForI := readBitmaps[i]
+		writeBitmapForI := writeBitmaps[i]
+
+		// directReach is used to build DAG
+		// reach is used to save reachability we have already known
+		directReachFromI := &bitmap.Bitmap{}
+		reachFromI := &bitmap.Bitmap{}
+		reachFromI.Set(i)
+
+		if i > 0 && s.fastConflicted(readBitmapForI, writeBitmapForI, cumulativeReadBitmap[i-1], cumulativeWriteBitmap[i-1]) {
+			// check reachability one by one, then build table
+			s.buildReach(i, reachFromI, readBitmaps, writeBitmaps, readBitmapForI, writeBitmapForI, directReachFromI, reachMap)
 		}
-	} else {
-		for i := 0; i < txCount; i++ {
-			// 1、get read and write bitmap for tx i
-			readBitmapForI := readBitmaps[i]
-			writeBitmapForI := writeBitmaps[i]
-
-			// directReach is used to build DAG
-			// reach is used to save reachability we have already known
-			directReachFromI := &bitmap.Bitmap{}
-			reachFromI := &bitmap.Bitmap{}
-			reachFromI.Set(i)
-
-			if i > 0 && s.fastConflicted(readBitmapForI, writeBitmapForI, cumulativeReadBitmap[i-1], cumulativeWriteBitmap[i-1]) {
-				// check reachability one by one, then build table
-				s.buildReach(i, reachFromI, readBitmaps, writeBitmaps, readBitmapForI, writeBitmapForI, directReachFromI, reachMap)
-			}
-			reachMap[i] = reachFromI
+		reachMap[i] = reachFromI
 
-			// build DAG based on directReach bitmap
-			dag.Vertexes[i] = &commonPb.DAG_Neighbor{
-				Neighbors: make([]uint32, 0, 16),
-			}
-			for _, j := range directReachFromI.Pos1() {
-				dag.Vertexes[i].Neighbors = append(dag.Vertexes[i].Neighbors, uint32(j))
-			}
+		// build DAG based on directReach bitmap
+		dag.Vertexes[i] = &commonPb.DAG_Neighbor{
+			Neighbors: make([]uint32, 0, 16),
+		}
+		for _, j := range directReachFromI.Pos1() {
+			dag.Vertexes[i].Neighbors = append(dag.Vertexes[i].Neighbors, uint32(j))
 		}
 	}
 	log.Debugf("build DAG for block %d finished", s.blockHeight)
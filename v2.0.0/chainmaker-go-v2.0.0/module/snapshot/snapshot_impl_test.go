@@ -19,6 +19,7 @@ import (
 	acPb "chainmaker.org/chainmaker/pb-go/v2/accesscontrol"
 	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
 	"chainmaker.org/chainmaker/protocol/v2"
+	"github.com/stretchr/testify/require"
 )
 
 var _ protocol.TxSimContext = (*MockSimContextImpl)(nil)
@@ -313,3 +314,37 @@ func dumpDAG(dag *commonPb.DAG) {
 	}
 	fmt.Println("}")
 }
+
+func TestSnapshotImpl_ApplyBlockWrite(t *testing.T) {
+	snapshot := newTestSnapshot()
+	for i := 0; i < 2; i++ {
+		txId := fmt.Sprintf("tx%d", i)
+		ok, _ := snapshot.ApplyTxSimContext(&MockSimContextImpl{
+			txExecSeq: int32(i),
+			tx:        &commonPb.Transaction{Payload: &commonPb.Payload{TxId: txId}},
+			txRwSet: &commonPb.TxRWSet{TxId: txId, TxWrites: []*commonPb.TxWrite{
+				{ContractName: "c1", Key: []byte("balance"), Value: []byte(txId)},
+			}},
+			txResult: &commonPb.Result{},
+		}, true)
+		require.True(t, ok)
+	}
+	snapshot.Seal()
+
+	// the write of the same key is replaced
+	require.NoError(t, snapshot.ApplyBlockWrite("tx1", &commonPb.TxWrite{
+		ContractName: "c1", Key: []byte("balance"), Value: []byte("credited")}))
+	require.Len(t, snapshot.GetTxRWSetTable()[1].TxWrites, 1)
+	value, err := snapshot.GetKey(-1, "c1", []byte("balance"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("credited"), value)
+
+	require.NoError(t, snapshot.ApplyBlockWrite("tx0", &commonPb.TxWrite{
+		ContractName: "c1", Key: []byte("fee"), Value: []byte("1")}))
+	require.Len(t, snapshot.GetTxRWSetTable()[0].TxWrites, 2)
+	value, err = snapshot.GetKey(-1, "c1", []byte("fee"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("1"), value)
+
+	require.Error(t, snapshot.ApplyBlockWrite("tx2", &commonPb.TxWrite{ContractName: "c1", Key: []byte("fee")}))
+}
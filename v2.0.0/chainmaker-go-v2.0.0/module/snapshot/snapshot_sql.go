@@ -0,0 +1,110 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package snapshot
+
+import (
+	"strings"
+
+	"chainmaker.org/chainmaker-go/utils"
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+)
+
+const (
+	// sqlKeySeparator separates the contract name and the table name in the conflict key of sql, it can not be
+	// a part of contract name, so the key never equals to the key of kv state
+	sqlKeySeparator = "\x00sql:"
+	// sqlAllTables is the table name of the sql whose tables are unknown, it conflicts with all the tables of
+	// the contract
+	sqlAllTables = "*"
+)
+
+// isSqlRecord returns whether the read or write is the sql statement recorded by PutRecord, its key is nil
+func isSqlRecord(key []byte) bool {
+	return len(key) == 0
+}
+
+// sqlConflictKey returns the conflict key of the table in contract
+func sqlConflictKey(contractName, table string) string {
+	return contractName + sqlKeySeparator + table
+}
+
+// splitSqlConflictKey returns the prefix of the contract and the table name of the sql conflict key
+func splitSqlConflictKey(key string) (prefix string, table string, ok bool) {
+	idx := strings.Index(key, sqlKeySeparator)
+	if idx < 0 {
+		return "", "", false
+	}
+	idx += len(sqlKeySeparator)
+	return key[:idx], key[idx:], true
+}
+
+// sqlConflictKeys returns the conflict keys of the tables used by the sql statement, the statement which can
+// not be parsed to the tables, or contains more than one statement, conflicts with all the tables of contract.
+// The parsed keys are cached in snapshot, the caller must hold the lock.
+func (s *SnapshotImpl) sqlConflictKeys(contractName string, sql []byte) []string {
+	cacheKey := contractName + sqlKeySeparator + string(sql)
+	if keys, ok := s.sqlKeyCache[cacheKey]; ok {
+		return keys
+	}
+
+	var tables []string
+	if utils.GetSqlStatementCount(string(sql)) == 1 {
+		tables = utils.GetSqlTableName(string(sql))
+	}
+	keys := make([]string, 0, len(tables))
+	if len(tables) == 0 {
+		keys = append(keys, sqlConflictKey(contractName, sqlAllTables))
+	}
+	for _, table := range tables {
+		// the table names are case insensitive in some databases
+		keys = append(keys, sqlConflictKey(contractName, strings.ToLower(table)))
+	}
+
+	if s.sqlKeyCache == nil {
+		s.sqlKeyCache = make(map[string][]string, 64)
+	}
+	s.sqlKeyCache[cacheKey] = keys
+	return keys
+}
+
+// readConflictKeys returns the keys of the read in read table
+func (s *SnapshotImpl) readConflictKeys(txRead *commonPb.TxRead) []string {
+	if isSqlRecord(txRead.Key) {
+		return s.sqlConflictKeys(txRead.ContractName, txRead.Value)
+	}
+	return []string{constructKey(txRead.ContractName, txRead.Key)}
+}
+
+// writeConflictKeys returns the keys of the write in write table
+func (s *SnapshotImpl) writeConflictKeys(txWrite *commonPb.TxWrite) []string {
+	if isSqlRecord(txWrite.Key) {
+		return s.sqlConflictKeys(txWrite.ContractName, txWrite.Value)
+	}
+	return []string{constructKey(txWrite.ContractName, txWrite.Key)}
+}
+
+// isReadConflicted returns whether the key read by the tx executed at txExecSeq has been written by the tx
+// applied after it, the sql table conflicts with the sql statement of all tables in the same contract
+func (s *SnapshotImpl) isReadConflicted(key string, txExecSeq int) bool {
+	if sv, ok := s.writeTable[key]; ok && sv.seq >= txExecSeq {
+		return true
+	}
+	prefix, table, ok := splitSqlConflictKey(key)
+	if !ok {
+		return false
+	}
+	if table != sqlAllTables {
+		sv, ok := s.writeTable[prefix+sqlAllTables]
+		return ok && sv.seq >= txExecSeq
+	}
+	for writeKey, sv := range s.writeTable {
+		if sv.seq >= txExecSeq && strings.HasPrefix(writeKey, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,275 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package snapshot
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"testing"
+
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	"github.com/stretchr/testify/require"
+)
+
+// sqlTx is a sql tx of test, it reads the tables by select and writes the tables by insert
+type sqlTx struct {
+	contractName string
+	reads        []string
+	writes       []string
+	// allTables means the tx executes the statement which can not be parsed, it uses all the tables
+	allTables bool
+	kvKeys    []string
+}
+
+func (tx *sqlTx) rwSet(txId string) *commonPb.TxRWSet {
+	rwSet := &commonPb.TxRWSet{TxId: txId}
+	for _, table := range tx.reads {
+		rwSet.TxReads = append(rwSet.TxReads, &commonPb.TxRead{
+			ContractName: tx.contractName,
+			Value:        []byte(fmt.Sprintf("SELECT * FROM %s WHERE id = 1", table)),
+		})
+	}
+	for _, table := range tx.writes {
+		rwSet.TxWrites = append(rwSet.TxWrites, &commonPb.TxWrite{
+			ContractName: tx.contractName,
+			Value:        []byte(fmt.Sprintf("INSERT INTO %s (id, v) VALUES (1, '%s')", table, txId)),
+		})
+	}
+	if tx.allTables {
+		rwSet.TxWrites = append(rwSet.TxWrites, &commonPb.TxWrite{
+			ContractName: tx.contractName,
+			Value:        []byte("CALL unknown_procedure()"),
+		})
+	}
+	for _, key := range tx.kvKeys {
+		rwSet.TxWrites = append(rwSet.TxWrites, &commonPb.TxWrite{
+			ContractName: tx.contractName,
+			Key:          []byte(key),
+			Value:        []byte(txId),
+		})
+	}
+	return rwSet
+}
+
+// execute appends the digest of the tables read by tx to the tables written by tx, so the state depends on the
+// order of the conflicted txs
+func (tx *sqlTx) execute(index int, tables []string, state map[string][]string) {
+	reads, writes := tx.reads, tx.writes
+	if tx.allTables {
+		reads, writes = tables, tables
+	}
+	digest := fmt.Sprintf("tx%d", index)
+	for _, table := range reads {
+		digest += fmt.Sprintf(":%s=%d", table, len(state[tx.contractName+table]))
+	}
+	for _, table := range writes {
+		state[tx.contractName+table] = append(state[tx.contractName+table], digest)
+	}
+	for _, key := range tx.kvKeys {
+		state[tx.contractName+"/"+key] = append(state[tx.contractName+"/"+key], digest)
+	}
+}
+
+func newTestSnapshot() *SnapshotImpl {
+	return &SnapshotImpl{
+		blockHeight: 100,
+		txTable:     make([]*commonPb.Transaction, 0, 256),
+		txResultMap: make(map[string]*commonPb.Result, 256),
+		readTable:   make(map[string]*sv, 256),
+		writeTable:  make(map[string]*sv, 256),
+	}
+}
+
+func applySqlTxs(t *testing.T, snapshot *SnapshotImpl, txs []*sqlTx) {
+	for i, tx := range txs {
+		txId := fmt.Sprintf("tx%d", i)
+		ok, _ := snapshot.ApplyTxSimContext(&MockSimContextImpl{
+			txExecSeq: int32(i),
+			tx:        &commonPb.Transaction{Payload: &commonPb.Payload{TxId: txId}},
+			txRwSet:   tx.rwSet(txId),
+			txResult:  &commonPb.Result{},
+		}, true)
+		require.True(t, ok)
+	}
+	snapshot.Seal()
+}
+
+func TestSnapshotImpl_BuildDAGOfSql(t *testing.T) {
+	txs := []*sqlTx{
+		{contractName: "c1", writes: []string{"t1"}},
+		{contractName: "c1", writes: []string{"t2"}},
+		{contractName: "c1", reads: []string{"t1"}, writes: []string{"t3"}},
+		{contractName: "c1", writes: []string{"T2"}},
+		{contractName: "c1", kvKeys: []string{"k"}},
+		{contractName: "c1", reads: []string{"t4"}},
+		{contractName: "c1", allTables: true},
+		{contractName: "c1", writes: []string{"t5"}},
+		{contractName: "c2", writes: []string{"t1"}},
+	}
+	snapshot := newTestSnapshot()
+	applySqlTxs(t, snapshot, txs)
+
+	dag := snapshot.BuildDAG(true)
+	neighbors := make([][]uint32, 0, len(dag.Vertexes))
+	for _, vertex := range dag.Vertexes {
+		neighbors = append(neighbors, vertex.Neighbors)
+	}
+	require.Equal(t, [][]uint32{
+		{},
+		{},
+		{0},       // read t1 after write t1
+		{1},       // write t2 after write t2, the table names are case insensitive
+		{},        // kv is independent of sql
+		{},        // read t4 which is not written
+		{2, 3, 5}, // the statement of unknown tables uses all tables of c1, tx0 and tx1 are reachable
+		{6},
+		{}, // the tables of other contract
+	}, neighbors)
+}
+
+func TestSnapshotImpl_ApplySqlConflicted(t *testing.T) {
+	snapshot := newTestSnapshot()
+	applySqlTxs(t, snapshot, []*sqlTx{{contractName: "c1", writes: []string{"t1"}}})
+	snapshot.sealed = false
+
+	// the txs are executed before tx0 is applied
+	for _, c := range []struct {
+		tx         *sqlTx
+		conflicted bool
+	}{
+		{&sqlTx{contractName: "c1", reads: []string{"t1"}}, true},
+		{&sqlTx{contractName: "c1", reads: []string{"t2"}}, false},
+		{&sqlTx{contractName: "c2", reads: []string{"t1"}}, false},
+	} {
+		ok, _ := snapshot.ApplyTxSimContext(&MockSimContextImpl{
+			txExecSeq: 0,
+			tx:        &commonPb.Transaction{Payload: &commonPb.Payload{TxId: "tx"}},
+			txRwSet:   c.tx.rwSet("tx"),
+			txResult:  &commonPb.Result{},
+		}, true)
+		require.Equal(t, !c.conflicted, ok, "%+v", c.tx)
+	}
+
+	// the read of all tables conflicts with the write of any table, and vice versa
+	rwSet := &commonPb.TxRWSet{TxReads: []*commonPb.TxRead{{ContractName: "c1", Value: []byte("SELECT 1; SELECT 2")}}}
+	ok, _ := snapshot.ApplyTxSimContext(&MockSimContextImpl{tx: &commonPb.Transaction{
+		Payload: &commonPb.Payload{TxId: "tx"}}, txRwSet: rwSet, txResult: &commonPb.Result{}}, true)
+	require.False(t, ok)
+
+	snapshot = newTestSnapshot()
+	applySqlTxs(t, snapshot, []*sqlTx{{contractName: "c1", allTables: true}})
+	snapshot.sealed = false
+	ok, _ = snapshot.ApplyTxSimContext(&MockSimContextImpl{tx: &commonPb.Transaction{
+		Payload: &commonPb.Payload{TxId: "tx"}}, txRwSet: (&sqlTx{contractName: "c1", reads: []string{"t9"}}).rwSet("tx"),
+		txResult: &commonPb.Result{}}, true)
+	require.False(t, ok)
+}
+
+// TestSnapshotImpl_SqlDAGMatchesSerial executes the random sql txs concurrently following the dag, the state must
+// be the same as executing them one by one
+func TestSnapshotImpl_SqlDAGMatchesSerial(t *testing.T) {
+	tables := []string{"t0", "t1", "t2", "t3", "t4", "t5", "t6", "t7"}
+	randTables := func(r *rand.Rand) []string {
+		var result []string
+		for _, i := range r.Perm(len(tables))[:r.Intn(3)] {
+			result = append(result, tables[i])
+		}
+		return result
+	}
+
+	for round := 0; round < 20; round++ {
+		r := rand.New(rand.NewSource(int64(round)))
+		txs := make([]*sqlTx, 0, 64)
+		for i := 0; i < 64; i++ {
+			tx := &sqlTx{
+				contractName: []string{"c1", "c2"}[r.Intn(2)],
+				reads:        randTables(r),
+				writes:       randTables(r),
+				allTables:    r.Intn(20) == 0,
+			}
+			if r.Intn(4) == 0 {
+				tx.kvKeys = []string{fmt.Sprintf("k%d", r.Intn(4))}
+			}
+			txs = append(txs, tx)
+		}
+		snapshot := newTestSnapshot()
+		applySqlTxs(t, snapshot, txs)
+		dag := snapshot.BuildDAG(true)
+
+		serialState := make(map[string][]string)
+		for i, tx := range txs {
+			tx.execute(i, tables, serialState)
+		}
+
+		independent := 0
+		for _, vertex := range dag.Vertexes {
+			if len(vertex.Neighbors) == 0 {
+				independent++
+			}
+		}
+		require.Greater(t, independent, 1, "round %d", round)
+
+		for i := 0; i < 5; i++ {
+			require.Equal(t, serialState, executeWithDAG(txs, tables, dag), "round %d", round)
+		}
+	}
+}
+
+// executeWithDAG executes each tx in a goroutine after the txs it depends on are executed
+func executeWithDAG(txs []*sqlTx, tables []string, dag *commonPb.DAG) map[string][]string {
+	var (
+		lock  sync.Mutex
+		wg    sync.WaitGroup
+		state = make(map[string][]string)
+		done  = make([]chan struct{}, len(txs))
+	)
+	for i := range txs {
+		done[i] = make(chan struct{})
+	}
+	for i := range txs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for _, j := range dag.Vertexes[i].Neighbors {
+				<-done[j]
+			}
+			lock.Lock()
+			txs[i].execute(i, tables, state)
+			lock.Unlock()
+			close(done[i])
+		}(i)
+	}
+	wg.Wait()
+	return state
+}
+
+func TestSqlConflictKeys(t *testing.T) {
+	snapshot := newTestSnapshot()
+	for sql, tables := range map[string][]string{
+		"SELECT * FROM t1 WHERE id = 1":                    {"t1"},
+		"select a.id from T1 a join db1.t2 b on a.id=b.id": {"t1", "db1.t2"},
+		"UPDATE t3 SET v = 1":                              {"t3"},
+		"DELETE FROM t4":                                   {"t4"},
+		"ALTER TABLE t5 ADD COLUMN c INT":                  {"t5"},
+		"INSERT INTO t6 SELECT * FROM t7":                  {"t6", "t7"},
+		"SELECT 1":                                         {sqlAllTables},
+		"not a sql":                                        {sqlAllTables},
+		"UPDATE t1 SET v = 1; UPDATE t2 SET v = 1":         {sqlAllTables},
+	} {
+		expected := make([]string, 0, len(tables))
+		for _, table := range tables {
+			expected = append(expected, sqlConflictKey("c1", table))
+		}
+		keys := snapshot.sqlConflictKeys("c1", []byte(sql))
+		require.ElementsMatch(t, expected, keys, sql)
+		for _, key := range keys {
+			require.True(t, strings.HasPrefix(key, "c1"+sqlKeySeparator))
+		}
+	}
+}
@@ -0,0 +1,29 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package store
+
+import (
+	"errors"
+
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+)
+
+// ErrContractEventDBDisabled is returned when querying the contract events while contract event db is disabled
+var ErrContractEventDBDisabled = errors.New("contract event db is disabled")
+
+// GetContractEvents returns the contract events in block height range [startHeight, endHeight] ordered by
+// block height, the events are filtered by the contract name and the topic if they are not empty.
+func (bs *BlockStoreImpl) GetContractEvents(contractName, topic string, startHeight,
+	endHeight uint64) ([]*commonPb.ContractEventInfo, error) {
+	if bs.storeConfig.DisableContractEventDB || bs.contractEventDB == nil {
+		return nil, ErrContractEventDBDisabled
+	}
+	if startHeight > endHeight {
+		return nil, errors.New("start block height is greater than end block height")
+	}
+	return bs.contractEventDB.GetContractEvents(contractName, topic, startHeight, endHeight)
+}
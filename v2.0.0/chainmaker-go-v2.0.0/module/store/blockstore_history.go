@@ -0,0 +1,125 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package store
+
+import (
+	"bytes"
+	"errors"
+
+	"chainmaker.org/chainmaker-go/store/archive"
+	"chainmaker.org/chainmaker-go/store/types"
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	storePb "chainmaker.org/chainmaker/pb-go/v2/store"
+	"chainmaker.org/chainmaker/protocol/v2"
+)
+
+var (
+	// ErrHistoryDBDisabled is returned when reading the state at a block height while history db or result db
+	// is disabled
+	ErrHistoryDBDisabled = errors.New("history db or result db is disabled, state at block height unavailable")
+	// ErrBlockHeightNotReached is returned when the block height is greater than the last block height
+	ErrBlockHeightNotReached = errors.New("block height not reached")
+)
+
+// ReadObjectAtHeight returns the state value for given contract name and key at the given block height,
+// or returns nil if the key did not exist at that height.
+// The value is rebuilt from the key modification history and the rwsets of the history db and result db.
+func (bs *BlockStoreImpl) ReadObjectAtHeight(contractName string, key []byte, height uint64) ([]byte, error) {
+	if err := bs.checkHeightReadable(height); err != nil {
+		return nil, err
+	}
+	return bs.readObjectAtHeight(contractName, key, height)
+}
+
+// SelectObjectAtHeight returns an iterator that contains all the key-values between given key ranges
+// at the given block height. startKey is included in the results and limit is excluded.
+func (bs *BlockStoreImpl) SelectObjectAtHeight(contractName string, startKey []byte, limit []byte,
+	height uint64) (protocol.StateIterator, error) {
+	if err := bs.checkHeightReadable(height); err != nil {
+		return nil, err
+	}
+	keys, err := bs.historyDB.GetKeysInRange(contractName, startKey, limit)
+	if err != nil {
+		return nil, err
+	}
+	kvs := make([]*storePb.KV, 0, len(keys))
+	for _, key := range keys {
+		value, err := bs.readObjectAtHeight(contractName, key, height)
+		if err != nil {
+			return nil, err
+		}
+		//deleted or not created yet
+		if len(value) == 0 {
+			continue
+		}
+		kvs = append(kvs, &storePb.KV{
+			ContractName: contractName,
+			Key:          key,
+			Value:        value,
+		})
+	}
+	return types.NewKVIterator(kvs), nil
+}
+
+// checkHeightReadable checks whether the state at the block height can be rebuilt
+func (bs *BlockStoreImpl) checkHeightReadable(height uint64) error {
+	if bs.storeConfig.DisableHistoryDB || bs.storeConfig.DisableResultDB {
+		return ErrHistoryDBDisabled
+	}
+	lastBlock, err := bs.GetLastBlock()
+	if err != nil {
+		return err
+	}
+	if lastBlock == nil || height > lastBlock.Header.BlockHeight {
+		return ErrBlockHeightNotReached
+	}
+	if pivot := bs.GetArchivedPivot(); pivot > 0 && height <= pivot {
+		return archive.ErrArchivedBlock
+	}
+	return nil
+}
+
+func (bs *BlockStoreImpl) readObjectAtHeight(contractName string, key []byte, height uint64) ([]byte, error) {
+	//find the txs of the last block which wrote the key, no later than height
+	txs, err := bs.historyDB.GetLastHistoryForKey(contractName, key, height)
+	if err != nil {
+		return nil, err
+	}
+	if len(txs) == 0 {
+		return nil, nil
+	}
+	writeHeight := txs[0].BlockHeight
+	if pivot := bs.GetArchivedPivot(); pivot > 0 && writeHeight <= pivot {
+		return nil, archive.ErrArchivedRWSet
+	}
+
+	var txRWSets []*commonPb.TxRWSet
+	if len(txs) == 1 {
+		txRWSet, err := bs.GetTxRWSet(txs[0].TxId)
+		if err != nil {
+			return nil, err
+		}
+		txRWSets = []*commonPb.TxRWSet{txRWSet}
+	} else {
+		//several txs of the block wrote the key, the rwsets are in block order and the last write wins
+		if txRWSets, err = bs.GetTxRWSetsByHeight(writeHeight); err != nil {
+			return nil, err
+		}
+	}
+	for i := len(txRWSets) - 1; i >= 0; i-- {
+		if txRWSets[i] == nil {
+			continue
+		}
+		writes := txRWSets[i].TxWrites
+		for j := len(writes) - 1; j >= 0; j-- {
+			if writes[j].ContractName == contractName && bytes.Equal(writes[j].Key, key) {
+				return writes[j].Value, nil
+			}
+		}
+	}
+	return nil, nil
+}
@@ -52,6 +52,14 @@ type BlockStoreImpl struct {
 	workersSemaphore *semaphore.Weighted
 	logger           protocol.Logger
 	storeConfig      *localconf.StorageConfig
+	chainId          string
+	// the height of the installed state snapshot, the blocks from it are logged after the genesis block in wal
+	snapshotHeight uint64
+	// the view of the states to export as state snapshot after the next block is committed
+	pendingSnapshot *pendingStateSnapshot
+	// exportingSnapshot is set while a state snapshot is exported in background
+	exportingSnapshot int32
+	exportWg          sync.WaitGroup
 }
 
 // NewBlockStoreImpl constructs new `BlockStoreImpl`
@@ -90,11 +98,17 @@ func NewBlockStoreImpl(chainId string,
 		workersSemaphore: semaphore.NewWeighted(int64(nWorkers)),
 		logger:           logger,
 		storeConfig:      storeConfig,
+		chainId:          chainId,
 	}
 
 	if err := blockStore.InitArchiveMgr(chainId); err != nil {
 		return nil, err
 	}
+	snapshotHeight, err := blockStore.getStateSnapshotHeight()
+	if err != nil {
+		return nil, err
+	}
+	blockStore.snapshotHeight = snapshotHeight
 
 	//binlog 有SavePoint，不是空数据库，进行数据恢复
 	if i, errbs := blockStore.getLastSavepoint(); errbs == nil && i > 0 {
@@ -106,6 +120,12 @@ func NewBlockStoreImpl(chainId string,
 	} else {
 		logger.Info("binlog is empty, don't need recover")
 	}
+	// the node can not run the chain whose config enables the state tree if the state db does not maintain it
+	if lastBlock, err := blockStore.GetLastBlock(); err == nil && lastBlock != nil {
+		if _, err = blockStore.IsStateTreeEnabled(); err != nil {
+			return nil, err
+		}
+	}
 	return blockStore, nil
 }
 
@@ -120,6 +140,9 @@ func (bs *BlockStoreImpl) InitGenesis(genesisBlock *storePb.BlockWithRWSet) erro
 	if err := checkGenesis(genesisBlock); err != nil {
 		return err
 	}
+	if err := bs.checkStateTreeSupported(genesisBlock.TxRWSets); err != nil {
+		return err
+	}
 	//创世区块只执行一次，而且可能涉及到创建创建数据库，所以串行执行，而且无法启用事务
 	blockBytes, blockWithSerializedInfo, err := serialization.SerializeBlock(genesisBlock)
 	if err != nil {
@@ -164,16 +187,11 @@ func (bs *BlockStoreImpl) InitGenesis(genesisBlock *storePb.BlockWithRWSet) erro
 	}
 	//6. init contract event db
 	if !bs.storeConfig.DisableContractEventDB {
-		if parseEngineType(bs.storeConfig.ContractEventDbConfig.SqlDbConfig.SqlDbType) == types.MySQL &&
-			bs.storeConfig.ContractEventDbConfig.Provider == localconf.DbConfig_Provider_Sql {
-			err = bs.contractEventDB.InitGenesis(blockWithSerializedInfo)
-			if err != nil {
-				bs.logger.Errorf("chain[%s] failed to write event db, block[%d]",
-					block.Header.ChainId, block.Header.BlockHeight)
-				return err
-			}
-		} else {
-			return errors.New("contract event db config err")
+		err = bs.contractEventDB.InitGenesis(blockWithSerializedInfo)
+		if err != nil {
+			bs.logger.Errorf("chain[%s] failed to write event db, block[%d]",
+				block.Header.ChainId, block.Header.BlockHeight)
+			return err
 		}
 	}
 	bs.logger.Infof("chain[%s]: put block[%d] hash[%x] (txs:%d bytes:%d), ",
@@ -199,6 +217,11 @@ func (bs *BlockStoreImpl) PutBlock(block *commonPb.Block, txRWSets []*commonPb.T
 	bs.logger.Debugf("chain[%s]: start put block[%d] (txs:%d)",
 		block.Header.ChainId, block.Header.BlockHeight, len(block.Txs))
 
+	if err := bs.checkStateTreeSupported(txRWSets); err != nil {
+		bs.logger.Errorf("chain[%s] failed to put block[%d], err:%s",
+			block.Header.ChainId, block.Header.BlockHeight, err)
+		return err
+	}
 	startPutBlock := utils.CurrentTimeMillisSeconds()
 	//1. commit log
 	blockWithRWSet := &storePb.BlockWithRWSet{
@@ -289,6 +312,9 @@ func (bs *BlockStoreImpl) PutBlock(block *commonPb.Block, txRWSets []*commonPb.T
 		block.Header.ChainId, block.Header.BlockHeight, block.Header.BlockHash, len(block.Txs), len(blockBytes),
 		elapsedMarshalBlockAndRWSet, elapsedCommitlogDB, elapsedCommitBlock,
 		utils.CurrentTimeMillisSeconds()-startPutBlock)
+
+	//8. export state snapshot in background
+	bs.exportStateSnapshot(block.Header.BlockHeight)
 	return nil
 }
 
@@ -541,18 +567,15 @@ func (bs *BlockStoreImpl) GetDBHandle(dbName string) protocol.DBHandle {
 
 // Close is used to close database
 func (bs *BlockStoreImpl) Close() error {
+	bs.releasePendingSnapshot()
+	bs.exportWg.Wait()
 	bs.blockDB.Close()
 	bs.stateDB.Close()
 	if !bs.storeConfig.DisableHistoryDB && bs.historyDB != nil {
 		bs.historyDB.Close()
 	}
 	if !bs.storeConfig.DisableContractEventDB && bs.contractEventDB != nil {
-		if parseEngineType(bs.storeConfig.ContractEventDbConfig.SqlDbConfig.SqlDbType) == types.MySQL &&
-			bs.storeConfig.ContractEventDbConfig.Provider == localconf.DbConfig_Provider_Sql {
-			bs.contractEventDB.Close()
-		} else {
-			return errors.New("contract event db config err")
-		}
+		bs.contractEventDB.Close()
 	}
 	if !bs.storeConfig.DisableResultDB && bs.resultDB != nil {
 		bs.resultDB.Close()
@@ -587,13 +610,8 @@ func (bs *BlockStoreImpl) recover() error {
 		}
 	}
 	if !bs.storeConfig.DisableContractEventDB {
-		if parseEngineType(bs.storeConfig.ContractEventDbConfig.SqlDbConfig.SqlDbType) == types.MySQL &&
-			bs.storeConfig.ContractEventDbConfig.Provider == localconf.DbConfig_Provider_Sql {
-			if contractEventSavepoint, err = bs.contractEventDB.GetLastSavepoint(); err != nil {
-				return err
-			}
-		} else {
-			return errors.New("contract event db config err")
+		if contractEventSavepoint, err = bs.contractEventDB.GetLastSavepoint(); err != nil {
+			return err
 		}
 	}
 
@@ -724,7 +742,15 @@ func (bs *BlockStoreImpl) recoverResultDB(currentHeight uint64, savePoint uint64
 
 func (bs *BlockStoreImpl) writeLog(blockHeight uint64, bytes []byte) error {
 	// wal log, index increase from 1, while blockHeight increase form 0
-	return bs.wal.Write(blockHeight+1, bytes)
+	return bs.wal.Write(bs.logIndex(blockHeight), bytes)
+}
+
+// logIndex returns the index of block in wal, the blocks from the installed state snapshot follow the genesis block
+func (bs *BlockStoreImpl) logIndex(blockHeight uint64) uint64 {
+	if bs.snapshotHeight > 0 && blockHeight >= bs.snapshotHeight {
+		return blockHeight - bs.snapshotHeight + 2
+	}
+	return blockHeight + 1
 }
 
 func (bs *BlockStoreImpl) getLastSavepoint() (uint64, error) {
@@ -735,11 +761,14 @@ func (bs *BlockStoreImpl) getLastSavepoint() (uint64, error) {
 	if lastIndex == 0 {
 		return 0, nil
 	}
+	if bs.snapshotHeight > 0 && lastIndex >= 2 {
+		return lastIndex - 2 + bs.snapshotHeight, nil
+	}
 	return lastIndex - 1, nil
 }
 
 func (bs *BlockStoreImpl) getBlockFromLog(num uint64) (*serialization.BlockWithSerializedInfo, error) {
-	index := num + 1
+	index := bs.logIndex(num)
 	bytes, err := bs.wal.Read(index)
 	if err != nil {
 		bs.logger.Errorf("read log failed, err:%s", err)
@@ -754,7 +783,7 @@ func (bs *BlockStoreImpl) getBlockFromLog(num uint64) (*serialization.BlockWithS
 }
 
 func (bs *BlockStoreImpl) deleteBlockFromLog(num uint64) error {
-	index := num + 1
+	index := bs.logIndex(num)
 	//delete block from log every 100 block
 	if (index % 100) != 0 {
 		return nil
@@ -820,7 +849,10 @@ func (bs *BlockStoreImpl) calculateRecoverHeight(currentHeight uint64, savePoint
 			height = height - 1
 		}
 	}
-
+	// the blocks before the installed state snapshot are not logged
+	if height < bs.snapshotHeight {
+		height = bs.snapshotHeight
+	}
 	return height
 }
 
@@ -10,6 +10,7 @@ import (
 	"bytes"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -20,14 +21,19 @@ import (
 	"chainmaker.org/chainmaker-go/store/archive"
 	"chainmaker.org/chainmaker-go/store/binlog"
 	"chainmaker.org/chainmaker-go/store/serialization"
+	"chainmaker.org/chainmaker-go/store/statedb"
+	"chainmaker.org/chainmaker-go/store/statedb/statekvdb"
 	"chainmaker.org/chainmaker-go/utils"
+	"chainmaker.org/chainmaker/common/v2/crypto/hash"
 	"chainmaker.org/chainmaker/common/v2/wal"
 	acPb "chainmaker.org/chainmaker/pb-go/v2/accesscontrol"
 	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	configPb "chainmaker.org/chainmaker/pb-go/v2/config"
 	storePb "chainmaker.org/chainmaker/pb-go/v2/store"
 	"chainmaker.org/chainmaker/pb-go/v2/syscontract"
 	"chainmaker.org/chainmaker/protocol/v2"
 	"chainmaker.org/chainmaker/protocol/v2/test"
+	"github.com/gogo/protobuf/proto"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -1045,3 +1051,441 @@ func verifyArchivedHeight(t *testing.T, avBlkHeight uint64, blocks []*commonPb.B
 	assert.True(t, archive.ErrArchivedRWSet == err9)
 	assert.True(t, vtBlkRWs == nil)
 }
+
+func Test_blockchainStoreImpl_ReadObjectAtHeight(t *testing.T) {
+	for _, conf := range []*localconf.StorageConfig{getSqlConfig(), getlvldbConfig("")} {
+		var factory Factory
+		store, err := factory.newStore(chainId, conf, binlog.NewMemBinlog(), log)
+		assert.Nil(t, err)
+		initHistoryBlocks(store)
+		s := store.(*BlockStoreImpl)
+
+		value, err := s.ReadObjectAtHeight(defaultContractName, []byte("key_0"), 1)
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("value_0@1"), value)
+		value, err = s.ReadObjectAtHeight(defaultContractName, []byte("key_0"), 2)
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("value_0@2"), value)
+		value, err = s.ReadObjectAtHeight(defaultContractName, []byte("key_0"), 3)
+		assert.Nil(t, err)
+		assert.Nil(t, value)
+		value, err = s.ReadObjectAtHeight(defaultContractName, []byte("key_1"), 1)
+		assert.Nil(t, err)
+		assert.Nil(t, value)
+		value, err = s.ReadObjectAtHeight(defaultContractName, []byte("key_1"), 3)
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("value_1@3"), value)
+		_, err = s.ReadObjectAtHeight(defaultContractName, []byte("key_0"), 4)
+		assert.Equal(t, ErrBlockHeightNotReached, err)
+		s.Close()
+	}
+}
+
+func Test_blockchainStoreImpl_SelectObjectAtHeight(t *testing.T) {
+	for _, conf := range []*localconf.StorageConfig{getSqlConfig(), getlvldbConfig("")} {
+		var factory Factory
+		store, err := factory.newStore(chainId, conf, binlog.NewMemBinlog(), log)
+		assert.Nil(t, err)
+		initHistoryBlocks(store)
+		s := store.(*BlockStoreImpl)
+
+		iter, err := s.SelectObjectAtHeight(defaultContractName, []byte("key_0"), []byte("key_9"), 2)
+		assert.Nil(t, err)
+		kvs := make(map[string]string)
+		for iter.Next() {
+			kv, e := iter.Value()
+			assert.Nil(t, e)
+			kvs[string(kv.Key)] = string(kv.Value)
+		}
+		iter.Release()
+		assert.Equal(t, map[string]string{"key_0": "value_0@2", "key_1": "value_1@2"}, kvs)
+
+		iter, err = s.SelectObjectAtHeight(defaultContractName, []byte("key_0"), []byte("key_9"), 3)
+		assert.Nil(t, err)
+		kvs = make(map[string]string)
+		for iter.Next() {
+			kv, e := iter.Value()
+			assert.Nil(t, e)
+			kvs[string(kv.Key)] = string(kv.Value)
+		}
+		iter.Release()
+		assert.Equal(t, map[string]string{"key_1": "value_1@3"}, kvs)
+		s.Close()
+	}
+}
+
+//初始化数据库：0创世区块，1-3区块修改key_0和key_1，3区块删除key_0并两次修改key_1
+func initHistoryBlocks(s protocol.BlockchainStore, genesisRWSets ...*commonPb.TxRWSet) {
+	genesis := &storePb.BlockWithRWSet{Block: block0, TxRWSets: genesisRWSets}
+	s.InitGenesis(genesis)
+	b, rw := createBlockAndRWSets(chainId, 1, 1)
+	rw[0].TxWrites[0].Value = []byte("value_0@1")
+	s.PutBlock(b, rw)
+	b, rw = createBlockAndRWSets(chainId, 2, 2)
+	rw[0].TxWrites[0].Value = []byte("value_0@2")
+	rw[1].TxWrites[0].Value = []byte("value_1@2")
+	s.PutBlock(b, rw)
+	b, rw = createBlockAndRWSets(chainId, 3, 3)
+	rw[0].TxWrites[0].Value = nil
+	rw[2].TxWrites[0].Key = []byte("key_1")
+	rw[2].TxWrites[0].Value = []byte("value_1@3")
+	s.PutBlock(b, rw)
+}
+
+// stateTreeConfigRWSet returns the rwset which writes the chain config enabling or disabling the state tree
+func stateTreeConfigRWSet(t *testing.T, enabled bool) *commonPb.TxRWSet {
+	chainConfig, err := proto.Marshal(&configPb.ChainConfig{
+		ChainId: chainId,
+		Crypto:  &configPb.CryptoConfig{Hash: "SHA256"},
+		Consensus: &configPb.ConsensusConfig{ExtConfig: []*configPb.ConfigKeyValue{
+			{Key: utils.StateTreeConfigKey, Value: fmt.Sprintf("%t", enabled)},
+		}},
+	})
+	assert.Nil(t, err)
+	return &commonPb.TxRWSet{
+		TxId: "state_tree_config",
+		TxWrites: []*commonPb.TxWrite{{
+			ContractName: syscontract.SystemContract_CHAIN_CONFIG.String(),
+			Key:          []byte(syscontract.SystemContract_CHAIN_CONFIG.String()),
+			Value:        chainConfig,
+		}},
+	}
+}
+
+func Test_blockchainStoreImpl_GetStateWithProof(t *testing.T) {
+	var factory Factory
+	conf := getlvldbConfig("")
+	store, err := factory.newStore(chainId, conf, binlog.NewMemBinlog(), log)
+	assert.Nil(t, err)
+	initHistoryBlocks(store, stateTreeConfigRWSet(t, true))
+	s := store.(*BlockStoreImpl)
+	defer s.Close()
+	enabled, err := s.IsStateTreeEnabled()
+	assert.Nil(t, err)
+	assert.True(t, enabled)
+
+	// the state root of block is the root after the previous block
+	for _, c := range []struct {
+		key         string
+		blockHeight uint64
+		value       []byte
+	}{
+		{"key_0", 1, nil},
+		{"key_0", 2, []byte("value_0@1")},
+		{"key_0", 3, []byte("value_0@2")},
+		{"key_1", 3, []byte("value_1@2")},
+		{"key_1", 2, nil},
+	} {
+		state, err := s.GetStateWithProof(defaultContractName, []byte(c.key), c.blockHeight)
+		assert.Nil(t, err)
+		assert.Equal(t, c.value, state.Value, "%s@%d", c.key, c.blockHeight)
+		assert.Nil(t, state.Verify())
+		state.Value = []byte("fake")
+		assert.NotNil(t, state.Verify())
+	}
+	_, err = s.GetStateWithProof(defaultContractName, []byte("key_0"), 4)
+	assert.Equal(t, ErrBlockHeightNotReached, err)
+
+	// the root calculated before committing is the same as the committed
+	root2, err := s.GetStateRoot(2)
+	assert.Nil(t, err)
+	root3, err := s.GetStateRoot(3)
+	assert.Nil(t, err)
+	assert.NotEqual(t, root2, root3)
+	writes := []*commonPb.TxWrite{
+		{ContractName: defaultContractName, Key: []byte("key_0")},
+		{ContractName: defaultContractName, Key: []byte("key_1"), Value: []byte("value_1@2")},
+		{ContractName: defaultContractName, Key: []byte("key_1"), Value: []byte("value_1@3")},
+	}
+	root, err := s.CalcStateRoot(root2, writes, make(map[string][]byte))
+	assert.Nil(t, err)
+	assert.Equal(t, root3, root)
+}
+
+func Test_blockchainStoreImpl_EnableStateTree(t *testing.T) {
+	var factory Factory
+	store, err := factory.newStore(chainId, getlvldbConfig(""), binlog.NewMemBinlog(), log)
+	assert.Nil(t, err)
+	s := store.(*BlockStoreImpl)
+	defer s.Close()
+	initHistoryBlocks(s)
+	_, err = s.GetStateRoot(3)
+	assert.Equal(t, ErrStateTreeDisabled, err)
+
+	enabledStore, err := factory.newStore(chainId, getlvldbConfig(""), binlog.NewMemBinlog(), log)
+	assert.Nil(t, err)
+	es := enabledStore.(*BlockStoreImpl)
+	defer es.Close()
+	initHistoryBlocks(es, stateTreeConfigRWSet(t, true))
+
+	// the state tree is built from the committed states by the block enabling it
+	b, rw := createBlockAndRWSets(chainId, 4, 1)
+	rw = append(rw, stateTreeConfigRWSet(t, true))
+	assert.Nil(t, s.PutBlock(b, rw))
+	assert.Nil(t, es.PutBlock(b, rw))
+	enabled, err := s.IsStateTreeEnabled()
+	assert.Nil(t, err)
+	assert.True(t, enabled)
+	root, err := s.GetStateRoot(3)
+	assert.Nil(t, err)
+	assert.Nil(t, root)
+	expected, err := es.GetStateRoot(4)
+	assert.Nil(t, err)
+	root, err = s.GetStateRoot(4)
+	assert.Nil(t, err)
+	assert.Equal(t, expected, root)
+
+	// the state tree is deleted by the block disabling it
+	b, rw = createBlockAndRWSets(chainId, 5, 1)
+	rw = append(rw, stateTreeConfigRWSet(t, false))
+	assert.Nil(t, s.PutBlock(b, rw))
+	enabled, err = s.IsStateTreeEnabled()
+	assert.Nil(t, err)
+	assert.False(t, enabled)
+	_, err = s.GetStateRoot(4)
+	assert.Equal(t, ErrStateTreeDisabled, err)
+	root, err = s.stateDB.(stateTreeDB).GetStateRoot(4)
+	assert.Nil(t, err)
+	assert.Nil(t, root)
+
+	// the state tree is not supported by sql state db, the config enabling it is refused
+	sqlStore, err := factory.newStore(chainId, getSqlConfig(), binlog.NewMemBinlog(), log)
+	assert.Nil(t, err)
+	defer sqlStore.Close()
+	ss := sqlStore.(*BlockStoreImpl)
+	assert.Equal(t, ErrStateTreeNotSupported, ss.InitGenesis(&storePb.BlockWithRWSet{Block: block0,
+		TxRWSets: []*commonPb.TxRWSet{stateTreeConfigRWSet(t, true)}}))
+	initHistoryBlocks(ss)
+	b, rw = createBlockAndRWSets(chainId, 4, 1)
+	assert.Equal(t, ErrStateTreeNotSupported, ss.PutBlock(b, append(rw, stateTreeConfigRWSet(t, true))))
+	lastBlock, err := ss.GetLastBlock()
+	assert.Nil(t, err)
+	assert.EqualValues(t, 3, lastBlock.Header.BlockHeight)
+	enabled, err = ss.IsStateTreeEnabled()
+	assert.Nil(t, err)
+	assert.False(t, enabled)
+}
+
+func Test_blockchainStoreImpl_StateTreeNotSupported(t *testing.T) {
+	var factory Factory
+	sqlStore, err := factory.newStore(chainId, getSqlConfig(), binlog.NewMemBinlog(), log)
+	assert.Nil(t, err)
+	defer sqlStore.Close()
+	s := sqlStore.(*BlockStoreImpl)
+	initHistoryBlocks(s)
+
+	// the chain config enabling the state tree is written by other way, it is an error instead of being disabled
+	s.stateDB = &stateTreeConfigStateDB{StateDB: s.stateDB, chainConfig: &configPb.ChainConfig{
+		Consensus: &configPb.ConsensusConfig{ExtConfig: []*configPb.ConfigKeyValue{
+			{Key: utils.StateTreeConfigKey, Value: "true"},
+		}},
+	}}
+	_, err = s.IsStateTreeEnabled()
+	assert.Equal(t, ErrStateTreeNotSupported, err)
+	_, err = s.GetStateRoot(3)
+	assert.Equal(t, ErrStateTreeNotSupported, err)
+
+	// the chain config can not be read
+	configErr := errors.New("chain config not found")
+	s.stateDB = &stateTreeConfigStateDB{StateDB: s.stateDB, err: configErr}
+	_, err = s.IsStateTreeEnabled()
+	assert.Equal(t, configErr, err)
+}
+
+// stateTreeConfigStateDB returns the chain config set
+type stateTreeConfigStateDB struct {
+	statedb.StateDB
+	chainConfig *configPb.ChainConfig
+	err         error
+}
+
+func (db *stateTreeConfigStateDB) GetChainConfig() (*configPb.ChainConfig, error) {
+	return db.chainConfig, db.err
+}
+
+func Test_blockchainStoreImpl_PruneStateTree(t *testing.T) {
+	var factory Factory
+	conf := getlvldbConfig("")
+	conf.RetainStateTreeBlocks = 2
+	store, err := factory.newStore(chainId, conf, binlog.NewMemBinlog(), log)
+	assert.Nil(t, err)
+	s := store.(*BlockStoreImpl)
+	defer s.Close()
+	initHistoryBlocks(s, stateTreeConfigRWSet(t, true))
+
+	// the values of key_0 are repeated, so the pruned nodes are built again
+	for height := uint64(4); height < 20; height++ {
+		b, rw := createBlockAndRWSets(chainId, height, 1)
+		rw[0].TxWrites[0].Value = []byte(fmt.Sprintf("value_0@%d", height%3))
+		assert.Nil(t, s.PutBlock(b, rw))
+
+		state, err := s.GetStateWithProof(defaultContractName, []byte("key_0"), height)
+		assert.Nil(t, err)
+		assert.Equal(t, []byte(fmt.Sprintf("value_0@%d", (height-1)%3)), state.Value)
+		assert.Nil(t, state.Verify())
+		_, err = s.GetStateWithProof(defaultContractName, []byte("key_0"), height-1)
+		assert.Equal(t, statekvdb.ErrStateRootNotFound, err)
+	}
+
+	// the nodes of the pruned roots are deleted, the trees of the 3 states have 5 nodes, the stale nodes of the
+	// last blocks may be kept since they are pruned from the flushed db
+	time.Sleep(time.Second)
+	iter := s.stateDB.(*statekvdb.StateKvDB).DbHandle.NewIteratorWithPrefix([]byte("\x00st/n/"))
+	defer iter.Release()
+	nodes := 0
+	for iter.Next() {
+		nodes++
+	}
+	assert.True(t, nodes <= 3*5, "%d nodes are kept", nodes)
+}
+
+// sealStateSnapshotBlock sets the rwset hashes, the tx root, the pre block hash, the state root and the hash of
+// the block as the proposer does
+func sealStateSnapshotBlock(t *testing.T, b *storePb.BlockWithRWSet, preBlock *commonPb.Block, stateRoot []byte) {
+	txHashes := make([][]byte, 0, len(b.Block.Txs))
+	for i, tx := range b.Block.Txs {
+		rwSetHash, err := utils.CalcRWSetHash("SHA256", b.TxRWSets[i])
+		assert.Nil(t, err)
+		tx.Result.RwSetHash = rwSetHash
+		txHash, err := utils.CalcTxHash("SHA256", tx)
+		assert.Nil(t, err)
+		txHashes = append(txHashes, txHash)
+	}
+	txRoot, err := hash.GetMerkleRoot("SHA256", txHashes)
+	assert.Nil(t, err)
+	b.Block.Header.TxRoot = txRoot
+	if preBlock != nil {
+		b.Block.Header.PreBlockHash = preBlock.Header.BlockHash
+		utils.SetBlockStateRoot(b.Block, stateRoot)
+	}
+	b.Block.Header.BlockHash, err = utils.CalcBlockHash("SHA256", b.Block)
+	assert.Nil(t, err)
+}
+
+//初始化数据库：0创世区块包含启用状态树的链配置，1-4区块修改key_0，区块包含上一区块的状态根，仅提交0-3区块
+func initStateSnapshotBlocks(t *testing.T, s *BlockStoreImpl) []*storePb.BlockWithRWSet {
+	genesis := createConfigBlock(chainId, 0)
+	genesis.Txs[0].Payload.ContractName = syscontract.SystemContract_CHAIN_CONFIG.String()
+	configRWSet := stateTreeConfigRWSet(t, true)
+	configRWSet.TxId = genesis.Txs[0].Payload.TxId
+	blocks := []*storePb.BlockWithRWSet{{Block: genesis, TxRWSets: []*commonPb.TxRWSet{configRWSet}}}
+	sealStateSnapshotBlock(t, blocks[0], nil, nil)
+	assert.Nil(t, s.InitGenesis(blocks[0]))
+	for height := uint64(1); height <= 4; height++ {
+		b, rw := createBlockAndRWSets(chainId, height, int(height))
+		rw[0].TxWrites[0].Value = []byte(fmt.Sprintf("value_0@%d", height))
+		blocks = append(blocks, &storePb.BlockWithRWSet{Block: b, TxRWSets: rw})
+		stateRoot, err := s.GetStateRoot(height - 1)
+		assert.Nil(t, err)
+		sealStateSnapshotBlock(t, blocks[height], blocks[height-1].Block, stateRoot)
+		if height < 4 {
+			assert.Nil(t, s.PutBlock(b, rw))
+		}
+	}
+	return blocks
+}
+
+func Test_blockchainStoreImpl_StateSnapshot(t *testing.T) {
+	var factory Factory
+	conf := getlvldbConfig("")
+	conf.StateSnapshotInterval = 3
+	store, err := factory.newStore(chainId, conf, binlog.NewMemBinlog(), log)
+	assert.Nil(t, err)
+	s := store.(*BlockStoreImpl)
+	defer s.Close()
+	blocks := initStateSnapshotBlocks(t, s)
+
+	// the snapshot is exported in background after the next block which commits its state root
+	manifest, err := s.GetStateSnapshotManifest()
+	assert.Nil(t, err)
+	assert.Nil(t, manifest)
+	assert.Nil(t, s.PutBlock(blocks[4].Block, blocks[4].TxRWSets))
+	for i := 0; i < 50 && manifest == nil; i++ {
+		time.Sleep(100 * time.Millisecond)
+		manifest, err = s.GetStateSnapshotManifest()
+		assert.Nil(t, err)
+	}
+	assert.NotNil(t, manifest)
+	assert.EqualValues(t, 3, manifest.BlockHeight)
+	assert.Equal(t, blocks[3].Block.Header.BlockHash, manifest.BlockHash)
+	assert.Equal(t, utils.GetBlockStateRoot(blocks[4].Block), manifest.StateRoot)
+	getChunk := func(index int) ([]byte, error) {
+		return s.GetStateSnapshotChunk(manifest.BlockHeight, index)
+	}
+	var verified []uint64
+	verifyBlock := func(block *commonPb.Block) error {
+		verified = append(verified, block.Header.BlockHeight)
+		return nil
+	}
+
+	// the new node installs the snapshot, then commits the blocks after it
+	newStore, err := factory.newStore(chainId, getlvldbConfig(""), binlog.NewMemBinlog(), log)
+	assert.Nil(t, err)
+	ns := newStore.(*BlockStoreImpl)
+	defer ns.Close()
+	assert.Nil(t, ns.InitGenesis(blocks[0]))
+	err = ns.InstallStateSnapshot(manifest, func(index int) ([]byte, error) {
+		chunk, err := getChunk(index)
+		return append(chunk, 0), err
+	}, verifyBlock)
+	assert.NotNil(t, err)
+	err = ns.InstallStateSnapshot(manifest, getChunk, func(block *commonPb.Block) error {
+		return errors.New("invalid signatures")
+	})
+	assert.NotNil(t, err)
+
+	// the states which do not match the state root committed by the next block are not installed
+	chunk, err := getChunk(0)
+	assert.Nil(t, err)
+	states, err := utils.DecodeStateSnapshotChunk(chunk)
+	assert.Nil(t, err)
+	for _, state := range states {
+		if string(state.Key) == "key_0" {
+			state.Value = []byte("fake")
+		}
+	}
+	fakeChunk, fakeHash, err := utils.EncodeStateSnapshotChunk(states)
+	assert.Nil(t, err)
+	fakeManifest := *manifest
+	fakeManifest.ChunkHashes = append([][]byte{fakeHash}, manifest.ChunkHashes[1:]...)
+	err = ns.InstallStateSnapshot(&fakeManifest, func(index int) ([]byte, error) {
+		if index == 0 {
+			return fakeChunk, nil
+		}
+		return getChunk(index)
+	}, verifyBlock)
+	assert.NotNil(t, err)
+	// the states are staged, the committed states are not changed by the failed installs
+	value, err := ns.ReadObject(defaultContractName, []byte("key_0"))
+	assert.Nil(t, err)
+	assert.Nil(t, value)
+	savepoint, err := ns.stateDB.GetLastSavepoint()
+	assert.Nil(t, err)
+	assert.EqualValues(t, 0, savepoint)
+
+	verified = nil
+	assert.Nil(t, ns.InstallStateSnapshot(manifest, getChunk, verifyBlock))
+	assert.Equal(t, []uint64{3, 4}, verified)
+	lastBlock, err := ns.GetLastBlock()
+	assert.Nil(t, err)
+	assert.EqualValues(t, 3, lastBlock.Header.BlockHeight)
+	value, err = ns.ReadObject(defaultContractName, []byte("key_0"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value_0@3"), value)
+	root, err := ns.GetStateRoot(3)
+	assert.Nil(t, err)
+	assert.Equal(t, manifest.StateRoot, root)
+
+	assert.Nil(t, ns.PutBlock(blocks[4].Block, blocks[4].TxRWSets))
+	savepoint, err = ns.getLastSavepoint()
+	assert.Nil(t, err)
+	assert.EqualValues(t, 4, savepoint)
+	expected, err := s.GetStateRoot(4)
+	assert.Nil(t, err)
+	root, err = ns.GetStateRoot(4)
+	assert.Nil(t, err)
+	assert.Equal(t, expected, root)
+
+	// the snapshot can not be installed again
+	assert.NotNil(t, ns.InstallStateSnapshot(manifest, getChunk, verifyBlock))
+}
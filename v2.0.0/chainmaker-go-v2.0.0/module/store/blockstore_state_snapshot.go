@@ -0,0 +1,479 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package store
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync/atomic"
+
+	"chainmaker.org/chainmaker-go/store/serialization"
+	"chainmaker.org/chainmaker-go/store/statedb/statekvdb"
+	"chainmaker.org/chainmaker-go/utils"
+	"chainmaker.org/chainmaker/common/v2/crypto/hash"
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	configPb "chainmaker.org/chainmaker/pb-go/v2/config"
+	storePb "chainmaker.org/chainmaker/pb-go/v2/store"
+	"github.com/gogo/protobuf/proto"
+)
+
+const (
+	stateSnapshotPath         = "state_snapshot"
+	stateSnapshotManifestFile = "manifest.json"
+	// the number of states in a chunk
+	stateSnapshotChunkSize = 4096
+	// the number of snapshots kept, the former one is kept for the peers which are fetching it
+	stateSnapshotKept = 2
+	// the key in common db of the height of the installed snapshot
+	stateSnapshotHeightKey = "stateSnapshotHeight"
+)
+
+// ErrStateSnapshotUnsupported is returned when the state db does not support the state snapshot
+var ErrStateSnapshotUnsupported = errors.New("state snapshot is only supported by kv state db")
+
+// stateSnapshotDB is implemented by the state db which can export and install the state snapshot
+type stateSnapshotDB interface {
+	SnapshotStates() *statekvdb.StatesSnapshot
+	DiscardStagedStates() error
+	StageStates(states []*commonPb.TxWrite) error
+	GetStagedChainConfig() (*configPb.ChainConfig, error)
+	CommitStateSnapshot(height uint64, stateRoot []byte) error
+}
+
+// pendingStateSnapshot is the view of the states of the block to export as state snapshot, it is exported once the
+// next block, which commits the state root of the states, is committed
+type pendingStateSnapshot struct {
+	height uint64
+	states *statekvdb.StatesSnapshot
+}
+
+// exportStateSnapshot is called after the block of height is committed. The view of the states is taken at the
+// blocks of the interval, and exported in background after the next block is committed. The snapshot is skipped
+// if the former one is still being exported.
+func (bs *BlockStoreImpl) exportStateSnapshot(height uint64) {
+	interval := bs.storeConfig.StateSnapshotInterval
+	db, ok := bs.stateDB.(stateSnapshotDB)
+	if interval == 0 || !ok {
+		return
+	}
+	if pending := bs.pendingSnapshot; pending != nil && pending.height+1 == height {
+		bs.pendingSnapshot = nil
+		if !atomic.CompareAndSwapInt32(&bs.exportingSnapshot, 0, 1) {
+			bs.logger.Warnf("skip the state snapshot of block[%d], the former one is being exported", pending.height)
+			pending.states.Release()
+		} else {
+			bs.exportWg.Add(1)
+			go func() {
+				defer bs.exportWg.Done()
+				defer atomic.StoreInt32(&bs.exportingSnapshot, 0)
+				defer pending.states.Release()
+				if _, err := bs.writeStateSnapshot(pending.height, pending.states); err != nil {
+					bs.logger.Warnf("chain[%s]: failed to export state snapshot, block[%d], err:%s", bs.chainId,
+						pending.height, err)
+				}
+			}()
+		}
+	}
+	if height%interval != 0 {
+		return
+	}
+	if enabled, err := bs.IsStateTreeEnabled(); err != nil || !enabled {
+		bs.logger.Warnf("skip the state snapshot of block[%d], the state tree is not enabled by chain config, "+
+			"err: %v", height, err)
+		return
+	}
+	bs.releasePendingSnapshot()
+	bs.pendingSnapshot = &pendingStateSnapshot{height: height, states: db.SnapshotStates()}
+}
+
+// releasePendingSnapshot releases the view of the states which is not exported
+func (bs *BlockStoreImpl) releasePendingSnapshot() {
+	if bs.pendingSnapshot != nil {
+		bs.pendingSnapshot.states.Release()
+		bs.pendingSnapshot = nil
+	}
+}
+
+// writeStateSnapshot writes the states after the block of height as a state snapshot to the state_snapshot
+// directory of the store, the next block must have been committed. Only the latest snapshots are kept.
+func (bs *BlockStoreImpl) writeStateSnapshot(height uint64, states *statekvdb.StatesSnapshot) (
+	*utils.StateSnapshotManifest, error) {
+	manifest, err := bs.newStateSnapshotManifest(height)
+	if err != nil {
+		return nil, err
+	}
+
+	dir := filepath.Join(bs.stateSnapshotDir(), fmt.Sprintf("%d.tmp", height))
+	if err = os.RemoveAll(dir); err != nil {
+		return nil, err
+	}
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	chunkStates := make([]*commonPb.TxWrite, 0, stateSnapshotChunkSize)
+	writeChunk := func() error {
+		chunk, hash, err := utils.EncodeStateSnapshotChunk(chunkStates)
+		if err != nil {
+			return err
+		}
+		if err = ioutil.WriteFile(stateSnapshotChunkFile(dir, len(manifest.ChunkHashes)), chunk, 0644); err != nil {
+			return err
+		}
+		manifest.ChunkHashes = append(manifest.ChunkHashes, hash)
+		chunkStates = chunkStates[:0]
+		return nil
+	}
+	if err = states.Iterate(func(state *commonPb.TxWrite) error {
+		chunkStates = append(chunkStates, state)
+		if len(chunkStates) < stateSnapshotChunkSize {
+			return nil
+		}
+		return writeChunk()
+	}); err != nil {
+		return nil, err
+	}
+	if len(chunkStates) > 0 {
+		if err = writeChunk(); err != nil {
+			return nil, err
+		}
+	}
+	manifestBytes, err := json.Marshal(manifest)
+	if err != nil {
+		return nil, err
+	}
+	if err = ioutil.WriteFile(filepath.Join(dir, stateSnapshotManifestFile), manifestBytes, 0644); err != nil {
+		return nil, err
+	}
+	if err = os.Rename(dir, filepath.Join(bs.stateSnapshotDir(), strconv.FormatUint(height, 10))); err != nil {
+		return nil, err
+	}
+	bs.logger.Infof("export state snapshot of block[%d], chunks: %d", height, len(manifest.ChunkHashes))
+
+	heights, err := bs.stateSnapshotHeights()
+	if err != nil {
+		return nil, err
+	}
+	for i := stateSnapshotKept; i < len(heights); i++ {
+		if err = os.RemoveAll(filepath.Join(bs.stateSnapshotDir(), strconv.FormatUint(heights[i], 10))); err != nil {
+			bs.logger.Warnf("remove state snapshot of block[%d] failed, %s", heights[i], err)
+		}
+	}
+	return manifest, nil
+}
+
+// GetStateSnapshotManifest returns the manifest of the latest state snapshot exported, or nil if none exists
+func (bs *BlockStoreImpl) GetStateSnapshotManifest() (*utils.StateSnapshotManifest, error) {
+	heights, err := bs.stateSnapshotHeights()
+	if err != nil || len(heights) == 0 {
+		return nil, err
+	}
+	bz, err := ioutil.ReadFile(filepath.Join(bs.stateSnapshotDir(), strconv.FormatUint(heights[0], 10),
+		stateSnapshotManifestFile))
+	if err != nil {
+		return nil, err
+	}
+	var manifest utils.StateSnapshotManifest
+	if err = json.Unmarshal(bz, &manifest); err != nil {
+		return nil, err
+	}
+	return &manifest, nil
+}
+
+// GetStateSnapshotChunk returns the chunk of index of the state snapshot after the block of height
+func (bs *BlockStoreImpl) GetStateSnapshotChunk(height uint64, index int) ([]byte, error) {
+	return ioutil.ReadFile(stateSnapshotChunkFile(
+		filepath.Join(bs.stateSnapshotDir(), strconv.FormatUint(height, 10)), index))
+}
+
+// InstallStateSnapshot installs the state snapshot to the store which has only the genesis block, getChunk
+// returns the chunk of index, which is verified against the manifest. The states are staged until they are
+// verified, then swapped in atomically. The staged chain config must enable the state tree, and the blocks of the
+// manifest are hashed with it. The block, the next block and the last config block of the snapshot are verified by
+// verifyBlock, which checks their signatures against the trust roots and the consensus nodes of the chain. The root
+// of the state tree of the staged states must be the state root committed by the next block.
+// The last config block and the block of the snapshot are committed after the states, then the blocks after the
+// snapshot are committed by PutBlock, the blocks between the genesis block and the snapshot are not kept.
+func (bs *BlockStoreImpl) InstallStateSnapshot(manifest *utils.StateSnapshotManifest,
+	getChunk func(index int) ([]byte, error), verifyBlock func(block *commonPb.Block) error) error {
+	db, ok := bs.stateDB.(stateSnapshotDB)
+	if !ok {
+		return ErrStateSnapshotUnsupported
+	}
+	lastBlock, err := bs.GetLastBlock()
+	if err != nil {
+		return err
+	}
+	if lastBlock == nil || lastBlock.Header.BlockHeight != 0 {
+		return errors.New("state snapshot can only be installed to the store with only the genesis block")
+	}
+	if manifest.ChainId != lastBlock.Header.ChainId || manifest.BlockHeight == 0 {
+		return fmt.Errorf("invalid state snapshot of chain[%s] block[%d]", manifest.ChainId, manifest.BlockHeight)
+	}
+	block, configBlock, err := manifest.GetBlocks()
+	if err != nil {
+		return err
+	}
+	nextBlock, err := manifest.GetNextBlock()
+	if err != nil {
+		return err
+	}
+
+	bs.logger.Infof("install state snapshot of block[%d], chunks: %d", manifest.BlockHeight,
+		len(manifest.ChunkHashes))
+	if err = db.DiscardStagedStates(); err != nil {
+		return err
+	}
+	for i := range manifest.ChunkHashes {
+		chunk, err := getChunk(i)
+		if err != nil {
+			return err
+		}
+		if err = manifest.VerifyChunk(i, chunk); err != nil {
+			return err
+		}
+		states, err := utils.DecodeStateSnapshotChunk(chunk)
+		if err != nil {
+			return err
+		}
+		if err = db.StageStates(states); err != nil {
+			return err
+		}
+		bs.logger.Debugf("install state snapshot chunk %d/%d", i+1, len(manifest.ChunkHashes))
+	}
+
+	chainConfig, err := db.GetStagedChainConfig()
+	if err != nil {
+		return err
+	}
+	if !utils.IsStateTreeEnabled(chainConfig) {
+		return errors.New("the states of snapshot can not be verified, the state tree is not enabled")
+	}
+	if err = verifyStateSnapshotBlocks(chainConfig.Crypto.Hash, lastBlock, block, configBlock, nextBlock,
+		verifyBlock); err != nil {
+		return err
+	}
+	if err = db.CommitStateSnapshot(manifest.BlockHeight, manifest.StateRoot); err != nil {
+		return err
+	}
+
+	// the config block is not logged, the blocks from the block of snapshot are logged after the genesis block
+	if configBlock.Block.Header.BlockHeight != 0 && configBlock.Block.Header.BlockHeight != manifest.BlockHeight {
+		if _, configBlockInfo, err := serialization.SerializeBlock(configBlock); err != nil {
+			return err
+		} else if err = bs.commitStateSnapshotBlock(configBlockInfo); err != nil {
+			return err
+		}
+	}
+	heightBytes := make([]byte, 8)
+	binary.BigEndian.PutUint64(heightBytes, manifest.BlockHeight)
+	if err = bs.commonDB.Put([]byte(stateSnapshotHeightKey), heightBytes); err != nil {
+		return err
+	}
+	bs.snapshotHeight = manifest.BlockHeight
+	blockBytes, blockInfo, err := serialization.SerializeBlock(block)
+	if err != nil {
+		return err
+	}
+	if err = bs.writeLog(manifest.BlockHeight, blockBytes); err != nil {
+		return err
+	}
+	if err = bs.commitStateSnapshotBlock(blockInfo); err != nil {
+		return err
+	}
+	bs.logger.Infof("chain[%s]: install state snapshot of block[%d] hash[%x]", manifest.ChainId,
+		manifest.BlockHeight, manifest.BlockHash)
+	return nil
+}
+
+// verifyStateSnapshotBlocks verifies the hashes of the blocks of state snapshot, the txs and rwsets of the blocks
+// to commit against their headers, and the signatures of the blocks by verifyBlock. The config block at height 0
+// must be the genesis block of the store.
+func verifyStateSnapshotBlocks(hashType string, genesis *commonPb.Block, block, configBlock *storePb.BlockWithRWSet,
+	nextBlock *commonPb.Block, verifyBlock func(block *commonPb.Block) error) error {
+	for _, b := range []*commonPb.Block{block.Block, configBlock.Block, nextBlock} {
+		blockHash, err := utils.CalcBlockHash(hashType, b)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(blockHash, b.Header.BlockHash) {
+			return fmt.Errorf("block[%d] hash expect %x, got %x", b.Header.BlockHeight, b.Header.BlockHash,
+				blockHash)
+		}
+	}
+	if err := verifyStateSnapshotTxs(hashType, block); err != nil {
+		return err
+	}
+	if configBlock.Block.Header.BlockHeight == 0 {
+		if !bytes.Equal(configBlock.Block.Header.BlockHash, genesis.Header.BlockHash) {
+			return fmt.Errorf("genesis block expect %x, got %x", genesis.Header.BlockHash,
+				configBlock.Block.Header.BlockHash)
+		}
+	} else if configBlock.Block.Header.BlockHeight != block.Block.Header.BlockHeight {
+		if err := verifyStateSnapshotTxs(hashType, configBlock); err != nil {
+			return err
+		}
+		if err := verifyBlock(configBlock.Block); err != nil {
+			return err
+		}
+	}
+	if err := verifyBlock(block.Block); err != nil {
+		return err
+	}
+	return verifyBlock(nextBlock)
+}
+
+// verifyStateSnapshotTxs verifies the txs of the block against the tx root and the rwsets against the rwset hashes
+// in the tx results, so that the history and the results committed with the block are those of the chain
+func verifyStateSnapshotTxs(hashType string, block *storePb.BlockWithRWSet) error {
+	txs := block.Block.Txs
+	if len(block.TxRWSets) != len(txs) {
+		return fmt.Errorf("block[%d] has %d txs but %d rwsets", block.Block.Header.BlockHeight, len(txs),
+			len(block.TxRWSets))
+	}
+	txHashes := make([][]byte, 0, len(txs))
+	for i, tx := range txs {
+		txHash, err := utils.CalcTxHash(hashType, tx)
+		if err != nil {
+			return err
+		}
+		txHashes = append(txHashes, txHash)
+		rwSetHash, err := utils.CalcRWSetHash(hashType, block.TxRWSets[i])
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(rwSetHash, tx.Result.GetRwSetHash()) {
+			return fmt.Errorf("rwset hash of tx[%s] expect %x, got %x", tx.Payload.GetTxId(),
+				tx.Result.GetRwSetHash(), rwSetHash)
+		}
+	}
+	txRoot, err := hash.GetMerkleRoot(hashType, txHashes)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(txRoot, block.Block.Header.TxRoot) {
+		return fmt.Errorf("tx root of block[%d] expect %x, got %x", block.Block.Header.BlockHeight,
+			block.Block.Header.TxRoot, txRoot)
+	}
+	return nil
+}
+
+func (bs *BlockStoreImpl) newStateSnapshotManifest(height uint64) (*utils.StateSnapshotManifest, error) {
+	block, err := bs.GetBlockWithRWSets(height)
+	if err != nil {
+		return nil, err
+	}
+	if block == nil {
+		return nil, fmt.Errorf("block[%d] not found", height)
+	}
+	// the snapshot is exported in background, the config block is the last one at the block instead of the latest
+	configHeight := block.Block.Header.PreConfHeight
+	if utils.IsConfBlock(block.Block) {
+		configHeight = height
+	}
+	configBlock, err := bs.GetBlockWithRWSets(configHeight)
+	if err != nil {
+		return nil, err
+	}
+	if configBlock == nil {
+		return nil, fmt.Errorf("config block[%d] of block[%d] not found", configHeight, height)
+	}
+	nextBlock, err := bs.GetBlock(height + 1)
+	if err != nil {
+		return nil, err
+	}
+	if nextBlock == nil {
+		return nil, fmt.Errorf("block[%d] which commits the state root not found", height+1)
+	}
+	// the state root is the one committed by the next block
+	manifest := &utils.StateSnapshotManifest{
+		ChainId:     block.Block.Header.ChainId,
+		BlockHeight: height,
+		BlockHash:   block.Block.Header.BlockHash,
+		StateRoot:   utils.GetBlockStateRoot(nextBlock),
+	}
+	if manifest.StateRoot == nil {
+		return nil, fmt.Errorf("block[%d] has no state root", height+1)
+	}
+	if manifest.Block, err = proto.Marshal(block); err != nil {
+		return nil, err
+	}
+	if manifest.NextBlock, err = proto.Marshal(&commonPb.Block{
+		Header:         nextBlock.Header,
+		AdditionalData: nextBlock.AdditionalData,
+	}); err != nil {
+		return nil, err
+	}
+	if manifest.ConfigBlock, err = proto.Marshal(configBlock); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// commitStateSnapshotBlock commits the block of the state snapshot to the dbs except the state db
+func (bs *BlockStoreImpl) commitStateSnapshotBlock(blockInfo *serialization.BlockWithSerializedInfo) error {
+	commits := []commitBlock{bs.blockDB.CommitBlock}
+	if !bs.storeConfig.DisableHistoryDB {
+		commits = append(commits, bs.historyDB.CommitBlock)
+	}
+	if !bs.storeConfig.DisableResultDB {
+		commits = append(commits, bs.resultDB.CommitBlock)
+	}
+	if !bs.storeConfig.DisableContractEventDB {
+		commits = append(commits, bs.contractEventDB.CommitBlock)
+	}
+	for _, commit := range commits {
+		if err := commit(blockInfo); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getStateSnapshotHeight returns the height of the installed state snapshot, or 0 if none is installed
+func (bs *BlockStoreImpl) getStateSnapshotHeight() (uint64, error) {
+	heightBytes, err := bs.commonDB.Get([]byte(stateSnapshotHeightKey))
+	if err != nil || len(heightBytes) == 0 {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(heightBytes), nil
+}
+
+func (bs *BlockStoreImpl) stateSnapshotDir() string {
+	return filepath.Join(bs.storeConfig.StorePath, bs.chainId, stateSnapshotPath)
+}
+
+// stateSnapshotHeights returns the heights of the exported state snapshots in descending order
+func (bs *BlockStoreImpl) stateSnapshotHeights() ([]uint64, error) {
+	files, err := ioutil.ReadDir(bs.stateSnapshotDir())
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	heights := make([]uint64, 0, len(files))
+	for _, file := range files {
+		if height, err := strconv.ParseUint(file.Name(), 10, 64); err == nil && file.IsDir() {
+			heights = append(heights, height)
+		}
+	}
+	sort.Slice(heights, func(i, j int) bool {
+		return heights[i] > heights[j]
+	})
+	return heights, nil
+}
+
+func stateSnapshotChunkFile(dir string, index int) string {
+	return filepath.Join(dir, fmt.Sprintf("chunk_%d", index))
+}
@@ -0,0 +1,119 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package store
+
+import (
+	"errors"
+
+	"chainmaker.org/chainmaker-go/utils"
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	configPb "chainmaker.org/chainmaker/pb-go/v2/config"
+	"chainmaker.org/chainmaker/pb-go/v2/syscontract"
+)
+
+var (
+	// ErrStateTreeDisabled is returned when using the state tree while it is not enabled by the chain config
+	ErrStateTreeDisabled = errors.New("state tree is disabled")
+	// ErrStateTreeNotSupported is returned when the state tree is enabled but the state db does not maintain it
+	ErrStateTreeNotSupported = errors.New("state tree is only supported by kv state db")
+)
+
+// stateTreeDB is implemented by the state db which maintains the state tree
+type stateTreeDB interface {
+	GetStateRoot(height uint64) ([]byte, error)
+	CalcStateRoot(root []byte, writes []*commonPb.TxWrite, nodes map[string][]byte) ([]byte, error)
+	GetStateWithProof(contractName string, key []byte, blockHeight uint64) (*utils.StateWithProof, error)
+}
+
+// IsStateTreeEnabled returns whether the state tree is maintained, the blocks carry the state root if it is.
+// The error is returned if the chain config can not be read, or it enables the state tree on the state db which
+// does not maintain it, the blocks can neither be proposed nor verified then.
+func (bs *BlockStoreImpl) IsStateTreeEnabled() (bool, error) {
+	_, err := bs.stateTree()
+	if err == ErrStateTreeDisabled {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// GetStateRoot returns the root of state tree after the block of height is committed, or nil if not found
+func (bs *BlockStoreImpl) GetStateRoot(height uint64) ([]byte, error) {
+	tree, err := bs.stateTree()
+	if err != nil {
+		return nil, err
+	}
+	return tree.GetStateRoot(height)
+}
+
+// CalcStateRoot applies the writes to the state tree of root without committing them, the new nodes are added
+// to nodes, so the state root of the blocks not committed can be chained
+func (bs *BlockStoreImpl) CalcStateRoot(root []byte, writes []*commonPb.TxWrite, nodes map[string][]byte) (
+	[]byte, error) {
+	tree, err := bs.stateTree()
+	if err != nil {
+		return nil, err
+	}
+	return tree.CalcStateRoot(root, writes, nodes)
+}
+
+// GetStateWithProof returns the state value and the proof of it against the state root committed in the block of
+// blockHeight, the value is nil if the key does not exist
+func (bs *BlockStoreImpl) GetStateWithProof(contractName string, key []byte, blockHeight uint64) (
+	*utils.StateWithProof, error) {
+	tree, err := bs.stateTree()
+	if err != nil {
+		return nil, err
+	}
+	lastBlock, err := bs.GetLastBlock()
+	if err != nil {
+		return nil, err
+	}
+	if lastBlock == nil || blockHeight > lastBlock.Header.BlockHeight {
+		return nil, ErrBlockHeightNotReached
+	}
+	return tree.GetStateWithProof(contractName, key, blockHeight)
+}
+
+// checkStateTreeSupported refuses the block writing the chain config which enables the state tree if the state db
+// does not maintain it
+func (bs *BlockStoreImpl) checkStateTreeSupported(txRWSets []*commonPb.TxRWSet) error {
+	if _, ok := bs.stateDB.(stateTreeDB); ok {
+		return nil
+	}
+	configName := syscontract.SystemContract_CHAIN_CONFIG.String()
+	for _, rwSet := range txRWSets {
+		for _, write := range rwSet.GetTxWrites() {
+			if write.ContractName != configName || string(write.Key) != configName {
+				continue
+			}
+			chainConfig := &configPb.ChainConfig{}
+			if err := chainConfig.Unmarshal(write.Value); err != nil {
+				return err
+			}
+			if utils.IsStateTreeEnabled(chainConfig) {
+				return ErrStateTreeNotSupported
+			}
+		}
+	}
+	return nil
+}
+
+// stateTree returns the state db if the state tree is enabled by the last chain config
+func (bs *BlockStoreImpl) stateTree() (stateTreeDB, error) {
+	chainConfig, err := bs.GetLastChainConfig()
+	if err != nil {
+		return nil, err
+	}
+	if !utils.IsStateTreeEnabled(chainConfig) {
+		return nil, ErrStateTreeDisabled
+	}
+	tree, ok := bs.stateDB.(stateTreeDB)
+	if !ok {
+		return nil, ErrStateTreeNotSupported
+	}
+	return tree, nil
+}
@@ -2,10 +2,11 @@ package contracteventdb
 
 import (
 	"chainmaker.org/chainmaker-go/store/serialization"
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
 )
 
 // ContractEventDB provides handle to contract event
-// This implementation provides a mysql based data model
+// This implementation provides a kv or sql based data model
 type ContractEventDB interface {
 
 	// CommitBlock commits the event in an atomic operation
@@ -17,6 +18,11 @@ type ContractEventDB interface {
 	// GetLastSavepoint returns the last block height
 	GetLastSavepoint() (uint64, error)
 
+	// GetContractEvents returns the events in block height range [startHeight, endHeight] ordered by block height,
+	// the events are filtered by the contract name and the topic if they are not empty,
+	// the topic filter works with the contract name only.
+	GetContractEvents(contractName, topic string, startHeight, endHeight uint64) ([]*commonPb.ContractEventInfo, error)
+
 	// Close is used to close database
 	Close()
 }
@@ -0,0 +1,233 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package eventkvdb
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"math"
+
+	"chainmaker.org/chainmaker-go/store/serialization"
+	"chainmaker.org/chainmaker-go/store/types"
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	"chainmaker.org/chainmaker/protocol/v2"
+	"github.com/gogo/protobuf/proto"
+)
+
+const (
+	eventPrefix                 = "e" // e{contractName}#{blockHeight}{eventSeq} -> ContractEventInfo
+	topicIndexPrefix            = "t" // t{contractName}#{hex(topic)}#{blockHeight}{eventSeq} -> nil
+	heightIndexPrefix           = "h" // h{blockHeight}{eventSeq} -> contractName
+	contractEventDBSavepointKey = "contractEventSavepointKey"
+	splitChar                   = "#"
+
+	// the length of {blockHeight}{eventSeq}, eventSeq is the position of the event in the block
+	eventPosLen = 12
+)
+
+// ContractEventKvDB provider an implementation of `contracteventdb.ContractEventDB`
+// This implementation provides a key-value based data model
+type ContractEventKvDB struct {
+	dbHandle protocol.DBHandle
+	logger   protocol.Logger
+}
+
+// NewContractEventKvDB construct a new `ContractEventDB` on the db handle
+func NewContractEventKvDB(db protocol.DBHandle, logger protocol.Logger) *ContractEventKvDB {
+	return &ContractEventKvDB{
+		dbHandle: db,
+		logger:   logger,
+	}
+}
+
+func (c *ContractEventKvDB) InitGenesis(genesisBlock *serialization.BlockWithSerializedInfo) error {
+	return c.CommitBlock(genesisBlock)
+}
+
+// CommitBlock commits the event in an atomic operation
+func (c *ContractEventKvDB) CommitBlock(blockInfo *serialization.BlockWithSerializedInfo) error {
+	batch := types.NewUpdateBatch()
+	block := blockInfo.Block
+	blockHeight := block.Header.BlockHeight
+	lastBlockNumBytes := make([]byte, 8)
+	binary.BigEndian.PutUint64(lastBlockNumBytes, blockHeight)
+	batch.Put([]byte(contractEventDBSavepointKey), lastBlockNumBytes)
+
+	var eventSeq uint32
+	for _, tx := range block.Txs {
+		if tx.Result == nil || tx.Result.ContractResult == nil {
+			continue
+		}
+		for _, event := range tx.Result.ContractResult.ContractEvent {
+			eventInfo := &commonPb.ContractEventInfo{
+				BlockHeight:     blockHeight,
+				ChainId:         block.Header.ChainId,
+				Topic:           event.Topic,
+				TxId:            event.TxId,
+				ContractName:    event.ContractName,
+				ContractVersion: event.ContractVersion,
+				EventData:       event.EventData,
+			}
+			eventBytes, err := proto.Marshal(eventInfo)
+			if err != nil {
+				return err
+			}
+			pos := constructEventPos(blockHeight, eventSeq)
+			batch.Put(constructEventKey(event.ContractName, pos), eventBytes)
+			batch.Put(constructTopicIndexKey(event.ContractName, event.Topic, pos), []byte{})
+			batch.Put(constructHeightIndexKey(pos), []byte(event.ContractName))
+			eventSeq++
+		}
+	}
+	if err := c.dbHandle.WriteBatch(batch, false); err != nil {
+		return err
+	}
+	c.logger.Debugf("chain[%s]: commit contract event block[%d], events: %d",
+		block.Header.ChainId, blockHeight, eventSeq)
+	return nil
+}
+
+// GetLastSavepoint returns the last block height
+func (c *ContractEventKvDB) GetLastSavepoint() (uint64, error) {
+	bytes, err := c.dbHandle.Get([]byte(contractEventDBSavepointKey))
+	if err != nil {
+		return 0, err
+	} else if bytes == nil {
+		return 0, nil
+	}
+	return binary.BigEndian.Uint64(bytes), nil
+}
+
+// GetContractEvents returns the events in block height range [startHeight, endHeight] ordered by block height
+func (c *ContractEventKvDB) GetContractEvents(contractName, topic string, startHeight,
+	endHeight uint64) ([]*commonPb.ContractEventInfo, error) {
+	if len(contractName) == 0 {
+		if len(topic) != 0 {
+			return nil, errors.New("contract name is required to filter the events by topic")
+		}
+		return c.getEventsByHeightIndex(startHeight, endHeight)
+	}
+	if len(topic) == 0 {
+		return c.getEventsOfContract(contractName, startHeight, endHeight)
+	}
+	return c.getEventsByTopicIndex(contractName, topic, startHeight, endHeight)
+}
+
+// Close is used to close database
+func (c *ContractEventKvDB) Close() {
+	c.logger.Info("close contract event kv db")
+	c.dbHandle.Close()
+}
+
+func (c *ContractEventKvDB) getEventsOfContract(contractName string, startHeight,
+	endHeight uint64) ([]*commonPb.ContractEventInfo, error) {
+	start, limit := heightRange([]byte(eventPrefix+contractName+splitChar), startHeight, endHeight)
+	iter := c.dbHandle.NewIteratorWithRange(start, limit)
+	defer iter.Release()
+	events := make([]*commonPb.ContractEventInfo, 0)
+	for iter.Next() {
+		event := &commonPb.ContractEventInfo{}
+		if err := proto.Unmarshal(iter.Value(), event); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, iter.Error()
+}
+
+func (c *ContractEventKvDB) getEventsByTopicIndex(contractName, topic string, startHeight,
+	endHeight uint64) ([]*commonPb.ContractEventInfo, error) {
+	start, limit := heightRange(constructTopicIndexPrefix(contractName, topic), startHeight, endHeight)
+	iter := c.dbHandle.NewIteratorWithRange(start, limit)
+	defer iter.Release()
+	positions := make([][]byte, 0)
+	for iter.Next() {
+		key := iter.Key()
+		positions = append(positions, append([]byte{}, key[len(key)-eventPosLen:]...))
+	}
+	if err := iter.Error(); err != nil {
+		return nil, err
+	}
+	return c.getEvents(contractName, positions)
+}
+
+func (c *ContractEventKvDB) getEventsByHeightIndex(startHeight, endHeight uint64) ([]*commonPb.ContractEventInfo,
+	error) {
+	start, limit := heightRange([]byte(heightIndexPrefix), startHeight, endHeight)
+	iter := c.dbHandle.NewIteratorWithRange(start, limit)
+	defer iter.Release()
+	events := make([]*commonPb.ContractEventInfo, 0)
+	for iter.Next() {
+		key := iter.Key()
+		contractEvents, err := c.getEvents(string(iter.Value()), [][]byte{key[len(key)-eventPosLen:]})
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, contractEvents...)
+	}
+	return events, iter.Error()
+}
+
+func (c *ContractEventKvDB) getEvents(contractName string, positions [][]byte) ([]*commonPb.ContractEventInfo,
+	error) {
+	events := make([]*commonPb.ContractEventInfo, 0, len(positions))
+	for _, pos := range positions {
+		eventBytes, err := c.dbHandle.Get(constructEventKey(contractName, pos))
+		if err != nil {
+			return nil, err
+		}
+		if eventBytes == nil {
+			return nil, errors.New("contract event not found by index")
+		}
+		event := &commonPb.ContractEventInfo{}
+		if err = proto.Unmarshal(eventBytes, event); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+func constructEventPos(blockHeight uint64, eventSeq uint32) []byte {
+	pos := make([]byte, eventPosLen)
+	binary.BigEndian.PutUint64(pos, blockHeight)
+	binary.BigEndian.PutUint32(pos[8:], eventSeq)
+	return pos
+}
+
+func constructEventKey(contractName string, pos []byte) []byte {
+	return append([]byte(eventPrefix+contractName+splitChar), pos...)
+}
+
+func constructTopicIndexPrefix(contractName, topic string) []byte {
+	return []byte(topicIndexPrefix + contractName + splitChar + hex.EncodeToString([]byte(topic)) + splitChar)
+}
+
+func constructTopicIndexKey(contractName, topic string, pos []byte) []byte {
+	return append(constructTopicIndexPrefix(contractName, topic), pos...)
+}
+
+func constructHeightIndexKey(pos []byte) []byte {
+	return append([]byte(heightIndexPrefix), pos...)
+}
+
+// heightRange returns the key range [start, limit) of block height range [startHeight, endHeight] under the prefix
+func heightRange(prefix []byte, startHeight, endHeight uint64) (start []byte, limit []byte) {
+	heightBytes := make([]byte, 8)
+	binary.BigEndian.PutUint64(heightBytes, startHeight)
+	start = append(append([]byte{}, prefix...), heightBytes...)
+	if endHeight == math.MaxUint64 {
+		// the first key after all keys with the prefix
+		limit = append([]byte{}, prefix...)
+		limit[len(limit)-1]++
+		return start, limit
+	}
+	binary.BigEndian.PutUint64(heightBytes, endHeight+1)
+	limit = append(append([]byte{}, prefix...), heightBytes...)
+	return start, limit
+}
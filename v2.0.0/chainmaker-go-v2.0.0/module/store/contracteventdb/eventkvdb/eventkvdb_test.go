@@ -0,0 +1,111 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package eventkvdb
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"chainmaker.org/chainmaker-go/store/dbprovider/leveldbprovider"
+	"chainmaker.org/chainmaker-go/store/serialization"
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	"chainmaker.org/chainmaker/protocol/v2/test"
+	"github.com/stretchr/testify/assert"
+)
+
+var log = &test.GoLogger{}
+
+const testChainId = "testchainid_1"
+
+// createBlockWithEvents creates a block of two txs, each tx emits an event of topic1 and topic2 of the contract
+func createBlockWithEvents(height uint64, contractName string) *serialization.BlockWithSerializedInfo {
+	block := &commonPb.Block{
+		Header: &commonPb.BlockHeader{
+			ChainId:     testChainId,
+			BlockHeight: height,
+			BlockHash:   []byte(fmt.Sprintf("hash-%d", height)),
+		},
+	}
+	for i := 0; i < 2; i++ {
+		txId := fmt.Sprintf("tx-%d-%d", height, i)
+		tx := &commonPb.Transaction{
+			Payload: &commonPb.Payload{ChainId: testChainId, TxId: txId, ContractName: contractName},
+			Result: &commonPb.Result{
+				Code:           commonPb.TxStatusCode_SUCCESS,
+				ContractResult: &commonPb.ContractResult{},
+			},
+		}
+		for _, topic := range []string{"topic1", "topic2"} {
+			tx.Result.ContractResult.ContractEvent = append(tx.Result.ContractResult.ContractEvent,
+				&commonPb.ContractEvent{
+					Topic:           topic,
+					TxId:            txId,
+					ContractName:    contractName,
+					ContractVersion: "1.0",
+					EventData:       []string{topic, txId},
+				})
+		}
+		block.Txs = append(block.Txs, tx)
+	}
+	return &serialization.BlockWithSerializedInfo{Block: block}
+}
+
+func initKvDB(t *testing.T) *ContractEventKvDB {
+	db := NewContractEventKvDB(leveldbprovider.NewMemdbHandle(), log)
+	assert.Nil(t, db.InitGenesis(&serialization.BlockWithSerializedInfo{Block: &commonPb.Block{
+		Header: &commonPb.BlockHeader{ChainId: testChainId, BlockHeight: 0},
+	}}))
+	for height := uint64(1); height <= 3; height++ {
+		assert.Nil(t, db.CommitBlock(createBlockWithEvents(height, "contract1")))
+	}
+	assert.Nil(t, db.CommitBlock(createBlockWithEvents(4, "contract2")))
+	return db
+}
+
+func TestContractEventKvDB_GetLastSavepoint(t *testing.T) {
+	db := initKvDB(t)
+	height, err := db.GetLastSavepoint()
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(4), height)
+}
+
+func TestContractEventKvDB_GetContractEvents(t *testing.T) {
+	db := initKvDB(t)
+
+	events, err := db.GetContractEvents("contract1", "", 2, 3)
+	assert.Nil(t, err)
+	assert.Equal(t, 8, len(events))
+	assert.Equal(t, uint64(2), events[0].BlockHeight)
+	assert.Equal(t, []string{"topic1", "tx-2-0"}, events[0].EventData)
+	assert.Equal(t, "topic2", events[1].Topic)
+	assert.Equal(t, "tx-2-1", events[2].TxId)
+	assert.Equal(t, uint64(3), events[7].BlockHeight)
+
+	events, err = db.GetContractEvents("contract1", "topic2", 0, math.MaxUint64)
+	assert.Nil(t, err)
+	assert.Equal(t, 6, len(events))
+	for _, event := range events {
+		assert.Equal(t, "topic2", event.Topic)
+		assert.Equal(t, "contract1", event.ContractName)
+	}
+	assert.Equal(t, "tx-1-0", events[0].TxId)
+	assert.Equal(t, "tx-3-1", events[5].TxId)
+
+	events, err = db.GetContractEvents("", "", 3, 4)
+	assert.Nil(t, err)
+	assert.Equal(t, 8, len(events))
+	assert.Equal(t, "contract1", events[0].ContractName)
+	assert.Equal(t, "contract2", events[4].ContractName)
+
+	events, err = db.GetContractEvents("contract2", "topic1", 0, 3)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(events))
+
+	_, err = db.GetContractEvents("", "topic1", 0, 3)
+	assert.NotNil(t, err)
+}
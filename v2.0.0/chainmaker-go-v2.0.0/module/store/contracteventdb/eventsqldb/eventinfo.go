@@ -7,10 +7,61 @@
 
 package eventsqldb
 
+import "chainmaker.org/chainmaker-go/localconf"
+
 const (
 	CreateBlockHeightWithTopicTableDdl string = `CREATE TABLE IF NOT EXISTS block_height_topic_table_index( id bigint unsigned NOT NULL AUTO_INCREMENT,chain_id varchar(128),block_height bigint,topic_table_name_src varchar(512),topic_table_name_hex varchar(64),PRIMARY KEY (id),UNIQUE KEY unique_index(block_height,topic_table_name_src) );`
 	BlockHeightWithTopicTableName      string = `block_height_topic_table_index`
 	CreateBlockHeightIndexTableDdl     string = `CREATE TABLE IF NOT EXISTS block_height_index ( id bigint unsigned NOT NULL AUTO_INCREMENT,block_height bigint,PRIMARY KEY (id) ) ENGINE=InnoDB DEFAULT CHARSET=utf8;`
 	InitBlockHeightIndexTableDdl       string = `INSERT IGNORE INTO block_height_index (id,block_height) VALUES('1','0')`
 	BlockHeightIndexTableName          string = `block_height_index`
+
+	// the number of the event data columns of topic table, see utils.TopicTableColumnDdl
+	topicTableDataColumns = 16
+
+	ContractEventInfoTableName       string = `contract_event_infos`
+	CreateContractEventIndexDdl      string = `CREATE INDEX IF NOT EXISTS contract_event_index ON contract_event_infos (contract_name,block_height,event_seq)`
+	CreateContractEventTopicIndexDdl string = `CREATE INDEX IF NOT EXISTS contract_event_topic_index ON contract_event_infos (contract_name,topic,block_height,event_seq)`
 )
+
+// ContractEventInfo defines sqlite orm model, used to create table 'contract_event_infos'
+// which saves the events of all the contracts
+type ContractEventInfo struct {
+	BlockHeight     uint64
+	EventSeq        uint32 // the position of the event in the block
+	ChainId         string
+	ContractName    string
+	ContractVersion string
+	Topic           string
+	TxId            string
+	EventData       []byte // json of the event data list
+}
+
+func (b *ContractEventInfo) GetCreateTableSql(dbType string) string {
+	if dbType == localconf.SqlDbConfig_SqlDbType_Sqlite {
+		return `CREATE TABLE contract_event_infos (
+    block_height integer,event_seq integer,chain_id text,contract_name text,contract_version text,
+    topic text,tx_id text,event_data blob,
+    PRIMARY KEY (block_height,event_seq))`
+	}
+	panic("Unsupported db type:" + dbType)
+}
+func (b *ContractEventInfo) GetTableName() string {
+	return ContractEventInfoTableName
+}
+func (b *ContractEventInfo) GetInsertSql() (string, []interface{}) {
+	return "INSERT INTO contract_event_infos values(?,?,?,?,?,?,?,?)",
+		[]interface{}{b.BlockHeight, b.EventSeq, b.ChainId, b.ContractName, b.ContractVersion, b.Topic, b.TxId,
+			b.EventData}
+}
+func (b *ContractEventInfo) GetUpdateSql() (string, []interface{}) {
+	return `UPDATE contract_event_infos 
+set chain_id=?,contract_name=?,contract_version=?,topic=?,tx_id=?,event_data=?
+WHERE block_height=? and event_seq=?`,
+		[]interface{}{b.ChainId, b.ContractName, b.ContractVersion, b.Topic, b.TxId, b.EventData,
+			b.BlockHeight, b.EventSeq}
+}
+func (b *ContractEventInfo) GetCountSql() (string, []interface{}) {
+	return "SELECT count(*) FROM contract_event_infos WHERE block_height=? and event_seq=?",
+		[]interface{}{b.BlockHeight, b.EventSeq}
+}
@@ -8,35 +8,42 @@
 package eventsqldb
 
 import (
+	"errors"
 	"fmt"
+	"math"
+	"sort"
+	"strings"
 
 	"chainmaker.org/chainmaker-go/localconf"
 	"chainmaker.org/chainmaker-go/store/dbprovider/rawsqlprovider"
 	"chainmaker.org/chainmaker-go/store/serialization"
 	"chainmaker.org/chainmaker-go/utils"
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
 	"chainmaker.org/chainmaker/protocol/v2"
 )
 
 // BlockMysqlDB provider a implementation of `contracteventdb.ContractEventDB`
 // This implementation provides a mysql based data model
 type ContractEventSqlDB struct {
-	db     protocol.SqlDBHandle
-	Logger protocol.Logger
-	dbName string
+	db      protocol.SqlDBHandle
+	Logger  protocol.Logger
+	dbName  string
+	chainId string
 }
 
 // NewContractEventMysqlDB construct a new `ContractEventDB` for given chainId
 func NewContractEventMysqlDB(chainId string, sqlDbConfig *localconf.SqlDbConfig, logger protocol.Logger) (*ContractEventSqlDB, error) {
 	dbName := getDbName(sqlDbConfig, chainId)
 	db := rawsqlprovider.NewSqlDBHandle(dbName, sqlDbConfig, logger)
-	return newContractEventDB(dbName, db, logger)
+	return newContractEventDB(chainId, dbName, db, logger)
 }
 
-func newContractEventDB(dbName string, db protocol.SqlDBHandle, logger protocol.Logger) (*ContractEventSqlDB, error) {
+func newContractEventDB(chainId, dbName string, db protocol.SqlDBHandle, logger protocol.Logger) (*ContractEventSqlDB, error) {
 	cdb := &ContractEventSqlDB{
-		db:     db,
-		Logger: logger,
-		dbName: dbName,
+		db:      db,
+		Logger:  logger,
+		dbName:  dbName,
+		chainId: chainId,
 	}
 	cdb.initDb(dbName)
 	return cdb, nil
@@ -190,6 +197,112 @@ func (c *ContractEventSqlDB) GetLastSavepoint() (uint64, error) {
 	return uint64(blockHeight), err
 }
 
+// GetContractEvents returns the events in block height range [startHeight, endHeight] ordered by block height,
+// the events in the same block are ordered by topic table and then the saving order.
+func (c *ContractEventSqlDB) GetContractEvents(contractName, topic string, startHeight,
+	endHeight uint64) ([]*commonPb.ContractEventInfo, error) {
+	if len(contractName) == 0 && len(topic) != 0 {
+		return nil, errors.New("contract name is required to filter the events by topic")
+	}
+	startHeight, endHeight = sqlHeightRange(startHeight, endHeight)
+	rows, err := c.db.QueryMulti("select distinct topic_table_name_src,topic_table_name_hex from "+
+		BlockHeightWithTopicTableName+" where block_height>=? and block_height<=?", startHeight, endHeight)
+	if err != nil {
+		return nil, err
+	}
+	topicTables := make([]string, 0)
+	for rows.Next() {
+		var src, tableName string
+		if err = rows.ScanColumns(&src, &tableName); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if len(topic) != 0 && src != c.chainId+"_"+contractName+"_"+topic {
+			continue
+		}
+		if len(contractName) != 0 && !strings.HasPrefix(src, c.chainId+"_"+contractName+"_") {
+			continue
+		}
+		topicTables = append(topicTables, tableName)
+	}
+	rows.Close()
+	sort.Strings(topicTables)
+
+	events := make([]*commonPb.ContractEventInfo, 0)
+	for _, tableName := range topicTables {
+		tableEvents, err := c.getEventsInTopicTable(tableName, contractName, topic, startHeight, endHeight)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, tableEvents...)
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].BlockHeight < events[j].BlockHeight
+	})
+	return events, nil
+}
+
+func (c *ContractEventSqlDB) getEventsInTopicTable(tableName, contractName, topic string, startHeight,
+	endHeight uint64) ([]*commonPb.ContractEventInfo, error) {
+	var dataColumns string
+	for i := 1; i <= topicTableDataColumns; i++ {
+		dataColumns += fmt.Sprintf(",data%d", i)
+	}
+	sql := "select block_height,chain_id,contract_name,contract_version,topic,tx_id" + dataColumns +
+		" from " + tableName + " where block_height>=? and block_height<=?"
+	values := []interface{}{startHeight, endHeight}
+	// different contract and topic may share a topic table if the table name source is the same
+	if len(contractName) != 0 {
+		sql += " and contract_name=?"
+		values = append(values, contractName)
+	}
+	if len(topic) != 0 {
+		sql += " and topic=?"
+		values = append(values, topic)
+	}
+	sql += " order by block_height,id"
+	rows, err := c.db.QueryMulti(sql, values...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	events := make([]*commonPb.ContractEventInfo, 0)
+	for rows.Next() {
+		var (
+			event = &commonPb.ContractEventInfo{}
+			data  = make([][]byte, topicTableDataColumns)
+			dest  = []interface{}{&event.BlockHeight, &event.ChainId, &event.ContractName, &event.ContractVersion,
+				&event.Topic, &event.TxId}
+		)
+		for i := range data {
+			dest = append(dest, &data[i])
+		}
+		if err = rows.ScanColumns(dest...); err != nil {
+			return nil, err
+		}
+		// the data columns are filled in order, the unused columns are null
+		for _, d := range data {
+			if d == nil {
+				break
+			}
+			event.EventData = append(event.EventData, string(d))
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// sqlHeightRange limit the block height range in int64, which is the max integer supported by sql drivers
+func sqlHeightRange(startHeight, endHeight uint64) (uint64, uint64) {
+	if startHeight > math.MaxInt64 {
+		startHeight = math.MaxInt64
+	}
+	if endHeight > math.MaxInt64 {
+		endHeight = math.MaxInt64
+	}
+	return startHeight, endHeight
+}
+
 // insert a record to init block height index table
 func (c *ContractEventSqlDB) initBlockHeightIndexTable() error {
 	_, err := c.db.ExecSql(InitBlockHeightIndexTableDdl)
@@ -0,0 +1,197 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package eventsqldb
+
+import (
+	"encoding/json"
+	"errors"
+
+	"chainmaker.org/chainmaker-go/localconf"
+	"chainmaker.org/chainmaker-go/store/dbprovider/rawsqlprovider"
+	"chainmaker.org/chainmaker-go/store/serialization"
+	"chainmaker.org/chainmaker-go/store/types"
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	"chainmaker.org/chainmaker/protocol/v2"
+)
+
+// ContractEventSqliteDB provider a implementation of `contracteventdb.ContractEventDB`
+// This implementation saves the events of all the contracts in one sqlite table
+type ContractEventSqliteDB struct {
+	db     protocol.SqlDBHandle
+	logger protocol.Logger
+	dbName string
+}
+
+// NewContractEventSqliteDB construct a new sqlite `ContractEventDB` for given chainId
+func NewContractEventSqliteDB(chainId string, sqlDbConfig *localconf.SqlDbConfig,
+	logger protocol.Logger) (*ContractEventSqliteDB, error) {
+	dbName := getDbName(sqlDbConfig, chainId)
+	db := rawsqlprovider.NewSqlDBHandle(dbName, sqlDbConfig, logger)
+	cdb := &ContractEventSqliteDB{
+		db:     db,
+		logger: logger,
+		dbName: dbName,
+	}
+	cdb.initDb()
+	return cdb, nil
+}
+
+func (c *ContractEventSqliteDB) initDb() {
+	c.logger.Debugf("create contract event database:%s", c.dbName)
+	err := c.db.CreateTableIfNotExist(&ContractEventInfo{})
+	if err != nil {
+		c.logger.Panicf("init contract event sql db table `%s` fail, error:%s", ContractEventInfoTableName, err)
+	}
+	for _, ddl := range []string{CreateContractEventIndexDdl, CreateContractEventTopicIndexDdl} {
+		if _, err = c.db.ExecSql(ddl); err != nil {
+			c.logger.Panicf("init contract event sql db index fail, error:%s", err)
+		}
+	}
+	err = c.db.CreateTableIfNotExist(&types.SavePoint{})
+	if err != nil {
+		c.logger.Panicf("init contract event sql db table `save_points` fail, error:%s", err)
+	}
+	// the savepoint is inserted once, it is kept when the node restarts
+	row, err := c.db.QuerySingle("select count(*) from save_points")
+	if err != nil {
+		c.logger.Panicf("query SavePoint get an error:%s", err)
+	}
+	var count int
+	if err = row.ScanColumns(&count); err != nil {
+		c.logger.Panicf("query SavePoint get an error:%s", err)
+	}
+	if count > 0 {
+		return
+	}
+	_, err = c.db.Save(&types.SavePoint{})
+	if err != nil {
+		c.logger.Panicf("insert new SavePoint get an error:%s", err)
+	}
+}
+
+func (c *ContractEventSqliteDB) InitGenesis(genesisBlock *serialization.BlockWithSerializedInfo) error {
+	return c.CommitBlock(genesisBlock)
+}
+
+// CommitBlock commits the event in an atomic operation
+func (c *ContractEventSqliteDB) CommitBlock(blockInfo *serialization.BlockWithSerializedInfo) error {
+	block := blockInfo.Block
+	blockHashStr := block.GetBlockHashStr()
+	dbTx, err := c.db.BeginDbTransaction(blockHashStr)
+	if err != nil {
+		return err
+	}
+	var eventSeq uint32
+	for _, tx := range block.Txs {
+		if tx.Result == nil || tx.Result.ContractResult == nil {
+			continue
+		}
+		for _, event := range tx.Result.ContractResult.ContractEvent {
+			eventData, err := json.Marshal(event.EventData)
+			if err != nil {
+				c.db.RollbackDbTransaction(blockHashStr)
+				return err
+			}
+			eventInfo := &ContractEventInfo{
+				BlockHeight:     block.Header.BlockHeight,
+				EventSeq:        eventSeq,
+				ChainId:         block.Header.ChainId,
+				ContractName:    event.ContractName,
+				ContractVersion: event.ContractVersion,
+				Topic:           event.Topic,
+				TxId:            event.TxId,
+				EventData:       eventData,
+			}
+			if _, err = dbTx.Save(eventInfo); err != nil {
+				c.logger.Errorf("failed to save contract event, contract:%s, topic:%s, err:%s",
+					event.ContractName, event.Topic, err)
+				c.db.RollbackDbTransaction(blockHashStr)
+				return err
+			}
+			eventSeq++
+		}
+	}
+	//save last point
+	_, err = dbTx.ExecSql("update save_points set block_height=?", block.Header.BlockHeight)
+	if err != nil {
+		c.logger.Errorf("update save point error:%s", err)
+		c.db.RollbackDbTransaction(blockHashStr)
+		return err
+	}
+	if err = c.db.CommitDbTransaction(blockHashStr); err != nil {
+		return err
+	}
+	c.logger.Debugf("chain[%s]: commit contract event block[%d], events: %d",
+		block.Header.ChainId, block.Header.BlockHeight, eventSeq)
+	return nil
+}
+
+// GetLastSavepoint returns the last block height
+func (c *ContractEventSqliteDB) GetLastSavepoint() (uint64, error) {
+	row, err := c.db.QuerySingle("select block_height from save_points")
+	if err != nil {
+		return 0, err
+	}
+	var height *uint64
+	if err = row.ScanColumns(&height); err != nil {
+		return 0, err
+	}
+	if height == nil {
+		return 0, nil
+	}
+	return *height, nil
+}
+
+// GetContractEvents returns the events in block height range [startHeight, endHeight] ordered by block height
+func (c *ContractEventSqliteDB) GetContractEvents(contractName, topic string, startHeight,
+	endHeight uint64) ([]*commonPb.ContractEventInfo, error) {
+	if len(contractName) == 0 && len(topic) != 0 {
+		return nil, errors.New("contract name is required to filter the events by topic")
+	}
+	startHeight, endHeight = sqlHeightRange(startHeight, endHeight)
+	sql := `select block_height,chain_id,contract_name,contract_version,topic,tx_id,event_data
+from contract_event_infos
+where block_height>=? and block_height<=?`
+	values := []interface{}{startHeight, endHeight}
+	if len(contractName) != 0 {
+		sql += " and contract_name=?"
+		values = append(values, contractName)
+	}
+	if len(topic) != 0 {
+		sql += " and topic=?"
+		values = append(values, topic)
+	}
+	sql += " order by block_height,event_seq"
+	rows, err := c.db.QueryMulti(sql, values...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	events := make([]*commonPb.ContractEventInfo, 0)
+	for rows.Next() {
+		var (
+			event     = &commonPb.ContractEventInfo{}
+			eventData []byte
+		)
+		err = rows.ScanColumns(&event.BlockHeight, &event.ChainId, &event.ContractName, &event.ContractVersion,
+			&event.Topic, &event.TxId, &eventData)
+		if err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal(eventData, &event.EventData); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// Close is used to close database
+func (c *ContractEventSqliteDB) Close() {
+	c.logger.Info("close contract event sqlite db")
+	c.db.Close()
+}
@@ -0,0 +1,134 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package eventsqldb
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"chainmaker.org/chainmaker-go/localconf"
+	"chainmaker.org/chainmaker-go/store/serialization"
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	"chainmaker.org/chainmaker/protocol/v2/test"
+	"github.com/stretchr/testify/assert"
+)
+
+var log = &test.GoLogger{}
+
+const testChainId = "testchainid_1"
+
+// createBlockWithEvents creates a block of two txs, each tx emits an event of topic1 and topic2 of the contract
+func createBlockWithEvents(height uint64, contractName string) *serialization.BlockWithSerializedInfo {
+	block := &commonPb.Block{
+		Header: &commonPb.BlockHeader{
+			ChainId:     testChainId,
+			BlockHeight: height,
+			BlockHash:   []byte(fmt.Sprintf("hash-%d", height)),
+		},
+	}
+	for i := 0; i < 2; i++ {
+		txId := fmt.Sprintf("tx-%d-%d", height, i)
+		tx := &commonPb.Transaction{
+			Payload: &commonPb.Payload{ChainId: testChainId, TxId: txId, ContractName: contractName},
+			Result: &commonPb.Result{
+				Code:           commonPb.TxStatusCode_SUCCESS,
+				ContractResult: &commonPb.ContractResult{},
+			},
+		}
+		for _, topic := range []string{"topic1", "topic2"} {
+			tx.Result.ContractResult.ContractEvent = append(tx.Result.ContractResult.ContractEvent,
+				&commonPb.ContractEvent{
+					Topic:           topic,
+					TxId:            txId,
+					ContractName:    contractName,
+					ContractVersion: "1.0",
+					EventData:       []string{topic, txId},
+				})
+		}
+		block.Txs = append(block.Txs, tx)
+	}
+	return &serialization.BlockWithSerializedInfo{Block: block}
+}
+
+func initSqliteDB(t *testing.T) *ContractEventSqliteDB {
+	conf := &localconf.SqlDbConfig{
+		Dsn:       ":memory:",
+		SqlDbType: "sqlite",
+	}
+	db, err := NewContractEventSqliteDB(testChainId, conf, log)
+	assert.Nil(t, err)
+	for height := uint64(1); height <= 3; height++ {
+		assert.Nil(t, db.CommitBlock(createBlockWithEvents(height, "contract1")))
+	}
+	assert.Nil(t, db.CommitBlock(createBlockWithEvents(4, "contract2")))
+	return db
+}
+
+func TestContractEventSqliteDB_GetLastSavepoint(t *testing.T) {
+	db := initSqliteDB(t)
+	defer db.Close()
+	height, err := db.GetLastSavepoint()
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(4), height)
+}
+
+func TestContractEventSqliteDB_Restart(t *testing.T) {
+	conf := &localconf.SqlDbConfig{
+		Dsn:       t.TempDir(),
+		SqlDbType: "sqlite",
+	}
+	db, err := NewContractEventSqliteDB(testChainId, conf, log)
+	assert.Nil(t, err)
+	for height := uint64(1); height <= 2; height++ {
+		assert.Nil(t, db.CommitBlock(createBlockWithEvents(height, "contract1")))
+	}
+	db.Close()
+
+	// the savepoint and the events are kept after restart
+	db, err = NewContractEventSqliteDB(testChainId, conf, log)
+	assert.Nil(t, err)
+	defer db.Close()
+	height, err := db.GetLastSavepoint()
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(2), height)
+	events, err := db.GetContractEvents("contract1", "", 0, math.MaxUint64)
+	assert.Nil(t, err)
+	assert.Equal(t, 8, len(events))
+
+	assert.Nil(t, db.CommitBlock(createBlockWithEvents(3, "contract1")))
+	height, err = db.GetLastSavepoint()
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(3), height)
+}
+
+func TestContractEventSqliteDB_GetContractEvents(t *testing.T) {
+	db := initSqliteDB(t)
+	defer db.Close()
+
+	events, err := db.GetContractEvents("contract1", "", 2, 3)
+	assert.Nil(t, err)
+	assert.Equal(t, 8, len(events))
+	assert.Equal(t, uint64(2), events[0].BlockHeight)
+	assert.Equal(t, []string{"topic1", "tx-2-0"}, events[0].EventData)
+	assert.Equal(t, "topic2", events[1].Topic)
+	assert.Equal(t, uint64(3), events[7].BlockHeight)
+
+	events, err = db.GetContractEvents("contract1", "topic2", 0, math.MaxUint64)
+	assert.Nil(t, err)
+	assert.Equal(t, 6, len(events))
+	assert.Equal(t, "tx-1-0", events[0].TxId)
+	assert.Equal(t, "tx-3-1", events[5].TxId)
+
+	events, err = db.GetContractEvents("", "", 3, 4)
+	assert.Nil(t, err)
+	assert.Equal(t, 8, len(events))
+	assert.Equal(t, "contract2", events[4].ContractName)
+
+	_, err = db.GetContractEvents("", "topic1", 0, 3)
+	assert.NotNil(t, err)
+}
@@ -32,6 +32,8 @@ const (
 	StoreHistoryDBDir = "store_history"
 	//StoreResultDBDir resultdb folder name
 	StoreResultDBDir = "store_result"
+	//StoreContractEventDBDir contract event db folder name
+	StoreContractEventDBDir = "store_contract_event"
 )
 
 // LevelDBHandle encapsulated handle to leveldb
@@ -20,6 +20,12 @@ type HistoryDB interface {
 	GetHistoryForKey(contractName string, key []byte) (HistoryIterator, error)
 	GetAccountTxHistory(account []byte) (HistoryIterator, error)
 	GetContractTxHistory(contractName string) (HistoryIterator, error)
+	// GetKeysInRange returns the keys of the contract that have ever been written, in range [startKey, limit),
+	// an empty limit means no upper bound
+	GetKeysInRange(contractName string, startKey []byte, limit []byte) ([][]byte, error)
+	// GetLastHistoryForKey returns the txs of the last block no later than height which wrote the key,
+	// nil if the key was not written until height
+	GetLastHistoryForKey(contractName string, key []byte, height uint64) ([]*BlockHeightTxId, error)
 	// GetLastSavepoint returns the last block height
 	GetLastSavepoint() (uint64, error)
 
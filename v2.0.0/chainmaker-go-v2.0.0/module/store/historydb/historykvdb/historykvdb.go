@@ -21,7 +21,9 @@ const (
 	keyHistoryPrefix        = "k"
 	accountTxHistoryPrefix  = "a"
 	contractTxHistoryPrefix = "c"
+	keyHeightIndexPrefix    = "v"
 	historyDBSavepointKey   = "historySavepointKey"
+	keyHeightIndexStartKey  = "historyKeyHeightIndexStartKey"
 	splitChar               = "#"
 )
 
@@ -54,12 +56,21 @@ func (h *HistoryKvDB) CommitBlock(blockInfo *serialization.BlockWithSerializedIn
 	binary.BigEndian.PutUint64(lastBlockNumBytes, block.Header.BlockHeight)
 	batch.Put([]byte(historyDBSavepointKey), lastBlockNumBytes)
 	blockHeight := block.Header.BlockHeight
+	//the writes of the blocks committed before the height index was added are not indexed
+	indexStart, err := h.get([]byte(keyHeightIndexStartKey))
+	if err != nil {
+		return err
+	}
+	if indexStart == nil {
+		batch.Put([]byte(keyHeightIndexStartKey), lastBlockNumBytes)
+	}
 	txRWSets := blockInfo.TxRWSets
 	for _, txRWSet := range txRWSets {
 		txId := txRWSet.TxId
 		for _, write := range txRWSet.TxWrites {
 			key := constructKey(write.ContractName, write.Key, blockHeight, txId)
 			batch.Put(key, []byte{}) //write key modify history
+			batch.Put(constructKeyHeightIndex(write.ContractName, write.Key, blockHeight, txId), []byte{})
 		}
 	}
 	for _, tx := range block.Txs {
@@ -70,7 +81,7 @@ func (h *HistoryKvDB) CommitBlock(blockInfo *serialization.BlockWithSerializedIn
 		batch.Put(constructAcctTxHistKey(accountId, blockHeight, txId), []byte{})
 		batch.Put(constructContractTxHistKey(contractName, blockHeight, txId), []byte{})
 	}
-	err := h.writeBatch(block.Header.BlockHeight, batch)
+	err = h.writeBatch(block.Header.BlockHeight, batch)
 	if err != nil {
 		return err
 	}
@@ -293,3 +293,64 @@ func TestHistorySqlDB_GetContractTxHistory(t *testing.T) {
 		t.Logf("%#v", v)
 	}
 }
+func TestHistoryKvDB_GetKeysInRange(t *testing.T) {
+	db := initKvDb()
+	_, blockInfo, err := serialization.SerializeBlock(block1)
+	assert.Nil(t, err)
+	err = db.CommitBlock(blockInfo)
+	assert.Nil(t, err)
+	_, blockInfo, err = serialization.SerializeBlock(block2)
+	assert.Nil(t, err)
+	err = db.CommitBlock(blockInfo)
+	assert.Nil(t, err)
+	keys, err := db.GetKeysInRange("contract1", []byte("key_1"), []byte("key_4"))
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("key_1"), []byte("key_2"), []byte("key_3")}, keys)
+	keys, err = db.GetKeysInRange("contract1", []byte("key_8"), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(keys))
+	keys, err = db.GetKeysInRange("contract2", nil, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(keys))
+}
+func TestHistoryKvDB_GetLastHistoryForKey(t *testing.T) {
+	db := initKvDb()
+	for _, b := range []*storePb.BlockWithRWSet{block1, block2} {
+		_, blockInfo, err := serialization.SerializeBlock(b)
+		assert.Nil(t, err)
+		err = db.CommitBlock(blockInfo)
+		assert.Nil(t, err)
+	}
+	txs, err := db.GetLastHistoryForKey("contract1", []byte("key_1"), 1)
+	assert.Nil(t, err)
+	assert.Equal(t, []*historydb.BlockHeightTxId{{BlockHeight: 1, TxId: block1.TxRWSets[1].TxId}}, txs)
+	txs, err = db.GetLastHistoryForKey("contract1", []byte("key_1"), 5)
+	assert.Nil(t, err)
+	assert.Equal(t, []*historydb.BlockHeightTxId{{BlockHeight: 2, TxId: block2.TxRWSets[1].TxId}}, txs)
+	txs, err = db.GetLastHistoryForKey("contract1", []byte("key_5"), 2)
+	assert.Nil(t, err)
+	assert.Equal(t, []*historydb.BlockHeightTxId{{BlockHeight: 1, TxId: block1.TxRWSets[5].TxId}}, txs)
+	txs, err = db.GetLastHistoryForKey("contract1", []byte("key_1"), 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(txs))
+}
+
+func TestHistoryKvDB_GetLastHistoryForKeyNotIndexed(t *testing.T) {
+	db := NewHistoryKvDB(initProvider(), cache.NewStoreCacheMgr(testChainId, log), log)
+	//the history written before the height index was added
+	assert.Nil(t, db.dbHandle.Put(constructKey("contract1", []byte("key_1"), 1, "tx1"), []byte{}))
+	txs, err := db.GetLastHistoryForKey("contract1", []byte("key_1"), 1)
+	assert.Nil(t, err)
+	assert.Equal(t, []*historydb.BlockHeightTxId{{BlockHeight: 1, TxId: "tx1"}}, txs)
+
+	_, blockInfo, err := serialization.SerializeBlock(block2)
+	assert.Nil(t, err)
+	err = db.CommitBlock(blockInfo)
+	assert.Nil(t, err)
+	txs, err = db.GetLastHistoryForKey("contract1", []byte("key_1"), 1)
+	assert.Nil(t, err)
+	assert.Equal(t, []*historydb.BlockHeightTxId{{BlockHeight: 1, TxId: "tx1"}}, txs)
+	txs, err = db.GetLastHistoryForKey("contract1", []byte("key_1"), 2)
+	assert.Nil(t, err)
+	assert.Equal(t, []*historydb.BlockHeightTxId{{BlockHeight: 2, TxId: block2.TxRWSets[1].TxId}}, txs)
+}
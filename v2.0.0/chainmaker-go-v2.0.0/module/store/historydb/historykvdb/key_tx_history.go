@@ -8,6 +8,8 @@
 package historykvdb
 
 import (
+	"bytes"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"strconv"
@@ -26,6 +28,31 @@ func constructKeyPrefix(contractName string, key []byte) []byte {
 	dbkey := fmt.Sprintf(keyHistoryPrefix+"%s"+splitChar+"%s"+splitChar, contractName, key)
 	return []byte(dbkey)
 }
+
+//v+ContractName+StateKey+^BlockHeight+TxId, the height is inverted in big endian,
+//so the latest write no later than a height is the first one from the seek key
+func constructKeyHeightIndex(contractName string, key []byte, blockHeight uint64, txId string) []byte {
+	dbKey := constructKeyHeightIndexSeekKey(contractName, key, blockHeight)
+	return append(dbKey, txId...)
+}
+func constructKeyHeightIndexPrefix(contractName string, key []byte) []byte {
+	dbkey := fmt.Sprintf(keyHeightIndexPrefix+"%s"+splitChar+"%s"+splitChar, contractName, key)
+	return []byte(dbkey)
+}
+func constructKeyHeightIndexSeekKey(contractName string, key []byte, blockHeight uint64) []byte {
+	dbKey := constructKeyHeightIndexPrefix(contractName, key)
+	heightBytes := make([]byte, 8)
+	binary.BigEndian.PutUint64(heightBytes, ^blockHeight)
+	return append(dbKey, heightBytes...)
+}
+func splitKeyHeightIndex(dbKey []byte, prefixLen int) (blockHeight uint64, txId string, err error) {
+	if len(dbKey) < prefixLen+8 {
+		return 0, "", errors.New("invalid dbKey format")
+	}
+	blockHeight = ^binary.BigEndian.Uint64(dbKey[prefixLen : prefixLen+8])
+	txId = string(dbKey[prefixLen+8:])
+	return
+}
 func splitKey(dbKey []byte) (contractName string, key []byte, blockHeight uint64, txId string, err error) {
 	if len(dbKey) == 0 {
 		return "", nil, 0, "", errors.New("empty dbKey")
@@ -56,3 +83,97 @@ func (h *HistoryKvDB) GetHistoryForKey(contractName string, key []byte) (history
 	}
 	return &historyKeyIterator{dbIter: iter, buildFunc: splitKeyFunc}, nil
 }
+
+// GetKeysInRange returns the sorted keys of the contract that have ever been written, in range [startKey, limit)
+func (h *HistoryKvDB) GetKeysInRange(contractName string, startKey []byte, limit []byte) ([][]byte, error) {
+	start := []byte(fmt.Sprintf(keyHistoryPrefix+"%s"+splitChar+"%s", contractName, startKey))
+	//'$' is the next char of splitChar, so the range covers all keys of the contract
+	end := []byte(fmt.Sprintf(keyHistoryPrefix+"%s$", contractName))
+	iter := h.dbHandle.NewIteratorWithRange(start, end)
+	defer iter.Release()
+	keys := make([][]byte, 0)
+	for iter.Next() {
+		_, key, _, _, err := splitKey(iter.Key())
+		if err != nil {
+			return nil, err
+		}
+		if len(limit) > 0 && bytes.Compare(key, limit) >= 0 {
+			break
+		}
+		if len(keys) > 0 && bytes.Equal(keys[len(keys)-1], key) {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// GetLastHistoryForKey returns the txs of the last block no later than height which wrote the key,
+// it seeks the height in the height index of the key
+func (h *HistoryKvDB) GetLastHistoryForKey(contractName string, key []byte,
+	height uint64) ([]*historydb.BlockHeightTxId, error) {
+	prefix := constructKeyHeightIndexPrefix(contractName, key)
+	start := constructKeyHeightIndexSeekKey(contractName, key, height)
+	//'$' is the next char of splitChar, so the range covers all heights of the key
+	end := append(prefix[:len(prefix)-1:len(prefix)-1], '$')
+	iter := h.dbHandle.NewIteratorWithRange(start, end)
+	defer iter.Release()
+	var txs []*historydb.BlockHeightTxId
+	for iter.Next() {
+		blockHeight, txId, err := splitKeyHeightIndex(iter.Key(), len(prefix))
+		if err != nil {
+			return nil, err
+		}
+		if len(txs) > 0 && txs[0].BlockHeight != blockHeight {
+			break
+		}
+		txs = append(txs, &historydb.BlockHeightTxId{BlockHeight: blockHeight, TxId: txId})
+	}
+	if err := iter.Error(); err != nil {
+		return nil, err
+	}
+	if len(txs) > 0 {
+		return txs, nil
+	}
+
+	//the key may be written before the height index was added
+	indexStart, err := h.get([]byte(keyHeightIndexStartKey))
+	if err != nil {
+		return nil, err
+	}
+	if indexStart != nil {
+		start := binary.BigEndian.Uint64(indexStart)
+		if start == 0 {
+			return nil, nil
+		}
+		if start <= height {
+			height = start - 1
+		}
+	}
+	return h.getLastHistoryForKeyByScan(contractName, key, height)
+}
+
+// getLastHistoryForKeyByScan scans the history of the key which is not indexed by height
+func (h *HistoryKvDB) getLastHistoryForKeyByScan(contractName string, key []byte,
+	height uint64) ([]*historydb.BlockHeightTxId, error) {
+	iter := h.dbHandle.NewIteratorWithPrefix(constructKeyPrefix(contractName, key))
+	defer iter.Release()
+	var txs []*historydb.BlockHeightTxId
+	for iter.Next() {
+		_, _, blockHeight, txId, err := splitKey(iter.Key())
+		if err != nil {
+			return nil, err
+		}
+		if blockHeight > height || (len(txs) > 0 && blockHeight < txs[0].BlockHeight) {
+			continue
+		}
+		if len(txs) > 0 && blockHeight > txs[0].BlockHeight {
+			txs = txs[:0]
+		}
+		txs = append(txs, &historydb.BlockHeightTxId{BlockHeight: blockHeight, TxId: txId})
+	}
+	if err := iter.Error(); err != nil {
+		return nil, err
+	}
+	return txs, nil
+}
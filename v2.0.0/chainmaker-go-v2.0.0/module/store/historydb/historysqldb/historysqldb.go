@@ -242,3 +242,59 @@ order by block_height desc`
 	}
 	return newHisIter(rows), nil
 }
+
+// GetKeysInRange returns the sorted keys of the contract that have ever been written, in range [startKey, limit)
+func (h *HistorySqlDB) GetKeysInRange(contractName string, startKey []byte, limit []byte) ([][]byte, error) {
+	sql := `select distinct state_key 
+from state_history_infos 
+where contract_name=? and state_key>=?`
+	if startKey == nil {
+		startKey = []byte{}
+	}
+	values := []interface{}{contractName, startKey}
+	if len(limit) > 0 {
+		sql += " and state_key<?"
+		values = append(values, limit)
+	}
+	sql += " order by state_key"
+	rows, err := h.db.QueryMulti(sql, values...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	keys := make([][]byte, 0)
+	for rows.Next() {
+		var key []byte
+		err = rows.ScanColumns(&key)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// GetLastHistoryForKey returns the txs of the last block no later than height which wrote the key
+func (h *HistorySqlDB) GetLastHistoryForKey(contractName string, key []byte,
+	height uint64) ([]*historydb.BlockHeightTxId, error) {
+	sql := `select tx_id,block_height 
+from state_history_infos 
+where contract_name=? and state_key=? and block_height=(select max(block_height) 
+from state_history_infos 
+where contract_name=? and state_key=? and block_height<=?)`
+	rows, err := h.db.QueryMulti(sql, contractName, key, contractName, key, height)
+	if err != nil {
+		return nil, err
+	}
+	iter := newHisIter(rows)
+	defer iter.Release()
+	var txs []*historydb.BlockHeightTxId
+	for iter.Next() {
+		tx, err := iter.Value()
+		if err != nil {
+			return nil, err
+		}
+		txs = append(txs, tx)
+	}
+	return txs, nil
+}
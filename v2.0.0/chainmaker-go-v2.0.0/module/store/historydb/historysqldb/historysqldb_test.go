@@ -286,3 +286,21 @@ func TestHistorySqlDB_GetContractTxHistory(t *testing.T) {
 		t.Logf("%#v", v)
 	}
 }
+func TestHistorySqlDB_GetLastHistoryForKey(t *testing.T) {
+	db := initSqlDb()
+	for _, b := range []*storePb.BlockWithRWSet{block1, block2} {
+		_, blockInfo, err := serialization.SerializeBlock(b)
+		assert.Nil(t, err)
+		err = db.CommitBlock(blockInfo)
+		assert.Nil(t, err)
+	}
+	txs, err := db.GetLastHistoryForKey("contract1", []byte("key_1"), 1)
+	assert.Nil(t, err)
+	assert.Equal(t, []*historydb.BlockHeightTxId{{BlockHeight: 1, TxId: block1.TxRWSets[1].TxId}}, txs)
+	txs, err = db.GetLastHistoryForKey("contract1", []byte("key_1"), 5)
+	assert.Nil(t, err)
+	assert.Equal(t, []*historydb.BlockHeightTxId{{BlockHeight: 2, TxId: block2.TxRWSets[1].TxId}}, txs)
+	txs, err = db.GetLastHistoryForKey("contract1", []byte("key_1"), 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(txs))
+}
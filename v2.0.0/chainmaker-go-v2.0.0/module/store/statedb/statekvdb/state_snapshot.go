@@ -0,0 +1,174 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package statekvdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"chainmaker.org/chainmaker-go/store/types"
+	"chainmaker.org/chainmaker-go/utils"
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	configPb "chainmaker.org/chainmaker/pb-go/v2/config"
+	"chainmaker.org/chainmaker/pb-go/v2/syscontract"
+	"chainmaker.org/chainmaker/protocol/v2"
+)
+
+// the states of the state snapshot being installed are staged under the prefix, which begins with 0 as the keys
+// of state tree, they are swapped in place of the committed states when the snapshot is committed
+const stagedStatePrefix = "\x00sn/"
+
+// StatesSnapshot is a point-in-time view of the committed states, the blocks committed after it are not seen, so
+// the states can be iterated in background. It must be released after use.
+type StatesSnapshot struct {
+	iter protocol.Iterator
+}
+
+// Iterate calls fn with each state in the order of the state keys, it can only be called once
+func (ss *StatesSnapshot) Iterate(fn func(state *commonPb.TxWrite) error) error {
+	return iterateStates(ss.iter, fn)
+}
+
+// Release releases the view of the states
+func (ss *StatesSnapshot) Release() {
+	ss.iter.Release()
+}
+
+// SnapshotStates returns the view of the states of the last committed block, the states committed asynchronously
+// are flushed before
+func (s *StateKvDB) SnapshotStates() *StatesSnapshot {
+	s.Cache.LockForFlush()
+	defer s.Cache.UnLockFlush()
+	return &StatesSnapshot{iter: s.DbHandle.NewIteratorWithRange(nil, nil)}
+}
+
+// DiscardStagedStates deletes the staged states of the state snapshot which is not committed
+func (s *StateKvDB) DiscardStagedStates() error {
+	batch := types.NewUpdateBatch()
+	iter := s.DbHandle.NewIteratorWithPrefix([]byte(stagedStatePrefix))
+	defer iter.Release()
+	for iter.Next() {
+		batch.Delete(append([]byte(nil), iter.Key()...))
+	}
+	if err := iter.Error(); err != nil {
+		return err
+	}
+	return s.DbHandle.WriteBatch(batch, true)
+}
+
+// StageStates puts the states of a state snapshot aside, the committed states are not changed until
+// CommitStateSnapshot
+func (s *StateKvDB) StageStates(states []*commonPb.TxWrite) error {
+	batch := types.NewUpdateBatch()
+	for _, state := range states {
+		if len(state.Value) > 0 {
+			batch.Put(constructStagedStateKey(state.ContractName, state.Key), state.Value)
+		}
+	}
+	return s.DbHandle.WriteBatch(batch, true)
+}
+
+// GetStagedChainConfig returns the chain config in the staged states
+func (s *StateKvDB) GetStagedChainConfig() (*configPb.ChainConfig, error) {
+	name := syscontract.SystemContract_CHAIN_CONFIG.String()
+	val, err := s.DbHandle.Get(constructStagedStateKey(name, []byte(name)))
+	if err != nil {
+		return nil, err
+	}
+	if val == nil {
+		return nil, errors.New("the state snapshot has no chain config")
+	}
+	conf := &configPb.ChainConfig{}
+	if err = conf.Unmarshal(val); err != nil {
+		return nil, err
+	}
+	return conf, nil
+}
+
+// CommitStateSnapshot replaces the committed states and state tree with the staged states and their state tree in
+// an atomic write, and sets the savepoint to the height of the snapshot. The root of the state tree of the staged
+// states must be stateRoot.
+func (s *StateKvDB) CommitStateSnapshot(height uint64, stateRoot []byte) error {
+	if stateRoot == nil {
+		return errors.New("the state snapshot has no state root")
+	}
+	s.Cache.LockForFlush()
+	defer s.Cache.UnLockFlush()
+	batch := types.NewUpdateBatch()
+	iter := s.DbHandle.NewIteratorWithRange(nil, nil)
+	defer iter.Release()
+	states := make([]*commonPb.TxWrite, 0, 1024)
+	for iter.Next() {
+		key := append([]byte(nil), iter.Key()...)
+		batch.Delete(key)
+		if !bytes.HasPrefix(key, []byte(stagedStatePrefix)) {
+			continue
+		}
+		stateKey := key[len(stagedStatePrefix):]
+		idx := bytes.IndexByte(stateKey, contractStoreSeparator)
+		if idx < 0 {
+			return fmt.Errorf("invalid state key %x", stateKey)
+		}
+		value := append([]byte(nil), iter.Value()...)
+		states = append(states, &commonPb.TxWrite{
+			ContractName: string(stateKey[:idx]),
+			Key:          stateKey[idx+1:],
+			Value:        value,
+		})
+		batch.Put(stateKey, value)
+	}
+	if err := iter.Error(); err != nil {
+		return err
+	}
+	root, err := s.putStateTree(batch, utils.StateTreeEmptyRoot, height, states)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(root, stateRoot) {
+		return fmt.Errorf("state root of snapshot expect %x, got %x", stateRoot, root)
+	}
+	savepoint := make([]byte, 8)
+	binary.BigEndian.PutUint64(savepoint, height)
+	batch.Put([]byte(stateDBSavepointKey), savepoint)
+	return s.DbHandle.WriteBatch(batch, true)
+}
+
+// iterateStates iterates the states in db, the keys of the savepoint and the state tree are skipped
+func (s *StateKvDB) iterateStates(fn func(state *commonPb.TxWrite) error) error {
+	iter := s.DbHandle.NewIteratorWithRange(nil, nil)
+	defer iter.Release()
+	return iterateStates(iter, fn)
+}
+
+func constructStagedStateKey(contractName string, key []byte) []byte {
+	return append([]byte(stagedStatePrefix), constructStateKey(contractName, key)...)
+}
+
+// iterateStates iterates the states by iter, the keys of the savepoint, the state tree and the staged states are
+// skipped
+func iterateStates(iter protocol.Iterator, fn func(state *commonPb.TxWrite) error) error {
+	for iter.Next() {
+		key := iter.Key()
+		if bytes.Equal(key, []byte(stateDBSavepointKey)) || key[0] == stateTreeNodePrefix[0] {
+			continue
+		}
+		idx := bytes.IndexByte(key, contractStoreSeparator)
+		if idx < 0 {
+			return fmt.Errorf("invalid state key %x", key)
+		}
+		if err := fn(&commonPb.TxWrite{
+			ContractName: string(key[:idx]),
+			Key:          append([]byte{}, key[idx+1:]...),
+			Value:        append([]byte{}, iter.Value()...),
+		}); err != nil {
+			return err
+		}
+	}
+	return iter.Error()
+}
@@ -0,0 +1,303 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package statekvdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+
+	"chainmaker.org/chainmaker-go/store/serialization"
+	"chainmaker.org/chainmaker-go/store/types"
+	"chainmaker.org/chainmaker-go/utils"
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	configPb "chainmaker.org/chainmaker/pb-go/v2/config"
+	"chainmaker.org/chainmaker/pb-go/v2/syscontract"
+	"chainmaker.org/chainmaker/protocol/v2"
+)
+
+// the keys of state tree begin with 0, which never begins the key of state: contractName#key
+const (
+	stateTreeNodePrefix = "\x00st/n/"
+	stateTreeRootPrefix = "\x00st/r/"
+	// the node not referenced by the tree since a height is marked with the height, and indexed by the height for
+	// pruning, the mark is deleted if the node is built again
+	stateTreeStalePrefix      = "\x00st/s/"
+	stateTreeStaleIndexPrefix = "\x00st/i/"
+	stateTreePrefix           = "\x00st/"
+)
+
+// ErrStateRootNotFound is returned when the state tree has no root of the block height
+var ErrStateRootNotFound = errors.New("state root not found")
+
+// GetStateRoot returns the root of state tree after the block of height is committed, or nil if not found
+func (s *StateKvDB) GetStateRoot(height uint64) ([]byte, error) {
+	return s.get(constructStateRootKey(height))
+}
+
+// CalcStateRoot applies the writes to the state tree of root without committing them. The new nodes are added
+// to nodes, which are read before the committed nodes, so the root of the blocks not committed can be chained.
+func (s *StateKvDB) CalcStateRoot(root []byte, writes []*commonPb.TxWrite, nodes map[string][]byte) ([]byte,
+	error) {
+	newRoot, newNodes, err := utils.UpdateStateTree(root, writes, func(hash []byte) ([]byte, error) {
+		if node, ok := nodes[string(hash)]; ok {
+			return node, nil
+		}
+		return s.readStateTreeNode(hash)
+	})
+	if err != nil {
+		return nil, err
+	}
+	for hash, node := range newNodes {
+		nodes[hash] = node
+	}
+	return newRoot, nil
+}
+
+// GetStateWithProof returns the state value and the proof of it against the state root committed in the block of
+// blockHeight, which is the root after the previous block, the value is nil if the key does not exist
+func (s *StateKvDB) GetStateWithProof(contractName string, key []byte, blockHeight uint64) (
+	*utils.StateWithProof, error) {
+	if blockHeight == 0 {
+		return nil, errors.New("the genesis block has no state root")
+	}
+	root, err := s.GetStateRoot(blockHeight - 1)
+	if err != nil {
+		return nil, err
+	}
+	if root == nil {
+		return nil, ErrStateRootNotFound
+	}
+	value, proof, err := utils.ProveStateTree(root, contractName, key, s.readStateTreeNode)
+	if err != nil {
+		return nil, err
+	}
+	return &utils.StateWithProof{
+		ContractName: contractName,
+		Key:          key,
+		Value:        value,
+		BlockHeight:  blockHeight,
+		StateRoot:    root,
+		Proof:        proof,
+	}, nil
+}
+
+// InitStateTree builds the state tree of the committed states if the state tree is enabled by the chain config
+// in state but the root of the savepoint is missing, it must be called before any block is committed
+func (s *StateKvDB) InitStateTree() error {
+	savepoint, err := s.DbHandle.Get([]byte(stateDBSavepointKey))
+	if err != nil || savepoint == nil {
+		return err
+	}
+	chainConfig, err := s.GetChainConfig()
+	if err != nil || !utils.IsStateTreeEnabled(chainConfig) {
+		return err
+	}
+	height := binary.BigEndian.Uint64(savepoint)
+	if root, err := s.GetStateRoot(height); err != nil || root != nil {
+		return err
+	}
+
+	s.Logger.Infof("build state tree of block[%d]", height)
+	writes, err := s.getStates()
+	if err != nil {
+		return err
+	}
+	batch := types.NewUpdateBatch()
+	if _, err = s.putStateTree(batch, utils.StateTreeEmptyRoot, height, writes); err != nil {
+		return err
+	}
+	return s.DbHandle.WriteBatch(batch, true)
+}
+
+// updateStateTree puts the nodes of state tree updated by the block into batch if the state tree is enabled by
+// the chain config after the block. The state tree is built from the committed states by the block which enables
+// it, and it is deleted by the block which disables it.
+func (s *StateKvDB) updateStateTree(batch protocol.StoreBatcher,
+	blockWithRWSet *serialization.BlockWithSerializedInfo) error {
+	block := blockWithRWSet.Block
+	height := block.Header.BlockHeight
+	writes, err := utils.GetBlockStateWrites(block, blockWithRWSet.TxRWSets)
+	if err != nil {
+		return err
+	}
+	enabled, err := s.isStateTreeEnabledAfter(writes)
+	if err != nil {
+		return err
+	}
+	root := utils.StateTreeEmptyRoot
+	if height > 0 {
+		var prevRoot []byte
+		if prevRoot, err = s.GetStateRoot(height - 1); err != nil {
+			return err
+		}
+		switch {
+		case !enabled && prevRoot != nil:
+			s.Logger.Infof("state tree is disabled by block[%d]", height)
+			return s.deleteStateTree(batch)
+		case !enabled:
+			return nil
+		case prevRoot != nil:
+			root = prevRoot
+		default:
+			s.Logger.Infof("state tree is enabled by block[%d], build it from the committed states", height)
+			states, err := s.getStates()
+			if err != nil {
+				return err
+			}
+			writes = append(states, writes...)
+		}
+	} else if !enabled {
+		return nil
+	}
+	_, err = s.putStateTree(batch, root, height, writes)
+	return err
+}
+
+// isStateTreeEnabledAfter returns whether the state tree is enabled by the chain config after the block of writes
+func (s *StateKvDB) isStateTreeEnabledAfter(writes []*commonPb.TxWrite) (bool, error) {
+	configName := syscontract.SystemContract_CHAIN_CONFIG.String()
+	var configBytes []byte
+	for _, write := range writes {
+		if write.ContractName == configName && string(write.Key) == configName {
+			configBytes = write.Value
+		}
+	}
+	if configBytes == nil {
+		chainConfig, err := s.GetChainConfig()
+		if err != nil {
+			return false, err
+		}
+		return utils.IsStateTreeEnabled(chainConfig), nil
+	}
+	chainConfig := &configPb.ChainConfig{}
+	if err := chainConfig.Unmarshal(configBytes); err != nil {
+		return false, err
+	}
+	return utils.IsStateTreeEnabled(chainConfig), nil
+}
+
+// putStateTree puts the nodes of state tree updated by the writes into batch, returns the new root. The old
+// roots and the nodes only referenced by them are pruned if RetainStateTreeBlocks is set.
+func (s *StateKvDB) putStateTree(batch protocol.StoreBatcher, root []byte, height uint64,
+	writes []*commonPb.TxWrite) ([]byte, error) {
+	newRoot, nodes, stale, err := utils.UpdateStateTreeWithStale(root, writes, s.readStateTreeNode)
+	if err != nil {
+		return nil, err
+	}
+	for hash, node := range nodes {
+		batch.Put(constructStateTreeNodeKey([]byte(hash)), node)
+		// the node is referenced again if it is stale before
+		batch.Delete(constructStateTreeStaleKey([]byte(hash)))
+	}
+	batch.Put(constructStateRootKey(height), newRoot)
+	s.Logger.Debugf("state root of block[%d]: %x", height, newRoot)
+
+	if s.RetainStateTreeBlocks == 0 {
+		return newRoot, nil
+	}
+	heightBytes := make([]byte, 8)
+	binary.BigEndian.PutUint64(heightBytes, height)
+	for _, hash := range stale {
+		batch.Put(constructStateTreeStaleKey(hash), heightBytes)
+		batch.Put(constructStateTreeStaleIndexKey(height, hash), hash)
+	}
+	if height >= s.RetainStateTreeBlocks {
+		if err = s.pruneStateTree(batch, height-s.RetainStateTreeBlocks, nodes); err != nil {
+			return nil, err
+		}
+	}
+	return newRoot, nil
+}
+
+// pruneStateTree puts into batch the deletes of the roots up to prunedHeight, and the nodes only referenced by
+// them, which are stale since the height up to prunedHeight+1 and not built again. The nodes in newNodes are
+// built by the batch, so they are kept.
+func (s *StateKvDB) pruneStateTree(batch protocol.StoreBatcher, prunedHeight uint64,
+	newNodes map[string][]byte) error {
+	iter := s.DbHandle.NewIteratorWithRange(constructStateRootKey(0), constructStateRootKey(prunedHeight+1))
+	for iter.Next() {
+		batch.Delete(append([]byte(nil), iter.Key()...))
+	}
+	iter.Release()
+
+	iter = s.DbHandle.NewIteratorWithRange(constructStateTreeStaleIndexKey(0, nil),
+		constructStateTreeStaleIndexKey(prunedHeight+2, nil))
+	defer iter.Release()
+	for iter.Next() {
+		key := append([]byte(nil), iter.Key()...)
+		batch.Delete(key)
+		staleHeight := key[len(stateTreeStaleIndexPrefix) : len(stateTreeStaleIndexPrefix)+8]
+		hash := key[len(stateTreeStaleIndexPrefix)+8:]
+		if _, ok := newNodes[string(hash)]; ok {
+			continue
+		}
+		mark, err := s.get(constructStateTreeStaleKey(hash))
+		if err != nil {
+			return err
+		}
+		// the node is built again after it is stale at the height
+		if !bytes.Equal(mark, staleHeight) {
+			continue
+		}
+		batch.Delete(constructStateTreeStaleKey(hash))
+		batch.Delete(constructStateTreeNodeKey(hash))
+	}
+	return iter.Error()
+}
+
+// deleteStateTree puts the deletes of all the roots and nodes of state tree into batch
+func (s *StateKvDB) deleteStateTree(batch protocol.StoreBatcher) error {
+	s.Cache.LockForFlush()
+	defer s.Cache.UnLockFlush()
+	iter := s.DbHandle.NewIteratorWithPrefix([]byte(stateTreePrefix))
+	defer iter.Release()
+	for iter.Next() {
+		batch.Delete(append([]byte(nil), iter.Key()...))
+	}
+	return iter.Error()
+}
+
+// getStates returns all the committed states, it waits until the states in cache are flushed
+func (s *StateKvDB) getStates() ([]*commonPb.TxWrite, error) {
+	s.Cache.LockForFlush()
+	defer s.Cache.UnLockFlush()
+	states := make([]*commonPb.TxWrite, 0, 1024)
+	if err := s.iterateStates(func(state *commonPb.TxWrite) error {
+		states = append(states, state)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return states, nil
+}
+
+func (s *StateKvDB) readStateTreeNode(hash []byte) ([]byte, error) {
+	return s.get(constructStateTreeNodeKey(hash))
+}
+
+func constructStateTreeNodeKey(hash []byte) []byte {
+	return append([]byte(stateTreeNodePrefix), hash...)
+}
+
+func constructStateTreeStaleKey(hash []byte) []byte {
+	return append([]byte(stateTreeStalePrefix), hash...)
+}
+
+func constructStateTreeStaleIndexKey(height uint64, hash []byte) []byte {
+	key := make([]byte, len(stateTreeStaleIndexPrefix)+8, len(stateTreeStaleIndexPrefix)+8+len(hash))
+	copy(key, stateTreeStaleIndexPrefix)
+	binary.BigEndian.PutUint64(key[len(stateTreeStaleIndexPrefix):], height)
+	return append(key, hash...)
+}
+
+func constructStateRootKey(height uint64) []byte {
+	key := make([]byte, len(stateTreeRootPrefix)+8)
+	copy(key, stateTreeRootPrefix)
+	binary.BigEndian.PutUint64(key[len(stateTreeRootPrefix):], height)
+	return key
+}
@@ -37,6 +37,9 @@ type StateKvDB struct {
 	DbHandle protocol.DBHandle
 	Cache    *cache.StoreCacheMgr
 	Logger   protocol.Logger
+	// RetainStateTreeBlocks is the number of the latest blocks whose state roots are retained when the state tree
+	// is enabled by the chain config, the older roots and the nodes only referenced by them are pruned, 0 retains all
+	RetainStateTreeBlocks uint64
 }
 
 func (s *StateKvDB) InitGenesis(genesisBlock *serialization.BlockWithSerializedInfo) error {
@@ -67,6 +70,9 @@ func (s *StateKvDB) CommitBlock(blockWithRWSet *serialization.BlockWithSerialize
 			return err
 		}
 	}
+	if err := s.updateStateTree(batch, blockWithRWSet); err != nil {
+		return err
+	}
 	err := s.writeBatch(block.Header.BlockHeight, batch)
 	if err != nil {
 		return err
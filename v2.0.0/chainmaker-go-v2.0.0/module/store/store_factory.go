@@ -18,6 +18,7 @@ import (
 	"chainmaker.org/chainmaker-go/store/blockdb/blocksqldb"
 	"chainmaker.org/chainmaker-go/store/cache"
 	"chainmaker.org/chainmaker-go/store/contracteventdb"
+	"chainmaker.org/chainmaker-go/store/contracteventdb/eventkvdb"
 	"chainmaker.org/chainmaker-go/store/contracteventdb/eventsqldb"
 	"chainmaker.org/chainmaker-go/store/dbprovider/leveldbprovider"
 	"chainmaker.org/chainmaker-go/store/historydb"
@@ -69,7 +70,7 @@ func (m *Factory) newStore(chainId string, storeConfig *localconf.StorageConfig,
 	stateDBConfig := storeConfig.GetStateDbConfig()
 	if stateDBConfig.IsKVDB() {
 		stateDB, err = m.NewStateKvDB(chainId, parseEngineType(stateDBConfig.Provider),
-			stateDBConfig.LevelDbConfig, logger)
+			stateDBConfig.LevelDbConfig, storeConfig.RetainStateTreeBlocks, logger)
 		if err != nil {
 			return nil, err
 		}
@@ -114,14 +115,9 @@ func (m *Factory) newStore(chainId string, storeConfig *localconf.StorageConfig,
 	var contractEventDB contracteventdb.ContractEventDB
 	contractEventDBConfig := storeConfig.GetContractEventDbConfig()
 	if !storeConfig.DisableContractEventDB {
-		if parseEngineType(storeConfig.ContractEventDbConfig.SqlDbConfig.SqlDbType) == types.MySQL &&
-			storeConfig.ContractEventDbConfig.Provider == "sql" {
-			contractEventDB, err = eventsqldb.NewContractEventMysqlDB(chainId, contractEventDBConfig.SqlDbConfig, logger)
-			if err != nil {
-				return nil, err
-			}
-		} else {
-			return nil, errors.New("contract event db config err")
+		contractEventDB, err = m.newContractEventDB(chainId, contractEventDBConfig, logger)
+		if err != nil {
+			return nil, err
 		}
 	}
 	return NewBlockStoreImpl(chainId, blockDB, stateDB, historyDB, contractEventDB, resultDB,
@@ -178,10 +174,11 @@ func (m *Factory) NewBlockKvDB(chainId string, engineType types.EngineType, conf
 
 // NewStateKvDB constructs new `StabeKvDB`
 func (m *Factory) NewStateKvDB(chainId string, engineType types.EngineType, config *localconf.LevelDbConfig,
-	logger protocol.Logger) (statedb.StateDB, error) {
+	retainStateTreeBlocks uint64, logger protocol.Logger) (statedb.StateDB, error) {
 	stateDB := &statekvdb.StateKvDB{
-		Logger: logger,
-		Cache:  cache.NewStoreCacheMgr(chainId, logger),
+		Logger:                logger,
+		Cache:                 cache.NewStoreCacheMgr(chainId, logger),
+		RetainStateTreeBlocks: retainStateTreeBlocks,
 	}
 	switch engineType {
 	case types.LevelDb:
@@ -192,6 +189,9 @@ func (m *Factory) NewStateKvDB(chainId string, engineType types.EngineType, conf
 	default:
 		return nil, nil
 	}
+	if err := stateDB.InitStateTree(); err != nil {
+		return nil, err
+	}
 	return stateDB, nil
 }
 
@@ -228,3 +228,34 @@ func (m *Factory) NewResultKvDB(chainId string, engineType types.EngineType, con
 	}
 	return resultDB, nil
 }
+
+func (m *Factory) newContractEventDB(chainId string, dbConfig *localconf.DbConfig,
+	logger protocol.Logger) (contracteventdb.ContractEventDB, error) {
+	if dbConfig.IsKVDB() {
+		return m.NewContractEventKvDB(chainId, parseEngineType(dbConfig.Provider), dbConfig.LevelDbConfig, logger)
+	}
+	if dbConfig.IsSqlDB() {
+		switch parseEngineType(dbConfig.SqlDbConfig.SqlDbType) {
+		case types.MySQL:
+			return eventsqldb.NewContractEventMysqlDB(chainId, dbConfig.SqlDbConfig, logger)
+		case types.Sqlite:
+			return eventsqldb.NewContractEventSqliteDB(chainId, dbConfig.SqlDbConfig, logger)
+		}
+	}
+	return nil, errors.New("contract event db config err")
+}
+
+// NewContractEventKvDB constructs new `ContractEventKvDB`
+func (m *Factory) NewContractEventKvDB(chainId string, engineType types.EngineType, config *localconf.LevelDbConfig,
+	logger protocol.Logger) (*eventkvdb.ContractEventKvDB, error) {
+	var db protocol.DBHandle
+	switch engineType {
+	case types.LevelDb:
+		db = leveldbprovider.NewLevelDBHandle(chainId, leveldbprovider.StoreContractEventDBDir, config, logger)
+	case types.RocksDb:
+		db = newRocksdbHandle(chainId, "contracteventdb", logger)
+	default:
+		return nil, errors.New("invalid db type")
+	}
+	return eventkvdb.NewContractEventKvDB(db, logger), nil
+}
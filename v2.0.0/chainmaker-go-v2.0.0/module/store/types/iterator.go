@@ -9,6 +9,7 @@ package types
 
 import (
 	"bytes"
+	"errors"
 
 	"chainmaker.org/chainmaker-go/store/blockdb"
 	"chainmaker.org/chainmaker-go/store/historydb"
@@ -91,3 +92,33 @@ func (hs *TxHistoryIteratorImpl) Value() (*storePb.TxHistory, error) {
 func (hs *TxHistoryIteratorImpl) Release() {
 	hs.dbItr.Release()
 }
+
+// KVIterator is a `protocol.StateIterator` over the key-values in memory.
+type KVIterator struct {
+	kvs   []*storePb.KV
+	index int
+}
+
+func NewKVIterator(kvs []*storePb.KV) *KVIterator {
+	return &KVIterator{
+		kvs:   kvs,
+		index: -1,
+	}
+}
+func (it *KVIterator) Next() bool {
+	if it.index+1 >= len(it.kvs) {
+		return false
+	}
+	it.index++
+	return true
+}
+
+func (it *KVIterator) Value() (*storePb.KV, error) {
+	if it.index < 0 || it.index >= len(it.kvs) {
+		return nil, errors.New("iterator out of range")
+	}
+	return it.kvs[it.index], nil
+}
+func (it *KVIterator) Release() {
+	it.kvs = nil
+}
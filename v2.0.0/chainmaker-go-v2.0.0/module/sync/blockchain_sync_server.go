@@ -43,6 +43,10 @@ type BlockChainSyncServer struct {
 
 	scheduler *Routine // Service that get blocks from other nodes
 	processor *Routine // Service that processes block data, adding valid blocks to the chain
+
+	light *lightBlockCommitter // Verifies and commits the headers synced by the light node, nil on the full node
+
+	snapshot *stateSnapshotSyncer // Installs the state snapshot before syncing blocks, nil if it is not enabled
 }
 
 func NewBlockChainSyncServer(chainId string,
@@ -74,12 +78,26 @@ func (sync *BlockChainSyncServer) Start() error {
 
 	// 1. init conf
 	sync.initSyncConfIfRequire()
-	processor := newProcessor(sync, sync.ledgerCache, sync.log)
+	var verify verifyAndAddBlock = sync
+	if sync.light != nil {
+		verify = sync.light
+	}
+	processor := newProcessor(verify, sync.ledgerCache, sync.log)
 	scheduler := newScheduler(sync, sync.ledgerCache,
 		sync.conf.blockPoolSize, sync.conf.timeOut, sync.conf.reqTimeThreshold, sync.conf.batchSizeFromOneNode, sync.log)
 	if scheduler == nil {
 		return fmt.Errorf("init scheduler failed")
 	}
+	if sync.light != nil {
+		scheduler.reqMsgType = headerSyncReq
+	}
+	if sync.conf.maxBatchSizeFromOneNode > scheduler.BatchesizeInEachReq {
+		scheduler.maxBatchSize = sync.conf.maxBatchSizeFromOneNode
+	}
+	scheduler.peerPenaltyTime = sync.conf.peerPenaltyTime
+	if localconf.ChainMakerConfig.MonitorConfig.Enabled {
+		scheduler.metrics = newSyncMetrics(sync.chainId)
+	}
 	sync.scheduler = NewRoutine("scheduler", scheduler.handler, scheduler.getServiceState, sync.log)
 	sync.processor = NewRoutine("processor", processor.handler, processor.getServiceState, sync.log)
 
@@ -94,7 +112,16 @@ func (sync *BlockChainSyncServer) Start() error {
 		return err
 	}
 
-	// 3. start internal service
+	// 3. install the state snapshot, the scheduler is not started yet and syncs the blocks after the snapshot
+	if sync.snapshot != nil {
+		height, err := sync.syncStateSnapshot()
+		if err != nil {
+			return err
+		}
+		scheduler.pendingRecvHeight = height + 1
+	}
+
+	// 4. start internal service
 	if err := sync.scheduler.begin(); err != nil {
 		return err
 	}
@@ -122,6 +149,12 @@ func (sync *BlockChainSyncServer) initSyncConfIfRequire() {
 	if localconf.ChainMakerConfig.SyncConfig.BatchSizeFromOneNode > 0 {
 		sync.conf.SetBatchSizeFromOneNode(uint64(localconf.ChainMakerConfig.SyncConfig.BatchSizeFromOneNode))
 	}
+	if localconf.ChainMakerConfig.SyncConfig.MaxBatchSizeFromOneNode > 0 {
+		sync.conf.SetMaxBatchSizeFromOneNode(uint64(localconf.ChainMakerConfig.SyncConfig.MaxBatchSizeFromOneNode))
+	}
+	if localconf.ChainMakerConfig.SyncConfig.PeerPenaltyTime > 0 {
+		sync.conf.SetPeerPenaltyTime(localconf.ChainMakerConfig.SyncConfig.PeerPenaltyTime)
+	}
 	if localconf.ChainMakerConfig.SyncConfig.LivenessTick > 0 {
 		sync.conf.SetLivenessTicker(localconf.ChainMakerConfig.SyncConfig.LivenessTick)
 	}
@@ -166,8 +199,16 @@ func (sync *BlockChainSyncServer) blockSyncMsgHandler(from string, msg []byte, m
 		return sync.handleNodeStatusResp(&syncMsg, from)
 	case syncPb.SyncMsg_BLOCK_SYNC_REQ:
 		return sync.handleBlockReq(&syncMsg, from)
-	case syncPb.SyncMsg_BLOCK_SYNC_RESP:
+	case syncPb.SyncMsg_BLOCK_SYNC_RESP, headerSyncResp:
 		return sync.scheduler.addTask(&SyncedBlockMsg{msg: syncMsg.Payload, from: from})
+	case headerSyncReq:
+		return sync.handleHeaderReq(&syncMsg, from)
+	case stateSnapshotManifestReq:
+		return sync.handleStateSnapshotManifestReq(from)
+	case stateSnapshotChunkReq:
+		return sync.handleStateSnapshotChunkReq(&syncMsg, from)
+	case stateSnapshotManifestResp, stateSnapshotChunkResp:
+		return sync.handleStateSnapshotResp(&syncMsg, from)
 	}
 	return fmt.Errorf("not support the syncPb.SyncMsg.Type as %d", syncMsg.Type)
 }
@@ -178,6 +219,10 @@ func (sync *BlockChainSyncServer) handleNodeStatusReq(from string) error {
 		bz     []byte
 		err    error
 	)
+	// the light node keeps the headers only, it does not report its height to be synced from
+	if sync.light != nil {
+		return nil
+	}
 	if height, err = sync.ledgerCache.CurrentHeight(); err != nil {
 		return err
 	}
@@ -209,6 +254,9 @@ func (sync *BlockChainSyncServer) handleBlockReq(syncMsg *syncPb.SyncMsg, from s
 	}
 	sync.log.Debugf("receive request to get block [height: %d, batch_size: %d] from "+
 		"node [%s]", req.BlockHeight, req.BatchSize, from)
+	if sync.light != nil {
+		return fmt.Errorf("the light node can not serve the blocks")
+	}
 	if req.WithRwset {
 		return sync.sendInfos(&req, from)
 	}
@@ -365,7 +413,9 @@ func (sync *BlockChainSyncServer) loop() {
 	}
 }
 
-func (sync *BlockChainSyncServer) validateAndCommitBlock(block *commonPb.Block) processedBlockStatus {
+// validateAndCommitBlock verifies the block by executing it again, the rwsets synced with the block are not used
+func (sync *BlockChainSyncServer) validateAndCommitBlock(block *commonPb.Block,
+	_ []*commonPb.TxRWSet) processedBlockStatus {
 	if blk := sync.ledgerCache.GetLastCommittedBlock(); blk != nil && blk.Header.BlockHeight >= block.Header.BlockHeight {
 		sync.log.Infof("the block: %d has been committed in the blockChainStore ", block.Header.BlockHeight)
 		return hasProcessed
@@ -414,7 +464,7 @@ func (sync *BlockChainSyncServer) OnMessage(message *msgbus.Message) {
 			return
 		}
 		height := blockInfo.Block.Header.BlockHeight
-		if height%3 != 0 {
+		if height%3 != 0 || sync.light != nil {
 			return
 		}
 		bz, err := proto.Marshal(&syncPb.BlockHeightBCM{BlockHeight: height})
@@ -24,6 +24,9 @@ type BlockSyncServerConf struct {
 	blockPoolSize        uint64 // Maximum number of blocks to be processed in scheduler
 	batchSizeFromOneNode uint64 // The number of blocks received from each node in a request
 
+	maxBatchSizeFromOneNode uint64        // The maximum number of blocks in a request, the batch size of each node adapts to its performance
+	peerPenaltyTime         time.Duration // The time a node is not requested after it returns an invalid block
+
 }
 
 func NewBlockSyncServerConf() *BlockSyncServerConf {
@@ -37,6 +40,9 @@ func NewBlockSyncServerConf() *BlockSyncServerConf {
 		schedulerTick:        20 * time.Millisecond,
 		dataDetectionTick:    time.Minute,
 		reqTimeThreshold:     3 * time.Second,
+
+		maxBatchSizeFromOneNode: defaultMaxBatchSize,
+		peerPenaltyTime:         defaultPeerPenaltyTime,
 	}
 }
 
@@ -52,6 +58,14 @@ func (c *BlockSyncServerConf) SetBatchSizeFromOneNode(n uint64) *BlockSyncServer
 	c.batchSizeFromOneNode = n
 	return c
 }
+func (c *BlockSyncServerConf) SetMaxBatchSizeFromOneNode(n uint64) *BlockSyncServerConf {
+	c.maxBatchSizeFromOneNode = n
+	return c
+}
+func (c *BlockSyncServerConf) SetPeerPenaltyTime(n float64) *BlockSyncServerConf {
+	c.peerPenaltyTime = time.Duration(n * float64(time.Second))
+	return c
+}
 func (c *BlockSyncServerConf) SetProcessBlockTicker(n float64) *BlockSyncServerConf {
 	c.processBlockTick = time.Duration(n * float64(time.Second))
 	return c
@@ -77,7 +91,8 @@ func (c *BlockSyncServerConf) SetReqTimeThreshold(n float64) *BlockSyncServerCon
 	return c
 }
 func (c *BlockSyncServerConf) print() string {
-	return fmt.Sprintf("blockPoolSize: %d, request timeout: %d, batchSizeFromOneNode: %d"+
-		", processBlockTick: %v, schedulerTick: %v, livenessTick: %v, nodeStatusTick: %v\n",
-		c.blockPoolSize, c.timeOut, c.batchSizeFromOneNode, c.processBlockTick, c.schedulerTick, c.livenessTick, c.nodeStatusTick)
+	return fmt.Sprintf("blockPoolSize: %d, request timeout: %d, batchSizeFromOneNode: %d, maxBatchSizeFromOneNode: %d"+
+		", peerPenaltyTime: %v, processBlockTick: %v, schedulerTick: %v, livenessTick: %v, nodeStatusTick: %v\n",
+		c.blockPoolSize, c.timeOut, c.batchSizeFromOneNode, c.maxBatchSizeFromOneNode, c.peerPenaltyTime,
+		c.processBlockTick, c.schedulerTick, c.livenessTick, c.nodeStatusTick)
 }
@@ -40,8 +40,9 @@ type LivenessMsg struct {
 }
 
 type ReceivedBlocks struct {
-	blks []*commonPb.Block
-	from string
+	blks   []*commonPb.Block
+	rwSets map[uint64][]*commonPb.TxRWSet // The rwsets of the blocks synced with rwsets
+	from   string
 	EqualLevel
 }
 
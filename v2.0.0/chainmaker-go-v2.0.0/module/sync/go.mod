@@ -5,6 +5,8 @@ go 1.15
 require (
 	chainmaker.org/chainmaker-go/localconf v0.0.0
 	chainmaker.org/chainmaker-go/logger v0.0.0
+	chainmaker.org/chainmaker-go/monitor v0.0.0
+	chainmaker.org/chainmaker-go/utils v0.0.0
 	chainmaker.org/chainmaker/common/v2 v2.0.0
 	chainmaker.org/chainmaker/pb-go/v2 v2.0.0
 	chainmaker.org/chainmaker/protocol/v2 v2.0.0
@@ -12,11 +14,14 @@ require (
 	github.com/gogo/protobuf v1.3.2
 	github.com/golang/mock v1.6.0
 	github.com/golang/protobuf v1.4.2
+	github.com/prometheus/client_golang v1.9.0
 	github.com/stretchr/testify v1.7.0
 )
 
 replace (
 	chainmaker.org/chainmaker-go/localconf => ./../conf/localconf
 	chainmaker.org/chainmaker-go/logger => ../logger
+	chainmaker.org/chainmaker-go/monitor => ../monitor
+	chainmaker.org/chainmaker-go/utils => ../utils
 
 )
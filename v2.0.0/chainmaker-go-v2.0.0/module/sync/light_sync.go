@@ -0,0 +1,222 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package sync
+
+import (
+	"bytes"
+	"fmt"
+
+	"chainmaker.org/chainmaker-go/logger"
+	"chainmaker.org/chainmaker-go/utils"
+	"chainmaker.org/chainmaker/common/v2/crypto/hash"
+	"chainmaker.org/chainmaker/common/v2/msgbus"
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	configPb "chainmaker.org/chainmaker/pb-go/v2/config"
+	syncPb "chainmaker.org/chainmaker/pb-go/v2/sync"
+	"chainmaker.org/chainmaker/pb-go/v2/syscontract"
+	"chainmaker.org/chainmaker/protocol/v2"
+	"github.com/gogo/protobuf/proto"
+)
+
+// The sync messages of the light node, they extend syncPb.SyncMsg_MsgType.
+// The request is a syncPb.BlockSyncReq, the response is a syncPb.SyncBlockBatch of block infos,
+// each block carries the header and the additional data only, except the block with one tx,
+// which carries its tx and rwset, so that the light node finds and applies the config blocks.
+const (
+	headerSyncReq  syncPb.SyncMsg_MsgType = 100
+	headerSyncResp syncPb.SyncMsg_MsgType = 101
+)
+
+// VerifyBlockFunc verifies the proposer signature and the consensus signatures of the block,
+// e.g. consensus.VerifyBlockSignatures with the chain config at the height of the block
+type VerifyBlockFunc func(block *commonPb.Block) error
+
+// NewLightBlockChainSyncServer returns the sync service of the light node, which syncs the block headers and
+// the config blocks from the full nodes, verifies them with verify and the config blocks before, and commits
+// them to the store. The light node does not serve blocks to other nodes.
+func NewLightBlockChainSyncServer(chainId string,
+	net protocol.NetService,
+	msgBus msgbus.MessageBus,
+	blockchainStore protocol.BlockchainStore,
+	ledgerCache protocol.LedgerCache,
+	chainConf protocol.ChainConf,
+	verify VerifyBlockFunc) protocol.SyncService {
+
+	syncServer := NewBlockChainSyncServer(chainId, net, msgBus, blockchainStore, ledgerCache,
+		nil, nil).(*BlockChainSyncServer)
+	syncServer.light = &lightBlockCommitter{
+		store:       blockchainStore,
+		ledgerCache: ledgerCache,
+		chainConf:   chainConf,
+		verify:      verify,
+		log:         syncServer.log,
+	}
+	return syncServer
+}
+
+func (sync *BlockChainSyncServer) handleHeaderReq(syncMsg *syncPb.SyncMsg, from string) error {
+	var (
+		err error
+		req syncPb.BlockSyncReq
+	)
+	if err = proto.Unmarshal(syncMsg.Payload, &req); err != nil {
+		sync.log.Errorf("fail to proto.Unmarshal the syncPb.SyncMsg:%s", err.Error())
+		return err
+	}
+	sync.log.Debugf("receive request to get header [height: %d, batch_size: %d] from "+
+		"node [%s]", req.BlockHeight, req.BatchSize, from)
+	return sync.sendHeaders(&req, from)
+}
+
+func (sync *BlockChainSyncServer) sendHeaders(req *syncPb.BlockSyncReq, from string) error {
+	var (
+		bz     []byte
+		err    error
+		blk    *commonPb.Block
+		rwSets []*commonPb.TxRWSet
+	)
+
+	for i := uint64(0); i < req.BatchSize; i++ {
+		if blk, err = sync.blockChainStore.GetBlock(req.BlockHeight + i); err != nil || blk == nil {
+			return err
+		}
+		info := &commonPb.BlockInfo{Block: &commonPb.Block{Header: blk.Header, AdditionalData: blk.AdditionalData}}
+		if len(blk.Txs) == 1 {
+			if rwSets, err = sync.blockChainStore.GetTxRWSetsByHeight(blk.Header.BlockHeight); err != nil {
+				return err
+			}
+			info = &commonPb.BlockInfo{Block: blk, RwsetList: rwSets}
+		}
+		if bz, err = proto.Marshal(&syncPb.SyncBlockBatch{
+			Data: &syncPb.SyncBlockBatch_BlockinfoBatch{BlockinfoBatch: &syncPb.BlockInfoBatch{Batch: []*commonPb.BlockInfo{info}}},
+		}); err != nil {
+			return err
+		}
+		if err := sync.sendMsg(headerSyncResp, bz, from); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lightBlockCommitter verifies the blocks synced by the light node and commits them to the store,
+// only the config blocks are committed with their txs and rwsets
+type lightBlockCommitter struct {
+	store       protocol.BlockchainStore
+	ledgerCache protocol.LedgerCache
+	chainConf   protocol.ChainConf
+	verify      VerifyBlockFunc
+	log         *logger.CMLogger
+}
+
+func (l *lightBlockCommitter) validateAndCommitBlock(block *commonPb.Block,
+	rwSets []*commonPb.TxRWSet) processedBlockStatus {
+	lastBlock := l.ledgerCache.GetLastCommittedBlock()
+	if lastBlock.Header.BlockHeight >= block.Header.BlockHeight {
+		l.log.Infof("the block: %d has been committed in the blockChainStore ", block.Header.BlockHeight)
+		return hasProcessed
+	}
+	if err := l.verifyBlock(block, lastBlock, rwSets); err != nil {
+		l.log.Warnf("fail to verify the block whose height is %d, err: %s", block.Header.BlockHeight, err)
+		return validateFailed
+	}
+
+	isConfBlock := utils.IsConfBlock(block)
+	if isConfBlock {
+		// the chain config is completed before the block is committed, CompleteBlock only reloads it from
+		// the store and notifies the watchers
+		if err := checkChainConfigOfBlock(rwSets); err != nil {
+			l.log.Warnf("fail to complete the config block whose height is %d, err: %s", block.Header.BlockHeight, err)
+			return validateFailed
+		}
+	} else {
+		block = &commonPb.Block{Header: block.Header, AdditionalData: block.AdditionalData}
+		rwSets = nil
+	}
+	if err := l.store.PutBlock(block, rwSets); err != nil {
+		l.log.Warnf("fail to commit the block whose height is %d, err: %s", block.Header.BlockHeight, err)
+		return addErr
+	}
+	l.ledgerCache.SetLastCommittedBlock(block)
+	if isConfBlock {
+		// the chain config and the trust roots of later blocks are changed by the config block
+		if err := l.chainConf.CompleteBlock(block); err != nil {
+			l.log.Errorf("chainconf block complete failed, height: %d, err: %s", block.Header.BlockHeight, err)
+			return addErr
+		}
+	}
+	l.log.Infof("commit the header of block: %d, config block: %v", block.Header.BlockHeight, isConfBlock)
+	return ok
+}
+
+// verifyBlock verifies the block follows lastBlock and is signed by the consensus nodes,
+// the tx and the rwset of the block with one tx are verified against the header
+func (l *lightBlockCommitter) verifyBlock(block, lastBlock *commonPb.Block, rwSets []*commonPb.TxRWSet) error {
+	header := block.Header
+	if header.BlockHeight != lastBlock.Header.BlockHeight+1 {
+		return fmt.Errorf("block height expect %d, got %d", lastBlock.Header.BlockHeight+1, header.BlockHeight)
+	}
+	if !bytes.Equal(header.PreBlockHash, lastBlock.Header.BlockHash) {
+		return fmt.Errorf("pre block hash expect %x, got %x", lastBlock.Header.BlockHash, header.PreBlockHash)
+	}
+	if header.TxCount == 1 {
+		if err := l.verifyTx(block, rwSets); err != nil {
+			return err
+		}
+	}
+	return l.verify(block)
+}
+
+// verifyTx verifies the only tx of the block against the tx root and its rwset against the rwset hash in
+// the tx result, the full node must send them so that a config block can not be hidden
+func (l *lightBlockCommitter) verifyTx(block *commonPb.Block, rwSets []*commonPb.TxRWSet) error {
+	if len(block.Txs) != 1 || len(rwSets) != 1 {
+		return fmt.Errorf("the tx and its rwset of the block are missing")
+	}
+	hashType := l.chainConf.ChainConfig().Crypto.Hash
+	txHash, err := utils.CalcTxHash(hashType, block.Txs[0])
+	if err != nil {
+		return err
+	}
+	txRoot, err := hash.GetMerkleRoot(hashType, [][]byte{txHash})
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(txRoot, block.Header.TxRoot) {
+		return fmt.Errorf("tx root expect %x, got %x", block.Header.TxRoot, txRoot)
+	}
+	rwSetHash, err := utils.CalcRWSetHash(hashType, rwSets[0])
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(rwSetHash, block.Txs[0].Result.GetRwSetHash()) {
+		return fmt.Errorf("rwset hash expect %x, got %x", block.Txs[0].Result.GetRwSetHash(), rwSetHash)
+	}
+	return nil
+}
+
+// checkChainConfigOfBlock checks the chain config written by the config block, which is loaded by the chain config
+// once the block is committed
+func checkChainConfigOfBlock(rwSets []*commonPb.TxRWSet) error {
+	configKey := syscontract.SystemContract_CHAIN_CONFIG.String()
+	for _, rwSet := range rwSets {
+		for _, write := range rwSet.TxWrites {
+			if write.ContractName != configKey || string(write.Key) != configKey {
+				continue
+			}
+			if len(write.Value) == 0 {
+				return fmt.Errorf("the chain config is empty")
+			}
+			var chainConfig configPb.ChainConfig
+			if err := proto.Unmarshal(write.Value, &chainConfig); err != nil {
+				return fmt.Errorf("unmarshal the chain config failed, %s", err)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("the chain config is not written by the config block")
+}
@@ -0,0 +1,182 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package sync
+
+import (
+	"fmt"
+	"testing"
+
+	"chainmaker.org/chainmaker-go/logger"
+	"chainmaker.org/chainmaker-go/utils"
+	"chainmaker.org/chainmaker/common/v2/crypto/hash"
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	configPb "chainmaker.org/chainmaker/pb-go/v2/config"
+	netPb "chainmaker.org/chainmaker/pb-go/v2/net"
+	syncPb "chainmaker.org/chainmaker/pb-go/v2/sync"
+	"chainmaker.org/chainmaker/pb-go/v2/syscontract"
+	"chainmaker.org/chainmaker/protocol/v2/mock"
+	"github.com/golang/mock/gomock"
+	"github.com/golang/protobuf/proto"
+	"github.com/stretchr/testify/require"
+)
+
+func getHeaderReq(t *testing.T, height, batchSize uint64) []byte {
+	bz, err := proto.Marshal(&syncPb.BlockSyncReq{BlockHeight: height, BatchSize: batchSize})
+	require.NoError(t, err)
+	bz, err = proto.Marshal(&syncPb.SyncMsg{Type: headerSyncReq, Payload: bz})
+	require.NoError(t, err)
+	return bz
+}
+
+func newLightBlock(height uint64) *commonPb.Block {
+	return &commonPb.Block{Header: &commonPb.BlockHeader{
+		BlockHeight:  height,
+		BlockHash:    []byte(fmt.Sprintf("hash%d", height)),
+		PreBlockHash: []byte(fmt.Sprintf("hash%d", height-1)),
+		TxCount:      3,
+	}}
+}
+
+func newConfigBlock(t *testing.T, height uint64) (*commonPb.Block, []*commonPb.TxRWSet) {
+	chainConfig, err := proto.Marshal(&configPb.ChainConfig{ChainId: "chain1", Sequence: height})
+	require.NoError(t, err)
+	return newConfigBlockWithWrite(t, height, &commonPb.TxWrite{
+		ContractName: syscontract.SystemContract_CHAIN_CONFIG.String(),
+		Key:          []byte(syscontract.SystemContract_CHAIN_CONFIG.String()),
+		Value:        chainConfig,
+	})
+}
+
+func newConfigBlockWithWrite(t *testing.T, height uint64, txWrite *commonPb.TxWrite) (*commonPb.Block,
+	[]*commonPb.TxRWSet) {
+	rwSet := &commonPb.TxRWSet{TxId: "config", TxWrites: []*commonPb.TxWrite{txWrite}}
+	rwSetHash, err := utils.CalcRWSetHash("SHA256", rwSet)
+	require.NoError(t, err)
+	tx := &commonPb.Transaction{
+		Payload: &commonPb.Payload{TxId: "config", ContractName: syscontract.SystemContract_CHAIN_CONFIG.String()},
+		Result: &commonPb.Result{
+			Code:           commonPb.TxStatusCode_SUCCESS,
+			ContractResult: &commonPb.ContractResult{Result: []byte("ok")},
+			RwSetHash:      rwSetHash,
+		},
+	}
+	txHash, err := utils.CalcTxHash("SHA256", tx)
+	require.NoError(t, err)
+	txRoot, err := hash.GetMerkleRoot("SHA256", [][]byte{txHash})
+	require.NoError(t, err)
+
+	block := newLightBlock(height)
+	block.Header.TxCount = 1
+	block.Header.TxRoot = txRoot
+	block.Txs = []*commonPb.Transaction{tx}
+	return block, []*commonPb.TxRWSet{rwSet}
+}
+
+func TestLightBlockCommitter(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockStore := newMockBlockChainStore(ctrl)
+	mockLedger := newMockLedgerCache(ctrl, &commonPb.Block{Header: &commonPb.BlockHeader{
+		BlockHeight: 0, BlockHash: []byte("hash0")}})
+	mockChainConf := mock.NewMockChainConf(ctrl)
+	mockChainConf.EXPECT().ChainConfig().Return(&configPb.ChainConfig{
+		Crypto: &configPb.CryptoConfig{Hash: "SHA256"}}).AnyTimes()
+	mockChainConf.EXPECT().CompleteBlock(gomock.Any()).Return(nil).Times(1)
+
+	verifyErr := error(nil)
+	light := &lightBlockCommitter{
+		store:       mockStore,
+		ledgerCache: mockLedger,
+		chainConf:   mockChainConf,
+		verify: func(block *commonPb.Block) error {
+			return verifyErr
+		},
+		log: logger.GetLogger(logger.MODULE_SYNC),
+	}
+
+	// the headers are committed in order
+	require.EqualValues(t, validateFailed, light.validateAndCommitBlock(newLightBlock(2), nil))
+	require.EqualValues(t, ok, light.validateAndCommitBlock(newLightBlock(1), nil))
+	require.EqualValues(t, hasProcessed, light.validateAndCommitBlock(newLightBlock(1), nil))
+	blk, err := mockStore.GetBlock(1)
+	require.NoError(t, err)
+	require.Nil(t, blk.Txs)
+
+	// the block fails the consensus verification
+	verifyErr = fmt.Errorf("voteSet without majority")
+	require.EqualValues(t, validateFailed, light.validateAndCommitBlock(newLightBlock(2), nil))
+	verifyErr = nil
+
+	// the block with one tx must carry the tx and its rwset
+	confBlock, rwSets := newConfigBlock(t, 2)
+	require.EqualValues(t, validateFailed, light.validateAndCommitBlock(
+		&commonPb.Block{Header: confBlock.Header}, nil))
+	require.EqualValues(t, validateFailed, light.validateAndCommitBlock(confBlock,
+		[]*commonPb.TxRWSet{{TxId: "config"}}))
+
+	// the config block without the chain config is not committed
+	badBlock, badRwSets := newConfigBlockWithWrite(t, 2, &commonPb.TxWrite{
+		ContractName: syscontract.SystemContract_CHAIN_CONFIG.String(), Key: []byte("key"), Value: []byte("value"),
+	})
+	require.EqualValues(t, validateFailed, light.validateAndCommitBlock(badBlock, badRwSets))
+	_, err = mockStore.GetBlock(2)
+	require.Error(t, err)
+
+	// the config block is committed with its rwset and applied to the chain config
+	require.EqualValues(t, ok, light.validateAndCommitBlock(confBlock, rwSets))
+	blk, err = mockStore.GetBlock(2)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, len(blk.Txs))
+	require.EqualValues(t, 2, mockLedger.GetLastCommittedBlock().Header.BlockHeight)
+}
+
+func TestGetBlocksFromBatch(t *testing.T) {
+	confBlock, rwSets := newConfigBlock(t, 2)
+	blks, blkRwSets := getBlocksFromBatch(&syncPb.SyncBlockBatch{
+		Data: &syncPb.SyncBlockBatch_BlockinfoBatch{BlockinfoBatch: &syncPb.BlockInfoBatch{Batch: []*commonPb.BlockInfo{
+			{Block: newLightBlock(1)}, {Block: confBlock, RwsetList: rwSets},
+		}}},
+	})
+	require.EqualValues(t, 2, len(blks))
+	require.EqualValues(t, 1, len(blkRwSets))
+	require.EqualValues(t, rwSets, blkRwSets[2])
+
+	blks, blkRwSets = getBlocksFromBatch(&syncPb.SyncBlockBatch{
+		Data: &syncPb.SyncBlockBatch_BlockBatch{BlockBatch: &syncPb.BlockBatch{Batches: []*commonPb.Block{
+			newLightBlock(1),
+		}}},
+	})
+	require.EqualValues(t, 1, len(blks))
+	require.Nil(t, blkRwSets)
+}
+
+func TestSyncHeader_Req(t *testing.T) {
+	sync, fn := initTestSync(t)
+	defer fn()
+	implSync := sync.(*BlockChainSyncServer)
+
+	_ = implSync.blockChainStore.PutBlock(newLightBlock(99), nil)
+	_ = implSync.blockChainStore.PutBlock(newLightBlock(100), nil)
+
+	require.NoError(t, implSync.blockSyncMsgHandler("node1", getHeaderReq(t, 99, 2), netPb.NetMsg_SYNC_BLOCK_MSG))
+	require.Error(t, implSync.blockSyncMsgHandler("node1", getHeaderReq(t, 110, 2), netPb.NetMsg_SYNC_BLOCK_MSG))
+}
+
+func TestLightSyncServer(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockLedger := newMockLedgerCache(ctrl, &commonPb.Block{Header: &commonPb.BlockHeader{BlockHeight: 10}})
+	sync := NewLightBlockChainSyncServer("chain1", newMockNet(ctrl), newMockMessageBus(ctrl),
+		newMockBlockChainStore(ctrl), mockLedger, mock.NewMockChainConf(ctrl), nil)
+	require.NoError(t, sync.Start())
+	defer sync.Stop()
+	implSync := sync.(*BlockChainSyncServer)
+
+	// the light node does not serve blocks
+	require.NoError(t, implSync.blockSyncMsgHandler("node1", getNodeStatusReq(t), netPb.NetMsg_SYNC_BLOCK_MSG))
+	require.Error(t, implSync.blockSyncMsgHandler("node1", getBlockReq(t, 1, 1), netPb.NetMsg_SYNC_BLOCK_MSG))
+}
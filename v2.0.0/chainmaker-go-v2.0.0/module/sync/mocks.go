@@ -316,7 +316,8 @@ func NewMockVerifyAndCommit(cache protocol.LedgerCache) *MockVerifyAndCommit {
 	return &MockVerifyAndCommit{cache: cache}
 }
 
-func (m *MockVerifyAndCommit) validateAndCommitBlock(block *commonPb.Block) processedBlockStatus {
+func (m *MockVerifyAndCommit) validateAndCommitBlock(block *commonPb.Block,
+	_ []*commonPb.TxRWSet) processedBlockStatus {
 	m.receiveItem = append(m.receiveItem, block)
 	m.cache.SetLastCommittedBlock(block)
 	return ok
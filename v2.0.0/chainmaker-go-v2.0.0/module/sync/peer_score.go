@@ -0,0 +1,219 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package sync
+
+import (
+	"sort"
+	"time"
+
+	"chainmaker.org/chainmaker-go/monitor"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	defaultMaxBatchSize    = 32               // The maximum number of blocks in a request to a peer by default
+	defaultPeerPenaltyTime = 60 * time.Second // The time a peer is not requested after it returns an invalid block
+	latencySmoothing       = 0.3              // The weight of the latest response in the moving average of latency
+	failureCostFactor      = 4                // How much the timeout requests of a peer increase its cost
+)
+
+// peerScore keeps the performance of a peer in serving blocks, which decides the order of the peers to be
+// requested and the number of blocks in each request to the peer
+type peerScore struct {
+	latency       time.Duration // The moving average of the latency from the request to the response
+	batchSize     uint64        // The number of blocks in each request to the peer
+	streak        uint64        // The number of blocks received since the batch size was changed
+	requested     uint64        // The number of blocks requested from the peer
+	failures      uint64        // The number of requested blocks which are timeout
+	invalid       uint64        // The number of blocks from the peer which failed to be verified
+	servedBlocks  uint64        // The number of blocks received from the peer
+	servedBytes   uint64        // The size of the messages received from the peer
+	penalizedTill time.Time     // The peer is not requested until then after returning an invalid block
+	lastSeen      time.Time     // The last time the peer was scheduled or sent its status
+}
+
+func (s *peerScore) failureRate() float64 {
+	if s.requested == 0 {
+		return 0
+	}
+	return float64(s.failures) / float64(s.requested)
+}
+
+// cost returns the expected time for the peer to serve a new request after its pending blocks, the peer which is
+// not requested yet has no cost, so that each peer is tried
+func (s *peerScore) cost(pending int) float64 {
+	perBlock := float64(s.latency) / float64(s.batchSize)
+	return perBlock * float64(uint64(pending)+s.batchSize) * (1 + failureCostFactor*s.failureRate())
+}
+
+func (sch *scheduler) getScore(peer string) *peerScore {
+	score, exist := sch.scores[peer]
+	if !exist {
+		score = &peerScore{batchSize: sch.minBatchSize()}
+		sch.scores[peer] = score
+	}
+	score.lastSeen = time.Now()
+	return score
+}
+
+// prunePeerScores drops the scores of the peers which have been gone longer than the penalty time and are not
+// penalized any more, the metrics of the peers are deleted too, so that the labels do not grow as peers churn
+func (sch *scheduler) prunePeerScores() {
+	now := time.Now()
+	for peer, score := range sch.scores {
+		if _, exist := sch.peers[peer]; exist {
+			continue
+		}
+		if now.Before(score.penalizedTill) || now.Sub(score.lastSeen) <= sch.peerPenaltyTime {
+			continue
+		}
+		delete(sch.scores, peer)
+		if sch.metrics != nil {
+			sch.metrics.deletePeer(peer)
+		}
+		sch.log.Debugf("drop the score of node[%s] gone since %s", peer, score.lastSeen)
+	}
+}
+
+// minBatchSize returns the configured batch size, which is the initial and the minimum batch size of the peers
+func (sch *scheduler) minBatchSize() uint64 {
+	if sch.BatchesizeInEachReq == 0 {
+		return 1
+	}
+	return sch.BatchesizeInEachReq
+}
+
+func (sch *scheduler) isPenalized(peer string) bool {
+	score, exist := sch.scores[peer]
+	return exist && time.Now().Before(score.penalizedTill)
+}
+
+// rankPeers returns the peers which are not penalized and have the block of the height, in the order of their cost
+func (sch *scheduler) rankPeers(height uint64) []string {
+	pending := make(map[string]int, len(sch.peers))
+	for _, id := range sch.pendingBlocks {
+		pending[id]++
+	}
+	peers := make([]string, 0, len(sch.peers))
+	costs := make(map[string]float64, len(sch.peers))
+	for id, peerHeight := range sch.peers {
+		if peerHeight < height || sch.isPenalized(id) {
+			continue
+		}
+		peers = append(peers, id)
+		costs[id] = sch.getScore(id).cost(pending[id])
+	}
+	sort.Slice(peers, func(i, j int) bool {
+		if costs[peers[i]] != costs[peers[j]] {
+			return costs[peers[i]] < costs[peers[j]]
+		}
+		if pending[peers[i]] != pending[peers[j]] {
+			return pending[peers[i]] < pending[peers[j]]
+		}
+		return peers[i] < peers[j]
+	})
+	return peers
+}
+
+func (sch *scheduler) onBlocksRequested(peer string, blocks uint64) {
+	sch.getScore(peer).requested += blocks
+}
+
+// onBlocksReceived updates the latency of the peer, and doubles its batch size after a batch of blocks is
+// received quickly
+func (sch *scheduler) onBlocksReceived(peer string, latency time.Duration, blocks, bytes uint64) {
+	score := sch.getScore(peer)
+	if score.latency == 0 {
+		score.latency = latency
+	} else {
+		score.latency = time.Duration(latencySmoothing*float64(latency) + (1-latencySmoothing)*float64(score.latency))
+	}
+	score.servedBlocks += blocks
+	score.servedBytes += bytes
+	score.streak += blocks
+	if score.streak >= score.batchSize && score.latency < sch.peerReqTimeout/4 && score.batchSize < sch.maxBatchSize {
+		score.batchSize *= 2
+		if score.batchSize > sch.maxBatchSize {
+			score.batchSize = sch.maxBatchSize
+		}
+		score.streak = 0
+		sch.log.Debugf("increase batch size of node[%s] to %d, latency: %s", peer, score.batchSize, score.latency)
+	}
+	if sch.metrics != nil {
+		sch.metrics.latency.WithLabelValues(sch.metrics.chainId).Observe(latency.Seconds())
+		sch.metrics.blocks.WithLabelValues(sch.metrics.chainId, peer).Add(float64(blocks))
+		sch.metrics.bytes.WithLabelValues(sch.metrics.chainId, peer).Add(float64(bytes))
+		sch.metrics.batchSize.WithLabelValues(sch.metrics.chainId, peer).Set(float64(score.batchSize))
+	}
+}
+
+// onRequestTimeout halves the batch size of the peer whose requested blocks are timeout
+func (sch *scheduler) onRequestTimeout(peer string, blocks uint64) {
+	score := sch.getScore(peer)
+	score.failures += blocks
+	score.streak = 0
+	if score.batchSize /= 2; score.batchSize < sch.minBatchSize() {
+		score.batchSize = sch.minBatchSize()
+	}
+	if sch.metrics != nil {
+		sch.metrics.failures.WithLabelValues(sch.metrics.chainId, peer, "timeout").Add(float64(blocks))
+		sch.metrics.batchSize.WithLabelValues(sch.metrics.chainId, peer).Set(float64(score.batchSize))
+	}
+}
+
+// onInvalidBlock penalizes the peer which returns a block failed to be verified, the peer is not
+// requested in the penalty time, which doubles for each invalid block
+func (sch *scheduler) onInvalidBlock(peer string) {
+	score := sch.getScore(peer)
+	score.invalid++
+	penalty := sch.peerPenaltyTime
+	for i := uint64(1); i < score.invalid && penalty < time.Hour; i++ {
+		penalty *= 2
+	}
+	score.penalizedTill = time.Now().Add(penalty)
+	score.batchSize = sch.minBatchSize()
+	score.streak = 0
+	sch.log.Warnf("node[%s] returned invalid block %d times, penalized for %s", peer, score.invalid, penalty)
+	if sch.metrics != nil {
+		sch.metrics.failures.WithLabelValues(sch.metrics.chainId, peer, "invalid").Inc()
+	}
+}
+
+// syncMetrics exports the performance of the peers through the monitor module
+type syncMetrics struct {
+	chainId   string
+	latency   *prometheus.HistogramVec
+	blocks    *prometheus.CounterVec
+	bytes     *prometheus.CounterVec
+	failures  *prometheus.CounterVec
+	batchSize *prometheus.GaugeVec
+}
+
+func newSyncMetrics(chainId string) *syncMetrics {
+	return &syncMetrics{
+		chainId: chainId,
+		latency: monitor.NewHistogramVec(monitor.SUBSYSTEM_SYNC, "metric_block_request_latency",
+			"block request latency", prometheus.ExponentialBuckets(0.005, 2, 12), monitor.ChainId),
+		blocks: monitor.NewCounterVec(monitor.SUBSYSTEM_SYNC, "metric_synced_blocks",
+			"blocks received from peer", monitor.ChainId, "peer"),
+		bytes: monitor.NewCounterVec(monitor.SUBSYSTEM_SYNC, "metric_synced_bytes",
+			"bytes received from peer", monitor.ChainId, "peer"),
+		failures: monitor.NewCounterVec(monitor.SUBSYSTEM_SYNC, "metric_peer_failures",
+			"blocks failed from peer", monitor.ChainId, "peer", "reason"),
+		batchSize: monitor.NewGaugeVec(monitor.SUBSYSTEM_SYNC, "metric_peer_batch_size",
+			"batch size of request to peer", monitor.ChainId, "peer"),
+	}
+}
+
+// deletePeer deletes the metrics of the peer whose score is dropped
+func (m *syncMetrics) deletePeer(peer string) {
+	m.blocks.DeleteLabelValues(m.chainId, peer)
+	m.bytes.DeleteLabelValues(m.chainId, peer)
+	m.failures.DeleteLabelValues(m.chainId, peer, "timeout")
+	m.failures.DeleteLabelValues(m.chainId, peer, "invalid")
+	m.batchSize.DeleteLabelValues(m.chainId, peer)
+}
@@ -20,12 +20,13 @@ import (
 )
 
 type verifyAndAddBlock interface {
-	validateAndCommitBlock(block *commonPb.Block) processedBlockStatus
+	validateAndCommitBlock(block *commonPb.Block, rwSets []*commonPb.TxRWSet) processedBlockStatus
 }
 
 type blockWithPeerInfo struct {
-	id  string
-	blk *commonPb.Block
+	id     string
+	blk    *commonPb.Block
+	rwSets []*commonPb.TxRWSet
 }
 
 type processor struct {
@@ -66,7 +67,7 @@ func (pro *processor) handleReceivedBlocks(msg *ReceivedBlocks) {
 		}
 		if _, exist := pro.queue[blk.Header.BlockHeight]; !exist {
 			pro.queue[blk.Header.BlockHeight] = blockWithPeerInfo{
-				blk: blk, id: msg.from,
+				blk: blk, id: msg.from, rwSets: msg.rwSets[blk.Header.BlockHeight],
 			}
 			pro.log.Debugf("received block [height: %d] from node [%s]", blk.Header.BlockHeight, msg.from)
 		}
@@ -84,7 +85,7 @@ func (pro *processor) handleProcessBlockMsg() (queue.Item, error) {
 		//pro.log.Debugf("block [%d] not find in queue.", pendingBlockHeight)
 		return nil, nil
 	}
-	if status = pro.validateAndCommitBlock(info.blk); status == ok || status == hasProcessed {
+	if status = pro.validateAndCommitBlock(info.blk, info.rwSets); status == ok || status == hasProcessed {
 		pro.hasCommitBlock++
 	}
 	delete(pro.queue, pendingBlockHeight)
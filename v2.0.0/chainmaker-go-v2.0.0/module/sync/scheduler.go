@@ -10,10 +10,10 @@ package sync
 import (
 	"fmt"
 	"math"
-	"sort"
 	"time"
 
 	"chainmaker.org/chainmaker-go/logger"
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
 	syncPb "chainmaker.org/chainmaker/pb-go/v2/sync"
 	"chainmaker.org/chainmaker/protocol/v2"
 	"github.com/Workiva/go-datastructures/queue"
@@ -40,6 +40,13 @@ type scheduler struct {
 	peerReqTimeout      time.Duration // The maximum timeout for a node response
 	reqTimeThreshold    time.Duration // When the difference between the height of the node and the latest height of peers is 1, the time interval for requesting
 
+	reqMsgType syncPb.SyncMsg_MsgType // The type of the block request, the light node requests the headers only
+
+	scores          map[string]*peerScore // The performance of the peers, which is dropped a while after the peers are gone
+	maxBatchSize    uint64                // The maximum number of blocks in a request, the batch size of each peer adapts to its performance
+	peerPenaltyTime time.Duration         // The time a peer is not requested after it returns an invalid block
+	metrics         *syncMetrics          // Exports the performance of the peers, nil if the monitor is disabled
+
 	log    *logger.CMLogger
 	sender syncSender
 	ledger protocol.LedgerCache
@@ -52,6 +59,10 @@ func newScheduler(sender syncSender, ledger protocol.LedgerCache,
 	if err != nil {
 		return nil
 	}
+	maxBatchSize := uint64(defaultMaxBatchSize)
+	if Batchesize > maxBatchSize {
+		maxBatchSize = Batchesize
+	}
 	return &scheduler{
 		log:    log,
 		ledger: ledger,
@@ -61,8 +72,12 @@ func newScheduler(sender syncSender, ledger protocol.LedgerCache,
 		maxPendingBlocks:    maxNum,
 		BatchesizeInEachReq: Batchesize,
 		reqTimeThreshold:    reqTimeThreshold,
+		reqMsgType:          syncPb.SyncMsg_BLOCK_SYNC_REQ,
+		maxBatchSize:        maxBatchSize,
+		peerPenaltyTime:     defaultPeerPenaltyTime,
 
 		peers:             make(map[string]uint64),
+		scores:            make(map[string]*peerScore),
 		blockStates:       make(map[uint64]blockState),
 		pendingBlocks:     make(map[uint64]string),
 		pendingTime:       make(map[uint64]time.Time),
@@ -91,6 +106,9 @@ func (sch *scheduler) handler(event queue.Item) (queue.Item, error) {
 
 func (sch *scheduler) handleNodeStatus(msg NodeStatusMsg) {
 	localCurrBlk := sch.ledger.GetLastCommittedBlock()
+	if score, exist := sch.scores[msg.from]; exist {
+		score.lastSeen = time.Now()
+	}
 	if old, exist := sch.peers[msg.from]; exist {
 		if old > msg.msg.BlockHeight || sch.isPeerArchivedTooHeight(localCurrBlk.Header.BlockHeight, msg.msg.GetArchivedHeight()) {
 			delete(sch.peers, msg.from)
@@ -102,6 +120,10 @@ func (sch *scheduler) handleNodeStatus(msg NodeStatusMsg) {
 			msg.from, msg.msg.BlockHeight, msg.msg.GetArchivedHeight())
 		return
 	}
+	if sch.isPenalized(msg.from) {
+		sch.log.Debugf("coming node[%s] is penalized, will ignore it", msg.from)
+		return
+	}
 	sch.log.Debugf("add node[%s], status[height: %d, archivedHeight: %d]", msg.from, msg.msg.BlockHeight, msg.msg.ArchivedHeight)
 	sch.peers[msg.from] = msg.msg.BlockHeight
 	sch.addPendingBlocksAndUpdatePendingHeight(msg.msg.BlockHeight)
@@ -137,57 +159,88 @@ func (sch *scheduler) handleDataDetection() {
 	sch.blockStates[sch.pendingRecvHeight] = newBlock
 }
 
+// handleLivinessMsg reschedules the timeout requests, the peers of them are removed until their next status
 func (sch *scheduler) handleLivinessMsg() {
-	reqTime, exist := sch.pendingTime[sch.pendingRecvHeight]
-	if exist && time.Since(reqTime) > sch.peerReqTimeout {
-		id := sch.pendingBlocks[sch.pendingRecvHeight]
-		sch.log.Debugf("block request [height: %d] time out from node[%s]", sch.pendingRecvHeight, id)
-		if currBlk := sch.ledger.GetLastCommittedBlock(); currBlk != nil && currBlk.Header.BlockHeight < sch.pendingRecvHeight {
-			sch.blockStates[sch.pendingRecvHeight] = newBlock
+	timeouts := make(map[string]uint64)
+	currBlk := sch.ledger.GetLastCommittedBlock()
+	for height, reqTime := range sch.pendingTime {
+		if time.Since(reqTime) <= sch.peerReqTimeout {
+			continue
+		}
+		id := sch.pendingBlocks[height]
+		sch.log.Debugf("block request [height: %d] time out from node[%s]", height, id)
+		if currBlk != nil && currBlk.Header.BlockHeight < height {
+			sch.blockStates[height] = newBlock
 		}
+		timeouts[id]++
+		delete(sch.pendingTime, height)
+		delete(sch.pendingBlocks, height)
+	}
+	for id, blocks := range timeouts {
 		delete(sch.peers, id)
-		delete(sch.pendingTime, sch.pendingRecvHeight)
-		delete(sch.pendingBlocks, sch.pendingRecvHeight)
+		if len(id) > 0 {
+			sch.onRequestTimeout(id, blocks)
+		}
 	}
+	sch.prunePeerScores()
 }
 
+// handleScheduleMsg requests the next blocks from each available peer, the peers with lower cost are requested
+// the lower heights, and each request is a range of blocks in the batch size of the peer
 func (sch *scheduler) handleScheduleMsg() (queue.Item, error) {
-	var (
-		err           error
-		bz            []byte
-		peer          string
-		pendingHeight uint64
-	)
-
 	if !sch.isNeedSync() {
 		//sch.log.Debugf("no need to sync block")
 		return nil, nil
 	}
-	if pendingHeight = sch.nextHeightToReq(); pendingHeight < 0 {
-		sch.log.Debugf("pendingHeight: %d, block status %v", pendingHeight, sch.blockStates)
+	pendingHeight := sch.nextHeightToReq()
+	if pendingHeight == math.MaxUint64 {
 		return nil, nil
 	}
-	if bz, err = proto.Marshal(&syncPb.BlockSyncReq{
-		BlockHeight: pendingHeight, BatchSize: sch.BatchesizeInEachReq,
-	}); err != nil {
-		return nil, err
-	}
-
-	if peer = sch.selectPeer(pendingHeight); len(peer) == 0 {
+	peers := sch.rankPeers(pendingHeight)
+	if len(peers) == 0 {
 		sch.log.Debugf("no peers have block [%d] ", pendingHeight)
 		return nil, nil
 	}
+	for _, peer := range peers {
+		if err := sch.requestBlocks(peer, pendingHeight); err != nil {
+			return nil, err
+		}
+		if pendingHeight = sch.nextHeightToReq(); pendingHeight == math.MaxUint64 {
+			break
+		}
+	}
+	return nil, nil
+}
+
+// requestBlocks requests the new blocks from the height to the peer, which are no more than the batch size of the peer
+func (sch *scheduler) requestBlocks(peer string, pendingHeight uint64) error {
+	var (
+		err       error
+		bz        []byte
+		batchSize = sch.getScore(peer).batchSize
+		blocks    uint64
+	)
+	if sch.peers[peer] < pendingHeight {
+		return nil
+	}
 	sch.lastRequest = time.Now()
-	for i := pendingHeight; i <= sch.peers[peer] && i < sch.BatchesizeInEachReq+pendingHeight; i++ {
+	for i := pendingHeight; i <= sch.peers[peer] && i < batchSize+pendingHeight; i++ {
+		if state, exist := sch.blockStates[i]; i > pendingHeight && (!exist || state != newBlock) {
+			break
+		}
 		sch.blockStates[i] = pendingBlock
 		sch.pendingTime[i] = sch.lastRequest
 		sch.pendingBlocks[i] = peer
+		blocks++
 	}
-	sch.log.Debugf("request block[height: %d] from node [%s], BatchesizeInReq: %d", pendingHeight, peer, sch.BatchesizeInEachReq)
-	if err := sch.sender.sendMsg(syncPb.SyncMsg_BLOCK_SYNC_REQ, bz, peer); err != nil {
-		return nil, err
+	if bz, err = proto.Marshal(&syncPb.BlockSyncReq{
+		BlockHeight: pendingHeight, BatchSize: blocks,
+	}); err != nil {
+		return err
 	}
-	return nil, nil
+	sch.onBlocksRequested(peer, blocks)
+	sch.log.Debugf("request block[height: %d] from node [%s], BatchesizeInReq: %d", pendingHeight, peer, blocks)
+	return sch.sender.sendMsg(sch.reqMsgType, bz, peer)
 }
 
 func (sch *scheduler) nextHeightToReq() uint64 {
@@ -227,58 +280,21 @@ func (sch *scheduler) isNeedSync() bool {
 	return currHeight+1 < max || (currHeight+1 == max && time.Since(sch.lastRequest) > sch.reqTimeThreshold)
 }
 
-func (sch *scheduler) selectPeer(pendingHeight uint64) string {
-	peers := sch.getHeight(pendingHeight)
-	if len(peers) == 0 {
-		return ""
-	}
-
-	pendingReqInPeers := make(map[int][]string)
-	for i := 0; i < len(peers); i++ {
-		reqNum := sch.getPendingReqInPeer(peers[i])
-		pendingReqInPeers[reqNum] = append(pendingReqInPeers[reqNum], peers[i])
-	}
-	min := math.MaxInt64
-	for num := range pendingReqInPeers {
-		if min > num {
-			min = num
-		}
-	}
-	peers = pendingReqInPeers[min]
-	sort.Strings(peers)
-	return peers[0]
-}
-
-func (sch *scheduler) getHeight(pendingHeight uint64) []string {
-	peers := make([]string, 0, len(sch.peers)/2)
-	for id, height := range sch.peers {
-		if height >= pendingHeight {
-			peers = append(peers, id)
-		}
-	}
-	return peers
-}
-
-func (sch *scheduler) getPendingReqInPeer(peer string) int {
-	num := 0
-	for _, id := range sch.pendingBlocks {
-		if id == peer {
-			num++
-		}
-	}
-	return num
-}
-
 func (sch *scheduler) handleSyncedBlockMsg(msg *SyncedBlockMsg) (queue.Item, error) {
 	blkBatch := syncPb.SyncBlockBatch{}
 	if err := proto.Unmarshal(msg.msg, &blkBatch); err != nil {
 		return nil, err
 	}
-	if len(blkBatch.GetBlockBatch().Batches) == 0 {
+	blks, rwSets := getBlocksFromBatch(&blkBatch)
+	if len(blks) == 0 {
 		return nil, nil
 	}
 	needToProcess := false
-	for _, blk := range blkBatch.GetBlockBatch().Batches {
+	var reqTime time.Time
+	for _, blk := range blks {
+		if sch.pendingBlocks[blk.Header.BlockHeight] == msg.from && reqTime.IsZero() {
+			reqTime = sch.pendingTime[blk.Header.BlockHeight]
+		}
 		delete(sch.pendingBlocks, blk.Header.BlockHeight)
 		delete(sch.pendingTime, blk.Header.BlockHeight)
 		if _, exist := sch.blockStates[blk.Header.BlockHeight]; exist {
@@ -289,14 +305,38 @@ func (sch *scheduler) handleSyncedBlockMsg(msg *SyncedBlockMsg) (queue.Item, err
 		sch.log.Debugf("received block [height:%d:%x] needToProcess: %v from "+
 			"node [%s]", blk.Header.BlockHeight, blk.Header.BlockHash, needToProcess, msg.from)
 	}
+	if !reqTime.IsZero() {
+		sch.onBlocksReceived(msg.from, time.Since(reqTime), uint64(len(blks)), uint64(len(msg.msg)))
+	}
 	if needToProcess {
 		return &ReceivedBlocks{
-			blks: blkBatch.GetBlockBatch().Batches,
-			from: msg.from}, nil
+			blks:   blks,
+			rwSets: rwSets,
+			from:   msg.from}, nil
 	}
 	return nil, nil
 }
 
+// getBlocksFromBatch returns the blocks in the batch and the rwsets of the blocks synced with rwsets
+func getBlocksFromBatch(blkBatch *syncPb.SyncBlockBatch) ([]*commonPb.Block, map[uint64][]*commonPb.TxRWSet) {
+	infos := blkBatch.GetBlockinfoBatch().GetBatch()
+	if len(infos) == 0 {
+		return blkBatch.GetBlockBatch().GetBatches(), nil
+	}
+	blks := make([]*commonPb.Block, 0, len(infos))
+	rwSets := make(map[uint64][]*commonPb.TxRWSet, len(infos))
+	for _, info := range infos {
+		if info.Block == nil || info.Block.Header == nil {
+			continue
+		}
+		blks = append(blks, info.Block)
+		if len(info.RwsetList) > 0 {
+			rwSets[info.Block.Header.BlockHeight] = info.RwsetList
+		}
+	}
+	return blks, rwSets
+}
+
 func (sch *scheduler) handleProcessedBlockResp(msg ProcessedBlockResp) (queue.Item, error) {
 	sch.log.Debugf("process block [height:%d] status[%d] from node"+
 		" [%s], pendingHeight: %d", msg.height, msg.status, msg.from, sch.pendingRecvHeight)
@@ -311,6 +351,7 @@ func (sch *scheduler) handleProcessedBlockResp(msg ProcessedBlockResp) (queue.It
 	if msg.status == validateFailed {
 		sch.blockStates[msg.height] = newBlock
 		delete(sch.peers, msg.from)
+		sch.onInvalidBlock(msg.from)
 	}
 	if msg.status == dbErr {
 		return nil, fmt.Errorf("query db failed in processor")
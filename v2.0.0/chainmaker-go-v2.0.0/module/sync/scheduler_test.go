@@ -254,3 +254,100 @@ func TestSchedulerFlow(t *testing.T) {
 	require.NoError(t, err)
 	require.EqualValues(t, 98, len(sch.blockStates))
 }
+
+func TestAdaptiveSchedule(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockSender := NewMockSender()
+	mockLedger := newMockLedgerCache(ctrl, &commonPb.Block{Header: &commonPb.BlockHeader{BlockHeight: 10}})
+	sch := newScheduler(mockSender, mockLedger, 100, time.Second, time.Second*3, 2, logger.GetLogger(logger.MODULE_SYNC))
+	sch.maxBatchSize = 8
+
+	// 1. each peer is requested a range of blocks in one schedule
+	_, _ = sch.handler(NodeStatusMsg{from: "node1", msg: syncPb.BlockHeightBCM{BlockHeight: 100}})
+	_, _ = sch.handler(NodeStatusMsg{from: "node2", msg: syncPb.BlockHeightBCM{BlockHeight: 100}})
+	_, _ = sch.handler(SchedulerMsg{})
+	require.EqualValues(t, 2, len(mockSender.msgs))
+	require.EqualValues(t, "node1", sch.pendingBlocks[11])
+	require.EqualValues(t, "node1", sch.pendingBlocks[12])
+	require.EqualValues(t, "node2", sch.pendingBlocks[13])
+	require.EqualValues(t, "node2", sch.pendingBlocks[14])
+
+	// 2. the batch size of the peer responding quickly is doubled, and the faster peer is requested first
+	for height := uint64(13); height <= 14; height++ {
+		bz, err := proto.Marshal(&syncPb.SyncBlockBatch{
+			Data: &syncPb.SyncBlockBatch_BlockBatch{BlockBatch: &syncPb.BlockBatch{Batches: []*commonPb.Block{
+				{Header: &commonPb.BlockHeader{BlockHeight: height}},
+			}}},
+		})
+		require.NoError(t, err)
+		_, err = sch.handler(&SyncedBlockMsg{from: "node2", msg: bz})
+		require.NoError(t, err)
+	}
+	require.EqualValues(t, 4, sch.scores["node2"].batchSize)
+	require.EqualValues(t, 2, sch.scores["node2"].servedBlocks)
+	sch.scores["node1"].latency = sch.peerReqTimeout
+	require.Equal(t, []string{"node2", "node1"}, sch.rankPeers(15))
+	sch.lastRequest = time.Time{}
+	_, _ = sch.handler(SchedulerMsg{})
+	for height := uint64(15); height < 19; height++ {
+		require.EqualValues(t, "node2", sch.pendingBlocks[height])
+	}
+	require.EqualValues(t, "node1", sch.pendingBlocks[19])
+
+	// 3. the batch size of the peer is halved when its requests are timeout
+	for height := range sch.pendingTime {
+		sch.pendingTime[height] = time.Now().Add(-2 * sch.peerReqTimeout)
+	}
+	_, _ = sch.handler(LivenessMsg{})
+	require.EqualValues(t, 0, len(sch.pendingBlocks))
+	require.EqualValues(t, 0, len(sch.peers))
+	require.EqualValues(t, 2, sch.scores["node2"].batchSize)
+	require.EqualValues(t, 4, sch.scores["node2"].failures)
+	require.EqualValues(t, newBlock, sch.blockStates[11])
+
+	// 4. the peer returning an invalid block is penalized
+	_, _ = sch.handler(NodeStatusMsg{from: "node1", msg: syncPb.BlockHeightBCM{BlockHeight: 100}})
+	_, err := sch.handler(ProcessedBlockResp{height: 11, status: validateFailed, from: "node1"})
+	require.NoError(t, err)
+	require.True(t, sch.isPenalized("node1"))
+	_, _ = sch.handler(NodeStatusMsg{from: "node1", msg: syncPb.BlockHeightBCM{BlockHeight: 100}})
+	require.EqualValues(t, 0, len(sch.peers))
+	sch.scores["node1"].penalizedTill = time.Now()
+	_, _ = sch.handler(NodeStatusMsg{from: "node1", msg: syncPb.BlockHeightBCM{BlockHeight: 100}})
+	require.EqualValues(t, 1, len(sch.peers))
+}
+
+func TestPrunePeerScores(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockLedger := newMockLedgerCache(ctrl, &commonPb.Block{Header: &commonPb.BlockHeader{BlockHeight: 10}})
+	sch := newScheduler(NewMockSender(), mockLedger, 100, time.Second, time.Second*3, 2, logger.GetLogger(logger.MODULE_SYNC))
+
+	_, _ = sch.handler(NodeStatusMsg{from: "node1", msg: syncPb.BlockHeightBCM{BlockHeight: 100}})
+	for _, peer := range []string{"node1", "node2", "node3", "node4"} {
+		sch.onBlocksRequested(peer, 1)
+	}
+	gone := time.Now().Add(-2 * sch.peerPenaltyTime)
+	for _, score := range sch.scores {
+		score.lastSeen = gone
+	}
+	// node3 is still penalized, node4 is gone recently
+	sch.scores["node3"].penalizedTill = time.Now().Add(time.Minute)
+	sch.scores["node4"].lastSeen = time.Now()
+
+	_, _ = sch.handler(LivenessMsg{})
+	require.EqualValues(t, 3, len(sch.scores))
+	require.NotNil(t, sch.scores["node1"])
+	require.Nil(t, sch.scores["node2"])
+	require.NotNil(t, sch.scores["node3"])
+	require.NotNil(t, sch.scores["node4"])
+
+	// the penalized peer sending its status is not gone after the penalty
+	sch.scores["node3"].lastSeen = gone
+	_, _ = sch.handler(NodeStatusMsg{from: "node3", msg: syncPb.BlockHeightBCM{BlockHeight: 100}})
+	require.EqualValues(t, 1, len(sch.peers))
+	sch.scores["node3"].penalizedTill = time.Now()
+	_, _ = sch.handler(LivenessMsg{})
+	require.NotNil(t, sch.scores["node3"])
+}
@@ -0,0 +1,284 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package sync
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"chainmaker.org/chainmaker-go/utils"
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	syncPb "chainmaker.org/chainmaker/pb-go/v2/sync"
+)
+
+// The sync messages of the state snapshot, they extend syncPb.SyncMsg_MsgType.
+// The manifest request has no payload, the manifest response is the json encoded utils.StateSnapshotManifest,
+// the chunk request and response are the json encoded stateSnapshotChunk.
+const (
+	stateSnapshotManifestReq  syncPb.SyncMsg_MsgType = 102
+	stateSnapshotManifestResp syncPb.SyncMsg_MsgType = 103
+	stateSnapshotChunkReq     syncPb.SyncMsg_MsgType = 104
+	stateSnapshotChunkResp    syncPb.SyncMsg_MsgType = 105
+)
+
+const (
+	stateSnapshotWaitTime     = time.Minute     // The time to wait for an accepted manifest from peers
+	stateSnapshotReqInterval  = 5 * time.Second // The interval to broadcast the manifest request
+	stateSnapshotChunkRetries = 3               // The times to request a chunk from each peer
+)
+
+// stateSnapshotStore is implemented by the store which exports and installs the state snapshots
+type stateSnapshotStore interface {
+	GetStateSnapshotManifest() (*utils.StateSnapshotManifest, error)
+	GetStateSnapshotChunk(height uint64, index int) ([]byte, error)
+	InstallStateSnapshot(manifest *utils.StateSnapshotManifest, getChunk func(index int) ([]byte, error),
+		verifyBlock func(block *commonPb.Block) error) error
+}
+
+// StateSnapshotInstalledFunc is called after the state snapshot is installed, before the blocks after the snapshot
+// are synced, e.g. to reload the chain config from the installed states
+type StateSnapshotInstalledFunc func(block, configBlock *commonPb.Block) error
+
+type stateSnapshotChunk struct {
+	BlockHeight uint64 `json:"block_height"`
+	Index       int    `json:"index"`
+	Chunk       []byte `json:"chunk,omitempty"`
+}
+
+type peerStateSnapshotManifest struct {
+	from     string
+	manifest *utils.StateSnapshotManifest
+}
+
+// stateSnapshotSyncer keeps the state of the new node which installs the state snapshot from peers
+type stateSnapshotSyncer struct {
+	trustedHash []byte          // The block hash of the trusted snapshot, the manifest is agreed by peers if it is empty
+	minPeers    int             // The number of peers which must serve the same manifest
+	verify      VerifyBlockFunc // Verifies the signatures of the blocks of the snapshot
+	installed   StateSnapshotInstalledFunc
+
+	manifests chan *peerStateSnapshotManifest
+	chunks    chan *stateSnapshotChunk
+}
+
+// EnableStateSnapshotSync makes the new node install the state snapshot from peers when the service starts, instead
+// of executing the blocks from the genesis. The snapshot is accepted if its block hash is trustedHash, or if
+// trustedHash is empty, when minPeers peers serve the same one. The blocks of the snapshot are verified by verify
+// before the states are installed. The node syncs the blocks from the genesis if no snapshot is accepted in time.
+func (sync *BlockChainSyncServer) EnableStateSnapshotSync(trustedHash []byte, minPeers int, verify VerifyBlockFunc,
+	installed StateSnapshotInstalledFunc) {
+	if minPeers < 1 {
+		minPeers = 1
+	}
+	sync.snapshot = &stateSnapshotSyncer{
+		trustedHash: trustedHash,
+		minPeers:    minPeers,
+		verify:      verify,
+		installed:   installed,
+		manifests:   make(chan *peerStateSnapshotManifest, 64),
+		chunks:      make(chan *stateSnapshotChunk, 16),
+	}
+}
+
+// syncStateSnapshot installs the state snapshot accepted from peers, and returns the height of the installed
+// block, or the current height if there is no snapshot to install
+func (sync *BlockChainSyncServer) syncStateSnapshot() (uint64, error) {
+	height, err := sync.ledgerCache.CurrentHeight()
+	if err != nil || height > 0 {
+		return height, err
+	}
+	store, ok := sync.blockChainStore.(stateSnapshotStore)
+	if !ok {
+		return height, fmt.Errorf("the store does not support the state snapshot")
+	}
+	manifest, peers := sync.snapshot.fetchManifest(func() error {
+		return sync.broadcastMsg(stateSnapshotManifestReq, nil)
+	})
+	if manifest == nil {
+		sync.log.Warnf("no state snapshot is accepted in %s, sync the blocks from the genesis", stateSnapshotWaitTime)
+		return height, nil
+	}
+	sync.log.Infof("install the state snapshot of block[%d] %x with %d chunks from %v", manifest.BlockHeight,
+		manifest.BlockHash, len(manifest.ChunkHashes), peers)
+	if err = store.InstallStateSnapshot(manifest, func(index int) ([]byte, error) {
+		return sync.fetchStateSnapshotChunk(manifest, peers, index)
+	}, sync.snapshot.verify); err != nil {
+		return height, err
+	}
+	block, configBlock, err := manifest.GetBlocks()
+	if err != nil {
+		return height, err
+	}
+	sync.ledgerCache.SetLastCommittedBlock(block.Block)
+	if sync.snapshot.installed != nil {
+		if err = sync.snapshot.installed(block.Block, configBlock.Block); err != nil {
+			return height, err
+		}
+	}
+	sync.log.Infof("the state snapshot of block[%d] is installed", manifest.BlockHeight)
+	return manifest.BlockHeight, nil
+}
+
+// fetchManifest broadcasts the manifest request until a manifest is accepted, it returns the manifest and the
+// peers serving it, or nil if no manifest is accepted in stateSnapshotWaitTime
+func (s *stateSnapshotSyncer) fetchManifest(broadcast func() error) (*utils.StateSnapshotManifest, []string) {
+	type candidate struct {
+		manifest *utils.StateSnapshotManifest
+		peers    map[string]struct{}
+	}
+	var (
+		candidates = make(map[string]*candidate)
+		ticker     = time.NewTicker(stateSnapshotReqInterval)
+		deadline   = time.NewTimer(stateSnapshotWaitTime)
+	)
+	defer ticker.Stop()
+	defer deadline.Stop()
+
+	_ = broadcast()
+	for {
+		select {
+		case resp := <-s.manifests:
+			if len(s.trustedHash) > 0 && !bytes.Equal(resp.manifest.BlockHash, s.trustedHash) {
+				continue
+			}
+			hash, err := resp.manifest.Hash()
+			if err != nil {
+				continue
+			}
+			c, exist := candidates[string(hash)]
+			if !exist {
+				c = &candidate{manifest: resp.manifest, peers: make(map[string]struct{})}
+				candidates[string(hash)] = c
+			}
+			c.peers[resp.from] = struct{}{}
+			if len(s.trustedHash) > 0 || len(c.peers) >= s.minPeers {
+				peers := make([]string, 0, len(c.peers))
+				for peer := range c.peers {
+					peers = append(peers, peer)
+				}
+				return c.manifest, peers
+			}
+		case <-ticker.C:
+			_ = broadcast()
+		case <-deadline.C:
+			return nil, nil
+		}
+	}
+}
+
+// waitChunk returns the chunk of index received before timeout, the responses of other chunks are dropped
+func (s *stateSnapshotSyncer) waitChunk(height uint64, index int, timeout time.Duration) []byte {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case resp := <-s.chunks:
+			if resp.BlockHeight == height && resp.Index == index {
+				return resp.Chunk
+			}
+		case <-timer.C:
+			return nil
+		}
+	}
+}
+
+// fetchStateSnapshotChunk requests the chunk of index from the peers in turn until a valid one is received
+func (sync *BlockChainSyncServer) fetchStateSnapshotChunk(manifest *utils.StateSnapshotManifest, peers []string,
+	index int) ([]byte, error) {
+	req, err := json.Marshal(&stateSnapshotChunk{BlockHeight: manifest.BlockHeight, Index: index})
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < len(peers)*stateSnapshotChunkRetries; i++ {
+		peer := peers[(index+i)%len(peers)]
+		if err = sync.sendMsg(stateSnapshotChunkReq, req, peer); err != nil {
+			continue
+		}
+		chunk := sync.snapshot.waitChunk(manifest.BlockHeight, index, sync.conf.timeOut)
+		if chunk == nil {
+			sync.log.Warnf("request chunk %d of state snapshot from node[%s] timeout", index, peer)
+			continue
+		}
+		if err = manifest.VerifyChunk(index, chunk); err != nil {
+			sync.log.Warnf("invalid chunk from node[%s]: %s", peer, err)
+			continue
+		}
+		return chunk, nil
+	}
+	return nil, fmt.Errorf("fail to fetch chunk %d of state snapshot from %v", index, peers)
+}
+
+func (sync *BlockChainSyncServer) handleStateSnapshotManifestReq(from string) error {
+	store, ok := sync.blockChainStore.(stateSnapshotStore)
+	// the light node keeps the headers only, it has no states to serve
+	if !ok || sync.light != nil {
+		return nil
+	}
+	manifest, err := store.GetStateSnapshotManifest()
+	if err != nil || manifest == nil {
+		return err
+	}
+	bz, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	return sync.sendMsg(stateSnapshotManifestResp, bz, from)
+}
+
+func (sync *BlockChainSyncServer) handleStateSnapshotChunkReq(syncMsg *syncPb.SyncMsg, from string) error {
+	store, ok := sync.blockChainStore.(stateSnapshotStore)
+	if !ok || sync.light != nil {
+		return nil
+	}
+	var req stateSnapshotChunk
+	if err := json.Unmarshal(syncMsg.Payload, &req); err != nil {
+		return err
+	}
+	chunk, err := store.GetStateSnapshotChunk(req.BlockHeight, req.Index)
+	if err != nil {
+		return err
+	}
+	req.Chunk = chunk
+	bz, err := json.Marshal(&req)
+	if err != nil {
+		return err
+	}
+	return sync.sendMsg(stateSnapshotChunkResp, bz, from)
+}
+
+// handleStateSnapshotResp passes the response to the syncing snapshot, the response is dropped if the node is not
+// syncing the snapshot or too many responses are pending
+func (sync *BlockChainSyncServer) handleStateSnapshotResp(syncMsg *syncPb.SyncMsg, from string) error {
+	if sync.snapshot == nil {
+		return nil
+	}
+	if syncMsg.Type == stateSnapshotManifestResp {
+		var manifest utils.StateSnapshotManifest
+		if err := json.Unmarshal(syncMsg.Payload, &manifest); err != nil {
+			return err
+		}
+		if manifest.ChainId != sync.chainId {
+			return fmt.Errorf("state snapshot of chain %s from node[%s]", manifest.ChainId, from)
+		}
+		select {
+		case sync.snapshot.manifests <- &peerStateSnapshotManifest{from: from, manifest: &manifest}:
+		default:
+		}
+		return nil
+	}
+	var chunk stateSnapshotChunk
+	if err := json.Unmarshal(syncMsg.Payload, &chunk); err != nil {
+		return err
+	}
+	select {
+	case sync.snapshot.chunks <- &chunk:
+	default:
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package sync
+
+import (
+	"encoding/json"
+	"testing"
+
+	"chainmaker.org/chainmaker-go/utils"
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	netPb "chainmaker.org/chainmaker/pb-go/v2/net"
+	storePb "chainmaker.org/chainmaker/pb-go/v2/store"
+	syncPb "chainmaker.org/chainmaker/pb-go/v2/sync"
+	"chainmaker.org/chainmaker/protocol/v2"
+	"github.com/golang/mock/gomock"
+	"github.com/golang/protobuf/proto"
+	"github.com/stretchr/testify/require"
+)
+
+type mockStateSnapshotStore struct {
+	protocol.BlockchainStore
+	manifest *utils.StateSnapshotManifest
+	chunks   [][]byte
+}
+
+func (m *mockStateSnapshotStore) GetStateSnapshotManifest() (*utils.StateSnapshotManifest, error) {
+	return m.manifest, nil
+}
+
+func (m *mockStateSnapshotStore) GetStateSnapshotChunk(height uint64, index int) ([]byte, error) {
+	return m.chunks[index], nil
+}
+
+func (m *mockStateSnapshotStore) InstallStateSnapshot(manifest *utils.StateSnapshotManifest,
+	getChunk func(index int) ([]byte, error), verifyBlock func(block *commonPb.Block) error) error {
+	block, _, err := manifest.GetBlocks()
+	if err != nil {
+		return err
+	}
+	if err = verifyBlock(block.Block); err != nil {
+		return err
+	}
+	for i := range manifest.ChunkHashes {
+		chunk, err := getChunk(i)
+		if err != nil {
+			return err
+		}
+		m.chunks = append(m.chunks, chunk)
+	}
+	m.manifest = manifest
+	return nil
+}
+
+func newTestStateSnapshot(t *testing.T, height uint64) (*utils.StateSnapshotManifest, []byte) {
+	chunk, chunkHash, err := utils.EncodeStateSnapshotChunk([]*commonPb.TxWrite{
+		{ContractName: "c", Key: []byte("k"), Value: []byte("v")},
+	})
+	require.NoError(t, err)
+	block := newLightBlock(height)
+	block.Header.ChainId = "chain1"
+	blockBytes, err := proto.Marshal(&storePb.BlockWithRWSet{Block: block})
+	require.NoError(t, err)
+	configBlock, _ := newConfigBlock(t, 0)
+	configBlock.Header.ChainId = "chain1"
+	configBlockBytes, err := proto.Marshal(&storePb.BlockWithRWSet{Block: configBlock})
+	require.NoError(t, err)
+	return &utils.StateSnapshotManifest{
+		ChainId:     "chain1",
+		BlockHeight: height,
+		BlockHash:   block.Header.BlockHash,
+		Block:       blockBytes,
+		ConfigBlock: configBlockBytes,
+		ChunkHashes: [][]byte{chunkHash},
+	}, chunk
+}
+
+func getStateSnapshotResp(t *testing.T, msgType syncPb.SyncMsg_MsgType, payload interface{}) []byte {
+	bz, err := json.Marshal(payload)
+	require.NoError(t, err)
+	bz, err = proto.Marshal(&syncPb.SyncMsg{Type: msgType, Payload: bz})
+	require.NoError(t, err)
+	return bz
+}
+
+func TestStateSnapshotSyncer_FetchManifest(t *testing.T) {
+	manifest5, _ := newTestStateSnapshot(t, 5)
+	manifest6, _ := newTestStateSnapshot(t, 6)
+	broadcast := func() error { return nil }
+
+	// the manifest is accepted when it is served by enough peers
+	s := &stateSnapshotSyncer{minPeers: 2, manifests: make(chan *peerStateSnapshotManifest, 8)}
+	s.manifests <- &peerStateSnapshotManifest{from: "node1", manifest: manifest6}
+	s.manifests <- &peerStateSnapshotManifest{from: "node2", manifest: manifest5}
+	s.manifests <- &peerStateSnapshotManifest{from: "node1", manifest: manifest6}
+	s.manifests <- &peerStateSnapshotManifest{from: "node3", manifest: manifest5}
+	manifest, peers := s.fetchManifest(broadcast)
+	require.EqualValues(t, 5, manifest.BlockHeight)
+	require.ElementsMatch(t, []string{"node2", "node3"}, peers)
+
+	// the manifest of the trusted hash is accepted from one peer
+	s = &stateSnapshotSyncer{trustedHash: manifest6.BlockHash, minPeers: 2,
+		manifests: make(chan *peerStateSnapshotManifest, 8)}
+	s.manifests <- &peerStateSnapshotManifest{from: "node2", manifest: manifest5}
+	s.manifests <- &peerStateSnapshotManifest{from: "node1", manifest: manifest6}
+	manifest, peers = s.fetchManifest(broadcast)
+	require.EqualValues(t, 6, manifest.BlockHeight)
+	require.Equal(t, []string{"node1"}, peers)
+}
+
+func TestBlockChainSyncServer_SyncStateSnapshot(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	manifest, chunk := newTestStateSnapshot(t, 5)
+	store := &mockStateSnapshotStore{BlockchainStore: newMockBlockChainStore(ctrl)}
+	ledger := newMockLedgerCache(ctrl, &commonPb.Block{Header: &commonPb.BlockHeader{BlockHeight: 0}})
+	sync := NewBlockChainSyncServer("chain1", newMockNet(ctrl), newMockMessageBus(ctrl), store, ledger,
+		newMockVerifier(ctrl), newMockCommitter(ctrl, ledger)).(*BlockChainSyncServer)
+	var installed *commonPb.Block
+	var verified *commonPb.Block
+	sync.EnableStateSnapshotSync(nil, 1, func(block *commonPb.Block) error {
+		verified = block
+		return nil
+	}, func(block, configBlock *commonPb.Block) error {
+		installed = block
+		return nil
+	})
+	sync.initSyncConfIfRequire()
+	sync.start = 1
+
+	// the responses are passed to the syncing snapshot, the invalid chunk is dropped by the hash
+	require.NoError(t, sync.blockSyncMsgHandler("node1",
+		getStateSnapshotResp(t, stateSnapshotManifestResp, manifest), netPb.NetMsg_SYNC_BLOCK_MSG))
+	require.NoError(t, sync.blockSyncMsgHandler("node1", getStateSnapshotResp(t, stateSnapshotChunkResp,
+		&stateSnapshotChunk{BlockHeight: 5, Index: 0, Chunk: append(chunk, 0)}), netPb.NetMsg_SYNC_BLOCK_MSG))
+	require.NoError(t, sync.blockSyncMsgHandler("node1", getStateSnapshotResp(t, stateSnapshotChunkResp,
+		&stateSnapshotChunk{BlockHeight: 5, Index: 0, Chunk: chunk}), netPb.NetMsg_SYNC_BLOCK_MSG))
+
+	height, err := sync.syncStateSnapshot()
+	require.NoError(t, err)
+	require.EqualValues(t, 5, height)
+	require.Equal(t, [][]byte{chunk}, store.chunks)
+	require.EqualValues(t, 5, verified.Header.BlockHeight)
+	require.EqualValues(t, 5, installed.Header.BlockHeight)
+	currHeight, err := ledger.CurrentHeight()
+	require.NoError(t, err)
+	require.EqualValues(t, 5, currHeight)
+
+	// the node serves the installed snapshot
+	require.NoError(t, sync.blockSyncMsgHandler("node2", getStateSnapshotResp(t, stateSnapshotChunkReq,
+		&stateSnapshotChunk{BlockHeight: 5, Index: 0}), netPb.NetMsg_SYNC_BLOCK_MSG))
+	require.NoError(t, sync.handleStateSnapshotManifestReq("node2"))
+
+	// the snapshot is installed on the new node only
+	height, err = sync.syncStateSnapshot()
+	require.NoError(t, err)
+	require.EqualValues(t, 5, height)
+}
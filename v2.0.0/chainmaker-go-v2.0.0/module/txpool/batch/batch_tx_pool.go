@@ -15,6 +15,7 @@ import (
 	"time"
 
 	"chainmaker.org/chainmaker-go/txpool/poolconf"
+	"chainmaker.org/chainmaker-go/txpool/poolwal"
 	"chainmaker.org/chainmaker-go/utils"
 	commonErrors "chainmaker.org/chainmaker/common/v2/errors"
 	"chainmaker.org/chainmaker/common/v2/msgbus"
@@ -56,6 +57,7 @@ type BatchTxPool struct {
 	log        protocol.Logger                //
 	chainConf  protocol.ChainConf             //
 	chainStore protocol.BlockchainStore       // Access information on the chain
+	txWal      *poolwal.TxWal                 // Persist the txs in the pool, nil if persistence is disabled
 
 	fetchLock sync.Mutex    // The protection of the FETCH function allows only one FETCH at a time
 	stopCh    chan struct{} // Signal notification of service exit
@@ -106,6 +108,12 @@ func (p *BatchTxPool) Start() error {
 	}
 	p.txQueue = lockfreequeue.NewQueue(uint32(p.maxTxCount))
 	p.cfgTxQueue = lockfreequeue.NewQueue(uint32(10))
+	if poolconf.IsPersist() {
+		if err := p.replayTxWal(); err != nil {
+			atomic.StoreInt32(&p.stat, 0)
+			return err
+		}
+	}
 	if p.mb != nil {
 		p.mb.Register(msgbus.RecvTxPoolMsg, p)
 	}
@@ -113,14 +121,73 @@ func (p *BatchTxPool) Start() error {
 	return nil
 }
 
+// replayTxWal open the tx wal and push the txs which are not confirmed before the node stopped to the queues
+func (p *BatchTxPool) replayTxWal() error {
+	txWal, err := poolwal.Open(poolconf.PersistDir(p.chainId), p.log)
+	if err != nil {
+		return err
+	}
+	txs, err := txWal.Replay(p.chainStore)
+	if err != nil {
+		_ = txWal.Close()
+		return fmt.Errorf("replay tx wal failed, %s", err.Error())
+	}
+	p.txWal = txWal
+	dropped := make([]*commonPb.Transaction, 0)
+	for _, tx := range txs {
+		queue := p.txQueue
+		if utils.IsConfigTx(tx) {
+			queue = p.cfgTxQueue
+		}
+		if ok, _ := queue.Push(tx); !ok {
+			p.log.Warnf("push replayed tx failed because queue is full, txId: %s", tx.Payload.GetTxId())
+			dropped = append(dropped, tx)
+			continue
+		}
+		atomic.AddInt32(&p.currentTxCount, 1)
+	}
+	p.unpersistTxs(dropped)
+	p.log.Infof("replay txs from tx wal, txs num: %d", len(txs))
+	return nil
+}
+
 func (p *BatchTxPool) Stop() error {
 	if !atomic.CompareAndSwapInt32(&p.stat, 1, 0) {
 		return commonErrors.ErrTxPoolHasStopped
 	}
 	close(p.stopCh)
+	if p.txWal != nil {
+		if err := p.txWal.Close(); err != nil {
+			p.log.Errorf("close tx wal failed, %s", err.Error())
+		}
+	}
 	return nil
 }
 
+// persistTxs records the txs accepted by the pool if persistence is enabled
+func (p *BatchTxPool) persistTxs(txs []*commonPb.Transaction) error {
+	if p.txWal == nil {
+		return nil
+	}
+	return p.txWal.AddTxs(txs)
+}
+
+// dropTxs drops the txs pulled from the queues which are not put to a batch pool
+func (p *BatchTxPool) dropTxs(txs []*commonPb.Transaction) {
+	atomic.AddInt32(&p.currentTxCount, -int32(len(txs)))
+	p.unpersistTxs(txs)
+}
+
+// unpersistTxs removes the txs removed or dropped by the pool from the tx wal if persistence is enabled
+func (p *BatchTxPool) unpersistTxs(txs []*commonPb.Transaction) {
+	if p.txWal == nil || len(txs) == 0 {
+		return
+	}
+	if err := p.txWal.RemoveTxs(txs); err != nil {
+		p.log.Errorf("persist removed txs failed, %s", err.Error())
+	}
+}
+
 func (p *BatchTxPool) AddTx(tx *commonPb.Transaction, src protocol.TxSource) error {
 	if atomic.LoadInt32(&p.stat) == 0 {
 		return errors.New("batch tx pool not started")
@@ -131,9 +198,14 @@ func (p *BatchTxPool) AddTx(tx *commonPb.Transaction, src protocol.TxSource) err
 	if err := p.validate(tx, src); err != nil {
 		return err
 	}
-	// 1. push tx to config queue
+	if err := p.persistTxs([]*commonPb.Transaction{tx}); err != nil {
+		p.log.Errorf("persist tx failed, txId: %s, err: %s", tx.Payload.GetTxId(), err.Error())
+		return err
+	}
+	// 1. push tx to config queue, the tx rejected is removed from the wal
 	if utils.IsConfigTx(tx) {
 		if ok, _ := p.cfgTxQueue.Push(tx); !ok {
+			p.unpersistTxs([]*commonPb.Transaction{tx})
 			return errors.New("push cfg tx to cfg queue failed because queue is full")
 		}
 		atomic.AddInt32(&p.currentTxCount, 1)
@@ -142,6 +214,7 @@ func (p *BatchTxPool) AddTx(tx *commonPb.Transaction, src protocol.TxSource) err
 
 	// 2. push tx to common queue
 	if ok, _ := p.txQueue.Push(tx); !ok {
+		p.unpersistTxs([]*commonPb.Transaction{tx})
 		return errors.New("push tx to tx queue failed because queue is full")
 	}
 	atomic.AddInt32(&p.currentTxCount, 1)
@@ -182,11 +255,13 @@ func (p *BatchTxPool) createConfigTxBatch() {
 	batchMsg, err := proto.Marshal(batch)
 	if err != nil {
 		p.log.Errorf("marshal batch failed, %s", err.Error())
+		p.dropTxs(batch.Txs)
 		return
 	}
 	// put batch to cfg batch pool
 	if !p.configBatchPool.PutIfNotExist(batch) {
 		p.log.Errorf("put cfg batch to config batch pool failed")
+		p.dropTxs(batch.Txs)
 		return
 	}
 	p.batchTxIdRecorder.AddRecordWithBatch(batch)
@@ -251,12 +326,14 @@ func (p *BatchTxPool) createCommonTxBatch() {
 	)
 	if batchMsg, err = proto.Marshal(batch); err != nil {
 		p.log.Errorf("marshal batch failed, %s", err.Error())
+		p.dropTxs(batch.Txs)
 		return
 	}
 
 	// put batch to normal batch pool
 	if !p.commonBatchPool.PutIfNotExist(batch) {
 		p.log.Errorf("put batch to normal batch pool failed")
+		p.dropTxs(batch.Txs)
 		return
 	}
 	p.batchTxIdRecorder.AddRecordWithBatch(batch)
@@ -446,6 +523,9 @@ func (p *BatchTxPool) retryTxBatch(txs []*commonPb.Transaction) {
 		TxIdsMap: createTxIdsMap(txs),
 		BatchId:  atomic.AddInt32(&p.currentBatchId, 1),
 	}
+	if err := p.persistTxs(txs); err != nil {
+		p.log.Errorf("persist retry txs failed, %s", err.Error())
+	}
 	p.batchTxIdRecorder.AddRecordWithBatch(batch)
 	if utils.IsConfigTx(txs[0]) {
 		p.configBatchPool.PutIfNotExist(batch)
@@ -498,6 +578,7 @@ func (p *BatchTxPool) removeTxBatch(txs []*commonPb.Transaction) {
 		atomic.AddInt32(&p.currentTxCount, 0-batch.GetSize_())
 		p.log.Infof("current txs num: %d", atomic.LoadInt32(&p.currentTxCount))
 		p.batchTxIdRecorder.RemoveRecordWithBatch(batch)
+		p.unpersistTxs(txs)
 	} else {
 		p.log.Errorf("remove batch failed, batch(batch id:%d) not found in all batch pool", batchId)
 	}
@@ -565,6 +646,9 @@ func (p *BatchTxPool) addTxBatch(batch *txpoolPb.TxBatch) error {
 	if atomic.LoadInt32(&p.currentTxCount) >= p.maxTxCount {
 		return errors.New("batch tx pool is full")
 	}
+	if err := p.persistTxs(batch.Txs); err != nil {
+		return fmt.Errorf("persist batch failed, %s", err.Error())
+	}
 	batch.NodeId = p.nodeId
 	batch.BatchId = atomic.AddInt32(&p.currentBatchId, 1)
 	p.batchTxIdRecorder.AddRecordWithBatch(batch)
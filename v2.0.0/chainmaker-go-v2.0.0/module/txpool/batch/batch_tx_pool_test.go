@@ -10,9 +10,12 @@ import (
 	"testing"
 	"time"
 
+	"chainmaker.org/chainmaker-go/txpool/poolwal"
 	"chainmaker.org/chainmaker-go/utils"
 	"chainmaker.org/chainmaker/common/v2/queue/lockfreequeue"
 	commonpb "chainmaker.org/chainmaker/pb-go/v2/common"
+	"chainmaker.org/chainmaker/protocol/v2"
+	"chainmaker.org/chainmaker/protocol/v2/test"
 
 	"github.com/stretchr/testify/require"
 )
@@ -32,3 +35,48 @@ func TestBatchTxPool_PopTxsFromQueue(t *testing.T) {
 		}
 	}
 }
+
+func TestBatchTxPool_PersistTxs(t *testing.T) {
+	log := &test.GoLogger{}
+	dir := t.TempDir()
+	txWal, err := poolwal.Open(dir, log)
+	require.NoError(t, err)
+	pool := NewBatchTxPool("nodeId", "test-chain", nil, nil, nil, log)
+	pool.stat = 1
+	pool.txWal = txWal
+	pool.txQueue = lockfreequeue.NewQueue(4)
+	pool.cfgTxQueue = lockfreequeue.NewQueue(4)
+
+	// the txs rejected because the queue is full are not kept in the wal
+	var accepted, rejected []string
+	for i := 0; i < 20; i++ {
+		tx := &commonpb.Transaction{Payload: &commonpb.Payload{TxId: utils.GetRandTxId(),
+			Timestamp: utils.CurrentTimeSeconds()}}
+		if err = pool.AddTx(tx, protocol.RPC); err != nil {
+			rejected = append(rejected, tx.Payload.TxId)
+		} else {
+			accepted = append(accepted, tx.Payload.TxId)
+		}
+	}
+	require.NotEmpty(t, accepted)
+	require.NotEmpty(t, rejected)
+
+	// the txs dropped from the batch are removed from the wal
+	txs, _ := pool.popTxsFromQueue()
+	require.Len(t, txs, len(accepted))
+	pool.dropTxs(txs[:1])
+	require.EqualValues(t, len(accepted)-1, pool.currentTxCount)
+	require.NoError(t, txWal.Close())
+
+	txWal, err = poolwal.Open(dir, log)
+	require.NoError(t, err)
+	defer txWal.Close()
+	replayTxs, err := txWal.Replay(nil)
+	require.NoError(t, err)
+	replayTxIds := make([]string, 0, len(replayTxs))
+	for _, tx := range replayTxs {
+		replayTxIds = append(replayTxIds, tx.Payload.TxId)
+	}
+	require.ElementsMatch(t, accepted[1:], replayTxIds)
+	require.NotContains(t, replayTxIds, txs[0].Payload.TxId)
+}
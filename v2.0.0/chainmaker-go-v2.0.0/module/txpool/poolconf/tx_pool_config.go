@@ -6,6 +6,8 @@ SPDX-License-Identifier: Apache-2.0
 package poolconf
 
 import (
+	"path/filepath"
+
 	"chainmaker.org/chainmaker-go/localconf"
 	"chainmaker.org/chainmaker/protocol/v2"
 )
@@ -15,6 +17,8 @@ const (
 	DefaultMaxTxPoolSize       = 5120         // Maximum number of common transaction in the pool
 	DefaultMaxConfigTxPoolSize = 100          // Maximum number of config transaction in the pool
 	DefaultMaxTxTimeTimeout    = float64(600) // The unit is in seconds
+	DefaultPersistDir          = "txpool_wal" // The dir of tx wal under the store path of chain
+	DefaultOrderingPolicy      = "fifo"       // Fetch the txs in the order of arrival
 )
 
 // ===========config in the blockchain============
@@ -75,3 +79,36 @@ func IsMetrics() bool {
 	config := localconf.ChainMakerConfig.TxPoolConfig
 	return config.IsMetrics
 }
+
+// IsPersist Whether to persist the transactions in the pool to the wal
+func IsPersist() bool {
+	config := localconf.ChainMakerConfig.TxPoolConfig
+	return config.EnablePersist
+}
+
+// PersistDir The dir of the tx wal of the chain
+func PersistDir(chainId string) string {
+	config := localconf.ChainMakerConfig.TxPoolConfig
+	if len(config.PersistDir) != 0 {
+		return filepath.Join(config.PersistDir, chainId)
+	}
+	return filepath.Join(localconf.ChainMakerConfig.StorageConfig.StorePath, chainId, DefaultPersistDir)
+}
+
+// OrderingPolicy The policy to order the common txs fetched to the block
+func OrderingPolicy() string {
+	config := localconf.ChainMakerConfig.TxPoolConfig
+	if len(config.OrderingPolicy) != 0 {
+		return config.OrderingPolicy
+	}
+	return DefaultOrderingPolicy
+}
+
+// MaxSenderTxsInBlock Maximum number of transactions of a sender in a block, 0 means no limit
+func MaxSenderTxsInBlock() int {
+	config := localconf.ChainMakerConfig.TxPoolConfig
+	if config.MaxSenderTxsInBlock > 0 {
+		return config.MaxSenderTxsInBlock
+	}
+	return 0
+}
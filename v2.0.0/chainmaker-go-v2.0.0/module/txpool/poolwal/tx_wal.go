@@ -0,0 +1,242 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package poolwal
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"chainmaker.org/chainmaker/common/v2/wal"
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	txpoolPb "chainmaker.org/chainmaker/pb-go/v2/txpool"
+	"chainmaker.org/chainmaker/protocol/v2"
+	"github.com/gogo/protobuf/proto"
+)
+
+const (
+	entryAddTxs    byte = 1 // the entry records the txs accepted by the pool
+	entryRemoveTxs byte = 2 // the entry records the ids of the txs removed from the pool
+
+	// DefaultCompactThreshold the wal is truncated after so many txs are removed
+	DefaultCompactThreshold = 10000
+)
+
+// TxWal records the txs accepted by the tx pool and the txs removed from it,
+// so that the unconfirmed txs can be restored after the node restarts.
+type TxWal struct {
+	lock sync.Mutex
+	wal  *wal.Log
+	log  protocol.Logger
+
+	liveTxs          map[string]uint64 // the txs not removed yet, txId -> index of the entry which adds it
+	removedCount     int               // the number of txs removed since the last compaction
+	compactThreshold int
+}
+
+// Open the tx wal in the dir
+func Open(dir string, log protocol.Logger) (*TxWal, error) {
+	l, err := wal.Open(dir, nil)
+	if err != nil {
+		return nil, fmt.Errorf("open tx wal in %s failed, %s", dir, err.Error())
+	}
+	return &TxWal{
+		wal:              l,
+		log:              log,
+		liveTxs:          make(map[string]uint64),
+		compactThreshold: DefaultCompactThreshold,
+	}, nil
+}
+
+// AddTxs records the txs accepted by the pool, the txs which are recorded already are ignored
+func (w *TxWal) AddTxs(txs []*commonPb.Transaction) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	newTxs := make([]*commonPb.Transaction, 0, len(txs))
+	for _, tx := range txs {
+		if _, ok := w.liveTxs[tx.Payload.TxId]; !ok {
+			newTxs = append(newTxs, tx)
+		}
+	}
+	if len(newTxs) == 0 {
+		return nil
+	}
+	index, err := w.write(entryAddTxs, &txpoolPb.TxBatch{Txs: newTxs, Size_: int32(len(newTxs))})
+	if err != nil {
+		return err
+	}
+	for _, tx := range newTxs {
+		w.liveTxs[tx.Payload.TxId] = index
+	}
+	return nil
+}
+
+// RemoveTxs records the txs removed from the pool, the txs which are not recorded are ignored
+func (w *TxWal) RemoveTxs(txs []*commonPb.Transaction) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	txIds := make(map[string]int32, len(txs))
+	for idx, tx := range txs {
+		if _, ok := w.liveTxs[tx.Payload.TxId]; ok {
+			txIds[tx.Payload.TxId] = int32(idx)
+		}
+	}
+	if len(txIds) == 0 {
+		return nil
+	}
+	if _, err := w.write(entryRemoveTxs, &txpoolPb.TxBatch{TxIdsMap: txIds, Size_: int32(len(txIds))}); err != nil {
+		return err
+	}
+	for txId := range txIds {
+		delete(w.liveTxs, txId)
+	}
+	w.removedCount += len(txIds)
+	if w.removedCount >= w.compactThreshold {
+		w.removedCount = 0
+		if err := w.compact(); err != nil {
+			w.log.Warnf("compact tx wal failed, %s", err.Error())
+		}
+	}
+	return nil
+}
+
+// Replay returns the txs which are accepted and not removed in the order they are added,
+// the txs which are in the blockchainStore already are skipped.
+// The wal is rewritten with the returned txs only, so it should be called once before any other writing.
+func (w *TxWal) Replay(blockchainStore protocol.BlockchainStore) ([]*commonPb.Transaction, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	firstIndex, err := w.wal.FirstIndex()
+	if err != nil {
+		return nil, err
+	}
+	lastIndex, err := w.wal.LastIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		order = make([]*commonPb.Transaction, 0)
+		live  = make(map[string]int) // txId -> the position in order of the tx not removed
+	)
+	for i := firstIndex; i <= lastIndex && lastIndex > 0; i++ {
+		entryType, batch, err := w.read(i)
+		if err != nil {
+			return nil, err
+		}
+		switch entryType {
+		case entryAddTxs:
+			for _, tx := range batch.Txs {
+				if _, ok := live[tx.Payload.TxId]; !ok {
+					live[tx.Payload.TxId] = len(order)
+					order = append(order, tx)
+				}
+			}
+		case entryRemoveTxs:
+			for txId := range batch.TxIdsMap {
+				delete(live, txId)
+			}
+		default:
+			return nil, fmt.Errorf("unknown tx wal entry type %d at index %d", entryType, i)
+		}
+	}
+
+	replayTxs := make([]*commonPb.Transaction, 0, len(live))
+	for pos, tx := range order {
+		// the tx which is removed and added again is in order twice, the latest one is kept
+		if livePos, ok := live[tx.Payload.TxId]; !ok || livePos != pos {
+			continue
+		}
+		if blockchainStore != nil {
+			if exist, _ := blockchainStore.TxExists(tx.Payload.TxId); exist {
+				continue
+			}
+		}
+		replayTxs = append(replayTxs, tx)
+	}
+	w.log.Infof("replay tx wal from index %d to %d, txs num: %d", firstIndex, lastIndex, len(replayTxs))
+
+	if lastIndex == 0 {
+		return replayTxs, nil
+	}
+	// rewrite the wal with the txs replayed only
+	w.liveTxs = make(map[string]uint64, len(replayTxs))
+	if len(replayTxs) == 0 {
+		return replayTxs, w.wal.TruncateFront(lastIndex)
+	}
+	index, err := w.write(entryAddTxs, &txpoolPb.TxBatch{Txs: replayTxs, Size_: int32(len(replayTxs))})
+	if err != nil {
+		return nil, err
+	}
+	for _, tx := range replayTxs {
+		w.liveTxs[tx.Payload.TxId] = index
+	}
+	return replayTxs, w.wal.TruncateFront(index)
+}
+
+// Close the tx wal
+func (w *TxWal) Close() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.wal.Close()
+}
+
+// compact truncates the entries before the first entry which contains any live tx
+func (w *TxWal) compact() error {
+	lastIndex, err := w.wal.LastIndex()
+	if err != nil {
+		return err
+	}
+	firstLive := lastIndex
+	for _, index := range w.liveTxs {
+		if index < firstLive {
+			firstLive = index
+		}
+	}
+	firstIndex, err := w.wal.FirstIndex()
+	if err != nil {
+		return err
+	}
+	if firstLive <= firstIndex {
+		return nil
+	}
+	w.log.Debugf("compact tx wal from index %d to %d", firstIndex, firstLive)
+	return w.wal.TruncateFront(firstLive)
+}
+
+func (w *TxWal) write(entryType byte, batch *txpoolPb.TxBatch) (uint64, error) {
+	data, err := proto.Marshal(batch)
+	if err != nil {
+		return 0, err
+	}
+	lastIndex, err := w.wal.LastIndex()
+	if err != nil {
+		return 0, err
+	}
+	entry := make([]byte, 0, len(data)+1)
+	entry = append(entry, entryType)
+	entry = append(entry, data...)
+	if err = w.wal.Write(lastIndex+1, entry); err != nil {
+		return 0, err
+	}
+	return lastIndex + 1, nil
+}
+
+func (w *TxWal) read(index uint64) (byte, *txpoolPb.TxBatch, error) {
+	entry, err := w.wal.Read(index)
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(entry) == 0 {
+		return 0, nil, errors.New("empty tx wal entry")
+	}
+	batch := &txpoolPb.TxBatch{}
+	if err = proto.Unmarshal(entry[1:], batch); err != nil {
+		return 0, nil, err
+	}
+	return entry[0], batch, nil
+}
@@ -0,0 +1,113 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package poolwal
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"chainmaker.org/chainmaker-go/utils"
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	"chainmaker.org/chainmaker/protocol/v2/mock"
+	"chainmaker.org/chainmaker/protocol/v2/test"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+var log = &test.GoLogger{}
+
+func generateTxs(num int) []*commonPb.Transaction {
+	txs := make([]*commonPb.Transaction, 0, num)
+	for i := 0; i < num; i++ {
+		txs = append(txs, &commonPb.Transaction{
+			Payload: &commonPb.Payload{TxId: utils.GetRandTxId(), TxType: commonPb.TxType_INVOKE_CONTRACT,
+				Method: "save", ContractName: "userContract1"},
+		})
+	}
+	return txs
+}
+
+func getTxIds(txs []*commonPb.Transaction) []string {
+	txIds := make([]string, 0, len(txs))
+	for _, tx := range txs {
+		txIds = append(txIds, tx.Payload.TxId)
+	}
+	return txIds
+}
+
+func TestTxWal_Replay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "txpool_wal")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	txs := generateTxs(10)
+	txWal, err := Open(dir, log)
+	require.NoError(t, err)
+	replayTxs, err := txWal.Replay(nil)
+	require.NoError(t, err)
+	require.Empty(t, replayTxs)
+
+	require.NoError(t, txWal.AddTxs(txs[:5]))
+	require.NoError(t, txWal.AddTxs(txs[3:]))
+	require.NoError(t, txWal.RemoveTxs(txs[:2]))
+	// the removed tx can be added again
+	require.NoError(t, txWal.AddTxs(txs[:1]))
+	require.NoError(t, txWal.Close())
+
+	// txs[9] is confirmed in block already
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	store := mock.NewMockBlockchainStore(ctrl)
+	store.EXPECT().TxExists(gomock.Any()).DoAndReturn(func(txId string) (bool, error) {
+		return txId == txs[9].Payload.TxId, nil
+	}).AnyTimes()
+
+	txWal, err = Open(dir, log)
+	require.NoError(t, err)
+	replayTxs, err = txWal.Replay(store)
+	require.NoError(t, err)
+	expected := append(append([]*commonPb.Transaction{}, txs[2:9]...), txs[0])
+	require.Equal(t, getTxIds(expected), getTxIds(replayTxs))
+	require.NoError(t, txWal.RemoveTxs(txs[2:5]))
+	require.NoError(t, txWal.Close())
+
+	// the wal is rewritten by the last replay
+	txWal, err = Open(dir, log)
+	require.NoError(t, err)
+	replayTxs, err = txWal.Replay(nil)
+	require.NoError(t, err)
+	expected = append(append([]*commonPb.Transaction{}, txs[5:9]...), txs[0])
+	require.Equal(t, getTxIds(expected), getTxIds(replayTxs))
+	require.NoError(t, txWal.Close())
+}
+
+func TestTxWal_Compact(t *testing.T) {
+	dir, err := ioutil.TempDir("", "txpool_wal")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	txWal, err := Open(dir, log)
+	require.NoError(t, err)
+	txWal.compactThreshold = 5
+	txs := generateTxs(20)
+	for _, tx := range txs {
+		require.NoError(t, txWal.AddTxs([]*commonPb.Transaction{tx}))
+	}
+	require.NoError(t, txWal.RemoveTxs(txs[:6]))
+	firstIndex, err := txWal.wal.FirstIndex()
+	require.NoError(t, err)
+	require.Equal(t, uint64(7), firstIndex)
+
+	require.NoError(t, txWal.Close())
+	txWal, err = Open(dir, log)
+	require.NoError(t, err)
+	replayTxs, err := txWal.Replay(nil)
+	require.NoError(t, err)
+	require.Equal(t, getTxIds(txs[6:]), getTxIds(replayTxs))
+	require.NoError(t, txWal.Close())
+}
@@ -0,0 +1,162 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package single
+
+import (
+	"errors"
+	"sync"
+
+	"chainmaker.org/chainmaker-go/utils"
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+)
+
+// nonceTracker records the highest nonce of each sender fetched to the blocks which are not committed,
+// the txs of the sender are fetched from the next nonce of max(nonce in state, fetched nonce).
+type nonceTracker struct {
+	lock    sync.Mutex
+	fetched map[string]uint64
+}
+
+func newNonceTracker() *nonceTracker {
+	return &nonceTracker{fetched: make(map[string]uint64)}
+}
+
+func (t *nonceTracker) get(account string) uint64 {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.fetched[account]
+}
+
+func (t *nonceTracker) set(account string, nonce uint64) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if nonce > t.fetched[account] {
+		t.fetched[account] = nonce
+	}
+}
+
+// reset forgets the fetched nonces from the nonce of the retried tx, they may be fetched again, nonce 0 means
+// no tx is retried. The account is deleted once the nonce in state catches up with the fetched nonce, otherwise
+// it keeps the nonces fetched to the blocks in flight.
+func (t *nonceTracker) reset(account string, nonce uint64, stateNonce uint64) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	fetched, ok := t.fetched[account]
+	if !ok {
+		return
+	}
+	if nonce > 0 && fetched >= nonce {
+		fetched = nonce - 1
+	}
+	if fetched <= stateNonce {
+		delete(t.fetched, account)
+		return
+	}
+	t.fetched[account] = fetched
+}
+
+// readTxNonce read the nonce of the sender in the latest committed state
+func (pool *txPoolImpl) readTxNonce(account string) (uint64, error) {
+	value, err := pool.blockchainStore.ReadObject(utils.TxNonceContractName, utils.TxNonceKey(account))
+	if err != nil {
+		return 0, err
+	}
+	return utils.DecodeTxNonce(value)
+}
+
+// validateTxNonce reject the tx whose nonce has been used, the tx with a nonce gap is accepted and waits
+// in the pool for the txs of lower nonce
+func (pool *txPoolImpl) validateTxNonce(tx *commonPb.Transaction) error {
+	chainConfig := pool.chainConf.ChainConfig()
+	if !utils.IsTxNonceEnabled(chainConfig) || !utils.IsNonceTx(tx) {
+		return nil
+	}
+	account, err := utils.TxNonceAccount(tx, chainConfig.Crypto.Hash)
+	if err != nil {
+		return err
+	}
+	nonce, err := pool.readTxNonce(account)
+	if err != nil {
+		return err
+	}
+	if err = utils.CheckTxNonce(tx, nonce); err != nil && !errors.Is(err, utils.ErrTxNonceGap) {
+		return err
+	}
+	return nil
+}
+
+// newFetchValidator returns the validator of the txs fetched to a block. The tx with a nonce gap returns
+// utils.ErrTxNonceGap, it is left in the queue until the txs of lower nonce are fetched.
+func (pool *txPoolImpl) newFetchValidator() func(tx *commonPb.Transaction) error {
+	chainConfig := pool.chainConf.ChainConfig()
+	if !utils.IsTxNonceEnabled(chainConfig) {
+		return pool.validateTxTime
+	}
+	hashType := chainConfig.Crypto.Hash
+	nonces := make(map[string]uint64)
+	return func(tx *commonPb.Transaction) error {
+		if err := pool.validateTxTime(tx); err != nil {
+			return err
+		}
+		if !utils.IsNonceTx(tx) {
+			return nil
+		}
+		account, err := utils.TxNonceAccount(tx, hashType)
+		if err != nil {
+			return err
+		}
+		nonce, ok := nonces[account]
+		if !ok {
+			if nonce, err = pool.readTxNonce(account); err != nil {
+				// the tx is fetched again when the state can be read
+				return utils.ErrTxNonceGap
+			}
+			if fetched := pool.nonces.get(account); fetched > nonce {
+				nonce = fetched
+			}
+		}
+		if err = utils.CheckTxNonce(tx, nonce); err != nil {
+			return err
+		}
+		nonces[account] = tx.Payload.Sequence
+		pool.nonces.set(account, tx.Payload.Sequence)
+		return nil
+	}
+}
+
+// resetTxNonces forget the fetched nonces of the txs which are retried or removed, the removed txs are committed
+// or their nonces have been used, so only the nonces caught up by the state are forgotten.
+func (pool *txPoolImpl) resetTxNonces(txs []*commonPb.Transaction, retry bool) {
+	chainConfig := pool.chainConf.ChainConfig()
+	if !utils.IsTxNonceEnabled(chainConfig) {
+		return
+	}
+	// the lowest nonce retried of each account
+	nonces := make(map[string]uint64)
+	for _, tx := range txs {
+		if !utils.IsNonceTx(tx) {
+			continue
+		}
+		account, err := utils.TxNonceAccount(tx, chainConfig.Crypto.Hash)
+		if err != nil {
+			continue
+		}
+		nonce, ok := nonces[account]
+		if retry && (!ok || tx.Payload.Sequence < nonce) {
+			nonce = tx.Payload.Sequence
+		}
+		nonces[account] = nonce
+	}
+	for account, nonce := range nonces {
+		stateNonce, err := pool.readTxNonce(account)
+		if err != nil {
+			// the account is kept until the state can be read
+			pool.log.Warnf("read nonce of account[%s] error:%s", account, err)
+		}
+		pool.nonces.reset(account, nonce, stateNonce)
+	}
+}
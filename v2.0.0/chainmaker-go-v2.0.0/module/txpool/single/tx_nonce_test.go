@@ -0,0 +1,154 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package single
+
+import (
+	"errors"
+	"testing"
+
+	"chainmaker.org/chainmaker-go/chainconf"
+	"chainmaker.org/chainmaker-go/logger"
+	"chainmaker.org/chainmaker-go/utils"
+	acPb "chainmaker.org/chainmaker/pb-go/v2/accesscontrol"
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	configPb "chainmaker.org/chainmaker/pb-go/v2/config"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func generateNonceTx(member string, nonce uint64) *commonPb.Transaction {
+	return &commonPb.Transaction{
+		Payload: &commonPb.Payload{TxId: utils.GetRandTxId(), TxType: commonPb.TxType_INVOKE_CONTRACT,
+			Method: "invoke", ContractName: "contract1", Sequence: nonce},
+		Sender: &commonPb.EndorsementEntry{Signer: &acPb.Member{OrgId: "org1",
+			MemberType: acPb.MemberType_PUBLIC_KEY, MemberInfo: []byte(member)}},
+	}
+}
+
+func newTestNoncePool(t *testing.T, nonces map[string]uint64) (*txPoolImpl, func()) {
+	chainConf, _ := chainconf.NewChainConf(nil)
+	chainConf.ChainConf = &configPb.ChainConfig{
+		Block:    &configPb.BlockConfig{},
+		Contract: &configPb.ContractConfig{},
+		Crypto:   &configPb.CryptoConfig{Hash: "SHA256"},
+		Consensus: &configPb.ConsensusConfig{ExtConfig: []*configPb.ConfigKeyValue{
+			{Key: utils.TxNonceConfigKey, Value: "true"},
+		}},
+	}
+	ctrl := gomock.NewController(t)
+	mockStore := newMockBlockChainStore(ctrl)
+	mockStore.store.EXPECT().ReadObject(utils.TxNonceContractName, gomock.Any()).DoAndReturn(
+		func(contractName string, key []byte) ([]byte, error) {
+			for member, nonce := range nonces {
+				account, _ := utils.TxNonceAccount(generateNonceTx(member, 0), "SHA256")
+				if string(key) == string(utils.TxNonceKey(account)) {
+					return utils.EncodeTxNonce(nonce), nil
+				}
+			}
+			return nil, nil
+		}).AnyTimes()
+	return &txPoolImpl{
+		chainConf:       chainConf,
+		blockchainStore: mockStore.store,
+		nonces:          newNonceTracker(),
+		log:             logger.GetLogger(testListLogName),
+	}, ctrl.Finish
+}
+
+func TestNonceTracker(t *testing.T) {
+	tracker := newNonceTracker()
+	tracker.set("a", 3)
+	tracker.set("a", 2)
+	require.EqualValues(t, 3, tracker.get("a"))
+
+	// the nonces from the retried one are fetched again
+	tracker.reset("a", 4, 0)
+	require.EqualValues(t, 3, tracker.get("a"))
+	tracker.reset("a", 2, 0)
+	require.EqualValues(t, 1, tracker.get("a"))
+	tracker.reset("a", 1, 0)
+	require.EqualValues(t, 0, tracker.get("a"))
+	require.EqualValues(t, 0, len(tracker.fetched))
+
+	// the committed txs keep the nonces in flight above the state
+	tracker.set("a", 5)
+	tracker.reset("a", 0, 3)
+	require.EqualValues(t, 5, tracker.get("a"))
+	tracker.reset("a", 0, 5)
+	require.EqualValues(t, 0, len(tracker.fetched))
+
+	// the account is deleted once the retried nonces are caught up by the state
+	tracker.set("a", 5)
+	tracker.reset("a", 4, 3)
+	require.EqualValues(t, 0, len(tracker.fetched))
+}
+
+func TestTxPoolImpl_ValidateTxNonce(t *testing.T) {
+	pool, fn := newTestNoncePool(t, map[string]uint64{"user1": 5})
+	defer fn()
+
+	require.True(t, errors.Is(pool.validateTxNonce(generateNonceTx("user1", 5)), utils.ErrTxNonceTooLow))
+	require.NoError(t, pool.validateTxNonce(generateNonceTx("user1", 6)))
+	require.NoError(t, pool.validateTxNonce(generateNonceTx("user1", 8)))
+	require.NoError(t, pool.validateTxNonce(generateNonceTx("user2", 1)))
+}
+
+func TestTxPoolImpl_FetchValidator(t *testing.T) {
+	pool, fn := newTestNoncePool(t, map[string]uint64{"user1": 5})
+	defer fn()
+
+	validate := pool.newFetchValidator()
+	require.True(t, errors.Is(validate(generateNonceTx("user1", 7)), utils.ErrTxNonceGap))
+	require.NoError(t, validate(generateNonceTx("user1", 6)))
+	require.NoError(t, validate(generateNonceTx("user1", 7)))
+	require.True(t, errors.Is(validate(generateNonceTx("user1", 7)), utils.ErrTxNonceTooLow))
+	require.EqualValues(t, 7, pool.nonces.get(mustNonceAccount(t, "user1")))
+
+	// the next block continues from the nonces fetched to the uncommitted block
+	validate = pool.newFetchValidator()
+	require.True(t, errors.Is(validate(generateNonceTx("user1", 6)), utils.ErrTxNonceTooLow))
+	require.NoError(t, validate(generateNonceTx("user1", 8)))
+
+	// the nonces of the retried txs are fetched again
+	pool.resetTxNonces([]*commonPb.Transaction{generateNonceTx("user1", 7), generateNonceTx("user1", 8)}, true)
+	require.EqualValues(t, 6, pool.nonces.get(mustNonceAccount(t, "user1")))
+	validate = pool.newFetchValidator()
+	require.NoError(t, validate(generateNonceTx("user1", 7)))
+	require.NoError(t, validate(generateNonceTx("user1", 8)))
+}
+
+func TestTxPoolImpl_ResetTxNoncesOnCommit(t *testing.T) {
+	nonces := map[string]uint64{"user1": 5}
+	pool, fn := newTestNoncePool(t, nonces)
+	defer fn()
+
+	validate := pool.newFetchValidator()
+	for nonce := uint64(6); nonce <= 9; nonce++ {
+		require.NoError(t, validate(generateNonceTx("user1", nonce)))
+	}
+
+	// the block of the nonces 6 and 7 is committed, the nonces 8 and 9 are still in flight
+	nonces["user1"] = 7
+	pool.resetTxNonces([]*commonPb.Transaction{generateNonceTx("user1", 6), generateNonceTx("user1", 7)}, false)
+	require.EqualValues(t, 9, pool.nonces.get(mustNonceAccount(t, "user1")))
+	validate = pool.newFetchValidator()
+	require.True(t, errors.Is(validate(generateNonceTx("user1", 8)), utils.ErrTxNonceTooLow))
+	require.NoError(t, validate(generateNonceTx("user1", 10)))
+
+	// the account is deleted once the state catches up
+	nonces["user1"] = 10
+	pool.resetTxNonces([]*commonPb.Transaction{generateNonceTx("user1", 8), generateNonceTx("user1", 9),
+		generateNonceTx("user1", 10)}, false)
+	require.EqualValues(t, 0, len(pool.nonces.fetched))
+}
+
+func mustNonceAccount(t *testing.T, member string) string {
+	account, err := utils.TxNonceAccount(generateNonceTx(member, 0), "SHA256")
+	require.NoError(t, err)
+	return account
+}
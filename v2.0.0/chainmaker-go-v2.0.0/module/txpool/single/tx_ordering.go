@@ -0,0 +1,350 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package single
+
+import (
+	"container/heap"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"chainmaker.org/chainmaker-go/txpool/poolconf"
+	"chainmaker.org/chainmaker-go/utils"
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	configPb "chainmaker.org/chainmaker/pb-go/v2/config"
+	"chainmaker.org/chainmaker/protocol/v2"
+)
+
+const (
+	// OrderingPolicyFIFO fetch the common txs in the order of arrival
+	OrderingPolicyFIFO = "fifo"
+	// OrderingPolicyPriority fetch the common txs by priority class, then by gas price, then in the order of
+	// arrival. The lowest ranked tx is evicted when the pool is full and a higher ranked tx is accepted.
+	OrderingPolicyPriority = "priority"
+
+	// PriorityOrgConfigKeyPrefix the prefix of the keys in consensus.ext_config of chain config which set the
+	// priority class of the txs sent by an org, the larger class is fetched earlier, the default class is 0
+	//		- key: txpool.priority.org.wx-org1.chainmaker.org
+	//		  value: 10
+	PriorityOrgConfigKeyPrefix = "txpool.priority.org."
+	// PriorityContractConfigKeyPrefix the prefix of the keys in consensus.ext_config of chain config which set
+	// the priority class of the txs invoking a contract, the larger one of the org and the contract class is used
+	//		- key: txpool.priority.contract.settlement
+	//		  value: 20
+	PriorityContractConfigKeyPrefix = "txpool.priority.contract."
+)
+
+// orderingPolicy decides the order in which the common txs are fetched to the block
+// and which tx is evicted when the pool is full
+type orderingPolicy interface {
+	// rank returns the rank of the tx, it is computed when the tx is added to the queue
+	rank(tx *commonPb.Transaction) txRank
+	// senderCap returns the maximum number of txs of a sender in a block, 0 means no limit
+	senderCap() int
+}
+
+// txRank the position of a tx in the ordering
+type txRank struct {
+	class  int64
+	price  uint64 // the gas price charged for the tx, see utils.TxGasPrice
+	sender string
+}
+
+// before whether the tx of rank r is fetched before the tx of rank o, the txs of the same class and price
+// are fetched in the order of arrival
+func (r txRank) before(o txRank) bool {
+	if r.class != o.class {
+		return r.class > o.class
+	}
+	return r.price > o.price
+}
+
+type orderingPolicyProvider func(chainConf protocol.ChainConf) orderingPolicy
+
+var orderingPolicies = map[string]orderingPolicyProvider{
+	// nil means the txs are fetched in the order of arrival
+	OrderingPolicyFIFO:     func(chainConf protocol.ChainConf) orderingPolicy { return nil },
+	OrderingPolicyPriority: newPriorityPolicy,
+}
+
+// newOrderingPolicy returns the ordering policy of the name
+func newOrderingPolicy(name string, chainConf protocol.ChainConf) (orderingPolicy, error) {
+	provider, ok := orderingPolicies[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown txpool ordering policy: %s", name)
+	}
+	return provider(chainConf), nil
+}
+
+// priorityPolicy ranks the txs by the priority classes in the chain config and the gas price charged for them
+type priorityPolicy struct {
+	chainConf protocol.ChainConf
+	maxTxs    int
+
+	mu            sync.Mutex
+	config        *configPb.ChainConfig // the chain config which the classes are parsed from
+	orgClass      map[string]int64
+	contractClass map[string]int64
+	gasPrice      uint64
+}
+
+func newPriorityPolicy(chainConf protocol.ChainConf) orderingPolicy {
+	return &priorityPolicy{
+		chainConf: chainConf,
+		maxTxs:    poolconf.MaxSenderTxsInBlock(),
+	}
+}
+
+func (p *priorityPolicy) rank(tx *commonPb.Transaction) txRank {
+	var (
+		org      string
+		contract string
+	)
+	if tx.Sender != nil && tx.Sender.Signer != nil {
+		org = tx.Sender.Signer.OrgId
+	}
+	if tx.Payload != nil {
+		contract = tx.Payload.ContractName
+	}
+
+	p.mu.Lock()
+	p.loadConfig()
+	class := p.orgClass[org]
+	if c, ok := p.contractClass[contract]; ok && c > class {
+		class = c
+	}
+	gasPrice := p.gasPrice
+	p.mu.Unlock()
+
+	return txRank{class: class, price: utils.TxGasPrice(tx, gasPrice), sender: txSender(tx)}
+}
+
+func (p *priorityPolicy) senderCap() int {
+	return p.maxTxs
+}
+
+// loadConfig parse the classes and the gas price again if the chain config is updated
+func (p *priorityPolicy) loadConfig() {
+	if p.chainConf == nil {
+		return
+	}
+	config := p.chainConf.ChainConfig()
+	if config == p.config {
+		return
+	}
+	p.config = config
+	p.orgClass = make(map[string]int64)
+	p.contractClass = make(map[string]int64)
+	p.gasPrice = 0
+	if config == nil || config.Consensus == nil {
+		return
+	}
+	for _, kv := range config.Consensus.ExtConfig {
+		var classes map[string]int64
+		var name string
+		switch {
+		case strings.HasPrefix(kv.Key, PriorityOrgConfigKeyPrefix):
+			classes, name = p.orgClass, strings.TrimPrefix(kv.Key, PriorityOrgConfigKeyPrefix)
+		case strings.HasPrefix(kv.Key, PriorityContractConfigKeyPrefix):
+			classes, name = p.contractClass, strings.TrimPrefix(kv.Key, PriorityContractConfigKeyPrefix)
+		default:
+			continue
+		}
+		class, err := strconv.ParseInt(string(kv.Value), 10, 64)
+		if err != nil {
+			// the invalid class is ignored, the txs use the default class
+			continue
+		}
+		classes[name] = class
+	}
+	if price, err := utils.GetGasPrice(config); err == nil {
+		p.gasPrice = price
+	}
+}
+
+// txSender the identity of the sender of the tx
+func txSender(tx *commonPb.Transaction) string {
+	if tx.Sender == nil || tx.Sender.Signer == nil {
+		return ""
+	}
+	h := sha256.Sum256(tx.Sender.Signer.MemberInfo)
+	return tx.Sender.Signer.OrgId + "/" + hex.EncodeToString(h[:8])
+}
+
+// rankedTx a tx in the ordering, seq is the order of arrival
+type rankedTx struct {
+	txId     string
+	rank     txRank
+	seq      uint64
+	fetchIdx int // the index in the fetch heap of the class
+	evictIdx int // the index in the evict heap of the class
+}
+
+// fetchedBefore the tx of higher price is fetched first, then the earlier arrived one
+func fetchedBefore(a, b *rankedTx) bool {
+	if a.rank.price != b.rank.price {
+		return a.rank.price > b.rank.price
+	}
+	return a.seq < b.seq
+}
+
+// evictedBefore the tx of lower price is evicted first, then the later arrived one
+func evictedBefore(a, b *rankedTx) bool {
+	if a.rank.price != b.rank.price {
+		return a.rank.price < b.rank.price
+	}
+	return a.seq > b.seq
+}
+
+// txHeap implements heap.Interface, the index of each tx in the heap is tracked to remove it
+type txHeap struct {
+	txs   []*rankedTx
+	less  func(a, b *rankedTx) bool
+	index func(tx *rankedTx) *int
+}
+
+func (h *txHeap) Len() int { return len(h.txs) }
+
+func (h *txHeap) Less(i, j int) bool { return h.less(h.txs[i], h.txs[j]) }
+
+func (h *txHeap) Swap(i, j int) {
+	h.txs[i], h.txs[j] = h.txs[j], h.txs[i]
+	*h.index(h.txs[i]) = i
+	*h.index(h.txs[j]) = j
+}
+
+func (h *txHeap) Push(x interface{}) {
+	tx := x.(*rankedTx)
+	*h.index(tx) = len(h.txs)
+	h.txs = append(h.txs, tx)
+}
+
+func (h *txHeap) Pop() interface{} {
+	n := len(h.txs)
+	tx := h.txs[n-1]
+	h.txs[n-1] = nil
+	h.txs = h.txs[:n-1]
+	*h.index(tx) = -1
+	return tx
+}
+
+// top the first tx of the heap, nil if the heap is empty
+func (h *txHeap) top() *rankedTx {
+	if len(h.txs) == 0 {
+		return nil
+	}
+	return h.txs[0]
+}
+
+// classQueue the txs of a priority class, the top of the fetch heap is the tx fetched first
+// and the top of the evict heap is the tx evicted first
+type classQueue struct {
+	fetch *txHeap
+	evict *txHeap
+}
+
+func newClassQueue() *classQueue {
+	return &classQueue{
+		fetch: &txHeap{less: fetchedBefore, index: func(tx *rankedTx) *int { return &tx.fetchIdx }},
+		evict: &txHeap{less: evictedBefore, index: func(tx *rankedTx) *int { return &tx.evictIdx }},
+	}
+}
+
+func (q *classQueue) push(tx *rankedTx) {
+	heap.Push(q.fetch, tx)
+	heap.Push(q.evict, tx)
+}
+
+func (q *classQueue) remove(tx *rankedTx) {
+	heap.Remove(q.fetch, tx.fetchIdx)
+	heap.Remove(q.evict, tx.evictIdx)
+}
+
+func (q *classQueue) size() int {
+	return q.fetch.Len()
+}
+
+// txClasses the txs ordered by the policy, each priority class has its own heaps
+type txClasses struct {
+	classes map[int64]*classQueue
+	txs     map[string]*rankedTx
+	seq     uint64
+}
+
+func newTxClasses() *txClasses {
+	return &txClasses{
+		classes: make(map[int64]*classQueue),
+		txs:     make(map[string]*rankedTx),
+	}
+}
+
+func (c *txClasses) add(txId string, rank txRank) {
+	class, ok := c.classes[rank.class]
+	if !ok {
+		class = newClassQueue()
+		c.classes[rank.class] = class
+	}
+	tx := &rankedTx{txId: txId, rank: rank, seq: c.seq}
+	c.seq++
+	c.txs[txId] = tx
+	class.push(tx)
+}
+
+func (c *txClasses) remove(txId string) {
+	tx, ok := c.txs[txId]
+	if !ok {
+		return
+	}
+	delete(c.txs, txId)
+	c.classes[tx.rank.class].remove(tx)
+}
+
+// sortedClasses the classes from the highest to the lowest
+func (c *txClasses) sortedClasses() []int64 {
+	classes := make([]int64, 0, len(c.classes))
+	for class := range c.classes {
+		classes = append(classes, class)
+	}
+	sort.Slice(classes, func(i, j int) bool { return classes[i] > classes[j] })
+	return classes
+}
+
+// lowest the tx evicted first, the latest arrived one of the lowest price in the lowest class
+func (c *txClasses) lowest() *rankedTx {
+	classes := c.sortedClasses()
+	for i := len(classes) - 1; i >= 0; i-- {
+		if tx := c.classes[classes[i]].evict.top(); tx != nil {
+			return tx
+		}
+	}
+	return nil
+}
+
+// walk visits the txs in the order of fetching until visit returns false. The txs are popped from the fetch heaps
+// and pushed back after the walk, it costs O(k*log(n)) for the k txs visited.
+func (c *txClasses) walk(visit func(tx *rankedTx) bool) {
+	for _, class := range c.sortedClasses() {
+		queue := c.classes[class]
+		popped := make([]*rankedTx, 0)
+		next := true
+		for next && queue.fetch.Len() > 0 {
+			tx := heap.Pop(queue.fetch).(*rankedTx)
+			popped = append(popped, tx)
+			next = visit(tx)
+		}
+		for _, tx := range popped {
+			heap.Push(queue.fetch, tx)
+		}
+		if !next {
+			return
+		}
+	}
+}
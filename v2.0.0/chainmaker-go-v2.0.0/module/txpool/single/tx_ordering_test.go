@@ -0,0 +1,275 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package single
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"chainmaker.org/chainmaker-go/chainconf"
+	"chainmaker.org/chainmaker-go/localconf"
+	"chainmaker.org/chainmaker-go/logger"
+	"chainmaker.org/chainmaker-go/utils"
+	commonErrors "chainmaker.org/chainmaker/common/v2/errors"
+	acPb "chainmaker.org/chainmaker/pb-go/v2/accesscontrol"
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	configPb "chainmaker.org/chainmaker/pb-go/v2/config"
+	"chainmaker.org/chainmaker/protocol/v2"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestPriorityConf(kvs ...*configPb.ConfigKeyValue) *chainconf.ChainConf {
+	chainConf, _ := chainconf.NewChainConf(nil)
+	chainConf.ChainConf = &configPb.ChainConfig{
+		Block:     &configPb.BlockConfig{},
+		Contract:  &configPb.ContractConfig{},
+		Consensus: &configPb.ConsensusConfig{ExtConfig: kvs},
+	}
+	return chainConf
+}
+
+// generatePriorityTx generate a tx bidding the gas price, no price is bid if gasPrice is 0
+func generatePriorityTx(org, member, contract string, gasPrice uint64) *commonPb.Transaction {
+	tx := &commonPb.Transaction{
+		Payload: &commonPb.Payload{TxId: utils.GetRandTxId(), TxType: commonPb.TxType_INVOKE_CONTRACT,
+			Method: "invoke", ContractName: contract},
+		Sender: &commonPb.EndorsementEntry{Signer: &acPb.Member{OrgId: org, MemberInfo: []byte(member)}},
+	}
+	if gasPrice > 0 {
+		tx.Payload.Limit = utils.NewTxGasLimitWithPrice(100000, gasPrice)
+	}
+	return tx
+}
+
+// classSize the number of txs of the class in the list
+func classSize(list *txList, class int64) int {
+	if queue, ok := list.classes.classes[class]; ok {
+		return queue.size()
+	}
+	return 0
+}
+
+func TestNewOrderingPolicy(t *testing.T) {
+	policy, err := newOrderingPolicy(OrderingPolicyFIFO, nil)
+	require.NoError(t, err)
+	require.Nil(t, policy)
+
+	policy, err = newOrderingPolicy(OrderingPolicyPriority, newTestPriorityConf())
+	require.NoError(t, err)
+	require.NotNil(t, policy)
+
+	_, err = newOrderingPolicy("unknown", nil)
+	require.Error(t, err)
+}
+
+func TestPriorityPolicy_Rank(t *testing.T) {
+	chainConf := newTestPriorityConf(
+		&configPb.ConfigKeyValue{Key: PriorityOrgConfigKeyPrefix + "org1", Value: "10"},
+		&configPb.ConfigKeyValue{Key: PriorityContractConfigKeyPrefix + "settlement", Value: "20"},
+		&configPb.ConfigKeyValue{Key: PriorityContractConfigKeyPrefix + "invalid", Value: "high"},
+	)
+	policy := newPriorityPolicy(chainConf)
+
+	require.EqualValues(t, 0, policy.rank(generatePriorityTx("org2", "user1", "batch", 0)).class)
+	require.EqualValues(t, 10, policy.rank(generatePriorityTx("org1", "user1", "batch", 0)).class)
+	require.EqualValues(t, 20, policy.rank(generatePriorityTx("org1", "user1", "settlement", 0)).class)
+	require.EqualValues(t, 0, policy.rank(generatePriorityTx("org2", "user1", "invalid", 0)).class)
+	// no fee is charged without the gas price in chain config, the bid is ignored
+	require.EqualValues(t, 0, policy.rank(generatePriorityTx("org2", "user1", "batch", 100)).price)
+
+	// the same member of an org is the same sender
+	require.EqualValues(t, policy.rank(generatePriorityTx("org1", "user1", "a", 0)).sender,
+		policy.rank(generatePriorityTx("org1", "user1", "b", 0)).sender)
+	require.NotEqual(t, policy.rank(generatePriorityTx("org1", "user1", "a", 0)).sender,
+		policy.rank(generatePriorityTx("org1", "user2", "a", 0)).sender)
+
+	// the classes and the price follow the update of the chain config, the price is the higher one of the bid
+	// and the price in chain config
+	chainConf.ChainConf = newTestPriorityConf(
+		&configPb.ConfigKeyValue{Key: utils.GasPriceConfigKey, Value: "2"},
+	).ChainConf
+	rank := policy.rank(generatePriorityTx("org1", "user1", "settlement", 100))
+	require.EqualValues(t, 0, rank.class)
+	require.EqualValues(t, 100, rank.price)
+	require.EqualValues(t, 2, policy.rank(generatePriorityTx("org1", "user1", "a", 0)).price)
+	require.EqualValues(t, 2, policy.rank(generatePriorityTx("org1", "user1", "a", 1)).price)
+}
+
+func TestTxRank_Before(t *testing.T) {
+	require.True(t, txRank{class: 1}.before(txRank{class: 0, price: 100}))
+	require.True(t, txRank{class: 1, price: 2}.before(txRank{class: 1, price: 1}))
+	require.False(t, txRank{class: 1, price: 1}.before(txRank{class: 1, price: 1}))
+	require.False(t, txRank{class: -1}.before(txRank{class: 0}))
+}
+
+func TestTxList_FetchByPolicy(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	blockChainStore := newMockBlockChainStore(ctrl)
+	list := newTxList(logger.GetLogger(testListLogName), &sync.Map{}, blockChainStore.store)
+	list.setPolicy(newPriorityPolicy(newTestPriorityConf(
+		&configPb.ConfigKeyValue{Key: PriorityContractConfigKeyPrefix + "settlement", Value: "10"},
+		&configPb.ConfigKeyValue{Key: utils.GasPriceConfigKey, Value: "1"},
+	)), nil)
+	validateFunc := mockValidate(list, blockChainStore.store)
+
+	batchTxs := make([]*commonPb.Transaction, 0, 5)
+	for i := 0; i < 5; i++ {
+		batchTxs = append(batchTxs, generatePriorityTx("org1", "importer", "batch", 0))
+	}
+	richTx := generatePriorityTx("org2", "user1", "batch", 10)
+	urgentTx := generatePriorityTx("org2", "user2", "settlement", 0)
+	list.Put(batchTxs, protocol.RPC, validateFunc)
+	list.Put([]*commonPb.Transaction{richTx, urgentTx}, protocol.RPC, validateFunc)
+	require.EqualValues(t, 1, classSize(list, 10))
+	require.EqualValues(t, 6, classSize(list, 0))
+
+	// the higher class first, then the higher price, then in the order of arrival
+	_, txIds := list.Fetch(4, nil, 1)
+	require.EqualValues(t, []string{urgentTx.Payload.TxId, richTx.Payload.TxId, batchTxs[0].Payload.TxId,
+		batchTxs[1].Payload.TxId}, txIds)
+	require.EqualValues(t, 0, classSize(list, 10))
+	require.EqualValues(t, 3, classSize(list, 0))
+	require.EqualValues(t, 3, len(list.classes.txs))
+
+	// the txs left keep their order in the heaps
+	_, txIds = list.Fetch(4, nil, 2)
+	require.EqualValues(t, []string{batchTxs[2].Payload.TxId, batchTxs[3].Payload.TxId,
+		batchTxs[4].Payload.TxId}, txIds)
+}
+
+func TestTxList_FetchBySenderCap(t *testing.T) {
+	localconf.ChainMakerConfig.TxPoolConfig.MaxSenderTxsInBlock = 2
+	defer func() {
+		localconf.ChainMakerConfig.TxPoolConfig.MaxSenderTxsInBlock = 0
+	}()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	blockChainStore := newMockBlockChainStore(ctrl)
+	list := newTxList(logger.GetLogger(testListLogName), &sync.Map{}, blockChainStore.store)
+	list.setPolicy(newPriorityPolicy(newTestPriorityConf()), nil)
+	validateFunc := mockValidate(list, blockChainStore.store)
+
+	importTxs := make([]*commonPb.Transaction, 0, 5)
+	for i := 0; i < 5; i++ {
+		importTxs = append(importTxs, generatePriorityTx("org1", "importer", "batch", 0))
+	}
+	otherTx := generatePriorityTx("org1", "user1", "batch", 0)
+	list.Put(importTxs, protocol.RPC, validateFunc)
+	list.Put([]*commonPb.Transaction{otherTx}, protocol.RPC, validateFunc)
+
+	// the txs exceeding the cap of the sender are left to the next block
+	_, txIds := list.Fetch(10, nil, 1)
+	require.EqualValues(t, []string{importTxs[0].Payload.TxId, importTxs[1].Payload.TxId, otherTx.Payload.TxId}, txIds)
+	require.EqualValues(t, 3, list.Size())
+	_, txIds = list.Fetch(10, nil, 2)
+	require.EqualValues(t, []string{importTxs[2].Payload.TxId, importTxs[3].Payload.TxId}, txIds)
+}
+
+func TestTxList_Evict(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	blockChainStore := newMockBlockChainStore(ctrl)
+	list := newTxList(logger.GetLogger(testListLogName), &sync.Map{}, blockChainStore.store)
+	validateFunc := mockValidate(list, blockChainStore.store)
+
+	// nothing is evicted in the order of arrival
+	list.Put(generateTxs(3, false), protocol.RPC, validateFunc)
+	require.False(t, list.OutranksLowest(generatePriorityTx("org1", "user1", "settlement", 0)))
+
+	list = newTxList(logger.GetLogger(testListLogName), &sync.Map{}, blockChainStore.store)
+	list.setPolicy(newPriorityPolicy(newTestPriorityConf(
+		&configPb.ConfigKeyValue{Key: PriorityOrgConfigKeyPrefix + "org1", Value: "5"},
+		&configPb.ConfigKeyValue{Key: PriorityContractConfigKeyPrefix + "settlement", Value: "10"},
+		&configPb.ConfigKeyValue{Key: utils.GasPriceConfigKey, Value: "1"},
+	)), func() int { return 3 })
+	validateFunc = mockValidate(list, blockChainStore.store)
+	txs := []*commonPb.Transaction{
+		generatePriorityTx("org2", "user1", "batch", 0),
+		generatePriorityTx("org2", "user1", "batch", 0),
+		generatePriorityTx("org1", "user1", "batch", 0),
+	}
+	accepted, evicted := list.Put(txs, protocol.RPC, validateFunc)
+	require.EqualValues(t, txs, accepted)
+	require.Empty(t, evicted)
+
+	// the tx of the same rank is rejected and does not evict others
+	sameTx := generatePriorityTx("org2", "user2", "batch", 0)
+	require.False(t, list.OutranksLowest(sameTx))
+	accepted, evicted = list.Put([]*commonPb.Transaction{sameTx}, protocol.RPC, validateFunc)
+	require.Empty(t, accepted)
+	require.Empty(t, evicted)
+
+	// the invalid tx does not evict others even if it is ranked higher
+	invalidTx := generatePriorityTx("org2", "user2", "settlement", 0)
+	require.True(t, list.OutranksLowest(invalidTx))
+	blockChainStore.txs[invalidTx.Payload.TxId] = invalidTx
+	accepted, evicted = list.Put([]*commonPb.Transaction{invalidTx}, protocol.RPC, validateFunc)
+	require.Empty(t, accepted)
+	require.Empty(t, evicted)
+	require.EqualValues(t, 3, list.Size())
+
+	// the latest arrived one of the lowest ranked txs is evicted, a higher price outranks the same class
+	urgentTx := generatePriorityTx("org2", "user2", "settlement", 0)
+	richTx := generatePriorityTx("org2", "user2", "batch", 10)
+	accepted, evicted = list.Put([]*commonPb.Transaction{urgentTx, richTx}, protocol.RPC, validateFunc)
+	require.EqualValues(t, []*commonPb.Transaction{urgentTx, richTx}, accepted)
+	require.EqualValues(t, []*commonPb.Transaction{txs[1], txs[0]}, evicted)
+
+	// the internal txs are not limited by the capacity
+	accepted, evicted = list.Put([]*commonPb.Transaction{generatePriorityTx("org2", "user2", "batch", 0)},
+		protocol.INTERNAL, validateFunc)
+	require.Len(t, accepted, 1)
+	require.Empty(t, evicted)
+	require.EqualValues(t, 4, list.Size())
+	require.EqualValues(t, 2, classSize(list, 0))
+	require.EqualValues(t, 1, classSize(list, 5))
+	require.EqualValues(t, 1, classSize(list, 10))
+}
+
+func TestTxPoolImpl_AddTxEvict(t *testing.T) {
+	localconf.ChainMakerConfig.TxPoolConfig.OrderingPolicy = OrderingPolicyPriority
+	defer func() {
+		localconf.ChainMakerConfig.TxPoolConfig.OrderingPolicy = ""
+	}()
+	testPool, fn := newTestPool(t, 10)
+	defer fn()
+	imPool := testPool.txPool.(*txPoolImpl)
+	imPool.chainConf.(*chainconf.ChainConf).ChainConf = newTestPriorityConf(
+		&configPb.ConfigKeyValue{Key: PriorityContractConfigKeyPrefix + "settlement", Value: "10"},
+	).ChainConf
+
+	for i := 0; i < 10; i++ {
+		require.NoError(t, testPool.txPool.AddTx(generatePriorityTx("org1", "importer", "batch", 0), protocol.RPC))
+	}
+	time.Sleep(time.Second)
+	require.EqualValues(t, 10, imPool.queue.commonTxsCount())
+
+	// the tx of the default class is rejected
+	require.EqualError(t, commonErrors.ErrTxPoolLimit,
+		testPool.txPool.AddTx(generatePriorityTx("org1", "importer", "batch", 0), protocol.RPC).Error())
+
+	// the urgent tx rejected by the queue evicts nothing
+	invalidTx := generatePriorityTx("org2", "user1", "settlement", 0)
+	testPool.extTxs[invalidTx.Payload.TxId] = invalidTx
+	require.NoError(t, testPool.txPool.AddTx(invalidTx, protocol.RPC))
+	time.Sleep(time.Second)
+	require.EqualValues(t, 10, imPool.queue.commonTxsCount())
+	require.False(t, imPool.TxExists(invalidTx))
+
+	// the urgent tx evicts a tx of the default class after it is accepted
+	urgentTx := generatePriorityTx("org2", "user1", "settlement", 0)
+	require.NoError(t, testPool.txPool.AddTx(urgentTx, protocol.RPC))
+	time.Sleep(time.Second)
+	require.EqualValues(t, 10, imPool.queue.commonTxsCount())
+
+	txs := testPool.txPool.FetchTxBatch(1)
+	require.EqualValues(t, urgentTx.Payload.TxId, txs[0].Payload.TxId)
+}
@@ -15,6 +15,7 @@ import (
 
 	"chainmaker.org/chainmaker-go/localconf"
 	"chainmaker.org/chainmaker-go/txpool/poolconf"
+	"chainmaker.org/chainmaker-go/txpool/poolwal"
 	"chainmaker.org/chainmaker-go/utils"
 	commonErrors "chainmaker.org/chainmaker/common/v2/errors"
 	"chainmaker.org/chainmaker/common/v2/msgbus"
@@ -39,6 +40,7 @@ type txPoolImpl struct {
 	signalLock     sync.RWMutex        // Locker to protect signal status
 	signalStatus   txpoolPb.SignalType // The current state of the transaction pool
 	latestFullTime int64               // The most latest time the trading pool was full
+	nonces         *nonceTracker       // The nonces of the senders fetched to the uncommitted blocks
 
 	ac              protocol.AccessControlProvider
 	log             protocol.Logger
@@ -46,6 +48,7 @@ type txPoolImpl struct {
 	chainConf       protocol.ChainConf       // chainConfig
 	netService      protocol.NetService      // P2P module implementation
 	blockchainStore protocol.BlockchainStore // Store module implementation
+	txWal           *poolwal.TxWal           // Persist the txs in the pool, nil if persistence is disabled
 }
 
 func NewTxPoolImpl(chainId string, blockStore protocol.BlockchainStore, msgBus msgbus.MessageBus,
@@ -71,6 +74,7 @@ func NewTxPoolImpl(chainId string, blockStore protocol.BlockchainStore, msgBus m
 		addTxsCh:     make(chan *mempoolTxs, addChSize),
 		flushTicker:  ticker,
 		signalStatus: txpoolPb.SignalType_NO_EVENT,
+		nonces:       newNonceTracker(),
 
 		ac:              ac,
 		log:             log,
@@ -79,11 +83,21 @@ func NewTxPoolImpl(chainId string, blockStore protocol.BlockchainStore, msgBus m
 		netService:      net,
 		blockchainStore: blockStore,
 	}
+	policy, err := newOrderingPolicy(poolconf.OrderingPolicy(), conf)
+	if err != nil {
+		return nil, err
+	}
 	txPoolQueue.queue = newQueue(blockStore, log, txPoolQueue.validate)
+	txPoolQueue.queue.setOrderingPolicy(policy)
 	return txPoolQueue, nil
 }
 
 func (pool *txPoolImpl) Start() (err error) {
+	if poolconf.IsPersist() {
+		if err = pool.replayTxWal(); err != nil {
+			return err
+		}
+	}
 	if pool.msgBus != nil {
 		pool.msgBus.Register(msgbus.RecvTxPoolMsg, pool)
 	}
@@ -91,6 +105,87 @@ func (pool *txPoolImpl) Start() (err error) {
 	return
 }
 
+// replayTxWal open the tx wal and re-add the txs which are not confirmed before the node stopped
+func (pool *txPoolImpl) replayTxWal() error {
+	txWal, err := poolwal.Open(poolconf.PersistDir(pool.chainId), pool.log)
+	if err != nil {
+		return err
+	}
+	txs, err := txWal.Replay(pool.blockchainStore)
+	if err != nil {
+		_ = txWal.Close()
+		return fmt.Errorf("replay tx wal failed, %s", err.Error())
+	}
+	pool.txWal = txWal
+	if len(txs) == 0 {
+		return nil
+	}
+	var (
+		configTxs   = make([]*commonPb.Transaction, 0)
+		commonTxs   = make([]*commonPb.Transaction, 0, len(txs))
+		enableSqlDB = pool.chainConf.ChainConfig().Contract.EnableSqlSupport
+	)
+	for _, tx := range txs {
+		if utils.IsConfigTx(tx) || utils.IsManageContractAsConfigTx(tx, enableSqlDB) {
+			configTxs = append(configTxs, tx)
+		} else {
+			commonTxs = append(commonTxs, tx)
+		}
+	}
+	// the txs which are invalid now are removed from the wal
+	accepted := pool.queue.addTxsToConfigQueue(&mempoolTxs{txs: configTxs, source: protocol.INTERNAL})
+	commonAccepted, _ := pool.queue.addTxsToCommonQueue(&mempoolTxs{txs: commonTxs, source: protocol.INTERNAL})
+	accepted = append(accepted, commonAccepted...)
+	pool.removeRejectedTxs(txs, accepted)
+	pool.updateAndPublishSignal()
+	pool.log.Infof("replay txs from tx wal, config txs: %d, common txs: %d, accepted txs: %d", len(configTxs),
+		len(commonTxs), len(accepted))
+	return nil
+}
+
+// addCommonTxs add the txs to the common queue, the txs rejected by the queue and the txs evicted for them
+// are removed from the wal
+func (pool *txPoolImpl) addCommonTxs(txs []*commonPb.Transaction, source protocol.TxSource) {
+	if len(txs) == 0 {
+		return
+	}
+	accepted, evicted := pool.queue.addTxsToCommonQueue(&mempoolTxs{txs: txs, source: source})
+	pool.removeRejectedTxs(txs, accepted)
+	if len(evicted) == 0 {
+		return
+	}
+	for _, tx := range evicted {
+		pool.log.Warnf("txPool is full, evict txId: %s", tx.Payload.GetTxId())
+	}
+	if pool.txWal != nil {
+		if err := pool.txWal.RemoveTxs(evicted); err != nil {
+			pool.log.Errorf("persist evicted txs failed, %s", err)
+		}
+	}
+}
+
+// removeRejectedTxs removes the txs which are neither accepted by the queue nor in the pool from the tx wal,
+// e.g. the txs in blockchain already, or the replayed or retried txs which are invalid now.
+// The txs are persisted by AddTx before they are put into the queue.
+func (pool *txPoolImpl) removeRejectedTxs(txs, accepted []*commonPb.Transaction) {
+	if pool.txWal == nil || len(txs) == 0 || len(accepted) == len(txs) {
+		return
+	}
+	acceptedIds := make(map[string]struct{}, len(accepted))
+	for _, tx := range accepted {
+		acceptedIds[tx.Payload.TxId] = struct{}{}
+	}
+	rejected := make([]*commonPb.Transaction, 0, len(txs)-len(accepted))
+	for _, tx := range txs {
+		if _, ok := acceptedIds[tx.Payload.TxId]; !ok && !pool.queue.has(tx, true) {
+			rejected = append(rejected, tx)
+		}
+	}
+	if err := pool.txWal.RemoveTxs(rejected); err != nil {
+		pool.log.Errorf("persist rejected txs failed, %s", err)
+	}
+}
+
 func (pool *txPoolImpl) listen() {
 	flushTicker := time.NewTicker(time.Duration(pool.flushTicker) * time.Second)
 	defer flushTicker.Stop()
@@ -132,7 +227,7 @@ func (pool *txPoolImpl) flushConfigTxToQueue(memTxs *mempoolTxs) {
 	defer func() {
 		pool.updateAndPublishSignal()
 	}()
-	pool.queue.addTxsToConfigQueue(memTxs)
+	pool.removeRejectedTxs(memTxs.txs, pool.queue.addTxsToConfigQueue(memTxs))
 }
 
 func (pool *txPoolImpl) flushCommonTxToQueue(memTxs *mempoolTxs) {
@@ -142,9 +237,9 @@ func (pool *txPoolImpl) flushCommonTxToQueue(memTxs *mempoolTxs) {
 	}()
 
 	rpcTxs, p2pTxs, internalTxs := pool.cache.mergeAndSplitTxsBySource(memTxs)
-	pool.queue.addTxsToCommonQueue(&mempoolTxs{txs: rpcTxs, source: protocol.RPC})
-	pool.queue.addTxsToCommonQueue(&mempoolTxs{txs: p2pTxs, source: protocol.P2P})
-	pool.queue.addTxsToCommonQueue(&mempoolTxs{txs: internalTxs, source: protocol.INTERNAL})
+	pool.addCommonTxs(rpcTxs, protocol.RPC)
+	pool.addCommonTxs(p2pTxs, protocol.P2P)
+	pool.addCommonTxs(internalTxs, protocol.INTERNAL)
 }
 
 func (pool *txPoolImpl) Stop() error {
@@ -153,6 +248,11 @@ func (pool *txPoolImpl) Stop() error {
 	}
 	close(pool.stopCh)
 	close(pool.addTxsCh)
+	if pool.txWal != nil {
+		if err := pool.txWal.Close(); err != nil {
+			pool.log.Errorf("close tx wal failed, %s", err)
+		}
+	}
 	pool.log.Infof("close txpool service")
 	return nil
 }
@@ -177,6 +277,10 @@ func (pool *txPoolImpl) AddTx(tx *commonPb.Transaction, source protocol.TxSource
 	if pool.TxExists(tx) {
 		return commonErrors.ErrTxIdExist
 	}
+	if err := pool.validateTxNonce(tx); err != nil {
+		pool.log.Warnf("AddTx txId: %s, invalid nonce: %s", tx.Payload.GetTxId(), err)
+		return err
+	}
 	var (
 		err   error
 		txMsg []byte
@@ -193,12 +297,20 @@ func (pool *txPoolImpl) AddTx(tx *commonPb.Transaction, source protocol.TxSource
 	if utils.IsConfigTx(tx) || utils.IsManageContractAsConfigTx(tx, pool.chainConf.ChainConfig().Contract.EnableSqlSupport) {
 		memTx.isConfigTxs = true
 	}
+	// the tx is persisted before it is acknowledged, it is removed from the wal if the queue rejects it
+	if pool.txWal != nil {
+		if err = pool.txWal.AddTxs(memTx.txs); err != nil {
+			pool.log.Errorf("persist tx failed, txId: %s, err: %s", tx.Payload.GetTxId(), err)
+			return err
+		}
+	}
 	t := time.NewTimer(time.Second)
 	defer t.Stop()
 	select {
 	case pool.addTxsCh <- memTx:
 	case <-t.C:
 		pool.log.Warnf("add transaction timeout")
+		pool.removeRejectedTxs(memTx.txs, nil)
 		return fmt.Errorf("add transaction timeout")
 	}
 	// 3. broadcast the transaction
@@ -208,13 +320,17 @@ func (pool *txPoolImpl) AddTx(tx *commonPb.Transaction, source protocol.TxSource
 	return nil
 }
 
-// isFull Check whether the transaction pool is fullnal
+// isFull Check whether the transaction pool is fullnal. A common tx ranked before the lowest ranked one is let in
+// if the pool has an ordering policy, the lowest one is only evicted after the tx is accepted by the queue
 func (pool *txPoolImpl) isFull(tx *commonPb.Transaction) bool {
 	if utils.IsConfigTx(tx) && pool.queue.configTxsCount() >= poolconf.MaxConfigTxPoolSize() {
 		pool.log.Errorf("AddTx configTxPool is full, txId: %s, configQueueSize: %d", tx.Payload.GetTxId(), pool.queue.configTxsCount())
 		return true
 	}
 	if pool.queue.commonTxsCount() >= poolconf.MaxCommonTxPoolSize() {
+		if !utils.IsConfigTx(tx) && !pool.TxExists(tx) && pool.queue.outranksLowestCommonTx(tx) {
+			return false
+		}
 		pool.log.Errorf("AddTx txPool is full, txId: %s, txQueueSize: %d", tx.Payload.GetTxId(), pool.queue.commonTxsCount())
 		return true
 	}
@@ -313,13 +429,15 @@ func (pool *txPoolImpl) retryTxs(txs []*commonPb.Transaction) {
 	}
 
 	pool.queue.deleteTxsInPending(txs)
+	pool.resetTxNonces(txs, true)
 	if len(configTxs) > 0 {
 		pool.log.Debugf("retryTxBatch config txs count: %d, txIds: %v", len(configTxs), configTxIds)
-		pool.queue.addTxsToConfigQueue(&mempoolTxs{txs: configTxs, source: protocol.INTERNAL})
+		pool.removeRejectedTxs(configTxs, pool.queue.addTxsToConfigQueue(&mempoolTxs{txs: configTxs,
+			source: protocol.INTERNAL}))
 	}
 	if len(commonTxs) > 0 {
 		pool.log.Debugf("retryTxBatch common txs count: %d, txIds: %v", len(commonTxs), commonTxIds)
-		pool.queue.addTxsToCommonQueue(&mempoolTxs{txs: commonTxs, source: protocol.INTERNAL})
+		pool.addCommonTxs(commonTxs, protocol.INTERNAL)
 	}
 	pool.log.Infof("retryTxs elapse time: %d", utils.CurrentTimeMillisSeconds()-start)
 }
@@ -350,12 +468,18 @@ func (pool *txPoolImpl) removeTxs(txs []*commonPb.Transaction) {
 		pool.log.Debugf("removeTxBatch common txs count: %d, txIds: %v", len(commonTxIds), commonTxIds)
 		pool.queue.deleteCommonTxs(commonTxIds)
 	}
+	if pool.txWal != nil {
+		if err := pool.txWal.RemoveTxs(txs); err != nil {
+			pool.log.Errorf("persist removed txs failed, %s", err)
+		}
+	}
+	pool.resetTxNonces(txs, false)
 	pool.log.Infof("removeTxs elapse time: %d", utils.CurrentTimeMillisSeconds()-start)
 }
 
 func (pool *txPoolImpl) FetchTxBatch(blockHeight uint64) []*commonPb.Transaction {
 	start := utils.CurrentTimeMillisSeconds()
-	txs := pool.queue.fetch(poolconf.MaxTxCount(pool.chainConf), blockHeight, pool.validateTxTime)
+	txs := pool.queue.fetch(poolconf.MaxTxCount(pool.chainConf), blockHeight, pool.newFetchValidator())
 	if len(txs) > 0 {
 		pool.log.Infof("fetch txs from txPool, txsNum:%d, blockHeight:%d, elapse time: %d", len(txs), blockHeight, utils.CurrentTimeMillisSeconds()-start)
 	}
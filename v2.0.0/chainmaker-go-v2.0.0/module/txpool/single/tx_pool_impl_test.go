@@ -17,6 +17,7 @@ import (
 
 	"chainmaker.org/chainmaker-go/chainconf"
 	"chainmaker.org/chainmaker-go/localconf"
+	"chainmaker.org/chainmaker-go/txpool/poolwal"
 	"chainmaker.org/chainmaker-go/utils"
 	commonErrors "chainmaker.org/chainmaker/common/v2/errors"
 	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
@@ -339,6 +340,84 @@ func TestTxPoolImpl_RetryAndRemoveTxs(t *testing.T) {
 	//require.EqualValues(t, 0, imlPool.queue.pendingCache.Size())
 }
 
+func TestTxPoolImpl_PersistTxs(t *testing.T) {
+	testPool, fn := newTestPool(t, 2000)
+	txPool := testPool.txPool
+	defer fn()
+	imlPool := txPool.(*txPoolImpl)
+	dir := t.TempDir()
+	txWal, err := poolwal.Open(dir, log)
+	require.NoError(t, err)
+	imlPool.txWal = txWal
+	commonTxs := generateTxs(10, false)
+
+	// 1. the txs in blockchain are rejected when flushed to the queue, they are not persisted
+	for _, tx := range commonTxs[5:8] {
+		testPool.extTxs[tx.Payload.TxId] = tx
+	}
+	for _, tx := range commonTxs[:8] {
+		require.NoError(t, txPool.AddTx(tx, protocol.RPC))
+	}
+	time.Sleep(time.Second)
+	require.EqualValues(t, 5, imlPool.queue.commonTxsCount())
+
+	// 2. the retried txs which are in blockchain now are removed from the wal
+	txs := txPool.FetchTxBatch(1)
+	require.Len(t, txs, 5)
+	testPool.extTxs[commonTxs[0].Payload.TxId] = commonTxs[0]
+	txPool.RetryAndRemoveTxs(txs, nil)
+	require.EqualValues(t, 4, imlPool.queue.commonTxsCount())
+
+	// 3. the txs removed are removed from the wal
+	txPool.RetryAndRemoveTxs(nil, commonTxs[1:2])
+	require.EqualValues(t, 3, imlPool.queue.commonTxsCount())
+
+	imlPool.txWal = nil
+	require.NoError(t, txWal.Close())
+	txWal, err = poolwal.Open(dir, log)
+	require.NoError(t, err)
+	defer txWal.Close()
+	replayTxs, err := txWal.Replay(nil)
+	require.NoError(t, err)
+	require.ElementsMatch(t, getTxIds(commonTxs[2:5]), getTxIds(replayTxs))
+}
+
+func TestTxPoolImpl_PersistTxsBeforeFlush(t *testing.T) {
+	chainConf, _ := chainconf.NewChainConf(nil)
+	chainConf.ChainConf = &configpb.ChainConfig{
+		Block:    &configpb.BlockConfig{},
+		Contract: &configpb.ContractConfig{},
+	}
+	localconf.ChainMakerConfig.TxPoolConfig.MaxTxPoolSize = 100
+	localconf.ChainMakerConfig.TxPoolConfig.MaxConfigTxPoolSize = 10
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	// the pool is not started, so the txs are never flushed to the queue
+	txPool, err := NewTxPoolImpl("test_chain", newMockBlockChainStore(ctrl).store, newMockMessageBus(ctrl), chainConf,
+		newMockAccessControlProvider(ctrl), newMockNet(ctrl), log)
+	require.NoError(t, err)
+	imlPool := txPool.(*txPoolImpl)
+	dir := t.TempDir()
+	txWal, err := poolwal.Open(dir, log)
+	require.NoError(t, err)
+	imlPool.txWal = txWal
+
+	commonTxs := generateTxs(3, false)
+	for _, tx := range commonTxs {
+		require.NoError(t, txPool.AddTx(tx, protocol.P2P))
+	}
+	require.EqualValues(t, 0, imlPool.queue.commonTxsCount())
+
+	// the node crashes before the flush, the txs acknowledged are replayed after restart
+	require.NoError(t, txWal.Close())
+	txWal, err = poolwal.Open(dir, log)
+	require.NoError(t, err)
+	defer txWal.Close()
+	replayTxs, err := txWal.Replay(nil)
+	require.NoError(t, err)
+	require.ElementsMatch(t, getTxIds(commonTxs), getTxIds(replayTxs))
+}
+
 func TestPoolImplConcurrencyInvoke(t *testing.T) {
 	testPool, fn := newTestPool(t, 2000000)
 	txPool := testPool.txPool
@@ -7,8 +7,10 @@ SPDX-License-Identifier: Apache-2.0
 package single
 
 import (
+	"errors"
 	"fmt"
 	"math"
+	"strconv"
 	"sync"
 
 	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
@@ -27,6 +29,10 @@ type txList struct {
 	log              protocol.Logger
 	blockchainStore  protocol.BlockchainStore
 	metricTxPoolSize *prometheus.GaugeVec
+	metricClassSize  *prometheus.GaugeVec
+	policy           orderingPolicy // The order of fetching txs, nil means in the order of arrival
+	maxSize          func() int     // The capacity under the policy, the lowest ranked tx is evicted for a higher one
+	classes          *txClasses
 
 	rwLock       sync.RWMutex
 	queue        *linkedhashmap.LinkedHashMap // Orderly store TXS: txs
@@ -40,21 +46,41 @@ func newTxList(log protocol.Logger, pendingCache *sync.Map, blockchainStore prot
 		rwLock:          sync.RWMutex{},
 		queue:           linkedhashmap.NewLinkedHashMap(),
 		pendingCache:    pendingCache,
+		classes:         newTxClasses(),
 	}
 	if localconf.ChainMakerConfig.MonitorConfig.Enabled {
 		list.metricTxPoolSize = monitor.NewGaugeVec(monitor.SUBSYSTEM_TXPOOL, "metric_tx_pool_size", "tx pool size", "chainId", "poolType")
+		list.metricClassSize = monitor.NewGaugeVec(monitor.SUBSYSTEM_TXPOOL, "metric_tx_pool_class_size",
+			"tx pool size of each priority class", "chainId", "class")
 	}
 	return list
 }
 
-// Put Add transaction to the txList
-func (l *txList) Put(txs []*commonPb.Transaction, source protocol.TxSource, validate txValidateFunc) {
+// setPolicy Set the ordering policy and the capacity of the list, it must be called before any tx is added.
+// When the list is full, the tx ranked lower than the lowest one is rejected, otherwise the lowest one is evicted.
+func (l *txList) setPolicy(policy orderingPolicy, maxSize func() int) {
+	l.rwLock.Lock()
+	defer l.rwLock.Unlock()
+	l.policy = policy
+	l.maxSize = maxSize
+}
+
+// Put Add transaction to the txList, returns the txs accepted and the txs evicted for them
+func (l *txList) Put(txs []*commonPb.Transaction, source protocol.TxSource,
+	validate txValidateFunc) (accepted, evicted []*commonPb.Transaction) {
 	if len(txs) == 0 {
-		return
+		return nil, nil
 	}
 
+	accepted = make([]*commonPb.Transaction, 0, len(txs))
 	for _, tx := range txs {
-		l.addTxs(tx, source, validate)
+		ok, evictedTx := l.addTxs(tx, source, validate)
+		if ok {
+			accepted = append(accepted, tx)
+		}
+		if evictedTx != nil {
+			evicted = append(evicted, evictedTx)
+		}
 	}
 	if localconf.ChainMakerConfig.MonitorConfig.Enabled {
 		if utils.IsConfigTx(txs[0]) {
@@ -62,23 +88,56 @@ func (l *txList) Put(txs []*commonPb.Transaction, source protocol.TxSource, vali
 		} else {
 			go l.metricTxPoolSize.WithLabelValues(txs[0].Payload.ChainId, "normal").Set(float64(l.queue.Size()))
 		}
+		l.rwLock.RLock()
+		l.monitorClasses(txs[0].Payload.ChainId)
+		l.rwLock.RUnlock()
 	}
+	return accepted, evicted
 }
 
-func (l *txList) addTxs(tx *commonPb.Transaction, source protocol.TxSource, validate txValidateFunc) {
+// addTxs add the tx to the queue, returns whether the tx is accepted and the tx evicted for it. The tx is only
+// ranked against the lowest one after it is validated, so an invalid tx never evicts others. The txs retried or
+// replayed internally are not limited by the capacity.
+func (l *txList) addTxs(tx *commonPb.Transaction, source protocol.TxSource,
+	validate txValidateFunc) (bool, *commonPb.Transaction) {
 	l.rwLock.Lock()
 	defer l.rwLock.Unlock()
-	if validate == nil || validate(tx, source) == nil {
-		if source != protocol.INTERNAL {
-			if val, ok := l.pendingCache.Load(tx.Payload.TxId); ok && val != nil {
-				return
-			}
-		}
-		if l.queue.Get(tx.Payload.TxId) != nil {
-			return
+	if validate != nil && validate(tx, source) != nil {
+		return false, nil
+	}
+	if source != protocol.INTERNAL {
+		if val, ok := l.pendingCache.Load(tx.Payload.TxId); ok && val != nil {
+			return false, nil
 		}
+	}
+	if l.queue.Get(tx.Payload.TxId) != nil {
+		return false, nil
+	}
+	if l.policy == nil {
 		l.queue.Add(tx.Payload.TxId, tx)
+		return true, nil
 	}
+	var (
+		rank    = l.policy.rank(tx)
+		evicted *commonPb.Transaction
+	)
+	if source != protocol.INTERNAL && l.maxSize != nil && l.queue.Size() >= l.maxSize() {
+		lowest := l.classes.lowest()
+		if lowest == nil || !rank.before(lowest.rank) {
+			return false, nil
+		}
+		evicted = l.queue.Get(lowest.txId).(*commonPb.Transaction)
+		l.remove(lowest.txId)
+	}
+	l.queue.Add(tx.Payload.TxId, tx)
+	l.classes.add(tx.Payload.TxId, rank)
+	return true, evicted
+}
+
+// remove Remove the tx from the queue, the caller must hold the lock
+func (l *txList) remove(txId string) {
+	l.queue.Remove(txId)
+	l.classes.remove(txId)
 }
 
 // Delete Delete transactions from TXList by the txIds
@@ -87,7 +146,7 @@ func (l *txList) Delete(txIds []string) {
 	defer l.rwLock.Unlock()
 	l.log.Debugf("remove txIds num: %d", len(txIds))
 	for _, txId := range txIds {
-		l.queue.Remove(txId)
+		l.remove(txId)
 		l.pendingCache.Delete(txId)
 	}
 
@@ -113,10 +172,10 @@ func (l *txList) Fetch(count int, validate func(tx *commonPb.Transaction) error,
 		}
 		begin := utils.CurrentTimeMillisSeconds()
 		for _, txId := range errKeys {
-			l.queue.Remove(txId)
+			l.remove(txId)
 		}
 		for _, val := range cacheKVs {
-			l.queue.Remove(val.tx.Payload.TxId)
+			l.remove(val.tx.Payload.TxId)
 			l.pendingCache.Store(val.tx.Payload.TxId, val)
 		}
 		l.rwLock.Unlock()
@@ -124,7 +183,10 @@ func (l *txList) Fetch(count int, validate func(tx *commonPb.Transaction) error,
 	}()
 
 	l.log.Debugw("txList Fetch", "count", count, "queueLen", queueLen)
-	if queueLen > 0 {
+	if queueLen > 0 && l.policy != nil {
+		cacheKVs, txs, txIds, errKeys = l.getTxsByPolicy(count, blockHeight, validate)
+		l.log.Debugw("txList Fetch txsByPolicy", "count", count, "queueLen", queueLen, "txsLen", len(txs), "errKeys", len(errKeys), "cacheKeys", len(cacheKVs))
+	} else if queueLen > 0 {
 		cacheKVs, txs, txIds, errKeys = l.getTxsFromQueue(count, blockHeight, validate)
 		l.log.Debugw("txList Fetch txsNormal", "count", count, "queueLen", queueLen, "txsLen", len(txs), "errKeys", len(errKeys), "cacheKeys", len(cacheKVs))
 	}
@@ -142,7 +204,16 @@ func (l *txList) getTxsFromQueue(count int, blockHeight uint64, validate func(tx
 	for node != nil && count > 0 {
 		txId := node.Value.(string)
 		tx := l.queue.Get(txId).(*commonPb.Transaction)
-		if validate != nil && validate(tx) != nil {
+		var err error
+		if validate != nil {
+			err = validate(tx)
+		}
+		if errors.Is(err, utils.ErrTxNonceGap) {
+			// the tx waits in the queue for the txs of lower nonce of the sender
+			node = node.Next()
+			continue
+		}
+		if err != nil {
 			errKeys = append(errKeys, txId)
 		} else {
 			txs = append(txs, tx)
@@ -161,6 +232,67 @@ func (l *txList) getTxsFromQueue(count int, blockHeight uint64, validate func(tx
 	return
 }
 
+// getTxsByPolicy Gets the txs in the order of the policy, the txs exceeding the cap of the sender are
+// left in the queue for the next block
+func (l *txList) getTxsByPolicy(count int, blockHeight uint64, validate func(tx *commonPb.Transaction) error) (
+	cacheKVs []*valInPendingCache, txs []*commonPb.Transaction, txIds []string, errKeys []string) {
+
+	txs = make([]*commonPb.Transaction, 0, count)
+	txIds = make([]string, 0, count)
+	errKeys = make([]string, 0, count)
+	cacheKVs = make([]*valInPendingCache, 0, count)
+
+	var (
+		senderCap = l.policy.senderCap()
+		senderTxs = make(map[string]int)
+	)
+	// the fetched and the invalid txs are removed from the heaps by the caller
+	l.classes.walk(func(ranked *rankedTx) bool {
+		if count <= 0 {
+			return false
+		}
+		if senderCap > 0 && senderTxs[ranked.rank.sender] >= senderCap {
+			return true
+		}
+		tx := l.queue.Get(ranked.txId).(*commonPb.Transaction)
+		var err error
+		if validate != nil {
+			err = validate(tx)
+		}
+		if errors.Is(err, utils.ErrTxNonceGap) {
+			return true
+		}
+		if err != nil {
+			errKeys = append(errKeys, ranked.txId)
+		} else {
+			txs = append(txs, tx)
+			txIds = append(txIds, ranked.txId)
+			cacheKVs = append(cacheKVs, &valInPendingCache{
+				tx:            tx,
+				inBlockHeight: blockHeight,
+			})
+			senderTxs[ranked.rank.sender]++
+		}
+		count--
+		return count > 0
+	})
+	return
+}
+
+// OutranksLowest Whether the tx is ranked before the lowest ranked tx, so that it evicts the lowest one
+// if it is accepted when the list is full. It is false if the list has no ordering policy.
+func (l *txList) OutranksLowest(tx *commonPb.Transaction) bool {
+	if l.policy == nil {
+		return false
+	}
+	rank := l.policy.rank(tx)
+
+	l.rwLock.RLock()
+	defer l.rwLock.RUnlock()
+	lowest := l.classes.lowest()
+	return lowest != nil && rank.before(lowest.rank)
+}
+
 func (l *txList) monitor(tx *commonPb.Transaction, len int) {
 	chainId := tx.Payload.ChainId
 	isConfigTx := utils.IsConfigTx(tx)
@@ -171,6 +303,17 @@ func (l *txList) monitor(tx *commonPb.Transaction, len int) {
 		} else {
 			go l.metricTxPoolSize.WithLabelValues(chainId, "normal").Set(float64(len))
 		}
+		l.monitorClasses(chainId)
+	}
+}
+
+// monitorClasses Report the size of each priority class, the caller must hold the lock
+func (l *txList) monitorClasses(chainId string) {
+	if l.policy == nil || l.metricClassSize == nil {
+		return
+	}
+	for class, queue := range l.classes.classes {
+		l.metricClassSize.WithLabelValues(chainId, strconv.FormatInt(class, 10)).Set(float64(queue.size()))
 	}
 }
 
@@ -212,7 +355,7 @@ func (l *txList) appendTxsToPendingCache(txs []*commonPb.Transaction, blockHeigh
 	defer l.rwLock.Unlock()
 	for _, tx := range txs {
 		l.pendingCache.Store(tx.Payload.TxId, &valInPendingCache{tx: tx, inBlockHeight: blockHeight})
-		l.queue.Remove(tx.Payload.TxId)
+		l.remove(tx.Payload.TxId)
 	}
 }
 
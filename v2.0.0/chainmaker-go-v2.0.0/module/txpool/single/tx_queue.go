@@ -11,6 +11,7 @@ import (
 	"math"
 	"sync"
 
+	"chainmaker.org/chainmaker-go/txpool/poolconf"
 	"chainmaker.org/chainmaker-go/utils"
 	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
 	"chainmaker.org/chainmaker/protocol/v2"
@@ -39,12 +40,25 @@ func newQueue(blockStore protocol.BlockchainStore, log protocol.Logger, validate
 	return &queue
 }
 
-func (queue *txQueue) addTxsToConfigQueue(memTxs *mempoolTxs) {
-	queue.configTxQueue.Put(memTxs.txs, memTxs.source, queue.validate)
+// setOrderingPolicy set the policy to order the common txs, the config txs are always in the order of arrival
+func (queue *txQueue) setOrderingPolicy(policy orderingPolicy) {
+	queue.commonTxQueue.setPolicy(policy, poolconf.MaxCommonTxPoolSize)
 }
 
-func (queue *txQueue) addTxsToCommonQueue(memTxs *mempoolTxs) {
-	queue.commonTxQueue.Put(memTxs.txs, memTxs.source, queue.validate)
+// addTxsToConfigQueue add the txs to the config queue, returns the txs accepted
+func (queue *txQueue) addTxsToConfigQueue(memTxs *mempoolTxs) []*commonPb.Transaction {
+	accepted, _ := queue.configTxQueue.Put(memTxs.txs, memTxs.source, queue.validate)
+	return accepted
+}
+
+// addTxsToCommonQueue add the txs to the common queue, returns the txs accepted and the txs evicted for them
+func (queue *txQueue) addTxsToCommonQueue(memTxs *mempoolTxs) (accepted, evicted []*commonPb.Transaction) {
+	return queue.commonTxQueue.Put(memTxs.txs, memTxs.source, queue.validate)
+}
+
+// outranksLowestCommonTx whether the tx evicts the lowest ranked common tx if it is accepted
+func (queue *txQueue) outranksLowestCommonTx(tx *commonPb.Transaction) bool {
+	return queue.commonTxQueue.OutranksLowest(tx)
 }
 
 func (queue *txQueue) deleteTxsInPending(txIds []*commonPb.Transaction) {
@@ -14,11 +14,16 @@ import (
 
 	"chainmaker.org/chainmaker/common/v2/crypto/hash"
 	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	configPb "chainmaker.org/chainmaker/pb-go/v2/config"
 	consensusPb "chainmaker.org/chainmaker/pb-go/v2/consensus"
 	"chainmaker.org/chainmaker/protocol/v2"
 	"github.com/gogo/protobuf/proto"
 )
 
+// BlockStateRootKey is the key of the state root in the extra data of block, pb BlockHeader has no field of it,
+// so the state root is covered by the block hash together with the header, see calcUnsignedBlockBytes
+const BlockStateRootKey = "StateRoot"
+
 // CalcBlockHash calculate block hash
 func CalcBlockHash(hashType string, b *commonPb.Block) ([]byte, error) {
 	if b == nil {
@@ -64,6 +69,9 @@ func FormatBlock(b *commonPb.Block) string {
 	serializedBlock.WriteString(fmt.Sprintf("Proposer:\t%x\n", b.Header.Proposer))
 	serializedBlock.WriteString(fmt.Sprintf("ConsensusArgs:\t%x\n", b.Header.ConsensusArgs))
 	serializedBlock.WriteString(fmt.Sprintf("TxCount:\t%d\n", b.Header.TxCount))
+	if stateRoot := GetBlockStateRoot(b); stateRoot != nil {
+		serializedBlock.WriteString(fmt.Sprintf("StateRoot:\t%x\n", stateRoot))
+	}
 	serializedBlock.WriteString("------------block signed part ends-------------\n")
 	serializedBlock.WriteString(fmt.Sprintf("BlockHash:\t%x\n", b.Header.BlockHash))
 	serializedBlock.WriteString(fmt.Sprintf("Signature:\t%x\n", b.Header.Signature))
@@ -73,6 +81,7 @@ func FormatBlock(b *commonPb.Block) string {
 
 // calcUnsignedBlockBytes calculate unsigned block bytes
 // since dag & txs are already included in block header, we can safely set this two field to nil
+// the state root is appended to the header bytes if the block has it
 func calcUnsignedBlockBytes(b *commonPb.Block) ([]byte, error) {
 	//block := &commonPb.Block{
 	//	Header: &commonPb.BlockHeader{
@@ -102,9 +111,32 @@ func calcUnsignedBlockBytes(b *commonPb.Block) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
+	if stateRoot := GetBlockStateRoot(b); stateRoot != nil {
+		blockBytes = append(blockBytes, stateRoot...)
+	}
 	return blockBytes, nil
 }
 
+// GetBlockStateRoot returns the state root committed in block, which is the root of state tree after the
+// previous block, or nil if the block has no state root
+func GetBlockStateRoot(block *commonPb.Block) []byte {
+	if block == nil || block.AdditionalData == nil || block.AdditionalData.ExtraData == nil {
+		return nil
+	}
+	return block.AdditionalData.ExtraData[BlockStateRootKey]
+}
+
+// SetBlockStateRoot sets the state root of block, it must be set before the block hash is calculated
+func SetBlockStateRoot(block *commonPb.Block, stateRoot []byte) {
+	if block.AdditionalData == nil {
+		block.AdditionalData = &commonPb.AdditionalData{}
+	}
+	if block.AdditionalData.ExtraData == nil {
+		block.AdditionalData.ExtraData = make(map[string][]byte)
+	}
+	block.AdditionalData.ExtraData[BlockStateRootKey] = stateRoot
+}
+
 type BlockFingerPrint string
 
 // CalcBlockFingerPrint since the block has not yet formed, snapshot uses fingerprint as the possible unique value of the block
@@ -233,6 +265,36 @@ func VerifyBlockSig(hashType string, b *commonPb.Block, ac protocol.AccessContro
 	}
 	return true, nil
 }
+
+// VerifyBlockProposerSig verify the block hash and the proposer signature of the block,
+// the proposer must belong to an org of the consensus nodes in chain config
+func VerifyBlockProposerSig(chainConfig *configPb.ChainConfig, b *commonPb.Block, ac protocol.AccessControlProvider) error {
+	if b == nil || b.Header == nil || b.Header.Proposer == nil || len(b.Header.Signature) == 0 {
+		return fmt.Errorf("invalid block, proposer or signature is empty")
+	}
+	hashedBlock, err := CalcBlockHash(chainConfig.Crypto.Hash, b)
+	if err != nil {
+		return fmt.Errorf("fail to hash block: %v", err)
+	}
+	if !bytes.Equal(hashedBlock, b.Header.BlockHash) {
+		return fmt.Errorf("block hash mismatch, expect: %x, actual: %x", hashedBlock, b.Header.BlockHash)
+	}
+	isConsensusOrg := false
+	for _, node := range chainConfig.Consensus.Nodes {
+		if node.OrgId == b.Header.Proposer.OrgId {
+			isConsensusOrg = true
+			break
+		}
+	}
+	if !isConsensusOrg {
+		return fmt.Errorf("proposer org[%s] is not in consensus node list", b.Header.Proposer.OrgId)
+	}
+	if _, err = VerifyBlockSig(chainConfig.Crypto.Hash, b, ac); err != nil {
+		return err
+	}
+	return nil
+}
+
 func IsContractMgmtBlock(b *commonPb.Block) bool {
 	if len(b.Txs) == 0 {
 		return false
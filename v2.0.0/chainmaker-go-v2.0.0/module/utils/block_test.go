@@ -10,6 +10,7 @@ package utils
 import (
 	"chainmaker.org/chainmaker/pb-go/v2/accesscontrol"
 	"chainmaker.org/chainmaker/pb-go/v2/common"
+	"chainmaker.org/chainmaker/pb-go/v2/config"
 	"github.com/stretchr/testify/assert"
 	"testing"
 	"time"
@@ -46,3 +47,30 @@ func TestCalcUnsignedBlockBytes(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, bytes, data2)
 }
+
+func TestVerifyBlockProposerSig(t *testing.T) {
+	chainConfig := &config.ChainConfig{
+		Crypto:    &config.CryptoConfig{Hash: "SHA256"},
+		Consensus: &config.ConsensusConfig{Nodes: []*config.OrgConfig{{OrgId: "org1"}}},
+	}
+	h := &common.BlockHeader{BlockHeight: 1,
+		ChainId:        "chain1",
+		BlockTimestamp: time.Now().Unix(),
+		Proposer:       &accesscontrol.Member{OrgId: "org2", MemberInfo: []byte("User1")},
+		Signature:      []byte("sign1")}
+	b := &common.Block{Header: h}
+
+	// block hash mismatch
+	h.BlockHash = []byte("hash1")
+	assert.NotNil(t, VerifyBlockProposerSig(chainConfig, b, nil))
+
+	// proposer is not a consensus org
+	hash, err := CalcBlockHash(chainConfig.Crypto.Hash, b)
+	assert.Nil(t, err)
+	h.BlockHash = hash
+	assert.NotNil(t, VerifyBlockProposerSig(chainConfig, b, nil))
+
+	// no signature
+	h.Signature = nil
+	assert.NotNil(t, VerifyBlockProposerSig(chainConfig, b, nil))
+}
@@ -0,0 +1,48 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package utils
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+
+	configPb "chainmaker.org/chainmaker/pb-go/v2/config"
+)
+
+const (
+	// EthChainIdConfigKey the key in consensus.ext_config of chain config which specifies the EIP-155 chain id
+	// of the ethereum txs mapped to the chain, the ethereum txs are rejected if it is not set.
+	//		- key: evm.eth_chain_id
+	//		  value: 1337
+	EthChainIdConfigKey = "evm.eth_chain_id"
+
+	ethNoncePrefix = "ETH_NONCE/"
+)
+
+// GetEthChainId returns the EIP-155 chain id of the ethereum txs in chain config, nil if not set
+func GetEthChainId(chainConfig *configPb.ChainConfig) (*big.Int, error) {
+	if chainConfig == nil || chainConfig.Consensus == nil {
+		return nil, nil
+	}
+	for _, kv := range chainConfig.Consensus.ExtConfig {
+		if kv.Key == EthChainIdConfigKey {
+			chainId, ok := new(big.Int).SetString(string(kv.Value), 10)
+			if !ok || chainId.Sign() <= 0 {
+				return nil, fmt.Errorf("invalid %s %s in chain config", EthChainIdConfigKey, kv.Value)
+			}
+			return chainId, nil
+		}
+	}
+	return nil, nil
+}
+
+// EthNonceKey returns the key of the count of the ethereum txs sent by the address in state, it is stored
+// under TxNonceContractName with the same encoding as the tx nonce
+func EthNonceKey(address []byte) []byte {
+	return []byte(ethNoncePrefix + hex.EncodeToString(address))
+}
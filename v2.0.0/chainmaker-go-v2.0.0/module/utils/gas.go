@@ -0,0 +1,112 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package utils
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	configPb "chainmaker.org/chainmaker/pb-go/v2/config"
+	"chainmaker.org/chainmaker/protocol/v2"
+)
+
+const (
+	// GasPriceConfigKey the key of gas price in consensus.ext_config of chain config, the fee of tx is
+	// gasUsed * price, the fee is not charged if it is absent or 0
+	//		- key: gas.price
+	//		  value: 1
+	GasPriceConfigKey = "gas.price"
+
+	// TxGasLimitLen the length of gas limit in the Limit field of tx payload, uint64 in big endian
+	TxGasLimitLen = 8
+	// TxGasLimitWithPriceLen the length of the Limit field of tx payload in which the gas limit is followed by the
+	// gas price bid by the sender, uint64 in big endian. The bid is charged if it is higher than the gas price
+	// in chain config, and the tx of higher price is fetched earlier by the priority ordering of txpool
+	TxGasLimitWithPriceLen = TxGasLimitLen + 8
+)
+
+// NewTxGasLimit encode the gas limit of tx, the result is set to the Limit field of tx payload
+func NewTxGasLimit(gasLimit uint64) []byte {
+	limit := make([]byte, TxGasLimitLen)
+	binary.BigEndian.PutUint64(limit, gasLimit)
+	return limit
+}
+
+// NewTxGasLimitWithPrice encode the gas limit and the gas price bid by the sender of tx, the result is set to
+// the Limit field of tx payload
+func NewTxGasLimitWithPrice(gasLimit, gasPrice uint64) []byte {
+	limit := make([]byte, TxGasLimitWithPriceLen)
+	binary.BigEndian.PutUint64(limit, gasLimit)
+	binary.BigEndian.PutUint64(limit[TxGasLimitLen:], gasPrice)
+	return limit
+}
+
+// ParseTxGasLimit decode the gas limit from the Limit field of tx payload.
+// protocol.GasLimit is returned if the limit is empty, and the gas limit can not exceed protocol.GasLimit.
+func ParseTxGasLimit(limit []byte) (uint64, error) {
+	if len(limit) == 0 {
+		return protocol.GasLimit, nil
+	}
+	if len(limit) != TxGasLimitLen && len(limit) != TxGasLimitWithPriceLen {
+		return 0, fmt.Errorf("invalid tx gas limit, expect %d or %d bytes, got %d", TxGasLimitLen,
+			TxGasLimitWithPriceLen, len(limit))
+	}
+	gasLimit := binary.BigEndian.Uint64(limit)
+	if gasLimit == 0 {
+		return 0, errors.New("invalid tx gas limit, it must be greater than 0")
+	}
+	if gasLimit > protocol.GasLimit {
+		return protocol.GasLimit, nil
+	}
+	return gasLimit, nil
+}
+
+// TxGasLimit returns the gas limit of tx, protocol.GasLimit is returned if the limit is invalid,
+// the tx with invalid limit is rejected by scheduler before running vm.
+func TxGasLimit(tx *commonPb.Transaction) uint64 {
+	if tx == nil || tx.Payload == nil {
+		return protocol.GasLimit
+	}
+	gasLimit, err := ParseTxGasLimit(tx.Payload.Limit)
+	if err != nil {
+		return protocol.GasLimit
+	}
+	return gasLimit
+}
+
+// TxGasPrice returns the gas price charged for the tx, which is the higher one of the price bid by the sender and
+// chainGasPrice, the price in chain config. It is 0 if chainGasPrice is 0, as no fee is charged.
+func TxGasPrice(tx *commonPb.Transaction, chainGasPrice uint64) uint64 {
+	if chainGasPrice == 0 || tx == nil || tx.Payload == nil || len(tx.Payload.Limit) != TxGasLimitWithPriceLen {
+		return chainGasPrice
+	}
+	if price := binary.BigEndian.Uint64(tx.Payload.Limit[TxGasLimitLen:]); price > chainGasPrice {
+		return price
+	}
+	return chainGasPrice
+}
+
+// GetGasPrice returns the gas price in chain config, 0 means no fee is charged
+func GetGasPrice(chainConfig *configPb.ChainConfig) (uint64, error) {
+	if chainConfig == nil || chainConfig.Consensus == nil {
+		return 0, nil
+	}
+	for _, kv := range chainConfig.Consensus.ExtConfig {
+		if kv.Key != GasPriceConfigKey {
+			continue
+		}
+		price, err := strconv.ParseUint(string(kv.Value), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("%s error, actual: %s", GasPriceConfigKey, kv.Value)
+		}
+		return price, nil
+	}
+	return 0, nil
+}
@@ -0,0 +1,149 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"chainmaker.org/chainmaker/pb-go/v2/accesscontrol"
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	"chainmaker.org/chainmaker/pb-go/v2/syscontract"
+	"chainmaker.org/chainmaker/protocol/v2"
+	"github.com/mr-tron/base58/base58"
+)
+
+// gasFeeBalanceFormat the key of the balance of an address, the same as dposmgr.KeyBalanceFormat
+const gasFeeBalanceFormat = "B/%s"
+
+// GasFeeContractName the contract in which the gas fees are paid, the balances of the dpos erc20 contract
+var GasFeeContractName = syscontract.SystemContract_DPOS_ERC20.String()
+
+// GetStateFunc reads the value of the key of the contract in state, e.g. TxSimContext.Get
+type GetStateFunc func(contractName string, key []byte) ([]byte, error)
+
+// GasFee returns gas * gasPrice
+func GasFee(gas uint64, gasPrice uint64) *BigInteger {
+	fee := new(big.Int).Mul(new(big.Int).SetUint64(gas), new(big.Int).SetUint64(gasPrice))
+	return &BigInteger{Value: fee}
+}
+
+// GasFeeBalanceKey returns the key of the balance of the address in GasFeeContractName
+func GasFeeBalanceKey(address string) []byte {
+	return []byte(fmt.Sprintf(gasFeeBalanceFormat, address))
+}
+
+// MemberAddress returns the address of the member in the dpos erc20 contract, which is the sha256 of the public key
+// of the member cert in base58. The cert of the member of cert hash is read from the cert manage contract.
+func MemberAddress(member *accesscontrol.Member, getState GetStateFunc) (string, error) {
+	if member == nil {
+		return "", errors.New("member is nil")
+	}
+	var cert []byte
+	switch member.MemberType {
+	case accesscontrol.MemberType_CERT:
+		cert = member.MemberInfo
+	case accesscontrol.MemberType_CERT_HASH:
+		certHash := hex.EncodeToString(member.MemberInfo)
+		var err error
+		cert, err = getState(syscontract.SystemContract_CERT_MANAGE.String(), []byte(certHash))
+		if err != nil {
+			return "", fmt.Errorf("can not load whole cert info, member[%s], %s", certHash, err)
+		}
+	default:
+		return "", errors.New("invalid member type")
+	}
+	return CertAddress(cert)
+}
+
+// CertAddress returns the address of the cert in the dpos erc20 contract, see MemberAddress
+func CertAddress(certPEM []byte) (string, error) {
+	certificate, err := ParseCert(certPEM)
+	if err != nil {
+		return "", fmt.Errorf("parse cert failed, %s", err)
+	}
+	pubKeyBytes, err := certificate.PublicKey.Bytes()
+	if err != nil {
+		return "", fmt.Errorf("load public key from cert failed, %s", err)
+	}
+	addressBytes := sha256.Sum256(pubKeyBytes)
+	return base58.Encode(addressBytes[:]), nil
+}
+
+// GasFeeBalance returns the balance of the address in GasFeeContractName
+func GasFeeBalance(address string, getState GetStateFunc) (*BigInteger, error) {
+	value, err := getState(GasFeeContractName, GasFeeBalanceKey(address))
+	if err != nil {
+		return nil, err
+	}
+	if len(value) == 0 {
+		return NewZeroBigInteger(), nil
+	}
+	balance := NewBigInteger(string(value))
+	if balance == nil {
+		return nil, fmt.Errorf("invalid balance of address[%s]: %s", address, value)
+	}
+	return balance, nil
+}
+
+// CheckGasFee checks whether the balance of the tx sender is enough to pay the fee
+func CheckGasFee(txSimContext protocol.TxSimContext, fee *BigInteger) error {
+	_, _, err := payerBalance(txSimContext, fee)
+	return err
+}
+
+// PayGasFee deducts the gas fee of the tx from the balance of the sender. The fees are credited to the proposer
+// of the block once for all the txs by CreditGasFees, so that the txs do not conflict on the proposer balance.
+func PayGasFee(txSimContext protocol.TxSimContext, fee *BigInteger) error {
+	if fee.Cmp(NewZeroBigInteger()) <= 0 {
+		return nil
+	}
+	sender, balance, err := payerBalance(txSimContext, fee)
+	if err != nil {
+		return err
+	}
+	return txSimContext.Put(GasFeeContractName, GasFeeBalanceKey(sender), []byte(Sub(balance, fee).String()))
+}
+
+// payerBalance returns the address and the balance of the tx sender, which must be enough to pay the fee
+func payerBalance(txSimContext protocol.TxSimContext, fee *BigInteger) (string, *BigInteger, error) {
+	sender, err := MemberAddress(txSimContext.GetSender(), txSimContext.Get)
+	if err != nil {
+		return "", nil, err
+	}
+	balance, err := GasFeeBalance(sender, txSimContext.Get)
+	if err != nil {
+		return "", nil, err
+	}
+	if balance.Cmp(fee) < 0 {
+		return "", nil, fmt.Errorf("address balance is not enough to pay the gas fee, contract[%s] address[%s] "+
+			"balance[%s] < fee[%s]", GasFeeContractName, sender, balance.String(), fee.String())
+	}
+	return sender, balance, nil
+}
+
+// CreditGasFees returns the write which credits the gas fees of a block to the proposer, getState reads the state
+// after all the txs of the block
+func CreditGasFees(proposer *accesscontrol.Member, fees *BigInteger, getState GetStateFunc) (*commonPb.TxWrite,
+	error) {
+	address, err := MemberAddress(proposer, getState)
+	if err != nil {
+		return nil, err
+	}
+	balance, err := GasFeeBalance(address, getState)
+	if err != nil {
+		return nil, err
+	}
+	return &commonPb.TxWrite{
+		ContractName: GasFeeContractName,
+		Key:          GasFeeBalanceKey(address),
+		Value:        []byte(Sum(balance, fees).String()),
+	}, nil
+}
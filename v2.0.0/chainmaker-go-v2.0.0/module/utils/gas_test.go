@@ -0,0 +1,72 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package utils
+
+import (
+	"testing"
+
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	configPb "chainmaker.org/chainmaker/pb-go/v2/config"
+	"chainmaker.org/chainmaker/protocol/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTxGasLimit(t *testing.T) {
+	gasLimit, err := ParseTxGasLimit(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(protocol.GasLimit), gasLimit)
+
+	gasLimit, err = ParseTxGasLimit(NewTxGasLimit(10000))
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(10000), gasLimit)
+
+	gasLimit, err = ParseTxGasLimit(NewTxGasLimit(protocol.GasLimit + 1))
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(protocol.GasLimit), gasLimit)
+
+	_, err = ParseTxGasLimit(NewTxGasLimit(0))
+	assert.NotNil(t, err)
+	_, err = ParseTxGasLimit([]byte{1, 2, 3})
+	assert.NotNil(t, err)
+
+	tx := &commonPb.Transaction{Payload: &commonPb.Payload{Limit: []byte{1, 2, 3}}}
+	assert.Equal(t, uint64(protocol.GasLimit), TxGasLimit(tx))
+	tx.Payload.Limit = NewTxGasLimit(500)
+	assert.Equal(t, uint64(500), TxGasLimit(tx))
+
+	gasLimit, err = ParseTxGasLimit(NewTxGasLimitWithPrice(600, 3))
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(600), gasLimit)
+	_, err = ParseTxGasLimit(NewTxGasLimitWithPrice(0, 3))
+	assert.NotNil(t, err)
+}
+
+func TestTxGasPrice(t *testing.T) {
+	tx := &commonPb.Transaction{Payload: &commonPb.Payload{Limit: NewTxGasLimit(500)}}
+	assert.Equal(t, uint64(2), TxGasPrice(tx, 2))
+	tx.Payload.Limit = NewTxGasLimitWithPrice(500, 5)
+	assert.Equal(t, uint64(5), TxGasPrice(tx, 2))
+	assert.Equal(t, uint64(8), TxGasPrice(tx, 8))
+	// no fee is charged if the gas price in chain config is 0
+	assert.Equal(t, uint64(0), TxGasPrice(tx, 0))
+}
+
+func TestGetGasPrice(t *testing.T) {
+	chainConfig := &configPb.ChainConfig{Consensus: &configPb.ConsensusConfig{}}
+	price, err := GetGasPrice(chainConfig)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0), price)
+
+	chainConfig.Consensus.ExtConfig = []*configPb.ConfigKeyValue{{Key: GasPriceConfigKey, Value: "3"}}
+	price, err = GetGasPrice(chainConfig)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(3), price)
+
+	chainConfig.Consensus.ExtConfig[0].Value = "-1"
+	_, err = GetGasPrice(chainConfig)
+	assert.NotNil(t, err)
+}
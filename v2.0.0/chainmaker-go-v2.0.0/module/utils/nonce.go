@@ -0,0 +1,201 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"chainmaker.org/chainmaker/pb-go/v2/accesscontrol"
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	configPb "chainmaker.org/chainmaker/pb-go/v2/config"
+	"chainmaker.org/chainmaker/pb-go/v2/syscontract"
+)
+
+const (
+	// TxNonceConfigKey the key in consensus.ext_config of chain config which enables the nonce of the accounts.
+	// The common tx carries the nonce in the Sequence field of payload, it must be the nonce of the sender
+	// account in state plus 1, and the nonce in state is increased whether the tx succeeds or not.
+	// The config txs are not affected, their Sequence is the sequence of chain config.
+	//		- key: tx.nonce
+	//		  value: true
+	TxNonceConfigKey = "tx.nonce"
+
+	// TxNonceLen the length of the nonce in state, uint64 in big endian
+	TxNonceLen = 8
+
+	noncePrefix = "NONCE/"
+)
+
+var (
+	// TxNonceContractName the contract under which the nonces of the accounts are stored
+	TxNonceContractName = syscontract.SystemContract_CHAIN_CONFIG.String()
+
+	// ErrTxNonceTooLow the nonce of tx has been used
+	ErrTxNonceTooLow = errors.New("tx nonce too low")
+	// ErrTxNonceGap the nonce of tx is larger than the next nonce of the account
+	ErrTxNonceGap = errors.New("tx nonce gap")
+)
+
+// IsTxNonceEnabled whether the nonce of the accounts is enabled in chain config
+func IsTxNonceEnabled(chainConfig *configPb.ChainConfig) bool {
+	if chainConfig == nil || chainConfig.Consensus == nil {
+		return false
+	}
+	for _, kv := range chainConfig.Consensus.ExtConfig {
+		if kv.Key == TxNonceConfigKey {
+			enabled, err := strconv.ParseBool(string(kv.Value))
+			return err == nil && enabled
+		}
+	}
+	return false
+}
+
+// IsNonceTx whether the tx is required to carry the nonce when the nonce is enabled
+func IsNonceTx(tx *commonPb.Transaction) bool {
+	return tx != nil && tx.Payload != nil && !IsConfigTx(tx)
+}
+
+// TxNonceAccount returns the account of the sender whose nonce the tx uses, the member of cert and the
+// member of cert hash are the same account.
+func TxNonceAccount(tx *commonPb.Transaction, hashType string) (string, error) {
+	if tx == nil || tx.Sender == nil || tx.Sender.Signer == nil {
+		return "", errors.New("no sender in tx")
+	}
+	member := tx.Sender.Signer
+	var id []byte
+	switch member.MemberType {
+	case accesscontrol.MemberType_CERT:
+		certId, err := GetCertificateId(member.MemberInfo, hashType)
+		if err != nil {
+			return "", fmt.Errorf("get cert id of sender failed, %s", err)
+		}
+		id = certId
+	case accesscontrol.MemberType_CERT_HASH:
+		id = member.MemberInfo
+	default:
+		h := sha256.Sum256(member.MemberInfo)
+		id = h[:]
+	}
+	return member.OrgId + "/" + hex.EncodeToString(id), nil
+}
+
+// TxNonceKey returns the key of the nonce of the account in state
+func TxNonceKey(account string) []byte {
+	return []byte(noncePrefix + account)
+}
+
+// EncodeTxNonce encode the nonce stored in state
+func EncodeTxNonce(nonce uint64) []byte {
+	value := make([]byte, TxNonceLen)
+	binary.BigEndian.PutUint64(value, nonce)
+	return value
+}
+
+// DecodeTxNonce decode the nonce stored in state, it is 0 if the account has not sent any tx
+func DecodeTxNonce(value []byte) (uint64, error) {
+	if len(value) == 0 {
+		return 0, nil
+	}
+	if len(value) != TxNonceLen {
+		return 0, fmt.Errorf("invalid tx nonce, expect %d bytes, got %d", TxNonceLen, len(value))
+	}
+	return binary.BigEndian.Uint64(value), nil
+}
+
+// CheckTxNonce check the nonce of tx against the nonce of the account in state,
+// ErrTxNonceTooLow or ErrTxNonceGap is returned if it is not the next nonce.
+func CheckTxNonce(tx *commonPb.Transaction, nonce uint64) error {
+	switch next := nonce + 1; {
+	case tx.Payload.Sequence < next:
+		return fmt.Errorf("%w, txId: %s, nonce: %d, expect: %d", ErrTxNonceTooLow, tx.Payload.TxId,
+			tx.Payload.Sequence, next)
+	case tx.Payload.Sequence > next:
+		return fmt.Errorf("%w, txId: %s, nonce: %d, expect: %d", ErrTxNonceGap, tx.Payload.TxId,
+			tx.Payload.Sequence, next)
+	}
+	return nil
+}
+
+// TxNonceReader reads the nonce value of the key in state
+type TxNonceReader func(contractName string, key []byte) ([]byte, error)
+
+// SplitTxsByNonce split the txs into the txs which can be packed into a block in order, the txs whose nonce has
+// been used, and the txs which wait for the txs of lower nonce. The txs without nonce are always valid.
+func SplitTxsByNonce(txs []*commonPb.Transaction, hashType string, reader TxNonceReader) (
+	valid []*commonPb.Transaction, used []*commonPb.Transaction, waiting []*commonPb.Transaction) {
+
+	valid = make([]*commonPb.Transaction, 0, len(txs))
+	nonces := make(map[string]uint64)
+	for _, tx := range txs {
+		if !IsNonceTx(tx) {
+			valid = append(valid, tx)
+			continue
+		}
+		account, err := TxNonceAccount(tx, hashType)
+		if err != nil {
+			used = append(used, tx)
+			continue
+		}
+		nonce, ok := nonces[account]
+		if !ok {
+			if nonce, err = readTxNonce(reader, account); err != nil {
+				waiting = append(waiting, tx)
+				continue
+			}
+		}
+		err = CheckTxNonce(tx, nonce)
+		switch {
+		case err == nil:
+			valid = append(valid, tx)
+			nonce++
+		case errors.Is(err, ErrTxNonceTooLow):
+			used = append(used, tx)
+		default:
+			waiting = append(waiting, tx)
+		}
+		nonces[account] = nonce
+	}
+	return valid, used, waiting
+}
+
+// VerifyTxsNonce verify that the nonces of the txs of each account are consecutive from the nonce in state
+func VerifyTxsNonce(txs []*commonPb.Transaction, hashType string, reader TxNonceReader) error {
+	nonces := make(map[string]uint64)
+	for _, tx := range txs {
+		if !IsNonceTx(tx) {
+			continue
+		}
+		account, err := TxNonceAccount(tx, hashType)
+		if err != nil {
+			return err
+		}
+		nonce, ok := nonces[account]
+		if !ok {
+			if nonce, err = readTxNonce(reader, account); err != nil {
+				return err
+			}
+		}
+		if err = CheckTxNonce(tx, nonce); err != nil {
+			return err
+		}
+		nonces[account] = nonce + 1
+	}
+	return nil
+}
+
+func readTxNonce(reader TxNonceReader, account string) (uint64, error) {
+	value, err := reader(TxNonceContractName, TxNonceKey(account))
+	if err != nil {
+		return 0, err
+	}
+	return DecodeTxNonce(value)
+}
@@ -0,0 +1,105 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package utils
+
+import (
+	"errors"
+	"testing"
+
+	"chainmaker.org/chainmaker/pb-go/v2/accesscontrol"
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	configPb "chainmaker.org/chainmaker/pb-go/v2/config"
+	"chainmaker.org/chainmaker/pb-go/v2/syscontract"
+	"github.com/stretchr/testify/assert"
+)
+
+func newNonceTx(member string, nonce uint64) *commonPb.Transaction {
+	return &commonPb.Transaction{
+		Payload: &commonPb.Payload{TxId: GetRandTxId(), ContractName: "contract1", Sequence: nonce},
+		Sender: &commonPb.EndorsementEntry{Signer: &accesscontrol.Member{OrgId: "org1",
+			MemberType: accesscontrol.MemberType_PUBLIC_KEY, MemberInfo: []byte(member)}},
+	}
+}
+
+func newNonceReader(nonces map[string]uint64) TxNonceReader {
+	return func(contractName string, key []byte) ([]byte, error) {
+		for member, nonce := range nonces {
+			account, _ := TxNonceAccount(newNonceTx(member, 0), "SHA256")
+			if string(key) == string(TxNonceKey(account)) {
+				return EncodeTxNonce(nonce), nil
+			}
+		}
+		return nil, nil
+	}
+}
+
+func TestIsTxNonceEnabled(t *testing.T) {
+	assert.False(t, IsTxNonceEnabled(nil))
+	assert.False(t, IsTxNonceEnabled(&configPb.ChainConfig{Consensus: &configPb.ConsensusConfig{}}))
+	assert.True(t, IsTxNonceEnabled(&configPb.ChainConfig{Consensus: &configPb.ConsensusConfig{
+		ExtConfig: []*configPb.ConfigKeyValue{{Key: TxNonceConfigKey, Value: "true"}},
+	}}))
+	assert.False(t, IsTxNonceEnabled(&configPb.ChainConfig{Consensus: &configPb.ConsensusConfig{
+		ExtConfig: []*configPb.ConfigKeyValue{{Key: TxNonceConfigKey, Value: "yes"}},
+	}}))
+}
+
+func TestTxNonce(t *testing.T) {
+	nonce, err := DecodeTxNonce(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0), nonce)
+	nonce, err = DecodeTxNonce(EncodeTxNonce(10))
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(10), nonce)
+	_, err = DecodeTxNonce([]byte{1})
+	assert.NotNil(t, err)
+
+	assert.Nil(t, CheckTxNonce(newNonceTx("user1", 11), 10))
+	assert.True(t, errors.Is(CheckTxNonce(newNonceTx("user1", 10), 10), ErrTxNonceTooLow))
+	assert.True(t, errors.Is(CheckTxNonce(newNonceTx("user1", 12), 10), ErrTxNonceGap))
+
+	// the config tx uses the sequence of chain config
+	configTx := newNonceTx("user1", 1)
+	configTx.Payload.ContractName = syscontract.SystemContract_CHAIN_CONFIG.String()
+	assert.False(t, IsNonceTx(configTx))
+	assert.True(t, IsNonceTx(newNonceTx("user1", 1)))
+}
+
+func TestTxNonceAccount(t *testing.T) {
+	account1, err := TxNonceAccount(newNonceTx("user1", 1), "SHA256")
+	assert.Nil(t, err)
+	account2, err := TxNonceAccount(newNonceTx("user1", 2), "SHA256")
+	assert.Nil(t, err)
+	assert.Equal(t, account1, account2)
+	account3, err := TxNonceAccount(newNonceTx("user2", 1), "SHA256")
+	assert.Nil(t, err)
+	assert.NotEqual(t, account1, account3)
+
+	_, err = TxNonceAccount(&commonPb.Transaction{Payload: &commonPb.Payload{}}, "SHA256")
+	assert.NotNil(t, err)
+}
+
+func TestSplitTxsByNonce(t *testing.T) {
+	reader := newNonceReader(map[string]uint64{"user1": 5})
+	txs := []*commonPb.Transaction{
+		newNonceTx("user1", 6),
+		newNonceTx("user1", 5),
+		newNonceTx("user1", 8),
+		newNonceTx("user1", 7),
+		newNonceTx("user2", 1),
+		newNonceTx("user2", 2),
+	}
+	valid, used, waiting := SplitTxsByNonce(txs, "SHA256", reader)
+	assert.Equal(t, []*commonPb.Transaction{txs[0], txs[3], txs[4], txs[5]}, valid)
+	assert.Equal(t, []*commonPb.Transaction{txs[1]}, used)
+	assert.Equal(t, []*commonPb.Transaction{txs[2]}, waiting)
+
+	assert.Nil(t, VerifyTxsNonce(valid, "SHA256", reader))
+	assert.True(t, errors.Is(VerifyTxsNonce(txs, "SHA256", reader), ErrTxNonceTooLow))
+	assert.True(t, errors.Is(VerifyTxsNonce([]*commonPb.Transaction{txs[4], txs[5], txs[0], txs[2]}, "SHA256",
+		reader), ErrTxNonceGap))
+}
@@ -0,0 +1,142 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	storePb "chainmaker.org/chainmaker/pb-go/v2/store"
+	"github.com/gogo/protobuf/proto"
+)
+
+// StateSnapshotManifest describes the state snapshot after the block of BlockHeight. The states are split into
+// chunks in the order of their keys, each chunk is a proto encoded commonPb.TxRWSet whose writes are the states,
+// and the chunks are verified by their sha256 hashes in the manifest.
+type StateSnapshotManifest struct {
+	ChainId     string `json:"chain_id"`
+	BlockHeight uint64 `json:"block_height"`
+	BlockHash   []byte `json:"block_hash"`
+	// StateRoot is the root of state tree after the block, which is committed by the next block, the snapshot is
+	// only exported when the state tree is enabled
+	StateRoot []byte `json:"state_root"`
+	// Block is the proto encoded storePb.BlockWithRWSet of the block, its additional data carries the consensus
+	// state, e.g. the vote set of tbft
+	Block []byte `json:"block"`
+	// NextBlock is the proto encoded commonPb.Block of the next block without txs, its header and additional data
+	// commit StateRoot and carry the signatures of the consensus nodes
+	NextBlock []byte `json:"next_block"`
+	// ConfigBlock is the proto encoded storePb.BlockWithRWSet of the last config block before or at the block
+	ConfigBlock []byte   `json:"config_block"`
+	ChunkHashes [][]byte `json:"chunk_hashes"`
+}
+
+// Hash returns the hash which identifies the snapshot by the block and the states, the encoded blocks are not
+// covered as they are checked against the block hash by GetBlocks
+func (m *StateSnapshotManifest) Hash() ([]byte, error) {
+	bz, err := json.Marshal(&StateSnapshotManifest{
+		ChainId:     m.ChainId,
+		BlockHeight: m.BlockHeight,
+		BlockHash:   m.BlockHash,
+		StateRoot:   m.StateRoot,
+		ChunkHashes: m.ChunkHashes,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sha256Sum(bz), nil
+}
+
+// GetBlocks returns the block and the last config block of the snapshot, they are checked against the manifest
+func (m *StateSnapshotManifest) GetBlocks() (*storePb.BlockWithRWSet, *storePb.BlockWithRWSet, error) {
+	block, err := decodeSnapshotBlock(m.Block)
+	if err != nil {
+		return nil, nil, err
+	}
+	header := block.Block.Header
+	if header.ChainId != m.ChainId || header.BlockHeight != m.BlockHeight || !bytes.Equal(header.BlockHash,
+		m.BlockHash) {
+		return nil, nil, fmt.Errorf("block[%d] %x does not match the snapshot", header.BlockHeight, header.BlockHash)
+	}
+	configBlock, err := decodeSnapshotBlock(m.ConfigBlock)
+	if err != nil {
+		return nil, nil, err
+	}
+	configHeight := header.PreConfHeight
+	if IsConfBlock(block.Block) {
+		configHeight = header.BlockHeight
+	}
+	if !IsConfBlock(configBlock.Block) || configBlock.Block.Header.BlockHeight != configHeight {
+		return nil, nil, fmt.Errorf("block[%d] is not the last config block of the snapshot",
+			configBlock.Block.Header.BlockHeight)
+	}
+	return block, configBlock, nil
+}
+
+// GetNextBlock returns the next block of the snapshot, it is checked to follow the block of the snapshot and to
+// commit the state root of the snapshot
+func (m *StateSnapshotManifest) GetNextBlock() (*commonPb.Block, error) {
+	var block commonPb.Block
+	if err := proto.Unmarshal(m.NextBlock, &block); err != nil {
+		return nil, err
+	}
+	if block.Header == nil {
+		return nil, errors.New("invalid next block of snapshot")
+	}
+	header := block.Header
+	if header.ChainId != m.ChainId || header.BlockHeight != m.BlockHeight+1 || !bytes.Equal(header.PreBlockHash,
+		m.BlockHash) {
+		return nil, fmt.Errorf("block[%d] %x does not follow the snapshot", header.BlockHeight, header.BlockHash)
+	}
+	if stateRoot := GetBlockStateRoot(&block); len(m.StateRoot) == 0 || !bytes.Equal(stateRoot, m.StateRoot) {
+		return nil, fmt.Errorf("state root of snapshot expect %x, got %x", m.StateRoot, stateRoot)
+	}
+	return &block, nil
+}
+
+// VerifyChunk verifies the chunk of index against its hash in the manifest
+func (m *StateSnapshotManifest) VerifyChunk(index int, chunk []byte) error {
+	if index < 0 || index >= len(m.ChunkHashes) {
+		return fmt.Errorf("chunk %d out of range [0, %d)", index, len(m.ChunkHashes))
+	}
+	if hash := sha256Sum(chunk); !bytes.Equal(hash, m.ChunkHashes[index]) {
+		return fmt.Errorf("chunk %d hash expect %x, got %x", index, m.ChunkHashes[index], hash)
+	}
+	return nil
+}
+
+// EncodeStateSnapshotChunk returns the chunk of the states and its hash
+func EncodeStateSnapshotChunk(states []*commonPb.TxWrite) ([]byte, []byte, error) {
+	chunk, err := proto.Marshal(&commonPb.TxRWSet{TxWrites: states})
+	if err != nil {
+		return nil, nil, err
+	}
+	return chunk, sha256Sum(chunk), nil
+}
+
+// DecodeStateSnapshotChunk returns the states in the chunk
+func DecodeStateSnapshotChunk(chunk []byte) ([]*commonPb.TxWrite, error) {
+	var rwSet commonPb.TxRWSet
+	if err := proto.Unmarshal(chunk, &rwSet); err != nil {
+		return nil, err
+	}
+	return rwSet.TxWrites, nil
+}
+
+func decodeSnapshotBlock(data []byte) (*storePb.BlockWithRWSet, error) {
+	var block storePb.BlockWithRWSet
+	if err := proto.Unmarshal(data, &block); err != nil {
+		return nil, err
+	}
+	if block.Block == nil || block.Block.Header == nil {
+		return nil, errors.New("invalid block of snapshot")
+	}
+	return &block, nil
+}
@@ -0,0 +1,119 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package utils
+
+import (
+	"testing"
+
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	storePb "chainmaker.org/chainmaker/pb-go/v2/store"
+	"chainmaker.org/chainmaker/pb-go/v2/syscontract"
+	"github.com/gogo/protobuf/proto"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStateSnapshotManifest(t *testing.T) {
+	states := []*commonPb.TxWrite{
+		{ContractName: "c", Key: []byte("k1"), Value: []byte("v1")},
+		{ContractName: "c", Key: []byte("k2"), Value: []byte("v2")},
+	}
+	chunk, hash, err := EncodeStateSnapshotChunk(states)
+	require.Nil(t, err)
+	decoded, err := DecodeStateSnapshotChunk(chunk)
+	require.Nil(t, err)
+	require.Equal(t, len(states), len(decoded))
+	require.Equal(t, states[1].Value, decoded[1].Value)
+
+	configBlock := &commonPb.Block{
+		Header: &commonPb.BlockHeader{ChainId: "chain1", BlockHeight: 2},
+		Txs: []*commonPb.Transaction{{
+			Payload: &commonPb.Payload{ContractName: syscontract.SystemContract_CHAIN_CONFIG.String()},
+			Result: &commonPb.Result{
+				Code:           commonPb.TxStatusCode_SUCCESS,
+				ContractResult: &commonPb.ContractResult{Result: []byte("ok")},
+			},
+		}},
+	}
+	block := &commonPb.Block{Header: &commonPb.BlockHeader{
+		ChainId: "chain1", BlockHeight: 5, BlockHash: []byte("hash5"), PreConfHeight: 2}}
+	blockBytes, err := proto.Marshal(&storePb.BlockWithRWSet{Block: block})
+	require.Nil(t, err)
+	configBlockBytes, err := proto.Marshal(&storePb.BlockWithRWSet{Block: configBlock})
+	require.Nil(t, err)
+	manifest := &StateSnapshotManifest{
+		ChainId:     "chain1",
+		BlockHeight: 5,
+		BlockHash:   []byte("hash5"),
+		Block:       blockBytes,
+		ConfigBlock: configBlockBytes,
+		ChunkHashes: [][]byte{hash},
+	}
+
+	blk, confBlk, err := manifest.GetBlocks()
+	require.Nil(t, err)
+	require.EqualValues(t, 5, blk.Block.Header.BlockHeight)
+	require.EqualValues(t, 2, confBlk.Block.Header.BlockHeight)
+
+	require.Nil(t, manifest.VerifyChunk(0, chunk))
+	require.NotNil(t, manifest.VerifyChunk(0, append(chunk, 0)))
+	require.NotNil(t, manifest.VerifyChunk(1, chunk))
+
+	// the blocks must match the manifest
+	manifest.BlockHash = []byte("hash4")
+	_, _, err = manifest.GetBlocks()
+	require.NotNil(t, err)
+	manifest.BlockHash = []byte("hash5")
+	manifest.ConfigBlock = blockBytes
+	_, _, err = manifest.GetBlocks()
+	require.NotNil(t, err)
+
+	// the hash identifies the snapshot by the block and the states
+	hash1, err := manifest.Hash()
+	require.Nil(t, err)
+	manifest.ConfigBlock = configBlockBytes
+	hash2, err := manifest.Hash()
+	require.Nil(t, err)
+	require.Equal(t, hash1, hash2)
+	manifest.StateRoot = []byte("root")
+	hash2, err = manifest.Hash()
+	require.Nil(t, err)
+	require.NotEqual(t, hash1, hash2)
+}
+
+func TestStateSnapshotManifest_GetNextBlock(t *testing.T) {
+	manifest := &StateSnapshotManifest{
+		ChainId:     "chain1",
+		BlockHeight: 5,
+		BlockHash:   []byte("hash5"),
+		StateRoot:   []byte("root5"),
+	}
+	nextBlock := func(height uint64, preBlockHash, stateRoot []byte) []byte {
+		block := &commonPb.Block{Header: &commonPb.BlockHeader{
+			ChainId: "chain1", BlockHeight: height, PreBlockHash: preBlockHash}}
+		SetBlockStateRoot(block, stateRoot)
+		bz, err := proto.Marshal(block)
+		require.Nil(t, err)
+		return bz
+	}
+
+	manifest.NextBlock = nextBlock(6, []byte("hash5"), []byte("root5"))
+	block, err := manifest.GetNextBlock()
+	require.Nil(t, err)
+	require.EqualValues(t, 6, block.Header.BlockHeight)
+
+	// the next block must follow the block of snapshot and commit its state root
+	for _, bz := range [][]byte{
+		nextBlock(7, []byte("hash5"), []byte("root5")),
+		nextBlock(6, []byte("hash4"), []byte("root5")),
+		nextBlock(6, []byte("hash5"), []byte("root4")),
+		nextBlock(6, []byte("hash5"), nil),
+	} {
+		manifest.NextBlock = bz
+		_, err = manifest.GetNextBlock()
+		require.NotNil(t, err)
+	}
+}
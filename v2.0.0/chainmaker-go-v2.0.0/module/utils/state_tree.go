@@ -0,0 +1,482 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package utils
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	configPb "chainmaker.org/chainmaker/pb-go/v2/config"
+)
+
+// The state tree is a binary sparse merkle tree over the sha256 of the state keys, the subtree which contains
+// only one leaf is replaced by the leaf, so the tree of the same states is always the same whatever the order of
+// the updates is.
+//	leaf hash:     sha256(0x00 || key hash || sha256(value))
+//	internal hash: sha256(0x01 || left hash || right hash)
+//	empty hash:    32 zero bytes
+// The keys with empty value are not stored in the tree, which is the same as deleted.
+
+const (
+	// StateTreeConfigKey the key in consensus.ext_config of chain config which enables the state tree. The state
+	// tree is maintained from the block which enables it, and the blocks after it carry the state root of their
+	// previous block. It is only supported by the kv state db.
+	//		- key: state.tree
+	//		  value: true
+	StateTreeConfigKey = "state.tree"
+
+	// StateTreeHashSize is the size of the hashes of state tree
+	StateTreeHashSize = sha256.Size
+
+	stateTreeLeafPrefix     byte = 0
+	stateTreeInternalPrefix byte = 1
+	stateTreeKeyBits             = StateTreeHashSize * 8
+)
+
+var (
+	// StateTreeEmptyRoot is the root of the state tree which has no state
+	StateTreeEmptyRoot = make([]byte, StateTreeHashSize)
+
+	errInvalidStateTreeNode = errors.New("invalid state tree node")
+)
+
+// StateTreeNodeReader returns the encoded node of the state tree by its hash, or nil if not found
+type StateTreeNodeReader func(hash []byte) ([]byte, error)
+
+// StateProof proves a state value, or that the state does not exist, against the root of state tree
+type StateProof struct {
+	// Siblings are the hashes of the siblings on the path from the root to the leaf, nil is the empty subtree
+	Siblings [][]byte `json:"siblings"`
+	// LeafKey and LeafValueHash are of the leaf at the end of the path, they are nil if the path ends at an
+	// empty subtree. For the state which does not exist, they are of another key sharing the path.
+	LeafKey       []byte `json:"leaf_key,omitempty"`
+	LeafValueHash []byte `json:"leaf_value_hash,omitempty"`
+}
+
+// StateWithProof is a state value with its proof against the state root committed in a block, the state root
+// of block is the root after the previous block
+type StateWithProof struct {
+	ContractName string      `json:"contract_name"`
+	Key          []byte      `json:"key"`
+	Value        []byte      `json:"value"`
+	BlockHeight  uint64      `json:"block_height"`
+	StateRoot    []byte      `json:"state_root"`
+	Proof        *StateProof `json:"proof"`
+}
+
+// Verify verifies the state against its state root
+func (s *StateWithProof) Verify() error {
+	return VerifyStateProof(s.StateRoot, s.ContractName, s.Key, s.Value, s.Proof)
+}
+
+// IsStateTreeEnabled whether the state tree is enabled in chain config
+func IsStateTreeEnabled(chainConfig *configPb.ChainConfig) bool {
+	if chainConfig == nil || chainConfig.Consensus == nil {
+		return false
+	}
+	for _, kv := range chainConfig.Consensus.ExtConfig {
+		if kv.Key == StateTreeConfigKey {
+			enabled, err := strconv.ParseBool(string(kv.Value))
+			return err == nil && enabled
+		}
+	}
+	return false
+}
+
+// StateTreeKey returns the key of state in state tree
+func StateTreeKey(contractName string, key []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte(contractName))
+	h.Write([]byte{'#'})
+	h.Write(key)
+	return h.Sum(nil)
+}
+
+// GetBlockStateWrites returns the writes of the state by the block in order, the later write of the same key
+// overwrites the former
+func GetBlockStateWrites(block *commonPb.Block, txRWSets []*commonPb.TxRWSet) ([]*commonPb.TxWrite, error) {
+	writes := make([]*commonPb.TxWrite, 0, len(txRWSets))
+	for _, txRWSet := range txRWSets {
+		if txRWSet != nil {
+			writes = append(writes, txRWSet.TxWrites...)
+		}
+	}
+	if len(block.Header.ConsensusArgs) > 0 {
+		consensusArgs, err := GetConsensusArgsFromBlock(block)
+		if err != nil {
+			return nil, err
+		}
+		if consensusArgs.ConsensusData != nil {
+			writes = append(writes, consensusArgs.ConsensusData.TxWrites...)
+		}
+	}
+	return writes, nil
+}
+
+// UpdateStateTree applies the writes to the state tree of root, returns the new root and the new nodes, the
+// nodes are encoded and keyed by string(hash)
+func UpdateStateTree(root []byte, writes []*commonPb.TxWrite, reader StateTreeNodeReader) (
+	[]byte, map[string][]byte, error) {
+	newRoot, nodes, _, err := UpdateStateTreeWithStale(root, writes, reader)
+	return newRoot, nodes, err
+}
+
+// UpdateStateTreeWithStale is UpdateStateTree which also returns the hashes of the nodes of the tree of root which
+// are not referenced by the new tree, they can be pruned once the tree of root is not used
+func UpdateStateTreeWithStale(root []byte, writes []*commonPb.TxWrite, reader StateTreeNodeReader) (
+	[]byte, map[string][]byte, [][]byte, error) {
+	updateMap := make(map[string][]byte, len(writes))
+	for _, write := range writes {
+		updateMap[string(StateTreeKey(write.ContractName, write.Key))] = write.Value
+	}
+	updates := make([]stateTreeUpdate, 0, len(updateMap))
+	for key, value := range updateMap {
+		updates = append(updates, stateTreeUpdate{key: []byte(key), value: value})
+	}
+	sort.Slice(updates, func(i, j int) bool {
+		return bytes.Compare(updates[i].key, updates[j].key) < 0
+	})
+
+	u := &stateTreeUpdater{reader: reader, nodes: make(map[string][]byte), replaced: make(map[string]struct{})}
+	ref, err := u.update(&stateTreeRef{hash: root}, 0, updates)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	// the replaced node is still referenced if the same node is built again
+	stale := make([][]byte, 0, len(u.replaced))
+	for hash := range u.replaced {
+		if _, ok := u.nodes[hash]; !ok {
+			stale = append(stale, []byte(hash))
+		}
+	}
+	return ref.getHash(), u.nodes, stale, nil
+}
+
+// ProveStateTree returns the value of the key in the state tree of root and the proof of it, the value is nil
+// if the key does not exist
+func ProveStateTree(root []byte, contractName string, key []byte, reader StateTreeNodeReader) (
+	[]byte, *StateProof, error) {
+	treeKey := StateTreeKey(contractName, key)
+	proof := &StateProof{}
+	hash := root
+	for depth := 0; ; depth++ {
+		if isStateTreeEmpty(hash) {
+			return nil, proof, nil
+		}
+		node, err := loadStateTreeNode(reader, hash)
+		if err != nil {
+			return nil, nil, err
+		}
+		if node.isLeaf() {
+			proof.LeafKey = node.key
+			proof.LeafValueHash = sha256Sum(node.value)
+			if bytes.Equal(node.key, treeKey) {
+				return node.value, proof, nil
+			}
+			return nil, proof, nil
+		}
+		if depth >= stateTreeKeyBits {
+			return nil, nil, errInvalidStateTreeNode
+		}
+		if stateTreeKeyBit(treeKey, depth) == 0 {
+			proof.Siblings = append(proof.Siblings, compactStateTreeHash(node.right))
+			hash = node.left
+		} else {
+			proof.Siblings = append(proof.Siblings, compactStateTreeHash(node.left))
+			hash = node.right
+		}
+	}
+}
+
+// VerifyStateProof verifies the value of the key against the root of state tree, the nil value means the key
+// does not exist
+func VerifyStateProof(root []byte, contractName string, key []byte, value []byte, proof *StateProof) error {
+	if proof == nil {
+		return errors.New("state proof is nil")
+	}
+	if len(proof.Siblings) > stateTreeKeyBits {
+		return fmt.Errorf("too many siblings in state proof: %d", len(proof.Siblings))
+	}
+	treeKey := StateTreeKey(contractName, key)
+	var hash []byte
+	switch {
+	case len(value) > 0:
+		if !bytes.Equal(proof.LeafKey, treeKey) || !bytes.Equal(proof.LeafValueHash, sha256Sum(value)) {
+			return errors.New("the leaf of state proof does not match the state")
+		}
+		hash = stateTreeLeafHash(proof.LeafKey, proof.LeafValueHash)
+	case proof.LeafKey == nil:
+		hash = StateTreeEmptyRoot
+	default:
+		if len(proof.LeafKey) != StateTreeHashSize || bytes.Equal(proof.LeafKey, treeKey) {
+			return errors.New("the leaf of state proof does not prove the absence of state")
+		}
+		for depth := range proof.Siblings {
+			if stateTreeKeyBit(proof.LeafKey, depth) != stateTreeKeyBit(treeKey, depth) {
+				return errors.New("the leaf of state proof is not on the path of state")
+			}
+		}
+		hash = stateTreeLeafHash(proof.LeafKey, proof.LeafValueHash)
+	}
+
+	for depth := len(proof.Siblings) - 1; depth >= 0; depth-- {
+		sibling := proof.Siblings[depth]
+		if len(sibling) == 0 {
+			sibling = StateTreeEmptyRoot
+		}
+		if stateTreeKeyBit(treeKey, depth) == 0 {
+			hash = stateTreeInternalHash(hash, sibling)
+		} else {
+			hash = stateTreeInternalHash(sibling, hash)
+		}
+	}
+	if !bytes.Equal(hash, root) {
+		return fmt.Errorf("state root expect %x, got %x", root, hash)
+	}
+	return nil
+}
+
+type stateTreeUpdate struct {
+	key   []byte
+	value []byte
+}
+
+// stateTreeNode is a leaf with key and value, or an internal node with the hashes of children
+type stateTreeNode struct {
+	key   []byte
+	value []byte
+	left  []byte
+	right []byte
+}
+
+func (n *stateTreeNode) isLeaf() bool {
+	return n.key != nil
+}
+
+func (n *stateTreeNode) encode() []byte {
+	if n.isLeaf() {
+		return append(append([]byte{stateTreeLeafPrefix}, n.key...), n.value...)
+	}
+	return append(append([]byte{stateTreeInternalPrefix}, n.left...), n.right...)
+}
+
+func (n *stateTreeNode) hash() []byte {
+	if n.isLeaf() {
+		return stateTreeLeafHash(n.key, sha256Sum(n.value))
+	}
+	return stateTreeInternalHash(n.left, n.right)
+}
+
+func decodeStateTreeNode(data []byte) (*stateTreeNode, error) {
+	if len(data) < 1+StateTreeHashSize {
+		return nil, errInvalidStateTreeNode
+	}
+	switch data[0] {
+	case stateTreeLeafPrefix:
+		return &stateTreeNode{key: data[1 : 1+StateTreeHashSize], value: data[1+StateTreeHashSize:]}, nil
+	case stateTreeInternalPrefix:
+		if len(data) != 1+2*StateTreeHashSize {
+			return nil, errInvalidStateTreeNode
+		}
+		return &stateTreeNode{left: data[1 : 1+StateTreeHashSize], right: data[1+StateTreeHashSize:]}, nil
+	default:
+		return nil, errInvalidStateTreeNode
+	}
+}
+
+func loadStateTreeNode(reader StateTreeNodeReader, hash []byte) (*stateTreeNode, error) {
+	data, err := reader(hash)
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		return nil, fmt.Errorf("state tree node %x not found", hash)
+	}
+	return decodeStateTreeNode(data)
+}
+
+// stateTreeRef refers to a subtree, the node is loaded only when it is needed
+type stateTreeRef struct {
+	hash []byte
+	node *stateTreeNode
+}
+
+func (r *stateTreeRef) getHash() []byte {
+	if r == nil {
+		return StateTreeEmptyRoot
+	}
+	return r.hash
+}
+
+type stateTreeUpdater struct {
+	reader StateTreeNodeReader
+	nodes  map[string][]byte
+	// replaced are the hashes of the existing nodes which are replaced by the updates
+	replaced map[string]struct{}
+}
+
+func (u *stateTreeUpdater) load(ref *stateTreeRef) (*stateTreeNode, error) {
+	if ref.node != nil {
+		return ref.node, nil
+	}
+	if data, ok := u.nodes[string(ref.hash)]; ok {
+		return decodeStateTreeNode(data)
+	}
+	return loadStateTreeNode(u.reader, ref.hash)
+}
+
+func (u *stateTreeUpdater) newNode(node *stateTreeNode) *stateTreeRef {
+	ref := &stateTreeRef{hash: node.hash(), node: node}
+	u.nodes[string(ref.hash)] = node.encode()
+	return ref
+}
+
+// update applies the sorted updates to the subtree at depth, nil is returned for the empty subtree
+func (u *stateTreeUpdater) update(ref *stateTreeRef, depth int, updates []stateTreeUpdate) (*stateTreeRef, error) {
+	if ref != nil && isStateTreeEmpty(ref.hash) {
+		ref = nil
+	}
+	if len(updates) == 0 {
+		return ref, nil
+	}
+	if ref == nil {
+		return u.build(depth, updates)
+	}
+	node, err := u.load(ref)
+	if err != nil {
+		return nil, err
+	}
+	u.replaced[string(ref.hash)] = struct{}{}
+	if node.isLeaf() {
+		// the leaf is moved down with the updates unless it is updated
+		idx := sort.Search(len(updates), func(i int) bool {
+			return bytes.Compare(updates[i].key, node.key) >= 0
+		})
+		if idx == len(updates) || !bytes.Equal(updates[idx].key, node.key) {
+			merged := make([]stateTreeUpdate, 0, len(updates)+1)
+			merged = append(append(append(merged, updates[:idx]...),
+				stateTreeUpdate{key: node.key, value: node.value}), updates[idx:]...)
+			updates = merged
+		}
+		return u.build(depth, updates)
+	}
+	if depth >= stateTreeKeyBits {
+		return nil, errInvalidStateTreeNode
+	}
+	split := splitStateTreeUpdates(updates, depth)
+	left, err := u.update(&stateTreeRef{hash: node.left}, depth+1, updates[:split])
+	if err != nil {
+		return nil, err
+	}
+	right, err := u.update(&stateTreeRef{hash: node.right}, depth+1, updates[split:])
+	if err != nil {
+		return nil, err
+	}
+	return u.join(left, right)
+}
+
+// build returns the subtree at depth of the sorted updates, the deletes are ignored
+func (u *stateTreeUpdater) build(depth int, updates []stateTreeUpdate) (*stateTreeRef, error) {
+	puts := make([]stateTreeUpdate, 0, len(updates))
+	for _, update := range updates {
+		if len(update.value) > 0 {
+			puts = append(puts, update)
+		}
+	}
+	return u.buildPuts(depth, puts)
+}
+
+func (u *stateTreeUpdater) buildPuts(depth int, puts []stateTreeUpdate) (*stateTreeRef, error) {
+	switch {
+	case len(puts) == 0:
+		return nil, nil
+	case len(puts) == 1:
+		return u.newNode(&stateTreeNode{key: puts[0].key, value: puts[0].value}), nil
+	case depth >= stateTreeKeyBits:
+		return nil, errInvalidStateTreeNode
+	}
+	split := splitStateTreeUpdates(puts, depth)
+	left, err := u.buildPuts(depth+1, puts[:split])
+	if err != nil {
+		return nil, err
+	}
+	right, err := u.buildPuts(depth+1, puts[split:])
+	if err != nil {
+		return nil, err
+	}
+	return u.join(left, right)
+}
+
+// join returns the subtree of the children, the leaf without sibling replaces its parent
+func (u *stateTreeUpdater) join(left, right *stateTreeRef) (*stateTreeRef, error) {
+	if left == nil || right == nil {
+		child := left
+		if child == nil {
+			child = right
+		}
+		if child == nil {
+			return nil, nil
+		}
+		node, err := u.load(child)
+		if err != nil {
+			return nil, err
+		}
+		if node.isLeaf() {
+			child.node = node
+			return child, nil
+		}
+	}
+	return u.newNode(&stateTreeNode{left: left.getHash(), right: right.getHash()}), nil
+}
+
+// splitStateTreeUpdates returns the index of the first update whose key bit at depth is 1
+func splitStateTreeUpdates(updates []stateTreeUpdate, depth int) int {
+	return sort.Search(len(updates), func(i int) bool {
+		return stateTreeKeyBit(updates[i].key, depth) == 1
+	})
+}
+
+func stateTreeKeyBit(key []byte, depth int) byte {
+	return (key[depth/8] >> (7 - uint(depth%8))) & 1
+}
+
+func stateTreeLeafHash(key []byte, valueHash []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{stateTreeLeafPrefix})
+	h.Write(key)
+	h.Write(valueHash)
+	return h.Sum(nil)
+}
+
+func stateTreeInternalHash(left []byte, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{stateTreeInternalPrefix})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+func isStateTreeEmpty(hash []byte) bool {
+	return len(hash) == 0 || bytes.Equal(hash, StateTreeEmptyRoot)
+}
+
+func compactStateTreeHash(hash []byte) []byte {
+	if isStateTreeEmpty(hash) {
+		return nil
+	}
+	return hash
+}
+
+func sha256Sum(data []byte) []byte {
+	sum := sha256.Sum256(data)
+	return sum[:]
+}
@@ -0,0 +1,162 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package utils
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	"github.com/stretchr/testify/require"
+)
+
+type memStateTree struct {
+	nodes map[string][]byte
+	root  []byte
+}
+
+func newMemStateTree() *memStateTree {
+	return &memStateTree{nodes: make(map[string][]byte), root: StateTreeEmptyRoot}
+}
+
+func (m *memStateTree) read(hash []byte) ([]byte, error) {
+	return m.nodes[string(hash)], nil
+}
+
+func (m *memStateTree) update(t *testing.T, writes []*commonPb.TxWrite) {
+	root, nodes, err := UpdateStateTree(m.root, writes, m.read)
+	require.Nil(t, err)
+	for hash, node := range nodes {
+		m.nodes[hash] = node
+	}
+	m.root = root
+}
+
+func TestUpdateStateTree(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	tree := newMemStateTree()
+	state := make(map[string][]byte)
+
+	for round := 0; round < 50; round++ {
+		writes := make([]*commonPb.TxWrite, 0, 20)
+		n := r.Intn(20)
+		for i := 0; i < n; i++ {
+			key := fmt.Sprintf("key%d", r.Intn(100))
+			var value []byte
+			if r.Intn(3) > 0 {
+				value = []byte(fmt.Sprintf("value%d", r.Int()))
+			}
+			writes = append(writes, &commonPb.TxWrite{ContractName: "c", Key: []byte(key), Value: value})
+			state[key] = value
+		}
+		tree.update(t, writes)
+
+		// the root depends on the states only
+		rebuilt := newMemStateTree()
+		puts := make([]*commonPb.TxWrite, 0, len(state))
+		for key, value := range state {
+			puts = append(puts, &commonPb.TxWrite{ContractName: "c", Key: []byte(key), Value: value})
+		}
+		rebuilt.update(t, puts)
+		require.Equal(t, rebuilt.root, tree.root, "round %d", round)
+	}
+
+	for i := 0; i < 100; i++ {
+		key := []byte(fmt.Sprintf("key%d", i))
+		value, proof, err := ProveStateTree(tree.root, "c", key, tree.read)
+		require.Nil(t, err)
+		require.Equal(t, string(state[string(key)]), string(value))
+		require.Nil(t, VerifyStateProof(tree.root, "c", key, value, proof))
+		require.NotNil(t, VerifyStateProof(tree.root, "c", key, []byte("fake"), proof))
+		if len(value) > 0 {
+			require.NotNil(t, VerifyStateProof(tree.root, "c", key, nil, proof))
+			require.NotNil(t, VerifyStateProof(tree.root, "other", key, value, proof))
+		}
+	}
+}
+
+func TestUpdateStateTree_DeleteAll(t *testing.T) {
+	tree := newMemStateTree()
+	tree.update(t, []*commonPb.TxWrite{
+		{ContractName: "c", Key: []byte("k1"), Value: []byte("v1")},
+		{ContractName: "c", Key: []byte("k2"), Value: []byte("v2")},
+	})
+	require.NotEqual(t, StateTreeEmptyRoot, tree.root)
+	root := tree.root
+
+	// the tree of one state is the leaf of it
+	tree.update(t, []*commonPb.TxWrite{{ContractName: "c", Key: []byte("k2")}})
+	value, proof, err := ProveStateTree(tree.root, "c", []byte("k1"), tree.read)
+	require.Nil(t, err)
+	require.Equal(t, []byte("v1"), value)
+	require.Empty(t, proof.Siblings)
+
+	tree.update(t, []*commonPb.TxWrite{{ContractName: "c", Key: []byte("k1"), Value: []byte{}}})
+	require.Equal(t, StateTreeEmptyRoot, tree.root)
+	value, proof, err = ProveStateTree(tree.root, "c", []byte("k1"), tree.read)
+	require.Nil(t, err)
+	require.Nil(t, value)
+	require.Nil(t, VerifyStateProof(tree.root, "c", []byte("k1"), nil, proof))
+
+	// the old root is still provable since the nodes are never changed
+	value, proof, err = ProveStateTree(root, "c", []byte("k2"), tree.read)
+	require.Nil(t, err)
+	require.Equal(t, []byte("v2"), value)
+	require.Nil(t, VerifyStateProof(root, "c", []byte("k2"), value, proof))
+}
+
+func TestUpdateStateTreeWithStale(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	tree := newMemStateTree()
+	state := make(map[string][]byte)
+
+	for round := 0; round < 50; round++ {
+		writes := make([]*commonPb.TxWrite, 0, 20)
+		n := r.Intn(20)
+		for i := 0; i < n; i++ {
+			key := fmt.Sprintf("key%d", r.Intn(30))
+			var value []byte
+			// the values are reused, so the stale nodes are built again
+			if r.Intn(3) > 0 {
+				value = []byte(fmt.Sprintf("value%d", r.Intn(3)))
+			}
+			writes = append(writes, &commonPb.TxWrite{ContractName: "c", Key: []byte(key), Value: value})
+			state[key] = value
+		}
+		root, nodes, stale, err := UpdateStateTreeWithStale(tree.root, writes, tree.read)
+		require.Nil(t, err)
+		for _, hash := range stale {
+			require.NotContains(t, nodes, string(hash))
+			delete(tree.nodes, string(hash))
+		}
+		for hash, node := range nodes {
+			tree.nodes[hash] = node
+		}
+		tree.root = root
+
+		// only the nodes of the current tree are kept after the stale nodes are pruned
+		require.Equal(t, countStateTreeNodes(t, tree, tree.root), len(tree.nodes), "round %d", round)
+		for key, value := range state {
+			got, _, err := ProveStateTree(tree.root, "c", []byte(key), tree.read)
+			require.Nil(t, err)
+			require.Equal(t, string(value), string(got))
+		}
+	}
+}
+
+func countStateTreeNodes(t *testing.T, tree *memStateTree, hash []byte) int {
+	if isStateTreeEmpty(hash) {
+		return 0
+	}
+	node, err := loadStateTreeNode(tree.read, hash)
+	require.Nil(t, err)
+	if node.isLeaf() {
+		return 1
+	}
+	return 1 + countStateTreeNodes(t, tree, node.left) + countStateTreeNodes(t, tree, node.right)
+}
@@ -8,13 +8,55 @@
 package utils
 
 import (
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+
+	acPb "chainmaker.org/chainmaker/pb-go/v2/accesscontrol"
 	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
 	"chainmaker.org/chainmaker/pb-go/v2/syscontract"
 )
 
 const (
-	PrefixContractInfo     = "Contract:"
-	PrefixContractByteCode = "ContractByteCode:"
+	PrefixContractInfo      = "Contract:"
+	PrefixContractByteCode  = "ContractByteCode:"
+	PrefixContractMethodAcl = "ContractMethodAcl:"
+
+	// the contract info and the bytecode of the previous versions of the contract, retained for the rollback
+	PrefixContractHistory         = "ContractHistory:"
+	PrefixContractByteCodeHistory = "ContractByteCodeHistory:"
+
+	// ContractManageRollbackContract the method of CONTRACT_MANAGE which re-activates a previous version of the
+	// user contract, the version is syscontract.InitContract_CONTRACT_VERSION
+	ContractManageRollbackContract = "ROLLBACK_CONTRACT"
+	// ContractUpgradeMigrateMethod the optional parameter of UPGRADE_CONTRACT, the method of the new bytecode
+	// invoked after the upgrade method in the same transaction to migrate the state of the contract
+	ContractUpgradeMigrateMethod = "MIGRATE_METHOD"
+
+	// the metadata of the versions of the user contracts recorded by INIT_CONTRACT and UPGRADE_CONTRACT
+	PrefixContractMetadata = "ContractMetadata:"
+	// the optional parameters of INIT_CONTRACT and UPGRADE_CONTRACT which describe the contract
+	ContractMetadataAbi         = "CONTRACT_ABI"
+	ContractMetadataDescription = "CONTRACT_DESCRIPTION"
+
+	// the queries of CONTRACT_MANAGE which return the contracts with the metadata, the contract list is filtered by
+	// the optional parameters syscontract.InitContract_CONTRACT_RUNTIME_TYPE and ContractListStatus, the metadata
+	// of the current version is returned if syscontract.InitContract_CONTRACT_VERSION is not given
+	ContractQueryGetContractList     = "GET_CONTRACT_LIST"
+	ContractQueryGetContractMetadata = "GET_CONTRACT_METADATA"
+	ContractListStatus               = "CONTRACT_STATUS"
+
+	// the methods of CONTRACT_MANAGE which manage the method ACLs of the user contracts
+	ContractManageSetMethodAcl    = "SET_METHOD_ACL"
+	ContractManageDeleteMethodAcl = "DELETE_METHOD_ACL"
+	ContractQueryGetMethodAcl     = "GET_METHOD_ACL"
+
+	// the parameters of the method ACL, the contract name is syscontract.GetContractInfo_CONTRACT_NAME,
+	// the org list and the role list are separated by ','
+	ContractMethodAclMethodName = "METHOD_NAME"
+	ContractMethodAclRule       = "RULE"
+	ContractMethodAclOrgList    = "ORG_LIST"
+	ContractMethodAclRoleList   = "ROLE_LIST"
 )
 
 func GetContractDbKey(contractName string) []byte {
@@ -40,3 +82,114 @@ func GetContractBytecode(readObject func(contractName string, key []byte) ([]byt
 	key := GetContractByteCodeDbKey(name)
 	return readObject(syscontract.SystemContract_CONTRACT_MANAGE.String(), key)
 }
+
+// GetContractHistoryDbKey returns the key of the contract info of the previous version of the contract
+func GetContractHistoryDbKey(contractName, version string) []byte {
+	return []byte(PrefixContractHistory + contractName + ":" + version)
+}
+
+// GetContractByteCodeHistoryDbKey returns the key of the bytecode of the previous version of the contract
+func GetContractByteCodeHistoryDbKey(contractName, version string) []byte {
+	return []byte(PrefixContractByteCodeHistory + contractName + ":" + version)
+}
+
+// ContractMetadata the metadata of a version of the user contract
+type ContractMetadata struct {
+	// the tx and the block height which installed the contract
+	DeployTxId   string `json:"deploy_tx_id,omitempty"`
+	DeployHeight uint64 `json:"deploy_height,omitempty"`
+	// the tx and the block height which upgraded the contract to the version, empty for the installed version
+	UpgradeTxId   string `json:"upgrade_tx_id,omitempty"`
+	UpgradeHeight uint64 `json:"upgrade_height,omitempty"`
+	// the hex sha256 hash of the bytecode stored, the runtime bytecode for EVM
+	ByteCodeHash string `json:"bytecode_hash"`
+	Abi          string `json:"abi,omitempty"`
+	Description  string `json:"description,omitempty"`
+}
+
+// ContractDetail the contract info with the metadata of the version, the metadata is nil for the contracts
+// installed without the metadata, such as the system contracts
+type ContractDetail struct {
+	*commonPb.Contract
+	Metadata *ContractMetadata `json:"metadata,omitempty"`
+}
+
+// GetContractMetadataDbKey returns the key of the metadata of the version of the contract
+func GetContractMetadataDbKey(contractName, version string) []byte {
+	return []byte(PrefixContractMetadata + contractName + ":" + version)
+}
+
+// GetContractMetadata returns the metadata of the version of the contract, nil if not recorded
+func GetContractMetadata(readObject func(contractName string, key []byte) ([]byte, error), contractName,
+	version string) (*ContractMetadata, error) {
+	value, err := readObject(syscontract.SystemContract_CONTRACT_MANAGE.String(),
+		GetContractMetadataDbKey(contractName, version))
+	if err != nil || len(value) == 0 {
+		return nil, err
+	}
+	metadata := &ContractMetadata{}
+	if err = json.Unmarshal(value, metadata); err != nil {
+		return nil, err
+	}
+	return metadata, nil
+}
+
+// GetContractMethodAclDbKey returns the key of the ACL of the method of the contract
+func GetContractMethodAclDbKey(contractName, method string) []byte {
+	return []byte(PrefixContractMethodAcl + contractName + ":" + method)
+}
+
+// GetContractMethodAclDbPrefix returns the key prefix of the ACLs of all the methods of the contract
+func GetContractMethodAclDbPrefix(contractName string) []byte {
+	return []byte(PrefixContractMethodAcl + contractName + ":")
+}
+
+// GetContractMethodAclResourceName returns the resource name of the ACL of the method of the contract,
+// it is the same as the resource name of the method in the resource policies of chain config
+func GetContractMethodAclResourceName(contractName, method string) string {
+	return contractName + "-" + method
+}
+
+// NormalizeEvmMethod returns the method of the evm contract under which its ACL is stored, it is the lower case
+// hex of the selector without 0x
+func NormalizeEvmMethod(method string) string {
+	if strings.HasPrefix(method, "0x") || strings.HasPrefix(method, "0X") {
+		method = method[2:]
+	}
+	return strings.ToLower(method)
+}
+
+// GetEvmCallSelector returns the normalized selector of the calldata of the evm contract, which dispatches the call,
+// empty if the calldata is shorter than 4 bytes or not hex
+func GetEvmCallSelector(calldata string) string {
+	if strings.HasPrefix(calldata, "0x") || strings.HasPrefix(calldata, "0X") {
+		calldata = calldata[2:]
+	}
+	// the same as the evm runtime which pads the odd calldata
+	if len(calldata)%2 == 1 {
+		calldata = "0" + calldata
+	}
+	if len(calldata) < 8 {
+		return ""
+	}
+	selector, err := hex.DecodeString(calldata[:8])
+	if err != nil {
+		return ""
+	}
+	return hex.EncodeToString(selector)
+}
+
+// GetContractMethodAcl returns the ACL policy of the method of the contract, nil if the method is not restricted
+func GetContractMethodAcl(readObject func(contractName string, key []byte) ([]byte, error), contractName,
+	method string) (*acPb.Policy, error) {
+	value, err := readObject(syscontract.SystemContract_CONTRACT_MANAGE.String(),
+		GetContractMethodAclDbKey(contractName, method))
+	if err != nil || len(value) == 0 {
+		return nil, err
+	}
+	policy := &acPb.Policy{}
+	if err = policy.Unmarshal(value); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
@@ -8,6 +8,7 @@ SPDX-License-Identifier: Apache-2.0
 package utils
 
 import (
+	"encoding/hex"
 	"errors"
 	"fmt"
 
@@ -133,7 +134,45 @@ func IsConfigTx(tx *commonPb.Transaction) bool {
 	if tx == nil {
 		return false
 	}
-	return tx.Payload.ContractName == syscontract.SystemContract_CHAIN_CONFIG.String()
+	return tx.Payload.ContractName == syscontract.SystemContract_CHAIN_CONFIG.String() || IsMultiSignConfigTx(tx)
+}
+
+const (
+	// MultiSignParamPayload the param of a multi sign request which carries the hex of the wrapped payload
+	MultiSignParamPayload = "payload"
+	// MultiSignParamContractName the param of a multi sign vote which declares the contract called by the request,
+	// the vote of a CHAIN_CONFIG request must set it so that it is packed as a config tx
+	MultiSignParamContractName = "contract_name"
+)
+
+// IsMultiSignConfigTx the transaction is a multi sign request of a chain config update, or a vote of it,
+// which executes the update once the policy is satisfied
+func IsMultiSignConfigTx(tx *commonPb.Transaction) bool {
+	if tx == nil {
+		return false
+	}
+	payload := tx.Payload
+	if payload.ContractName != syscontract.SystemContract_MULTI_SIGN.String() {
+		return false
+	}
+	configContract := syscontract.SystemContract_CHAIN_CONFIG.String()
+	for _, kv := range payload.Parameters {
+		switch {
+		case payload.Method == syscontract.MultiSignFunction_REQ.String() && kv.Key == MultiSignParamPayload:
+			payloadBytes, err := hex.DecodeString(string(kv.Value))
+			if err != nil {
+				return false
+			}
+			wrapped := &commonPb.Payload{}
+			if err = proto.Unmarshal(payloadBytes, wrapped); err != nil {
+				return false
+			}
+			return wrapped.ContractName == configContract
+		case payload.Method == syscontract.MultiSignFunction_VOTE.String() && kv.Key == MultiSignParamContractName:
+			return string(kv.Value) == configContract
+		}
+	}
+	return false
 }
 
 // IsValidConfigTx the transaction is a valid config transaction or not
@@ -0,0 +1,547 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	bccrypto "chainmaker.org/chainmaker/common/v2/crypto"
+	"chainmaker.org/chainmaker/common/v2/crypto/hash"
+	bcx509 "chainmaker.org/chainmaker/common/v2/crypto/x509"
+	acPb "chainmaker.org/chainmaker/pb-go/v2/accesscontrol"
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	configPb "chainmaker.org/chainmaker/pb-go/v2/config"
+	consensusPb "chainmaker.org/chainmaker/pb-go/v2/consensus"
+	tbftpb "chainmaker.org/chainmaker/pb-go/v2/consensus/tbft"
+	"chainmaker.org/chainmaker/protocol/v2"
+	"github.com/gogo/protobuf/proto"
+)
+
+// TxProof is the proof that a transaction is included in a block, it is verified offline by VerifyTxProof
+// with the trusted root certificates of the chain
+type TxProof struct {
+	Tx      *commonPb.Transaction `json:"tx"`
+	TxIndex uint32                `json:"tx_index"`
+	// MerklePath is the sibling hashes from the tx hash up to the tx root, nil if the sibling is absent
+	MerklePath [][]byte              `json:"merkle_path"`
+	HashType   string                `json:"hash_type"`
+	Header     *commonPb.BlockHeader `json:"header"`
+	// StateRoot is covered by the block hash together with the header, see BlockStateRootKey
+	StateRoot []byte `json:"state_root,omitempty"`
+	// ProposerCert is the certificate of the proposer if the header carries the certificate id only
+	ProposerCert []byte `json:"proposer_cert,omitempty"`
+	// Votes are the precommit votes of the block for TBFT and DPoS, which are signed by the consensus nodes
+	Votes []*TxProofVote `json:"votes,omitempty"`
+	// Config is the proof of the config tx in the config block at Header.PreConfHeight, the consensus nodes
+	// in its chain config are the voters of the block
+	Config *TxProof `json:"config,omitempty"`
+}
+
+// TxProofVote is a precommit vote of the block, Vote is the marshalled tbft vote without endorsement
+type TxProofVote struct {
+	Vote      []byte       `json:"vote"`
+	Signer    *acPb.Member `json:"signer"`
+	Signature []byte       `json:"signature"`
+}
+
+// CertGetter returns the certificate of the certificate id
+type CertGetter func(certId []byte) ([]byte, error)
+
+// NewTxProof builds the proof of the tx in block, configBlock is the config block at the PreConfHeight of block,
+// the certificate ids in both blocks are resolved by getCert.
+// The block must carry the precommit votes of TBFT or DPoS, the proof is not supported by other consensus types.
+func NewTxProof(block, configBlock *commonPb.Block, txId string, hashType string, getCert CertGetter) (
+	*TxProof, error) {
+	proof, err := newTxProof(block, txId, hashType, getCert)
+	if err != nil {
+		return nil, err
+	}
+	if len(proof.Votes) == 0 {
+		return nil, fmt.Errorf("block %d has no precommit votes, the tx proof is supported by TBFT and DPoS only",
+			block.Header.BlockHeight)
+	}
+	if configBlock == nil || !IsConfBlock(configBlock) ||
+		configBlock.Header.BlockHeight != block.Header.PreConfHeight {
+		return nil, fmt.Errorf("block %d is not the config block of block %d", block.Header.PreConfHeight,
+			block.Header.BlockHeight)
+	}
+	if proof.Config, err = newTxProof(configBlock, configBlock.Txs[0].Payload.TxId, hashType, getCert); err != nil {
+		return nil, err
+	}
+	// the genesis block is the only config block without votes
+	if configBlock.Header.BlockHeight > 0 && len(proof.Config.Votes) == 0 {
+		return nil, fmt.Errorf("config block %d has no precommit votes", configBlock.Header.BlockHeight)
+	}
+	return proof, nil
+}
+
+// newTxProof builds the proof of the tx in block without the config
+func newTxProof(block *commonPb.Block, txId string, hashType string, getCert CertGetter) (*TxProof, error) {
+	txIndex := -1
+	txHashes := make([][]byte, len(block.Txs))
+	for i, tx := range block.Txs {
+		txHash, err := CalcTxHash(hashType, tx)
+		if err != nil {
+			return nil, err
+		}
+		txHashes[i] = txHash
+		if tx.Payload.TxId == txId {
+			txIndex = i
+		}
+	}
+	if txIndex < 0 {
+		return nil, fmt.Errorf("tx %s not found in block %d", txId, block.Header.BlockHeight)
+	}
+	path, err := calcMerklePath(hashType, txHashes, txIndex)
+	if err != nil {
+		return nil, err
+	}
+
+	proof := &TxProof{
+		Tx:         block.Txs[txIndex],
+		TxIndex:    uint32(txIndex),
+		MerklePath: path,
+		HashType:   hashType,
+		Header:     block.Header,
+		StateRoot:  GetBlockStateRoot(block),
+	}
+	if block.Header.Proposer != nil && block.Header.Proposer.MemberType == acPb.MemberType_CERT_HASH {
+		if proof.ProposerCert, err = getCert(block.Header.Proposer.MemberInfo); err != nil {
+			return nil, err
+		}
+	}
+	if block.AdditionalData == nil || block.AdditionalData.ExtraData == nil {
+		return proof, nil
+	}
+	voteSetBytes, ok := block.AdditionalData.ExtraData[protocol.TBFTAddtionalDataKey]
+	if !ok {
+		return proof, nil
+	}
+	voteSet := new(tbftpb.VoteSet)
+	if err = proto.Unmarshal(voteSetBytes, voteSet); err != nil {
+		return nil, err
+	}
+	for _, vote := range voteSet.Votes {
+		if vote.Endorsement == nil || !bytes.Equal(vote.Hash, block.Header.BlockHash) {
+			continue
+		}
+		signer := vote.Endorsement.Signer
+		if signer.MemberType == acPb.MemberType_CERT_HASH {
+			certPEM, err := getCert(signer.MemberInfo)
+			if err != nil {
+				return nil, err
+			}
+			signer = &acPb.Member{OrgId: signer.OrgId, MemberType: acPb.MemberType_CERT, MemberInfo: certPEM}
+		}
+		voteCopy := proto.Clone(vote).(*tbftpb.Vote)
+		voteCopy.Endorsement = nil
+		voteBytes, err := proto.Marshal(voteCopy)
+		if err != nil {
+			return nil, err
+		}
+		proof.Votes = append(proof.Votes, &TxProofVote{
+			Vote:      voteBytes,
+			Signer:    signer,
+			Signature: vote.Endorsement.Signature,
+		})
+	}
+	return proof, nil
+}
+
+// IsTxProofSupported returns whether the blocks of the consensus type carry the precommit votes for the tx proof
+func IsTxProofSupported(consensusType consensusPb.ConsensusType) bool {
+	return consensusType == consensusPb.ConsensusType_TBFT || consensusType == consensusPb.ConsensusType_DPOS
+}
+
+// VerifyTxProof verifies the tx proof with the trusted root certificates in pem:
+// the tx is in the tx root of the block header, the block hash matches the header,
+// the block is signed by its proposer and precommitted by the consensus nodes of the chain config in the proof.
+// Every signer certificate must be a consensus node issued by a trusted root of its own organization,
+// the voter of a vote must be a node id of the signer organization in the chain config, or the node id of
+// the signer in the trust members.
+// The block must be precommitted by at least minVoters distinct node ids and by the quorum of the consensus
+// nodes in the chain config, the voters must be from more than 2/3 of the organizations of the trusted roots.
+// The chain config is verified by the same organizations quorum on its config block, except for the genesis block.
+// The certificates are verified at the block timestamp, so that the proof is still verifiable after they expire.
+// minVoters must be positive.
+func VerifyTxProof(proof *TxProof, trustRoots [][]byte, minVoters int) error {
+	if proof == nil || proof.Tx == nil || proof.Header == nil {
+		return errors.New("invalid tx proof")
+	}
+	if minVoters <= 0 {
+		return fmt.Errorf("min voters must be positive, got %d", minVoters)
+	}
+	blockHash, err := verifyTxInBlock(proof)
+	if err != nil {
+		return err
+	}
+
+	roots, err := newTrustRoots(trustRoots)
+	if err != nil {
+		return err
+	}
+	if err = verifyProposer(proof, blockHash, roots); err != nil {
+		return err
+	}
+	chainConfig, err := verifyTxProofConfig(proof, roots)
+	if err != nil {
+		return fmt.Errorf("verify chain config failed, %s", err)
+	}
+	voters, err := verifyVotes(proof, blockHash, roots, chainConfig)
+	if err != nil {
+		return err
+	}
+	nodes := 0
+	for _, org := range chainConfig.Consensus.GetNodes() {
+		nodes += len(org.NodeId)
+	}
+	if quorum := nodes*2/3 + 1; minVoters < quorum {
+		minVoters = quorum
+	}
+	if voters < minVoters {
+		return fmt.Errorf("the block is precommitted by %d consensus nodes, less than %d", voters, minVoters)
+	}
+	return nil
+}
+
+// trustRoots is the trusted root certificates of the organizations
+type trustRoots struct {
+	opts bcx509.VerifyOptions
+	// orgs maps the raw root certificate to its organization
+	orgs map[string]string
+	// orgCount is the count of the organizations with trusted roots
+	orgCount int
+}
+
+func newTrustRoots(rootPEMs [][]byte) (*trustRoots, error) {
+	roots := &trustRoots{
+		opts: bcx509.VerifyOptions{
+			Intermediates: bcx509.NewCertPool(),
+			Roots:         bcx509.NewCertPool(),
+		},
+		orgs: make(map[string]string, len(rootPEMs)),
+	}
+	orgs := make(map[string]bool, len(rootPEMs))
+	for _, rootPEM := range rootPEMs {
+		cert, err := ParseCert(rootPEM)
+		if err != nil {
+			return nil, err
+		}
+		if len(cert.Subject.Organization) == 0 {
+			return nil, fmt.Errorf("trusted root %s has no organization", cert.Subject.CommonName)
+		}
+		roots.opts.Roots.AddCert(cert)
+		roots.orgs[string(cert.Raw)] = cert.Subject.Organization[0]
+		orgs[cert.Subject.Organization[0]] = true
+	}
+	roots.orgCount = len(orgs)
+	return roots, nil
+}
+
+func verifyProposer(proof *TxProof, blockHash []byte, roots *trustRoots) error {
+	header := proof.Header
+	if header.Proposer == nil {
+		return errors.New("block proposer is empty")
+	}
+	proposerCert := header.Proposer.MemberInfo
+	if header.Proposer.MemberType == acPb.MemberType_CERT_HASH {
+		certId, err := getCertificateId(proof.ProposerCert, proof.HashType)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(certId, header.Proposer.MemberInfo) {
+			return fmt.Errorf("proposer cert id expect %x, got %x", header.Proposer.MemberInfo, certId)
+		}
+		proposerCert = proof.ProposerCert
+	}
+	if _, err := verifyConsensusSignature(roots, header, header.Proposer.OrgId, proposerCert, blockHash,
+		header.Signature); err != nil {
+		return fmt.Errorf("verify proposer signature failed, %s", err)
+	}
+	return nil
+}
+
+// verifyTxProofConfig verifies the config in the proof is the config block at the PreConfHeight of the block,
+// returns its chain config
+func verifyTxProofConfig(proof *TxProof, roots *trustRoots) (*configPb.ChainConfig, error) {
+	config := proof.Config
+	if config == nil || config.Tx == nil || config.Header == nil {
+		return nil, errors.New("config block is absent")
+	}
+	if config.Header.BlockHeight != proof.Header.PreConfHeight || config.Header.ChainId != proof.Header.ChainId {
+		return nil, fmt.Errorf("config block expect %s(%d), got %s(%d)", proof.Header.ChainId,
+			proof.Header.PreConfHeight, config.Header.ChainId, config.Header.BlockHeight)
+	}
+	if config.HashType != proof.HashType || config.TxIndex != 0 || !IsValidConfigTx(config.Tx) {
+		return nil, errors.New("not a config tx")
+	}
+	blockHash, err := verifyTxInBlock(config)
+	if err != nil {
+		return nil, err
+	}
+	// the voters of a config block are from the previous config, only the organizations quorum is checked
+	if config.Header.BlockHeight > 0 {
+		if err = verifyProposer(config, blockHash, roots); err != nil {
+			return nil, err
+		}
+		if _, err = verifyVotes(config, blockHash, roots, nil); err != nil {
+			return nil, err
+		}
+	}
+	chainConfig := &configPb.ChainConfig{}
+	if err = proto.Unmarshal(config.Tx.Result.ContractResult.Result, chainConfig); err != nil {
+		return nil, err
+	}
+	if chainConfig.ChainId != proof.Header.ChainId {
+		return nil, fmt.Errorf("chain id expect %s, got %s", proof.Header.ChainId, chainConfig.ChainId)
+	}
+	return chainConfig, nil
+}
+
+// verifyVotes verifies the precommit votes of the block and the organizations quorum of the voters,
+// the voters are bound to the consensus nodes of chainConfig if it is not nil.
+// Returns the count of distinct voters.
+func verifyVotes(proof *TxProof, blockHash []byte, roots *trustRoots, chainConfig *configPb.ChainConfig) (
+	int, error) {
+	header := proof.Header
+	voters := make(map[string]bool, len(proof.Votes))
+	certs := make(map[string]bool, len(proof.Votes))
+	orgs := make(map[string]bool)
+	for _, v := range proof.Votes {
+		vote := new(tbftpb.Vote)
+		if err := proto.Unmarshal(v.Vote, vote); err != nil {
+			return 0, err
+		}
+		if vote.Type != tbftpb.VoteType_VOTE_PRECOMMIT || vote.Height != header.BlockHeight ||
+			!bytes.Equal(vote.Hash, blockHash) {
+			return 0, fmt.Errorf("vote of %s is not a precommit of the block", vote.Voter)
+		}
+		if v.Signer == nil || v.Signer.MemberType != acPb.MemberType_CERT {
+			return 0, fmt.Errorf("vote of %s has no signer certificate", vote.Voter)
+		}
+		cert, err := verifyConsensusSignature(roots, header, v.Signer.OrgId, v.Signer.MemberInfo, v.Vote,
+			v.Signature)
+		if err != nil {
+			return 0, fmt.Errorf("verify vote of %s failed, %s", vote.Voter, err)
+		}
+		if chainConfig != nil {
+			if err = verifyVoter(chainConfig, v.Signer, vote.Voter); err != nil {
+				return 0, err
+			}
+		}
+		if voters[vote.Voter] || certs[string(cert.Raw)] {
+			return 0, fmt.Errorf("duplicate vote of %s", vote.Voter)
+		}
+		voters[vote.Voter] = true
+		certs[string(cert.Raw)] = true
+		orgs[v.Signer.OrgId] = true
+	}
+	if len(orgs)*3 <= roots.orgCount*2 {
+		return 0, fmt.Errorf("block %d is precommitted by %d of %d trusted organizations, not more than 2/3",
+			header.BlockHeight, len(orgs), roots.orgCount)
+	}
+	return len(voters), nil
+}
+
+// verifyVoter verifies the voter is the node id of the signer, which is bound by the trust members,
+// or one of the consensus nodes of the signer organization otherwise, the same as tbft
+func verifyVoter(chainConfig *configPb.ChainConfig, signer *acPb.Member, voter string) error {
+	for _, member := range chainConfig.TrustMembers {
+		if member.MemberInfo == string(signer.MemberInfo) {
+			if member.NodeId != voter {
+				return fmt.Errorf("voter %s is not the trust member %s", voter, member.NodeId)
+			}
+			return nil
+		}
+	}
+	for _, org := range chainConfig.Consensus.GetNodes() {
+		if org.OrgId != signer.OrgId {
+			continue
+		}
+		for _, nodeId := range org.NodeId {
+			if nodeId == voter {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("voter %s is not a consensus node of %s", voter, signer.OrgId)
+}
+
+// VerifyTxInclusion verifies the tx proof against the block header verified locally, e.g. by a light node,
+// the signatures in the proof are not checked since the header has been verified
+func VerifyTxInclusion(proof *TxProof, header *commonPb.BlockHeader) error {
+	if proof == nil || proof.Tx == nil || proof.Header == nil || header == nil {
+		return errors.New("invalid tx proof")
+	}
+	if proof.Header.BlockHeight != header.BlockHeight || !bytes.Equal(proof.Header.BlockHash, header.BlockHash) {
+		return fmt.Errorf("block(%d) hash expect %x, got %x", header.BlockHeight, header.BlockHash,
+			proof.Header.BlockHash)
+	}
+	_, err := verifyTxInBlock(proof)
+	return err
+}
+
+// verifyTxInBlock verifies the tx is in the tx root of the proof header and the header matches its block hash,
+// returns the block hash
+func verifyTxInBlock(proof *TxProof) ([]byte, error) {
+	header := proof.Header
+	txHash, err := CalcTxHash(proof.HashType, proof.Tx)
+	if err != nil {
+		return nil, err
+	}
+	txRoot, err := calcMerkleRootFromPath(proof.HashType, txHash, int(proof.TxIndex), int(header.TxCount),
+		proof.MerklePath)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(txRoot, header.TxRoot) {
+		return nil, fmt.Errorf("tx root expect %x, got %x", header.TxRoot, txRoot)
+	}
+
+	block := &commonPb.Block{Header: header}
+	if proof.StateRoot != nil {
+		SetBlockStateRoot(block, proof.StateRoot)
+	}
+	blockHash, err := CalcBlockHash(proof.HashType, block)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(blockHash, header.BlockHash) {
+		return nil, fmt.Errorf("block hash expect %x, got %x", header.BlockHash, blockHash)
+	}
+	return blockHash, nil
+}
+
+// verifyConsensusSignature verifies the signature of msg, the signer must be a consensus node of orgId
+// issued by a trusted root of orgId at the timestamp of header
+func verifyConsensusSignature(roots *trustRoots, header *commonPb.BlockHeader, orgId string, certPEM, msg,
+	sig []byte) (*bcx509.Certificate, error) {
+	cert, err := ParseCert(certPEM)
+	if err != nil {
+		return nil, err
+	}
+	opts := roots.opts
+	opts.CurrentTime = time.Unix(header.BlockTimestamp, 0)
+	chains, err := cert.Verify(opts)
+	if err != nil {
+		return nil, fmt.Errorf("not a certificate from trusted roots, %s", err)
+	}
+	if len(cert.Subject.Organization) == 0 || cert.Subject.Organization[0] != orgId {
+		return nil, fmt.Errorf("signer does not belong to the organization it claims: %s", orgId)
+	}
+	issued := false
+	for _, chain := range chains {
+		if roots.orgs[string(chain[len(chain)-1].Raw)] == orgId {
+			issued = true
+			break
+		}
+	}
+	if !issued {
+		return nil, fmt.Errorf("signer is not issued by the trusted roots of %s", orgId)
+	}
+	if len(cert.Subject.OrganizationalUnit) == 0 ||
+		protocol.Role(strings.ToUpper(cert.Subject.OrganizationalUnit[0])) != protocol.RoleConsensusNode {
+		return nil, errors.New("signer is not a consensus node")
+	}
+	hashAlgo, err := bcx509.GetHashFromSignatureAlgorithm(cert.SignatureAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+	ok, err := cert.PublicKey.VerifyWithOpts(msg, sig, &bccrypto.SignOpts{
+		Hash: hashAlgo,
+		UID:  bccrypto.CRYPTO_DEFAULT_UID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errors.New("invalid signature")
+	}
+	return cert, nil
+}
+
+// calcMerklePath returns the sibling hashes from hashes[index] up to the merkle root, the merkle tree is the
+// same as hash.GetMerkleRoot: the leaves are padded with nil to a power of two, a nil right child is replaced
+// by its left sibling, and a node with a nil left child is nil
+func calcMerklePath(hashType string, hashes [][]byte, index int) ([][]byte, error) {
+	if index < 0 || index >= len(hashes) {
+		return nil, fmt.Errorf("merkle leaf index %d out of range", index)
+	}
+	level := make([][]byte, nextPowerOfTwo(len(hashes)))
+	copy(level, hashes)
+	path := make([][]byte, 0)
+	for len(level) > 1 {
+		path = append(path, level[index^1])
+		next := make([][]byte, len(level)/2)
+		for i := range next {
+			node, err := hashMerkleBranches(hashType, level[2*i], level[2*i+1])
+			if err != nil {
+				return nil, err
+			}
+			next[i] = node
+		}
+		level = next
+		index /= 2
+	}
+	return path, nil
+}
+
+// calcMerkleRootFromPath returns the merkle root of count leaves from the leaf of index and its merkle path
+func calcMerkleRootFromPath(hashType string, leaf []byte, index, count int, path [][]byte) ([]byte, error) {
+	if index < 0 || index >= count {
+		return nil, fmt.Errorf("merkle leaf index %d out of range", index)
+	}
+	width := nextPowerOfTwo(count)
+	if 1<<uint(len(path)) != width {
+		return nil, fmt.Errorf("merkle path length %d mismatch with %d leaves", len(path), count)
+	}
+	node := leaf
+	for _, sibling := range path {
+		// the sibling is nil if and only if it is beyond the leaves
+		siblingIndex := index ^ 1
+		if (siblingIndex < count) != (sibling != nil) {
+			return nil, errors.New("invalid merkle path")
+		}
+		var err error
+		if index%2 == 0 {
+			node, err = hashMerkleBranches(hashType, node, sibling)
+		} else {
+			node, err = hashMerkleBranches(hashType, sibling, node)
+		}
+		if err != nil {
+			return nil, err
+		}
+		index /= 2
+		count = (count + 1) / 2
+	}
+	return node, nil
+}
+
+func hashMerkleBranches(hashType string, left, right []byte) ([]byte, error) {
+	if left == nil {
+		return nil, nil
+	}
+	if right == nil {
+		right = left
+	}
+	data := make([]byte, 0, len(left)+len(right))
+	data = append(data, left...)
+	data = append(data, right...)
+	return hash.GetByStrType(hashType, data)
+}
+
+func nextPowerOfTwo(n int) int {
+	width := 1
+	for width < n {
+		width <<= 1
+	}
+	return width
+}
@@ -0,0 +1,80 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package vm
+
+import (
+	"fmt"
+
+	"chainmaker.org/chainmaker-go/utils"
+	acPb "chainmaker.org/chainmaker/pb-go/v2/accesscontrol"
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	"chainmaker.org/chainmaker/protocol/v2"
+)
+
+// methodAclPrincipal carries the method ACL of the user contract stored on chain, the access control provider
+// verifies the principal against the ACL instead of the policy configured for the resource name
+type methodAclPrincipal struct {
+	protocol.Principal
+	policy *acPb.Policy
+}
+
+// GetPolicy returns the method ACL
+func (p *methodAclPrincipal) GetPolicy() *acPb.Policy {
+	return p.policy
+}
+
+// verifyMethodAcl verify the signers of the tx against the ACL of the method of the user contract set by
+// CONTRACT_MANAGE, the method without ACL is not restricted. The evm contract dispatches the call by the selector
+// of the calldata, so its ACL is looked up by the selector, which must be the method of the tx
+func (m *VmManagerImpl) verifyMethodAcl(contract *commonPb.Contract, method string, parameters map[string][]byte,
+	txContext protocol.TxSimContext) error {
+	if method == protocol.ContractInitMethod || method == protocol.ContractUpgradeMethod {
+		return nil
+	}
+	if contract.RuntimeType == commonPb.RuntimeType_EVM {
+		selector := utils.GetEvmCallSelector(string(parameters[protocol.ContractEvmParamKey]))
+		if selector == "" || selector != utils.NormalizeEvmMethod(method) {
+			return fmt.Errorf("method[%s] of evm contract[%s] is not the selector of the calldata",
+				method, contract.Name)
+		}
+		method = selector
+	}
+	policy, err := utils.GetContractMethodAcl(txContext.Get, contract.Name, method)
+	if err != nil {
+		return fmt.Errorf("get acl of contract[%s] method[%s] failed, %s", contract.Name, method, err)
+	}
+	if policy == nil {
+		return nil
+	}
+
+	tx := txContext.GetTx()
+	txBytes, err := utils.CalcUnsignedTxBytes(tx)
+	if err != nil {
+		return err
+	}
+	endorsements := make([]*commonPb.EndorsementEntry, 0, len(tx.Endorsers)+1)
+	endorsements = append(endorsements, tx.Sender)
+	endorsements = append(endorsements, tx.Endorsers...)
+
+	ac, err := txContext.GetAccessControl()
+	if err != nil {
+		return err
+	}
+	resourceName := utils.GetContractMethodAclResourceName(contract.Name, method)
+	principal, err := ac.CreatePrincipal(resourceName, endorsements, txBytes)
+	if err != nil {
+		return fmt.Errorf("fail to construct authentication principal for %s: %s", resourceName, err)
+	}
+	ok, err := ac.VerifyPrincipal(&methodAclPrincipal{Principal: principal, policy: policy})
+	if err != nil {
+		return fmt.Errorf("authentication error for %s: %s", resourceName, err)
+	}
+	if !ok {
+		return fmt.Errorf("authentication failed for %s", resourceName)
+	}
+	return nil
+}
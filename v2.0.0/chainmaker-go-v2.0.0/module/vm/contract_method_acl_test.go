@@ -0,0 +1,90 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package vm
+
+import (
+	"errors"
+	"testing"
+
+	"chainmaker.org/chainmaker-go/utils"
+	acPb "chainmaker.org/chainmaker/pb-go/v2/accesscontrol"
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	"chainmaker.org/chainmaker/pb-go/v2/syscontract"
+	"chainmaker.org/chainmaker/protocol/v2"
+	"chainmaker.org/chainmaker/protocol/v2/mock"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+const testEvmTransferCalldata = "a9059cbb00000000000000000000000070997970c51812dc3a010c7d01b50e0d17dc79c8" +
+	"0000000000000000000000000000000000000000000000000000000000000064"
+
+// newMethodAclTestContext the method transfer of the evm contract token and the method increase of the wasm
+// contract counter are restricted, the signers of the tx satisfy no ACL
+func newMethodAclTestContext(t *testing.T) (protocol.TxSimContext, func()) {
+	ctrl := gomock.NewController(t)
+	policy, err := (&acPb.Policy{Rule: string(protocol.RuleAll), OrgList: []string{"org1"}}).Marshal()
+	require.Nil(t, err)
+	state := map[string][]byte{
+		string(utils.GetContractMethodAclDbKey("token", "a9059cbb")):   policy,
+		string(utils.GetContractMethodAclDbKey("counter", "increase")): policy,
+	}
+	txContext := mock.NewMockTxSimContext(ctrl)
+	txContext.EXPECT().Get(syscontract.SystemContract_CONTRACT_MANAGE.String(), gomock.Any()).DoAndReturn(
+		func(name string, key []byte) ([]byte, error) {
+			return state[string(key)], nil
+		}).AnyTimes()
+	txContext.EXPECT().GetTx().Return(&commonPb.Transaction{
+		Payload: &commonPb.Payload{TxId: "tx1"},
+		Sender:  &commonPb.EndorsementEntry{Signer: &acPb.Member{OrgId: "org2"}},
+	}).AnyTimes()
+	ac := mock.NewMockAccessControlProvider(ctrl)
+	ac.EXPECT().CreatePrincipal(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, nil).AnyTimes()
+	ac.EXPECT().VerifyPrincipal(gomock.Any()).DoAndReturn(func(principal protocol.Principal) (bool, error) {
+		if _, ok := principal.(*methodAclPrincipal); !ok {
+			return false, errors.New("not a method acl principal")
+		}
+		return false, nil
+	}).AnyTimes()
+	txContext.EXPECT().GetAccessControl().Return(ac, nil).AnyTimes()
+	return txContext, ctrl.Finish
+}
+
+func TestVmManagerImpl_VerifyMethodAcl(t *testing.T) {
+	txContext, fn := newMethodAclTestContext(t)
+	defer fn()
+	m := &VmManagerImpl{}
+
+	counter := &commonPb.Contract{Name: "counter", RuntimeType: commonPb.RuntimeType_WASMER}
+	require.NotNil(t, m.verifyMethodAcl(counter, "increase", nil, txContext))
+	require.Nil(t, m.verifyMethodAcl(counter, "get", nil, txContext))
+	require.Nil(t, m.verifyMethodAcl(counter, protocol.ContractUpgradeMethod, nil, txContext))
+}
+
+func TestVmManagerImpl_VerifyEvmMethodAcl(t *testing.T) {
+	txContext, fn := newMethodAclTestContext(t)
+	defer fn()
+	m := &VmManagerImpl{}
+
+	token := &commonPb.Contract{Name: "token", RuntimeType: commonPb.RuntimeType_EVM}
+	transfer := map[string][]byte{protocol.ContractEvmParamKey: []byte(testEvmTransferCalldata)}
+	// the acl of the selector applies to any spelling of the method
+	for _, method := range []string{"a9059cbb", "0xa9059cbb", "A9059CBB", "0XA9059CBB"} {
+		require.NotNil(t, m.verifyMethodAcl(token, method, transfer, txContext), method)
+	}
+	transfer[protocol.ContractEvmParamKey] = []byte("0x" + testEvmTransferCalldata)
+	require.NotNil(t, m.verifyMethodAcl(token, "a9059cbb", transfer, txContext))
+
+	// the method of the tx must be the selector of the calldata which dispatches the call
+	require.NotNil(t, m.verifyMethodAcl(token, "70a08231", transfer, txContext))
+	require.NotNil(t, m.verifyMethodAcl(token, "a9059cbb", map[string][]byte{
+		protocol.ContractEvmParamKey: []byte("a905")}, txContext))
+
+	balanceOf := map[string][]byte{protocol.ContractEvmParamKey: []byte("70A08231" +
+		"00000000000000000000000070997970c51812dc3a010c7d01b50e0d17dc79c8")}
+	require.Nil(t, m.verifyMethodAcl(token, "0x70a08231", balanceOf, txContext))
+}
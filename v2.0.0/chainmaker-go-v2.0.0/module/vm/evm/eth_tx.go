@@ -0,0 +1,139 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package evm
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"chainmaker.org/chainmaker-go/utils"
+	"chainmaker.org/chainmaker/common/v2/evmutils"
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	"chainmaker.org/chainmaker/protocol/v2"
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+const (
+	// EvmEthRawTxParamKey is the key of the payload parameter which carries the signed ethereum tx that the
+	// chainmaker tx is mapped from, the signer of the ethereum tx is the msg.sender of the contract
+	EvmEthRawTxParamKey = "__eth_raw_tx__"
+	// EvmEthCallerParamKey is the key of the payload parameter which specifies the msg.sender of the query tx,
+	// the value is a hex address, it is ignored by the invoke tx
+	EvmEthCallerParamKey = "__eth_from__"
+
+	// methodLen is the length of method selector in the call data
+	methodLen = 4
+)
+
+// verifyEthTx verifies the ethereum tx carried by the chainmaker tx and returns it with its signer. The ethereum
+// tx must be replay-protected with the chain id in chain config, the chainmaker tx id must be its hash, and it must
+// call the same contract with the same data and value as the chainmaker tx.
+func verifyEthTx(rawTx []byte, txId string, ethChainId *big.Int, address *evmutils.Int, method string,
+	messageData []byte, callValue *evmutils.Int) (*types.Transaction, *evmutils.Int, error) {
+	if len(messageData) < methodLen {
+		return nil, nil, errors.New("the data of ethereum tx is too short to call a method")
+	}
+	if ethChainId == nil {
+		return nil, nil, fmt.Errorf("ethereum tx is not allowed, %s is not set in chain config",
+			utils.EthChainIdConfigKey)
+	}
+	tx, sender, err := DecodeEthTx(rawTx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !tx.Protected() || tx.ChainId().Cmp(ethChainId) != 0 {
+		return nil, nil, fmt.Errorf("only the replay-protected ethereum tx of chain id %s is allowed", ethChainId)
+	}
+	if !strings.EqualFold(txId, hex.EncodeToString(tx.Hash().Bytes())) {
+		return nil, nil, errors.New("the tx id is not the hash of ethereum tx")
+	}
+	if tx.To() == nil || *tx.To() != ethcommon.BigToAddress(address.Int) {
+		return nil, nil, errors.New("the receiver of ethereum tx is not the contract")
+	}
+	if !bytes.Equal(tx.Data(), messageData) ||
+		!strings.EqualFold(hex.EncodeToString(messageData[:methodLen]), method) {
+		return nil, nil, errors.New("the data of ethereum tx does not match the method and parameters")
+	}
+	if tx.Value().Cmp(callValue.Int) != 0 {
+		return nil, nil, errors.New("the value of ethereum tx does not match the call value")
+	}
+	return tx, sender, nil
+}
+
+// useEthNonce checks the nonce of the ethereum tx against the count of the txs sent by the signer in state and
+// increases the count, the count is not increased if the tx fails as its write set is dropped
+func useEthNonce(txSimContext protocol.TxSimContext, tx *types.Transaction, sender *evmutils.Int) error {
+	key := utils.EthNonceKey(ethcommon.BigToAddress(sender.Int).Bytes())
+	value, err := txSimContext.Get(utils.TxNonceContractName, key)
+	if err != nil {
+		return err
+	}
+	nonce, err := utils.DecodeTxNonce(value)
+	if err != nil {
+		return err
+	}
+	if tx.Nonce() != nonce {
+		return fmt.Errorf("invalid nonce of ethereum tx, expect %d, got %d", nonce, tx.Nonce())
+	}
+	return txSimContext.Put(utils.TxNonceContractName, key, utils.EncodeTxNonce(nonce+1))
+}
+
+// DecodeEthTx decodes the signed ethereum tx in the binary format of go-ethereum and recovers its signer
+func DecodeEthTx(rawTx []byte) (*types.Transaction, *evmutils.Int, error) {
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(rawTx); err != nil {
+		return nil, nil, fmt.Errorf("invalid ethereum tx, %s", err)
+	}
+	from, err := types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid signature of ethereum tx, %s", err)
+	}
+	return tx, evmutils.FromBigInt(new(big.Int).SetBytes(from.Bytes())), nil
+}
+
+// loadEthSender returns the msg.sender specified by the ethereum tx or the query parameter, it returns nil if
+// neither is set. The ethereum tx is verified by verifyEthTx and its nonce is used.
+func loadEthSender(txSimContext protocol.TxSimContext, parameters map[string][]byte, address *evmutils.Int,
+	method string, messageData []byte, callValue *evmutils.Int) (*evmutils.Int, error) {
+	if rawTx, ok := parameters[EvmEthRawTxParamKey]; ok {
+		chainConfig, err := txSimContext.GetBlockchainStore().GetLastChainConfig()
+		if err != nil {
+			return nil, fmt.Errorf("get chain config failed, %s", err)
+		}
+		ethChainId, err := utils.GetEthChainId(chainConfig)
+		if err != nil {
+			return nil, err
+		}
+		tx, sender, err := verifyEthTx(rawTx, txSimContext.GetTx().Payload.TxId, ethChainId, address, method,
+			messageData, callValue)
+		if err != nil {
+			return nil, err
+		}
+		if err = useEthNonce(txSimContext, tx, sender); err != nil {
+			return nil, err
+		}
+		return sender, nil
+	}
+
+	caller := string(parameters[EvmEthCallerParamKey])
+	if len(caller) == 0 || txSimContext.GetTx().Payload.TxType != commonPb.TxType_QUERY_CONTRACT {
+		return nil, nil
+	}
+	if evmutils.Has0xPrefix(caller) {
+		caller = caller[2:]
+	}
+	sender := evmutils.FromHexString(caller)
+	if sender == nil {
+		return nil, fmt.Errorf("invalid caller address %s", caller)
+	}
+	return sender, nil
+}
@@ -0,0 +1,121 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package evm
+
+import (
+	"encoding/hex"
+	"math/big"
+	"strings"
+	"testing"
+
+	"chainmaker.org/chainmaker-go/utils"
+	"chainmaker.org/chainmaker/common/v2/evmutils"
+	"chainmaker.org/chainmaker/pb-go/v2/common"
+	"chainmaker.org/chainmaker/protocol/v2"
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+)
+
+// the ethereum tx signed by the first account of hardhat with chain id 1337, it calls transfer of the contract
+const (
+	testEthRawTx    = "f8a78080830186a0945fbdb2315678afecb367f032d93f642f64180aa380b844a9059cbb00000000000000000000000070997970c51812dc3a010c7d01b50e0d17dc79c80000000000000000000000000000000000000000000000000000000000000064820a95a0e8013ab7eff7746ea97111636c466cd1a7bd3ec5f8abb5011dfd4d6fe44222ada0296906045d784c6ea6cb0284e0d4d0208a7cfbf02923e190b0f711dee44a4915"
+	testEthTxData   = "a9059cbb00000000000000000000000070997970c51812dc3a010c7d01b50e0d17dc79c80000000000000000000000000000000000000000000000000000000000000064"
+	testEthTxHash   = "944f06b9013ad580e9bf0964d3f1ff9f8231a63ed09988cf0770e07e736b4c4c"
+	testEthSender   = "f39fd6e51aad88f6f4ce6ab8827279cfffb92266"
+	testEthContract = "5fbdb2315678afecb367f032d93f642f64180aa3"
+)
+
+// ethTestContext is the tx context whose state is a map, the other methods are not implemented
+type ethTestContext struct {
+	protocol.TxSimContext
+	tx    *common.Transaction
+	state map[string][]byte
+}
+
+func (c *ethTestContext) GetTx() *common.Transaction {
+	return c.tx
+}
+
+func (c *ethTestContext) Get(contractName string, key []byte) ([]byte, error) {
+	return c.state[contractName+"/"+string(key)], nil
+}
+
+func (c *ethTestContext) Put(contractName string, key []byte, value []byte) error {
+	c.state[contractName+"/"+string(key)] = value
+	return nil
+}
+
+func TestVerifyEthTx(t *testing.T) {
+	rawTx, _ := hex.DecodeString(testEthRawTx)
+	data, _ := hex.DecodeString(testEthTxData)
+	contract := evmutils.FromHexString(testEthContract)
+	chainId := big.NewInt(1337)
+
+	tx, sender, err := DecodeEthTx(rawTx)
+	assert.Nil(t, err)
+	assert.Equal(t, testEthTxHash, hex.EncodeToString(tx.Hash().Bytes()))
+	assert.Equal(t, testEthSender, hex.EncodeToString(sender.Bytes()))
+
+	_, sender, err = verifyEthTx(rawTx, testEthTxHash, chainId, contract, "a9059cbb", data, evmutils.New(0))
+	assert.Nil(t, err)
+	assert.Equal(t, testEthSender, hex.EncodeToString(sender.Bytes()))
+
+	// the ethereum tx is bound to the chainmaker tx id and the chain id in chain config
+	_, _, err = verifyEthTx(rawTx, strings.Repeat("0", 64), chainId, contract, "a9059cbb", data, evmutils.New(0))
+	assert.NotNil(t, err)
+	_, _, err = verifyEthTx(rawTx, testEthTxHash, big.NewInt(1), contract, "a9059cbb", data, evmutils.New(0))
+	assert.NotNil(t, err)
+	_, _, err = verifyEthTx(rawTx, testEthTxHash, nil, contract, "a9059cbb", data, evmutils.New(0))
+	assert.NotNil(t, err)
+
+	// the chainmaker tx must be the same call as the ethereum tx
+	_, _, err = verifyEthTx(rawTx, testEthTxHash, chainId, evmutils.FromHexString(testEthSender), "a9059cbb",
+		data, evmutils.New(0))
+	assert.NotNil(t, err)
+	_, _, err = verifyEthTx(rawTx, testEthTxHash, chainId, contract, "70a08231", data, evmutils.New(0))
+	assert.NotNil(t, err)
+	_, _, err = verifyEthTx(rawTx, testEthTxHash, chainId, contract, "a9059cbb", data[:36], evmutils.New(0))
+	assert.NotNil(t, err)
+	_, _, err = verifyEthTx(rawTx, testEthTxHash, chainId, contract, "a9059cbb", data, evmutils.New(1))
+	assert.NotNil(t, err)
+
+	// the modified signature changes the hash of the ethereum tx, so it is not the tx id any more
+	rawTx[len(rawTx)-1]++
+	_, _, err = verifyEthTx(rawTx, testEthTxHash, chainId, contract, "a9059cbb", data, evmutils.New(0))
+	assert.NotNil(t, err)
+}
+
+func TestUseEthNonce(t *testing.T) {
+	rawTx, _ := hex.DecodeString(testEthRawTx)
+	tx, sender, err := DecodeEthTx(rawTx)
+	assert.Nil(t, err)
+	ctx := &ethTestContext{state: make(map[string][]byte)}
+
+	// the nonce of the tx is 0, it can only be used once
+	assert.Nil(t, useEthNonce(ctx, tx, sender))
+	value, _ := ctx.Get(utils.TxNonceContractName, utils.EthNonceKey(ethcommon.HexToAddress(testEthSender).Bytes()))
+	nonce, err := utils.DecodeTxNonce(value)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, nonce)
+	assert.NotNil(t, useEthNonce(ctx, tx, sender))
+}
+
+func TestLoadEthSender_Query(t *testing.T) {
+	data, _ := hex.DecodeString(testEthTxData)
+	contract := evmutils.FromHexString(testEthContract)
+	ctx := &ethTestContext{tx: &common.Transaction{Payload: &common.Payload{TxType: common.TxType_QUERY_CONTRACT}}}
+
+	// the caller is only specified by query tx
+	params := map[string][]byte{EvmEthCallerParamKey: []byte("0x" + testEthSender)}
+	sender, err := loadEthSender(ctx, params, contract, "70a08231", data, evmutils.New(0))
+	assert.Nil(t, err)
+	assert.Equal(t, testEthSender, hex.EncodeToString(sender.Bytes()))
+	ctx.tx.Payload.TxType = common.TxType_INVOKE_CONTRACT
+	sender, err = loadEthSender(ctx, params, contract, "70a08231", data, evmutils.New(0))
+	assert.Nil(t, err)
+	assert.Nil(t, sender)
+}
@@ -82,6 +82,12 @@ func New(param EVMParam) *EVM {
 	return evm
 }
 
+// Transfer moves the value between the addresses before executing the contract,
+// the balances are written to the ledger by the result callback only if the execution succeeds
+func (e *EVM) Transfer(from *evmutils.Int, to *evmutils.Int, value *evmutils.Int) error {
+	return e.storage.Transfer(from, to, value)
+}
+
 func (e *EVM) subResult(result ExecuteResult, err error) {
 	if err == nil && result.ExitOpCode != opcodes.REVERT {
 		storage.MergeResultCache(&result.StorageCache, &e.storage.ResultCache)
@@ -175,11 +181,13 @@ func (e *EVM) getClosureDefaultEVM(param instructions.ClosureParam) *EVM {
 			Block:       e.context.Block,
 			Transaction: e.context.Transaction,
 			Message: environment.Message{
-				Data: param.CallData,
+				Value: evmutils.New(0),
+				Data:  param.CallData,
 			},
 			Parameters: e.context.Parameters,
 		},
 	})
+	newEVM.storage.SetParent(e.storage)
 
 	newEVM.context.Contract = environment.Contract{
 		Address: param.ContractAddress,
@@ -206,13 +214,19 @@ func (e *EVM) commonCall(param instructions.ClosureParam) ([]byte, error) {
 		newEVM.context.Message.Caller = e.context.Message.Caller
 	case opcodes.CALL:
 		newEVM.context.Contract.Address = param.ContractAddress
-		newEVM.context.Message.Value = e.context.Message.Value
+		newEVM.context.Message.Value = param.CallValue
 		newEVM.context.Message.Caller = e.context.Message.Caller
 	}
 	if param.OpCode == opcodes.STATICCALL || e.instructions.IsReadOnly() {
 		newEVM.instructions.SetReadOnly()
 	}
 
+	if param.OpCode == opcodes.CALL || param.OpCode == opcodes.CALLCODE {
+		if err := e.transferCallValue(newEVM, param.CallValue); err != nil {
+			return nil, err
+		}
+	}
+
 	ret, err := newEVM.ExecuteContract(false)
 	//ret, err := newEVM.ExecuteContract(opcodes.CALL == param.OpCode)
 
@@ -234,11 +248,29 @@ func (e *EVM) commonCreate(param instructions.ClosureParam) ([]byte, error) {
 	newEVM.context.Message.Value = param.CallValue
 	newEVM.context.Message.Caller = e.context.Contract.Address
 
+	if err := e.transferCallValue(newEVM, param.CallValue); err != nil {
+		return nil, err
+	}
+
 	ret, err := newEVM.ExecuteContract(true)
 	e.instructions.SetGasLimit(ret.GasLeft)
 	return ret.ResultData, err
 }
 
+// transferCallValue moves the call value from the current contract to the callee in the storage of the callee,
+// so the transfer is dropped together with the other modifications if the callee reverts
+func (e *EVM) transferCallValue(newEVM *EVM, value *evmutils.Int) error {
+	if value == nil || value.Int.Sign() == 0 {
+		return nil
+	}
+
+	if e.instructions.IsReadOnly() {
+		return utils.ErrWriteProtection
+	}
+
+	return newEVM.storage.Transfer(e.context.Contract.Address, newEVM.context.Contract.Address, value)
+}
+
 func closure(param instructions.ClosureParam) ([]byte, error) {
 	evm, ok := param.VM.(*EVM)
 	if !ok {
@@ -112,8 +112,13 @@ func revertAction(ctx *instructionsContext) ([]byte, error) {
 func selfDestructAction(ctx *instructionsContext) ([]byte, error) {
 	addr := ctx.stack.Pop()
 	contractAddr := ctx.environment.Contract.Address.Clone()
-	balance, _ := ctx.storage.Balance(contractAddr)
+	balance, err := ctx.storage.Balance(contractAddr)
+	if err != nil {
+		return nil, err
+	}
+	// refund the balance of the contract to the beneficiary
 	ctx.storage.BalanceModify(addr, balance, false)
+	ctx.storage.BalanceModify(contractAddr, balance, true)
 	ctx.storage.Destruct(contractAddr)
 	return nil, nil
 }
@@ -18,15 +18,29 @@ package storage
 
 import (
 	"encoding/hex"
+	"fmt"
 
 	"chainmaker.org/chainmaker-go/evm/evm-go/environment"
 	"chainmaker.org/chainmaker-go/logger"
 	"chainmaker.org/chainmaker/common/v2/evmutils"
+	"chainmaker.org/chainmaker/pb-go/v2/syscontract"
 	"chainmaker.org/chainmaker/protocol/v2"
 )
 
 var log = logger.GetLogger(logger.MODULE_VM)
 
+// the balances of the evm addresses are kept in the ledger of the DPoS ERC20 contract,
+// the key format is the same as dposmgr.KeyBalanceFormat
+const balanceKeyFormat = "B/%s"
+
+var balanceContractName = syscontract.SystemContract_DPOS_ERC20.String()
+
+// BalanceAccount returns the account of the address in the DPoS ERC20 ledger, it is the 40 characters hex string,
+// so the tokens can be transferred to an evm address by the DPoS ERC20 contract.
+func BalanceAccount(address *evmutils.Int) string {
+	return fmt.Sprintf("%040x", address.Int)
+}
+
 type ContractStorage struct {
 	ResultCache     ResultCache
 	ExternalStorage IExternalStorage
@@ -55,12 +69,35 @@ func NewStorage(extStorage IExternalStorage) *ContractStorage {
 	return s
 }
 
+// GetBalance returns the balance of the address in the DPoS ERC20 ledger
 func (c *ContractStorage) GetBalance(address *evmutils.Int) (*evmutils.Int, error) {
-	return evmutils.New(0), nil
+	account := BalanceAccount(address)
+	val, err := c.Ctx.Get(balanceContractName, []byte(fmt.Sprintf(balanceKeyFormat, account)))
+	if err != nil {
+		return nil, err
+	}
+	balance := evmutils.New(0)
+	if len(val) == 0 {
+		return balance, nil
+	}
+	if _, ok := balance.Int.SetString(string(val), 10); !ok {
+		return nil, fmt.Errorf("invalid balance %s of account %s", string(val), account)
+	}
+	return balance, nil
+}
+
+// SetBalance writes the balance of the address to the DPoS ERC20 ledger
+func (c *ContractStorage) SetBalance(address *evmutils.Int, balance *evmutils.Int) error {
+	key := fmt.Sprintf(balanceKeyFormat, BalanceAccount(address))
+	return c.Ctx.Put(balanceContractName, []byte(key), []byte(balance.Int.String()))
 }
 
 func (c *ContractStorage) CanTransfer(from, to, val *evmutils.Int) bool {
-	return false
+	balance, err := c.GetBalance(from)
+	if err != nil {
+		return false
+	}
+	return balance.Int.Cmp(val.Int) >= 0
 }
 
 func (c *ContractStorage) GetCode(address *evmutils.Int) (code []byte, err error) {
@@ -28,6 +28,8 @@ type Storage struct {
 	ResultCache     ResultCache
 	ExternalStorage IExternalStorage
 	readOnlyCache   readOnlyCache
+	// parent is the storage of the caller, the balances are read through it
+	parent *Storage
 }
 
 func New(extStorage IExternalStorage) *Storage {
@@ -105,6 +107,31 @@ func (s *Storage) BalanceModify(address *evmutils.Int, value *evmutils.Int, neg
 	}
 }
 
+// Transfer moves the value between the addresses in the result cache, the balance of from must be enough
+func (s *Storage) Transfer(from *evmutils.Int, to *evmutils.Int, value *evmutils.Int) error {
+	if value == nil || value.Int.Sign() == 0 {
+		return nil
+	}
+
+	b, err := s.Balance(from)
+	if err != nil {
+		return err
+	}
+
+	if value.Int.Sign() < 0 || b.Int.Cmp(value.Int) < 0 {
+		return utils.ErrInsufficientBalance
+	}
+
+	s.BalanceModify(from, value, true)
+	s.BalanceModify(to, value, false)
+	return nil
+}
+
+// SetParent sets the storage of the caller, so the balances modified by the caller are visible to the callee
+func (s *Storage) SetParent(parent *Storage) {
+	s.parent = parent
+}
+
 func (s *Storage) Log(address *evmutils.Int, topics [][]byte, data []byte, context environment.Context) {
 	//kString := address.String()
 	kString := hex.EncodeToString(address.Bytes())
@@ -142,8 +169,29 @@ func (s *Storage) commonGetter(key *evmutils.Int, cache Cache, getterFunc common
 	return b, err
 }
 
+// Balance returns the balance of the address, including the modifications in the result cache
 func (s *Storage) Balance(address *evmutils.Int) (*evmutils.Int, error) {
-	return s.ExternalStorage.GetBalance(address)
+	var (
+		b   *evmutils.Int
+		err error
+	)
+
+	if s.parent != nil {
+		b, err = s.parent.Balance(address)
+	} else {
+		b, err = s.ExternalStorage.GetBalance(address)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := evmutils.New(0)
+	result.Int.Set(b.Int)
+	if cached, exist := s.ResultCache.Balance[hex.EncodeToString(address.Bytes())]; exist {
+		result.Int.Add(result.Int, cached.Balance.Int)
+	}
+
+	return result, nil
 }
 func (s *Storage) SetCode(address *evmutils.Int, code []byte) {
 	//keyStr := address.String()
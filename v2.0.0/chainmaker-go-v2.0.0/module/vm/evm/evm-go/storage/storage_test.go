@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"testing"
+
+	"chainmaker.org/chainmaker-go/evm/evm-go/utils"
+	"chainmaker.org/chainmaker-go/evm/test"
+	"chainmaker.org/chainmaker/common/v2/evmutils"
+	pb "chainmaker.org/chainmaker/pb-go/v2/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorage_Transfer(t *testing.T) {
+	test.CertFilePath = "../../test/config/admin1.sing.crt"
+	_, txContext, _ := test.InitContextTest(pb.RuntimeType_EVM)
+
+	var (
+		user     = evmutils.MakeAddressFromString("user")
+		contract = evmutils.MakeAddressFromString("contract")
+		receiver = evmutils.MakeAddressFromString("receiver")
+	)
+	externalStore := &ContractStorage{Ctx: txContext}
+	require.NoError(t, externalStore.SetBalance(user, evmutils.New(100)))
+	require.True(t, externalStore.CanTransfer(user, contract, evmutils.New(100)))
+	require.False(t, externalStore.CanTransfer(user, contract, evmutils.New(101)))
+
+	s := New(externalStore)
+	require.NoError(t, s.Transfer(user, contract, evmutils.New(30)))
+	requireBalance(t, s, user, 70)
+	requireBalance(t, s, contract, 30)
+
+	// the callee sees the balances modified by the caller
+	callee := New(externalStore)
+	callee.SetParent(s)
+	require.Equal(t, utils.ErrInsufficientBalance, callee.Transfer(contract, receiver, evmutils.New(40)))
+	require.NoError(t, callee.Transfer(contract, receiver, evmutils.New(20)))
+	requireBalance(t, callee, contract, 10)
+	requireBalance(t, s, receiver, 0)
+
+	MergeResultCache(&callee.ResultCache, &s.ResultCache)
+	requireBalance(t, s, contract, 10)
+	requireBalance(t, s, receiver, 20)
+
+	// the ledger is not modified until the balances are applied
+	balance, err := externalStore.GetBalance(user)
+	require.NoError(t, err)
+	require.Equal(t, int64(100), balance.Int.Int64())
+}
+
+func requireBalance(t *testing.T, s *Storage, address *evmutils.Int, expected int64) {
+	balance, err := s.Balance(address)
+	require.NoError(t, err)
+	require.Equal(t, expected, balance.Int.Int64())
+}
@@ -17,11 +17,16 @@ import (
 	"chainmaker.org/chainmaker-go/evm/evm-go/opcodes"
 	"chainmaker.org/chainmaker-go/evm/evm-go/storage"
 	"chainmaker.org/chainmaker-go/logger"
+	"chainmaker.org/chainmaker-go/utils"
 	"chainmaker.org/chainmaker/common/v2/evmutils"
 	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
 	"chainmaker.org/chainmaker/protocol/v2"
 )
 
+// EvmValueParamKey is the key of the payload parameter which carries the value in decimal, it is transferred
+// from the sender to the contract with the tx and is the msg.value of the contract
+const EvmValueParamKey = "value"
+
 // RuntimeInstance evm runtime
 type RuntimeInstance struct {
 	Method        string             // invoke contract method
@@ -97,13 +102,9 @@ func (r *RuntimeInstance) Invoke(contract *commonPb.Contract, method string, byt
 	if err != nil {
 		return r.errorResult(contractResult, err, "get sender pk fail")
 	}
-
-	gasLeft := protocol.GasLimit - gasUsed
-	evmTransaction := environment.Transaction{
-		TxHash:   []byte(txId),
-		Origin:   senderAddress,
-		GasPrice: evmutils.New(protocol.EvmGasPrice),
-		GasLimit: evmutils.New(int64(gasLeft)),
+	callValue, err := loadCallValue(parameters)
+	if err != nil {
+		return r.errorResult(contractResult, err, "get call value fail")
 	}
 
 	// contract
@@ -112,6 +113,30 @@ func (r *RuntimeInstance) Invoke(contract *commonPb.Contract, method string, byt
 	if err != nil {
 		return r.errorResult(contractResult, err, "make address fail")
 	}
+	// the msg.sender of the tx mapped from an ethereum tx is the signer of the ethereum tx
+	if _, ok := parameters[EvmEthRawTxParamKey]; ok && isDeploy {
+		return r.errorResult(contractResult, nil, "ethereum tx is not allowed to deploy contract")
+	}
+	ethSender, err := loadEthSender(txSimContext, parameters, address, method, messageData, callValue)
+	if err != nil {
+		return r.errorResult(contractResult, err, "get ethereum sender fail")
+	}
+	if ethSender != nil {
+		senderAddress = ethSender
+	}
+
+	gasLimit := utils.TxGasLimit(txSimContext.GetTx())
+	if gasUsed >= gasLimit {
+		return r.errorResult(contractResult, nil, fmt.Sprintf("out of gas %d/%d", gasUsed, gasLimit))
+	}
+	gasLeft := gasLimit - gasUsed
+	evmTransaction := environment.Transaction{
+		TxHash:   []byte(txId),
+		Origin:   senderAddress,
+		GasPrice: evmutils.New(protocol.EvmGasPrice),
+		GasLimit: evmutils.New(int64(gasLeft)),
+	}
+
 	codeHash := evmutils.BytesDataToEVMIntHash(byteCode)
 	eContract := environment.Contract{
 		Address: address,
@@ -139,12 +164,16 @@ func (r *RuntimeInstance) Invoke(contract *commonPb.Contract, method string, byt
 			Transaction: evmTransaction,
 			Message: environment.Message{
 				Caller: senderAddress,
-				Value:  evmutils.New(0),
+				Value:  callValue,
 				Data:   messageData,
 			},
 			Parameters: parameters,
 		},
 	})
+	// transfer the value carried by the tx to the contract
+	if err = evm.Transfer(senderAddress, address, callValue); err != nil {
+		return r.errorResult(contractResult, err, "failed to transfer call value")
+	}
 	// init memory and env
 	evm_go.Load()
 	// execute method
@@ -159,6 +188,20 @@ func (r *RuntimeInstance) Invoke(contract *commonPb.Contract, method string, byt
 	contractResult.ContractEvent = r.ContractEvent
 	return contractResult
 }
+
+// loadCallValue parses the value carried by the tx, it is zero if not set
+func loadCallValue(parameters map[string][]byte) (*evmutils.Int, error) {
+	value := evmutils.New(0)
+	valueStr := string(parameters[EvmValueParamKey])
+	if len(valueStr) == 0 {
+		return value, nil
+	}
+	if _, ok := value.Int.SetString(valueStr, 10); !ok || value.Int.Sign() < 0 {
+		return nil, fmt.Errorf("value %s is not a non-negative decimal integer", valueStr)
+	}
+	return value, nil
+}
+
 func contractNameDecimalToAddress(cname string) (*evmutils.Int, error) {
 	// hexStr2 == hexStr2
 	// hexStr := hex.EncodeToString(evmutils.Keccak256([]byte("contractName")))[24:]
@@ -203,6 +246,12 @@ func (r *RuntimeInstance) callback(result evm_go.ExecuteResult, err error) {
 			//fmt.Println("n k val", n, k, val, val.String())
 		}
 	}
+	//apply the balance modifications, including the refunds of the destructed contracts
+	if err = r.applyBalances(result.StorageCache.Balance); err != nil {
+		r.Log.Errorf("failed to apply balances in contract [%s] execution，tx: [%s], error: [%s]",
+			r.Contract.Name, r.TxSimContext.GetTx().Payload.TxId, err.Error())
+		panic(err)
+	}
 	//TODO：Devin:销毁一个合约是在ContractManage合约中去操作的，这里能操作系统合约的状态数据？
 	//if len(result.StorageCache.Destructs) > 0 {
 	//	revokeKey := []byte(protocol.ContractRevoke + r.Contract.Name)
@@ -243,6 +292,28 @@ func (r *RuntimeInstance) callback(result evm_go.ExecuteResult, err error) {
 	r.Log.Debug("result:", result.ResultData)
 }
 
+// applyBalances writes the balances modified by the execution to the ledger
+func (r *RuntimeInstance) applyBalances(balances storage.BalanceCache) error {
+	externalStore := &storage.ContractStorage{Ctx: r.TxSimContext}
+	for _, b := range balances {
+		if b.Balance.Int.Sign() == 0 {
+			continue
+		}
+		balance, err := externalStore.GetBalance(b.Address)
+		if err != nil {
+			return err
+		}
+		balance.Int.Add(balance.Int, b.Balance.Int)
+		if balance.Int.Sign() < 0 {
+			return fmt.Errorf("insufficient balance of account %s", storage.BalanceAccount(b.Address))
+		}
+		if err = externalStore.SetBalance(b.Address, balance); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (r *RuntimeInstance) errorResult(contractResult *commonPb.ContractResult, err error, errMsg string) *commonPb.ContractResult {
 	contractResult.Code = 1
 	if err != nil {
@@ -0,0 +1,255 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package evm
+
+import (
+	"encoding/hex"
+	"testing"
+
+	evm_go "chainmaker.org/chainmaker-go/evm/evm-go"
+	"chainmaker.org/chainmaker-go/evm/evm-go/environment"
+	"chainmaker.org/chainmaker-go/evm/evm-go/opcodes"
+	"chainmaker.org/chainmaker-go/evm/evm-go/storage"
+	"chainmaker.org/chainmaker-go/evm/evm-go/utils"
+	"chainmaker.org/chainmaker-go/logger"
+	"chainmaker.org/chainmaker/common/v2/evmutils"
+	"chainmaker.org/chainmaker/pb-go/v2/common"
+	"github.com/stretchr/testify/assert"
+)
+
+// balanceTestStorage is the ledger of the tx context, the code of the contracts called is kept in memory
+type balanceTestStorage struct {
+	*storage.ContractStorage
+	codes map[string][]byte
+}
+
+func (s *balanceTestStorage) GetCode(address *evmutils.Int) ([]byte, error) {
+	return s.codes[storage.BalanceAccount(address)], nil
+}
+
+func (s *balanceTestStorage) GetCodeHash(address *evmutils.Int) (*evmutils.Int, error) {
+	return evmutils.BytesDataToEVMIntHash(s.codes[storage.BalanceAccount(address)]), nil
+}
+
+var (
+	balanceTestUser        = evmutils.MakeAddressFromString("user")
+	balanceTestCaller      = evmutils.MakeAddressFromString("caller")
+	balanceTestCallee      = evmutils.MakeAddressFromString("callee")
+	balanceTestNested      = evmutils.MakeAddressFromString("nested")
+	balanceTestBeneficiary = evmutils.MakeAddressFromString("beneficiary")
+)
+
+// pushAddress returns the code pushing the address on the stack
+func pushAddress(address *evmutils.Int) []byte {
+	b, _ := hex.DecodeString(storage.BalanceAccount(address))
+	return append([]byte{byte(opcodes.PUSH20)}, b...)
+}
+
+// callWithValue returns the code calling the contract of address with value and no call data
+func callWithValue(address *evmutils.Int, value byte) []byte {
+	code := []byte{
+		byte(opcodes.PUSH1), 0, // ret length
+		byte(opcodes.PUSH1), 0, // ret offset
+		byte(opcodes.PUSH1), 0, // args length
+		byte(opcodes.PUSH1), 0, // args offset
+		byte(opcodes.PUSH1), value,
+	}
+	code = append(code, pushAddress(address)...)
+	return append(code, byte(opcodes.GAS), byte(opcodes.CALL), byte(opcodes.POP))
+}
+
+func concatCode(codes ...[]byte) []byte {
+	var code []byte
+	for _, c := range codes {
+		code = append(code, c...)
+	}
+	return code
+}
+
+var (
+	stopCode         = []byte{byte(opcodes.STOP)}
+	revertCode       = []byte{byte(opcodes.PUSH1), 0, byte(opcodes.PUSH1), 0, byte(opcodes.REVERT)}
+	selfDestructCode = append(pushAddress(balanceTestBeneficiary), byte(opcodes.SELFDESTRUCT))
+)
+
+// executeBalanceTest runs the code of the caller contract called by the user, the balances modified are written
+// to the ledger by the result callback of the runtime
+func executeBalanceTest(t *testing.T, codes map[*evmutils.Int][]byte,
+	balances map[*evmutils.Int]int64) (*storage.ContractStorage, error) {
+
+	txContext := &ethTestContext{
+		tx:    &common.Transaction{Payload: &common.Payload{TxId: "balanceTest"}},
+		state: make(map[string][]byte),
+	}
+	externalStore := &storage.ContractStorage{Ctx: txContext}
+	for address, balance := range balances {
+		assert.Nil(t, externalStore.SetBalance(address, evmutils.New(balance)))
+	}
+	store := &balanceTestStorage{ContractStorage: externalStore, codes: make(map[string][]byte)}
+	for address, code := range codes {
+		store.codes[storage.BalanceAccount(address)] = code
+	}
+
+	runtimeInstance := &RuntimeInstance{
+		ChainId:      "chain01",
+		Contract:     &common.Contract{Name: storage.BalanceAccount(balanceTestCaller)},
+		Log:          logger.GetLogger(logger.MODULE_VM),
+		TxSimContext: txContext,
+	}
+	code := codes[balanceTestCaller]
+	evm := evm_go.New(evm_go.EVMParam{
+		MaxStackDepth:  1024,
+		ExternalStore:  store,
+		ResultCallback: runtimeInstance.callback,
+		Context: &environment.Context{
+			Block: environment.Block{
+				Coinbase:   balanceTestUser,
+				Timestamp:  evmutils.New(0),
+				Number:     evmutils.New(0),
+				Difficulty: evmutils.New(0),
+				GasLimit:   evmutils.New(1e10),
+			},
+			Contract: environment.Contract{
+				Address: balanceTestCaller,
+				Code:    code,
+				Hash:    evmutils.BytesDataToEVMIntHash(code),
+			},
+			Transaction: environment.Transaction{
+				TxHash:   []byte("balanceTest"),
+				Origin:   balanceTestUser,
+				GasPrice: evmutils.New(1),
+				GasLimit: evmutils.New(1e8),
+			},
+			Message: environment.Message{
+				Caller: balanceTestUser,
+				Value:  evmutils.New(0),
+			},
+		},
+	})
+	_, err := evm.ExecuteContract(false)
+	return externalStore, err
+}
+
+func assertBalance(t *testing.T, externalStore *storage.ContractStorage, address *evmutils.Int, expected int64) {
+	balance, err := externalStore.GetBalance(address)
+	assert.Nil(t, err)
+	assert.Equal(t, expected, balance.Int.Int64(), storage.BalanceAccount(address))
+}
+
+func TestRuntimeInstance_CallValue(t *testing.T) {
+	tests := []struct {
+		name     string
+		codes    map[*evmutils.Int][]byte
+		balances map[*evmutils.Int]int64
+		want     map[*evmutils.Int]int64
+	}{
+		{
+			name: "call",
+			codes: map[*evmutils.Int][]byte{
+				balanceTestCaller: concatCode(callWithValue(balanceTestCallee, 30), stopCode),
+				balanceTestCallee: stopCode,
+			},
+			balances: map[*evmutils.Int]int64{balanceTestCaller: 100},
+			want:     map[*evmutils.Int]int64{balanceTestCaller: 70, balanceTestCallee: 30},
+		},
+		{
+			// the callee spends the value received from the caller
+			name: "nested call",
+			codes: map[*evmutils.Int][]byte{
+				balanceTestCaller: concatCode(callWithValue(balanceTestCallee, 30), stopCode),
+				balanceTestCallee: concatCode(callWithValue(balanceTestNested, 40), stopCode),
+				balanceTestNested: stopCode,
+			},
+			balances: map[*evmutils.Int]int64{balanceTestCaller: 100, balanceTestCallee: 10},
+			want: map[*evmutils.Int]int64{
+				balanceTestCaller: 70, balanceTestCallee: 0, balanceTestNested: 40,
+			},
+		},
+		{
+			// the transfers of the callee and to the callee are dropped, the caller goes on
+			name: "revert",
+			codes: map[*evmutils.Int][]byte{
+				balanceTestCaller: concatCode(callWithValue(balanceTestCallee, 30),
+					callWithValue(balanceTestBeneficiary, 20), stopCode),
+				balanceTestCallee:      concatCode(callWithValue(balanceTestNested, 10), revertCode),
+				balanceTestNested:      stopCode,
+				balanceTestBeneficiary: stopCode,
+			},
+			balances: map[*evmutils.Int]int64{balanceTestCaller: 100},
+			want: map[*evmutils.Int]int64{
+				balanceTestCaller: 80, balanceTestCallee: 0, balanceTestNested: 0, balanceTestBeneficiary: 20,
+			},
+		},
+		{
+			// the beneficiary is credited with the balance of the callee including the value received
+			name: "selfdestruct",
+			codes: map[*evmutils.Int][]byte{
+				balanceTestCaller: concatCode(callWithValue(balanceTestCallee, 30), stopCode),
+				balanceTestCallee: selfDestructCode,
+			},
+			balances: map[*evmutils.Int]int64{
+				balanceTestCaller: 100, balanceTestCallee: 50, balanceTestBeneficiary: 5,
+			},
+			want: map[*evmutils.Int]int64{
+				balanceTestCaller: 70, balanceTestCallee: 0, balanceTestBeneficiary: 85,
+			},
+		},
+		{
+			name: "selfdestruct reverted",
+			codes: map[*evmutils.Int][]byte{
+				balanceTestCaller: concatCode(callWithValue(balanceTestCallee, 30), stopCode),
+				balanceTestCallee: concatCode(callWithValue(balanceTestNested, 0), revertCode),
+				balanceTestNested: selfDestructCode,
+			},
+			balances: map[*evmutils.Int]int64{balanceTestCaller: 100, balanceTestNested: 50},
+			want: map[*evmutils.Int]int64{
+				balanceTestCaller: 100, balanceTestCallee: 0, balanceTestNested: 50, balanceTestBeneficiary: 0,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			externalStore, err := executeBalanceTest(t, test.codes, test.balances)
+			assert.Nil(t, err)
+			for address, balance := range test.want {
+				assertBalance(t, externalStore, address, balance)
+			}
+		})
+	}
+}
+
+func TestRuntimeInstance_CallValueInsufficientBalance(t *testing.T) {
+	codes := map[*evmutils.Int][]byte{
+		balanceTestCaller: concatCode(callWithValue(balanceTestCallee, 30), stopCode),
+		balanceTestCallee: stopCode,
+	}
+	defer func() {
+		// the runtime fails the tx with the error of the transfer
+		assert.Equal(t, utils.ErrInsufficientBalance, recover())
+	}()
+	_, _ = executeBalanceTest(t, codes, map[*evmutils.Int]int64{balanceTestCaller: 20})
+	t.Fatal("the call with value more than the balance must fail")
+}
+
+func TestRuntimeInstance_ApplyBalances(t *testing.T) {
+	txContext := &ethTestContext{state: make(map[string][]byte)}
+	externalStore := &storage.ContractStorage{Ctx: txContext}
+	assert.Nil(t, externalStore.SetBalance(balanceTestCaller, evmutils.New(100)))
+	runtimeInstance := &RuntimeInstance{TxSimContext: txContext}
+
+	s := storage.New(externalStore)
+	assert.Nil(t, s.Transfer(balanceTestCaller, balanceTestCallee, evmutils.New(30)))
+	assert.Nil(t, runtimeInstance.applyBalances(s.ResultCache.Balance))
+	assertBalance(t, externalStore, balanceTestCaller, 70)
+	assertBalance(t, externalStore, balanceTestCallee, 30)
+
+	// the balance of the ledger can not be overdrawn
+	s = storage.New(externalStore)
+	s.BalanceModify(balanceTestCallee, evmutils.New(31), true)
+	assert.NotNil(t, runtimeInstance.applyBalances(s.ResultCache.Balance))
+}
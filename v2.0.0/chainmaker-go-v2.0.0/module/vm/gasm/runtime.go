@@ -17,6 +17,7 @@ import (
 	"chainmaker.org/chainmaker-go/gasm/gasm-go/wasi"
 	"chainmaker.org/chainmaker-go/gasm/gasm-go/wasm"
 	"chainmaker.org/chainmaker-go/logger"
+	"chainmaker.org/chainmaker-go/utils"
 	"chainmaker.org/chainmaker/common/v2/serialize"
 	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
 	"chainmaker.org/chainmaker/protocol/v2"
@@ -149,7 +150,7 @@ func (r *RuntimeInstance) Invoke(contractId *commonPb.Contract, method string, b
 		}
 	}
 
-	if vm, err = wasm.NewVM(mod, gasUsed, protocol.GasLimit, protocol.TimeLimit); err != nil {
+	if vm, err = wasm.NewVM(mod, gasUsed, utils.TxGasLimit(tx), protocol.TimeLimit); err != nil {
 		contractResult.Code = 1
 		contractResult.Message = err.Error()
 		r.Log.Errorf("invoke gasm,tx id:%s, error= %s", tx.GetPayload().TxId, err.Error())
@@ -9,6 +9,7 @@ package blockcontract
 
 import (
 	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"math"
@@ -17,8 +18,10 @@ import (
 	"strings"
 
 	"chainmaker.org/chainmaker-go/localconf"
+	"chainmaker.org/chainmaker-go/utils"
 	"chainmaker.org/chainmaker-go/vm/native/common"
 	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	configPb "chainmaker.org/chainmaker/pb-go/v2/config"
 	discoveryPb "chainmaker.org/chainmaker/pb-go/v2/discovery"
 	"chainmaker.org/chainmaker/pb-go/v2/syscontract"
 	"chainmaker.org/chainmaker/protocol/v2"
@@ -26,10 +29,23 @@ import (
 )
 
 const (
-	paramNameBlockHeight = "blockHeight"
-	paramNameWithRWSet   = "withRWSet"
-	paramNameBlockHash   = "blockHash"
-	paramNameTxId        = "txId"
+	paramNameBlockHeight  = "blockHeight"
+	paramNameWithRWSet    = "withRWSet"
+	paramNameBlockHash    = "blockHash"
+	paramNameTxId         = "txId"
+	paramNameContractName = "contractName"
+	paramNameKey          = "key"
+	paramNameProof        = "proof"
+)
+
+// the query methods not defined in syscontract.ChainQueryFunction
+const (
+	// MethodGetStateWithProof is the query method of the state with its proof against the state root of a block
+	MethodGetStateWithProof = "GET_STATE_WITH_PROOF"
+	// MethodGetTxProofByTxId is the query method of the proof that a tx is included in its block
+	MethodGetTxProofByTxId = "GET_TX_PROOF_BY_TX_ID"
+	// MethodVerifyTxProof is the query method to verify a tx proof against the block header in the local ledger
+	MethodVerifyTxProof = "VERIFY_TX_PROOF"
 )
 
 var (
@@ -63,6 +79,8 @@ func registerBlockContactMethods(log protocol.Logger) map[string]common.Contract
 	queryMethodMap[syscontract.ChainQueryFunction_GET_BLOCK_WITH_TXRWSETS_BY_HASH.String()] = blockRuntime.GetBlockWithTxRWSetsByHash
 	queryMethodMap[syscontract.ChainQueryFunction_GET_BLOCK_BY_TX_ID.String()] = blockRuntime.GetBlockByTxId
 	queryMethodMap[syscontract.ChainQueryFunction_GET_TX_BY_TX_ID.String()] = blockRuntime.GetTxByTxId
+	queryMethodMap[MethodGetTxProofByTxId] = blockRuntime.GetTxProofByTxId
+	queryMethodMap[MethodVerifyTxProof] = blockRuntime.VerifyTxProof
 	queryMethodMap[syscontract.ChainQueryFunction_GET_LAST_CONFIG_BLOCK.String()] = blockRuntime.GetLastConfigBlock
 	queryMethodMap[syscontract.ChainQueryFunction_GET_LAST_BLOCK.String()] = blockRuntime.GetLastBlock
 	queryMethodMap[syscontract.ChainQueryFunction_GET_CHAIN_INFO.String()] = blockRuntime.GetChainInfo
@@ -72,6 +90,7 @@ func registerBlockContactMethods(log protocol.Logger) map[string]common.Contract
 	queryMethodMap[syscontract.ChainQueryFunction_GET_BLOCK_HEIGHT_BY_HASH.String()] = blockRuntime.GetBlockHeightByHash
 	queryMethodMap[syscontract.ChainQueryFunction_GET_BLOCK_HEADER_BY_HEIGHT.String()] = blockRuntime.GetBlockHeaderByHeight
 	queryMethodMap[syscontract.ChainQueryFunction_GET_ARCHIVED_BLOCK_HEIGHT.String()] = blockRuntime.GetArchiveBlockHeight
+	queryMethodMap[MethodGetStateWithProof] = blockRuntime.GetStateWithProof
 	return queryMethodMap
 }
 
@@ -80,10 +99,19 @@ type BlockRuntime struct {
 }
 
 type BlockRuntimeParam struct {
-	height    uint64
-	withRWSet string
-	hash      string
-	txId      string
+	height       uint64
+	withRWSet    string
+	hash         string
+	txId         string
+	contractName string
+	key          string
+	proof        string
+}
+
+// stateProofStore is implemented by the blockchain store which maintains the state tree
+type stateProofStore interface {
+	IsStateTreeEnabled() (bool, error)
+	GetStateWithProof(contractName string, key []byte, blockHeight uint64) (*utils.StateWithProof, error)
 }
 
 // GetNodeChainList return list of chain
@@ -506,6 +534,118 @@ func (r *BlockRuntime) GetTxByTxId(txSimContext protocol.TxSimContext, parameter
 
 }
 
+// GetTxProofByTxId returns the proof that the tx is included in its block, the result is json of utils.TxProof
+func (r *BlockRuntime) GetTxProofByTxId(txSimContext protocol.TxSimContext, parameters map[string][]byte) (
+	[]byte, error) {
+	var errMsg string
+	var err error
+
+	// check params
+	var param *BlockRuntimeParam
+	if param, err = r.validateParams(parameters, paramNameTxId); err != nil {
+		return nil, err
+	}
+
+	chainId := txSimContext.GetTx().Payload.ChainId
+
+	store := txSimContext.GetBlockchainStore()
+	if store == nil {
+		return nil, errStoreIsNil
+	}
+
+	var block *commonPb.Block
+	if block, err = r.getBlockByTxId(store, chainId, param.txId); err != nil {
+		return nil, err
+	}
+
+	chainConfig, err := r.getChainConfig(txSimContext)
+	if err != nil {
+		return nil, err
+	}
+	if !utils.IsTxProofSupported(chainConfig.Consensus.Type) {
+		errMsg = fmt.Sprintf("tx proof is not supported by consensus %s, which does not keep the precommit votes "+
+			"in blocks", chainConfig.Consensus.Type)
+		r.log.Errorf(errMsg)
+		return nil, fmt.Errorf(errMsg)
+	}
+
+	var configBlock *commonPb.Block
+	if configBlock, err = r.getBlockByHeight(store, chainId, block.Header.PreConfHeight); err != nil {
+		return nil, err
+	}
+	txProof, err := utils.NewTxProof(block, configBlock, param.txId, chainConfig.Crypto.Hash, func(certId []byte) (
+		[]byte, error) {
+		cert, err := txSimContext.Get(syscontract.SystemContract_CERT_MANAGE.String(),
+			[]byte(hex.EncodeToString(certId)))
+		if err != nil {
+			return nil, err
+		}
+		if cert == nil {
+			return nil, fmt.Errorf("cert %x not found", certId)
+		}
+		return cert, nil
+	})
+	if err != nil {
+		errMsg = fmt.Sprintf("build tx proof failed, %s", err.Error())
+		r.log.Errorf(errMsg)
+		return nil, fmt.Errorf(errMsg)
+	}
+
+	txProofBytes, err := json.Marshal(txProof)
+	if err != nil {
+		errMsg = fmt.Sprintf("marshal tx proof failed, %s", err.Error())
+		r.log.Errorf(errMsg)
+		return nil, fmt.Errorf(errMsg)
+	}
+	return txProofBytes, nil
+}
+
+// VerifyTxProof verifies the tx proof in json of utils.TxProof against the block header in the local ledger,
+// it serves the inclusion checks on a light node which keeps the verified headers only,
+// the result is the height of the block which includes the tx
+func (r *BlockRuntime) VerifyTxProof(txSimContext protocol.TxSimContext, parameters map[string][]byte) (
+	[]byte, error) {
+	var errMsg string
+	var err error
+
+	// check params
+	var param *BlockRuntimeParam
+	if param, err = r.validateParams(parameters, paramNameProof); err != nil {
+		return nil, err
+	}
+	proof := &utils.TxProof{}
+	if err = json.Unmarshal([]byte(param.proof), proof); err != nil || proof.Header == nil {
+		errMsg = fmt.Sprintf("invalid tx proof, %v", err)
+		r.log.Error(errMsg)
+		return nil, errors.New(errMsg)
+	}
+
+	chainId := txSimContext.GetTx().Payload.ChainId
+
+	store := txSimContext.GetBlockchainStore()
+	if store == nil {
+		return nil, errStoreIsNil
+	}
+
+	header, err := store.GetBlockHeaderByHeight(proof.Header.BlockHeight)
+	if err = r.handleError(header, err, chainId); err != nil {
+		return nil, err
+	}
+
+	// the hashes are calculated with the hash type of the chain
+	chainConfig, err := r.getChainConfig(txSimContext)
+	if err != nil {
+		return nil, err
+	}
+	proof.HashType = chainConfig.Crypto.Hash
+	if err = utils.VerifyTxInclusion(proof, header); err != nil {
+		errMsg = fmt.Sprintf("verify tx proof failed, %s", err.Error())
+		r.log.Warn(errMsg)
+		return nil, errors.New(errMsg)
+	}
+	return []byte(strconv.FormatUint(header.BlockHeight, 10)), nil
+}
+
 func (a *BlockRuntime) GetFullBlockByHeight(context protocol.TxSimContext, params map[string][]byte) ([]byte, error) {
 	var errMsg string
 	var err error
@@ -598,6 +738,68 @@ func (a *BlockRuntime) GetBlockHeaderByHeight(context protocol.TxSimContext, par
 	return blockHeaderBytes, nil
 }
 
+// GetStateWithProof returns the state and its proof against the state root committed in the block of blockHeight,
+// the state root is the root after the previous block, the result is json of utils.StateWithProof
+func (r *BlockRuntime) GetStateWithProof(context protocol.TxSimContext, params map[string][]byte) ([]byte, error) {
+	var err error
+	var errMsg string
+	// check params
+	var param *BlockRuntimeParam
+	if param, err = r.validateParams(params, paramNameContractName, paramNameKey, paramNameBlockHeight); err != nil {
+		return nil, err
+	}
+
+	store, ok := context.GetBlockchainStore().(stateProofStore)
+	if !ok {
+		errMsg = "state tree is not enabled"
+		r.log.Error(errMsg)
+		return nil, errors.New(errMsg)
+	}
+	if enabled, err := store.IsStateTreeEnabled(); err != nil || !enabled {
+		errMsg = fmt.Sprintf("state tree is not enabled, err: %v", err)
+		r.log.Error(errMsg)
+		return nil, errors.New(errMsg)
+	}
+	if param.height == math.MaxUint64 {
+		var block *commonPb.Block
+		if block, err = r.getBlockByHeight(context.GetBlockchainStore(),
+			context.GetTx().Payload.ChainId, param.height); err != nil {
+			return nil, err
+		}
+		param.height = block.Header.BlockHeight
+	}
+
+	stateWithProof, err := store.GetStateWithProof(param.contractName, []byte(param.key), param.height)
+	if err != nil {
+		errMsg = fmt.Sprintf("get state with proof failed, %s", err.Error())
+		r.log.Error(errMsg)
+		return nil, errors.New(errMsg)
+	}
+
+	stateWithProofBytes, err := json.Marshal(stateWithProof)
+	if err != nil {
+		errMsg = fmt.Sprintf("marshal state with proof failed, %s", err.Error())
+		r.log.Error(errMsg)
+		return nil, errors.New(errMsg)
+	}
+	return stateWithProofBytes, nil
+}
+
+func (r *BlockRuntime) getChainConfig(txSimContext protocol.TxSimContext) (*configPb.ChainConfig, error) {
+	chainConfigBytes, err := txSimContext.Get(syscontract.SystemContract_CHAIN_CONFIG.String(),
+		[]byte(syscontract.SystemContract_CHAIN_CONFIG.String()))
+	if err != nil {
+		r.log.Errorf("get chain config failed, %s", err.Error())
+		return nil, fmt.Errorf("get chain config failed, %s", err)
+	}
+	chainConfig := &configPb.ChainConfig{}
+	if err = proto.Unmarshal(chainConfigBytes, chainConfig); err != nil {
+		r.log.Errorf("unmarshal chain config failed, %s", err.Error())
+		return nil, fmt.Errorf("unmarshal chain config failed, %s", err)
+	}
+	return chainConfig, nil
+}
+
 func (r *BlockRuntime) getChainNodeInfo(provider protocol.ChainNodesInfoProvider, chainId string) ([]*discoveryPb.Node, error) {
 	nodeInfos, err := provider.GetChainNodesInfo()
 	if err != nil {
@@ -724,6 +926,12 @@ func (r *BlockRuntime) validateParams(parameters map[string][]byte, keyNames ...
 			param.hash, err = r.getValue(parameters, paramNameBlockHash)
 		case paramNameTxId:
 			param.txId, err = r.getValue(parameters, paramNameTxId)
+		case paramNameContractName:
+			param.contractName, err = r.getValue(parameters, paramNameContractName)
+		case paramNameKey:
+			param.key, err = r.getValue(parameters, paramNameKey)
+		case paramNameProof:
+			param.proof, err = r.getValue(parameters, paramNameProof)
 		}
 		if err != nil {
 			return nil, err
@@ -22,6 +22,7 @@ import (
 
 	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
 	"chainmaker.org/chainmaker/protocol/v2"
+	"github.com/syndtr/goleveldb/leveldb/util"
 )
 
 var (
@@ -52,7 +53,13 @@ func registerContractManagerMethods(log protocol.Logger) map[string]common.Contr
 	methodMap[syscontract.ContractManageFunction_FREEZE_CONTRACT.String()] = runtime.freezeContract
 	methodMap[syscontract.ContractManageFunction_UNFREEZE_CONTRACT.String()] = runtime.unfreezeContract
 	methodMap[syscontract.ContractManageFunction_REVOKE_CONTRACT.String()] = runtime.revokeContract
+	methodMap[utils.ContractManageRollbackContract] = runtime.rollbackContract
 	methodMap[syscontract.ContractQueryFunction_GET_CONTRACT_INFO.String()] = runtime.getContractInfo
+	methodMap[utils.ContractQueryGetContractList] = runtime.getAllContracts
+	methodMap[utils.ContractQueryGetContractMetadata] = runtime.getContractMetadata
+	methodMap[utils.ContractManageSetMethodAcl] = runtime.setMethodAcl
+	methodMap[utils.ContractManageDeleteMethodAcl] = runtime.deleteMethodAcl
+	methodMap[utils.ContractQueryGetMethodAcl] = runtime.getMethodAcl
 	return methodMap
 
 }
@@ -65,11 +72,26 @@ func (r *ContractManagerRuntime) getContractInfo(txSimContext protocol.TxSimCont
 	return json.Marshal(contract)
 }
 func (r *ContractManagerRuntime) getAllContracts(txSimContext protocol.TxSimContext, parameters map[string][]byte) ([]byte, error) {
+	filter, err := r.parseContractListFilter(parameters)
+	if err != nil {
+		return nil, err
+	}
 	contracts, err := r.GetAllContracts(txSimContext)
 	if err != nil {
 		return nil, err
 	}
-	return json.Marshal(contracts)
+	details := make([]*utils.ContractDetail, 0, len(contracts))
+	for _, contract := range contracts {
+		if !filter(contract) {
+			continue
+		}
+		metadata, err := utils.GetContractMetadata(txSimContext.Get, contract.Name, contract.Version)
+		if err != nil {
+			return nil, err
+		}
+		details = append(details, &utils.ContractDetail{Contract: contract, Metadata: metadata})
+	}
+	return json.Marshal(details)
 }
 func (r *ContractManagerRuntime) installContract(txSimContext protocol.TxSimContext, parameters map[string][]byte) ([]byte, error) {
 	name, version, byteCode, runtimeType, err := r.parseParam(parameters)
@@ -105,6 +127,17 @@ func (r *ContractManagerRuntime) upgradeContract(txSimContext protocol.TxSimCont
 	return contract.Marshal()
 }
 
+func (r *ContractManagerRuntime) rollbackContract(txSimContext protocol.TxSimContext, parameters map[string][]byte) ([]byte, error) {
+	name := string(parameters[syscontract.GetContractInfo_CONTRACT_NAME.String()])
+	version := string(parameters[syscontract.InitContract_CONTRACT_VERSION.String()])
+	contract, err := r.RollbackContract(txSimContext, name, version)
+	if err != nil {
+		return nil, err
+	}
+	r.log.Infof("rollback contract success[name:%s version:%s runtimeType:%d]", contract.Name, contract.Version, contract.RuntimeType)
+	return contract.Marshal()
+}
+
 func (r *ContractManagerRuntime) parseParam(parameters map[string][]byte) (string, string, []byte, commonPb.RuntimeType, error) {
 	name := string(parameters[syscontract.InitContract_CONTRACT_NAME.String()])
 	version := string(parameters[syscontract.InitContract_CONTRACT_VERSION.String()])
@@ -173,8 +206,8 @@ func (r *ContractManagerRuntime) GetContractByteCode(context protocol.TxSimConte
 
 //GetAllContracts 查询所有合约的详细信息
 func (r *ContractManagerRuntime) GetAllContracts(context protocol.TxSimContext) ([]*commonPb.Contract, error) {
-	keyPrefix := []byte(utils.PrefixContractInfo)
-	it, err := context.Select(syscontract.SystemContract_CONTRACT_MANAGE.String(), keyPrefix, keyPrefix)
+	keyRange := util.BytesPrefix([]byte(utils.PrefixContractInfo))
+	it, err := context.Select(syscontract.SystemContract_CONTRACT_MANAGE.String(), keyRange.Start, keyRange.Limit)
 	if err != nil {
 		return nil, err
 	}
@@ -190,6 +223,7 @@ func (r *ContractManagerRuntime) GetAllContracts(context protocol.TxSimContext)
 		if err != nil {
 			return nil, err
 		}
+		result = append(result, contract)
 	}
 	return result, nil
 }
@@ -245,8 +279,12 @@ func (r *ContractManagerRuntime) InstallContract(context protocol.TxSimContext,
 				codeHash := sha256.Sum256(result.Result)
 				return fmt.Sprintf("update EVM contract[%s] bytecode hash:%x", name, codeHash)
 			})
+			byteCode = result.Result
 		}
 	}
+	if err := r.saveContractMetadata(context, contract, "", byteCode, initParameters); err != nil {
+		return nil, fmt.Errorf("%s, %s", errContractInitFail, err)
+	}
 	return contract, nil
 }
 
@@ -267,6 +305,15 @@ func (r *ContractManagerRuntime) UpgradeContract(context protocol.TxSimContext,
 	if contract.Version == version {
 		return nil, errContractVersionExist
 	}
+	migrateMethod := string(upgradeParameters[utils.ContractUpgradeMigrateMethod])
+	if migrateMethod == protocol.ContractInitMethod || migrateMethod == protocol.ContractUpgradeMethod {
+		return nil, fmt.Errorf("%s, invalid migrate method %s", errContractUpgradeFail, migrateMethod)
+	}
+	//保留当前版本的合约信息和字节码，用于回滚
+	if err = r.saveContractHistory(context, contract, version); err != nil {
+		return nil, err
+	}
+	previousVersion := contract.Version
 	contract.RuntimeType = runTime
 	contract.Version = version
 	//update ContractInfo
@@ -292,10 +339,110 @@ func (r *ContractManagerRuntime) UpgradeContract(context protocol.TxSimContext,
 			if err != nil {
 				return nil, fmt.Errorf("%s, %s", errContractUpgradeFail, err)
 			}
+			byteCode = result.Result
 		}
 	}
+	//运行新合约的迁移方法迁移合约状态，迁移失败则升级失败，交易的读写集不会生效
+	if migrateMethod != "" {
+		result, statusCode = context.CallContract(contract, migrateMethod, byteCode, upgradeParameters, 0, commonPb.TxType_INVOKE_CONTRACT)
+		if statusCode != commonPb.TxStatusCode_SUCCESS || result.Code > 0 {
+			return nil, fmt.Errorf("%s, migrate method %s failed, %s", errContractUpgradeFail, migrateMethod, result.Message)
+		}
+	}
+	if err = r.saveContractMetadata(context, contract, previousVersion, byteCode, upgradeParameters); err != nil {
+		return nil, fmt.Errorf("%s, %s", errContractUpgradeFail, err)
+	}
+	return contract, nil
+}
+
+//RollbackContract 回滚合约到之前的版本，当前版本同样被保留，可以再次回滚到当前版本
+func (r *ContractManagerRuntime) RollbackContract(context protocol.TxSimContext, name, version string) (*commonPb.Contract, error) {
+	if utils.IsAnyBlank(name, version) {
+		err := fmt.Errorf("%s, param[contract_name/contract_version] of rollback contract not found", common.ErrParams.Error())
+		r.log.Warnf(err.Error())
+		return nil, err
+	}
+	contract, err := context.GetContractByName(name)
+	if err != nil {
+		return nil, err
+	}
+	if contract.Status != commonPb.ContractStatus_NORMAL && contract.Status != commonPb.ContractStatus_FROZEN {
+		r.log.Warnf("contract[%s] expect status:NORMAL or FROZEN,actual status:%s", name, contract.Status.String())
+		return nil, errContractStatusInvalid
+	}
+	if contract.Version == version {
+		return nil, fmt.Errorf("%s, version %s is the current version", errContractRollbackFail, version)
+	}
+	historyContract, historyByteCode, err := r.getContractHistory(context, name, version)
+	if err != nil {
+		return nil, err
+	}
+	if err = r.saveContractHistory(context, contract, ""); err != nil {
+		return nil, err
+	}
+	//回滚后合约的状态、创建者不变
+	contract.Version = historyContract.Version
+	contract.RuntimeType = historyContract.RuntimeType
+	cdata, _ := contract.Marshal()
+	if err = context.Put(ContractName, utils.GetContractDbKey(name), cdata); err != nil {
+		return nil, err
+	}
+	if err = context.Put(ContractName, utils.GetContractByteCodeDbKey(name), historyByteCode); err != nil {
+		return nil, err
+	}
 	return contract, nil
 }
+
+// saveContractHistory retains the contract info and the bytecode of the current version of the contract,
+// the versions retained can not be used by the upgrade again, as the vm instances are cached by the versions
+func (r *ContractManagerRuntime) saveContractHistory(context protocol.TxSimContext, contract *commonPb.Contract,
+	newVersion string) error {
+	if newVersion != "" {
+		exist, err := context.Get(ContractName, utils.GetContractHistoryDbKey(contract.Name, newVersion))
+		if err != nil {
+			return err
+		}
+		if len(exist) > 0 {
+			return errContractVersionExist
+		}
+	}
+	byteCode, err := context.Get(ContractName, utils.GetContractByteCodeDbKey(contract.Name))
+	if err != nil {
+		return err
+	}
+	cdata, err := contract.Marshal()
+	if err != nil {
+		return err
+	}
+	if err = context.Put(ContractName, utils.GetContractHistoryDbKey(contract.Name, contract.Version), cdata); err != nil {
+		return err
+	}
+	return context.Put(ContractName, utils.GetContractByteCodeHistoryDbKey(contract.Name, contract.Version), byteCode)
+}
+
+// getContractHistory returns the contract info and the bytecode of the previous version of the contract
+func (r *ContractManagerRuntime) getContractHistory(context protocol.TxSimContext, name, version string) (
+	*commonPb.Contract, []byte, error) {
+	cdata, err := context.Get(ContractName, utils.GetContractHistoryDbKey(name, version))
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(cdata) == 0 {
+		return nil, nil, fmt.Errorf("%s, contract[%s] version[%s]", errContractVersionNotExist, name, version)
+	}
+	contract := &commonPb.Contract{}
+	if err = contract.Unmarshal(cdata); err != nil {
+		return nil, nil, err
+	}
+	byteCode, err := context.Get(ContractName, utils.GetContractByteCodeHistoryDbKey(name, version))
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(byteCode) == 0 {
+		return nil, nil, fmt.Errorf("%s, bytecode of contract[%s] version[%s]", errContractVersionNotExist, name, version)
+	}
+	return contract, byteCode, nil
+}
 func (r *ContractManagerRuntime) FreezeContract(context protocol.TxSimContext, name string) (*commonPb.Contract, error) {
 	return r.changeContractStatus(context, name, commonPb.ContractStatus_NORMAL, commonPb.ContractStatus_FROZEN)
 }
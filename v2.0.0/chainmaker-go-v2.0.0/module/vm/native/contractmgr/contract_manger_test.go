@@ -6,3 +6,338 @@
  */
 
 package contractmgr
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"testing"
+
+	"chainmaker.org/chainmaker-go/logger"
+	"chainmaker.org/chainmaker-go/utils"
+	acPb "chainmaker.org/chainmaker/pb-go/v2/accesscontrol"
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	configPb "chainmaker.org/chainmaker/pb-go/v2/config"
+	"chainmaker.org/chainmaker/pb-go/v2/store"
+	"chainmaker.org/chainmaker/pb-go/v2/syscontract"
+	"chainmaker.org/chainmaker/protocol/v2"
+	"chainmaker.org/chainmaker/protocol/v2/mock"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func initMethodAclEnv(t *testing.T) (*ContractManagerRuntime, protocol.TxSimContext, func()) {
+	ctrl := gomock.NewController(t)
+	txSimContext := mock.NewMockTxSimContext(ctrl)
+	state := make(map[string][]byte)
+	txSimContext.EXPECT().Get(ContractName, gomock.Any()).DoAndReturn(
+		func(name string, key []byte) ([]byte, error) {
+			return state[string(key)], nil
+		}).AnyTimes()
+	txSimContext.EXPECT().Put(ContractName, gomock.Any(), gomock.Any()).DoAndReturn(
+		func(name string, key []byte, value []byte) error {
+			state[string(key)] = value
+			return nil
+		}).AnyTimes()
+	txSimContext.EXPECT().Del(ContractName, gomock.Any()).DoAndReturn(
+		func(name string, key []byte) error {
+			delete(state, string(key))
+			return nil
+		}).AnyTimes()
+	txSimContext.EXPECT().GetContractByName(gomock.Any()).DoAndReturn(
+		func(name string) (*commonPb.Contract, error) {
+			switch name {
+			case "counter":
+				return &commonPb.Contract{Name: name, RuntimeType: commonPb.RuntimeType_WASMER,
+					Status: commonPb.ContractStatus_NORMAL}, nil
+			case "token":
+				return &commonPb.Contract{Name: name, RuntimeType: commonPb.RuntimeType_EVM,
+					Status: commonPb.ContractStatus_NORMAL}, nil
+			case "revoked":
+				return &commonPb.Contract{Name: name, RuntimeType: commonPb.RuntimeType_WASMER,
+					Status: commonPb.ContractStatus_REVOKED}, nil
+			case syscontract.SystemContract_CHAIN_CONFIG.String():
+				return &commonPb.Contract{Name: name, RuntimeType: commonPb.RuntimeType_NATIVE}, nil
+			}
+			return nil, errors.New("contract not exist")
+		}).AnyTimes()
+	ac := mock.NewMockAccessControlProvider(ctrl)
+	ac.EXPECT().ValidateResourcePolicy(gomock.Any()).DoAndReturn(
+		func(resourcePolicy *configPb.ResourcePolicy) bool {
+			return resourcePolicy.Policy.Rule != string(protocol.RuleSelf)
+		}).AnyTimes()
+	txSimContext.EXPECT().GetAccessControl().Return(ac, nil).AnyTimes()
+
+	return &ContractManagerRuntime{log: logger.GetLogger(logger.MODULE_VM)}, txSimContext, ctrl.Finish
+}
+
+func TestContractManagerRuntime_MethodAcl(t *testing.T) {
+	runtime, txSimContext, fn := initMethodAclEnv(t)
+	defer fn()
+
+	params := map[string][]byte{
+		syscontract.GetContractInfo_CONTRACT_NAME.String(): []byte("counter"),
+		utils.ContractMethodAclMethodName:                  []byte("increase"),
+		utils.ContractMethodAclRule:                        []byte(protocol.RuleAny),
+		utils.ContractMethodAclOrgList:                     []byte("org1, org2"),
+		utils.ContractMethodAclRoleList:                    []byte("ADMIN"),
+	}
+	_, err := runtime.setMethodAcl(txSimContext, params)
+	require.Nil(t, err)
+
+	policy, err := utils.GetContractMethodAcl(txSimContext.Get, "counter", "increase")
+	require.Nil(t, err)
+	require.Equal(t, &acPb.Policy{Rule: string(protocol.RuleAny), OrgList: []string{"org1", "org2"},
+		RoleList: []string{"ADMIN"}}, policy)
+	acls, err := runtime.GetMethodAcls(txSimContext, "counter", "increase")
+	require.Nil(t, err)
+	require.Equal(t, policy, acls["increase"])
+
+	_, err = runtime.deleteMethodAcl(txSimContext, params)
+	require.Nil(t, err)
+	policy, err = utils.GetContractMethodAcl(txSimContext.Get, "counter", "increase")
+	require.Nil(t, err)
+	require.Nil(t, policy)
+	_, err = runtime.deleteMethodAcl(txSimContext, params)
+	require.Equal(t, errMethodAclNotExist, err)
+}
+
+func TestContractManagerRuntime_SetMethodAclInvalid(t *testing.T) {
+	runtime, txSimContext, fn := initMethodAclEnv(t)
+	defer fn()
+
+	policy := &acPb.Policy{Rule: string(protocol.RuleAny)}
+	require.NotNil(t, runtime.SetMethodAcl(txSimContext, "counter", "", policy))
+	require.NotNil(t, runtime.SetMethodAcl(txSimContext, "unknown", "increase", policy))
+	require.NotNil(t, runtime.SetMethodAcl(txSimContext, "revoked", "increase", policy))
+	require.NotNil(t, runtime.SetMethodAcl(txSimContext, syscontract.SystemContract_CHAIN_CONFIG.String(),
+		"increase", policy))
+	require.NotNil(t, runtime.SetMethodAcl(txSimContext, "counter", protocol.ContractUpgradeMethod, policy))
+	require.NotNil(t, runtime.SetMethodAcl(txSimContext, "counter", "increase",
+		&acPb.Policy{Rule: string(protocol.RuleDelete)}))
+	require.NotNil(t, runtime.SetMethodAcl(txSimContext, "counter", "increase",
+		&acPb.Policy{Rule: string(protocol.RuleSelf)}))
+}
+
+func TestContractManagerRuntime_EvmMethodAcl(t *testing.T) {
+	runtime, txSimContext, fn := initMethodAclEnv(t)
+	defer fn()
+
+	policy := &acPb.Policy{Rule: string(protocol.RuleAny), OrgList: []string{"org1"}}
+	require.Nil(t, runtime.SetMethodAcl(txSimContext, "token", "0xA9059CBB", policy))
+	// the acl of the evm contract is stored under the normalized selector which the vm looks up
+	stored, err := utils.GetContractMethodAcl(txSimContext.Get, "token", "a9059cbb")
+	require.Nil(t, err)
+	require.Equal(t, policy, stored)
+	acls, err := runtime.GetMethodAcls(txSimContext, "token", "0xa9059cbb")
+	require.Nil(t, err)
+	require.Equal(t, policy, acls["a9059cbb"])
+
+	require.NotNil(t, runtime.SetMethodAcl(txSimContext, "token", "transfer", policy))
+	require.NotNil(t, runtime.SetMethodAcl(txSimContext, "token", "a9059c", policy))
+
+	require.Nil(t, runtime.DeleteMethodAcl(txSimContext, "token", "A9059CBB"))
+	stored, err = utils.GetContractMethodAcl(txSimContext.Get, "token", "a9059cbb")
+	require.Nil(t, err)
+	require.Nil(t, stored)
+}
+
+// initContractVersionEnv installs the version 1.0 of the contract counter, the calls of the contracts are recorded
+// as version:method:bytecode, the tx id and the block height are derived from the count of the calls
+func initContractVersionEnv(t *testing.T) (*ContractManagerRuntime, protocol.TxSimContext, *[]string, func()) {
+	ctrl := gomock.NewController(t)
+	txSimContext := mock.NewMockTxSimContext(ctrl)
+	state := make(map[string][]byte)
+	calls := make([]string, 0)
+	getState := func(name string, key []byte) ([]byte, error) {
+		return state[string(key)], nil
+	}
+	txSimContext.EXPECT().Get(ContractName, gomock.Any()).DoAndReturn(getState).AnyTimes()
+	txSimContext.EXPECT().Put(ContractName, gomock.Any(), gomock.Any()).DoAndReturn(
+		func(name string, key []byte, value []byte) error {
+			state[string(key)] = value
+			return nil
+		}).AnyTimes()
+	txSimContext.EXPECT().GetContractByName(gomock.Any()).DoAndReturn(
+		func(name string) (*commonPb.Contract, error) {
+			return utils.GetContractByName(getState, name)
+		}).AnyTimes()
+	txSimContext.EXPECT().GetSender().Return(&acPb.Member{OrgId: "org1"}).AnyTimes()
+	txSimContext.EXPECT().Select(ContractName, gomock.Any(), gomock.Any()).DoAndReturn(
+		func(name string, startKey []byte, limit []byte) (protocol.StateIterator, error) {
+			it := &kvIterator{}
+			for key, value := range state {
+				if key >= string(startKey) && key < string(limit) {
+					it.kvs = append(it.kvs, &store.KV{Key: []byte(key), Value: value})
+				}
+			}
+			sort.Slice(it.kvs, func(i, j int) bool { return string(it.kvs[i].Key) < string(it.kvs[j].Key) })
+			return it, nil
+		}).AnyTimes()
+	txSimContext.EXPECT().GetTx().DoAndReturn(func() *commonPb.Transaction {
+		return &commonPb.Transaction{Payload: &commonPb.Payload{TxId: fmt.Sprintf("tx%d", len(calls))}}
+	}).AnyTimes()
+	txSimContext.EXPECT().GetBlockHeight().DoAndReturn(func() uint64 {
+		return uint64(len(calls))
+	}).AnyTimes()
+	txSimContext.EXPECT().CallContract(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(),
+		gomock.Any()).DoAndReturn(
+		func(contract *commonPb.Contract, method string, byteCode []byte, parameter map[string][]byte,
+			gasUsed uint64, refTxType commonPb.TxType) (*commonPb.ContractResult, commonPb.TxStatusCode) {
+			calls = append(calls, contract.Version+":"+method+":"+string(byteCode))
+			if method == "bad_migrate" {
+				return &commonPb.ContractResult{Code: 1, Message: "migrate failed"}, commonPb.TxStatusCode_CONTRACT_FAIL
+			}
+			return &commonPb.ContractResult{}, commonPb.TxStatusCode_SUCCESS
+		}).AnyTimes()
+
+	runtime := &ContractManagerRuntime{log: logger.GetLogger(logger.MODULE_VM)}
+	_, err := runtime.InstallContract(txSimContext, "counter", "1.0", []byte("code1"), commonPb.RuntimeType_WASMER, nil)
+	require.Nil(t, err)
+	return runtime, txSimContext, &calls, ctrl.Finish
+}
+
+func TestContractManagerRuntime_UpgradeMigrate(t *testing.T) {
+	runtime, txSimContext, calls, fn := initContractVersionEnv(t)
+	defer fn()
+
+	params := map[string][]byte{utils.ContractUpgradeMigrateMethod: []byte(protocol.ContractInitMethod)}
+	_, err := runtime.UpgradeContract(txSimContext, "counter", "2.0", []byte("code2"), commonPb.RuntimeType_WASMER, params)
+	require.NotNil(t, err)
+
+	params[utils.ContractUpgradeMigrateMethod] = []byte("migrate")
+	contract, err := runtime.UpgradeContract(txSimContext, "counter", "2.0", []byte("code2"), commonPb.RuntimeType_WASMER, params)
+	require.Nil(t, err)
+	require.Equal(t, "2.0", contract.Version)
+	require.Equal(t, []string{"1.0:" + protocol.ContractInitMethod + ":code1",
+		"2.0:" + protocol.ContractUpgradeMethod + ":code2", "2.0:migrate:code2"}, *calls)
+
+	params[utils.ContractUpgradeMigrateMethod] = []byte("bad_migrate")
+	_, err = runtime.UpgradeContract(txSimContext, "counter", "3.0", []byte("code3"), commonPb.RuntimeType_WASMER, params)
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), errContractUpgradeFail.Error())
+}
+
+func TestContractManagerRuntime_RollbackContract(t *testing.T) {
+	runtime, txSimContext, _, fn := initContractVersionEnv(t)
+	defer fn()
+
+	_, err := runtime.UpgradeContract(txSimContext, "counter", "2.0", []byte("code2"), commonPb.RuntimeType_WASMER, nil)
+	require.Nil(t, err)
+	_, err = runtime.RollbackContract(txSimContext, "counter", "2.0")
+	require.NotNil(t, err)
+	_, err = runtime.RollbackContract(txSimContext, "counter", "3.0")
+	require.NotNil(t, err)
+
+	contract, err := runtime.RollbackContract(txSimContext, "counter", "1.0")
+	require.Nil(t, err)
+	require.Equal(t, "1.0", contract.Version)
+	byteCode, err := txSimContext.Get(ContractName, utils.GetContractByteCodeDbKey("counter"))
+	require.Nil(t, err)
+	require.Equal(t, []byte("code1"), byteCode)
+
+	// the version rolled back from is retained, and the retained versions can not be upgraded to again
+	_, err = runtime.UpgradeContract(txSimContext, "counter", "2.0", []byte("code4"), commonPb.RuntimeType_WASMER, nil)
+	require.Equal(t, errContractVersionExist, err)
+	contract, err = runtime.RollbackContract(txSimContext, "counter", "2.0")
+	require.Nil(t, err)
+	require.Equal(t, "2.0", contract.Version)
+	byteCode, err = txSimContext.Get(ContractName, utils.GetContractByteCodeDbKey("counter"))
+	require.Nil(t, err)
+	require.Equal(t, []byte("code2"), byteCode)
+}
+
+func TestContractManagerRuntime_ContractMetadata(t *testing.T) {
+	runtime, txSimContext, _, fn := initContractVersionEnv(t)
+	defer fn()
+
+	params := map[string][]byte{
+		utils.ContractMetadataAbi:         []byte("abi2"),
+		utils.ContractMetadataDescription: []byte("counter contract"),
+	}
+	_, err := runtime.UpgradeContract(txSimContext, "counter", "2.0", []byte("code2"), commonPb.RuntimeType_WASMER, params)
+	require.Nil(t, err)
+	_, err = runtime.UpgradeContract(txSimContext, "counter", "3.0", []byte("code3"), commonPb.RuntimeType_WASMER, nil)
+	require.Nil(t, err)
+
+	detail, err := runtime.GetContractMetadata(txSimContext, "counter", "")
+	require.Nil(t, err)
+	require.Equal(t, "3.0", detail.Version)
+	byteCodeHash := sha256.Sum256([]byte("code3"))
+	require.Equal(t, &utils.ContractMetadata{DeployTxId: "tx1", DeployHeight: 1, UpgradeTxId: "tx3", UpgradeHeight: 3,
+		ByteCodeHash: hex.EncodeToString(byteCodeHash[:]), Description: "counter contract"}, detail.Metadata)
+
+	detail, err = runtime.GetContractMetadata(txSimContext, "counter", "2.0")
+	require.Nil(t, err)
+	require.Equal(t, "2.0", detail.Version)
+	require.Equal(t, "abi2", detail.Metadata.Abi)
+	require.Equal(t, "tx2", detail.Metadata.UpgradeTxId)
+	_, err = runtime.GetContractMetadata(txSimContext, "counter", "4.0")
+	require.NotNil(t, err)
+
+	// the metadata follows the version rolled back to
+	_, err = runtime.RollbackContract(txSimContext, "counter", "2.0")
+	require.Nil(t, err)
+	detail, err = runtime.GetContractMetadata(txSimContext, "counter", "")
+	require.Nil(t, err)
+	require.Equal(t, "abi2", detail.Metadata.Abi)
+}
+
+func TestContractManagerRuntime_GetContractList(t *testing.T) {
+	runtime, txSimContext, _, fn := initContractVersionEnv(t)
+	defer fn()
+
+	_, err := runtime.InstallContract(txSimContext, "asset", "1.0", []byte("code"), commonPb.RuntimeType_GASM, nil)
+	require.Nil(t, err)
+	_, err = runtime.FreezeContract(txSimContext, "asset")
+	require.Nil(t, err)
+
+	list := func(runtimeType, status string) []*utils.ContractDetail {
+		result, err := runtime.getAllContracts(txSimContext, map[string][]byte{
+			syscontract.InitContract_CONTRACT_RUNTIME_TYPE.String(): []byte(runtimeType),
+			utils.ContractListStatus:                                []byte(status),
+		})
+		require.Nil(t, err)
+		var details []*utils.ContractDetail
+		require.Nil(t, json.Unmarshal(result, &details))
+		return details
+	}
+	details := list("", "")
+	require.Equal(t, 2, len(details))
+	require.Equal(t, "asset", details[0].Name)
+	require.Equal(t, "counter", details[1].Name)
+	require.Equal(t, "tx1", details[1].Metadata.DeployTxId)
+
+	details = list(commonPb.RuntimeType_WASMER.String(), "")
+	require.Equal(t, 1, len(details))
+	require.Equal(t, "counter", details[0].Name)
+	details = list("", commonPb.ContractStatus_FROZEN.String())
+	require.Equal(t, 1, len(details))
+	require.Equal(t, "asset", details[0].Name)
+	require.Equal(t, 0, len(list(commonPb.RuntimeType_WASMER.String(), commonPb.ContractStatus_REVOKED.String())))
+
+	_, err = runtime.getAllContracts(txSimContext, map[string][]byte{utils.ContractListStatus: []byte("UNKNOWN")})
+	require.NotNil(t, err)
+}
+
+type kvIterator struct {
+	kvs []*store.KV
+	idx int
+}
+
+func (kvi *kvIterator) Next() bool {
+	kvi.idx++
+	return kvi.idx <= len(kvi.kvs)
+}
+
+func (kvi *kvIterator) Value() (*store.KV, error) {
+	return kvi.kvs[kvi.idx-1], nil
+}
+
+func (kvi *kvIterator) Release() {
+	kvi.idx = 0
+	kvi.kvs = nil
+}
@@ -0,0 +1,107 @@
+/*
+ * Copyright (C) BABEC. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package contractmgr
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"chainmaker.org/chainmaker-go/utils"
+	"chainmaker.org/chainmaker-go/vm/native/common"
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	"chainmaker.org/chainmaker/pb-go/v2/syscontract"
+	"chainmaker.org/chainmaker/protocol/v2"
+)
+
+func (r *ContractManagerRuntime) getContractMetadata(txSimContext protocol.TxSimContext, parameters map[string][]byte) ([]byte, error) {
+	name := string(parameters[syscontract.GetContractInfo_CONTRACT_NAME.String()])
+	version := string(parameters[syscontract.InitContract_CONTRACT_VERSION.String()])
+	detail, err := r.GetContractMetadata(txSimContext, name, version)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(detail)
+}
+
+// GetContractMetadata 查询合约指定版本的元数据，未指定版本时返回当前版本的元数据
+func (r *ContractManagerRuntime) GetContractMetadata(context protocol.TxSimContext, name, version string) (
+	*utils.ContractDetail, error) {
+	contract, err := r.GetContractInfo(context, name)
+	if err != nil {
+		return nil, err
+	}
+	if version != "" && version != contract.Version {
+		contract, _, err = r.getContractHistory(context, name, version)
+		if err != nil {
+			return nil, err
+		}
+	}
+	metadata, err := utils.GetContractMetadata(context.Get, name, contract.Version)
+	if err != nil {
+		return nil, err
+	}
+	return &utils.ContractDetail{Contract: contract, Metadata: metadata}, nil
+}
+
+// parseContractListFilter parses the optional runtime type and status filters of the contract list
+func (r *ContractManagerRuntime) parseContractListFilter(parameters map[string][]byte) (
+	func(contract *commonPb.Contract) bool, error) {
+	runtime := string(parameters[syscontract.InitContract_CONTRACT_RUNTIME_TYPE.String()])
+	status := string(parameters[utils.ContractListStatus])
+	runtimeType, ok := commonPb.RuntimeType_value[runtime]
+	if runtime != "" && !ok {
+		return nil, fmt.Errorf("%s, runtimeType[%s] is error", common.ErrParams.Error(), runtime)
+	}
+	contractStatus, ok := commonPb.ContractStatus_value[status]
+	if status != "" && !ok {
+		return nil, fmt.Errorf("%s, status[%s] is error", common.ErrParams.Error(), status)
+	}
+	return func(contract *commonPb.Contract) bool {
+		if runtime != "" && contract.RuntimeType != commonPb.RuntimeType(runtimeType) {
+			return false
+		}
+		return status == "" || contract.Status == commonPb.ContractStatus(contractStatus)
+	}, nil
+}
+
+// saveContractMetadata records the metadata of the version of the contract installed or upgraded by the tx,
+// the deploy tx and the description are inherited from the previous version if any
+func (r *ContractManagerRuntime) saveContractMetadata(context protocol.TxSimContext, contract *commonPb.Contract,
+	previousVersion string, byteCode []byte, parameters map[string][]byte) error {
+	byteCodeHash := sha256.Sum256(byteCode)
+	metadata := &utils.ContractMetadata{
+		ByteCodeHash: hex.EncodeToString(byteCodeHash[:]),
+		Abi:          string(parameters[utils.ContractMetadataAbi]),
+		Description:  string(parameters[utils.ContractMetadataDescription]),
+	}
+	txId := context.GetTx().Payload.TxId
+	if previousVersion == "" {
+		metadata.DeployTxId = txId
+		metadata.DeployHeight = context.GetBlockHeight()
+	} else {
+		previous, err := utils.GetContractMetadata(context.Get, contract.Name, previousVersion)
+		if err != nil {
+			return err
+		}
+		if previous != nil {
+			metadata.DeployTxId = previous.DeployTxId
+			metadata.DeployHeight = previous.DeployHeight
+			if metadata.Description == "" {
+				metadata.Description = previous.Description
+			}
+		}
+		metadata.UpgradeTxId = txId
+		metadata.UpgradeHeight = context.GetBlockHeight()
+	}
+	value, err := json.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+	return context.Put(ContractName, utils.GetContractMetadataDbKey(contract.Name, contract.Version), value)
+}
@@ -0,0 +1,203 @@
+/*
+ * Copyright (C) BABEC. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package contractmgr
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"chainmaker.org/chainmaker-go/utils"
+	"chainmaker.org/chainmaker-go/vm/native/common"
+	acPb "chainmaker.org/chainmaker/pb-go/v2/accesscontrol"
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	configPb "chainmaker.org/chainmaker/pb-go/v2/config"
+	"chainmaker.org/chainmaker/pb-go/v2/syscontract"
+	"chainmaker.org/chainmaker/protocol/v2"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+func (r *ContractManagerRuntime) setMethodAcl(txSimContext protocol.TxSimContext, parameters map[string][]byte) ([]byte, error) {
+	name := string(parameters[syscontract.GetContractInfo_CONTRACT_NAME.String()])
+	method := string(parameters[utils.ContractMethodAclMethodName])
+	policy := &acPb.Policy{
+		Rule:     string(parameters[utils.ContractMethodAclRule]),
+		OrgList:  splitAclList(parameters[utils.ContractMethodAclOrgList]),
+		RoleList: splitAclList(parameters[utils.ContractMethodAclRoleList]),
+	}
+	if err := r.SetMethodAcl(txSimContext, name, method, policy); err != nil {
+		return nil, err
+	}
+	r.log.Infof("set method acl success[name:%s method:%s rule:%s orgList:%v roleList:%v]", name, method,
+		policy.Rule, policy.OrgList, policy.RoleList)
+	return json.Marshal(policy)
+}
+
+func (r *ContractManagerRuntime) deleteMethodAcl(txSimContext protocol.TxSimContext, parameters map[string][]byte) ([]byte, error) {
+	name := string(parameters[syscontract.GetContractInfo_CONTRACT_NAME.String()])
+	method := string(parameters[utils.ContractMethodAclMethodName])
+	if err := r.DeleteMethodAcl(txSimContext, name, method); err != nil {
+		return nil, err
+	}
+	r.log.Infof("delete method acl success[name:%s method:%s]", name, method)
+	return nil, nil
+}
+
+func (r *ContractManagerRuntime) getMethodAcl(txSimContext protocol.TxSimContext, parameters map[string][]byte) ([]byte, error) {
+	name := string(parameters[syscontract.GetContractInfo_CONTRACT_NAME.String()])
+	method := string(parameters[utils.ContractMethodAclMethodName])
+	acls, err := r.GetMethodAcls(txSimContext, name, method)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(acls)
+}
+
+// SetMethodAcl 设置用户合约方法的访问控制策略，调用方法的交易的签名者须满足该策略
+func (r *ContractManagerRuntime) SetMethodAcl(context protocol.TxSimContext, name, method string,
+	policy *acPb.Policy) error {
+	if utils.IsAnyBlank(name, method, policy.Rule) {
+		err := fmt.Errorf("%s, param[contract_name/method_name/rule] of set method acl not found",
+			common.ErrParams.Error())
+		r.log.Warnf(err.Error())
+		return err
+	}
+	method, err := r.checkMethodAclContract(context, name, method)
+	if err != nil {
+		return err
+	}
+	// the acl is removed by DELETE_METHOD_ACL, and the rule SELF is rejected by the validation of the ac
+	if policy.Rule == string(protocol.RuleDelete) {
+		return fmt.Errorf("%s, rule %s", errInvalidMethodAcl, policy.Rule)
+	}
+	ac, err := context.GetAccessControl()
+	if err != nil {
+		return err
+	}
+	resourcePolicy := &configPb.ResourcePolicy{
+		ResourceName: utils.GetContractMethodAclResourceName(name, method),
+		Policy:       policy,
+	}
+	if !ac.ValidateResourcePolicy(resourcePolicy) {
+		return fmt.Errorf("%s, rule:%s orgList:%v roleList:%v", errInvalidMethodAcl, policy.Rule,
+			policy.OrgList, policy.RoleList)
+	}
+	value, err := policy.Marshal()
+	if err != nil {
+		return err
+	}
+	return context.Put(ContractName, utils.GetContractMethodAclDbKey(name, method), value)
+}
+
+// DeleteMethodAcl 删除用户合约方法的访问控制策略
+func (r *ContractManagerRuntime) DeleteMethodAcl(context protocol.TxSimContext, name, method string) error {
+	if utils.IsAnyBlank(name, method) {
+		err := fmt.Errorf("%s, param[contract_name/method_name] of delete method acl not found",
+			common.ErrParams.Error())
+		r.log.Warnf(err.Error())
+		return err
+	}
+	method = r.normalizeAclMethod(context, name, method)
+	policy, err := utils.GetContractMethodAcl(context.Get, name, method)
+	if err != nil {
+		return err
+	}
+	if policy == nil {
+		return errMethodAclNotExist
+	}
+	return context.Del(ContractName, utils.GetContractMethodAclDbKey(name, method))
+}
+
+// GetMethodAcls 查询用户合约方法的访问控制策略，未指定方法时返回合约所有方法的策略
+func (r *ContractManagerRuntime) GetMethodAcls(context protocol.TxSimContext, name, method string) (
+	map[string]*acPb.Policy, error) {
+	if utils.IsAnyBlank(name) {
+		err := fmt.Errorf("%s, param[contract_name] of get method acl not found", common.ErrParams.Error())
+		r.log.Warnf(err.Error())
+		return nil, err
+	}
+	acls := make(map[string]*acPb.Policy)
+	if method != "" {
+		method = r.normalizeAclMethod(context, name, method)
+		policy, err := utils.GetContractMethodAcl(context.Get, name, method)
+		if err != nil {
+			return nil, err
+		}
+		if policy != nil {
+			acls[method] = policy
+		}
+		return acls, nil
+	}
+
+	prefix := utils.GetContractMethodAclDbPrefix(name)
+	keyRange := util.BytesPrefix(prefix)
+	it, err := context.Select(ContractName, keyRange.Start, keyRange.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer it.Release()
+	for it.Next() {
+		kv, err := it.Value()
+		if err != nil {
+			return nil, err
+		}
+		policy := &acPb.Policy{}
+		if err = policy.Unmarshal(kv.Value); err != nil {
+			return nil, err
+		}
+		acls[strings.TrimPrefix(string(kv.Key), string(prefix))] = policy
+	}
+	return acls, nil
+}
+
+// checkMethodAclContract the acl is only set to the methods of the user contracts which are not revoked,
+// the init and upgrade methods are controlled by the policies of contract management. The method of the evm
+// contract must be a selector, it is returned normalized
+func (r *ContractManagerRuntime) checkMethodAclContract(context protocol.TxSimContext, name, method string) (
+	string, error) {
+	contract, err := context.GetContractByName(name)
+	if err != nil {
+		return "", err
+	}
+	if contract.RuntimeType == commonPb.RuntimeType_NATIVE {
+		return "", fmt.Errorf("%s, contract[%s] is not a user contract", errInvalidMethodAcl, name)
+	}
+	if contract.Status == commonPb.ContractStatus_REVOKED {
+		return "", fmt.Errorf("%s, contract[%s] has been revoked", errContractStatusInvalid, name)
+	}
+	if method == protocol.ContractInitMethod || method == protocol.ContractUpgradeMethod {
+		return "", fmt.Errorf("%s, method[%s] is controlled by contract management", errInvalidMethodAcl, method)
+	}
+	if contract.RuntimeType == commonPb.RuntimeType_EVM {
+		selector := utils.NormalizeEvmMethod(method)
+		if utils.GetEvmCallSelector(selector) != selector {
+			return "", fmt.Errorf("%s, method[%s] of evm contract is not a selector", errInvalidMethodAcl, method)
+		}
+		return selector, nil
+	}
+	return method, nil
+}
+
+// normalizeAclMethod returns the method under which the acl is stored, the selector of the evm contract is
+// normalized
+func (r *ContractManagerRuntime) normalizeAclMethod(context protocol.TxSimContext, name, method string) string {
+	contract, err := context.GetContractByName(name)
+	if err != nil || contract.RuntimeType != commonPb.RuntimeType_EVM {
+		return method
+	}
+	return utils.NormalizeEvmMethod(method)
+}
+
+func splitAclList(value []byte) []string {
+	var list []string
+	for _, item := range strings.Split(string(value), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
@@ -10,12 +10,16 @@ package contractmgr
 import "errors"
 
 var (
-	errContractExist          = errors.New("contract exist")
-	errContractInitFail       = errors.New("contract initial fail")
-	errContractUpgradeFail    = errors.New("contract upgrade fail")
-	errContractNotExist       = errors.New("contract not exist")
-	errContractVersionExist   = errors.New("contract version exist")
-	errContractStatusInvalid  = errors.New("contract status invalid")
-	errInvalidContractName    = errors.New("invalid contract name")
-	errInvalidEvmContractName = errors.New("invalid EVM contract name")
+	errContractExist           = errors.New("contract exist")
+	errContractInitFail        = errors.New("contract initial fail")
+	errContractUpgradeFail     = errors.New("contract upgrade fail")
+	errContractNotExist        = errors.New("contract not exist")
+	errContractVersionExist    = errors.New("contract version exist")
+	errContractVersionNotExist = errors.New("contract version not exist")
+	errContractRollbackFail    = errors.New("contract rollback fail")
+	errContractStatusInvalid   = errors.New("contract status invalid")
+	errInvalidContractName     = errors.New("invalid contract name")
+	errInvalidEvmContractName  = errors.New("invalid EVM contract name")
+	errInvalidMethodAcl        = errors.New("invalid contract method acl")
+	errMethodAclNotExist       = errors.New("contract method acl not exist")
 )
@@ -8,20 +8,14 @@
 package dposmgr
 
 import (
-	"crypto/sha256"
-	"encoding/hex"
-	"errors"
 	"fmt"
 	"strings"
 
 	"chainmaker.org/chainmaker-go/vm/native/common"
-	"chainmaker.org/chainmaker/pb-go/v2/accesscontrol"
 	"chainmaker.org/chainmaker/pb-go/v2/syscontract"
 
 	"chainmaker.org/chainmaker-go/utils"
-	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
 	"chainmaker.org/chainmaker/protocol/v2"
-	"github.com/mr-tron/base58/base58"
 )
 
 const (
@@ -556,55 +550,21 @@ func setApproveValue(txSimContext protocol.TxSimContext, from, to string, val *u
 }
 
 func loadSenderAddress(txSimContext protocol.TxSimContext) (string, error) {
-	sender := txSimContext.GetSender()
-	if sender != nil {
-		// 将sender转换为用户地址
-		var member []byte
-		if sender.MemberType == accesscontrol.MemberType_CERT {
-			// 长证书
-			member = sender.MemberInfo
-		} else if sender.MemberType == accesscontrol.MemberType_CERT_HASH {
-			// 短证书
-			memberInfoHex := hex.EncodeToString(sender.MemberInfo)
-			certInfo, err := getWholeCertInfo(txSimContext, memberInfoHex)
-			if err != nil {
-				return "", fmt.Errorf("can not load whole cert info , contract[%s] member[%s]", dposErc20ContractName, memberInfoHex)
-			}
-			member = certInfo.Cert
-		} else {
-			return "", errors.New("invalid member type")
-		}
-		return parseUserAddress(member)
+	// 将sender转换为用户地址
+	address, err := utils.MemberAddress(txSimContext.GetSender(), txSimContext.Get)
+	if err != nil {
+		return "", fmt.Errorf("can not load sender address, contract[%s] err: %s", dposErc20ContractName, err)
 	}
-	return "", fmt.Errorf("can not find sender from tx, contract[%s]", dposErc20ContractName)
+	return address, nil
 }
 
 // parseUserAddress
 func parseUserAddress(member []byte) (string, error) {
-	certificate, err := utils.ParseCert(member)
+	address, err := utils.CertAddress(member)
 	if err != nil {
-		msg := fmt.Errorf("parse cert failed, name[%s] err: %+v", dposErc20ContractName, err)
-		return "", msg
-	}
-	pubKeyBytes, err := certificate.PublicKey.Bytes()
-	if err != nil {
-		msg := fmt.Errorf("load public key from cert failed, name[%s] err: %+v", dposErc20ContractName, err)
-		return "", msg
-	}
-	// 转换为SHA-256
-	addressBytes := sha256.Sum256(pubKeyBytes)
-	return base58.Encode(addressBytes[:]), nil
-}
-
-func getWholeCertInfo(txSimContext protocol.TxSimContext, certHash string) (*commonPb.CertInfo, error) {
-	certBytes, err := txSimContext.Get(syscontract.SystemContract_CERT_MANAGE.String(), []byte(certHash))
-	if err != nil {
-		return nil, err
+		return "", fmt.Errorf("%s, name[%s]", err, dposErc20ContractName)
 	}
-	return &commonPb.CertInfo{
-		Hash: certHash,
-		Cert: certBytes,
-	}, nil
+	return address, nil
 }
 
 func balanceOf(txSimContext protocol.TxSimContext, address string) (*utils.BigInteger, error) {
@@ -8,6 +8,7 @@
 package dposmgr
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"encoding/binary"
 	"fmt"
@@ -26,6 +27,9 @@ import (
 )
 
 const (
+	// MethodUnjail 被惩罚入狱的验证人在入狱的世代结束后，自行解除入狱状态
+	MethodUnjail = "UNJAIL"
+
 	paramNodeID               = "node_id"
 	paramAddress              = "address"
 	paramTo                   = "to"
@@ -38,9 +42,11 @@ const (
 	paramEpochValidatorNumber = "epoch_validator_number"
 	paramEpochBlockNumber     = "epoch_block_number"
 
-	prefixValidator    = "V/"
-	prefixDelegation   = "D/"
-	prefixUnDelegation = "U/"
+	prefixValidator     = "V/"
+	prefixDelegation    = "D/"
+	prefixUnDelegation  = "U/"
+	prefixSlashEvidence = "SE/"
+	prefixJailedEpoch   = "J/"
 
 	KeyNodeIDFormat              = "N/%s"
 	KeyRevNodeFormat             = "NR/%s"
@@ -48,6 +54,8 @@ const (
 	KeyDelegationFormat          = "D/%s/%s"
 	KeyEpochFormat               = "E/%s"
 	KeyUnbondingDelegationFormat = "U/%s/%s/%s"
+	KeySlashEvidenceFormat       = "SE/%s/%s/%s/%s/%s"
+	KeyJailedEpochFormat         = "J/%s"
 
 	KeyCurrentEpoch                   = "CE"
 	KeyMinSelfDelegation              = "MSD"
@@ -103,6 +111,30 @@ func ToReverseNodeIDKey(nodeID string) []byte {
 	return []byte(fmt.Sprintf(KeyRevNodeFormat, nodeID))
 }
 
+// ToSlashEvidenceKey - Key：SE + "/" + BigEndian(EpochID) + "/" + ValidatorAddress + "/" + EvidenceType + "/" +
+// BigEndian(BlockHeight) + "/" + BigEndian(Round)
+func ToSlashEvidenceKey(epochID uint64, validatorAddress, evidenceType string, blockHeight, round uint64) []byte {
+	return []byte(fmt.Sprintf(KeySlashEvidenceFormat, encodeUint64ToBigEndian(epochID), validatorAddress,
+		evidenceType, encodeUint64ToBigEndian(blockHeight), encodeUint64ToBigEndian(round)))
+}
+
+// ToSlashEvidencePrefix - Key：SE + "/" + BigEndian(EpochID)
+func ToSlashEvidencePrefix(epochID uint64) []byte {
+	bz := encodeUint64ToBigEndian(epochID)
+	return []byte(prefixSlashEvidence + string(bz))
+}
+
+// IsSlashEvidenceKey returns whether the key is the key of a slash evidence
+func IsSlashEvidenceKey(key []byte) bool {
+	return bytes.HasPrefix(key, []byte(prefixSlashEvidence))
+}
+
+// ToJailedEpochKey - Key：J + "/" + ValidatorAddress, the value is BigEndian(EpochID) of the epoch from which
+// the validator is jailed
+func ToJailedEpochKey(validatorAddress string) []byte {
+	return []byte(fmt.Sprintf(KeyJailedEpochFormat, validatorAddress))
+}
+
 // StakeContractAddr - convert stake contract name string to address: base58.Encode(sha256(stake_contract_name))
 func StakeContractAddr() string {
 	stakeAddrHash := sha256.Sum256([]byte(syscontract.SystemContract_DPOS_STAKE.String()))
@@ -189,6 +221,7 @@ func registerDPoSStakeContractMethods(log protocol.Logger) map[string]common.Con
 	methodMap[syscontract.DPoSStakeFunction_READ_SYSTEM_CONTRACT_ADDR.String()] = DPoSStakeRuntime.ReadSystemContractAddr
 	//methodMap[syscontract.DPoSStakeFunction_UPDATE_EPOCH_BLOCK_NUMBER.String()] = DPoSStakeRuntime.UpdateEpochBlockNumber
 	methodMap[syscontract.DPoSStakeFunction_READ_COMPLETE_UNBOUNDING_EPOCH_NUMBER.String()] = DPoSStakeRuntime.ReadCompleteUnBoundingEpochNumber
+	methodMap[MethodUnjail] = DPoSStakeRuntime.Unjail
 	return methodMap
 }
 
@@ -658,6 +691,62 @@ func (s *DPoSStakeRuntime) canDelete(context protocol.TxSimContext, undelegateVa
 	return nil
 }
 
+// Unjail() Validator						// 验证人解除入狱状态
+// 只有验证人自身可以解除，且入狱的世代已经结束、自身抵押不少于最少抵押数量，解除后在下一个世代切换时重新成为候选人
+// return Validator
+func (s *DPoSStakeRuntime) Unjail(context protocol.TxSimContext, params map[string][]byte) ([]byte, error) {
+	sender, err := loadSenderAddress(context) // Use ERC20 parse method
+	if err != nil {
+		s.log.Errorf("get sender address error: ", err.Error())
+		return nil, err
+	}
+	v, err := getValidator(context, sender)
+	if err != nil {
+		s.log.Errorf("get validator error: %s", err)
+		return nil, err
+	}
+	if !v.Jailed {
+		return nil, fmt.Errorf("validator[%s] is not jailed", sender)
+	}
+	// read epoch
+	bz, err := s.ReadLatestEpoch(context, nil)
+	if err != nil {
+		s.log.Errorf("unjail read latest epoch error")
+		return nil, err
+	}
+	epoch := &syscontract.Epoch{}
+	if err = proto.Unmarshal(bz, epoch); err != nil {
+		s.log.Errorf("unjail unmarshal latest epoch error")
+		return nil, err
+	}
+	jailedEpochKey := ToJailedEpochKey(sender)
+	bz, err = context.Get(syscontract.SystemContract_DPOS_STAKE.String(), jailedEpochKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(bz) > 0 && decodeUint64FromBigEndian(bz) >= epoch.EpochId {
+		return nil, fmt.Errorf("validator[%s] is jailed in epoch[%d], current epoch[%d]",
+			sender, decodeUint64FromBigEndian(bz), epoch.EpochId)
+	}
+	cmp, err := compareMinSelfDelegation(context, v.SelfDelegation)
+	if err != nil {
+		return nil, err
+	}
+	if cmp < 0 {
+		return nil, fmt.Errorf("self delegation[%s] of validator[%s] is less than the min self delegation",
+			v.SelfDelegation, sender)
+	}
+	v.Jailed = false
+	if err = save(context, ToValidatorKey(sender), v); err != nil {
+		s.log.Errorf("save validator error: %s", err)
+		return nil, err
+	}
+	if err = del(context, jailedEpochKey); err != nil {
+		return nil, err
+	}
+	return proto.Marshal(v)
+}
+
 // ReadEpochByID() []ValidatorAddress				// 读取当前世代数据
 // return Epoch
 func (s *DPoSStakeRuntime) ReadLatestEpoch(context protocol.TxSimContext, params map[string][]byte) ([]byte, error) {
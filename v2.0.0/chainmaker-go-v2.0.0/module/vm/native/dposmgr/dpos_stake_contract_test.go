@@ -327,6 +327,50 @@ func TestDPosStakeRuntime_UpdateEpochBlockNumber(t *testing.T) {
 	require.Nil(t, bz)
 }
 
+func TestDPosStakeRuntime_Unjail(t *testing.T) {
+	rt, ctx, fn := setUp(t)
+	defer fn()
+	stakeContract := syscontract.SystemContract_DPOS_STAKE.String()
+	// the sender is not a validator
+	_, err := rt.Unjail(ctx, nil)
+	require.Error(t, err)
+
+	v := newValidator(DelegateAddress)
+	v.Status = syscontract.BondStatus_BONDED
+	v.SelfDelegation = amount
+	require.Nil(t, save(ctx, ToValidatorKey(DelegateAddress), v))
+	_, err = rt.Unjail(ctx, nil)
+	require.EqualError(t, err, fmt.Sprintf("validator[%s] is not jailed", DelegateAddress))
+
+	// the validator is jailed in the current epoch
+	v.Jailed = true
+	require.Nil(t, save(ctx, ToValidatorKey(DelegateAddress), v))
+	require.Nil(t, ctx.Put(stakeContract, ToJailedEpochKey(DelegateAddress), encodeUint64ToBigEndian(1)))
+	_, err = rt.Unjail(ctx, nil)
+	require.EqualError(t, err, fmt.Sprintf("validator[%s] is jailed in epoch[1], current epoch[1]", DelegateAddress))
+
+	// the self delegation is slashed below the min self delegation
+	require.Nil(t, ctx.Put(stakeContract, ToJailedEpochKey(DelegateAddress), encodeUint64ToBigEndian(0)))
+	v.SelfDelegation = "1"
+	require.Nil(t, save(ctx, ToValidatorKey(DelegateAddress), v))
+	_, err = rt.Unjail(ctx, nil)
+	require.Error(t, err)
+
+	v.SelfDelegation = amount
+	require.Nil(t, save(ctx, ToValidatorKey(DelegateAddress), v))
+	bz, err := rt.Unjail(ctx, nil)
+	require.Nil(t, err)
+	unjailed := &syscontract.Validator{}
+	require.Nil(t, proto.Unmarshal(bz, unjailed))
+	require.False(t, unjailed.Jailed)
+	jailedEpoch, err := ctx.Get(stakeContract, ToJailedEpochKey(DelegateAddress))
+	require.Nil(t, err)
+	require.Empty(t, jailedEpoch)
+	v, err = getValidator(ctx, DelegateAddress)
+	require.Nil(t, err)
+	require.False(t, v.Jailed)
+}
+
 func TestSortCollections(t *testing.T) {
 	c := Collections{"1", "2", "3", "400000000000000", "50000000000"}
 	sort.Sort(c)
@@ -8,18 +8,53 @@
 package government
 
 import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
 	"fmt"
 
 	"chainmaker.org/chainmaker-go/vm/native/common"
 	"chainmaker.org/chainmaker/pb-go/v2/syscontract"
+	"github.com/syndtr/goleveldb/leveldb/util"
 
 	"chainmaker.org/chainmaker/protocol/v2"
 )
 
 const (
 	GovernmentContractName = "government_contract"
+
+	// MethodGetVoteEvidences query the duplicate vote evidences of a validator, which are reported by TBFT
+	MethodGetVoteEvidences = "GET_VOTE_EVIDENCES"
+	paramValidator         = "validator"
+
+	prefixVoteEvidence = "VE/"
 )
 
+// ToVoteEvidenceKey - Key: VE + "/" + Validator + "/" + BigEndian(Height) + BigEndian(Round) + VoteType
+func ToVoteEvidenceKey(validator string, height uint64, round int32, voteType string) []byte {
+	key := ToVoteEvidencePrefix(validator)
+	bz := make([]byte, 12)
+	binary.BigEndian.PutUint64(bz, height)
+	binary.BigEndian.PutUint32(bz[8:], uint32(round))
+	key = append(key, bz...)
+	return append(key, voteType...)
+}
+
+// ToVoteEvidencePrefix - Key: VE + "/" + Validator + "/"
+func ToVoteEvidencePrefix(validator string) []byte {
+	return []byte(prefixVoteEvidence + validator + "/")
+}
+
+// VoteEvidencePrefix - Key: VE + "/", the prefix of the evidences of all the validators
+func VoteEvidencePrefix() []byte {
+	return []byte(prefixVoteEvidence)
+}
+
+// IsVoteEvidenceKey returns whether the key of the governance contract is a vote evidence
+func IsVoteEvidenceKey(key []byte) bool {
+	return bytes.HasPrefix(key, []byte(prefixVoteEvidence))
+}
+
 type GovernmentContract struct {
 	methods map[string]common.ContractFunc
 	log     protocol.Logger
@@ -41,6 +76,7 @@ func registerGovernmentContractMethods(log protocol.Logger) map[string]common.Co
 	// cert manager
 	governmentRuntime := &GovernmentRuntime{log: log}
 	methodMap[syscontract.ChainQueryFunction_GET_GOVERNANCE_CONTRACT.String()] = governmentRuntime.GetGovernmentContract
+	methodMap[MethodGetVoteEvidences] = governmentRuntime.GetVoteEvidences
 	return methodMap
 }
 
@@ -64,3 +100,28 @@ func (r *GovernmentRuntime) GetGovernmentContract(txSimContext protocol.TxSimCon
 
 	return bytes, nil
 }
+
+// GetVoteEvidences returns the json array of the duplicate vote evidences of the validator, ordered by height
+func (r *GovernmentRuntime) GetVoteEvidences(txSimContext protocol.TxSimContext, parameters map[string][]byte) ([]byte, error) {
+	validator := string(parameters[paramValidator])
+	if validator == "" {
+		return nil, fmt.Errorf("param %s is empty", paramValidator)
+	}
+	iterRange := util.BytesPrefix(ToVoteEvidencePrefix(validator))
+	iter, err := txSimContext.Select(syscontract.SystemContract_GOVERNANCE.String(), iterRange.Start, iterRange.Limit)
+	if err != nil {
+		r.log.Errorw("select vote evidences err", "validator", validator, "err", err)
+		return nil, err
+	}
+	defer iter.Release()
+
+	evidences := make([]json.RawMessage, 0)
+	for iter.Next() {
+		kv, err := iter.Value()
+		if err != nil {
+			return nil, err
+		}
+		evidences = append(evidences, kv.GetValue())
+	}
+	return json.Marshal(evidences)
+}
@@ -8,12 +8,21 @@
 package multisign
 
 import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
 
+	"chainmaker.org/chainmaker-go/utils"
 	"chainmaker.org/chainmaker-go/vm/native/common"
 
+	"chainmaker.org/chainmaker/common/v2/crypto"
+	"chainmaker.org/chainmaker/common/v2/crypto/hash"
 	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	"chainmaker.org/chainmaker/pb-go/v2/syscontract"
 	"chainmaker.org/chainmaker/protocol/v2"
+	"github.com/gogo/protobuf/proto"
 )
 
 var (
@@ -21,6 +30,32 @@ var (
 	KEY_SystemContractPayload = "SystemContractPayload"
 )
 
+const (
+	paramNameTxType        = "tx_type"
+	paramNameDeadlineBlock = "deadline_block"
+	paramNamePayload       = utils.MultiSignParamPayload
+	paramNameVoteInfo      = "vote_info"
+	paramNameTxId          = "tx_id"
+	paramNamePayloadHash   = "payload_hash"
+
+	keyPrefixMeta        = "meta_"
+	keyPrefixPayloadHash = "payload_hash_"
+	keyPrefixResult      = "result_"
+)
+
+var (
+	contractName = syscontract.SystemContract_MULTI_SIGN.String()
+
+	errMultiSignNotExist  = errors.New("multi sign request not exist")
+	errMultiSignExecuted  = errors.New("multi sign request has been executed")
+	errMultiSignExpired   = errors.New("multi sign request has expired")
+	errMultiSignExist     = errors.New("multi sign request of the payload already exist")
+	errMultiSignRepeated  = errors.New("the member has already voted")
+	errMultiSignNoSupport = errors.New("multi sign does not support the contract")
+	errMultiSignNotConfig = errors.New("the vote of a chain config request should declare the contract_name " +
+		"CHAIN_CONFIG, and only it")
+)
+
 // MultiSignContract multiSign Contract
 type MultiSignContract struct {
 	methods map[string]common.ContractFunc
@@ -40,7 +75,10 @@ func (c *MultiSignContract) GetMethod(methodName string) common.ContractFunc {
 
 func registerMultiSignContractMethods(log protocol.Logger) map[string]common.ContractFunc {
 	methodMap := make(map[string]common.ContractFunc, 64)
-
+	runtime := &MultiSignRuntime{log: log}
+	methodMap[syscontract.MultiSignFunction_REQ.String()] = runtime.Req
+	methodMap[syscontract.MultiSignFunction_VOTE.String()] = runtime.Vote
+	methodMap[syscontract.MultiSignFunction_QUERY.String()] = runtime.Query
 	return methodMap
 }
 
@@ -49,6 +87,360 @@ type MultiSignRuntime struct {
 	log protocol.Logger
 }
 
+// multiSignMeta the request info which is not carried by commonPb.MultiSignInfo
+type multiSignMeta struct {
+	TxType        string `json:"tx_type"`
+	DeadlineBlock uint64 `json:"deadline_block"`
+	PayloadHash   string `json:"payload_hash"`
+}
+
+// Req create a multi sign request, the payload is stored and waiting for votes.
+// If the endorsement of the requester already satisfies the policy, the payload is executed at once.
+func (r *MultiSignRuntime) Req(txSimContext protocol.TxSimContext, params map[string][]byte) (result []byte, err error) {
+	txType := string(params[paramNameTxType])
+	payloadHex := string(params[paramNamePayload])
+	voteInfoBytes := params[paramNameVoteInfo]
+	if utils.IsAnyBlank(txType, payloadHex, voteInfoBytes) {
+		err = fmt.Errorf("%s, multi sign req require param [%s, %s, %s] not found", common.ErrParams.Error(),
+			paramNameTxType, paramNamePayload, paramNameVoteInfo)
+		r.log.Error(err)
+		return nil, err
+	}
+
+	var deadlineBlock uint64
+	if deadlineStr := string(params[paramNameDeadlineBlock]); deadlineStr != "" {
+		deadlineBlock, err = strconv.ParseUint(deadlineStr, 10, 64)
+		if err != nil {
+			err = fmt.Errorf("%s, param [%s] is not a number", common.ErrParams.Error(), paramNameDeadlineBlock)
+			r.log.Error(err)
+			return nil, err
+		}
+		if deadlineBlock != 0 && deadlineBlock <= txSimContext.GetBlockHeight() {
+			err = fmt.Errorf("%s, deadline block %d should be greater than current block %d",
+				common.ErrParams.Error(), deadlineBlock, txSimContext.GetBlockHeight())
+			r.log.Error(err)
+			return nil, err
+		}
+	}
+
+	payloadBytes, err := hex.DecodeString(payloadHex)
+	if err != nil {
+		r.log.Errorf("multi sign req decode payload failed, err: %s", err.Error())
+		return nil, err
+	}
+	if _, err = parsePayload(txType, payloadBytes); err != nil {
+		r.log.Errorf("multi sign req parse payload failed, err: %s", err.Error())
+		return nil, err
+	}
+
+	payloadHash, err := hash.GetByStrType(crypto.CRYPTO_ALGO_SHA256, payloadBytes)
+	if err != nil {
+		r.log.Errorf("multi sign req hash payload failed, err: %s", err.Error())
+		return nil, err
+	}
+	payloadHashHex := hex.EncodeToString(payloadHash)
+	existTxId, err := txSimContext.Get(contractName, []byte(keyPrefixPayloadHash+payloadHashHex))
+	if err != nil {
+		r.log.Errorf("multi sign req get payload hash failed, err: %s", err.Error())
+		return nil, err
+	}
+	if len(existTxId) > 0 {
+		r.log.Warnf("multi sign req payloadHash[%s] exist, txId[%s]", payloadHashHex, string(existTxId))
+		return nil, errMultiSignExist
+	}
+
+	txId := txSimContext.GetTx().Payload.TxId
+	multiSignInfo := &commonPb.MultiSignInfo{
+		PayloadBytes: payloadBytes,
+	}
+	meta := &multiSignMeta{
+		TxType:        txType,
+		DeadlineBlock: deadlineBlock,
+		PayloadHash:   payloadHashHex,
+	}
+	if err = r.addVote(txSimContext, multiSignInfo, voteInfoBytes); err != nil {
+		return nil, err
+	}
+
+	if err = txSimContext.Put(contractName, []byte(keyPrefixPayloadHash+payloadHashHex), []byte(txId)); err != nil {
+		r.log.Errorf("multi sign req put payload hash failed, err: %s", err.Error())
+		return nil, err
+	}
+	metaBytes, err := json.Marshal(meta)
+	if err != nil {
+		return nil, err
+	}
+	if err = txSimContext.Put(contractName, []byte(keyPrefixMeta+txId), metaBytes); err != nil {
+		r.log.Errorf("multi sign req put meta failed, err: %s", err.Error())
+		return nil, err
+	}
+
+	r.log.Infof("multi sign req success txId[%s] payloadHash[%s]", txId, payloadHashHex)
+	return r.saveAndTryExecute(txSimContext, txId, meta, multiSignInfo)
+}
+
+// Vote add a vote to a pending multi sign request, the request is located by tx_id or payload_hash.
+// Once the agreed endorsements satisfy the policy of the wrapped contract method, it is executed in this tx.
+func (r *MultiSignRuntime) Vote(txSimContext protocol.TxSimContext, params map[string][]byte) (result []byte, err error) {
+	voteInfoBytes := params[paramNameVoteInfo]
+	if utils.IsAnyBlank(voteInfoBytes) {
+		err = fmt.Errorf("%s, multi sign vote require param [%s] not found", common.ErrParams.Error(), paramNameVoteInfo)
+		r.log.Error(err)
+		return nil, err
+	}
+
+	txId, multiSignInfo, meta, err := r.getMultiSign(txSimContext, params)
+	if err != nil {
+		return nil, err
+	}
+
+	executed, err := txSimContext.Get(contractName, []byte(keyPrefixResult+txId))
+	if err != nil {
+		return nil, err
+	}
+	if len(executed) > 0 {
+		r.log.Warnf("multi sign vote failed, txId[%s] has been executed", txId)
+		return nil, errMultiSignExecuted
+	}
+	if meta.DeadlineBlock != 0 && txSimContext.GetBlockHeight() > meta.DeadlineBlock {
+		r.log.Warnf("multi sign vote failed, txId[%s] expired at block %d", txId, meta.DeadlineBlock)
+		return nil, errMultiSignExpired
+	}
+
+	if err = r.addVote(txSimContext, multiSignInfo, voteInfoBytes); err != nil {
+		return nil, err
+	}
+
+	r.log.Infof("multi sign vote success txId[%s] votes[%d]", txId, len(multiSignInfo.VoteInfos))
+	return r.saveAndTryExecute(txSimContext, txId, meta, multiSignInfo)
+}
+
+// Query return the commonPb.MultiSignInfo of a request located by tx_id or payload_hash
+func (r *MultiSignRuntime) Query(txSimContext protocol.TxSimContext, params map[string][]byte) (result []byte, err error) {
+	_, multiSignInfo, _, err := r.getMultiSign(txSimContext, params)
+	if err != nil {
+		return nil, err
+	}
+	return proto.Marshal(multiSignInfo)
+}
+
+// getMultiSign load the request by tx_id, or by payload_hash if tx_id is absent
+func (r *MultiSignRuntime) getMultiSign(txSimContext protocol.TxSimContext, params map[string][]byte) (
+	string, *commonPb.MultiSignInfo, *multiSignMeta, error) {
+	txId := string(params[paramNameTxId])
+	if txId == "" {
+		payloadHash := string(params[paramNamePayloadHash])
+		if utils.IsAnyBlank(payloadHash) {
+			err := fmt.Errorf("%s, require param [%s] or [%s] not found", common.ErrParams.Error(),
+				paramNameTxId, paramNamePayloadHash)
+			r.log.Error(err)
+			return "", nil, nil, err
+		}
+		txIdBytes, err := txSimContext.Get(contractName, []byte(keyPrefixPayloadHash+payloadHash))
+		if err != nil {
+			return "", nil, nil, err
+		}
+		if len(txIdBytes) == 0 {
+			return "", nil, nil, errMultiSignNotExist
+		}
+		txId = string(txIdBytes)
+	}
+
+	infoBytes, err := txSimContext.Get(contractName, []byte(txId))
+	if err != nil {
+		r.log.Errorf("multi sign get txId[%s] failed, err: %s", txId, err.Error())
+		return "", nil, nil, err
+	}
+	if len(infoBytes) == 0 {
+		return "", nil, nil, errMultiSignNotExist
+	}
+	multiSignInfo := &commonPb.MultiSignInfo{}
+	if err = proto.Unmarshal(infoBytes, multiSignInfo); err != nil {
+		r.log.Errorf("multi sign unmarshal txId[%s] failed, err: %s", txId, err.Error())
+		return "", nil, nil, common.ErrUnmarshalFailed
+	}
+
+	metaBytes, err := txSimContext.Get(contractName, []byte(keyPrefixMeta+txId))
+	if err != nil {
+		return "", nil, nil, err
+	}
+	meta := &multiSignMeta{}
+	if err = json.Unmarshal(metaBytes, meta); err != nil {
+		r.log.Errorf("multi sign unmarshal meta of txId[%s] failed, err: %s", txId, err.Error())
+		return "", nil, nil, common.ErrUnmarshalFailed
+	}
+	return txId, multiSignInfo, meta, nil
+}
+
+// addVote verify the vote and append it to the request. Each endorsement carried by a vote must be signed over
+// the payload bytes, and an agree vote must carry one; a disagree vote without endorsement is recorded against
+// the tx sender.
+func (r *MultiSignRuntime) addVote(txSimContext protocol.TxSimContext, multiSignInfo *commonPb.MultiSignInfo,
+	voteInfoBytes []byte) error {
+	voteInfo := &commonPb.MultiSignVoteInfo{}
+	if err := proto.Unmarshal(voteInfoBytes, voteInfo); err != nil {
+		r.log.Errorf("multi sign unmarshal vote info failed, err: %s", err.Error())
+		return common.ErrUnmarshalFailed
+	}
+	if voteInfo.Vote != commonPb.VoteStatus_AGREE && voteInfo.Vote != commonPb.VoteStatus_DISAGREE {
+		return fmt.Errorf("%s, unknown vote status %d", common.ErrParams.Error(), voteInfo.Vote)
+	}
+
+	ac, err := txSimContext.GetAccessControl()
+	if err != nil {
+		r.log.Errorf("txSimContext.GetAccessControl failed, err: %s", err.Error())
+		return err
+	}
+
+	if voteInfo.Endorsement == nil {
+		if voteInfo.Vote == commonPb.VoteStatus_AGREE {
+			return fmt.Errorf("%s, the agree vote has no endorsement", common.ErrParams.Error())
+		}
+		voteInfo.Endorsement = txSimContext.GetTx().Sender
+	} else {
+		if voteInfo.Endorsement.Signer == nil {
+			return fmt.Errorf("%s, the endorsement of the vote has no signer", common.ErrParams.Error())
+		}
+		member, err := ac.NewMember(voteInfo.Endorsement.Signer)
+		if err != nil {
+			r.log.Errorf("multi sign new member failed, err: %s", err.Error())
+			return err
+		}
+		if err = member.Verify(ac.GetHashAlg(), multiSignInfo.PayloadBytes, voteInfo.Endorsement.Signature); err != nil {
+			r.log.Errorf("multi sign verify vote signature failed, err: %s", err.Error())
+			return err
+		}
+	}
+
+	voter, err := ac.NewMember(voteInfo.Endorsement.Signer)
+	if err != nil {
+		r.log.Errorf("multi sign new member failed, err: %s", err.Error())
+		return err
+	}
+	for _, v := range multiSignInfo.VoteInfos {
+		m, err := ac.NewMember(v.Endorsement.Signer)
+		if err != nil {
+			return err
+		}
+		if m.GetMemberId() == voter.GetMemberId() {
+			r.log.Warnf("multi sign member[%s] has already voted", voter.GetMemberId())
+			return errMultiSignRepeated
+		}
+	}
+
+	multiSignInfo.VoteInfos = append(multiSignInfo.VoteInfos, voteInfo)
+	return nil
+}
+
+// saveAndTryExecute store the request, then execute the wrapped call if the policy is satisfied.
+// The result is the new chain config when a CHAIN_CONFIG call is executed, so that the block is
+// recognized as a config block, and nil otherwise.
+func (r *MultiSignRuntime) saveAndTryExecute(txSimContext protocol.TxSimContext, txId string, meta *multiSignMeta,
+	multiSignInfo *commonPb.MultiSignInfo) ([]byte, error) {
+	info, err := parsePayload(meta.TxType, multiSignInfo.PayloadBytes)
+	if err != nil {
+		return nil, err
+	}
+	payload := info.payload.(*commonPb.Payload)
+	// a chain config update must be executed by a config tx, which is packed alone in its block
+	isConfig := payload.ContractName == syscontract.SystemContract_CHAIN_CONFIG.String()
+	if isConfig != utils.IsMultiSignConfigTx(txSimContext.GetTx()) {
+		r.log.Warnf("multi sign txId[%s] of %s can not be executed by the tx", txId, payload.ContractName)
+		return nil, errMultiSignNotConfig
+	}
+
+	infoBytes, err := proto.Marshal(multiSignInfo)
+	if err != nil {
+		return nil, err
+	}
+	if err = txSimContext.Put(contractName, []byte(txId), infoBytes); err != nil {
+		r.log.Errorf("multi sign put txId[%s] failed, err: %s", txId, err.Error())
+		return nil, err
+	}
+	parameters := make(map[string][]byte, len(payload.Parameters))
+	for _, kv := range payload.Parameters {
+		parameters[kv.Key] = kv.Value
+	}
+
+	if !r.isPolicySatisfied(txSimContext, payload, parameters, multiSignInfo) {
+		return nil, nil
+	}
+
+	contract := &commonPb.Contract{Name: payload.ContractName}
+	contractResult, code := txSimContext.CallContract(contract, payload.Method, nil, parameters, 0,
+		commonPb.TxType_INVOKE_CONTRACT)
+	if code != commonPb.TxStatusCode_SUCCESS || contractResult.Code > 0 {
+		r.log.Errorf("multi sign execute txId[%s] %s-%s failed, code: %s, message: %s",
+			txId, payload.ContractName, payload.Method, code.String(), contractResult.Message)
+		return nil, fmt.Errorf("multi sign execute %s-%s failed, %s", payload.ContractName, payload.Method,
+			contractResult.Message)
+	}
+
+	resultBytes, err := proto.Marshal(contractResult)
+	if err != nil {
+		return nil, err
+	}
+	if err = txSimContext.Put(contractName, []byte(keyPrefixResult+txId), resultBytes); err != nil {
+		r.log.Errorf("multi sign put result of txId[%s] failed, err: %s", txId, err.Error())
+		return nil, err
+	}
+	r.log.Infof("multi sign execute txId[%s] %s-%s success", txId, payload.ContractName, payload.Method)
+
+	if isConfig {
+		return contractResult.Result, nil
+	}
+	return nil, nil
+}
+
+// isPolicySatisfied verify the agreed endorsements against the resource policy of the wrapped contract method
+func (r *MultiSignRuntime) isPolicySatisfied(txSimContext protocol.TxSimContext, payload *commonPb.Payload,
+	parameters map[string][]byte, multiSignInfo *commonPb.MultiSignInfo) bool {
+	endorsements := make([]*commonPb.EndorsementEntry, 0, len(multiSignInfo.VoteInfos))
+	for _, v := range multiSignInfo.VoteInfos {
+		if v.Vote == commonPb.VoteStatus_AGREE {
+			endorsements = append(endorsements, v.Endorsement)
+		}
+	}
+	if len(endorsements) == 0 {
+		return false
+	}
+
+	ac, err := txSimContext.GetAccessControl()
+	if err != nil {
+		r.log.Errorf("txSimContext.GetAccessControl failed, err: %s", err.Error())
+		return false
+	}
+	resourceName := payload.ContractName + "-" + payload.Method
+	p, err := ac.LookUpPolicy(resourceName)
+	if err != nil {
+		r.log.Warnf("multi sign look up policy of [%s] failed, err: %s", resourceName, err.Error())
+		return false
+	}
+
+	var principal protocol.Principal
+	if p.Rule == string(protocol.RuleSelf) {
+		targetOrg := string(parameters[protocol.ConfigNameOrgId])
+		if targetOrg == "" {
+			r.log.Warnf("verification rule of [%s] is [SELF], but org_id is not set in the parameter", resourceName)
+			return false
+		}
+		principal, err = ac.CreatePrincipalForTargetOrg(resourceName, endorsements, multiSignInfo.PayloadBytes, targetOrg)
+	} else {
+		principal, err = ac.CreatePrincipal(resourceName, endorsements, multiSignInfo.PayloadBytes)
+	}
+	if err != nil {
+		r.log.Warnf("multi sign create principal of [%s] failed, err: %s", resourceName, err.Error())
+		return false
+	}
+
+	ok, err := ac.VerifyPrincipal(principal)
+	if err != nil {
+		r.log.Infof("multi sign policy of [%s] not satisfied yet, %s", resourceName, err.Error())
+		return false
+	}
+	return ok
+}
+
 // payloadInfo the memory payload info
 type payloadInfo struct {
 	txType      commonPb.TxType
@@ -59,31 +451,33 @@ type payloadInfo struct {
 // parsePayload unmarshal bytes
 func parsePayload(txType string, payloadBytes []byte) (*payloadInfo, error) {
 	switch txType {
-	//case commonPb.TxType_MANAGE_USER_CONTRACT.String():
-	//	txType1 := commonPb.TxType(commonPb.TxType_value[txType])
-	//	payload := new(commonPb.Payload)
-	//	err := proto.Unmarshal(payloadBytes, payload)
-	//	if err != nil {
-	//		return nil, err
-	//	}
-	//	return &payloadInfo{
-	//		txType:      txType1,
-	//		payload:     payload,
-	//		payloadType: KEY_ContractMgmtPayload,
-	//	}, nil
-	//case commonPb.TxType_INVOKE_CONTRACT.String(), commonPb.TxType_INVOKE_CONTRACT.String():
-	//	txType1 := commonPb.TxType(commonPb.TxType_value[txType])
-	//	payload := new(commonPb.Payload)
-	//	err := proto.Unmarshal(payloadBytes, payload)
-	//	if err != nil {
-	//		return nil, err
-	//	}
-	//	return &payloadInfo{
-	//		txType:      txType1,
-	//		payload:     payload,
-	//		payloadType: KEY_SystemContractPayload,
-	//	}, nil
+	case commonPb.TxType_INVOKE_CONTRACT.String():
+		txType1 := commonPb.TxType(commonPb.TxType_value[txType])
+		payload := new(commonPb.Payload)
+		err := proto.Unmarshal(payloadBytes, payload)
+		if err != nil {
+			return nil, err
+		}
+		if !supportMultiSign(payload.ContractName) {
+			return nil, fmt.Errorf("%s, contract = %s", errMultiSignNoSupport, payload.ContractName)
+		}
+		payloadType := KEY_SystemContractPayload
+		if payload.ContractName == syscontract.SystemContract_CONTRACT_MANAGE.String() {
+			payloadType = KEY_ContractMgmtPayload
+		}
+		return &payloadInfo{
+			txType:      txType1,
+			payload:     payload,
+			payloadType: payloadType,
+		}, nil
 	default:
 		return nil, fmt.Errorf("no support the tx_type, tx_type = %s", txType)
 	}
 }
+
+// supportMultiSign the wrapped payload can only call the chain config and contract manage contracts,
+// whose effects are fully expressed by the write set of the multi sign tx
+func supportMultiSign(contractName string) bool {
+	return contractName == syscontract.SystemContract_CHAIN_CONFIG.String() ||
+		contractName == syscontract.SystemContract_CONTRACT_MANAGE.String()
+}
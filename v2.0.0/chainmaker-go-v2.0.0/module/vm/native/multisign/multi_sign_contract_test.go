@@ -0,0 +1,283 @@
+/*
+ * Copyright (C) BABEC. All rights reserved.
+ * Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package multisign
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"chainmaker.org/chainmaker-go/logger"
+	"chainmaker.org/chainmaker-go/utils"
+	acPb "chainmaker.org/chainmaker/pb-go/v2/accesscontrol"
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	"chainmaker.org/chainmaker/pb-go/v2/syscontract"
+	"chainmaker.org/chainmaker/protocol/v2"
+	"chainmaker.org/chainmaker/protocol/v2/mock"
+	"github.com/gogo/protobuf/proto"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePayload(t *testing.T) {
+	payload := &commonPb.Payload{
+		ChainId:      "chain1",
+		ContractName: syscontract.SystemContract_CHAIN_CONFIG.String(),
+		Method:       syscontract.ChainConfigFunction_CORE_UPDATE.String(),
+		TxType:       commonPb.TxType_INVOKE_CONTRACT,
+	}
+	payloadBytes, err := proto.Marshal(payload)
+	require.Nil(t, err)
+
+	info, err := parsePayload(commonPb.TxType_INVOKE_CONTRACT.String(), payloadBytes)
+	require.Nil(t, err)
+	require.Equal(t, commonPb.TxType_INVOKE_CONTRACT, info.txType)
+	require.Equal(t, KEY_SystemContractPayload, info.payloadType)
+	require.Equal(t, payload.Method, info.payload.(*commonPb.Payload).Method)
+
+	payload.ContractName = syscontract.SystemContract_CONTRACT_MANAGE.String()
+	payload.Method = syscontract.ContractManageFunction_FREEZE_CONTRACT.String()
+	payloadBytes, err = proto.Marshal(payload)
+	require.Nil(t, err)
+	info, err = parsePayload(commonPb.TxType_INVOKE_CONTRACT.String(), payloadBytes)
+	require.Nil(t, err)
+	require.Equal(t, KEY_ContractMgmtPayload, info.payloadType)
+}
+
+func TestParsePayloadNotSupport(t *testing.T) {
+	payload := &commonPb.Payload{
+		ContractName: syscontract.SystemContract_CERT_MANAGE.String(),
+		Method:       syscontract.CertManageFunction_CERTS_FREEZE.String(),
+	}
+	payloadBytes, err := proto.Marshal(payload)
+	require.Nil(t, err)
+
+	_, err = parsePayload(commonPb.TxType_INVOKE_CONTRACT.String(), payloadBytes)
+	require.NotNil(t, err)
+
+	_, err = parsePayload(commonPb.TxType_QUERY_CONTRACT.String(), payloadBytes)
+	require.NotNil(t, err)
+}
+
+// multiSignTestEnv the signature of a member over a message is the member info followed by the message,
+// the policy is satisfied by two agreed endorsements
+type multiSignTestEnv struct {
+	runtime      *MultiSignRuntime
+	txSimContext protocol.TxSimContext
+	tx           *commonPb.Transaction
+	calls        []string
+}
+
+func newMultiSignTestEnv(t *testing.T) (*multiSignTestEnv, func()) {
+	ctrl := gomock.NewController(t)
+	env := &multiSignTestEnv{runtime: &MultiSignRuntime{log: logger.GetLogger(logger.MODULE_VM)}}
+	state := make(map[string][]byte)
+	txSimContext := mock.NewMockTxSimContext(ctrl)
+	txSimContext.EXPECT().Get(contractName, gomock.Any()).DoAndReturn(
+		func(name string, key []byte) ([]byte, error) {
+			return state[string(key)], nil
+		}).AnyTimes()
+	txSimContext.EXPECT().Put(contractName, gomock.Any(), gomock.Any()).DoAndReturn(
+		func(name string, key []byte, value []byte) error {
+			state[string(key)] = value
+			return nil
+		}).AnyTimes()
+	txSimContext.EXPECT().GetTx().DoAndReturn(func() *commonPb.Transaction {
+		return env.tx
+	}).AnyTimes()
+	txSimContext.EXPECT().GetBlockHeight().Return(uint64(10)).AnyTimes()
+	txSimContext.EXPECT().CallContract(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(),
+		gomock.Any()).DoAndReturn(func(contract *commonPb.Contract, method string, byteCode []byte,
+		parameter map[string][]byte, gasUsed uint64, refTxType commonPb.TxType) (*commonPb.ContractResult,
+		commonPb.TxStatusCode) {
+		env.calls = append(env.calls, contract.Name+"-"+method)
+		return &commonPb.ContractResult{Result: []byte("new config")}, commonPb.TxStatusCode_SUCCESS
+	}).AnyTimes()
+
+	ac := mock.NewMockAccessControlProvider(ctrl)
+	ac.EXPECT().GetHashAlg().Return("SHA256").AnyTimes()
+	ac.EXPECT().NewMember(gomock.Any()).DoAndReturn(func(pbMember *acPb.Member) (protocol.Member, error) {
+		member := mock.NewMockMember(ctrl)
+		member.EXPECT().GetMemberId().Return(string(pbMember.MemberInfo)).AnyTimes()
+		member.EXPECT().Verify(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+			func(hashType string, msg []byte, sig []byte) error {
+				if !bytes.Equal(sig, append(append([]byte{}, pbMember.MemberInfo...), msg...)) {
+					return errors.New("invalid signature")
+				}
+				return nil
+			}).AnyTimes()
+		return member, nil
+	}).AnyTimes()
+	ac.EXPECT().LookUpPolicy(gomock.Any()).Return(&acPb.Policy{Rule: string(protocol.RuleMajority)}, nil).AnyTimes()
+	var agreed int
+	ac.EXPECT().CreatePrincipal(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(resourceName string, endorsements []*commonPb.EndorsementEntry, message []byte) (protocol.Principal,
+			error) {
+			agreed = len(endorsements)
+			return nil, nil
+		}).AnyTimes()
+	ac.EXPECT().VerifyPrincipal(gomock.Any()).DoAndReturn(func(principal protocol.Principal) (bool, error) {
+		if agreed < 2 {
+			return false, errors.New("not enough endorsements")
+		}
+		return true, nil
+	}).AnyTimes()
+	txSimContext.EXPECT().GetAccessControl().Return(ac, nil).AnyTimes()
+
+	env.txSimContext = txSimContext
+	return env, ctrl.Finish
+}
+
+// send sets the multi sign tx of the sender as the current tx and runs it
+func (env *multiSignTestEnv) send(sender, method string, params map[string][]byte) ([]byte, error) {
+	env.tx = &commonPb.Transaction{
+		Payload: &commonPb.Payload{TxId: "tx-" + sender + "-" + method,
+			ContractName: syscontract.SystemContract_MULTI_SIGN.String(), Method: method},
+		Sender: &commonPb.EndorsementEntry{Signer: &acPb.Member{MemberInfo: []byte(sender)}},
+	}
+	for k, v := range params {
+		env.tx.Payload.Parameters = append(env.tx.Payload.Parameters, &commonPb.KeyValuePair{Key: k, Value: v})
+	}
+	if method == syscontract.MultiSignFunction_REQ.String() {
+		return env.runtime.Req(env.txSimContext, params)
+	}
+	return env.runtime.Vote(env.txSimContext, params)
+}
+
+func newTestVoteInfo(t *testing.T, vote commonPb.VoteStatus, signer string, payloadBytes []byte) []byte {
+	voteInfo := &commonPb.MultiSignVoteInfo{Vote: vote}
+	if signer != "" {
+		voteInfo.Endorsement = &commonPb.EndorsementEntry{
+			Signer:    &acPb.Member{MemberInfo: []byte(signer)},
+			Signature: append([]byte(signer), payloadBytes...),
+		}
+	}
+	voteInfoBytes, err := proto.Marshal(voteInfo)
+	require.Nil(t, err)
+	return voteInfoBytes
+}
+
+func newTestMultiSignPayload(t *testing.T, contract, method string) []byte {
+	payloadBytes, err := proto.Marshal(&commonPb.Payload{
+		ChainId:      "chain1",
+		ContractName: contract,
+		Method:       method,
+		TxType:       commonPb.TxType_INVOKE_CONTRACT,
+	})
+	require.Nil(t, err)
+	return payloadBytes
+}
+
+func TestMultiSignRuntime_ReqAndVote(t *testing.T) {
+	env, fn := newMultiSignTestEnv(t)
+	defer fn()
+
+	payloadBytes := newTestMultiSignPayload(t, syscontract.SystemContract_CHAIN_CONFIG.String(),
+		syscontract.ChainConfigFunction_CORE_UPDATE.String())
+	result, err := env.send("admin1", syscontract.MultiSignFunction_REQ.String(), map[string][]byte{
+		paramNameTxType:   []byte(commonPb.TxType_INVOKE_CONTRACT.String()),
+		paramNamePayload:  []byte(hex.EncodeToString(payloadBytes)),
+		paramNameVoteInfo: newTestVoteInfo(t, commonPb.VoteStatus_AGREE, "admin1", payloadBytes),
+	})
+	require.Nil(t, err)
+	require.Nil(t, result)
+	require.True(t, utils.IsConfigTx(env.tx))
+	reqTxId := env.tx.Payload.TxId
+
+	// the vote of a chain config request must be a config tx
+	_, err = env.send("admin2", syscontract.MultiSignFunction_VOTE.String(), map[string][]byte{
+		paramNameTxId:     []byte(reqTxId),
+		paramNameVoteInfo: newTestVoteInfo(t, commonPb.VoteStatus_AGREE, "admin2", payloadBytes),
+	})
+	require.Equal(t, errMultiSignNotConfig, err)
+
+	configVote := func(voteInfo []byte) map[string][]byte {
+		return map[string][]byte{
+			paramNameTxId:                    []byte(reqTxId),
+			paramNameVoteInfo:                voteInfo,
+			utils.MultiSignParamContractName: []byte(syscontract.SystemContract_CHAIN_CONFIG.String()),
+		}
+	}
+	// the disagree vote without endorsement is recorded against the sender, who can not vote again
+	result, err = env.send("admin3", syscontract.MultiSignFunction_VOTE.String(),
+		configVote(newTestVoteInfo(t, commonPb.VoteStatus_DISAGREE, "", nil)))
+	require.Nil(t, err)
+	require.Nil(t, result)
+	_, err = env.send("admin3", syscontract.MultiSignFunction_VOTE.String(),
+		configVote(newTestVoteInfo(t, commonPb.VoteStatus_AGREE, "admin3", payloadBytes)))
+	require.Equal(t, errMultiSignRepeated, err)
+	require.Empty(t, env.calls)
+
+	result, err = env.send("admin2", syscontract.MultiSignFunction_VOTE.String(),
+		configVote(newTestVoteInfo(t, commonPb.VoteStatus_AGREE, "admin2", payloadBytes)))
+	require.Nil(t, err)
+	require.Equal(t, []byte("new config"), result)
+	require.Equal(t, []string{syscontract.SystemContract_CHAIN_CONFIG.String() + "-" +
+		syscontract.ChainConfigFunction_CORE_UPDATE.String()}, env.calls)
+
+	_, err = env.send("admin4", syscontract.MultiSignFunction_VOTE.String(),
+		configVote(newTestVoteInfo(t, commonPb.VoteStatus_AGREE, "admin4", payloadBytes)))
+	require.Equal(t, errMultiSignExecuted, err)
+
+	infoBytes, err := env.runtime.Query(env.txSimContext, map[string][]byte{paramNameTxId: []byte(reqTxId)})
+	require.Nil(t, err)
+	multiSignInfo := &commonPb.MultiSignInfo{}
+	require.Nil(t, proto.Unmarshal(infoBytes, multiSignInfo))
+	require.Len(t, multiSignInfo.VoteInfos, 3)
+	require.Equal(t, []byte("admin3"), multiSignInfo.VoteInfos[1].Endorsement.Signer.MemberInfo)
+}
+
+func TestMultiSignRuntime_VoteEndorsementVerified(t *testing.T) {
+	env, fn := newMultiSignTestEnv(t)
+	defer fn()
+
+	payloadBytes := newTestMultiSignPayload(t, syscontract.SystemContract_CONTRACT_MANAGE.String(),
+		syscontract.ContractManageFunction_FREEZE_CONTRACT.String())
+	reqParams := map[string][]byte{
+		paramNameTxType:   []byte(commonPb.TxType_INVOKE_CONTRACT.String()),
+		paramNamePayload:  []byte(hex.EncodeToString(payloadBytes)),
+		paramNameVoteInfo: newTestVoteInfo(t, commonPb.VoteStatus_AGREE, "admin1", []byte("other payload")),
+	}
+	_, err := env.send("admin1", syscontract.MultiSignFunction_REQ.String(), reqParams)
+	require.NotNil(t, err)
+
+	reqParams[paramNameVoteInfo] = newTestVoteInfo(t, commonPb.VoteStatus_AGREE, "admin1", payloadBytes)
+	_, err = env.send("admin1", syscontract.MultiSignFunction_REQ.String(), reqParams)
+	require.Nil(t, err)
+	require.False(t, utils.IsConfigTx(env.tx))
+	reqTxId := env.tx.Payload.TxId
+
+	// a disagree vote is verified too, the signer of an endorsement not over the payload can not vote for others
+	_, err = env.send("user1", syscontract.MultiSignFunction_VOTE.String(), map[string][]byte{
+		paramNameTxId:     []byte(reqTxId),
+		paramNameVoteInfo: newTestVoteInfo(t, commonPb.VoteStatus_DISAGREE, "admin2", []byte("other payload")),
+	})
+	require.NotNil(t, err)
+	_, err = env.send("admin2", syscontract.MultiSignFunction_VOTE.String(), map[string][]byte{
+		paramNameTxId:     []byte(reqTxId),
+		paramNameVoteInfo: newTestVoteInfo(t, commonPb.VoteStatus_AGREE, "", nil),
+	})
+	require.NotNil(t, err)
+	// the vote of a request which is not a chain config update can not be a config tx
+	_, err = env.send("admin2", syscontract.MultiSignFunction_VOTE.String(), map[string][]byte{
+		paramNameTxId:                    []byte(reqTxId),
+		paramNameVoteInfo:                newTestVoteInfo(t, commonPb.VoteStatus_AGREE, "admin2", payloadBytes),
+		utils.MultiSignParamContractName: []byte(syscontract.SystemContract_CHAIN_CONFIG.String()),
+	})
+	require.Equal(t, errMultiSignNotConfig, err)
+
+	result, err := env.send("admin2", syscontract.MultiSignFunction_VOTE.String(), map[string][]byte{
+		paramNameTxId:     []byte(reqTxId),
+		paramNameVoteInfo: newTestVoteInfo(t, commonPb.VoteStatus_AGREE, "admin2", payloadBytes),
+	})
+	require.Nil(t, err)
+	require.Nil(t, result)
+	require.Equal(t, []string{syscontract.SystemContract_CONTRACT_MANAGE.String() + "-" +
+		syscontract.ContractManageFunction_FREEZE_CONTRACT.String()}, env.calls)
+}
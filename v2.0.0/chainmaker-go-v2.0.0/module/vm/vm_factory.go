@@ -20,6 +20,7 @@ import (
 	"chainmaker.org/chainmaker-go/evm"
 	"chainmaker.org/chainmaker-go/gasm"
 	"chainmaker.org/chainmaker-go/logger"
+	"chainmaker.org/chainmaker-go/utils"
 	"chainmaker.org/chainmaker-go/vm/native"
 	"chainmaker.org/chainmaker-go/wasmer"
 	"chainmaker.org/chainmaker-go/wxvm"
@@ -175,6 +176,12 @@ func (m *VmManagerImpl) runUserContract(contract *commonPb.Contract, method stri
 	//	myContract = dbContract
 	//}
 
+	if err := m.verifyMethodAcl(myContract, method, parameters, txContext); err != nil {
+		contractResult.Message = err.Error()
+		m.Log.Warnf("failed to run user contract, %s", err)
+		return contractResult, commonPb.TxStatusCode_CONTRACT_FAIL
+	}
+
 	return m.invokeUserContractByRuntime(myContract, method, parameters, txContext, byteCode, gasUsed)
 }
 
@@ -293,8 +300,13 @@ func (m *VmManagerImpl) invokeUserContractByRuntime(contract *commonPb.Contract,
 		return fmt.Sprintf("invoke user contract[%s], runtime:%s,method:%s",
 			contract.Name, contract.RuntimeType.String(), method)
 	})
+	// the gas limit of tx is honoured by all the runtimes
+	gasLimit, err := utils.ParseTxGasLimit(txContext.GetTx().Payload.Limit)
+	if err != nil {
+		contractResult.Message = err.Error()
+		return contractResult, commonPb.TxStatusCode_INVALID_PARAMETER
+	}
 	var runtimeInstance RuntimeInstance
-	var err error
 	switch runtimeType {
 	case commonPb.RuntimeType_WASMER:
 		runtimeInstance, err = m.WasmerVmPoolManager.NewRuntimeInstance(contract, byteCode)
@@ -392,6 +404,10 @@ func (m *VmManagerImpl) invokeUserContractByRuntime(contract *commonPb.Contract,
 	}
 
 	runtimeContractResult := runtimeInstance.Invoke(contract, method, byteCode, parameters, txContext, gasUsed)
+	if runtimeContractResult.Code == 0 && runtimeContractResult.GasUsed > gasLimit {
+		runtimeContractResult.Code = 1
+		runtimeContractResult.Message = fmt.Sprintf("out of gas %d/%d", runtimeContractResult.GasUsed, gasLimit)
+	}
 	if runtimeContractResult.Code == 0 {
 		return runtimeContractResult, commonPb.TxStatusCode_SUCCESS
 	} else {
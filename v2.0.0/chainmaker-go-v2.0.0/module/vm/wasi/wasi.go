@@ -684,6 +684,7 @@ func (w *WacsiImpl) ExecuteQuery(requestBody []byte, contractName string, txSimC
 		}
 		changeCurrentDB(chainId, contractName, transaction)
 		rows, err = transaction.QueryMulti(sql)
+		txSimContext.PutRecord(contractName, []byte(sql), protocol.SqlTypeDql)
 	}
 
 	index := atomic.AddInt32(&w.rowIndex, 1)
@@ -723,6 +724,7 @@ func (w *WacsiImpl) ExecuteQueryOne(requestBody []byte, contractName string, txS
 			}
 			changeCurrentDB(chainId, contractName, transaction)
 			row, err = transaction.QuerySingle(sql)
+			txSimContext.PutRecord(contractName, []byte(sql), protocol.SqlTypeDql)
 		}
 		var dataRow map[string][]byte
 		if row.IsEmpty() {
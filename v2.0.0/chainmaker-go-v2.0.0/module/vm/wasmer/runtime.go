@@ -67,9 +67,10 @@ func (r *RuntimeInstance) Invoke(contract *commonPb.Contract, method string, byt
 		defer r.pool.RevertInstance(instanceInfo)
 	}
 
+	gasLimit := utils.TxGasLimit(txContext.GetTx())
 	instance := instanceInfo.wasmInstance
 	instance.SetGasUsed(gasUsed)
-	instance.SetGasLimit(protocol.GasLimit)
+	instance.SetGasLimit(gasLimit)
 
 	var sc = NewSimContext(method, r.log, r.chainId)
 	defer sc.removeCtxPointer()
@@ -86,8 +87,8 @@ func (r *RuntimeInstance) Invoke(contract *commonPb.Contract, method string, byt
 
 	// gas Log
 	gas := instance.GetGasUsed()
-	if gas > protocol.GasLimit {
-		err = fmt.Errorf("out of gas %d/%d", gas, int64(protocol.GasLimit))
+	if gas > gasLimit {
+		err = fmt.Errorf("out of gas %d/%d", gas, gasLimit)
 	}
 	logStr += fmt.Sprintf("used gas %d ", gas)
 	contractResult.GasUsed = gas
@@ -10,6 +10,7 @@ import (
 	"runtime/debug"
 
 	"chainmaker.org/chainmaker-go/logger"
+	"chainmaker.org/chainmaker-go/utils"
 	"chainmaker.org/chainmaker-go/wxvm/xvm"
 	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
 	"chainmaker.org/chainmaker/protocol/v2"
@@ -57,7 +58,8 @@ func (r *RuntimeInstance) Invoke(contract *commonPb.Contract, method string, byt
 		return
 	}
 
-	if inst, err := xvm.CreateInstance(context.ID, execCode, method, contract, gasUsed, int64(protocol.GasLimit)); err != nil {
+	if inst, err := xvm.CreateInstance(context.ID, execCode, method, contract, gasUsed,
+		int64(utils.TxGasLimit(tx))); err != nil {
 		contractResult.Code = 1
 		contractResult.Message = err.Error()
 		return
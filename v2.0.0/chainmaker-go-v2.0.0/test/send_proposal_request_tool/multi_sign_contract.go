@@ -192,6 +192,17 @@ func multiSignVote() error {
 	if err != nil {
 		return err
 	}
+	// the vote of a chain config request is packed as a config tx
+	multiPayload := &commonPb.Payload{}
+	if err = proto.Unmarshal(multiSignInfo.PayloadBytes, multiPayload); err != nil {
+		return err
+	}
+	if multiPayload.ContractName == syscontract.SystemContract_CHAIN_CONFIG.String() {
+		pairs = append(pairs, &commonPb.KeyValuePair{
+			Key:   "contract_name",
+			Value: []byte(multiPayload.ContractName),
+		})
+	}
 
 	var voteInfo *commonPb.MultiSignVoteInfo
 	if voteStatus {
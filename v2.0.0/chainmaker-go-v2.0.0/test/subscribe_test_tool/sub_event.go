@@ -16,6 +16,7 @@ import (
 
 	"chainmaker.org/chainmaker/pb-go/v2/common"
 	"chainmaker.org/chainmaker/pb-go/v2/syscontract"
+	"chainmaker.org/chainmaker/sdk-go/v2/utils"
 )
 
 func SubscribeEventCMD() *cobra.Command {
@@ -27,7 +28,7 @@ func SubscribeEventCMD() *cobra.Command {
 			ctx, cancel := context.WithCancel(context.Background())
 			defer cancel()
 
-			c, err := subscribeContractEvent(ctx, topic, contractName)
+			c, err := subscribeContractEvent(ctx, startBlock, endBlock, topic, contractName)
 			if err != nil {
 				return err
 			}
@@ -60,7 +61,8 @@ func SubscribeEventCMD() *cobra.Command {
 	return cmd
 }
 
-func subscribeContractEvent(ctx context.Context, topic string, contractName string) (<-chan interface{}, error) {
+func subscribeContractEvent(ctx context.Context, startBlock, endBlock int64, topic string,
+	contractName string) (<-chan interface{}, error) {
 
 	payload := createPayload(chainId, "", common.TxType_SUBSCRIBE, syscontract.SystemContract_SUBSCRIBE_MANAGE.String(),
 		syscontract.SubscribeFunction_SUBSCRIBE_CONTRACT_EVENT.String(), []*common.KeyValuePair{
@@ -72,6 +74,14 @@ func subscribeContractEvent(ctx context.Context, topic string, contractName stri
 				Key:   syscontract.SubscribeContractEvent_CONTRACT_NAME.String(),
 				Value: []byte(contractName),
 			},
+			{
+				Key:   syscontract.SubscribeBlock_START_BLOCK.String(),
+				Value: utils.I64ToBytes(startBlock),
+			},
+			{
+				Key:   syscontract.SubscribeBlock_END_BLOCK.String(),
+				Value: utils.I64ToBytes(endBlock),
+			},
 		}, 0,
 	)
 
@@ -42,6 +42,12 @@ var (
 	blockHeight    uint64
 	withRWSet      bool
 	txId           string
+	rule           string
+	orgList        string
+	roleList       string
+	migrateMethod  string
+	description    string
+	contractStatus string
 
 	adminKeyFilePaths string
 	adminCrtFilePaths string
@@ -117,6 +123,12 @@ const (
 	flagDelegator              = "delegator"
 	flagValidator              = "validator"
 	flagEpochID                = "epoch-id"
+	flagRule                   = "rule"
+	flagOrgList                = "org-list"
+	flagRoleList               = "role-list"
+	flagMigrateMethod          = "migrate-method"
+	flagDescription            = "description"
+	flagContractStatus         = "status"
 )
 
 func ClientCMD() *cobra.Command {
@@ -165,6 +177,12 @@ func init() {
 	flags.BoolVar(&withRWSet, flagWithRWSet, true, "whether with RWSet, default true")
 	flags.Uint64Var(&blockHeight, flagBlockHeight, 0, "specify block height, default 0")
 	flags.StringVar(&txId, flagTxId, "", "specify tx id")
+	flags.StringVar(&rule, flagRule, "", "specify the access rule, such as: ANY, ALL, MAJORITY, FORBIDDEN, 2, 2/3")
+	flags.StringVar(&orgList, flagOrgList, "", "specify the org ids allowed by the access rule, use ',' to separate")
+	flags.StringVar(&roleList, flagRoleList, "", "specify the roles allowed by the access rule, such as: ADMIN,CLIENT")
+	flags.StringVar(&migrateMethod, flagMigrateMethod, "", "specify the method of the new contract invoked after the upgrade to migrate the state")
+	flags.StringVar(&description, flagDescription, "", "specify the human readable description of user contract")
+	flags.StringVar(&contractStatus, flagContractStatus, "", "specify contract status, such as: normal, frozen, revoked")
 
 	// Admin秘钥和证书列表
 	//    - 使用逗号','分割
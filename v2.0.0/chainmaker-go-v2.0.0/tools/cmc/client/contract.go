@@ -18,6 +18,7 @@ func contractCMD() *cobra.Command {
 
 	contractCmd.AddCommand(userContractCMD())
 	contractCmd.AddCommand(systemContractCMD())
+	contractCmd.AddCommand(listContractCMD())
 
 	return contractCmd
 }
@@ -0,0 +1,92 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package client
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"chainmaker.org/chainmaker-go/tools/cmc/util"
+	"chainmaker.org/chainmaker-go/utils"
+	"chainmaker.org/chainmaker/pb-go/v2/common"
+	"chainmaker.org/chainmaker/pb-go/v2/syscontract"
+)
+
+func listContractCMD() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "list contracts command",
+		Long:  "list the contracts with the metadata, filtered by the runtime type and the status",
+		RunE: func(_ *cobra.Command, _ []string) error {
+			return listContract()
+		},
+	}
+
+	attachFlags(cmd, []string{
+		flagUserSignKeyFilePath, flagUserSignCrtFilePath, flagUserTlsKeyFilePath, flagUserTlsCrtFilePath,
+		flagSdkConfPath, flagOrgId, flagChainId, flagEnableCertHash, flagRuntimeType, flagContractStatus,
+	})
+
+	cmd.MarkFlagRequired(flagSdkConfPath)
+
+	return cmd
+}
+
+func listContract() error {
+	pairs := make(map[string]string)
+	if runtimeType != "" {
+		if _, ok := common.RuntimeType_value[runtimeType]; !ok {
+			return fmt.Errorf("unknown runtime type [%s]", runtimeType)
+		}
+		pairs[syscontract.InitContract_CONTRACT_RUNTIME_TYPE.String()] = runtimeType
+	}
+	if contractStatus != "" {
+		status := strings.ToUpper(contractStatus)
+		if _, ok := common.ContractStatus_value[status]; !ok {
+			return fmt.Errorf("unknown contract status [%s]", contractStatus)
+		}
+		pairs[utils.ContractListStatus] = status
+	}
+
+	client, err := util.CreateChainClient(sdkConfPath, chainId, orgId, userTlsCrtFilePath, userTlsKeyFilePath, userSignCrtFilePath, userSignKeyFilePath)
+	if err != nil {
+		return err
+	}
+	defer client.Stop()
+
+	resp, err := client.QuerySystemContract(syscontract.SystemContract_CONTRACT_MANAGE.String(),
+		utils.ContractQueryGetContractList, util.ConvertParameters(pairs), -1)
+	if err != nil {
+		return fmt.Errorf("query contract list failed, %s", err.Error())
+	}
+	if resp.Code != common.TxStatusCode_SUCCESS {
+		return fmt.Errorf("query contract list failed, [code:%d]/[msg:%s]", resp.Code, resp.Message)
+	}
+
+	fmt.Printf("contracts: %s\n", resp.ContractResult.Result)
+
+	return nil
+}
+
+// contractMetadataParameters returns the parameters of the abi and the description recorded as the contract metadata
+func contractMetadataParameters() ([]*common.KeyValuePair, error) {
+	pairs := make(map[string]string)
+	if abiFilePath != "" {
+		abiBytes, err := ioutil.ReadFile(abiFilePath)
+		if err != nil {
+			return nil, err
+		}
+		pairs[utils.ContractMetadataAbi] = string(abiBytes)
+	}
+	if description != "" {
+		pairs[utils.ContractMetadataDescription] = description
+	}
+	return util.ConvertParameters(pairs), nil
+}
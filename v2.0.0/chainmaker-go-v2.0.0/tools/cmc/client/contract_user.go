@@ -21,6 +21,7 @@ import (
 	"github.com/spf13/cobra"
 
 	"chainmaker.org/chainmaker-go/tools/cmc/util"
+	"chainmaker.org/chainmaker-go/utils"
 	"chainmaker.org/chainmaker/pb-go/v2/common"
 	sdk "chainmaker.org/chainmaker/sdk-go/v2"
 )
@@ -54,6 +55,10 @@ func userContractCMD() *cobra.Command {
 	userContractCmd.AddCommand(unfreezeUserContractCMD())
 	userContractCmd.AddCommand(revokeUserContractCMD())
 	userContractCmd.AddCommand(getUserContractCMD())
+	userContractCmd.AddCommand(rollbackUserContractCMD())
+	userContractCmd.AddCommand(setMethodAclCMD())
+	userContractCmd.AddCommand(deleteMethodAclCMD())
+	userContractCmd.AddCommand(getMethodAclCMD())
 
 	return userContractCmd
 }
@@ -72,7 +77,7 @@ func createUserContractCMD() *cobra.Command {
 		flagUserTlsKeyFilePath, flagUserTlsCrtFilePath, flagUserSignKeyFilePath, flagUserSignCrtFilePath,
 		flagSdkConfPath, flagContractName, flagVersion, flagByteCodePath, flagOrgId, flagChainId, flagSendTimes,
 		flagRuntimeType, flagTimeout, flagParams, flagSyncResult, flagEnableCertHash,
-		flagAdminKeyFilePaths, flagAdminCrtFilePaths,
+		flagAdminKeyFilePaths, flagAdminCrtFilePaths, flagAbiFilePath, flagDescription,
 	})
 
 	cmd.MarkFlagRequired(flagSdkConfPath)
@@ -168,7 +173,7 @@ func upgradeUserContractCMD() *cobra.Command {
 		flagUserSignKeyFilePath, flagUserSignCrtFilePath, flagUserTlsKeyFilePath, flagUserTlsCrtFilePath,
 		flagSdkConfPath, flagContractName, flagVersion, flagByteCodePath, flagOrgId, flagChainId, flagSendTimes,
 		flagRuntimeType, flagTimeout, flagParams, flagSyncResult, flagEnableCertHash,
-		flagAdminCrtFilePaths, flagAdminKeyFilePaths,
+		flagAdminCrtFilePaths, flagAdminKeyFilePaths, flagMigrateMethod, flagAbiFilePath, flagDescription,
 	})
 
 	cmd.MarkFlagRequired(flagSdkConfPath)
@@ -303,6 +308,11 @@ func createUserContract() error {
 	if err != nil {
 		return err
 	}
+	metadata, err := contractMetadataParameters()
+	if err != nil {
+		return err
+	}
+	payload.Parameters = append(payload.Parameters, metadata...)
 
 	endorsementEntrys := make([]*common.EndorsementEntry, len(adminKeys))
 	for i := range adminKeys {
@@ -501,12 +511,20 @@ func upgradeUserContract() error {
 			return err
 		}
 	}
+	if migrateMethod != "" {
+		pairs[utils.ContractUpgradeMigrateMethod] = migrateMethod
+	}
 	pairsKv := util.ConvertParameters(pairs)
 	fmt.Printf("upgrade user contract params:%+v\n", pairsKv)
 	payload, err := client.CreateContractUpgradePayload(contractName, version, byteCodePath, common.RuntimeType(rt), pairsKv)
 	if err != nil {
 		return err
 	}
+	metadata, err := contractMetadataParameters()
+	if err != nil {
+		return err
+	}
+	payload.Parameters = append(payload.Parameters, metadata...)
 
 	endorsementEntrys := make([]*common.EndorsementEntry, len(adminKeys))
 	for i := range adminKeys {
@@ -0,0 +1,175 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package client
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"chainmaker.org/chainmaker-go/tools/cmc/util"
+	"chainmaker.org/chainmaker-go/utils"
+	"chainmaker.org/chainmaker/pb-go/v2/common"
+	"chainmaker.org/chainmaker/pb-go/v2/syscontract"
+	sdk "chainmaker.org/chainmaker/sdk-go/v2"
+)
+
+func setMethodAclCMD() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "set-method-acl",
+		Short: "set the access control list of a user contract method",
+		Long: "set the access control list of a user contract method, the signers of the tx which calls " +
+			"the method must satisfy the rule, org list and role list",
+		RunE: func(_ *cobra.Command, _ []string) error {
+			return setOrDeleteMethodAcl(utils.ContractManageSetMethodAcl)
+		},
+	}
+
+	attachFlags(cmd, []string{
+		flagUserSignKeyFilePath, flagUserSignCrtFilePath, flagUserTlsKeyFilePath, flagUserTlsCrtFilePath,
+		flagSdkConfPath, flagContractName, flagMethod, flagRule, flagOrgList, flagRoleList, flagOrgId, flagChainId,
+		flagTimeout, flagSyncResult, flagEnableCertHash, flagAdminCrtFilePaths, flagAdminKeyFilePaths,
+	})
+
+	cmd.MarkFlagRequired(flagSdkConfPath)
+	cmd.MarkFlagRequired(flagContractName)
+	cmd.MarkFlagRequired(flagMethod)
+	cmd.MarkFlagRequired(flagRule)
+	cmd.MarkFlagRequired(flagAdminCrtFilePaths)
+	cmd.MarkFlagRequired(flagAdminKeyFilePaths)
+
+	return cmd
+}
+
+func deleteMethodAclCMD() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "delete-method-acl",
+		Short: "delete the access control list of a user contract method",
+		Long:  "delete the access control list of a user contract method",
+		RunE: func(_ *cobra.Command, _ []string) error {
+			return setOrDeleteMethodAcl(utils.ContractManageDeleteMethodAcl)
+		},
+	}
+
+	attachFlags(cmd, []string{
+		flagUserSignKeyFilePath, flagUserSignCrtFilePath, flagUserTlsKeyFilePath, flagUserTlsCrtFilePath,
+		flagSdkConfPath, flagContractName, flagMethod, flagOrgId, flagChainId, flagTimeout, flagSyncResult,
+		flagEnableCertHash, flagAdminCrtFilePaths, flagAdminKeyFilePaths,
+	})
+
+	cmd.MarkFlagRequired(flagSdkConfPath)
+	cmd.MarkFlagRequired(flagContractName)
+	cmd.MarkFlagRequired(flagMethod)
+	cmd.MarkFlagRequired(flagAdminCrtFilePaths)
+	cmd.MarkFlagRequired(flagAdminKeyFilePaths)
+
+	return cmd
+}
+
+func getMethodAclCMD() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "get-method-acl",
+		Short: "get the access control lists of the methods of a user contract",
+		Long:  "get the access control lists of the methods of a user contract, all the methods if --method is not given",
+		RunE: func(_ *cobra.Command, _ []string) error {
+			return getMethodAcl()
+		},
+	}
+
+	attachFlags(cmd, []string{
+		flagUserSignKeyFilePath, flagUserSignCrtFilePath, flagUserTlsKeyFilePath, flagUserTlsCrtFilePath,
+		flagSdkConfPath, flagContractName, flagMethod, flagOrgId, flagChainId, flagEnableCertHash,
+	})
+
+	cmd.MarkFlagRequired(flagSdkConfPath)
+	cmd.MarkFlagRequired(flagContractName)
+
+	return cmd
+}
+
+func setOrDeleteMethodAcl(manageMethod string) error {
+	adminKeys := strings.Split(adminKeyFilePaths, ",")
+	adminCrts := strings.Split(adminCrtFilePaths, ",")
+	if len(adminKeys) == 0 || len(adminCrts) == 0 {
+		return ErrAdminOrgIdKeyCertIsEmpty
+	}
+	if len(adminKeys) != len(adminCrts) {
+		return fmt.Errorf(ADMIN_ORGID_KEY_CERT_LENGTH_NOT_EQUAL_FORMAT, len(adminKeys), len(adminCrts))
+	}
+
+	client, err := util.CreateChainClient(sdkConfPath, chainId, orgId, userTlsCrtFilePath, userTlsKeyFilePath, userSignCrtFilePath, userSignKeyFilePath)
+	if err != nil {
+		return err
+	}
+	defer client.Stop()
+
+	// the sdk has no payload of the method acl, the contract manage payload with the contract name is reused
+	payload, err := client.CreateContractFreezePayload(contractName)
+	if err != nil {
+		return fmt.Errorf("create contract manage %s payload failed, %s", manageMethod, err.Error())
+	}
+	payload.Method = manageMethod
+	pairs := map[string]string{
+		utils.ContractMethodAclMethodName: method,
+	}
+	if manageMethod == utils.ContractManageSetMethodAcl {
+		pairs[utils.ContractMethodAclRule] = rule
+		pairs[utils.ContractMethodAclOrgList] = orgList
+		pairs[utils.ContractMethodAclRoleList] = roleList
+	}
+	payload.Parameters = append(payload.Parameters, util.ConvertParameters(pairs)...)
+
+	endorsementEntrys := make([]*common.EndorsementEntry, len(adminKeys))
+	for i := range adminKeys {
+		e, err := sdk.SignPayloadWithPath(adminKeys[i], adminCrts[i], payload)
+		if err != nil {
+			return err
+		}
+
+		endorsementEntrys[i] = e
+	}
+
+	resp, err := client.SendContractManageRequest(payload, endorsementEntrys, timeout, syncResult)
+	if err != nil {
+		return fmt.Errorf(SEND_CONTRACT_MANAGE_REQUEST_FAILED_FORMAT, err.Error())
+	}
+
+	err = util.CheckProposalRequestResp(resp, false)
+	if err != nil {
+		return fmt.Errorf(CHECK_PROPOSAL_RESPONSE_FAILED_FORMAT, err.Error())
+	}
+
+	fmt.Printf("%s resp: %+v\n", manageMethod, resp)
+
+	return nil
+}
+
+func getMethodAcl() error {
+	client, err := util.CreateChainClient(sdkConfPath, chainId, orgId, userTlsCrtFilePath, userTlsKeyFilePath, userSignCrtFilePath, userSignKeyFilePath)
+	if err != nil {
+		return err
+	}
+	defer client.Stop()
+
+	pairs := map[string]string{
+		syscontract.GetContractInfo_CONTRACT_NAME.String(): contractName,
+		utils.ContractMethodAclMethodName:                  method,
+	}
+	resp, err := client.QuerySystemContract(syscontract.SystemContract_CONTRACT_MANAGE.String(),
+		utils.ContractQueryGetMethodAcl, util.ConvertParameters(pairs), -1)
+	if err != nil {
+		return fmt.Errorf("query method acl failed, %s", err.Error())
+	}
+	if resp.Code != common.TxStatusCode_SUCCESS {
+		return fmt.Errorf("query method acl failed, [code:%d]/[msg:%s]", resp.Code, resp.Message)
+	}
+
+	fmt.Printf("method acls of contract %s: %s\n", contractName, resp.ContractResult.Result)
+
+	return nil
+}
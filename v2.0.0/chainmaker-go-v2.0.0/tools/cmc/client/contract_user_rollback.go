@@ -0,0 +1,96 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package client
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"chainmaker.org/chainmaker-go/tools/cmc/util"
+	"chainmaker.org/chainmaker-go/utils"
+	"chainmaker.org/chainmaker/pb-go/v2/common"
+	"chainmaker.org/chainmaker/pb-go/v2/syscontract"
+	sdk "chainmaker.org/chainmaker/sdk-go/v2"
+)
+
+func rollbackUserContractCMD() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "rollback",
+		Short: "rollback user contract command",
+		Long:  "rollback user contract to a previous version, the current version is retained and can be rolled back to",
+		RunE: func(_ *cobra.Command, _ []string) error {
+			return rollbackUserContract()
+		},
+	}
+
+	attachFlags(cmd, []string{
+		flagUserSignKeyFilePath, flagUserSignCrtFilePath, flagUserTlsKeyFilePath, flagUserTlsCrtFilePath,
+		flagSdkConfPath, flagContractName, flagVersion, flagOrgId, flagChainId, flagTimeout, flagSyncResult,
+		flagEnableCertHash, flagAdminCrtFilePaths, flagAdminKeyFilePaths,
+	})
+
+	cmd.MarkFlagRequired(flagSdkConfPath)
+	cmd.MarkFlagRequired(flagContractName)
+	cmd.MarkFlagRequired(flagVersion)
+	cmd.MarkFlagRequired(flagAdminCrtFilePaths)
+	cmd.MarkFlagRequired(flagAdminKeyFilePaths)
+
+	return cmd
+}
+
+func rollbackUserContract() error {
+	adminKeys := strings.Split(adminKeyFilePaths, ",")
+	adminCrts := strings.Split(adminCrtFilePaths, ",")
+	if len(adminKeys) == 0 || len(adminCrts) == 0 {
+		return ErrAdminOrgIdKeyCertIsEmpty
+	}
+	if len(adminKeys) != len(adminCrts) {
+		return fmt.Errorf(ADMIN_ORGID_KEY_CERT_LENGTH_NOT_EQUAL_FORMAT, len(adminKeys), len(adminCrts))
+	}
+
+	client, err := util.CreateChainClient(sdkConfPath, chainId, orgId, userTlsCrtFilePath, userTlsKeyFilePath, userSignCrtFilePath, userSignKeyFilePath)
+	if err != nil {
+		return err
+	}
+	defer client.Stop()
+
+	// the sdk has no payload of the rollback, the contract manage payload with the contract name is reused
+	payload, err := client.CreateContractFreezePayload(contractName)
+	if err != nil {
+		return fmt.Errorf("create contract manage %s payload failed, %s", utils.ContractManageRollbackContract, err.Error())
+	}
+	payload.Method = utils.ContractManageRollbackContract
+	payload.Parameters = append(payload.Parameters, util.ConvertParameters(map[string]string{
+		syscontract.InitContract_CONTRACT_VERSION.String(): version,
+	})...)
+
+	endorsementEntrys := make([]*common.EndorsementEntry, len(adminKeys))
+	for i := range adminKeys {
+		e, err := sdk.SignPayloadWithPath(adminKeys[i], adminCrts[i], payload)
+		if err != nil {
+			return err
+		}
+
+		endorsementEntrys[i] = e
+	}
+
+	resp, err := client.SendContractManageRequest(payload, endorsementEntrys, timeout, syncResult)
+	if err != nil {
+		return fmt.Errorf(SEND_CONTRACT_MANAGE_REQUEST_FAILED_FORMAT, err.Error())
+	}
+
+	err = util.CheckProposalRequestResp(resp, false)
+	if err != nil {
+		return fmt.Errorf(CHECK_PROPOSAL_RESPONSE_FAILED_FORMAT, err.Error())
+	}
+
+	fmt.Printf("rollback contract resp: %+v\n", resp)
+
+	return nil
+}
@@ -3,6 +3,7 @@ module chainmaker.org/chainmaker-go/tools/cmc
 go 1.15
 
 require (
+	chainmaker.org/chainmaker-go/utils v0.0.0
 	chainmaker.org/chainmaker/common/v2 v2.0.0
 	chainmaker.org/chainmaker/pb-go/v2 v2.0.0
 	chainmaker.org/chainmaker/sdk-go/v2 v2.0.0
@@ -22,3 +23,5 @@ require (
 	gorm.io/driver/mysql v1.0.6
 	gorm.io/gorm v1.21.9
 )
+
+replace chainmaker.org/chainmaker-go/utils => ../../module/utils
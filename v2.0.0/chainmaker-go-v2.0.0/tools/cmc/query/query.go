@@ -37,6 +37,7 @@ func NewQueryOnChainCMD() *cobra.Command {
 	cmd.AddCommand(newQueryBlockByHashOnChainCMD())
 	cmd.AddCommand(newQueryBlockByTxIdOnChainCMD())
 	cmd.AddCommand(newQueryArchivedHeightOnChainCMD())
+	cmd.AddCommand(newQueryTxProofCMD())
 
 	return cmd
 }
@@ -0,0 +1,169 @@
+// Copyright (C) BABEC. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package query
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/hokaccha/go-prettyjson"
+	"github.com/spf13/cobra"
+
+	"chainmaker.org/chainmaker-go/tools/cmc/util"
+	"chainmaker.org/chainmaker-go/utils"
+	"chainmaker.org/chainmaker/pb-go/v2/common"
+	"chainmaker.org/chainmaker/pb-go/v2/syscontract"
+)
+
+const (
+	flagTrustRootPaths = "trust-root-path"
+	flagMinVoters      = "min-voters"
+	flagProofFile      = "proof-file"
+	flagOutput         = "output"
+	flagVerifyByNode   = "verify-by-node"
+
+	// the query method of blockcontract.MethodGetTxProofByTxId
+	methodGetTxProofByTxId = "GET_TX_PROOF_BY_TX_ID"
+	// the query method of blockcontract.MethodVerifyTxProof
+	methodVerifyTxProof = "VERIFY_TX_PROOF"
+)
+
+var (
+	trustRootPaths []string
+	minVoters      int
+	proofFile      string
+	output         string
+	verifyByNode   bool
+)
+
+// newQueryTxProofCMD `query tx-proof` command implementation
+func newQueryTxProofCMD() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "tx-proof [txid]",
+		Short: "query the inclusion proof of tx by txid and verify it offline",
+		Long: "query the inclusion proof of tx by txid and verify it offline, " +
+			"the proof is read from --proof-file instead if txid is not given. " +
+			"The proof is supported by TBFT and DPoS chains only, whose blocks carry the precommit votes, " +
+			"the query fails on the chains of other consensus types, e.g. Solo, Raft and HotStuff",
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runQueryTxProofCMD(args)
+		},
+	}
+
+	cmd.Flags().StringSliceVar(&trustRootPaths, flagTrustRootPaths, nil,
+		"specify trusted root certificate paths of the chain, the proof is verified if given")
+	cmd.Flags().IntVar(&minVoters, flagMinVoters, 0,
+		"specify the minimal number of consensus nodes which precommit the block, "+
+			"the quorum of the consensus nodes in the chain config of the proof is always required")
+	cmd.Flags().StringVar(&proofFile, flagProofFile, "", "specify the proof file to verify")
+	cmd.Flags().StringVar(&output, flagOutput, "", "specify the file to save the proof")
+	cmd.Flags().BoolVar(&verifyByNode, flagVerifyByNode, false,
+		"verify the proof against the block headers of the node in sdk config, e.g. a light node")
+	util.AttachFlags(cmd, flags, []string{
+		flagSdkConfPath, flagChainId,
+	})
+	return cmd
+}
+
+func runQueryTxProofCMD(args []string) error {
+	var proofBytes []byte
+	var err error
+	if len(args) == 1 {
+		if proofBytes, err = queryTxProof(args[0]); err != nil {
+			return err
+		}
+	} else if proofFile != "" {
+		if proofBytes, err = ioutil.ReadFile(proofFile); err != nil {
+			return err
+		}
+	} else {
+		return errors.New("either txid or --proof-file is required")
+	}
+
+	proof := &utils.TxProof{}
+	if err = json.Unmarshal(proofBytes, proof); err != nil {
+		return fmt.Errorf("unmarshal tx proof failed, %s", err)
+	}
+	if output != "" {
+		if err = ioutil.WriteFile(output, proofBytes, 0600); err != nil {
+			return err
+		}
+	}
+	out, err := prettyjson.Marshal(proof)
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(out))
+
+	if verifyByNode {
+		height, err := verifyTxProofByNode(proofBytes)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("tx %s is included in block %s, verified by the node\n", proof.Tx.Payload.TxId, height)
+	}
+	if len(trustRootPaths) == 0 {
+		return nil
+	}
+	trustRoots := make([][]byte, 0, len(trustRootPaths))
+	for _, path := range trustRootPaths {
+		trustRoot, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		trustRoots = append(trustRoots, trustRoot)
+	}
+	// the quorum of the chain config in the proof is checked by VerifyTxProof
+	if minVoters <= 0 {
+		minVoters = 1
+	}
+	if err = utils.VerifyTxProof(proof, trustRoots, minVoters); err != nil {
+		return fmt.Errorf("verify tx proof failed, %s", err)
+	}
+	fmt.Printf("tx %s is included in block %d, verified with %d votes\n",
+		proof.Tx.Payload.TxId, proof.Header.BlockHeight, len(proof.Votes))
+	return nil
+}
+
+func queryTxProof(txId string) ([]byte, error) {
+	return queryChainQueryContract(methodGetTxProofByTxId, map[string]string{"txId": txId})
+}
+
+// verifyTxProofByNode returns the height of the block which includes the tx, verified by the node
+func verifyTxProofByNode(proofBytes []byte) (string, error) {
+	height, err := queryChainQueryContract(methodVerifyTxProof, map[string]string{"proof": string(proofBytes)})
+	if err != nil {
+		return "", err
+	}
+	return string(height), nil
+}
+
+func queryChainQueryContract(method string, params map[string]string) ([]byte, error) {
+	if sdkConfPath == "" || chainId == "" {
+		return nil, fmt.Errorf("--%s and --%s are required to query the node", flagSdkConfPath, flagChainId)
+	}
+	cc, err := util.CreateChainClient(sdkConfPath, chainId, "", "", "", "", "")
+	if err != nil {
+		return nil, err
+	}
+	defer cc.Stop()
+
+	resp, err := cc.QuerySystemContract(
+		syscontract.SystemContract_CHAIN_QUERY.String(),
+		method,
+		util.ConvertParameters(params),
+		-1,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Code != common.TxStatusCode_SUCCESS {
+		return nil, fmt.Errorf("query %s failed, [code:%d]/[msg:%s]", method, resp.Code, resp.Message)
+	}
+	return resp.ContractResult.Result, nil
+}